@@ -0,0 +1,128 @@
+// Package admin provides the administrative HTTP API for inspecting and changing rate limiter state at runtime.
+package admin
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Audit actions recorded by the admin API.
+const (
+	ActionBan             = "ban"
+	ActionUnban           = "unban"
+	ActionImportBans      = "import_bans"
+	ActionSetOverride     = "set_override"
+	ActionDeleteOverride  = "delete_override"
+	ActionImportOverrides = "import_overrides"
+	ActionSetReadOnly     = "set_read_only"
+	ActionClearReadOnly   = "clear_read_only"
+	ActionSetFaults       = "set_faults"
+	ActionClearFaults     = "clear_faults"
+)
+
+// AuditEntry is a structured record of an administrative action.
+type AuditEntry struct {
+	// Time is when the action was applied.
+	Time time.Time `json:"time"`
+	// Actor identifies who applied the action.
+	Actor string `json:"actor"`
+	// Action is the kind of change applied (e.g., "ban").
+	Action string `json:"action"`
+	// LimiterKey is the key of the limiter the action applies to.
+	LimiterKey string `json:"limiter_key"`
+	// Identifier is the identifier the action applies to, if any.
+	Identifier string `json:"identifier,omitempty"`
+	// Old is the value before the action, or nil if there was none.
+	Old any `json:"old,omitempty"`
+	// New is the value after the action, or nil if it was removed.
+	New any `json:"new,omitempty"`
+}
+
+// AuditQuery filters audit entries. Empty fields match all entries.
+type AuditQuery struct {
+	LimiterKey string
+	Identifier string
+	Action     string
+	Actor      string
+	// Since excludes entries recorded before it.
+	Since time.Time
+	// Limit is the maximum number of entries returned (newest first); 0 means no limit.
+	Limit int
+}
+
+// matches reports whether the entry satisfies the query filters.
+func (q AuditQuery) matches(e AuditEntry) bool {
+	return (q.LimiterKey == "" || e.LimiterKey == q.LimiterKey) &&
+		(q.Identifier == "" || e.Identifier == q.Identifier) &&
+		(q.Action == "" || e.Action == q.Action) &&
+		(q.Actor == "" || e.Actor == q.Actor) &&
+		(q.Since.IsZero() || !e.Time.Before(q.Since))
+}
+
+// full reports whether the query limit has been reached.
+func (q AuditQuery) full(entries []AuditEntry) bool {
+	return q.Limit > 0 && len(entries) >= q.Limit
+}
+
+// AuditSink stores audit entries and answers queries over them.
+type AuditSink interface {
+	// Record stores the entry.
+	Record(ctx context.Context, entry AuditEntry) error
+	// Query returns the entries matching the query, newest first.
+	Query(ctx context.Context, query AuditQuery) ([]AuditEntry, error)
+	io.Closer
+}
+
+// DefaultMemoryAuditCapacity is the number of entries kept by a memory audit sink created without a positive capacity.
+const DefaultMemoryAuditCapacity = 1000
+
+// MemoryAuditSink keeps the most recent audit entries in memory. Entries are lost on restart.
+type MemoryAuditSink struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+	// next is the index the next entry is written to once the buffer is full.
+	next     int
+	capacity int
+}
+
+// NewMemoryAuditSink creates an in-memory audit sink holding up to capacity entries.
+func NewMemoryAuditSink(capacity int) *MemoryAuditSink {
+	if capacity <= 0 {
+		capacity = DefaultMemoryAuditCapacity
+	}
+	return &MemoryAuditSink{capacity: capacity}
+}
+
+// Record stores the entry, evicting the oldest entry once the sink is full.
+func (s *MemoryAuditSink) Record(_ context.Context, entry AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) < s.capacity {
+		s.entries = append(s.entries, entry)
+		return nil
+	}
+	s.entries[s.next] = entry
+	s.next = (s.next + 1) % s.capacity
+	return nil
+}
+
+// Query returns the stored entries matching the query, newest first.
+func (s *MemoryAuditSink) Query(_ context.Context, query AuditQuery) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []AuditEntry
+	for i := len(s.entries) - 1; i >= 0 && !query.full(result); i-- {
+		entry := s.entries[(s.next+i)%len(s.entries)]
+		if query.matches(entry) {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+// Close does nothing; it exists to satisfy AuditSink.
+func (s *MemoryAuditSink) Close() error {
+	return nil
+}
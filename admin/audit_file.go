@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// FileAuditSink appends audit entries to a file as JSON lines.
+type FileAuditSink struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewFileAuditSink opens (or creates) the audit log file at path for appending.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log '%s': %w", path, err)
+	}
+	return &FileAuditSink{path: path, file: file}, nil
+}
+
+// Record appends the entry to the audit log file.
+func (s *FileAuditSink) Record(_ context.Context, entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal audit entry: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write audit log '%s': %w", s.path, err)
+	}
+	return nil
+}
+
+// Query scans the audit log file and returns the entries matching the query, newest first.
+// Lines that cannot be decoded are skipped.
+func (s *FileAuditSink) Query(_ context.Context, query AuditQuery) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log '%s': %w", s.path, err)
+	}
+	defer file.Close()
+
+	var matched []AuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Warn().Err(err).Str("path", s.path).Msg("Admin: Skipping malformed audit log line")
+			continue
+		}
+		if query.matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log '%s': %w", s.path, err)
+	}
+
+	// The file is in chronological order; return newest first
+	var result []AuditEntry
+	for i := len(matched) - 1; i >= 0 && !query.full(result); i-- {
+		result = append(result, matched[i])
+	}
+	return result, nil
+}
+
+// Close closes the audit log file.
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// DefaultAuditStream is the Redis stream used by a Redis audit sink created without a stream name.
+const DefaultAuditStream = "ratelimiter:audit"
+
+// auditStreamField is the stream entry field holding the JSON-encoded audit entry.
+const auditStreamField = "entry"
+
+// auditQueryPageSize is the number of stream entries fetched per round trip while answering a query.
+const auditQueryPageSize = 100
+
+// RedisAuditSink appends audit entries to a Redis stream, so entries from all instances are kept in one place.
+type RedisAuditSink struct {
+	client *redis.Client
+	stream string
+	// maxLen approximately caps the stream length; 0 keeps all entries.
+	maxLen int64
+}
+
+// NewRedisAuditSink creates an audit sink writing to the given Redis stream, trimmed to about maxLen entries if maxLen is positive.
+// The sink takes ownership of the client and closes it on Close.
+func NewRedisAuditSink(client *redis.Client, stream string, maxLen int64) *RedisAuditSink {
+	if stream == "" {
+		stream = DefaultAuditStream
+	}
+	return &RedisAuditSink{client: client, stream: stream, maxLen: maxLen}
+}
+
+// Record appends the entry to the audit stream.
+func (s *RedisAuditSink) Record(ctx context.Context, entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal audit entry: %w", err)
+	}
+	args := &redis.XAddArgs{
+		Stream: s.stream,
+		Values: map[string]interface{}{auditStreamField: data},
+	}
+	if s.maxLen > 0 {
+		args.MaxLen = s.maxLen
+		args.Approx = true
+	}
+	if err := s.client.XAdd(ctx, args).Err(); err != nil {
+		return fmt.Errorf("append to audit stream '%s': %w", s.stream, err)
+	}
+	return nil
+}
+
+// Query reads the audit stream from newest to oldest and returns the entries matching the query.
+func (s *RedisAuditSink) Query(ctx context.Context, query AuditQuery) ([]AuditEntry, error) {
+	var result []AuditEntry
+	start := "+"
+	for !query.full(result) {
+		messages, err := s.client.XRevRangeN(ctx, s.stream, start, "-", auditQueryPageSize).Result()
+		if err != nil {
+			return nil, fmt.Errorf("read audit stream '%s': %w", s.stream, err)
+		}
+		for _, message := range messages {
+			raw, _ := message.Values[auditStreamField].(string)
+			var entry AuditEntry
+			if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+				log.Warn().Err(err).Str("stream", s.stream).Str("id", message.ID).Msg("Admin: Skipping malformed audit stream entry")
+				continue
+			}
+			// Entries are read newest first, so nothing older can match once Since is passed
+			if !query.Since.IsZero() && entry.Time.Before(query.Since) {
+				return result, nil
+			}
+			if query.matches(entry) {
+				result = append(result, entry)
+				if query.full(result) {
+					break
+				}
+			}
+		}
+		if len(messages) < auditQueryPageSize {
+			break
+		}
+		// Continue after the oldest entry read (exclusive range)
+		start = "(" + messages[len(messages)-1].ID
+	}
+	return result, nil
+}
+
+// Close closes the Redis client.
+func (s *RedisAuditSink) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,123 @@
+package admin
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Role is the level of access granted to an admin API principal.
+type Role string
+
+// Supported roles. RoleMutate includes everything RoleRead allows.
+const (
+	// RoleRead allows inspecting state (e.g., listing bans, querying the audit log).
+	RoleRead Role = "read"
+	// RoleMutate additionally allows changing state (e.g., applying or lifting bans).
+	RoleMutate Role = "mutate"
+)
+
+// allows reports whether the role grants the required access.
+func (r Role) allows(required Role) bool {
+	switch r {
+	case RoleMutate:
+		return true
+	case RoleRead:
+		return required == RoleRead
+	default:
+		return false
+	}
+}
+
+// Principal is an authenticated caller of the admin API.
+type Principal struct {
+	// Name identifies the caller and is recorded as the actor in audit entries.
+	Name string
+	// Role is the access granted to the caller.
+	Role Role
+}
+
+// Authenticator identifies the principal making an admin request.
+// It returns false if the request does not carry credentials it recognizes.
+// Custom authenticators (e.g., validating an SSO session) can be passed to WithAuthenticators alongside the built-in ones.
+type Authenticator func(r *http.Request) (Principal, bool)
+
+// BearerTokenAuthenticator authenticates requests carrying "Authorization: Bearer <token>" for one of the given tokens.
+func BearerTokenAuthenticator(tokens map[string]Principal) Authenticator {
+	// Compare fixed-length digests in constant time so response timing doesn't reveal token prefixes
+	digests := make(map[[sha256.Size]byte]Principal, len(tokens))
+	for token, principal := range tokens {
+		digests[sha256.Sum256([]byte(token))] = principal
+	}
+	return func(r *http.Request) (Principal, bool) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			return Principal{}, false
+		}
+		digest := sha256.Sum256([]byte(token))
+		var match Principal
+		found := false
+		for candidate, principal := range digests {
+			if subtle.ConstantTimeCompare(candidate[:], digest[:]) == 1 {
+				match, found = principal, true
+			}
+		}
+		return match, found
+	}
+}
+
+// ClientCertAuthenticator authenticates requests presenting a verified TLS client certificate
+// whose subject common name is one of the given names.
+// The server must request and verify client certificates (e.g., tls.Config.ClientAuth set to tls.VerifyClientCertIfGiven).
+func ClientCertAuthenticator(commonNames map[string]Principal) Authenticator {
+	return func(r *http.Request) (Principal, bool) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return Principal{}, false
+		}
+		principal, ok := commonNames[r.TLS.VerifiedChains[0][0].Subject.CommonName]
+		return principal, ok
+	}
+}
+
+// principalKey is the context key for the authenticated principal.
+type principalKey struct{}
+
+// PrincipalFromContext returns the principal authenticated for the admin request, if any.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// authorize wraps an endpoint so it is only served to principals holding the required role.
+// Without authenticators every request is served, as before authentication was configured.
+func (h *Handler) authorize(required Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(h.authenticators) == 0 {
+			next(w, r)
+			return
+		}
+		principal, ok := h.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if !principal.Role.allows(required) {
+			writeError(w, http.StatusForbidden, "role '"+string(principal.Role)+"' may not perform this action")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+// authenticate returns the principal from the first authenticator recognizing the request.
+func (h *Handler) authenticate(r *http.Request) (Principal, bool) {
+	for _, authenticate := range h.authenticators {
+		if principal, ok := authenticate(r); ok {
+			return principal, true
+		}
+	}
+	return Principal{}, false
+}
@@ -0,0 +1,69 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"learn.ratelimiter/admin"
+	"learn.ratelimiter/banlist"
+)
+
+// TestAuthorization tests that admin endpoints require authentication and the role matching the action.
+func TestAuthorization(t *testing.T) {
+	authenticator := admin.BearerTokenAuthenticator(map[string]admin.Principal{
+		"viewer-token": {Name: "viewer", Role: admin.RoleRead},
+		"oncall-token": {Name: "oncall", Role: admin.RoleMutate},
+	})
+	handler := admin.NewHandler(banlist.New(), admin.NewMemoryAuditSink(0), admin.WithAuthenticators(authenticator))
+
+	serve := func(method, target, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	banBody := `{"limiter_key":"api","identifier":"1.2.3.4"}`
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		token  string
+		want   int
+	}{
+		{"NoToken", http.MethodGet, "/admin/bans", "", "", http.StatusUnauthorized},
+		{"UnknownToken", http.MethodGet, "/admin/bans", "", "wrong", http.StatusUnauthorized},
+		{"ReadInspects", http.MethodGet, "/admin/bans", "", "viewer-token", http.StatusOK},
+		{"ReadCannotMutate", http.MethodPost, "/admin/bans", banBody, "viewer-token", http.StatusForbidden},
+		{"MutateMutates", http.MethodPost, "/admin/bans", banBody, "oncall-token", http.StatusOK},
+		{"MutateInspects", http.MethodGet, "/admin/audit", "", "oncall-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(tt.method, tt.target, tt.body, tt.token); rec.Code != tt.want {
+				t.Errorf("Expected %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+		})
+	}
+
+	// The authenticated principal is recorded as the actor, ignoring the actor header
+	req := httptest.NewRequest(http.MethodGet, "/admin/audit", nil)
+	req.Header.Set("Authorization", "Bearer viewer-token")
+	req.Header.Set(admin.ActorHeader, "someone-else")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var entries []admin.AuditEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatalf("Failed to decode audit entries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "oncall" {
+		t.Errorf("Expected one ban recorded for oncall, got %+v", entries)
+	}
+}
@@ -0,0 +1,20 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"learn.ratelimiter/denialreport"
+)
+
+// denialReports handles GET /admin/denial-reports, optionally filtered by the limiter_key and day query parameters.
+func (h *Handler) denialReports(w http.ResponseWriter, r *http.Request) {
+	day := r.URL.Query().Get("day")
+	if day != "" {
+		if _, err := time.Parse(denialreport.DayLayout, day); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid day '"+day+"', expected YYYY-MM-DD")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, h.denials.Reports(r.URL.Query().Get("limiter_key"), day))
+}
@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"learn.ratelimiter/faults"
+)
+
+// faultsView is the JSON representation of the injected faults, and the body of PUT /admin/faults.
+type faultsView struct {
+	// Latency and Jitter are Go duration strings (e.g., "50ms"); empty means none.
+	Latency     string  `json:"latency,omitempty"`
+	Jitter      string  `json:"jitter,omitempty"`
+	ErrorRate   float64 `json:"error_rate"`
+	PartialRate float64 `json:"partial_rate"`
+}
+
+// newFaultsView returns the JSON representation of f.
+func newFaultsView(f faults.Faults) faultsView {
+	view := faultsView{ErrorRate: f.ErrorRate, PartialRate: f.PartialRate}
+	if f.Latency > 0 {
+		view.Latency = f.Latency.String()
+	}
+	if f.Jitter > 0 {
+		view.Jitter = f.Jitter.String()
+	}
+	return view
+}
+
+// getFaults handles GET /admin/faults.
+func (h *Handler) getFaults(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newFaultsView(h.faults.Faults()))
+}
+
+// setFaults handles PUT /admin/faults.
+func (h *Handler) setFaults(w http.ResponseWriter, r *http.Request) {
+	var req faultsView
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	f := faults.Faults{ErrorRate: req.ErrorRate, PartialRate: req.PartialRate}
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{{"latency", req.Latency, &f.Latency}, {"jitter", req.Jitter, &f.Jitter}} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid "+d.name+" '"+d.value+"'")
+			return
+		}
+		*d.dst = parsed
+	}
+
+	previous := h.faults.Faults()
+	if err := h.faults.Set(f); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	view := newFaultsView(f)
+	h.record(r, AuditEntry{Action: ActionSetFaults, Old: newFaultsView(previous), New: view})
+	writeJSON(w, http.StatusOK, view)
+}
+
+// clearFaults handles DELETE /admin/faults.
+func (h *Handler) clearFaults(w http.ResponseWriter, r *http.Request) {
+	previous := h.faults.Faults()
+	h.faults.Clear()
+	h.record(r, AuditEntry{Action: ActionClearFaults, Old: newFaultsView(previous)})
+	w.WriteHeader(http.StatusNoContent)
+}
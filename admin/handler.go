@@ -0,0 +1,645 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/banlist"
+	"learn.ratelimiter/connregistry"
+	"learn.ratelimiter/denialreport"
+	"learn.ratelimiter/faults"
+	"learn.ratelimiter/overrides"
+	"learn.ratelimiter/readonly"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// ActorHeader is the request header naming the actor recorded in audit entries when the admin API is unauthenticated.
+const ActorHeader = "X-Admin-Actor"
+
+// maxImportBytes caps the size of a bulk import request body.
+const maxImportBytes = 32 << 20
+
+// Bulk import modes.
+const (
+	// ImportMerge adds the imported bans or overrides to the existing ones. It is the default.
+	ImportMerge = "merge"
+	// ImportReplace replaces all existing bans or overrides with the imported ones, e.g., to sync them from another
+	// environment.
+	ImportReplace = "replace"
+)
+
+// defaultAuditQueryLimit is the number of audit entries returned when the query does not specify a limit.
+const defaultAuditQueryLimit = 100
+
+// Handler serves the admin API under /admin/.
+// Every change applied through it is recorded in the audit sink.
+type Handler struct {
+	bans *banlist.List
+	// overrides, if set, enables the override endpoints.
+	overrides *overrides.Table
+	// limiters, if set, enables the per-identifier stats endpoint.
+	limiters map[string]types.Limiter
+	// backends, if set, enables the backend connection health endpoint.
+	backends *connregistry.Registry
+	// readOnly, if set, enables the read-only mode endpoints.
+	readOnly *readonly.Switch
+	// faults, if set, enables the fault injection endpoints.
+	faults *faults.Injector
+	// denials, if set, enables the denial report endpoint.
+	denials *denialreport.Reporter
+	// versionInfo, if set, enables the version endpoint.
+	versionInfo *VersionInfo
+	audit       AuditSink
+	mux         *http.ServeMux
+	// authenticators identify callers; if empty, the API is served without authentication.
+	authenticators []Authenticator
+}
+
+// Option configures optional behaviour of a Handler.
+type Option func(*Handler)
+
+// WithAuthenticators requires admin requests to be authenticated by one of the given authenticators, tried in order.
+// Inspection endpoints require RoleRead and endpoints changing state require RoleMutate.
+func WithAuthenticators(authenticators ...Authenticator) Option {
+	return func(h *Handler) {
+		h.authenticators = append(h.authenticators, authenticators...)
+	}
+}
+
+// WithOverrides serves the endpoints managing per-identifier overrides in the given table.
+func WithOverrides(table *overrides.Table) Option {
+	return func(h *Handler) {
+		h.overrides = table
+	}
+}
+
+// WithBackends serves the health of the backend connections in registry at GET /admin/backends.
+func WithBackends(registry *connregistry.Registry) Option {
+	return func(h *Handler) {
+		h.backends = registry
+	}
+}
+
+// WithReadOnly serves the endpoints putting limiters in read-only mode with the given switch.
+func WithReadOnly(sw *readonly.Switch) Option {
+	return func(h *Handler) {
+		h.readOnly = sw
+	}
+}
+
+// WithFaults serves the faults injected by injector at /admin/faults, to change them at runtime. Only pass it in
+// builds where faults.Enabled is set.
+func WithFaults(injector *faults.Injector) Option {
+	return func(h *Handler) {
+		h.faults = injector
+	}
+}
+
+// WithDenialReports serves the daily denial reports of reporter at GET /admin/denial-reports.
+func WithDenialReports(reporter *denialreport.Reporter) Option {
+	return func(h *Handler) {
+		h.denials = reporter
+	}
+}
+
+// WithVersion serves the version and capabilities of the running rate limiter at GET /admin/version.
+func WithVersion(info VersionInfo) Option {
+	return func(h *Handler) {
+		h.versionInfo = &info
+	}
+}
+
+// WithLimiters serves the per-identifier stats of the given limiters (see types.Stats), by limiter key.
+func WithLimiters(limiters map[string]types.Limiter) Option {
+	return func(h *Handler) {
+		h.limiters = limiters
+	}
+}
+
+// NewHandler creates an admin API handler managing the given ban list and recording changes to the audit sink.
+func NewHandler(bans *banlist.List, audit AuditSink, opts ...Option) *Handler {
+	h := &Handler{bans: bans, audit: audit, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if len(h.authenticators) == 0 {
+		log.Warn().Msg("Admin: No authenticators configured, the admin API is unauthenticated")
+	}
+	h.mux.HandleFunc("GET /admin/bans", h.authorize(RoleRead, h.listBans))
+	h.mux.HandleFunc("POST /admin/bans", h.authorize(RoleMutate, h.ban))
+	h.mux.HandleFunc("DELETE /admin/bans", h.authorize(RoleMutate, h.unban))
+	h.mux.HandleFunc("GET /admin/bans/export", h.authorize(RoleRead, h.exportBans))
+	h.mux.HandleFunc("POST /admin/bans/import", h.authorize(RoleMutate, h.importBans))
+	if h.overrides != nil {
+		h.mux.HandleFunc("GET /admin/overrides", h.authorize(RoleRead, h.listOverrides))
+		h.mux.HandleFunc("POST /admin/overrides", h.authorize(RoleMutate, h.setOverride))
+		h.mux.HandleFunc("DELETE /admin/overrides", h.authorize(RoleMutate, h.deleteOverride))
+		h.mux.HandleFunc("GET /admin/overrides/export", h.authorize(RoleRead, h.exportOverrides))
+		h.mux.HandleFunc("POST /admin/overrides/import", h.authorize(RoleMutate, h.importOverrides))
+	}
+	if h.limiters != nil {
+		h.mux.HandleFunc("GET /admin/stats", h.authorize(RoleRead, h.identifierStats))
+		h.mux.HandleFunc("GET /admin/history", h.authorize(RoleRead, h.identifierHistory))
+	}
+	if h.backends != nil {
+		h.mux.HandleFunc("GET /admin/backends", h.authorize(RoleRead, h.backendHealth))
+	}
+	if h.readOnly != nil {
+		h.mux.HandleFunc("GET /admin/read-only", h.authorize(RoleRead, h.listReadOnly))
+		h.mux.HandleFunc("POST /admin/read-only", h.authorize(RoleMutate, h.setReadOnly))
+		h.mux.HandleFunc("DELETE /admin/read-only", h.authorize(RoleMutate, h.clearReadOnly))
+	}
+	if h.faults != nil {
+		h.mux.HandleFunc("GET /admin/faults", h.authorize(RoleRead, h.getFaults))
+		h.mux.HandleFunc("PUT /admin/faults", h.authorize(RoleMutate, h.setFaults))
+		h.mux.HandleFunc("DELETE /admin/faults", h.authorize(RoleMutate, h.clearFaults))
+	}
+	if h.denials != nil {
+		h.mux.HandleFunc("GET /admin/denial-reports", h.authorize(RoleRead, h.denialReports))
+	}
+	if h.versionInfo != nil {
+		h.mux.HandleFunc("GET /admin/version", h.authorize(RoleRead, h.version))
+	}
+	h.mux.HandleFunc("GET /admin/audit", h.authorize(RoleRead, h.queryAudit))
+	return h
+}
+
+// ServeHTTP dispatches the request to the admin endpoint.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// banRequest is the body of POST /admin/bans.
+type banRequest struct {
+	LimiterKey string `json:"limiter_key"`
+	Identifier string `json:"identifier"`
+	// TTL is a Go duration string (e.g., "1h"); empty bans permanently.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// listBans handles GET /admin/bans, optionally filtered by the limiter_key query parameter.
+func (h *Handler) listBans(w http.ResponseWriter, r *http.Request) {
+	entries := h.bans.Entries(r.URL.Query().Get("limiter_key"))
+	if entries == nil {
+		entries = []banlist.Entry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// ban handles POST /admin/bans.
+func (h *Handler) ban(w http.ResponseWriter, r *http.Request) {
+	var req banRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.LimiterKey == "" || req.Identifier == "" {
+		writeError(w, http.StatusBadRequest, "limiter_key and identifier are required")
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl < 0 {
+			writeError(w, http.StatusBadRequest, "invalid ttl '"+req.TTL+"'")
+			return
+		}
+	}
+
+	entry, previous, replaced := h.bans.Ban(req.LimiterKey, req.Identifier, ttl)
+	audit := AuditEntry{Action: ActionBan, LimiterKey: req.LimiterKey, Identifier: req.Identifier, New: entry}
+	if replaced {
+		audit.Old = previous
+	}
+	h.record(r, audit)
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// unban handles DELETE /admin/bans?limiter_key=...&identifier=...
+func (h *Handler) unban(w http.ResponseWriter, r *http.Request) {
+	limiterKey, identifier := r.URL.Query().Get("limiter_key"), r.URL.Query().Get("identifier")
+	if limiterKey == "" || identifier == "" {
+		writeError(w, http.StatusBadRequest, "limiter_key and identifier are required")
+		return
+	}
+	previous, ok := h.bans.Unban(limiterKey, identifier)
+	if !ok {
+		writeError(w, http.StatusNotFound, "identifier is not banned")
+		return
+	}
+	h.record(r, AuditEntry{Action: ActionUnban, LimiterKey: limiterKey, Identifier: identifier, Old: previous})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// importResult is the response of POST /admin/bans/import and /admin/overrides/import, and the new value of their
+// audit entries.
+type importResult struct {
+	Format   banlist.Format `json:"format"`
+	Mode     string         `json:"mode"`
+	Imported int            `json:"imported"`
+	// Skipped counts entries that had already expired.
+	Skipped int `json:"skipped"`
+	// Removed counts existing bans lifted, or overrides reverted, by a replace.
+	Removed int `json:"removed"`
+}
+
+// importParams returns the format and mode query parameters of an import, writing a 400 response if either is invalid.
+func importParams(w http.ResponseWriter, r *http.Request) (banlist.Format, string, bool) {
+	format, err := banlist.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return "", "", false
+	}
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case "":
+		mode = ImportMerge
+	case ImportMerge, ImportReplace:
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported mode '"+mode+"'")
+		return "", "", false
+	}
+	return format, mode, true
+}
+
+// exportBans handles GET /admin/bans/export?format=json|csv, optionally filtered by the limiter_key query parameter.
+func (h *Handler) exportBans(w http.ResponseWriter, r *http.Request) {
+	format, err := banlist.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	if err := banlist.Export(w, h.bans.Entries(r.URL.Query().Get("limiter_key")), format); err != nil {
+		log.Error().Err(err).Msg("Admin: Failed to export bans")
+	}
+}
+
+// importBans handles POST /admin/bans/import?format=json|csv&mode=merge|replace with the bans in the request body.
+// The import is applied only if every entry is valid. It is recorded as a single audit entry.
+func (h *Handler) importBans(w http.ResponseWriter, r *http.Request) {
+	format, mode, ok := importParams(w, r)
+	if !ok {
+		return
+	}
+	entries, err := banlist.Import(http.MaxBytesReader(w, r.Body, maxImportBytes), format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	result := importResult{Format: format, Mode: mode}
+	if mode == ImportReplace {
+		result.Imported, result.Removed = h.bans.Replace(entries)
+	} else {
+		result.Imported = h.bans.Merge(entries)
+	}
+	result.Skipped = len(entries) - result.Imported
+	h.record(r, AuditEntry{Action: ActionImportBans, New: result})
+	writeJSON(w, http.StatusOK, result)
+}
+
+// overrideRequest is the body of POST /admin/overrides.
+type overrideRequest struct {
+	LimiterKey string  `json:"limiter_key"`
+	Identifier string  `json:"identifier"`
+	Multiplier float64 `json:"multiplier"`
+	// TTL is a Go duration string (e.g., "24h"); empty overrides permanently.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// overrideView is an override as returned by the admin API, with the time it still applies.
+type overrideView struct {
+	overrides.Override
+	// Remaining is a Go duration string, omitted for permanent overrides.
+	Remaining string `json:"remaining,omitempty"`
+}
+
+// newOverrideView returns the view of the override at the given time.
+func newOverrideView(o overrides.Override, now time.Time) overrideView {
+	view := overrideView{Override: o}
+	if !o.ExpiresAt.IsZero() {
+		view.Remaining = o.Remaining(now).Round(time.Second).String()
+	}
+	return view
+}
+
+// listOverrides handles GET /admin/overrides, optionally filtered by the limiter_key query parameter.
+func (h *Handler) listOverrides(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	views := []overrideView{}
+	for _, o := range h.overrides.Entries(r.URL.Query().Get("limiter_key")) {
+		views = append(views, newOverrideView(o, now))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// setOverride handles POST /admin/overrides.
+func (h *Handler) setOverride(w http.ResponseWriter, r *http.Request) {
+	var req overrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.LimiterKey == "" || req.Identifier == "" {
+		writeError(w, http.StatusBadRequest, "limiter_key and identifier are required")
+		return
+	}
+	if req.Multiplier <= 0 {
+		writeError(w, http.StatusBadRequest, "multiplier must be positive")
+		return
+	}
+	o := overrides.Override{LimiterKey: req.LimiterKey, Identifier: req.Identifier, Multiplier: req.Multiplier}
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid ttl '"+req.TTL+"'")
+			return
+		}
+		o.ExpiresAt = time.Now().Add(ttl).UTC()
+	}
+
+	previous, replaced, err := h.overrides.Set(r.Context(), o)
+	if err != nil {
+		log.Error().Err(err).Str("limiter_key", o.LimiterKey).Msg("Admin: Failed to store override")
+		writeError(w, http.StatusInternalServerError, "failed to store override")
+		return
+	}
+	audit := AuditEntry{Action: ActionSetOverride, LimiterKey: o.LimiterKey, Identifier: o.Identifier, New: o}
+	if replaced {
+		audit.Old = previous
+	}
+	h.record(r, audit)
+	writeJSON(w, http.StatusOK, newOverrideView(o, time.Now()))
+}
+
+// deleteOverride handles DELETE /admin/overrides?limiter_key=...&identifier=...
+func (h *Handler) deleteOverride(w http.ResponseWriter, r *http.Request) {
+	limiterKey, identifier := r.URL.Query().Get("limiter_key"), r.URL.Query().Get("identifier")
+	if limiterKey == "" || identifier == "" {
+		writeError(w, http.StatusBadRequest, "limiter_key and identifier are required")
+		return
+	}
+	previous, ok, err := h.overrides.Delete(r.Context(), limiterKey, identifier)
+	if err != nil {
+		log.Error().Err(err).Str("limiter_key", limiterKey).Msg("Admin: Failed to delete override")
+		writeError(w, http.StatusInternalServerError, "failed to delete override")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "identifier has no override")
+		return
+	}
+	h.record(r, AuditEntry{Action: ActionDeleteOverride, LimiterKey: limiterKey, Identifier: identifier, Old: previous})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// exportOverrides handles GET /admin/overrides/export?format=json|csv, optionally filtered by the limiter_key query
+// parameter.
+func (h *Handler) exportOverrides(w http.ResponseWriter, r *http.Request) {
+	format, err := banlist.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	if err := overrides.Export(w, h.overrides.Entries(r.URL.Query().Get("limiter_key")), format); err != nil {
+		log.Error().Err(err).Msg("Admin: Failed to export overrides")
+	}
+}
+
+// importOverrides handles POST /admin/overrides/import?format=json|csv&mode=merge|replace with the overrides in the
+// request body. The import is applied only if every entry is valid. It is recorded as a single audit entry.
+func (h *Handler) importOverrides(w http.ResponseWriter, r *http.Request) {
+	format, mode, ok := importParams(w, r)
+	if !ok {
+		return
+	}
+	entries, err := overrides.Import(http.MaxBytesReader(w, r.Body, maxImportBytes), format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	result := importResult{Format: format, Mode: mode}
+	if mode == ImportReplace {
+		result.Imported, result.Removed, err = h.overrides.Replace(r.Context(), entries)
+	} else {
+		result.Imported, err = h.overrides.Merge(r.Context(), entries)
+	}
+	if err != nil {
+		// Entries stored before the failure stay applied, so the partial import is audited too
+		log.Error().Err(err).Msg("Admin: Failed to store imported overrides")
+		h.record(r, AuditEntry{Action: ActionImportOverrides, New: result})
+		writeError(w, http.StatusInternalServerError, "failed to store overrides")
+		return
+	}
+	result.Skipped = len(entries) - result.Imported
+	h.record(r, AuditEntry{Action: ActionImportOverrides, New: result})
+	writeJSON(w, http.StatusOK, result)
+}
+
+// queryAudit handles GET /admin/audit, filtered by the limiter_key, identifier, action, actor, since (RFC 3339) and limit query parameters.
+func (h *Handler) queryAudit(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := AuditQuery{
+		LimiterKey: params.Get("limiter_key"),
+		Identifier: params.Get("identifier"),
+		Action:     params.Get("action"),
+		Actor:      params.Get("actor"),
+		Limit:      defaultAuditQueryLimit,
+	}
+	if since := params.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since '"+since+"'")
+			return
+		}
+		query.Since = t
+	}
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit '"+limit+"'")
+			return
+		}
+		query.Limit = n
+	}
+
+	entries, err := h.audit.Query(r.Context(), query)
+	if err != nil {
+		log.Error().Err(err).Msg("Admin: Failed to query audit log")
+		writeError(w, http.StatusInternalServerError, "failed to query audit log")
+		return
+	}
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// record stamps the audit entry with the time and actor and stores it.
+// The action has already been applied, so a sink failure is logged rather than returned to the caller.
+func (h *Handler) record(r *http.Request, entry AuditEntry) {
+	entry.Time = time.Now().UTC()
+	entry.Actor = actorFromRequest(r)
+	// Don't let a cancelled admin request drop its audit entry
+	ctx := context.WithoutCancel(r.Context())
+	if err := h.audit.Record(ctx, entry); err != nil {
+		log.Error().Err(err).Str("action", entry.Action).Str("limiter_key", entry.LimiterKey).Str("actor", entry.Actor).Msg("Admin: Failed to record audit entry")
+		return
+	}
+	log.Info().Str("action", entry.Action).Str("limiter_key", entry.LimiterKey).Str("identifier", redact.Identifier(entry.Identifier)).Str("actor", entry.Actor).Msg("Admin: Action applied")
+}
+
+// actorFromRequest returns the authenticated principal's name, or without authentication
+// the actor named by the ActorHeader, falling back to the client address.
+func actorFromRequest(r *http.Request) string {
+	if principal, ok := PrincipalFromContext(r.Context()); ok {
+		return principal.Name
+	}
+	if actor := r.Header.Get(ActorHeader); actor != "" {
+		return actor
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// statsView is the JSON representation of an identifier's stats.
+type statsView struct {
+	LimiterKey string `json:"limiter_key"`
+	Identifier string `json:"identifier"`
+	Allowed    int64  `json:"allowed"`
+	Denied     int64  `json:"denied"`
+	Window     string `json:"window"`
+	// Throttled reports whether any request was denied in the window.
+	Throttled bool `json:"throttled"`
+}
+
+// identifierStats handles GET /admin/stats.
+func (h *Handler) identifierStats(w http.ResponseWriter, r *http.Request) {
+	limiterKey, identifier := r.URL.Query().Get("limiter_key"), r.URL.Query().Get("identifier")
+	if limiterKey == "" || identifier == "" {
+		writeError(w, http.StatusBadRequest, "limiter_key and identifier are required")
+		return
+	}
+	limiter, ok := h.limiters[limiterKey]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown limiter '"+limiterKey+"'")
+		return
+	}
+	stats, err := types.Stats(r.Context(), limiter, identifier)
+	if errors.Is(err, types.ErrStatsUnsupported) {
+		writeError(w, http.StatusNotFound, "stats are not enabled for limiter '"+limiterKey+"'")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, statsView{
+		LimiterKey: limiterKey,
+		Identifier: identifier,
+		Allowed:    stats.Allowed,
+		Denied:     stats.Denied,
+		Window:     stats.Window.String(),
+		Throttled:  stats.Denied > 0,
+	})
+}
+
+// decisionView is the JSON representation of a decision of an identifier's history.
+type decisionView struct {
+	Time    time.Time `json:"time"`
+	Allowed bool      `json:"allowed"`
+	Cost    int       `json:"cost"`
+	// Remaining is the fraction of the budget left after the decision, omitted if the limiter cannot tell.
+	Remaining *float64 `json:"remaining,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// historyView is the JSON representation of an identifier's history.
+type historyView struct {
+	LimiterKey string         `json:"limiter_key"`
+	Identifier string         `json:"identifier"`
+	Decisions  []decisionView `json:"decisions"`
+}
+
+// identifierHistory handles GET /admin/history, optionally filtered by the since (RFC 3339) query parameter.
+func (h *Handler) identifierHistory(w http.ResponseWriter, r *http.Request) {
+	limiterKey, identifier := r.URL.Query().Get("limiter_key"), r.URL.Query().Get("identifier")
+	if limiterKey == "" || identifier == "" {
+		writeError(w, http.StatusBadRequest, "limiter_key and identifier are required")
+		return
+	}
+	var since time.Time
+	if param := r.URL.Query().Get("since"); param != "" {
+		t, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since '"+param+"'")
+			return
+		}
+		since = t
+	}
+	limiter, ok := h.limiters[limiterKey]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown limiter '"+limiterKey+"'")
+		return
+	}
+	decisions, err := types.History(r.Context(), limiter, identifier)
+	if errors.Is(err, types.ErrHistoryUnsupported) {
+		writeError(w, http.StatusNotFound, "history is not enabled for limiter '"+limiterKey+"'")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	view := historyView{LimiterKey: limiterKey, Identifier: identifier, Decisions: make([]decisionView, 0, len(decisions))}
+	for _, decision := range decisions {
+		if decision.Time.Before(since) {
+			continue
+		}
+		d := decisionView{Time: decision.Time.UTC(), Allowed: decision.Allowed, Cost: decision.Cost, Error: decision.Err}
+		if decision.Remaining >= 0 {
+			remaining := decision.Remaining
+			d.Remaining = &remaining
+		}
+		view.Decisions = append(view.Decisions, d)
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+// backendHealth checks every backend connection and writes their statuses, with 503 if any is unhealthy.
+func (h *Handler) backendHealth(w http.ResponseWriter, r *http.Request) {
+	statuses := h.backends.Health(r.Context())
+	status := http.StatusOK
+	for _, backend := range statuses {
+		if !backend.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, status, map[string][]connregistry.Status{"backends": statuses})
+}
+
+// writeJSON writes v as a JSON response body with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error body with the given status.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
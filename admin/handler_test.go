@@ -0,0 +1,445 @@
+// Package admin_test contains tests for the admin API.
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/admin"
+	"learn.ratelimiter/banlist"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/connregistry"
+	"learn.ratelimiter/faults"
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/internal/history"
+	"learn.ratelimiter/internal/stats"
+	"learn.ratelimiter/overrides"
+	"learn.ratelimiter/readonly"
+	"learn.ratelimiter/types"
+)
+
+// TestBanAudit tests that bans applied through the admin API are enforced by the ban list and recorded in the audit log.
+func TestBanAudit(t *testing.T) {
+	bans := banlist.New()
+	handler := admin.NewHandler(bans, admin.NewMemoryAuditSink(0))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/bans", strings.NewReader(`{"limiter_key":"api","identifier":"1.2.3.4","ttl":"1h"}`))
+	req.Header.Set(admin.ActorHeader, "alice")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected ban to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	if !bans.IsBanned("api", "1.2.3.4") {
+		t.Fatal("Expected identifier to be banned")
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/bans?limiter_key=api&identifier=1.2.3.4", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected unban to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	if bans.IsBanned("api", "1.2.3.4") {
+		t.Fatal("Expected identifier to be unbanned")
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/audit?limiter_key=api", nil))
+	var entries []admin.AuditEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatalf("Failed to decode audit entries: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %d", len(entries))
+	}
+	// Newest first
+	if entries[0].Action != admin.ActionUnban || entries[0].Old == nil || entries[0].New != nil {
+		t.Errorf("Unexpected unban entry: %+v", entries[0])
+	}
+	if entries[1].Action != admin.ActionBan || entries[1].Actor != "alice" || entries[1].New == nil {
+		t.Errorf("Unexpected ban entry: %+v", entries[1])
+	}
+}
+
+// TestFileAuditSink tests that the file sink persists entries and filters queries.
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := admin.NewFileAuditSink(path)
+	if err != nil {
+		t.Fatalf("Failed to create file audit sink: %v", err)
+	}
+	ctx := context.Background()
+	for _, identifier := range []string{"a", "b", "c"} {
+		if err := sink.Record(ctx, admin.AuditEntry{Action: admin.ActionBan, LimiterKey: "api", Identifier: identifier}); err != nil {
+			t.Fatalf("Failed to record audit entry: %v", err)
+		}
+	}
+	sink.Close()
+
+	// Entries survive reopening the file
+	sink, err = admin.NewFileAuditSink(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file audit sink: %v", err)
+	}
+	defer sink.Close()
+	entries, err := sink.Query(ctx, admin.AuditQuery{LimiterKey: "api", Limit: 2})
+	if err != nil {
+		t.Fatalf("Failed to query audit log: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Identifier != "c" || entries[1].Identifier != "b" {
+		t.Errorf("Expected the two newest entries, got %+v", entries)
+	}
+}
+
+// TestBanImportExport tests that bans imported in bulk are enforced, exported in either format, and replaced on request.
+func TestBanImportExport(t *testing.T) {
+	bans := banlist.New()
+	handler := admin.NewHandler(bans, admin.NewMemoryAuditSink(0))
+	bans.Ban("api", "stale", 0)
+
+	csvBody := "limiter_key,identifier,expires_at\n" +
+		"api,1.2.3.4,\n" +
+		"api,5.6.7.8,2999-01-01T00:00:00Z\n" +
+		"login,bob,2000-01-01T00:00:00Z\n"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/bans/import?format=csv", strings.NewReader(csvBody)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected import to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	if !bans.IsBanned("api", "1.2.3.4") || !bans.IsBanned("api", "5.6.7.8") || !bans.IsBanned("api", "stale") {
+		t.Fatal("Expected imported bans to be merged with existing bans")
+	}
+	if bans.IsBanned("login", "bob") {
+		t.Error("Expected expired entry to be skipped")
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/bans/export?format=csv&limiter_key=api", nil))
+	exported := rec.Body.String()
+	if rec.Header().Get("Content-Type") != "text/csv" || !strings.Contains(exported, "api,5.6.7.8,2999-01-01T00:00:00Z\n") {
+		t.Errorf("Unexpected CSV export: %q", exported)
+	}
+
+	// Replacing with a JSON export of another environment lifts bans missing from it
+	rec = httptest.NewRecorder()
+	jsonBody := `[{"limiter_key":"api","identifier":"1.2.3.4"}]`
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/bans/import?mode=replace", strings.NewReader(jsonBody)))
+	var result struct {
+		Imported int `json:"imported"`
+		Removed  int `json:"removed"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode import result: %v", err)
+	}
+	if result.Imported != 1 || result.Removed != 2 {
+		t.Errorf("Expected 1 imported and 2 removed, got %+v", result)
+	}
+	if entries := bans.Entries(""); len(entries) != 1 || entries[0].Identifier != "1.2.3.4" {
+		t.Errorf("Expected only the imported ban to remain, got %+v", entries)
+	}
+
+	// Invalid input is rejected without changing anything
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/bans/import?format=csv&mode=replace", strings.NewReader("limiter_key,identifier,expires_at\napi,,\n")))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid import to be rejected, got %d", rec.Code)
+	}
+	if !bans.IsBanned("api", "1.2.3.4") {
+		t.Error("Expected a rejected import to leave bans untouched")
+	}
+}
+
+// TestOverrides tests that overrides set through the admin API are listed with their remaining time and can be removed.
+func TestOverrides(t *testing.T) {
+	table := overrides.NewTable(overrides.NewMemoryStore(), time.Hour)
+	defer table.Close()
+	handler := admin.NewHandler(banlist.New(), admin.NewMemoryAuditSink(0), admin.WithOverrides(table))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/overrides", strings.NewReader(`{"limiter_key":"api","identifier":"customer-x","multiplier":5,"ttl":"24h"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected override to be set, got %d: %s", rec.Code, rec.Body)
+	}
+	if multiplier, ok := table.Multiplier("api", "customer-x"); !ok || multiplier != 5 {
+		t.Fatalf("Expected multiplier 5, got %v (%v)", multiplier, ok)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/overrides?limiter_key=api", nil))
+	var listed []struct {
+		Identifier string  `json:"identifier"`
+		Multiplier float64 `json:"multiplier"`
+		Remaining  string  `json:"remaining"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&listed); err != nil {
+		t.Fatalf("Failed to decode overrides: %v", err)
+	}
+	if len(listed) != 1 || listed[0].Identifier != "customer-x" || listed[0].Remaining == "" {
+		t.Fatalf("Unexpected overrides: %+v", listed)
+	}
+	if remaining, err := time.ParseDuration(listed[0].Remaining); err != nil || remaining < 23*time.Hour || remaining > 24*time.Hour {
+		t.Errorf("Expected about 24h remaining, got %q", listed[0].Remaining)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/overrides", strings.NewReader(`{"limiter_key":"api","identifier":"customer-x","multiplier":0}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a non-positive multiplier to be rejected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/overrides?limiter_key=api&identifier=customer-x", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected override to be deleted, got %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := table.Multiplier("api", "customer-x"); ok {
+		t.Error("Expected override to be removed")
+	}
+}
+
+// TestOverrideImportExport tests that overrides exported from one instance can be imported into another in both formats
+// and modes.
+func TestOverrideImportExport(t *testing.T) {
+	source := overrides.NewTable(overrides.NewMemoryStore(), time.Hour)
+	defer source.Close()
+	ctx := context.Background()
+	source.Set(ctx, overrides.Override{LimiterKey: "api", Identifier: "customer-x", Multiplier: 5, ExpiresAt: time.Now().Add(time.Hour)})
+	source.Set(ctx, overrides.Override{LimiterKey: "api", Identifier: "customer-y", Multiplier: 0.5})
+	sourceHandler := admin.NewHandler(banlist.New(), admin.NewMemoryAuditSink(0), admin.WithOverrides(source))
+
+	for _, format := range []string{"json", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			sourceHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/overrides/export?format="+format, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected export to succeed, got %d: %s", rec.Code, rec.Body)
+			}
+			exported := rec.Body.String()
+
+			target := overrides.NewTable(overrides.NewMemoryStore(), time.Hour)
+			defer target.Close()
+			target.Set(ctx, overrides.Override{LimiterKey: "api", Identifier: "stale", Multiplier: 2})
+			audit := admin.NewMemoryAuditSink(0)
+			handler := admin.NewHandler(banlist.New(), audit, admin.WithOverrides(target))
+
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/overrides/import?mode=replace&format="+format, strings.NewReader(exported)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected import to succeed, got %d: %s", rec.Code, rec.Body)
+			}
+			var result struct{ Imported, Removed int }
+			json.NewDecoder(rec.Body).Decode(&result)
+			if result.Imported != 2 || result.Removed != 1 {
+				t.Errorf("Expected 2 overrides imported and 1 removed, got %+v", result)
+			}
+			if multiplier, ok := target.Multiplier("api", "customer-y"); !ok || multiplier != 0.5 {
+				t.Errorf("Expected customer-y to be imported with multiplier 0.5, got %v (%v)", multiplier, ok)
+			}
+			if _, ok := target.Multiplier("api", "stale"); ok {
+				t.Error("Expected a replace to remove overrides missing from the import")
+			}
+			if entries, _ := audit.Query(ctx, admin.AuditQuery{Action: admin.ActionImportOverrides}); len(entries) != 1 {
+				t.Errorf("Expected one import_overrides audit entry, got %d", len(entries))
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	sourceHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/overrides/import?format=csv", strings.NewReader("limiter_key,identifier,multiplier,expires_at\napi,customer-z,0,\n")))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an import with a non-positive multiplier to be rejected, got %d", rec.Code)
+	}
+	if _, ok := source.Multiplier("api", "customer-z"); ok {
+		t.Error("Expected a rejected import to leave overrides untouched")
+	}
+}
+
+// TestStats tests that the stats of an identifier are served for limiters counting them.
+func TestStats(t *testing.T) {
+	counted := stats.NewLimiter("api", fcinmemory.NewLimiter("api", time.Minute, 1), config.StatsConfig{Window: 5 * time.Minute})
+	for i := 0; i < 3; i++ {
+		counted.Allow(context.Background(), "customer-x")
+	}
+	limiters := map[string]types.Limiter{"api": counted, "login": fcinmemory.NewLimiter("login", time.Minute, 1)}
+	handler := admin.NewHandler(banlist.New(), admin.NewMemoryAuditSink(0), admin.WithLimiters(limiters))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/stats?limiter_key=api&identifier=customer-x", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected stats, got %d: %s", rec.Code, rec.Body)
+	}
+	var view struct {
+		Allowed   int64  `json:"allowed"`
+		Denied    int64  `json:"denied"`
+		Window    string `json:"window"`
+		Throttled bool   `json:"throttled"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&view); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	if view.Allowed != 1 || view.Denied != 2 || view.Window != "5m0s" || !view.Throttled {
+		t.Errorf("Unexpected stats: %+v", view)
+	}
+
+	for query, want := range map[string]int{
+		"limiter_key=login&identifier=customer-x":   http.StatusNotFound,
+		"limiter_key=unknown&identifier=customer-x": http.StatusNotFound,
+		"limiter_key=api":                           http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/stats?"+query, nil))
+		if rec.Code != want {
+			t.Errorf("GET /admin/stats?%s: expected %d, got %d", query, want, rec.Code)
+		}
+	}
+}
+
+// TestHistory tests that an identifier's latest decisions are served, filtered by time.
+func TestHistory(t *testing.T) {
+	kept := history.NewLimiter("api", fcinmemory.NewLimiter("api", time.Minute, 1), config.HistoryConfig{})
+	for i := 0; i < 2; i++ {
+		kept.Allow(context.Background(), "customer-x")
+	}
+	limiters := map[string]types.Limiter{"api": kept, "login": fcinmemory.NewLimiter("login", time.Minute, 1)}
+	handler := admin.NewHandler(banlist.New(), admin.NewMemoryAuditSink(0), admin.WithLimiters(limiters))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/history?limiter_key=api&identifier=customer-x", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected history, got %d: %s", rec.Code, rec.Body)
+	}
+	var view struct {
+		Decisions []struct {
+			Allowed   bool     `json:"allowed"`
+			Remaining *float64 `json:"remaining"`
+		} `json:"decisions"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&view); err != nil {
+		t.Fatalf("Failed to decode history: %v", err)
+	}
+	if len(view.Decisions) != 2 || !view.Decisions[0].Allowed || view.Decisions[1].Allowed || view.Decisions[1].Remaining == nil || *view.Decisions[1].Remaining != 0 {
+		t.Errorf("Unexpected history: %+v", view)
+	}
+
+	since := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	for query, want := range map[string]int{
+		"limiter_key=api&identifier=customer-x&since=" + since: http.StatusOK,
+		"limiter_key=api&identifier=customer-x&since=noon":     http.StatusBadRequest,
+		"limiter_key=login&identifier=customer-x":              http.StatusNotFound,
+		"limiter_key=unknown&identifier=customer-x":            http.StatusNotFound,
+		"limiter_key=api": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/history?"+query, nil))
+		if rec.Code != want {
+			t.Errorf("GET /admin/history?%s: expected %d, got %d", query, want, rec.Code)
+		}
+		if want == http.StatusOK && !strings.Contains(rec.Body.String(), `"decisions":[]`) {
+			t.Errorf("Expected no decisions since %s, got %s", since, rec.Body)
+		}
+	}
+}
+
+// TestBackends tests that the backend connection health is served, with 503 while a connection is unhealthy.
+func TestBackends(t *testing.T) {
+	registry := connregistry.New(func(params config.RedisBackendConfig, ping bool) (*redis.Client, error) {
+		return redis.NewClient(&redis.Options{Addr: params.Address, DialTimeout: 100 * time.Millisecond, MaxRetries: -1}), nil
+	})
+	defer registry.Close()
+	handler := admin.NewHandler(banlist.New(), admin.NewMemoryAuditSink(0), admin.WithBackends(registry))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/backends", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 without connections, got %d: %s", rec.Code, rec.Body)
+	}
+
+	registry.Clients(config.LimiterConfig{Key: "api", Backend: config.Redis, Connection: "sessions", RedisParams: &config.RedisBackendConfig{Address: "127.0.0.1:1"}})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/backends", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 with an unreachable connection, got %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Backends []connregistry.Status `json:"backends"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode backends: %v", err)
+	}
+	if len(body.Backends) != 1 || body.Backends[0].Name != "sessions" || body.Backends[0].Healthy {
+		t.Errorf("Unexpected backends: %+v", body.Backends)
+	}
+}
+
+// TestFaults tests that the injected faults are served, replaced and cleared, and that invalid faults are rejected.
+func TestFaults(t *testing.T) {
+	injector := faults.New()
+	handler := admin.NewHandler(banlist.New(), admin.NewMemoryAuditSink(0), admin.WithFaults(injector))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/faults", strings.NewReader(`{"latency":"50ms","error_rate":0.2}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected faults to be set, got %d: %s", rec.Code, rec.Body)
+	}
+	if got, want := injector.Faults(), (faults.Faults{Latency: 50 * time.Millisecond, ErrorRate: 0.2}); got != want {
+		t.Errorf("Expected %+v injected, got %+v", want, got)
+	}
+	for _, body := range []string{`{"latency":"soon"}`, `{"error_rate":2}`, `{`} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/faults", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: expected 400, got %d", body, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/faults", nil))
+	if !strings.Contains(rec.Body.String(), `"latency":"50ms"`) {
+		t.Errorf("Expected the faults served, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/faults", nil))
+	if rec.Code != http.StatusNoContent || injector.Faults() != (faults.Faults{}) {
+		t.Errorf("Expected faults cleared, got %d and %+v", rec.Code, injector.Faults())
+	}
+}
+
+// TestReadOnly tests that read-only mode is set and cleared through the admin API for known limiters only.
+func TestReadOnly(t *testing.T) {
+	sw := readonly.New()
+	defer sw.Close()
+	limiters := map[string]types.Limiter{"api": fcinmemory.NewLimiter("api", time.Minute, 10)}
+	handler := admin.NewHandler(banlist.New(), admin.NewMemoryAuditSink(0), admin.WithReadOnly(sw), admin.WithLimiters(limiters))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/read-only", strings.NewReader(`{"limiter_key":"api","ttl":"30m","reason":"migration"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected read-only mode to be set, got %d: %s", rec.Code, rec.Body)
+	}
+	if !sw.Active("api") {
+		t.Fatal("Expected the limiter to be read-only")
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/read-only", strings.NewReader(`{"limiter_key":"unknown"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown limiter, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/read-only?limiter_key=api", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected read-only mode to be cleared, got %d: %s", rec.Code, rec.Body)
+	}
+	if sw.Active("api") {
+		t.Error("Expected writes re-enabled")
+	}
+}
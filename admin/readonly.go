@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"learn.ratelimiter/readonly"
+)
+
+// readOnlyRequest is the body of POST /admin/read-only.
+type readOnlyRequest struct {
+	// LimiterKey is the key of the limiter to put in read-only mode, or readonly.Global for every limiter.
+	LimiterKey string `json:"limiter_key"`
+	// TTL is a Go duration string (e.g., "30m") after which writes are re-enabled; empty keeps read-only mode until it is cleared.
+	TTL    string `json:"ttl,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// listReadOnly handles GET /admin/read-only.
+func (h *Handler) listReadOnly(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.readOnly.Entries())
+}
+
+// setReadOnly handles POST /admin/read-only.
+func (h *Handler) setReadOnly(w http.ResponseWriter, r *http.Request) {
+	var req readOnlyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.LimiterKey == "" {
+		writeError(w, http.StatusBadRequest, "limiter_key is required, or '"+readonly.Global+"' for every limiter")
+		return
+	}
+	if h.limiters != nil && req.LimiterKey != readonly.Global {
+		if _, ok := h.limiters[req.LimiterKey]; !ok {
+			writeError(w, http.StatusNotFound, "unknown limiter '"+req.LimiterKey+"'")
+			return
+		}
+	}
+	entry := readonly.Entry{LimiterKey: req.LimiterKey, Reason: req.Reason}
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid ttl '"+req.TTL+"'")
+			return
+		}
+		entry.ExpiresAt = time.Now().Add(ttl).UTC()
+	}
+
+	previous, replaced := h.readOnly.Set(entry)
+	audit := AuditEntry{Action: ActionSetReadOnly, LimiterKey: entry.LimiterKey, New: entry}
+	if replaced {
+		audit.Old = previous
+	}
+	h.record(r, audit)
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// clearReadOnly handles DELETE /admin/read-only?limiter_key=...
+func (h *Handler) clearReadOnly(w http.ResponseWriter, r *http.Request) {
+	limiterKey := r.URL.Query().Get("limiter_key")
+	if limiterKey == "" {
+		writeError(w, http.StatusBadRequest, "limiter_key is required, or '"+readonly.Global+"' for every limiter")
+		return
+	}
+	previous, ok := h.readOnly.Clear(limiterKey)
+	if !ok {
+		writeError(w, http.StatusNotFound, "limiter is not in read-only mode")
+		return
+	}
+	h.record(r, AuditEntry{Action: ActionClearReadOnly, LimiterKey: limiterKey, Old: previous})
+	w.WriteHeader(http.StatusNoContent)
+}
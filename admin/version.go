@@ -0,0 +1,22 @@
+package admin
+
+import "net/http"
+
+// VersionInfo describes the running rate limiter: its release and build, and the backends, algorithms and
+// features its configuration uses, so a fleet can be audited for what each service runs.
+type VersionInfo struct {
+	Version string `json:"version"`
+	// Commit is the VCS revision the binary was built from, or empty if unknown.
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"go_version"`
+	// Backends, Algorithms and Features list, sorted, what the configured limiters use (e.g., "redis",
+	// "token_bucket", "lease"), features being named after their configuration sections.
+	Backends   []string `json:"backends"`
+	Algorithms []string `json:"algorithms"`
+	Features   []string `json:"features"`
+}
+
+// version handles GET /admin/version.
+func (h *Handler) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.versionInfo)
+}
@@ -0,0 +1,218 @@
+// Package anomaly detects abnormal spikes in each limiter's deny rate, so attacks and misconfigured clients surface as
+// events (logs, metrics and webhooks) without building external alerting first.
+package anomaly
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/metrics"
+)
+
+// minStdDev is the lowest standard deviation deny rates are compared with, so a limiter that never denied does not
+// turn a single denial into an infinite z-score.
+const minStdDev = 0.01
+
+// State tells whether an event starts or ends a spike.
+type State string
+
+const (
+	// Spike is reported when a limiter's deny rate rises abnormally above its baseline.
+	Spike State = "spike"
+	// Resolved is reported at the first interval the deny rate is no longer abnormal after a spike.
+	Resolved State = "resolved"
+)
+
+// Event reports the start or end of a spike in a limiter's deny rate.
+type Event struct {
+	Time       time.Time `json:"time"`
+	LimiterKey string    `json:"limiter_key"`
+	State      State     `json:"state"`
+	// DenyRate is the fraction of requests denied in the interval, between 0 and 1.
+	DenyRate float64 `json:"deny_rate"`
+	// Baseline is the moving average of the deny rates before the interval.
+	Baseline float64 `json:"baseline"`
+	// ZScore is the number of standard deviations between DenyRate and Baseline.
+	ZScore float64 `json:"z_score"`
+	// Requests is the number of requests checked in the interval.
+	Requests int64 `json:"requests"`
+}
+
+// Handler is called with each event, from the detector's goroutine. Handlers should return promptly.
+type Handler func(Event)
+
+// series holds the requests of the interval in progress and the baseline of one limiter.
+type series struct {
+	requests int64
+	denied   int64
+	mean     float64 // Exponentially weighted moving average of deny rates
+	variance float64 // Exponentially weighted moving variance of deny rates
+	learned  int     // Intervals folded into the baseline
+	spiking  bool
+}
+
+// Detector counts the decisions of each limiter per interval, and compares each interval's deny rate with an
+// exponentially weighted moving average and variance of the previous ones. An interval whose deny rate is at least
+// threshold standard deviations above the average starts a spike, which ends at the first interval that is not.
+// Intervals within a spike are not folded into the baseline, so a lasting change stays a spike until it ends.
+type Detector struct {
+	interval    time.Duration
+	smoothing   float64
+	threshold   float64
+	warmup      int
+	minRequests int64
+	minDenyRate float64
+	handlers    []Handler
+
+	mu       sync.Mutex
+	limiters map[string]*series
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a detector as cfg describes, calling handlers with each event in addition to logging it, and starts
+// evaluating intervals. Call Close to stop.
+func New(cfg config.AnomalyDetectionConfig, handlers ...Handler) *Detector {
+	d := &Detector{
+		interval:    cfg.Interval,
+		smoothing:   cfg.Smoothing,
+		threshold:   cfg.Threshold,
+		warmup:      cfg.Warmup,
+		minRequests: cfg.MinRequests,
+		minDenyRate: cfg.MinDenyRate,
+		handlers:    handlers,
+		limiters:    make(map[string]*series),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if d.interval <= 0 {
+		d.interval = config.DefaultAnomalyInterval
+	}
+	if d.smoothing <= 0 {
+		d.smoothing = config.DefaultAnomalySmoothing
+	}
+	if d.threshold <= 0 {
+		d.threshold = config.DefaultAnomalyThreshold
+	}
+	if d.warmup <= 0 {
+		d.warmup = config.DefaultAnomalyWarmup
+	}
+	if d.minRequests <= 0 {
+		d.minRequests = config.DefaultAnomalyMinRequests
+	}
+	if d.minDenyRate <= 0 {
+		d.minDenyRate = config.DefaultAnomalyMinDenyRate
+	}
+	log.Info().Dur("interval", d.interval).Float64("threshold", d.threshold).Msg("Anomaly: Starting deny rate anomaly detection")
+	go d.run()
+	return d
+}
+
+// Observe records a decision of the limiter in the interval in progress.
+func (d *Detector) Observe(limiterKey string, allowed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.limiters[limiterKey]
+	if !ok {
+		s = &series{}
+		d.limiters[limiterKey] = s
+	}
+	s.requests++
+	if !allowed {
+		s.denied++
+	}
+}
+
+// Evaluate ends the interval in progress at time now: it compares each limiter's deny rate with its baseline, folds it
+// into the baseline unless it is a spike, and returns the events raised after logging them and passing them to the
+// handlers. Limiters with fewer requests than the minimum in the interval are left as they were.
+func (d *Detector) Evaluate(now time.Time) []Event {
+	d.mu.Lock()
+	var events []Event
+	for limiterKey, s := range d.limiters {
+		requests, denied := s.requests, s.denied
+		s.requests, s.denied = 0, 0
+		if requests < d.minRequests {
+			continue
+		}
+		rate := float64(denied) / float64(requests)
+		zScore := (rate - s.mean) / max(math.Sqrt(s.variance), minStdDev)
+		anomalous := s.learned >= d.warmup && zScore >= d.threshold && rate >= d.minDenyRate
+		if s.learned >= d.warmup {
+			metrics.SetDenyRateZScore(limiterKey, zScore)
+		}
+		if anomalous != s.spiking {
+			event := Event{Time: now, LimiterKey: limiterKey, State: Resolved, DenyRate: rate, Baseline: s.mean, ZScore: zScore, Requests: requests}
+			if anomalous {
+				event.State = Spike
+			}
+			events = append(events, event)
+			s.spiking = anomalous
+		}
+		if anomalous {
+			continue
+		}
+
+		// Exponentially weighted moving variance (Finch, 2009)
+		diff := rate - s.mean
+		if s.learned == 0 {
+			s.mean = rate
+		} else {
+			increment := d.smoothing * diff
+			s.mean += increment
+			s.variance = (1 - d.smoothing) * (s.variance + diff*increment)
+		}
+		s.learned++
+	}
+	d.mu.Unlock()
+
+	sort.Slice(events, func(i, j int) bool { return events[i].LimiterKey < events[j].LimiterKey })
+	for _, event := range events {
+		d.report(event)
+	}
+	return events
+}
+
+// report logs the event, counts spikes and passes the event to the handlers.
+func (d *Detector) report(event Event) {
+	if event.State == Spike {
+		metrics.RecordDenyRateAnomaly(event.LimiterKey)
+		log.Warn().Str("limiter_key", event.LimiterKey).Float64("deny_rate", event.DenyRate).Float64("baseline", event.Baseline).Float64("z_score", event.ZScore).Int64("requests", event.Requests).Msg("Anomaly: Deny rate spike detected")
+	} else {
+		log.Info().Str("limiter_key", event.LimiterKey).Float64("deny_rate", event.DenyRate).Float64("baseline", event.Baseline).Msg("Anomaly: Deny rate spike resolved")
+	}
+	for _, handler := range d.handlers {
+		handler(event)
+	}
+}
+
+// Close stops evaluating intervals.
+func (d *Detector) Close() error {
+	d.closeOnce.Do(func() {
+		close(d.stop)
+		<-d.done
+	})
+	return nil
+}
+
+// run evaluates an interval every interval until the detector is closed.
+func (d *Detector) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			d.Evaluate(now)
+		case <-d.stop:
+			return
+		}
+	}
+}
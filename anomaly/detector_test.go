@@ -0,0 +1,108 @@
+package anomaly_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/anomaly"
+	"learn.ratelimiter/config"
+)
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// observe records requests decisions of the limiter, denied of them denied.
+func observe(d *anomaly.Detector, limiterKey string, requests, denied int) {
+	for i := 0; i < requests; i++ {
+		d.Observe(limiterKey, i >= denied)
+	}
+}
+
+// newDetector returns a detector whose intervals are only evaluated by the test.
+func newDetector(handlers ...anomaly.Handler) *anomaly.Detector {
+	return anomaly.New(config.AnomalyDetectionConfig{Interval: time.Hour, Warmup: 5}, handlers...)
+}
+
+// TestSpike tests that a deny rate far above the baseline starts a spike, which resolves once the rate drops back.
+func TestSpike(t *testing.T) {
+	d := newDetector()
+	defer d.Close()
+	now := start
+	for i := 0; i < 10; i++ {
+		observe(d, "api", 100, 2+i%2) // 2-3% denied
+		if events := d.Evaluate(now); len(events) != 0 {
+			t.Fatalf("Expected no events at the baseline, got %+v", events)
+		}
+		now = now.Add(time.Minute)
+	}
+
+	observe(d, "api", 100, 60)
+	events := d.Evaluate(now)
+	if len(events) != 1 || events[0].State != anomaly.Spike || events[0].LimiterKey != "api" {
+		t.Fatalf("Expected a spike for api, got %+v", events)
+	}
+	if events[0].DenyRate != 0.6 || events[0].Requests != 100 || events[0].ZScore < 3 {
+		t.Errorf("Expected the spike's deny rate and z-score reported, got %+v", events[0])
+	}
+
+	observe(d, "api", 100, 55)
+	if events := d.Evaluate(now.Add(time.Minute)); len(events) != 0 {
+		t.Errorf("Expected an ongoing spike reported once, got %+v", events)
+	}
+	observe(d, "api", 100, 2)
+	events = d.Evaluate(now.Add(2 * time.Minute))
+	if len(events) != 1 || events[0].State != anomaly.Resolved {
+		t.Errorf("Expected the spike resolved, got %+v", events)
+	}
+}
+
+// TestWarmupAndMinimums tests that spikes are not reported while learning the baseline, on too few requests,
+// or below the minimum deny rate.
+func TestWarmupAndMinimums(t *testing.T) {
+	d := newDetector()
+	defer d.Close()
+	observe(d, "api", 100, 0)
+	observe(d, "idle", 100, 0)
+	d.Evaluate(start)
+	observe(d, "api", 100, 90)
+	if events := d.Evaluate(start.Add(time.Minute)); len(events) != 0 {
+		t.Fatalf("Expected no events during warmup, got %+v", events)
+	}
+
+	for i := 2; i < 10; i++ {
+		observe(d, "api", 1000, 0)
+		observe(d, "idle", 100, 0)
+		d.Evaluate(start.Add(time.Duration(i) * time.Minute))
+	}
+	observe(d, "api", 1000, 30) // 3% is abnormal but below the minimum deny rate
+	observe(d, "idle", 10, 10)  // Below the minimum number of requests
+	if events := d.Evaluate(start.Add(10 * time.Minute)); len(events) != 0 {
+		t.Errorf("Expected no events, got %+v", events)
+	}
+}
+
+// TestWebhook tests that events are posted as JSON to the webhook.
+func TestWebhook(t *testing.T) {
+	received := make(chan anomaly.Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event anomaly.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode event: %v", err)
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	event := anomaly.Event{Time: start, LimiterKey: "api", State: anomaly.Spike, DenyRate: 0.5, Requests: 100}
+	anomaly.Webhook(server.URL, time.Second)(event)
+	select {
+	case got := <-received:
+		if got != event {
+			t.Errorf("Expected %+v posted, got %+v", event, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the event posted")
+	}
+}
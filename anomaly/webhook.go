@@ -0,0 +1,39 @@
+package anomaly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// Webhook returns a handler POSTing each event as JSON to url, giving up after timeout. Failures are logged, and
+// events are not retried.
+func Webhook(url string, timeout time.Duration) Handler {
+	client := &http.Client{Timeout: timeout}
+	return func(event Event) {
+		if err := post(client, url, event); err != nil {
+			log.Warn().Err(err).Str("limiter_key", event.LimiterKey).Str("state", string(event.State)).Msg("Anomaly: Failed to send webhook")
+		}
+	}
+}
+
+// post sends the event to url and checks that it was accepted.
+func post(client *http.Client, url string, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("post event: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/admin"
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/banlist"
+	"learn.ratelimiter/config"
+)
+
+// NewAdminHandlerFromConfig creates the admin API handler managing the given ban list, with the audit sink,
+// authentication and version endpoint configured under admin, and any further options. The returned audit sink must be
+// closed by the caller.
+func NewAdminHandlerFromConfig(cfgFile *ConfigFile, bans *banlist.List, opts ...admin.Option) (*admin.Handler, admin.AuditSink, error) {
+	adminCfg := config.AdminConfig{}
+	if cfgFile.Admin != nil {
+		adminCfg = *cfgFile.Admin
+	}
+
+	if adminCfg.Auth != nil {
+		authenticators, err := newAdminAuthenticators(*adminCfg.Auth)
+		if err != nil {
+			log.Error().Err(err).Msg("API: Admin initialization failed: Invalid credentials")
+			return nil, nil, err
+		}
+		opts = append(opts, admin.WithAuthenticators(authenticators...))
+	}
+
+	if adminCfg.ExposeVersion {
+		opts = append(opts, admin.WithVersion(versionInfo(cfgFile)))
+	}
+
+	auditSink, err := newAuditSink(adminCfg.Audit)
+	if err != nil {
+		log.Error().Err(err).Msg("API: Admin initialization failed: Failed to create audit sink")
+		return nil, nil, err
+	}
+	return admin.NewHandler(bans, auditSink, opts...), auditSink, nil
+}
+
+// NewAdminHandlerFromConfigPath loads configuration from the given path and calls NewAdminHandlerFromConfig with it.
+func NewAdminHandlerFromConfigPath(configPath string, bans *banlist.List, opts ...admin.Option) (*admin.Handler, admin.AuditSink, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Admin initialization failed: Error loading configuration")
+		return nil, nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewAdminHandlerFromConfig(cfgFile, bans, opts...)
+}
+
+// NewAuditSinkFromConfigPath loads configuration from the given path and creates the audit sink configured under admin.audit.
+// If no audit sink is configured, an in-memory sink is returned. The caller is responsible for closing the sink.
+func NewAuditSinkFromConfigPath(configPath string) (admin.AuditSink, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Audit sink initialization failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	var auditCfg *config.AuditConfig
+	if cfgFile.Admin != nil {
+		auditCfg = cfgFile.Admin.Audit
+	}
+	return newAuditSink(auditCfg)
+}
+
+// newAuditSink creates the configured audit sink, or an in-memory sink if auditCfg is nil.
+func newAuditSink(auditCfg *config.AuditConfig) (admin.AuditSink, error) {
+	if auditCfg == nil {
+		auditCfg = &config.AuditConfig{}
+	}
+	switch auditCfg.Sink {
+	case config.AuditSinkFile:
+		log.Info().Str("path", auditCfg.Path).Msg("API: Creating file audit sink")
+		return admin.NewFileAuditSink(auditCfg.Path)
+	case config.AuditSinkRedis:
+		log.Info().Str("address", auditCfg.RedisParams.Address).Str("stream", auditCfg.Stream).Msg("API: Creating Redis audit sink")
+		client, err := apiinternal.InitRedisClient(&config.LimiterConfig{RedisParams: auditCfg.RedisParams})
+		if err != nil {
+			return nil, fmt.Errorf("audit sink: %w", err)
+		}
+		return admin.NewRedisAuditSink(client, auditCfg.Stream, auditCfg.MaxEntries), nil
+	default:
+		log.Info().Int64("max_entries", auditCfg.MaxEntries).Msg("API: Creating in-memory audit sink")
+		return admin.NewMemoryAuditSink(int(auditCfg.MaxEntries)), nil
+	}
+}
+
+// newAdminAuthenticators creates the authenticators for the configured bearer tokens and client certificates.
+func newAdminAuthenticators(authCfg config.AdminAuthConfig) ([]admin.Authenticator, error) {
+	var authenticators []admin.Authenticator
+	if len(authCfg.Tokens) > 0 {
+		tokens := make(map[string]admin.Principal, len(authCfg.Tokens))
+		for _, tokenCfg := range authCfg.Tokens {
+			token := tokenCfg.Token
+			if tokenCfg.TokenEnv != "" {
+				token = os.Getenv(tokenCfg.TokenEnv)
+				if token == "" {
+					return nil, fmt.Errorf("admin token '%s': environment variable '%s' is not set", tokenCfg.Name, tokenCfg.TokenEnv)
+				}
+			}
+			tokens[token] = admin.Principal{Name: tokenCfg.Name, Role: admin.Role(tokenCfg.Role)}
+		}
+		authenticators = append(authenticators, admin.BearerTokenAuthenticator(tokens))
+	}
+	if len(authCfg.ClientCerts) > 0 {
+		commonNames := make(map[string]admin.Principal, len(authCfg.ClientCerts))
+		for _, certCfg := range authCfg.ClientCerts {
+			commonNames[certCfg.CommonName] = admin.Principal{Name: certCfg.CommonName, Role: admin.Role(certCfg.Role)}
+		}
+		authenticators = append(authenticators, admin.ClientCertAuthenticator(commonNames))
+	}
+	log.Info().Int("tokens", len(authCfg.Tokens)).Int("client_certs", len(authCfg.ClientCerts)).Msg("API: Admin authentication configured")
+	return authenticators, nil
+}
+
+// NewBanSyncFromConfig returns a sync sharing the bans of the list with other instances through the Redis instance
+// configured under bans, already started, or nil if bans are not shared. The caller must Close it.
+func NewBanSyncFromConfig(cfgFile *ConfigFile, bans *banlist.List) (*banlist.RedisSync, error) {
+	if cfgFile.Bans == nil {
+		return nil, nil
+	}
+	log.Info().Str("address", cfgFile.Bans.RedisParams.Address).Msg("API: Sharing bans through Redis")
+	client, err := apiinternal.InitRedisClient(&config.LimiterConfig{RedisParams: cfgFile.Bans.RedisParams})
+	if err != nil {
+		return nil, fmt.Errorf("ban store: %w", err)
+	}
+	sync := banlist.NewRedisSync(client, bans)
+	sync.Start()
+	return sync, nil
+}
+
+// NewBanSyncFromConfigPath loads configuration from the given path and calls NewBanSyncFromConfig with it.
+func NewBanSyncFromConfigPath(configPath string, bans *banlist.List) (*banlist.RedisSync, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Ban sync initialization failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewBanSyncFromConfig(cfgFile, bans)
+}
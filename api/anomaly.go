@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/anomaly"
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/config"
+)
+
+// NewAnomalyDetectorFromConfig returns the deny rate anomaly detector cfgFile describes, already evaluating intervals,
+// or nil if anomaly detection is not configured. The caller must Close it.
+func NewAnomalyDetectorFromConfig(cfgFile *ConfigFile) (*anomaly.Detector, error) {
+	anomalyCfg := cfgFile.AnomalyDetection
+	if anomalyCfg == nil {
+		return nil, nil
+	}
+	var handlers []anomaly.Handler
+	if anomalyCfg.WebhookURL != "" {
+		timeout := anomalyCfg.WebhookTimeout
+		if timeout <= 0 {
+			timeout = config.DefaultAnomalyWebhookTimeout
+		}
+		handlers = append(handlers, anomaly.Webhook(anomalyCfg.WebhookURL, timeout))
+	}
+	return anomaly.New(*anomalyCfg, handlers...), nil
+}
+
+// NewAnomalyDetectorFromConfigPath loads configuration from the given path and calls NewAnomalyDetectorFromConfig with it.
+func NewAnomalyDetectorFromConfigPath(configPath string) (*anomaly.Detector, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Anomaly detection initialization failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewAnomalyDetectorFromConfig(cfgFile)
+}
@@ -4,19 +4,38 @@ package api
 import (
 	"fmt"
 	"io"
+	"os"
+	"time"
 
 	// Import time for zerolog
-	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log" // Import zerolog's global logger
 
 	apiinternal "learn.ratelimiter/api/internal"
 	"learn.ratelimiter/config"
+	"learn.ratelimiter/connregistry"
+	"learn.ratelimiter/internal/backendkey"
+	"learn.ratelimiter/internal/bulkhead"
+	"learn.ratelimiter/internal/capped"
+	"learn.ratelimiter/internal/cardinality"
+	"learn.ratelimiter/internal/history"
+	"learn.ratelimiter/internal/hotswap"
+	"learn.ratelimiter/internal/identifierlimit"
+	"learn.ratelimiter/internal/maxkeys"
+	"learn.ratelimiter/internal/mempressure"
+	"learn.ratelimiter/internal/regional"
+	"learn.ratelimiter/internal/splitbudget"
+	"learn.ratelimiter/internal/stats"
+	"learn.ratelimiter/limitlog"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/redact"
 	"learn.ratelimiter/types"
 )
 
 // clientCloser is an internal type that holds backend clients and implements io.Closer.
 type clientCloser struct {
-	clients types.BackendClients
+	backends *connregistry.Registry
+	// closers are closed before the backend clients, e.g., background jobs and the clients they own.
+	closers []io.Closer
 }
 
 // Close gracefully shuts down all initialized backend clients held by the clientCloser.
@@ -25,26 +44,16 @@ func (c *clientCloser) Close() error {
 	log.Info().Msg("API: Starting backend client shutdown...")
 	var errs []error
 
-	if c.clients.RedisClient != nil {
-		log.Info().Msg("API: Closing Redis client...")
-		if err := c.clients.RedisClient.Close(); err != nil {
-			errs = append(errs, fmt.Errorf("failed to close Redis client: %w", err))
-			log.Error().Err(err).Msg("API: Error closing Redis client")
-		} else {
-			log.Info().Msg("API: Redis client closed successfully.")
+	for _, closer := range c.closers {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+			log.Error().Err(err).Msg("API: Error closing background resource")
 		}
 	}
 
-	// Add closing logic for other clients (e.g., Memcache) here
-	// if c.clients.MemcacheClient != nil {
-	// 	log.Info().Msg("API: Closing Memcache client...")
-	// 	if err := c.clients.MemcacheClient.Close(); err != nil {
-	// 		errs = append(errs, fmt.Errorf("failed to close Memcache client: %w", err))
-	// 		log.Error().Err(err).Msg("API: Error closing Memcache client")
-	// 	} else {
-	// 		log.Info().Msg("API: Memcache client closed successfully.")
-	// 	}
-	// }
+	if err := c.backends.Close(); err != nil {
+		errs = append(errs, err)
+	}
 
 	if len(errs) > 0 {
 		// Consider using a dedicated multi-error type for better handling
@@ -55,66 +64,42 @@ func (c *clientCloser) Close() error {
 	return nil
 }
 
-// NewLimitersFromConfigPath loads configuration from the given path, initializes any needed backend clients,
-// and returns a map of rate limiters keyed by their configuration key, a map of configurations keyed by their key, and an io.Closer for backend clients.
-// It returns an error if configuration loading or client/limiter initialization fails.
-func NewLimitersFromConfigPath(configPath string) (map[string]types.Limiter, map[string]config.LimiterConfig, io.Closer, error) {
-	log.Info().Str("config_path", configPath).Msg("API: Starting initialization of rate limiters from config path")
-	cfgFile, err := apiinternal.LoadConfig(configPath)
-	if err != nil {
-		// Improved error log with structured fields
-		log.Error().Err(err).Str("config_path", configPath).Msg("API: Initialization failed: Error loading configuration")
-		return nil, nil, nil, fmt.Errorf("error loading configuration: %w", err)
+// NewLimitersFromConfig initializes the backend clients needed by the limiters cfgFile configures, and returns a map of
+// rate limiters keyed by their configuration key, a map of configurations keyed by their key, and an io.Closer for
+// backend clients. Both maps also hold the members of budget groups, mapped to the limiter and configuration of their
+// group. It also applies the configured logging.identifiers redaction mode and hash key to the process (see package
+// redact). It returns an error if client/limiter initialization fails.
+func NewLimitersFromConfig(cfgFile *ConfigFile, opts ...LimiterOption) (map[string]types.Limiter, map[string]config.LimiterConfig, io.Closer, error) {
+	options := newLimiterOptions(opts)
+	if err := configureRedaction(cfgFile.Logging); err != nil {
+		log.Error().Err(err).Msg("API: Initialization failed: Error configuring identifier redaction")
+		return nil, nil, nil, err
 	}
+	limitlog.Configure(cfgFile.Limiters)
 
 	if len(cfgFile.Limiters) == 0 {
 		// Improved log with structured fields
-		log.Error().Str("config_path", configPath).Msg("API: Initialization failed: No limiter configurations found")
-		return nil, nil, nil, fmt.Errorf("no limiter configurations found in %s", configPath)
+		log.Error().Msg("API: Initialization failed: No limiter configurations found")
+		return nil, nil, nil, fmt.Errorf("no limiter configurations found")
 	}
 
-	backendClients := types.BackendClients{}
-	var redisClient *redis.Client
-
-	needsRedis := false
-	for _, cfg := range cfgFile.Limiters {
-		if cfg.Backend == config.Redis {
-			needsRedis = true
-			break
-		}
-	}
-
-	if needsRedis {
-		log.Info().Msg("API: Redis backend required for one or more limiters. Initializing Redis client...")
-		// Find the first Redis config to initialize the client
-		var redisCfg *config.LimiterConfig
-		for _, cfg := range cfgFile.Limiters {
-			if cfg.Backend == config.Redis && cfg.RedisParams != nil {
-				redisCfg = &cfg
-				break
-			}
-		}
-		// If no Redis config with params is found, return an error
-		if redisCfg == nil {
-			err := fmt.Errorf("redis backend specified but no valid redis_params found in config")
-			log.Error().Err(err).Msg("API: Initialization failed")
-			return nil, nil, nil, err
-		}
-
-		redisClient, err = apiinternal.InitRedisClient(redisCfg)
-		if err != nil {
-			// Improved error log with structured fields
-			log.Error().Err(err).Msg("API: Initialization failed: Failed to initialize Redis client")
-			return nil, nil, nil, err // initRedisClient already wraps the error
-		}
-		backendClients.RedisClient = redisClient
-	}
-
-	// Add initialization for other backends here if needed by the config
-	// if anyCfg.Backend == config.Memcache { ... }
+	// Backend connections are created as limiters need them and shared by limiters with identical parameters
+	backends := newBackendRegistry(options.faults)
 
 	limiters := make(map[string]types.Limiter)
 	limiterConfigs := make(map[string]config.LimiterConfig)
+	closer := &clientCloser{backends: backends}
+	var reconcilers []*regional.Reconciler
+	// Limiters are registered with peer mode once every limiter was created, like reconcilers are started
+	peerLimiters := make(map[string]types.Limiter)
+
+	// A failed initialization closes the backends, leases and reconcilers opened for the limiters created before
+	created := false
+	defer func() {
+		if !created {
+			closer.Close()
+		}
+	}()
 
 	log.Info().Int("count", len(cfgFile.Limiters)).Msg("API: Creating limiter instances...")
 	for _, cfg := range cfgFile.Limiters {
@@ -134,25 +119,270 @@ func NewLimitersFromConfigPath(configPath string) (map[string]types.Limiter, map
 			return nil, nil, nil, err
 		}
 
-		limiter, err := limiterFactory.CreateLimiter(cfg, backendClients)
+		backendClients, err := limiterClients(backends, cfgFile.StartupPolicy, cfg)
 		if err != nil {
-			err = fmt.Errorf("limiter '%s': failed to create instance: %w", cfg.Key, err)
-			// Improved error log with structured fields
-			log.Error().Err(err).Str("limiter_key", cfg.Key).Msg("API: Initialization failed: Failed to create instance")
-			return nil, nil, nil, err
+			log.Error().Err(err).Str("limiter_key", cfg.Key).Msg("API: Initialization failed: Failed to initialize backend client")
+			return nil, nil, nil, err // InitRedisClient already wraps the error
 		}
 
-		limiters[cfg.Key] = limiter
+		var limiter types.Limiter
+		if cfg.RegionalBudget != nil {
+			regionalLimiter, reconciler, err := newRegionalLimiter(limiterFactory, cfg, backendClients)
+			if err != nil {
+				err = fmt.Errorf("limiter '%s': failed to create regional budget: %w", cfg.Key, err)
+				log.Error().Err(err).Str("limiter_key", cfg.Key).Msg("API: Initialization failed: Failed to create regional budget")
+				return nil, nil, nil, err
+			}
+			limiter = regionalLimiter
+			if reconciler != nil {
+				reconcilers = append(reconcilers, reconciler)
+				closer.closers = append(closer.closers, reconciler)
+			}
+		} else {
+			limiter, err = newLimiter(limiterFactory, cfg, backendClients)
+			if err != nil {
+				// Improved error log with structured fields
+				log.Error().Err(err).Str("limiter_key", cfg.Key).Msg("API: Initialization failed: Failed to create instance")
+				return nil, nil, nil, err
+			}
+			limiter, err = withMigration(backends, cfgFile.StartupPolicy, limiterFactory, cfg, limiter)
+			if err != nil {
+				log.Error().Err(err).Str("limiter_key", cfg.Key).Msg("API: Initialization failed: Failed to create migration target")
+				return nil, nil, nil, err
+			}
+			var leaseCloser io.Closer
+			limiter, leaseCloser = withLease(cfg, limiter)
+			if leaseCloser != nil {
+				// Lease closers run before the Redis client is closed, so unused tokens can still be returned
+				closer.closers = append(closer.closers, leaseCloser)
+			}
+			limiter = options.withOverrides(limiterFactory, cfg, backendClients, limiter)
+			var local types.Limiter
+			if limiter, local = options.withPeers(cfg, limiter); local != nil {
+				peerLimiters[cfg.Key] = local
+			}
+		}
+		// The eviction watch ends with the Redis client, or when a reload retires the limiter
+		var pressureCloser io.Closer
+		limiter, pressureCloser = withMemoryPressure(cfg, backendClients, limiter)
+		limiter = withFailOpen(cfgFile.StartupPolicy, cfg, limiter)
+		limiter = withBulkhead(cfg, limiter)
+		limiter = withStats(cfg, limiter)
+		limiter = withHistory(cfg, limiter)
+		limiter = withMaxKeys(cfg, backendClients, limiter)
+		limiter = withUniqueIdentifiers(cfg, backendClients, limiter)
+		limiter = options.withReadOnly(cfg, limiter)
+		limiter = withIdentifierLimit(cfg, limiter)
+
+		// Limiters are swappable so a configuration reload can replace them under the same key (see Reloader)
+		limiters[cfg.Key] = hotswap.NewLimiter(cfg.Key, cfg.Algorithm, limiter, pressureCloser)
 		limiterConfigs[cfg.Key] = cfg // Store the config as well
+		recordLimiterConfig(cfg)
 		// Improved success log with structured fields
 		log.Info().Str("limiter_key", cfg.Key).Str("algorithm", string(cfg.Algorithm)).Str("backend", string(cfg.Backend)).Msg("API: Limiter created successfully.")
 	}
 
+	// Members of a budget group are aliases of the group's limiter, sharing its state, configuration and reloads
+	for _, group := range cfgFile.BudgetGroups {
+		for _, member := range group.Members {
+			limiters[member] = limiters[group.Limiter]
+			limiterConfigs[member] = limiterConfigs[group.Limiter]
+		}
+		log.Info().Str("limiter_key", group.Limiter).Strs("members", group.Members).Msg("API: Budget group created.")
+	}
+
+	// Reconcilers start only once every limiter was created, so a failed initialization leaves nothing running
+	for _, reconciler := range reconcilers {
+		reconciler.Start()
+	}
+	for key, local := range peerLimiters {
+		options.peers.Register(key, local)
+	}
+	created = true
+
 	log.Info().Msg("API: All rate limiters initialized.")
 
-	closer := &clientCloser{clients: backendClients}
 	return limiters, limiterConfigs, closer, nil
 }
 
+// NewLimitersFromConfigPath loads configuration from the given path and calls NewLimitersFromConfig with it.
+func NewLimitersFromConfigPath(configPath string, opts ...LimiterOption) (map[string]types.Limiter, map[string]config.LimiterConfig, io.Closer, error) {
+	log.Info().Str("config_path", configPath).Msg("API: Starting initialization of rate limiters from config path")
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		// Improved error log with structured fields
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Initialization failed: Error loading configuration")
+		return nil, nil, nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewLimitersFromConfig(cfgFile, opts...)
+}
+
+// newLimiter creates the limiter described by cfg, combined with its write budget and per-minute cap if they are configured.
+func newLimiter(limiterFactory LimiterFactory, cfg config.LimiterConfig, backendClients types.BackendClients) (types.Limiter, error) {
+	limiter, err := limiterFactory.CreateLimiter(cfg, backendClients)
+	if err != nil {
+		return nil, fmt.Errorf("limiter '%s': failed to create instance: %w", cfg.Key, err)
+	}
+
+	if writeCfg, ok := cfg.WriteBudgetConfig(); ok {
+		writeLimiter, err := limiterFactory.CreateLimiter(writeCfg, backendClients)
+		if err != nil {
+			return nil, fmt.Errorf("limiter '%s': failed to create write budget: %w", cfg.Key, err)
+		}
+		limiter = splitbudget.NewLimiter(cfg.Key, limiter, writeLimiter)
+	}
+
+	if capCfg, ok := cfg.PerMinuteCapConfig(); ok {
+		capFactory, err := NewLimiterFactory(capCfg)
+		if err != nil {
+			return nil, fmt.Errorf("limiter '%s': failed to get per-minute cap factory: %w", cfg.Key, err)
+		}
+		capLimiter, err := capFactory.CreateLimiter(capCfg, backendClients)
+		if err != nil {
+			return nil, fmt.Errorf("limiter '%s': failed to create per-minute cap: %w", cfg.Key, err)
+		}
+		limiter = capped.NewLimiter(cfg.Key, limiter, capLimiter, capped.WithCapPolicy(capCfg.Key))
+	}
+	return limiter, nil
+}
+
+// withBulkhead caps the simultaneous backend calls of limiter if cfg configures a bulkhead.
+func withBulkhead(cfg config.LimiterConfig, limiter types.Limiter) types.Limiter {
+	if cfg.Bulkhead == nil {
+		return limiter
+	}
+	return bulkhead.NewLimiter(cfg.Key, limiter, *cfg.Bulkhead)
+}
+
+// withMemoryPressure handles Redis running out of memory for limiter if cfg configures it, watching the evictions of
+// its keys if asked to. The returned closer, nil if no evictions are watched, stops watching them.
+func withMemoryPressure(cfg config.LimiterConfig, backendClients types.BackendClients, limiter types.Limiter) (types.Limiter, io.Closer) {
+	if cfg.MemoryPressure == nil {
+		return limiter, nil
+	}
+	pressureLimiter := mempressure.NewLimiter(cfg.Key, limiter, *cfg.MemoryPressure, evictionPenalty(cfg))
+	if cfg.MemoryPressure.WatchEvictions && backendClients.RedisClient != nil {
+		keys := []string{cfg.Key}
+		if cfg.WriteBudget != nil {
+			keys = append(keys, cfg.Key+config.WriteBudgetSuffix)
+		}
+		for _, key := range keys {
+			prefix := key + backendkey.Separator
+			switch cfg.Algorithm {
+			case config.LeakyBucket:
+				prefix = "leaky_bucket" + backendkey.Separator + prefix
+			case config.SlidingWindowLog:
+				prefix = "sliding_log" + backendkey.Separator + prefix
+			}
+			mempressure.Watch(backendClients.RedisClient, prefix, pressureLimiter)
+		}
+		return pressureLimiter, pressureLimiter
+	}
+	return pressureLimiter, nil
+}
+
+// evictionPenalty returns the eviction penalty of cfg, defaulting to the time the limiter's state takes to reset by
+// itself: the window, or the time a bucket takes to refill or drain from full.
+func evictionPenalty(cfg config.LimiterConfig) time.Duration {
+	if cfg.MemoryPressure.EvictionPenalty > 0 {
+		return cfg.MemoryPressure.EvictionPenalty
+	}
+	var capacity, rate int
+	switch {
+	case cfg.WindowParams != nil:
+		return cfg.WindowParams.Window
+	case cfg.TokenBucketParams != nil:
+		capacity, rate = cfg.TokenBucketParams.Capacity, cfg.TokenBucketParams.Rate
+	case cfg.LeakyBucketParams != nil:
+		capacity, rate = cfg.LeakyBucketParams.Capacity, cfg.LeakyBucketParams.Rate
+	}
+	if rate <= 0 {
+		return config.DefaultEvictionPenalty
+	}
+	return time.Duration(float64(capacity) / float64(rate) * float64(time.Second))
+}
+
+// withStats counts the decisions of limiter per identifier if cfg configures stats.
+func withStats(cfg config.LimiterConfig, limiter types.Limiter) types.Limiter {
+	if cfg.Stats == nil {
+		return limiter
+	}
+	return stats.NewLimiter(cfg.Key, limiter, *cfg.Stats)
+}
+
+// withHistory keeps the latest decisions of limiter per identifier if cfg configures a history.
+func withHistory(cfg config.LimiterConfig, limiter types.Limiter) types.Limiter {
+	if cfg.History == nil {
+		return limiter
+	}
+	return history.NewLimiter(cfg.Key, limiter, *cfg.History)
+}
+
+// withMaxKeys caps the distinct identifiers passed to limiter if cfg configures a key cap. Redis limiters count the
+// identifiers seen by all instances, and others those seen by this instance.
+func withMaxKeys(cfg config.LimiterConfig, backendClients types.BackendClients, limiter types.Limiter) types.Limiter {
+	if cfg.MaxKeys == nil {
+		return limiter
+	}
+	if cfg.Backend == config.Redis && backendClients.RedisClient != nil {
+		return maxkeys.NewRedisLimiter(cfg.Key, limiter, *cfg.MaxKeys, backendClients.RedisClient)
+	}
+	return maxkeys.NewLimiter(cfg.Key, limiter, *cfg.MaxKeys)
+}
+
+// withUniqueIdentifiers exports the estimated number of distinct identifiers passed to limiter if cfg configures it.
+// It wraps the key cap, so identifiers turned away by the cap are counted too.
+func withUniqueIdentifiers(cfg config.LimiterConfig, backendClients types.BackendClients, limiter types.Limiter) types.Limiter {
+	if cfg.UniqueIdentifiers == nil {
+		return limiter
+	}
+	if cfg.UniqueIdentifiers.Merge && backendClients.RedisClient != nil {
+		return cardinality.NewRedisLimiter(cfg.Key, limiter, *cfg.UniqueIdentifiers, backendClients.RedisClient)
+	}
+	return cardinality.NewLimiter(cfg.Key, limiter, *cfg.UniqueIdentifiers)
+}
+
+// withIdentifierLimit bounds the length of identifiers passed to limiter if cfg configures an identifier limit.
+// It wraps every other decorator, so oversized identifiers are handled before they reach any of them.
+func withIdentifierLimit(cfg config.LimiterConfig, limiter types.Limiter) types.Limiter {
+	if cfg.IdentifierLimit == nil {
+		return limiter
+	}
+	return identifierlimit.NewLimiter(cfg.Key, limiter, *cfg.IdentifierLimit)
+}
+
+// configureRedaction applies the identifier redaction mode and hash key of cfg to the process.
+func configureRedaction(cfg config.LoggingConfig) error {
+	var key []byte
+	if cfg.HashKeyEnv != "" {
+		key = []byte(os.Getenv(cfg.HashKeyEnv))
+		if len(key) == 0 {
+			return fmt.Errorf("logging.hash_key_env: environment variable '%s' is not set", cfg.HashKeyEnv)
+		}
+	}
+	redact.SetMode(cfg.Identifiers)
+	redact.SetHashKey(key)
+	return nil
+}
+
+// recordLimiterConfig exports the algorithm, backend and limits of cfg as metrics, so dashboards can compare usage
+// with the configured limits and configurations differing between instances show.
+func recordLimiterConfig(cfg config.LimiterConfig) {
+	params := make(map[string]float64)
+	switch {
+	case (cfg.Algorithm == config.FixedWindowCounter || cfg.Algorithm == config.SlidingWindowCounter || cfg.Algorithm == config.SlidingWindowLog) && cfg.WindowParams != nil:
+		params[metrics.ConfiguredLimit] = float64(cfg.WindowParams.Limit)
+		params[metrics.ConfiguredWindowSeconds] = cfg.WindowParams.Window.Seconds()
+	case cfg.Algorithm == config.TokenBucket && cfg.TokenBucketParams != nil:
+		params[metrics.ConfiguredRate] = float64(cfg.TokenBucketParams.Rate)
+		params[metrics.ConfiguredCapacity] = float64(cfg.TokenBucketParams.Capacity)
+		params[metrics.ConfiguredMaxDebt] = float64(cfg.TokenBucketParams.MaxDebt)
+	case cfg.Algorithm == config.LeakyBucket && cfg.LeakyBucketParams != nil:
+		params[metrics.ConfiguredRate] = float64(cfg.LeakyBucketParams.Rate)
+		params[metrics.ConfiguredCapacity] = float64(cfg.LeakyBucketParams.Capacity)
+	}
+	metrics.SetLimiterConfig(cfg.Key, string(cfg.Algorithm), string(cfg.Backend), params)
+}
+
 // You could also add a function that takes the config struct directly:
 // func NewLimitersFromConfigStruct(cfg ConfigFile) (map[string]types.Limiter, io.Closer, error) { ... }
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/apikeys"
+	"learn.ratelimiter/config"
+)
+
+// NewAPIKeyRegistryFromConfig creates the registry of the API keys configured under api_keys, already loaded and, with
+// Redis, refreshing in the background. It also returns the api_keys configuration, holding the header and the limiter
+// of each plan. It returns nil values if no API keys are configured. The caller is responsible for closing the
+// registry.
+func NewAPIKeyRegistryFromConfig(cfgFile *ConfigFile) (*apikeys.Registry, *config.APIKeysConfig, error) {
+	keysCfg := cfgFile.APIKeys
+	if keysCfg == nil {
+		return nil, nil, nil
+	}
+	resolved := *keysCfg
+	if resolved.Header == "" {
+		resolved.Header = config.DefaultAPIKeyHeader
+	}
+
+	staticKeys := make(map[string]apikeys.APIKey, len(keysCfg.Keys))
+	for _, keyCfg := range keysCfg.Keys {
+		key := keyCfg.Key
+		if keyCfg.KeyEnv != "" {
+			key = os.Getenv(keyCfg.KeyEnv)
+			if key == "" {
+				return nil, nil, fmt.Errorf("api key '%s': environment variable '%s' is not set", keyCfg.Name, keyCfg.KeyEnv)
+			}
+		}
+		staticKeys[key] = apikeys.APIKey{Name: keyCfg.Name, Plan: keyCfg.Plan}
+	}
+	stores := []apikeys.Store{apikeys.NewStaticStore(staticKeys)}
+
+	refreshInterval := keysCfg.RefreshInterval
+	if refreshInterval <= 0 {
+		refreshInterval = config.DefaultAPIKeyRefreshInterval
+	}
+	if keysCfg.RedisParams != nil {
+		log.Info().Str("address", keysCfg.RedisParams.Address).Msg("API: Creating Redis API key store")
+		client, err := apiinternal.InitRedisClient(&config.LimiterConfig{RedisParams: keysCfg.RedisParams})
+		if err != nil {
+			return nil, nil, fmt.Errorf("api key store: %w", err)
+		}
+		stores = append(stores, apikeys.NewRedisStore(client))
+	}
+
+	registry := apikeys.NewRegistry(refreshInterval, stores...)
+	registry.Start()
+	log.Info().Int("static_keys", len(staticKeys)).Int("plans", len(keysCfg.Plans)).Bool("redis", keysCfg.RedisParams != nil).Msg("API: API key registry initialized")
+	return registry, &resolved, nil
+}
+
+// NewAPIKeyRegistryFromConfigPath loads configuration from the given path and calls NewAPIKeyRegistryFromConfig with it.
+func NewAPIKeyRegistryFromConfigPath(configPath string) (*apikeys.Registry, *config.APIKeysConfig, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: API key initialization failed: Error loading configuration")
+		return nil, nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewAPIKeyRegistryFromConfig(cfgFile)
+}
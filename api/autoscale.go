@@ -0,0 +1,30 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/autoscale"
+)
+
+// NewAutoscaleHintsFromConfig returns the autoscaling hints cfgFile describes, already publishing metrics, or nil if
+// autoscaling hints are not configured. The caller must Close the hints.
+func NewAutoscaleHintsFromConfig(cfgFile *ConfigFile) (*autoscale.Hints, error) {
+	autoscalingCfg := cfgFile.Autoscaling
+	if autoscalingCfg == nil {
+		return nil, nil
+	}
+	return autoscale.New(autoscalingCfg.Windows, autoscalingCfg.Resolution), nil
+}
+
+// NewAutoscaleHintsFromConfigPath loads configuration from the given path and calls NewAutoscaleHintsFromConfig with it.
+func NewAutoscaleHintsFromConfigPath(configPath string) (*autoscale.Hints, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Autoscaling hints initialization failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewAutoscaleHintsFromConfig(cfgFile)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"io"
+
+	"github.com/go-redis/redis/v8"
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/connregistry"
+	"learn.ratelimiter/faults"
+	"learn.ratelimiter/internal/failopen"
+	"learn.ratelimiter/types"
+)
+
+// newBackendRegistry creates a connection registry initializing Redis clients like the rest of the API, with the
+// faults of injector, if set, injected into their commands, and Memcache clients with memcacheDialer.
+func newBackendRegistry(injector *faults.Injector) *connregistry.Registry {
+	return connregistry.New(func(params config.RedisBackendConfig, ping bool) (*redis.Client, error) {
+		var client *redis.Client
+		if !ping {
+			client = apiinternal.NewRedisClient(&params)
+		} else {
+			var err error
+			if client, err = apiinternal.InitRedisClient(&config.LimiterConfig{RedisParams: &params}); err != nil {
+				return nil, err
+			}
+		}
+		if injector != nil {
+			client.AddHook(injector)
+		}
+		return client, nil
+	}, connregistry.WithMemcacheDialer(memcacheDialer(injector)))
+}
+
+// WithFaults injects the faults of injector into the commands the limiters send to Redis and Memcache, to exercise
+// their failure handling (e.g., fail_open) in tests and staging. Connection checks of Redis on startup are not
+// affected.
+func WithFaults(injector *faults.Injector) LimiterOption {
+	return func(o *limiterOptions) {
+		o.faults = injector
+	}
+}
+
+// limiterClients returns the backend clients of cfg. Under the lazy and degraded startup policies, limiters that
+// are not required get clients without checking their backend, which connect on first use.
+func limiterClients(backends *connregistry.Registry, policy config.StartupPolicy, cfg config.LimiterConfig) (types.BackendClients, error) {
+	if cfg.Required || policy == "" || policy == config.StartupStrict {
+		return backends.Clients(cfg)
+	}
+	return backends.LazyClients(cfg)
+}
+
+// withFailOpen allows the requests whose check fails with an error under the degraded startup policy, for limiters
+// that are not required and have a remote backend.
+func withFailOpen(policy config.StartupPolicy, cfg config.LimiterConfig, limiter types.Limiter) types.Limiter {
+	if policy != config.StartupDegraded || cfg.Required || cfg.Backend == config.InMemory {
+		return limiter
+	}
+	return failopen.NewLimiter(cfg.Key, limiter)
+}
+
+// BackendRegistry returns the registry of backend connections used by the limiters returned with closer by
+// NewLimitersFromConfigPath, e.g., to serve their health with admin.WithBackends. It returns nil for other closers.
+func BackendRegistry(closer io.Closer) *connregistry.Registry {
+	c, ok := closer.(*clientCloser)
+	if !ok {
+		return nil
+	}
+	return c.backends
+}
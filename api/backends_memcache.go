@@ -0,0 +1,46 @@
+//go:build !nomemcache
+
+package api
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/connregistry"
+	"learn.ratelimiter/faults"
+	"learn.ratelimiter/internal/memcacheclient"
+)
+
+// memcacheDialer returns a MemcacheDialer creating Memcache clients of their parameters, pinging their servers if
+// ping is true. The faults of injector, if set, are injected into the connections of the clients.
+func memcacheDialer(injector *faults.Injector) connregistry.MemcacheDialer {
+	return func(params config.MemcacheBackendConfig, ping bool) (connregistry.MemcacheClient, error) {
+		return dialMemcache(params, ping, injector)
+	}
+}
+
+// dialMemcache creates a Memcache client of params with the faults of injector, if set, pinging its servers if ping
+// is true.
+func dialMemcache(params config.MemcacheBackendConfig, ping bool, injector *faults.Injector) (connregistry.MemcacheClient, error) {
+	client, err := memcacheclient.New(&params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Memcache client for %s: %w", strings.Join(params.Addresses, ","), err)
+	}
+	if injector != nil {
+		dial := client.DialContext
+		if dial == nil {
+			// The client bounds the dial with its timeout through the context
+			dial = (&net.Dialer{}).DialContext
+		}
+		client.DialContext = injector.Dial(dial)
+	}
+	if ping {
+		if err := client.Ping(); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to connect to Memcache at %s: %w", strings.Join(params.Addresses, ","), err)
+		}
+	}
+	return client, nil
+}
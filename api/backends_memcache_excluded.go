@@ -0,0 +1,13 @@
+//go:build nomemcache
+
+package api
+
+import (
+	"learn.ratelimiter/connregistry"
+	"learn.ratelimiter/faults"
+)
+
+// memcacheDialer returns nil in builds with the nomemcache tag, so limiters using the Memcache backend get an error.
+func memcacheDialer(*faults.Injector) connregistry.MemcacheDialer {
+	return nil
+}
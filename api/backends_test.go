@@ -0,0 +1,123 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/internal/testenv"
+)
+
+// TestBackendConnections tests that limiters naming different backend connections keep their state in different
+// Redis databases.
+func TestBackendConnections(t *testing.T) {
+	addr := testenv.Redis(t)
+	path := writeConfig(t, fmt.Sprintf(`
+backends:
+  primary:
+    redis:
+      address: %[1]q
+  secondary:
+    redis:
+      address: %[1]q
+      db: 1
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "redis"
+    connection: "primary"
+    window_params:
+      window: 1h
+      limit: 10
+  - key: "upload"
+    algorithm: "fixed_window_counter"
+    backend: "redis"
+    connection: "secondary"
+    window_params:
+      window: 1h
+      limit: 10
+`, addr))
+	limiters, configs, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+	if got := configs["upload"].RedisParams; got == nil || got.DB != 1 {
+		t.Fatalf("Expected the secondary connection's parameters, got %+v", got)
+	}
+
+	// A unique identifier keeps state left by earlier runs on a shared server from matching
+	ctx := context.Background()
+	identifier := fmt.Sprintf("connections-%d", time.Now().UnixNano())
+	if _, err := limiters["upload"].Allow(ctx, identifier); err != nil {
+		t.Fatalf("Allow failed: %v", err)
+	}
+	for db, want := range map[int]int{0: 0, 1: 1} {
+		client := redis.NewClient(&redis.Options{Addr: addr, DB: db})
+		keys, err := client.Keys(ctx, "*"+identifier+"*").Result()
+		client.Close()
+		if err != nil {
+			t.Fatalf("Failed to list keys in db %d: %v", db, err)
+		}
+		if len(keys) != want {
+			t.Errorf("Expected %d keys for the identifier in db %d, got %v", want, db, keys)
+		}
+	}
+}
+
+// TestBackendConnectionsInvalid tests that limiters referencing connections inconsistently are rejected.
+func TestBackendConnectionsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter string
+		wantErr string
+	}{
+		{
+			name: "unknown connection",
+			limiter: `
+    backend: "redis"
+    connection: "missing"`,
+			wantErr: "unknown backend connection",
+		},
+		{
+			name: "both connection and params",
+			limiter: `
+    backend: "redis"
+    connection: "primary"
+    redis_params:
+      address: "localhost:6379"`,
+			wantErr: "both connection and redis_params",
+		},
+		{
+			name: "non-redis backend",
+			limiter: `
+    backend: "in_memory"
+    connection: "primary"`,
+			wantErr: "in_memory backend",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, `
+backends:
+  primary:
+    redis:
+      address: "localhost:6379"
+limiters:
+  - key: "api"
+    algorithm: "token_bucket"
+    token_bucket_params:
+      rate: 1
+      capacity: 1`+tt.limiter+"\n")
+			_, _, _, err := api.NewLimitersFromConfigPath(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package api_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"learn.ratelimiter/api"
+)
+
+// budgetGroupYAML configures a search limiter whose budget is shared by two member keys.
+const budgetGroupYAML = `
+limiters:
+  - key: "search"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: %d
+budget_groups:
+  - limiter: "search"
+    members: ["search_web", "search_api"]
+`
+
+// TestBudgetGroup tests that the members of a budget group draw from the budget of its limiter, including after a
+// reload changed it.
+func TestBudgetGroup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFiles(t, filepath.Dir(path), map[string]string{"config.yaml": fmt.Sprintf(budgetGroupYAML, 4)})
+	limiters, configs, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+	reloader := api.NewReloader(path, limiters, configs)
+	defer reloader.Close()
+
+	if configs["search_web"].Key != "search" {
+		t.Errorf("Expected members to have the configuration of limiter 'search', got key '%s'", configs["search_web"].Key)
+	}
+	allowed := countAllowed(limiters["search_web"], "client1", 2) + countAllowed(limiters["search_api"], "client1", 2)
+	if allowed != 4 {
+		t.Fatalf("Expected the 4 requests of the members to be allowed, got %d", allowed)
+	}
+	if allowed := countAllowed(limiters["search"], "client1", 1); allowed != 0 {
+		t.Errorf("Expected the members to have used the shared budget, got %d allowed", allowed)
+	}
+
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(budgetGroupYAML, 10)), 0o600); err != nil {
+		t.Fatalf("Failed to rewrite config: %v", err)
+	}
+	reloaded, err := reloader.Reload()
+	if err != nil {
+		t.Fatalf("Reload returned error: %v", err)
+	}
+	if len(reloaded) != 1 || reloaded[0] != "search" {
+		t.Errorf("Expected only limiter 'search' to be reloaded, got %v", reloaded)
+	}
+	if allowed := countAllowed(limiters["search_web"], "client2", 12); allowed != 10 {
+		t.Errorf("Expected the reloaded limit of 10 to apply to members, got %d allowed", allowed)
+	}
+}
+
+// TestBudgetGroupValidation tests that groups must share the budget of a limiter, under keys of their own.
+func TestBudgetGroupValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		groups string
+		want   string
+	}{
+		{"unknown limiter", `[{limiter: "missing", members: ["b"]}]`, "unknown limiter 'missing'"},
+		{"no members", `[{limiter: "a"}]`, "has no members"},
+		{"limiter key", `[{limiter: "a", members: ["a"]}]`, "is a limiter key"},
+		{"two groups", `[{limiter: "a", members: ["b"]}, {limiter: "a", members: ["b"]}]`, "is listed for both"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"config.yaml": limiterYAML("a") + "budget_groups: " + tc.groups + "\n"})
+			_, _, _, err := api.NewLimitersFromConfigPath(filepath.Join(dir, "config.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
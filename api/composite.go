@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+
+	"learn.ratelimiter/config"
+	fcredis "learn.ratelimiter/internal/fixedcounter/redis"
+	"learn.ratelimiter/types"
+)
+
+// NewCompositeLimiter creates a limiter allowing a request only if every limit in cfgs allows it, checking and consuming
+// all of them in one atomic Redis script so a request denied by one limit consumes no budget from the others.
+// Each configuration must be a Redis fixed window counter with wall-clock windows and without smoothing; its key names
+// the state it shares with a limiter created from the same configuration.
+func NewCompositeLimiter(key string, cfgs []config.LimiterConfig, clients types.BackendClients) (types.Limiter, error) {
+	if len(cfgs) == 0 {
+		return nil, fmt.Errorf("composite limiter '%s': no limits configured", key)
+	}
+	if clients.RedisClient == nil {
+		return nil, fmt.Errorf("composite limiter '%s': redis client is required", key)
+	}
+	limits := make([]fcredis.Limit, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if cfg.Algorithm != config.FixedWindowCounter || cfg.Backend != config.Redis {
+			return nil, fmt.Errorf("composite limiter '%s': limit '%s' must be a redis fixed_window_counter", key, cfg.Key)
+		}
+		if cfg.WindowParams == nil || cfg.WindowParams.Window <= 0 || cfg.WindowParams.Limit <= 0 {
+			return nil, fmt.Errorf("composite limiter '%s': limit '%s' needs a positive window and limit", key, cfg.Key)
+		}
+		if cfg.WindowParams.Smoothing != nil {
+			return nil, fmt.Errorf("composite limiter '%s': smoothing is not supported for limit '%s'", key, cfg.Key)
+		}
+		if cfg.WindowParams.Alignment == config.AlignFirstRequest {
+			return nil, fmt.Errorf("composite limiter '%s': first_request window alignment is not supported for limit '%s'", key, cfg.Key)
+		}
+		limits = append(limits, fcredis.Limit{Key: cfg.Key, Window: cfg.WindowParams.Window, Limit: cfg.WindowParams.Limit})
+	}
+	return fcredis.NewCompositeLimiter(clients.RedisClient, key, limits), nil
+}
@@ -0,0 +1,50 @@
+package api_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/types"
+)
+
+// TestCompositeLimiterValidation tests that only Redis fixed window limits without smoothing can be combined.
+func TestCompositeLimiterValidation(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer client.Close()
+	clients := types.BackendClients{RedisClient: client}
+	limit := func(key string, algorithm config.AlgorithmType, backend config.BackendType) config.LimiterConfig {
+		return config.LimiterConfig{
+			Key:          key,
+			Algorithm:    algorithm,
+			Backend:      backend,
+			WindowParams: &config.WindowConfig{Window: time.Second, Limit: 10},
+		}
+	}
+
+	if _, err := api.NewCompositeLimiter("api", []config.LimiterConfig{
+		limit("api_per_second", config.FixedWindowCounter, config.Redis),
+		limit("api_per_hour", config.FixedWindowCounter, config.Redis),
+	}, clients); err != nil {
+		t.Errorf("Expected composite of redis fixed windows to be accepted, got %v", err)
+	}
+
+	smoothed := limit("api_smoothed", config.FixedWindowCounter, config.Redis)
+	smoothed.WindowParams.Smoothing = &config.SmoothingConfig{BurstFraction: 0.5}
+	for name, cfgs := range map[string][]config.LimiterConfig{
+		"empty":     nil,
+		"in_memory": {limit("api_memory", config.FixedWindowCounter, config.InMemory)},
+		"algorithm": {limit("api_sliding", config.SlidingWindowCounter, config.Redis)},
+		"smoothing": {smoothed},
+	} {
+		if _, err := api.NewCompositeLimiter("api", cfgs, clients); err == nil {
+			t.Errorf("Expected %s composite to be rejected", name)
+		}
+	}
+	if _, err := api.NewCompositeLimiter("api", []config.LimiterConfig{limit("api_per_second", config.FixedWindowCounter, config.Redis)}, types.BackendClients{}); err == nil {
+		t.Error("Expected composite without a redis client to be rejected")
+	}
+}
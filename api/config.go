@@ -0,0 +1,14 @@
+package api
+
+import (
+	apiinternal "learn.ratelimiter/api/internal"
+)
+
+// ConfigFile is a loaded configuration. The ...FromConfig constructors take it so a process creating several components
+// loads the configuration once, and every component sees the same version of it.
+type ConfigFile = apiinternal.ConfigFile
+
+// LoadConfig loads and validates the configuration from the given path, a file or a directory of them.
+func LoadConfig(configPath string) (*ConfigFile, error) {
+	return apiinternal.LoadConfig(configPath)
+}
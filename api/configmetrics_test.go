@@ -0,0 +1,84 @@
+//go:build !noprometheus
+
+package api_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"learn.ratelimiter/api"
+)
+
+// gaugeValue returns the value of the gauge with the given name and labels in the default registry, and whether
+// it exists.
+func gaugeValue(t *testing.T, name string, labels map[string]string) (float64, bool) {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			if len(metric.GetLabel()) != len(labels) {
+				continue
+			}
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+			return metric.GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+// TestLimiterConfigMetrics tests that the configured algorithm, backend and limits of each limiter are exported
+// as gauges and replaced when a reload changes them.
+func TestLimiterConfigMetrics(t *testing.T) {
+	path := writeConfig(t, reloadFixedWindow)
+	limiters, configs, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+
+	fixedWindowInfo := map[string]string{"limiter_key": "api", "algorithm": "fixed_window_counter", "backend": "in_memory"}
+	if value, ok := gaugeValue(t, "rate_limiter_limiter_config_info", fixedWindowInfo); !ok || value != 1 {
+		t.Errorf("Expected config info gauge of 1, got %v (found: %v)", value, ok)
+	}
+	for parameter, want := range map[string]float64{"limit": 5, "window_seconds": 60} {
+		labels := map[string]string{"limiter_key": "api", "parameter": parameter}
+		if value, ok := gaugeValue(t, "rate_limiter_configured_limit", labels); !ok || value != want {
+			t.Errorf("Expected configured %s of %v, got %v (found: %v)", parameter, want, value, ok)
+		}
+	}
+
+	reloader := api.NewReloader(path, limiters, configs)
+	defer reloader.Close()
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(reloadSlidingWindow, "fresh")), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if _, ok := gaugeValue(t, "rate_limiter_limiter_config_info", fixedWindowInfo); ok {
+		t.Error("Expected the config info gauge of the replaced algorithm to be removed")
+	}
+	slidingWindowInfo := map[string]string{"limiter_key": "api", "algorithm": "sliding_window_counter", "backend": "in_memory"}
+	if value, ok := gaugeValue(t, "rate_limiter_limiter_config_info", slidingWindowInfo); !ok || value != 1 {
+		t.Errorf("Expected config info gauge of 1 after reload, got %v (found: %v)", value, ok)
+	}
+	limit := map[string]string{"limiter_key": "api", "parameter": "limit"}
+	if value, _ := gaugeValue(t, "rate_limiter_configured_limit", limit); value != 10 {
+		t.Errorf("Expected configured limit of 10 after reload, got %v", value)
+	}
+}
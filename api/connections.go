@@ -0,0 +1,37 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/middleware"
+	"learn.ratelimiter/types"
+)
+
+// NewConnLimiterFromConfig returns the connection limiter cfgFile describes, checking new connections against the
+// configured limiter in limiters (as returned by NewLimitersFromConfig), or nil if connection limits are not
+// configured. Install it on the server with Install.
+func NewConnLimiterFromConfig(cfgFile *ConfigFile, limiters map[string]types.Limiter) (*middleware.ConnLimiter, error) {
+	connCfg := cfgFile.Connections
+	if connCfg == nil {
+		return nil, nil
+	}
+	limiter, ok := limiters[connCfg.Limiter]
+	if !ok {
+		return nil, fmt.Errorf("connections.limiter '%s' not found", connCfg.Limiter)
+	}
+	log.Info().Str("limiter_key", connCfg.Limiter).Int("max_per_ip", connCfg.MaxPerIP).Msg("API: Limiting connections per source IP")
+	return middleware.NewConnLimiter(limiter, connCfg.Limiter, middleware.WithMaxConnsPerIP(connCfg.MaxPerIP)), nil
+}
+
+// NewConnLimiterFromConfigPath loads configuration from the given path and calls NewConnLimiterFromConfig with it.
+func NewConnLimiterFromConfigPath(configPath string, limiters map[string]types.Limiter) (*middleware.ConnLimiter, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Connection limiter initialization failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewConnLimiterFromConfig(cfgFile, limiters)
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/decisions"
+)
+
+// NewDecisionSinkFromConfig returns the decision sink cfgFile describes, already running, or nil if no decision sink is
+// configured. The caller must Close the sink to flush buffered decisions.
+func NewDecisionSinkFromConfig(cfgFile *ConfigFile) (*decisions.Sink, error) {
+	sinkCfg := cfgFile.DecisionSink
+	if sinkCfg == nil {
+		return nil, nil
+	}
+
+	var writer decisions.Writer
+	switch sinkCfg.Sink {
+	case config.DecisionSinkFile:
+		log.Info().Str("path", sinkCfg.Path).Msg("API: Creating file decision sink")
+		fileWriter, err := decisions.NewFileWriter(sinkCfg.Path)
+		if err != nil {
+			return nil, fmt.Errorf("decision sink: %w", err)
+		}
+		writer = fileWriter
+	case config.DecisionSinkRedis:
+		log.Info().Str("address", sinkCfg.RedisParams.Address).Str("stream", sinkCfg.Stream).Msg("API: Creating Redis decision sink")
+		client, err := apiinternal.InitRedisClient(&config.LimiterConfig{RedisParams: sinkCfg.RedisParams})
+		if err != nil {
+			return nil, fmt.Errorf("decision sink: %w", err)
+		}
+		writer = decisions.NewRedisStreamWriter(client, sinkCfg.Stream, sinkCfg.MaxEntries)
+	case config.DecisionSinkStdout:
+		log.Info().Msg("API: Creating standard output decision sink")
+		writer = decisions.NewStreamWriter(os.Stdout, "stdout")
+	}
+
+	return decisions.NewSink(writer,
+		decisions.WithSampleRate(sinkCfg.SampleRate),
+		decisions.WithBatchSize(sinkCfg.BatchSize),
+		decisions.WithFlushInterval(sinkCfg.FlushInterval),
+		decisions.WithBuffer(sinkCfg.BufferSize, decisions.OverflowPolicy(sinkCfg.Overflow)),
+	), nil
+}
+
+// NewDecisionSinkFromConfigPath loads configuration from the given path and calls NewDecisionSinkFromConfig with it.
+func NewDecisionSinkFromConfigPath(configPath string) (*decisions.Sink, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Decision sink initialization failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewDecisionSinkFromConfig(cfgFile)
+}
@@ -0,0 +1,99 @@
+package api_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/config"
+)
+
+// TestConfigDefaults tests that limiters inherit the parameters they leave unset from the defaults section, merged
+// field by field, and only the algorithm parameters their algorithm uses.
+func TestConfigDefaults(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"config.yaml": `
+defaults:
+  algorithm: "sliding_window_counter"
+  backend: "in_memory"
+  max_wait: 2s
+  window_params:
+    window: 1m
+    limit: 100
+limiters:
+  - key: "inherited"
+  - key: "overridden"
+    window_params:
+      limit: 10
+  - key: "shorthand"
+    requests_per_second: 5
+  - key: "other_algorithm"
+    algorithm: "fixed_window_counter"
+    window_params:
+      limit: 5
+`})
+
+	_, configs, closer, err := api.NewLimitersFromConfigPath(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+
+	for key, want := range map[string]config.LimiterConfig{
+		"inherited":       {Algorithm: config.SlidingWindowCounter, WindowParams: &config.WindowConfig{Window: time.Minute, Limit: 100}},
+		"overridden":      {Algorithm: config.SlidingWindowCounter, WindowParams: &config.WindowConfig{Window: time.Minute, Limit: 10}},
+		"shorthand":       {Algorithm: config.TokenBucket},
+		"other_algorithm": {Algorithm: config.FixedWindowCounter, WindowParams: &config.WindowConfig{Window: time.Minute, Limit: 5}},
+	} {
+		got := configs[key]
+		if got.Algorithm != want.Algorithm || got.Backend != config.InMemory || got.MaxWait != 2*time.Second {
+			t.Errorf("%s: Expected a %s in-memory limiter waiting 2s, got %s %s waiting %s", key, want.Algorithm, got.Algorithm, got.Backend, got.MaxWait)
+		}
+		if (want.WindowParams == nil) != (got.WindowParams == nil) || want.WindowParams != nil && *got.WindowParams != *want.WindowParams {
+			t.Errorf("%s: Expected window_params %+v, got %+v", key, want.WindowParams, got.WindowParams)
+		}
+	}
+	if configs["inherited"].WindowParams == configs["overridden"].WindowParams {
+		t.Error("Expected limiters not to share their inherited parameters")
+	}
+}
+
+// TestConfigDefaultsValidated tests that limiters are validated once merged with the defaults.
+func TestConfigDefaultsValidated(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{
+			name:   "key",
+			config: "defaults:\n  key: \"all\"\n" + limiterYAML("a"),
+			want:   "defaults must not set a limiter key",
+		},
+		{
+			name: "merged limiter",
+			config: `
+defaults:
+  backend: "redis"
+limiters:
+  - key: "a"
+    algorithm: "token_bucket"
+    token_bucket_params:
+      rate: 1
+      capacity: 1
+`,
+			want: "redis_params are required",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"config.yaml": tc.config})
+			_, _, _, err := api.NewLimitersFromConfigPath(filepath.Join(dir, "config.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/denialreport"
+)
+
+// NewDenialReporterFromConfig returns the daily denial reporter cfgFile describes, already running, or nil if denial
+// reports are not configured. The caller must Close it.
+func NewDenialReporterFromConfig(cfgFile *ConfigFile) (*denialreport.Reporter, error) {
+	reportCfg := cfgFile.DenialReport
+	if reportCfg == nil {
+		return nil, nil
+	}
+	var handlers []denialreport.Handler
+	if reportCfg.ExportPath != "" {
+		handlers = append(handlers, denialreport.File(reportCfg.ExportPath))
+	}
+	return denialreport.New(*reportCfg, handlers...), nil
+}
+
+// NewDenialReporterFromConfigPath loads configuration from the given path and calls NewDenialReporterFromConfig with it.
+func NewDenialReporterFromConfigPath(configPath string) (*denialreport.Reporter, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Denial report initialization failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewDenialReporterFromConfig(cfgFile)
+}
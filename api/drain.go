@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/metrics"
+)
+
+// releasedLimiter allows every request. It stands in for a limiter removed from the configuration, so middleware
+// still bound to the limiter's key keeps serving requests without errors.
+type releasedLimiter struct{}
+
+// Allow allows the request.
+func (releasedLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return true, nil
+}
+
+// AllowN allows the request.
+func (releasedLimiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	return true, nil
+}
+
+// AllowAt allows the request.
+func (releasedLimiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	return true, nil
+}
+
+// drain is a limiter removed from the configuration and not released yet.
+type drain struct {
+	timer *time.Timer
+	// allowing reports whether the limiter was replaced by one allowing every request (config.DrainAllow).
+	allowing bool
+}
+
+// startDrain drains the limiter with the given key, removed from the configuration, as set by drainingCfg, and
+// releases it once its grace period is over. The caller holds r.mu.
+func (r *Reloader) startDrain(key string, drainingCfg config.DrainingConfig) {
+	limiter := r.limiters[key]
+	d := &drain{allowing: drainingCfg.Mode == config.DrainAllow}
+	if d.allowing {
+		limiter.Swap(releasedLimiter{}, nil, limiter.Algorithm(), config.StateTransitionFresh)
+	}
+	r.draining[key] = d
+	if drainingCfg.GracePeriod == 0 {
+		r.release(key)
+		return
+	}
+	log.Info().Str("limiter_key", key).Dur("grace_period", drainingCfg.GracePeriod).Bool("allowing", d.allowing).Msg("API: Draining limiter removed from configuration")
+	d.timer = time.AfterFunc(drainingCfg.GracePeriod, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		// The limiter may have been restored by a reload, or drained again, since the timer fired
+		if r.draining[key] == d {
+			r.release(key)
+		}
+	})
+}
+
+// stopDrain stops draining the limiter with the given key, if it is draining, as a reload configures it again.
+// The caller holds r.mu.
+func (r *Reloader) stopDrain(key string) {
+	if d, ok := r.draining[key]; ok {
+		d.timer.Stop()
+		delete(r.draining, key)
+		log.Info().Str("limiter_key", key).Msg("API: Draining limiter restored by configuration")
+	}
+}
+
+// release replaces the limiter with the given key by one allowing every request, and frees what the reloader holds
+// for it. Middleware bound to the key keeps working; a reload configuring the key again restores it.
+// The caller holds r.mu.
+func (r *Reloader) release(key string) {
+	limiter := r.limiters[key]
+	if !r.draining[key].allowing {
+		limiter.Swap(releasedLimiter{}, nil, limiter.Algorithm(), config.StateTransitionFresh)
+	}
+	delete(r.draining, key)
+	if lease, ok := r.leases[key]; ok {
+		if err := lease.Close(); err != nil {
+			log.Error().Err(err).Str("limiter_key", key).Msg("API: Error returning leased tokens")
+		}
+		delete(r.leases, key)
+	}
+	delete(r.configs, key)
+	metrics.DeleteLimiterConfig(key)
+	log.Info().Str("limiter_key", key).Msg("API: Released limiter removed from configuration, requests are allowed")
+}
@@ -0,0 +1,139 @@
+package api_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/api"
+)
+
+// drainLimiters configures the "api" limiter and, unless removed, the "extra" limiter.
+const drainLimiters = `
+%s
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 5
+%s
+`
+
+const drainExtraLimiter = `
+  - key: "extra"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 2
+`
+
+// rewriteConfig replaces the configuration file at path.
+func rewriteConfig(t *testing.T, path, yaml string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+}
+
+// TestReloadDrainsRemovedLimiter tests that a limiter removed by a reload keeps enforcing or allows every request,
+// depending on the drain mode, until its grace period is over, and then allows every request.
+func TestReloadDrainsRemovedLimiter(t *testing.T) {
+	tests := []struct {
+		mode string
+		// drainingAllowed is how many of 3 requests the limiter allows while draining, after 2 were allowed.
+		drainingAllowed int
+	}{
+		{mode: "enforce", drainingAllowed: 0},
+		{mode: "allow", drainingAllowed: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			draining := fmt.Sprintf("draining:\n  grace_period: 100ms\n  mode: %s", tt.mode)
+			path := writeConfig(t, fmt.Sprintf(drainLimiters, draining, drainExtraLimiter))
+			limiters, configs, closer, err := api.NewLimitersFromConfigPath(path)
+			if err != nil {
+				t.Fatalf("Failed to create limiters: %v", err)
+			}
+			defer closer.Close()
+			reloader := api.NewReloader(path, limiters, configs)
+			defer reloader.Close()
+
+			extra := limiters["extra"]
+			if allowed := countAllowed(extra, "client1", 2); allowed != 2 {
+				t.Fatalf("Expected 2 requests allowed before reload, got %d", allowed)
+			}
+
+			rewriteConfig(t, path, fmt.Sprintf(drainLimiters, draining, ""))
+			if _, err := reloader.Reload(); err != nil {
+				t.Fatalf("Reload failed: %v", err)
+			}
+			if allowed := countAllowed(extra, "client1", 3); allowed != tt.drainingAllowed {
+				t.Errorf("Expected %d requests allowed while draining, got %d", tt.drainingAllowed, allowed)
+			}
+			if _, ok := reloader.Configs()["extra"]; !ok {
+				t.Error("Expected the draining limiter's configuration to be kept")
+			}
+
+			time.Sleep(200 * time.Millisecond)
+			if allowed := countAllowed(extra, "client1", 3); allowed != 3 {
+				t.Errorf("Expected all requests allowed once released, got %d", allowed)
+			}
+			if _, ok := reloader.Configs()["extra"]; ok {
+				t.Error("Expected the released limiter's configuration to be dropped")
+			}
+		})
+	}
+}
+
+// TestReloadRestoresDrainingLimiter tests that a reload configuring a removed limiter again restores it, whether
+// it is still draining or was released.
+func TestReloadRestoresDrainingLimiter(t *testing.T) {
+	draining := "draining:\n  grace_period: 1h"
+	path := writeConfig(t, fmt.Sprintf(drainLimiters, draining, drainExtraLimiter))
+	limiters, configs, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+	reloader := api.NewReloader(path, limiters, configs)
+	defer reloader.Close()
+	extra := limiters["extra"]
+
+	// Draining in enforce mode and configured again unchanged, the limiter keeps its state
+	countAllowed(extra, "client1", 2)
+	rewriteConfig(t, path, fmt.Sprintf(drainLimiters, draining, ""))
+	if _, err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	rewriteConfig(t, path, fmt.Sprintf(drainLimiters, draining, drainExtraLimiter))
+	if _, err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if allowed := countAllowed(extra, "client1", 1); allowed != 0 {
+		t.Error("Expected the restored limiter to keep enforcing its state")
+	}
+
+	// Released, the limiter is created again
+	rewriteConfig(t, path, fmt.Sprintf(drainLimiters, "draining:\n  grace_period: 0s", ""))
+	if _, err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if allowed := countAllowed(extra, "client1", 5); allowed != 5 {
+		t.Errorf("Expected all requests allowed once released, got %d", allowed)
+	}
+	rewriteConfig(t, path, fmt.Sprintf(drainLimiters, draining, drainExtraLimiter))
+	reloaded, err := reloader.Reload()
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if len(reloaded) != 1 || reloaded[0] != "extra" {
+		t.Errorf("Expected the released limiter to be reloaded, got %v", reloaded)
+	}
+	if allowed := countAllowed(extra, "client1", 3); allowed != 2 {
+		t.Errorf("Expected the restored limiter to allow its limit of 2, got %d", allowed)
+	}
+}
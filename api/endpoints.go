@@ -0,0 +1,47 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/types"
+)
+
+// NewEndpointLimitersFromConfig creates the built-in limiters for the operational endpoints (/metrics, /admin/*,
+// /healthz), applying any endpoint_limits overrides. It returns maps of limiters and their configurations keyed by
+// endpoint name (e.g., config.EndpointMetrics); both are empty if the endpoint limits are disabled. The limiters are
+// in-memory and need no closing.
+func NewEndpointLimitersFromConfig(cfgFile *ConfigFile) (map[string]types.Limiter, map[string]config.LimiterConfig, error) {
+	limiters := make(map[string]types.Limiter)
+	limiterConfigs := cfgFile.EndpointLimits.LimiterConfigs()
+	for endpoint, cfg := range limiterConfigs {
+		limiterFactory, err := NewLimiterFactory(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("endpoint '%s': failed to get factory: %w", endpoint, err)
+		}
+		limiter, err := limiterFactory.CreateLimiter(cfg, types.BackendClients{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("endpoint '%s': failed to create instance: %w", endpoint, err)
+		}
+		limiters[endpoint] = limiter
+		log.Info().Str("endpoint", endpoint).Int("rate", cfg.TokenBucketParams.Rate).Int("capacity", cfg.TokenBucketParams.Capacity).Msg("API: Endpoint limiter created")
+	}
+	if limiterConfigs == nil {
+		limiterConfigs = make(map[string]config.LimiterConfig)
+		log.Warn().Msg("API: Endpoint limits disabled, operational endpoints are not rate limited")
+	}
+	return limiters, limiterConfigs, nil
+}
+
+// NewEndpointLimitersFromConfigPath loads configuration from the given path and calls NewEndpointLimitersFromConfig with it.
+func NewEndpointLimitersFromConfigPath(configPath string) (map[string]types.Limiter, map[string]config.LimiterConfig, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Endpoint limiter initialization failed: Error loading configuration")
+		return nil, nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewEndpointLimitersFromConfig(cfgFile)
+}
@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/config"
+)
+
+// writeConfig writes the YAML configuration to a temporary file and returns its path.
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+const endpointTestLimiters = `
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 10
+`
+
+// TestEndpointLimiters tests that the operational endpoints get default limits that config can override or disable.
+func TestEndpointLimiters(t *testing.T) {
+	path := writeConfig(t, endpointTestLimiters+`
+endpoint_limits:
+  metrics:
+    rate: 1
+    capacity: 2
+`)
+	limiters, configs, err := api.NewEndpointLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create endpoint limiters: %v", err)
+	}
+	for _, endpoint := range []string{config.EndpointMetrics, config.EndpointAdmin, config.EndpointHealthz} {
+		if _, ok := limiters[endpoint]; !ok {
+			t.Errorf("Expected a limiter for endpoint %q", endpoint)
+		}
+	}
+	if got := configs[config.EndpointAdmin].TokenBucketParams.Capacity; got != config.DefaultEndpointLimits[config.EndpointAdmin].Capacity {
+		t.Errorf("Expected default admin capacity, got %d", got)
+	}
+
+	// The overridden metrics capacity of 2 allows two scrapes in a burst
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiters[config.EndpointMetrics].Allow(ctx, "scraper"); !allowed {
+			t.Fatalf("Expected scrape %d to be allowed", i+1)
+		}
+	}
+	if allowed, _ := limiters[config.EndpointMetrics].Allow(ctx, "scraper"); allowed {
+		t.Error("Expected third scrape to be limited")
+	}
+
+	disabled := writeConfig(t, endpointTestLimiters+`
+endpoint_limits:
+  disabled: true
+`)
+	limiters, _, err = api.NewEndpointLimitersFromConfigPath(disabled)
+	if err != nil {
+		t.Fatalf("Failed to load config with disabled endpoint limits: %v", err)
+	}
+	if len(limiters) != 0 {
+		t.Errorf("Expected no endpoint limiters when disabled, got %d", len(limiters))
+	}
+
+	invalid := writeConfig(t, endpointTestLimiters+`
+endpoint_limits:
+  healthz:
+    rate: 0
+    capacity: 5
+`)
+	if _, _, err := api.NewEndpointLimitersFromConfigPath(invalid); err == nil {
+		t.Error("Expected an error for a zero healthz rate")
+	}
+}
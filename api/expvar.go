@@ -0,0 +1,78 @@
+package api
+
+import (
+	"expvar"
+	"fmt"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/types"
+)
+
+// ExpvarName is the name of the expvar variable published by PublishExpvar.
+const ExpvarName = "ratelimiter"
+
+// expvarLimiter is the state of one limiter published under ExpvarName.
+// Backend settings (e.g., Redis addresses and passwords) are left out.
+type expvarLimiter struct {
+	Algorithm config.AlgorithmType `json:"algorithm"`
+	Backend   config.BackendType   `json:"backend"`
+	Window    string               `json:"window,omitempty"`
+	Limit     int64                `json:"limit,omitempty"`
+	Rate      int                  `json:"rate,omitempty"`
+	Capacity  int                  `json:"capacity,omitempty"`
+
+	Allowed int64 `json:"allowed"`
+	Denied  int64 `json:"denied"`
+	Errors  int64 `json:"errors"`
+	// Keys is the number of identifiers with state, for limiters keeping it in process.
+	Keys *int `json:"keys,omitempty"`
+}
+
+// PublishExpvar publishes the configuration and live counters of the limiters returned by NewLimitersFromConfigPath
+// as the expvar variable ExpvarName, so Go debug tooling reading /debug/vars can inspect them without Prometheus.
+// configs is called on every read to get the current configuration (e.g., Reloader.Configs).
+// Allowed, denied and error counts are those recorded by middleware for each limiter key.
+// It returns an error if the variable is already published, since expvar variables cannot be replaced.
+func PublishExpvar(limiters map[string]types.Limiter, configs func() map[string]config.LimiterConfig) error {
+	if expvar.Get(ExpvarName) != nil {
+		return fmt.Errorf("expvar '%s' is already published", ExpvarName)
+	}
+	expvar.Publish(ExpvarName, expvar.Func(func() any {
+		return expvarLimiters(limiters, configs())
+	}))
+	return nil
+}
+
+// expvarLimiters returns the published state of every configured limiter, by limiter key.
+func expvarLimiters(limiters map[string]types.Limiter, configs map[string]config.LimiterConfig) map[string]expvarLimiter {
+	state := make(map[string]expvarLimiter, len(configs))
+	for key, cfg := range configs {
+		counts := metrics.Counts(key)
+		v := expvarLimiter{
+			Algorithm: cfg.Algorithm,
+			Backend:   cfg.Backend,
+			Allowed:   counts.Allowed,
+			Denied:    counts.Denied,
+			Errors:    counts.Errors,
+		}
+		switch {
+		case cfg.WindowParams != nil:
+			v.Window = cfg.WindowParams.Window.String()
+			v.Limit = cfg.WindowParams.Limit
+		case cfg.TokenBucketParams != nil:
+			v.Rate = cfg.TokenBucketParams.Rate
+			v.Capacity = cfg.TokenBucketParams.Capacity
+		case cfg.LeakyBucketParams != nil:
+			v.Rate = cfg.LeakyBucketParams.Rate
+			v.Capacity = cfg.LeakyBucketParams.Capacity
+		}
+		if keyCounter, ok := limiters[key].(types.KeyCounter); ok {
+			if keys, ok := keyCounter.KeyCount(); ok {
+				v.Keys = &keys
+			}
+		}
+		state[key] = v
+	}
+	return state
+}
@@ -0,0 +1,72 @@
+package api_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/metrics"
+)
+
+const expvarConfig = `
+limiters:
+  - key: "expvar_api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 5
+`
+
+// TestPublishExpvar tests that the limiter configuration, counters and key count are published under api.ExpvarName.
+func TestPublishExpvar(t *testing.T) {
+	path := writeConfig(t, expvarConfig)
+	limiters, configs, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+	reloader := api.NewReloader(path, limiters, configs)
+	defer reloader.Close()
+
+	if err := api.PublishExpvar(limiters, reloader.Configs); err != nil {
+		t.Fatalf("PublishExpvar returned error: %v", err)
+	}
+	if err := api.PublishExpvar(limiters, reloader.Configs); err == nil {
+		t.Error("Expected publishing twice to fail")
+	}
+
+	countAllowed(limiters["expvar_api"], "client1", 1)
+	countAllowed(limiters["expvar_api"], "client2", 1)
+	m := metrics.NewRateLimitMetrics()
+	m.RecordRequestWithLabels(true, "expvar_api", "fixed_window_counter")
+	m.RecordRequestWithLabels(false, "expvar_api", "fixed_window_counter")
+	metrics.RecordLimiterError("expvar_api")
+
+	var published map[string]struct {
+		Algorithm string `json:"algorithm"`
+		Window    string `json:"window"`
+		Limit     int64  `json:"limit"`
+		Allowed   int64  `json:"allowed"`
+		Denied    int64  `json:"denied"`
+		Errors    int64  `json:"errors"`
+		Keys      *int   `json:"keys"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get(api.ExpvarName).String()), &published); err != nil {
+		t.Fatalf("Failed to decode published variable: %v", err)
+	}
+	got, ok := published["expvar_api"]
+	if !ok {
+		t.Fatalf("Expected limiter 'expvar_api' to be published, got %v", published)
+	}
+	if got.Algorithm != "fixed_window_counter" || got.Window != "1m0s" || got.Limit != 5 {
+		t.Errorf("Unexpected published configuration: %+v", got)
+	}
+	if got.Allowed != 1 || got.Denied != 1 || got.Errors != 1 {
+		t.Errorf("Expected 1 allowed, 1 denied and 1 error, got %+v", got)
+	}
+	if got.Keys == nil || *got.Keys != 2 {
+		t.Errorf("Expected 2 keys with state, got %v", got.Keys)
+	}
+}
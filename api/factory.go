@@ -19,8 +19,12 @@ func NewLimiterFactory(cfg config.LimiterConfig) (LimiterFactory, error) {
 		return factory.NewFixedWindowFactory()
 	case config.SlidingWindowCounter:
 		return factory.NewSlidingWindowCounterFactory()
+	case config.SlidingWindowLog:
+		return factory.NewSlidingWindowLogFactory()
 	case config.TokenBucket:
 		return factory.NewTokenBucketFactory()
+	case config.LeakyBucket:
+		return factory.NewLeakyBucketFactory()
 	default:
 		err := fmt.Errorf("unsupported algorithm type '%s' for key '%s'", cfg.Algorithm, cfg.Key)
 		log.Printf("Factory: Failed to get factory for limiter key '%s': %v", cfg.Key, err)
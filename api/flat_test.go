@@ -0,0 +1,99 @@
+package api_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/config"
+)
+
+// TestFlatLimiters tests that limiters in the flattened JSON form are expanded into the nested configuration.
+func TestFlatLimiters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+  "flat_limiters": [
+    {"key": "api", "algorithm": "fixed_window_counter", "backend": "in_memory", "window_seconds": 60, "limit": 2, "max_wait_seconds": 1.5},
+    {"key": "upload", "algorithm": "token_bucket", "backend": "in_memory", "rate": 1, "capacity": 3, "window_seconds": 60}
+  ]
+}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	limiters, configs, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+
+	apiCfg := configs["api"]
+	if apiCfg.WindowParams == nil || apiCfg.WindowParams.Window != time.Minute || apiCfg.WindowParams.Limit != 2 {
+		t.Errorf("Expected a 1m window with limit 2, got %+v", apiCfg.WindowParams)
+	}
+	if apiCfg.MaxWait != 1500*time.Millisecond {
+		t.Errorf("Expected max_wait 1.5s, got %v", apiCfg.MaxWait)
+	}
+	uploadCfg := configs["upload"]
+	if uploadCfg.WindowParams != nil {
+		t.Errorf("Expected window parameters of a token bucket to be ignored, got %+v", uploadCfg.WindowParams)
+	}
+	if uploadCfg.TokenBucketParams == nil || uploadCfg.TokenBucketParams.Capacity != 3 {
+		t.Errorf("Expected a token bucket with capacity 3, got %+v", uploadCfg.TokenBucketParams)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiters["api"].Allow(ctx, "client1"); !allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+	if allowed, _ := limiters["api"].Allow(ctx, "client1"); allowed {
+		t.Error("Expected the third request to be denied")
+	}
+}
+
+// TestFlatLimitersRedis tests that prefixed backend fields fill the backend parameters.
+func TestFlatLimitersRedis(t *testing.T) {
+	cfg := config.FlatLimiterConfig{
+		Key:                     "api",
+		Algorithm:               config.LeakyBucket,
+		Backend:                 config.Redis,
+		Rate:                    5,
+		Capacity:                10,
+		RedisAddress:            "redis:6379",
+		RedisDB:                 2,
+		RedisReadTimeoutSeconds: 0.25,
+	}.LimiterConfig()
+	if cfg.RedisParams == nil || cfg.RedisParams.Address != "redis:6379" || cfg.RedisParams.DB != 2 {
+		t.Fatalf("Expected Redis parameters, got %+v", cfg.RedisParams)
+	}
+	if cfg.RedisParams.ReadTimeout != 250*time.Millisecond {
+		t.Errorf("Expected a 250ms read timeout, got %v", cfg.RedisParams.ReadTimeout)
+	}
+	if cfg.LeakyBucketParams == nil || cfg.LeakyBucketParams.Rate != 5 {
+		t.Errorf("Expected leaky bucket parameters, got %+v", cfg.LeakyBucketParams)
+	}
+	if cfg.MemcacheParams != nil {
+		t.Errorf("Expected no Memcache parameters, got %+v", cfg.MemcacheParams)
+	}
+}
+
+// TestFlatLimitersDuplicateKey tests that a key defined in both forms is rejected.
+func TestFlatLimitersDuplicateKey(t *testing.T) {
+	path := writeConfig(t, endpointTestLimiters+`
+flat_limiters:
+  - key: "api"
+    algorithm: "token_bucket"
+    backend: "in_memory"
+    rate: 1
+    capacity: 1
+`)
+	_, _, _, err := api.NewLimitersFromConfigPath(path)
+	if err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Fatalf("Expected a duplicate key error, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package api_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"learn.ratelimiter/api"
+)
+
+// writeFiles writes the files, by path relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+}
+
+// limiterYAML returns a limiters section defining an in-memory token bucket limiter with the key.
+func limiterYAML(key string) string {
+	return `
+limiters:
+  - key: "` + key + `"
+    algorithm: "token_bucket"
+    backend: "in_memory"
+    token_bucket_params:
+      rate: 1
+      capacity: 1
+`
+}
+
+// TestConfigDirectory tests that every *.yaml file of a config directory is merged, with the files they include.
+func TestConfigDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"payments.yaml":         limiterYAML("payments") + "include: [\"teams/*.yaml\"]\n",
+		"search.yaml":           limiterYAML("search") + "startup_policy: lazy\n",
+		"notes.txt":             "not a config file",
+		"teams/checkout.yaml":   limiterYAML("checkout"),
+		"teams/inventory.yaml":  limiterYAML("inventory") + "include: [\"checkout.yaml\"]\n",
+		"teams/disabled.yaml.x": limiterYAML("disabled"),
+	})
+
+	_, configs, closer, err := api.NewLimitersFromConfigPath(dir)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+	for _, key := range []string{"payments", "search", "checkout", "inventory"} {
+		if _, ok := configs[key]; !ok {
+			t.Errorf("Expected limiter '%s' to be loaded", key)
+		}
+	}
+	if len(configs) != 4 {
+		t.Errorf("Expected 4 limiters, got %d", len(configs))
+	}
+}
+
+// TestConfigDuplicates tests that limiters and sections defined by two files are rejected, naming both files.
+func TestConfigDuplicates(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+		want  string
+		// both reports whether the error names both files
+		both bool
+	}{
+		{
+			name:  "limiter",
+			files: map[string]string{"a.yaml": limiterYAML("api"), "b.yaml": limiterYAML("api")},
+			want:  "limiter 'api' is defined in both",
+			both:  true,
+		},
+		{
+			name: "section",
+			files: map[string]string{
+				"a.yaml": limiterYAML("a") + "startup_policy: lazy\n",
+				"b.yaml": limiterYAML("b") + "startup_policy: degraded\n",
+			},
+			want: "section 'startup_policy' is defined in both",
+			both: true,
+		},
+		{
+			name:  "missing include",
+			files: map[string]string{"a.yaml": limiterYAML("a") + "include: [\"missing.yaml\"]\n"},
+			want:  "matches no file",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tc.files)
+			_, _, _, err := api.NewLimitersFromConfigPath(dir)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Expected an error containing %q, got %v", tc.want, err)
+			}
+			if tc.both && !strings.Contains(err.Error(), filepath.Join(dir, "a.yaml")) {
+				t.Errorf("Expected the error to name both files, got %v", err)
+			}
+		})
+	}
+}
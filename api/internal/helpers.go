@@ -4,14 +4,22 @@ package internal
 import (
 	"context"
 	"fmt"
-	"os"
+	"math"
+	"net"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log" // Import zerolog's global logger
-	"gopkg.in/yaml.v2"
 
 	"learn.ratelimiter/config"
+	"learn.ratelimiter/dialer"
+	"learn.ratelimiter/internal/codec"
+	"learn.ratelimiter/internal/redisscripts"
 )
 
 // ConfigFile represents the top-level structure of the configuration file.
@@ -19,35 +27,152 @@ import (
 type ConfigFile struct {
 	// Limiters is a list of individual rate limiter configurations.
 	Limiters []config.LimiterConfig `yaml:"limiters"`
+	// FlatLimiters are limiter configurations in the flattened form generated by infrastructure-as-code tools.
+	// They are expanded and appended to Limiters when the file is loaded.
+	FlatLimiters []config.FlatLimiterConfig `yaml:"flat_limiters,omitempty"`
+	// Defaults holds parameters inherited by every limiter that leaves them unset (see config.LimiterConfig.WithDefaults).
+	Defaults *config.LimiterConfig `yaml:"defaults,omitempty"`
+	// StartupPolicy is how startup handles limiters whose backend is unreachable: "strict" (default), "lazy" or "degraded".
+	StartupPolicy config.StartupPolicy `yaml:"startup_policy,omitempty"`
+	// Backends defines named backend connections referenced by limiters, keyed by name.
+	Backends map[string]config.BackendConnectionConfig `yaml:"backends,omitempty"`
+	// Admin holds configuration for the admin API.
+	Admin *config.AdminConfig `yaml:"admin,omitempty"`
+	// EndpointLimits overrides the built-in limits for the operational endpoints.
+	EndpointLimits *config.EndpointLimitsConfig `yaml:"endpoint_limits,omitempty"`
+	// DecisionSink optionally replicates decisions to a secondary store for analytics.
+	DecisionSink *config.DecisionSinkConfig `yaml:"decision_sink,omitempty"`
+	// Mirror optionally copies a sample of denied requests to a sink for offline analysis.
+	Mirror *config.MirrorConfig `yaml:"mirror,omitempty"`
+	// Overrides configures where per-identifier limit overrides are stored.
+	Overrides *config.OverridesConfig `yaml:"overrides,omitempty"`
+	// Bans optionally shares the bans managed through the admin API between instances.
+	Bans *config.BansConfig `yaml:"bans,omitempty"`
+	// APIKeys maps API keys to plans enforced by the limiters.
+	APIKeys *config.APIKeysConfig `yaml:"api_keys,omitempty"`
+	// Logging configures how identifiers appear in logs.
+	Logging config.LoggingConfig `yaml:"logging,omitempty"`
+	// Connections optionally limits new connections per source IP.
+	Connections *config.ConnectionsConfig `yaml:"connections,omitempty"`
+	// Autoscaling optionally publishes autoscaling hints summarizing each limiter's utilization and denial rate.
+	Autoscaling *config.AutoscalingConfig `yaml:"autoscaling,omitempty"`
+	// AnomalyDetection optionally reports abnormal spikes in each limiter's deny rate.
+	AnomalyDetection *config.AnomalyDetectionConfig `yaml:"anomaly_detection,omitempty"`
+	// DenialReport optionally reports, per limiter and day, the fraction of requests denied and the identifiers denied most.
+	DenialReport *config.DenialReportConfig `yaml:"denial_report,omitempty"`
+	// Peers optionally shares in-memory limiters between instances by forwarding checks to an owner instance.
+	Peers *config.PeersConfig `yaml:"peers,omitempty"`
+	// ReadOnly optionally puts limiters in read-only mode on startup.
+	ReadOnly *config.ReadOnlyConfig `yaml:"read_only,omitempty"`
+	// Draining optionally configures how limiters removed by a reload are drained and released. Without it, they keep
+	// running until restart.
+	Draining *config.DrainingConfig `yaml:"draining,omitempty"`
+	// BudgetGroups declares limiter keys sharing the budget of another limiter.
+	BudgetGroups []config.BudgetGroupConfig `yaml:"budget_groups,omitempty"`
+	// Include lists further configuration files merged into this one, as paths or glob patterns relative to the
+	// directory of this file. An included directory contributes every *.yaml file in it.
+	Include []string `yaml:"include,omitempty"`
 }
 
-// LoadConfig reads and unmarshals the YAML configuration file from the given path.
+// LoadConfig reads and unmarshals the YAML configuration file from the given path. Since JSON is valid YAML, the file
+// may also be JSON (e.g., generated by Terraform), in which case flat_limiters avoids nested duration strings.
+// The path may also be a directory, whose *.yaml files are merged in lexical order, and files may include others
+// (see ConfigFile.Include), so each team can own the file of its limiters.
 // It returns a ConfigFile struct or an error if loading or unmarshalling fails.
 func LoadConfig(path string) (*ConfigFile, error) {
 	log.Info().Str("config_path", path).Msg("Helpers: Attempting to load configuration")
-	data, err := os.ReadFile(path)
+	cfg, err := readConfig(path)
 	if err != nil {
 		// Improved error log with structured fields
 		log.Error().Err(err).Str("config_path", path).Msg("Helpers: Failed to read config file")
-		return nil, fmt.Errorf("read config file %s: %w", path, err)
+		return nil, err
 	}
-	var cfg ConfigFile // Unmarshal into the new struct
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		// Improved error log with structured fields
-		log.Error().Err(err).Str("config_path", path).Msg("Helpers: Failed to unmarshal config file")
-		return nil, fmt.Errorf("unmarshal config file %s: %w", path, err)
+	if err := applyDefaults(cfg); err != nil {
+		log.Error().Err(err).Str("config_path", path).Msg("Helpers: Failed to apply limiter defaults")
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+	if err := resolveConnections(cfg); err != nil {
+		log.Error().Err(err).Str("config_path", path).Msg("Helpers: Failed to resolve backend connections")
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
 	}
 	log.Info().Str("config_path", path).Msg("Helpers: Configuration loaded successfully")
 
 	// Validate the loaded configuration
 	log.Info().Msg("Helpers: Validating configuration")
-	if err := validateConfig(&cfg); err != nil {
+	if err := validateConfig(cfg); err != nil {
 		log.Error().Err(err).Msg("Helpers: Configuration validation failed")
 		return nil, fmt.Errorf("configuration validation failed: %w", err)
 	}
 
 	log.Info().Msg("Helpers: Configuration validated successfully")
-	return &cfg, nil
+	return cfg, nil
+}
+
+// applyDefaults expands the shorthand of the limiters and fills the parameters they leave unset from the defaults
+// section, so the merged limiters are validated as if the parameters had been given inline.
+func applyDefaults(cfg *ConfigFile) error {
+	var defaults config.LimiterConfig
+	if cfg.Defaults != nil {
+		if cfg.Defaults.Key != "" {
+			return fmt.Errorf("defaults must not set a limiter key")
+		}
+		defaults = cfg.Defaults.ExpandShorthand()
+	}
+	for i := range cfg.Limiters {
+		cfg.Limiters[i] = cfg.Limiters[i].ExpandShorthand().WithDefaults(defaults)
+	}
+	return nil
+}
+
+// resolveConnections fills the backend parameters of limiters naming a connection from the backends section,
+// so the rest of the configuration is validated and used as if the parameters had been given inline.
+func resolveConnections(cfg *ConfigFile) error {
+	for name, backend := range cfg.Backends {
+		if name == "" {
+			return fmt.Errorf("backend connection name must not be empty")
+		}
+		if backend.Redis == nil {
+			return fmt.Errorf("backend connection '%s' must define redis", name)
+		}
+	}
+	for i := range cfg.Limiters {
+		limiterCfg := &cfg.Limiters[i]
+		if limiterCfg.Connection == "" {
+			continue
+		}
+		backend, ok := cfg.Backends[limiterCfg.Connection]
+		if !ok {
+			return fmt.Errorf("limiter '%s' references unknown backend connection '%s'", limiterCfg.Key, limiterCfg.Connection)
+		}
+		if limiterCfg.Backend != config.Redis {
+			return fmt.Errorf("limiter '%s' references a redis connection but uses the %s backend", limiterCfg.Key, limiterCfg.Backend)
+		}
+		if limiterCfg.RedisParams != nil {
+			return fmt.Errorf("limiter '%s' must not set both connection and redis_params", limiterCfg.Key)
+		}
+		redisParams := *backend.Redis
+		limiterCfg.RedisParams = &redisParams
+	}
+	for i := range cfg.Limiters {
+		limiterCfg := &cfg.Limiters[i]
+		if limiterCfg.Migration == nil || limiterCfg.Migration.Connection == "" {
+			continue
+		}
+		migrationCfg := limiterCfg.Migration
+		backend, ok := cfg.Backends[migrationCfg.Connection]
+		if !ok {
+			return fmt.Errorf("migration of limiter '%s' references unknown backend connection '%s'", limiterCfg.Key, migrationCfg.Connection)
+		}
+		if migrationCfg.Backend != config.Redis {
+			return fmt.Errorf("migration of limiter '%s' references a redis connection but uses the %s backend", limiterCfg.Key, migrationCfg.Backend)
+		}
+		if migrationCfg.RedisParams != nil {
+			return fmt.Errorf("migration of limiter '%s' must not set both connection and redis_params", limiterCfg.Key)
+		}
+		redisParams := *backend.Redis
+		migrationCfg.RedisParams = &redisParams
+	}
+	return nil
 }
 
 // validateConfig performs validation checks on the loaded configuration.
@@ -55,62 +180,865 @@ func validateConfig(cfg *ConfigFile) error {
 	if cfg == nil || len(cfg.Limiters) == 0 {
 		return fmt.Errorf("no rate limiters defined in configuration")
 	}
+	if err := validateAdminConfig(cfg.Admin); err != nil {
+		return err
+	}
+	if err := validateDecisionSinkConfig(cfg.DecisionSink); err != nil {
+		return err
+	}
+	if err := validateMirrorConfig(cfg.Mirror); err != nil {
+		return err
+	}
+	if err := validateAutoscalingConfig(cfg.Autoscaling); err != nil {
+		return err
+	}
+	if err := validateAnomalyDetectionConfig(cfg.AnomalyDetection); err != nil {
+		return err
+	}
+	if err := validateDenialReportConfig(cfg.DenialReport); err != nil {
+		return err
+	}
+	if err := validateConnectionsConfig(cfg.Connections, cfg.Limiters); err != nil {
+		return err
+	}
+	if err := validateOverridesConfig(cfg.Overrides); err != nil {
+		return err
+	}
+	if cfg.Bans != nil && (cfg.Bans.RedisParams == nil || cfg.Bans.RedisParams.Address == "") {
+		return fmt.Errorf("bans.redis_params.address is required")
+	}
+	if err := validateAPIKeysConfig(cfg.APIKeys, cfg.Limiters); err != nil {
+		return err
+	}
+	if err := validatePeersConfig(cfg.Peers); err != nil {
+		return err
+	}
+	if err := validateDrainingConfig(cfg.Draining); err != nil {
+		return err
+	}
+	if err := validateReadOnlyConfig(cfg.ReadOnly, cfg.Limiters); err != nil {
+		return err
+	}
+	if err := validateBudgetGroups(cfg.BudgetGroups, cfg.Limiters); err != nil {
+		return err
+	}
+	switch cfg.StartupPolicy {
+	case "", config.StartupStrict, config.StartupLazy, config.StartupDegraded:
+	default:
+		return fmt.Errorf("unsupported startup_policy '%s'", cfg.StartupPolicy)
+	}
+	switch cfg.Logging.Identifiers {
+	case "", config.IdentifierLogFull, config.IdentifierLogHashed, config.IdentifierLogMasked:
+	default:
+		return fmt.Errorf("unsupported logging.identifiers '%s'", cfg.Logging.Identifiers)
+	}
+	for endpoint, endpointCfg := range cfg.EndpointLimits.LimiterConfigs() {
+		if err := validateAlgorithmParams(endpointCfg); err != nil {
+			return fmt.Errorf("invalid endpoint_limits.%s: %w", endpoint, err)
+		}
+	}
 
+	keys := make(map[string]bool, len(cfg.Limiters))
 	for _, limiterCfg := range cfg.Limiters {
 		if limiterCfg.Key == "" {
 			return fmt.Errorf("limiter key is required for all limiters")
 		}
+		if keys[limiterCfg.Key] {
+			return fmt.Errorf("limiter key '%s' is defined more than once", limiterCfg.Key)
+		}
+		keys[limiterCfg.Key] = true
+		if limiterCfg.MaxWait < 0 {
+			return fmt.Errorf("max_wait must not be negative for limiter '%s'", limiterCfg.Key)
+		}
+		if limiterCfg.IdentifierMetrics != nil && limiterCfg.IdentifierMetrics.MaxIdentifiers < 0 {
+			return fmt.Errorf("identifier_metrics.max_identifiers must not be negative for limiter '%s'", limiterCfg.Key)
+		}
+		switch limiterCfg.StateTransition {
+		case "", config.StateTransitionFresh, config.StateTransitionConvert:
+		default:
+			return fmt.Errorf("unsupported state_transition '%s' for limiter '%s'", limiterCfg.StateTransition, limiterCfg.Key)
+		}
 
-		switch limiterCfg.Algorithm {
-		case config.TokenBucket:
-			if limiterCfg.TokenBucketParams == nil {
-				return fmt.Errorf("token_bucket_params are required for token_bucket limiter '%s'", limiterCfg.Key)
+		if limiterCfg.RequestsPerSecond != 0 || limiterCfg.Burst != 0 || limiterCfg.PerMinuteCap != 0 {
+			if err := validateShorthandConfig(limiterCfg); err != nil {
+				return err
 			}
-			if limiterCfg.TokenBucketParams.Rate <= 0 {
-				return fmt.Errorf("rate must be a positive integer for token_bucket limiter '%s'", limiterCfg.Key)
+		}
+		if limiterCfg.TokenBucketParams != nil && limiterCfg.TokenBucketParams.Lease != nil {
+			if err := validateLeaseConfig(limiterCfg); err != nil {
+				return err
 			}
-			if limiterCfg.TokenBucketParams.Capacity <= 0 {
-				return fmt.Errorf("capacity must be a positive integer for token_bucket limiter '%s'", limiterCfg.Key)
+		}
+		if limiterCfg.Bulkhead != nil {
+			if err := validateBulkheadConfig(limiterCfg); err != nil {
+				return err
 			}
-		case config.FixedWindowCounter, config.SlidingWindowCounter:
-			if limiterCfg.WindowParams == nil {
-				return fmt.Errorf("window_params are required for %s limiter '%s'", limiterCfg.Algorithm, limiterCfg.Key)
+		}
+		if limiterCfg.Migration != nil {
+			if err := validateMigrationConfig(limiterCfg); err != nil {
+				return err
 			}
-			if limiterCfg.WindowParams.Window <= 0 {
-				return fmt.Errorf("window duration must be positive for %s limiter '%s'", limiterCfg.Algorithm, limiterCfg.Key)
+		}
+		if limiterCfg.MemoryPressure != nil {
+			if err := validateMemoryPressureConfig(limiterCfg); err != nil {
+				return err
 			}
-			if limiterCfg.WindowParams.Limit <= 0 {
-				return fmt.Errorf("limit must be a positive integer for %s limiter '%s'", limiterCfg.Algorithm, limiterCfg.Key)
+		}
+		if limiterCfg.IdentifierLimit != nil {
+			if err := validateIdentifierLimitConfig(limiterCfg); err != nil {
+				return err
 			}
-		default:
-			return fmt.Errorf("unsupported algorithm type '%s' for limiter '%s'", limiterCfg.Algorithm, limiterCfg.Key)
 		}
-
-		switch limiterCfg.Backend {
-		case config.InMemory:
-			// No specific backend params to validate for in-memory
-		case config.Redis:
-			if limiterCfg.RedisParams == nil {
-				return fmt.Errorf("redis_params are required for redis backend for limiter '%s'", limiterCfg.Key)
+		if limiterCfg.MaxKeys != nil {
+			if err := validateMaxKeysConfig(limiterCfg); err != nil {
+				return err
 			}
-			if limiterCfg.RedisParams.Address == "" {
-				return fmt.Errorf("redis address is required for redis backend for limiter '%s'", limiterCfg.Key)
+		}
+		if uniqueCfg := limiterCfg.UniqueIdentifiers; uniqueCfg != nil {
+			if uniqueCfg.Interval < 0 {
+				return fmt.Errorf("unique_identifiers.interval must not be negative for limiter '%s'", limiterCfg.Key)
 			}
-		case config.Memcache:
-			if limiterCfg.MemcacheParams == nil {
-				return fmt.Errorf("memcache_params are required for memcache backend for limiter '%s'", limiterCfg.Key)
+			if uniqueCfg.Merge && limiterCfg.Backend != config.Redis {
+				return fmt.Errorf("unique_identifiers.merge requires the redis backend for limiter '%s'", limiterCfg.Key)
 			}
-			if len(limiterCfg.MemcacheParams.Addresses) == 0 || limiterCfg.MemcacheParams.Addresses[0] == "" {
-				return fmt.Errorf("at least one memcache address is required for memcache backend for limiter '%s'", limiterCfg.Key)
+		}
+		if statsCfg := limiterCfg.Stats; statsCfg != nil && (statsCfg.Window < 0 || statsCfg.MaxIdentifiers < 0) {
+			return fmt.Errorf("stats.window and stats.max_identifiers must not be negative for limiter '%s'", limiterCfg.Key)
+		}
+		if historyCfg := limiterCfg.History; historyCfg != nil && (historyCfg.Size < 0 || historyCfg.Retention < 0 || historyCfg.MaxIdentifiers < 0) {
+			return fmt.Errorf("history.size, history.retention and history.max_identifiers must not be negative for limiter '%s'", limiterCfg.Key)
+		}
+		if limiterCfg.Logging != nil {
+			if err := validateLimiterLoggingConfig(limiterCfg); err != nil {
+				return err
+			}
+		}
+
+		if err := validateAlgorithmParams(limiterCfg); err != nil {
+			return err
+		}
+		if writeCfg, ok := limiterCfg.WriteBudgetConfig(); ok {
+			if err := validateAlgorithmParams(writeCfg); err != nil {
+				return fmt.Errorf("invalid write_budget: %w", err)
+			}
+		}
+		if limiterCfg.RegionalBudget != nil {
+			if err := validateRegionalBudgetConfig(*limiterCfg.RegionalBudget); err != nil {
+				return fmt.Errorf("invalid regional_budget for limiter '%s': %w", limiterCfg.Key, err)
+			}
+		}
+
+		if err := validateBackendParams(limiterCfg); err != nil {
+			return err
+		}
+	}
+
+	// Write budgets keep their state under their limiter's key with a suffix, which another limiter must not use
+	for _, limiterCfg := range cfg.Limiters {
+		if writeKey := limiterCfg.Key + config.WriteBudgetSuffix; limiterCfg.WriteBudget != nil && keys[writeKey] {
+			return fmt.Errorf("limiter key '%s' is reserved for the write budget of limiter '%s'", writeKey, limiterCfg.Key)
+		}
+	}
+
+	return nil
+}
+
+// validateBackendParams checks the parameters of the limiter's backend.
+func validateBackendParams(limiterCfg config.LimiterConfig) error {
+	switch limiterCfg.Backend {
+	case config.InMemory:
+		// No specific backend params to validate for in-memory
+	case config.Redis:
+		if limiterCfg.RedisParams == nil {
+			return fmt.Errorf("redis_params are required for redis backend for limiter '%s'", limiterCfg.Key)
+		}
+		if limiterCfg.RedisParams.Address == "" {
+			return fmt.Errorf("redis address is required for redis backend for limiter '%s'", limiterCfg.Key)
+		}
+		if limiterCfg.RedisParams.KeyCacheSize < 0 {
+			return fmt.Errorf("key_cache_size must not be negative for limiter '%s'", limiterCfg.Key)
+		}
+		if err := dialer.Check(limiterCfg.RedisParams.Proxy, limiterCfg.RedisParams.Dialer); err != nil {
+			return fmt.Errorf("invalid redis connection for limiter '%s': %w", limiterCfg.Key, err)
+		}
+		if err := validateRefresh(limiterCfg.RedisParams.ResolveInterval, limiterCfg.RedisParams.Proxy, limiterCfg.RedisParams.Dialer); err != nil {
+			return fmt.Errorf("invalid redis connection for limiter '%s': %w", limiterCfg.Key, err)
+		}
+		if limiterCfg.RedisParams.ConnMaxAge < 0 {
+			return fmt.Errorf("conn_max_age must not be negative for limiter '%s'", limiterCfg.Key)
+		}
+	case config.Memcache:
+		if limiterCfg.MemcacheParams == nil {
+			return fmt.Errorf("memcache_params are required for memcache backend for limiter '%s'", limiterCfg.Key)
+		}
+		if len(limiterCfg.MemcacheParams.Addresses) == 0 || limiterCfg.MemcacheParams.Addresses[0] == "" {
+			return fmt.Errorf("at least one memcache address is required for memcache backend for limiter '%s'", limiterCfg.Key)
+		}
+		if _, err := codec.New(limiterCfg.MemcacheParams.Codec); err != nil {
+			return fmt.Errorf("invalid memcache codec for limiter '%s': %w", limiterCfg.Key, err)
+		}
+		if _, err := codec.Compress(codec.JSON, limiterCfg.MemcacheParams.Compression, 0); err != nil {
+			return fmt.Errorf("invalid memcache compression for limiter '%s': %w", limiterCfg.Key, err)
+		}
+		if limiterCfg.MemcacheParams.CompressionThreshold < 0 {
+			return fmt.Errorf("compression_threshold must not be negative for limiter '%s'", limiterCfg.Key)
+		}
+		if err := dialer.Check(limiterCfg.MemcacheParams.Proxy, limiterCfg.MemcacheParams.Dialer); err != nil {
+			return fmt.Errorf("invalid memcache connection for limiter '%s': %w", limiterCfg.Key, err)
+		}
+		if err := validateMemcacheClientConfig(limiterCfg.MemcacheParams); err != nil {
+			return fmt.Errorf("invalid memcache connection for limiter '%s': %w", limiterCfg.Key, err)
+		}
+	default:
+		return fmt.Errorf("unsupported backend type '%s' for limiter '%s'", limiterCfg.Backend, limiterCfg.Key)
+	}
+	return nil
+}
+
+// validateMemcacheClientConfig checks the key distribution, limits and credentials of a Memcache client.
+func validateMemcacheClientConfig(params *config.MemcacheBackendConfig) error {
+	switch params.Hashing {
+	case "", config.MemcacheHashingModulo, config.MemcacheHashingKetama:
+	default:
+		return fmt.Errorf("unsupported hashing '%s'", params.Hashing)
+	}
+	if params.ResolveInterval < 0 || params.Timeout < 0 || params.MaxIdleConns < 0 {
+		return fmt.Errorf("resolve_interval, timeout and max_idle_conns must not be negative")
+	}
+	if (params.Username == "") != (params.Password == "") {
+		return fmt.Errorf("username and password must be set together")
+	}
+	if strings.ContainsAny(params.Username, " \r\n") || strings.ContainsAny(params.Password, "\r\n") {
+		return fmt.Errorf("username must not contain spaces or line breaks, nor password line breaks")
+	}
+	return nil
+}
+
+// validateRefresh checks that addresses are only re-resolved for direct connections, whose peers are the resolved addresses.
+func validateRefresh(resolveInterval time.Duration, proxy, dialerName string) error {
+	if resolveInterval < 0 {
+		return fmt.Errorf("resolve_interval must not be negative")
+	}
+	if resolveInterval > 0 && (proxy != "" || dialerName != "") {
+		return fmt.Errorf("resolve_interval cannot be combined with a proxy or dialer")
+	}
+	return nil
+}
+
+// validateAlgorithmParams checks that the parameters required by the limiter's algorithm are present and valid.
+func validateAlgorithmParams(limiterCfg config.LimiterConfig) error {
+	switch limiterCfg.Algorithm {
+	case config.TokenBucket:
+		if limiterCfg.TokenBucketParams == nil {
+			return fmt.Errorf("token_bucket_params are required for token_bucket limiter '%s'", limiterCfg.Key)
+		}
+		if limiterCfg.TokenBucketParams.Rate <= 0 {
+			return fmt.Errorf("rate must be a positive integer for token_bucket limiter '%s'", limiterCfg.Key)
+		}
+		if limiterCfg.TokenBucketParams.Capacity <= 0 {
+			return fmt.Errorf("capacity must be a positive integer for token_bucket limiter '%s'", limiterCfg.Key)
+		}
+		if limiterCfg.TokenBucketParams.MaxDebt < 0 {
+			return fmt.Errorf("max_debt must not be negative for token_bucket limiter '%s'", limiterCfg.Key)
+		}
+		if limiterCfg.TokenBucketParams.ServerTime && limiterCfg.Backend != config.Redis {
+			return fmt.Errorf("server_time is only supported for the redis backend for token_bucket limiter '%s'", limiterCfg.Key)
+		}
+	case config.LeakyBucket:
+		if limiterCfg.LeakyBucketParams == nil {
+			return fmt.Errorf("leaky_bucket_params are required for leaky_bucket limiter '%s'", limiterCfg.Key)
+		}
+		if limiterCfg.LeakyBucketParams.Rate <= 0 {
+			return fmt.Errorf("rate must be a positive integer for leaky_bucket limiter '%s'", limiterCfg.Key)
+		}
+		if limiterCfg.LeakyBucketParams.Capacity <= 0 {
+			return fmt.Errorf("capacity must be a positive integer for leaky_bucket limiter '%s'", limiterCfg.Key)
+		}
+	case config.FixedWindowCounter, config.SlidingWindowCounter, config.SlidingWindowLog:
+		if limiterCfg.WindowParams == nil {
+			return fmt.Errorf("window_params are required for %s limiter '%s'", limiterCfg.Algorithm, limiterCfg.Key)
+		}
+		if limiterCfg.WindowParams.Window <= 0 {
+			return fmt.Errorf("window duration must be positive for %s limiter '%s'", limiterCfg.Algorithm, limiterCfg.Key)
+		}
+		if limiterCfg.WindowParams.Limit <= 0 {
+			return fmt.Errorf("limit must be a positive integer for %s limiter '%s'", limiterCfg.Algorithm, limiterCfg.Key)
+		}
+		if limiterCfg.WindowParams.CacheDenials && limiterCfg.Algorithm != config.FixedWindowCounter {
+			return fmt.Errorf("cache_denials is only supported for fixed_window_counter limiter '%s'", limiterCfg.Key)
+		}
+		switch limiterCfg.WindowParams.Alignment {
+		case "":
+		case config.AlignFirstRequest, config.AlignWallClock:
+			if limiterCfg.Algorithm != config.FixedWindowCounter {
+				return fmt.Errorf("window_alignment is only supported for fixed_window_counter limiter '%s'", limiterCfg.Key)
 			}
 		default:
-			return fmt.Errorf("unsupported backend type '%s' for limiter '%s'", limiterCfg.Backend, limiterCfg.Key)
+			return fmt.Errorf("unsupported window_alignment '%s' for limiter '%s'", limiterCfg.WindowParams.Alignment, limiterCfg.Key)
+		}
+		if smoothing := limiterCfg.WindowParams.Smoothing; smoothing != nil {
+			if limiterCfg.Algorithm != config.FixedWindowCounter {
+				return fmt.Errorf("smoothing is only supported for fixed_window_counter limiter '%s'", limiterCfg.Key)
+			}
+			if smoothing.BurstFraction < 0 || smoothing.BurstFraction >= 1 {
+				return fmt.Errorf("smoothing.burst_fraction must be at least 0 and below 1 for limiter '%s'", limiterCfg.Key)
+			}
+			switch smoothing.Mode {
+			case "", config.SmoothingDeny, config.SmoothingDelay:
+			default:
+				return fmt.Errorf("unsupported smoothing mode '%s' for limiter '%s'", smoothing.Mode, limiterCfg.Key)
+			}
 		}
+	default:
+		return fmt.Errorf("unsupported algorithm type '%s' for limiter '%s'", limiterCfg.Algorithm, limiterCfg.Key)
 	}
+	return nil
+}
 
+// validateLeaseConfig checks the token lease of a limiter, which only applies to plain Redis token buckets.
+func validateLeaseConfig(limiterCfg config.LimiterConfig) error {
+	leaseCfg := limiterCfg.TokenBucketParams.Lease
+	if limiterCfg.Algorithm != config.TokenBucket || limiterCfg.Backend != config.Redis {
+		return fmt.Errorf("lease requires a redis token_bucket for limiter '%s'", limiterCfg.Key)
+	}
+	if limiterCfg.WriteBudget != nil || limiterCfg.RegionalBudget != nil || limiterCfg.TokenBucketParams.MaxDebt > 0 {
+		return fmt.Errorf("lease cannot be combined with write_budget, regional_budget or max_debt for limiter '%s'", limiterCfg.Key)
+	}
+	if leaseCfg.Size <= 0 {
+		return fmt.Errorf("lease.size must be positive for limiter '%s'", limiterCfg.Key)
+	}
+	if leaseCfg.TTL < 0 {
+		return fmt.Errorf("lease.ttl must not be negative for limiter '%s'", limiterCfg.Key)
+	}
+	if leaseCfg.StalenessBudget < 0 {
+		return fmt.Errorf("lease.staleness_budget must not be negative for limiter '%s'", limiterCfg.Key)
+	}
+	for _, identifier := range leaseCfg.WarmIdentifiers {
+		if identifier == "" {
+			return fmt.Errorf("lease.warm_identifiers must not contain empty identifiers for limiter '%s'", limiterCfg.Key)
+		}
+	}
 	return nil
 }
 
+// validateShorthandConfig checks the requests_per_second, burst and per_minute_cap of a limiter. Once expanded,
+// requests_per_second and burst must match the token bucket they replace, so they cannot conflict with an explicit algorithm.
+func validateShorthandConfig(limiterCfg config.LimiterConfig) error {
+	if limiterCfg.RequestsPerSecond < 0 || limiterCfg.Burst < 0 || limiterCfg.PerMinuteCap < 0 {
+		return fmt.Errorf("requests_per_second, burst and per_minute_cap must not be negative for limiter '%s'", limiterCfg.Key)
+	}
+	if limiterCfg.Burst > 0 && limiterCfg.RequestsPerSecond == 0 {
+		return fmt.Errorf("burst requires requests_per_second for limiter '%s'", limiterCfg.Key)
+	}
+	if limiterCfg.RequestsPerSecond > 0 {
+		burst := limiterCfg.Burst
+		if burst == 0 {
+			burst = limiterCfg.RequestsPerSecond
+		}
+		params := limiterCfg.TokenBucketParams
+		if limiterCfg.Algorithm != config.TokenBucket || params == nil || params.Rate != limiterCfg.RequestsPerSecond || params.Capacity != burst {
+			return fmt.Errorf("requests_per_second and burst replace algorithm and token_bucket_params for limiter '%s', set one or the other", limiterCfg.Key)
+		}
+	}
+	if limiterCfg.PerMinuteCap > 0 && limiterCfg.TokenBucketParams != nil && limiterCfg.TokenBucketParams.Lease != nil {
+		return fmt.Errorf("per_minute_cap cannot be combined with lease for limiter '%s'", limiterCfg.Key)
+	}
+	return nil
+}
+
+// validateMigrationConfig checks that the migration target is a different backend the limiter can be created with.
+func validateMigrationConfig(limiterCfg config.LimiterConfig) error {
+	migrationCfg := limiterCfg.Migration
+	targetCfg, _ := limiterCfg.MigrationTargetConfig()
+	if err := validateBackendParams(targetCfg); err != nil {
+		return fmt.Errorf("invalid migration: %w", err)
+	}
+	if migrationCfg.Backend == limiterCfg.Backend && (migrationCfg.Backend == config.InMemory ||
+		reflect.DeepEqual(migrationCfg.RedisParams, limiterCfg.RedisParams) && reflect.DeepEqual(migrationCfg.MemcacheParams, limiterCfg.MemcacheParams)) {
+		return fmt.Errorf("migration of limiter '%s' must target another backend", limiterCfg.Key)
+	}
+	if limiterCfg.RegionalBudget != nil || (limiterCfg.TokenBucketParams != nil && limiterCfg.TokenBucketParams.Lease != nil) {
+		return fmt.Errorf("migration cannot be combined with regional_budget or lease for limiter '%s'", limiterCfg.Key)
+	}
+	return nil
+}
+
+// validateMemoryPressureConfig checks the memory pressure handling of a limiter, which only applies to Redis.
+func validateMemoryPressureConfig(limiterCfg config.LimiterConfig) error {
+	pressureCfg := limiterCfg.MemoryPressure
+	if limiterCfg.Backend != config.Redis {
+		return fmt.Errorf("memory_pressure requires the redis backend for limiter '%s'", limiterCfg.Key)
+	}
+	switch pressureCfg.OnOOM {
+	case "", config.FailClosed, config.FailOpen:
+	default:
+		return fmt.Errorf("unsupported memory_pressure.on_oom '%s' for limiter '%s'", pressureCfg.OnOOM, limiterCfg.Key)
+	}
+	switch pressureCfg.EvictionPolicy {
+	case "", config.EvictionCount:
+	case config.EvictionDeny:
+		if !pressureCfg.WatchEvictions {
+			return fmt.Errorf("memory_pressure.eviction_policy 'deny' requires watch_evictions for limiter '%s'", limiterCfg.Key)
+		}
+	default:
+		return fmt.Errorf("unsupported memory_pressure.eviction_policy '%s' for limiter '%s'", pressureCfg.EvictionPolicy, limiterCfg.Key)
+	}
+	if pressureCfg.EvictionPenalty < 0 {
+		return fmt.Errorf("memory_pressure.eviction_penalty must not be negative for limiter '%s'", limiterCfg.Key)
+	}
+	return nil
+}
+
+// validateBulkheadConfig checks the bulkhead of a limiter, which only applies to remote backends.
+func validateBulkheadConfig(limiterCfg config.LimiterConfig) error {
+	if limiterCfg.Backend == config.InMemory {
+		return fmt.Errorf("bulkhead is not supported for in-memory limiter '%s'", limiterCfg.Key)
+	}
+	if limiterCfg.Bulkhead.MaxInFlight <= 0 {
+		return fmt.Errorf("bulkhead.max_in_flight must be positive for limiter '%s'", limiterCfg.Key)
+	}
+	switch limiterCfg.Bulkhead.FailureMode {
+	case "", config.FailClosed, config.FailOpen:
+	default:
+		return fmt.Errorf("unsupported bulkhead.failure_mode '%s' for limiter '%s'", limiterCfg.Bulkhead.FailureMode, limiterCfg.Key)
+	}
+	return nil
+}
+
+// validateIdentifierLimitConfig checks the identifier limit of a limiter.
+func validateIdentifierLimitConfig(limiterCfg config.LimiterConfig) error {
+	identifierLimit := limiterCfg.IdentifierLimit
+	switch identifierLimit.Policy {
+	case "", config.IdentifierPolicyHash:
+		if identifierLimit.MaxLength < config.MinHashedIdentifierLength {
+			return fmt.Errorf("identifier_limit.max_length must be at least %d with the hash policy for limiter '%s'", config.MinHashedIdentifierLength, limiterCfg.Key)
+		}
+	case config.IdentifierPolicyReject:
+		if identifierLimit.MaxLength <= 0 {
+			return fmt.Errorf("identifier_limit.max_length must be positive for limiter '%s'", limiterCfg.Key)
+		}
+	default:
+		return fmt.Errorf("unsupported identifier_limit.policy '%s' for limiter '%s'", identifierLimit.Policy, limiterCfg.Key)
+	}
+	return nil
+}
+
+// validateMaxKeysConfig checks the key cap of a limiter. Evicting identifiers needs state held by this instance.
+func validateMaxKeysConfig(limiterCfg config.LimiterConfig) error {
+	maxKeys := limiterCfg.MaxKeys
+	if maxKeys.Limit <= 0 {
+		return fmt.Errorf("max_keys.limit must be positive for limiter '%s'", limiterCfg.Key)
+	}
+	if maxKeys.Window < 0 {
+		return fmt.Errorf("max_keys.window must not be negative for limiter '%s'", limiterCfg.Key)
+	}
+	switch maxKeys.Policy {
+	case "", config.KeyOverflowReject, config.KeyOverflowShare:
+	case config.KeyOverflowEvict:
+		if limiterCfg.Backend != config.InMemory {
+			return fmt.Errorf("max_keys.policy 'evict' requires the in_memory backend for limiter '%s'", limiterCfg.Key)
+		}
+	default:
+		return fmt.Errorf("unsupported max_keys.policy '%s' for limiter '%s'", maxKeys.Policy, limiterCfg.Key)
+	}
+	return nil
+}
+
+// validateLimiterLoggingConfig checks the log level and sample rate of a limiter.
+func validateLimiterLoggingConfig(limiterCfg config.LimiterConfig) error {
+	loggingCfg := limiterCfg.Logging
+	if loggingCfg.Level != "" {
+		if _, err := zerolog.ParseLevel(loggingCfg.Level); err != nil {
+			return fmt.Errorf("invalid logging.level '%s' for limiter '%s'", loggingCfg.Level, limiterCfg.Key)
+		}
+	}
+	if rate := loggingCfg.SampleRate; rate != nil && (*rate < 0 || *rate > 1) {
+		return fmt.Errorf("logging.sample_rate must be between 0 and 1 for limiter '%s'", limiterCfg.Key)
+	}
+	return nil
+}
+
+// validatePeersConfig checks that peer mode has a source of peers including this instance.
+// This instance's address may come from the environment, so it is only checked when configured explicitly.
+func validatePeersConfig(peersCfg *config.PeersConfig) error {
+	if peersCfg == nil {
+		return nil
+	}
+	switch {
+	case peersCfg.Kubernetes != nil:
+		if len(peersCfg.Static) > 0 {
+			return fmt.Errorf("peers.static and peers.kubernetes are mutually exclusive")
+		}
+		if peersCfg.Kubernetes.Service == "" {
+			return fmt.Errorf("peers.kubernetes.service is required")
+		}
+	case len(peersCfg.Static) == 0:
+		return fmt.Errorf("peers.static or peers.kubernetes is required")
+	case peersCfg.Self != "" && !slices.Contains(peersCfg.Static, peersCfg.Self):
+		return fmt.Errorf("peers.static must include peers.self '%s'", peersCfg.Self)
+	}
+	if peersCfg.SecretEnv == "" {
+		return fmt.Errorf("peers.secret_env is required")
+	}
+	if peersCfg.Timeout < 0 {
+		return fmt.Errorf("peers.timeout must not be negative")
+	}
+	switch peersCfg.FailureMode {
+	case "", config.FailClosed, config.FailOpen:
+	default:
+		return fmt.Errorf("unsupported peers.failure_mode '%s'", peersCfg.FailureMode)
+	}
+	return nil
+}
+
+// validateRegionalBudgetConfig checks that the regional shares add up to 100% and that reconciliation has a store.
+// The local region may come from the environment, so it is only checked against the shares when configured explicitly.
+func validateRegionalBudgetConfig(regionalCfg config.RegionalBudgetConfig) error {
+	if len(regionalCfg.Shares) == 0 {
+		return fmt.Errorf("at least one region share is required")
+	}
+	var total float64
+	for region, percent := range regionalCfg.Shares {
+		if region == "" || percent <= 0 {
+			return fmt.Errorf("share for region '%s' must be positive", region)
+		}
+		total += percent
+	}
+	if math.Abs(total-100) > 0.01 {
+		return fmt.Errorf("shares must add up to 100, got %g", total)
+	}
+	if regionalCfg.Region != "" {
+		if _, ok := regionalCfg.Shares[regionalCfg.Region]; !ok {
+			return fmt.Errorf("region '%s' has no share", regionalCfg.Region)
+		}
+	}
+	if reconcileCfg := regionalCfg.Reconcile; reconcileCfg != nil {
+		if reconcileCfg.Interval < 0 {
+			return fmt.Errorf("reconcile.interval must not be negative")
+		}
+		if reconcileCfg.RedisParams == nil || reconcileCfg.RedisParams.Address == "" {
+			return fmt.Errorf("reconcile.redis_params.address is required")
+		}
+	}
+	return nil
+}
+
+// validateDecisionSinkConfig checks the decision sink's store and buffering parameters.
+func validateDecisionSinkConfig(sinkCfg *config.DecisionSinkConfig) error {
+	if sinkCfg == nil {
+		return nil
+	}
+	switch sinkCfg.Sink {
+	case config.DecisionSinkFile:
+		if sinkCfg.Path == "" {
+			return fmt.Errorf("decision_sink.path is required for the file decision sink")
+		}
+	case config.DecisionSinkRedis:
+		if sinkCfg.RedisParams == nil || sinkCfg.RedisParams.Address == "" {
+			return fmt.Errorf("decision_sink.redis_params.address is required for the redis decision sink")
+		}
+	case config.DecisionSinkStdout:
+	default:
+		return fmt.Errorf("unsupported decision sink '%s'", sinkCfg.Sink)
+	}
+	if sinkCfg.SampleRate < 0 || sinkCfg.SampleRate > 1 {
+		return fmt.Errorf("decision_sink.sample_rate must be between 0 and 1")
+	}
+	if sinkCfg.MaxEntries < 0 || sinkCfg.BatchSize < 0 || sinkCfg.FlushInterval < 0 || sinkCfg.BufferSize < 0 {
+		return fmt.Errorf("decision_sink.max_entries, batch_size, flush_interval and buffer_size must not be negative")
+	}
+	switch sinkCfg.Overflow {
+	case "", config.OverflowDropNewest, config.OverflowDropOldest, config.OverflowBlock:
+	default:
+		return fmt.Errorf("unsupported decision_sink.overflow policy '%s'", sinkCfg.Overflow)
+	}
+	return nil
+}
+
+// validateMirrorConfig checks that the mirror sink has its destination and that its limits are valid.
+func validateMirrorConfig(mirrorCfg *config.MirrorConfig) error {
+	if mirrorCfg == nil {
+		return nil
+	}
+	switch mirrorCfg.Sink {
+	case config.MirrorSinkHTTP:
+		u, err := url.Parse(mirrorCfg.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("mirror.url must be an http or https URL for the http mirror sink")
+		}
+	case config.MirrorSinkFile:
+		if mirrorCfg.Path == "" {
+			return fmt.Errorf("mirror.path is required for the file mirror sink")
+		}
+	case config.MirrorSinkStdout:
+	default:
+		return fmt.Errorf("unsupported mirror sink '%s'", mirrorCfg.Sink)
+	}
+	if mirrorCfg.SampleRate < 0 || mirrorCfg.SampleRate > 1 {
+		return fmt.Errorf("mirror.sample_rate must be between 0 and 1")
+	}
+	if mirrorCfg.Timeout < 0 || mirrorCfg.MaxBodyBytes < 0 || mirrorCfg.BatchSize < 0 || mirrorCfg.FlushInterval < 0 || mirrorCfg.BufferSize < 0 {
+		return fmt.Errorf("mirror.timeout, max_body_bytes, batch_size, flush_interval and buffer_size must not be negative")
+	}
+	return nil
+}
+
+// validateAutoscalingConfig checks the windows and resolution of the autoscaling hints.
+func validateAutoscalingConfig(autoscalingCfg *config.AutoscalingConfig) error {
+	if autoscalingCfg == nil {
+		return nil
+	}
+	if autoscalingCfg.Resolution < 0 {
+		return fmt.Errorf("autoscaling.resolution must not be negative")
+	}
+	for _, window := range autoscalingCfg.Windows {
+		if window <= 0 {
+			return fmt.Errorf("autoscaling.windows must be positive")
+		}
+	}
+	return nil
+}
+
+// validateAnomalyDetectionConfig checks the sensitivity and webhook of the deny rate anomaly detection.
+func validateAnomalyDetectionConfig(anomalyCfg *config.AnomalyDetectionConfig) error {
+	if anomalyCfg == nil {
+		return nil
+	}
+	if anomalyCfg.Interval < 0 || anomalyCfg.WebhookTimeout < 0 {
+		return fmt.Errorf("anomaly_detection.interval and anomaly_detection.webhook_timeout must not be negative")
+	}
+	if anomalyCfg.Smoothing < 0 || anomalyCfg.Smoothing > 1 {
+		return fmt.Errorf("anomaly_detection.smoothing must be between 0 and 1")
+	}
+	if anomalyCfg.MinDenyRate < 0 || anomalyCfg.MinDenyRate > 1 {
+		return fmt.Errorf("anomaly_detection.min_deny_rate must be between 0 and 1")
+	}
+	if anomalyCfg.Threshold < 0 || anomalyCfg.Warmup < 0 || anomalyCfg.MinRequests < 0 {
+		return fmt.Errorf("anomaly_detection.threshold, warmup and min_requests must not be negative")
+	}
+	if anomalyCfg.WebhookURL != "" {
+		u, err := url.Parse(anomalyCfg.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("anomaly_detection.webhook_url must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+// validateDenialReportConfig checks the sizes of the daily denial reports.
+func validateDenialReportConfig(reportCfg *config.DenialReportConfig) error {
+	if reportCfg == nil {
+		return nil
+	}
+	if reportCfg.RetentionDays < 0 || reportCfg.TopIdentifiers < 0 || reportCfg.MaxIdentifiers < 0 {
+		return fmt.Errorf("denial_report.retention_days, denial_report.top_identifiers and denial_report.max_identifiers must not be negative")
+	}
+	return nil
+}
+
+// validateReadOnlyConfig checks that the read-only limiters are configured and the duration is not negative.
+func validateReadOnlyConfig(readOnlyCfg *config.ReadOnlyConfig, limiters []config.LimiterConfig) error {
+	if readOnlyCfg == nil {
+		return nil
+	}
+	if readOnlyCfg.Duration < 0 {
+		return fmt.Errorf("read_only.duration must not be negative")
+	}
+	for _, key := range readOnlyCfg.Limiters {
+		if !slices.ContainsFunc(limiters, func(limiterCfg config.LimiterConfig) bool { return limiterCfg.Key == key }) {
+			return fmt.Errorf("read_only.limiters references unknown limiter '%s'", key)
+		}
+	}
+	return nil
+}
+
+// validateBudgetGroups checks that each group shares the budget of a configured limiter, and that each member key is
+// neither a limiter key nor a member of another group.
+func validateBudgetGroups(groups []config.BudgetGroupConfig, limiters []config.LimiterConfig) error {
+	keys := make(map[string]bool, len(limiters))
+	for _, limiterCfg := range limiters {
+		keys[limiterCfg.Key] = true
+	}
+	members := make(map[string]string)
+	for _, group := range groups {
+		if !keys[group.Limiter] {
+			return fmt.Errorf("budget_groups references unknown limiter '%s'", group.Limiter)
+		}
+		if len(group.Members) == 0 {
+			return fmt.Errorf("budget group of limiter '%s' has no members", group.Limiter)
+		}
+		for _, member := range group.Members {
+			switch other, ok := members[member]; {
+			case member == "":
+				return fmt.Errorf("budget group of limiter '%s' has an empty member key", group.Limiter)
+			case keys[member]:
+				return fmt.Errorf("budget group member '%s' of limiter '%s' is a limiter key", member, group.Limiter)
+			case ok:
+				return fmt.Errorf("budget group member '%s' is listed for both limiter '%s' and limiter '%s'", member, other, group.Limiter)
+			}
+			members[member] = group.Limiter
+		}
+	}
+	return nil
+}
+
+// validateDrainingConfig checks the grace period and mode of removed limiters.
+func validateDrainingConfig(drainingCfg *config.DrainingConfig) error {
+	if drainingCfg == nil {
+		return nil
+	}
+	if drainingCfg.GracePeriod < 0 {
+		return fmt.Errorf("draining.grace_period must not be negative")
+	}
+	switch drainingCfg.Mode {
+	case "", config.DrainEnforce, config.DrainAllow:
+	default:
+		return fmt.Errorf("unsupported draining.mode '%s'", drainingCfg.Mode)
+	}
+	return nil
+}
+
+// validateConnectionsConfig checks that the connection limiter refers to a configured limiter.
+func validateConnectionsConfig(connCfg *config.ConnectionsConfig, limiters []config.LimiterConfig) error {
+	if connCfg == nil {
+		return nil
+	}
+	if connCfg.MaxPerIP < 0 {
+		return fmt.Errorf("connections.max_per_ip must not be negative")
+	}
+	for _, limiterCfg := range limiters {
+		if limiterCfg.Key == connCfg.Limiter {
+			return nil
+		}
+	}
+	return fmt.Errorf("connections.limiter refers to unknown limiter '%s'", connCfg.Limiter)
+}
+
+// validateAPIKeysConfig checks that every plan is enforced by a configured limiter and every key belongs to a plan.
+func validateAPIKeysConfig(keysCfg *config.APIKeysConfig, limiters []config.LimiterConfig) error {
+	if keysCfg == nil {
+		return nil
+	}
+	if len(keysCfg.Plans) == 0 {
+		return fmt.Errorf("api_keys.plans must define at least one plan")
+	}
+	limiterKeys := make(map[string]bool, len(limiters))
+	for _, limiterCfg := range limiters {
+		limiterKeys[limiterCfg.Key] = true
+	}
+	for plan, limiterKey := range keysCfg.Plans {
+		if !limiterKeys[limiterKey] {
+			return fmt.Errorf("api_keys plan '%s' refers to unknown limiter '%s'", plan, limiterKey)
+		}
+	}
+	for _, keyCfg := range keysCfg.Keys {
+		if keyCfg.Name == "" {
+			return fmt.Errorf("api_keys.keys entries require a name")
+		}
+		if (keyCfg.Key == "") == (keyCfg.KeyEnv == "") {
+			return fmt.Errorf("api key '%s' requires exactly one of key or key_env", keyCfg.Name)
+		}
+		if _, ok := keysCfg.Plans[keyCfg.Plan]; !ok {
+			return fmt.Errorf("api key '%s' has unknown plan '%s'", keyCfg.Name, keyCfg.Plan)
+		}
+	}
+	if keysCfg.RedisParams != nil && keysCfg.RedisParams.Address == "" {
+		return fmt.Errorf("api_keys.redis_params.address is required when redis_params are set")
+	}
+	if keysCfg.RefreshInterval < 0 {
+		return fmt.Errorf("api_keys.refresh_interval must not be negative")
+	}
+	return nil
+}
+
+// validateOverridesConfig checks that the override store is supported and has the connection it needs.
+func validateOverridesConfig(overridesCfg *config.OverridesConfig) error {
+	if overridesCfg == nil {
+		return nil
+	}
+	switch overridesCfg.Store {
+	case "", config.OverrideStoreMemory:
+	case config.OverrideStoreRedis:
+		if overridesCfg.RedisParams == nil || overridesCfg.RedisParams.Address == "" {
+			return fmt.Errorf("overrides.redis_params.address is required for the redis override store")
+		}
+	default:
+		return fmt.Errorf("unsupported override store '%s'", overridesCfg.Store)
+	}
+	if overridesCfg.RefreshInterval < 0 {
+		return fmt.Errorf("overrides.refresh_interval must not be negative")
+	}
+	return nil
+}
+
+// validateAdminConfig checks the admin API configuration, which may be absent.
+func validateAdminConfig(adminCfg *config.AdminConfig) error {
+	if adminCfg == nil {
+		return nil
+	}
+	if err := validateAdminAuthConfig(adminCfg.Auth); err != nil {
+		return err
+	}
+	audit := adminCfg.Audit
+	if audit == nil {
+		return nil
+	}
+	if audit.MaxEntries < 0 {
+		return fmt.Errorf("admin.audit.max_entries must not be negative")
+	}
+	switch audit.Sink {
+	case "", config.AuditSinkMemory:
+	case config.AuditSinkFile:
+		if audit.Path == "" {
+			return fmt.Errorf("admin.audit.path is required for the file audit sink")
+		}
+	case config.AuditSinkRedis:
+		if audit.RedisParams == nil || audit.RedisParams.Address == "" {
+			return fmt.Errorf("admin.audit.redis_params.address is required for the redis audit sink")
+		}
+	default:
+		return fmt.Errorf("unsupported audit sink '%s'", audit.Sink)
+	}
+	return nil
+}
+
+// validateAdminAuthConfig checks the admin API credentials, which may be absent.
+func validateAdminAuthConfig(authCfg *config.AdminAuthConfig) error {
+	if authCfg == nil {
+		return nil
+	}
+	for _, token := range authCfg.Tokens {
+		if token.Name == "" {
+			return fmt.Errorf("admin.auth.tokens: name is required")
+		}
+		if (token.Token == "") == (token.TokenEnv == "") {
+			return fmt.Errorf("admin.auth.tokens '%s': exactly one of token and token_env is required", token.Name)
+		}
+		if err := validateAdminRole(token.Role); err != nil {
+			return fmt.Errorf("admin.auth.tokens '%s': %w", token.Name, err)
+		}
+	}
+	for _, cert := range authCfg.ClientCerts {
+		if cert.CommonName == "" {
+			return fmt.Errorf("admin.auth.client_certs: common_name is required")
+		}
+		if err := validateAdminRole(cert.Role); err != nil {
+			return fmt.Errorf("admin.auth.client_certs '%s': %w", cert.CommonName, err)
+		}
+	}
+	return nil
+}
+
+// validateAdminRole checks that the role is a supported admin role.
+func validateAdminRole(role config.AdminRole) error {
+	switch role {
+	case config.AdminRoleRead, config.AdminRoleMutate:
+		return nil
+	default:
+		return fmt.Errorf("unsupported role '%s'", role)
+	}
+}
+
 // InitRedisClient initializes and pings a Redis client based on the provided limiter configuration.
 // It takes a LimiterConfig (specifically the RedisParams) and returns a Redis client instance or an error.
 func InitRedisClient(cfg *config.LimiterConfig) (*redis.Client, error) {
@@ -120,15 +1048,7 @@ func InitRedisClient(cfg *config.LimiterConfig) (*redis.Client, error) {
 		log.Error().Err(err).Msg("Helpers: Redis initialization failed")
 		return nil, err
 	}
-	client := redis.NewClient(&redis.Options{
-		Addr:         cfg.RedisParams.Address,
-		Password:     cfg.RedisParams.Password,
-		DB:           cfg.RedisParams.DB,
-		PoolSize:     cfg.RedisParams.PoolSize,
-		DialTimeout:  cfg.RedisParams.DialTimeout,
-		ReadTimeout:  cfg.RedisParams.ReadTimeout,
-		WriteTimeout: cfg.RedisParams.WriteTimeout,
-	})
+	client := NewRedisClient(cfg.RedisParams)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -141,5 +1061,46 @@ func InitRedisClient(cfg *config.LimiterConfig) (*redis.Client, error) {
 		return nil, fmt.Errorf("failed to connect to Redis at %s: %w", cfg.RedisParams.Address, err)
 	}
 	log.Info().Str("address", cfg.RedisParams.Address).Msg("Helpers: Successfully connected to Redis.")
+	// Best effort: scripts missing from the server's cache are sent in full on their first run
+	if err := redisscripts.LoadAll(ctx, client); err != nil {
+		log.Warn().Err(err).Str("address", cfg.RedisParams.Address).Msg("Helpers: Failed to preload Lua scripts")
+	}
 	return client, nil
 }
+
+// NewRedisClient creates a Redis client for params without checking that the server is reachable.
+// The client connects on first use, through the proxy or registered dialer of params if any.
+func NewRedisClient(params *config.RedisBackendConfig) *redis.Client {
+	opts := &redis.Options{
+		Addr:         params.Address,
+		Password:     params.Password,
+		DB:           params.DB,
+		PoolSize:     params.PoolSize,
+		DialTimeout:  params.DialTimeout,
+		ReadTimeout:  params.ReadTimeout,
+		WriteTimeout: params.WriteTimeout,
+		MaxConnAge:   params.ConnMaxAge,
+	}
+	if params.ResolveInterval > 0 {
+		opts.Dialer = dialer.Refreshing(params.Address, params.ResolveInterval, dialTimeout(params.DialTimeout))
+		return redis.NewClient(opts)
+	}
+	dial, err := dialer.New(params.Proxy, params.Dialer, dialTimeout(params.DialTimeout))
+	if err != nil {
+		// Reported by every dial, like an unreachable server
+		log.Error().Err(err).Str("address", params.Address).Msg("Helpers: Invalid Redis dialer")
+		dial = func(context.Context, string, string) (net.Conn, error) { return nil, err }
+	}
+	if dial != nil {
+		opts.Dialer = dial
+	}
+	return redis.NewClient(opts)
+}
+
+// dialTimeout returns the timeout of a backend dial, applying go-redis's default if none is configured.
+func dialTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return 5 * time.Second
+	}
+	return timeout
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+	"gopkg.in/yaml.v2"
+
+	"learn.ratelimiter/config"
+)
+
+// configLoader merges configuration files into one, remembering which file defined each limiter, backend connection
+// and section, so definitions repeated across files are reported with both files.
+type configLoader struct {
+	cfg      ConfigFile
+	limiters map[string]string // Limiter key to the file defining it
+	backends map[string]string // Backend connection name to the file defining it
+	sections map[string]string // Top-level section to the file defining it
+	loaded   map[string]bool   // Absolute paths of the files loaded, so a file included twice is merged once
+}
+
+// readConfig reads the configuration at path: a file and the files it includes, or every *.yaml file of a directory
+// in lexical order. Limiters are expanded from flat_limiters, but not validated.
+func readConfig(path string) (*ConfigFile, error) {
+	l := &configLoader{
+		limiters: make(map[string]string),
+		backends: make(map[string]string),
+		sections: make(map[string]string),
+		loaded:   make(map[string]bool),
+	}
+	if err := l.load(path); err != nil {
+		return nil, err
+	}
+	return &l.cfg, nil
+}
+
+// load merges the file at path, or every *.yaml file of the directory at path.
+func (l *configLoader) load(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("read config file %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return l.loadFile(path)
+	}
+	files, err := filepath.Glob(filepath.Join(path, "*.yaml"))
+	if err != nil {
+		return fmt.Errorf("list config directory %s: %w", path, err)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("config directory %s has no *.yaml file", path)
+	}
+	for _, file := range files {
+		if err := l.loadFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadFile merges the file at path, then the files it includes.
+func (l *configLoader) loadFile(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("resolve config file %s: %w", path, err)
+	}
+	if l.loaded[absPath] {
+		return nil
+	}
+	l.loaded[absPath] = true
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file %s: %w", path, err)
+	}
+	var file ConfigFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("unmarshal config file %s: %w", path, err)
+	}
+	for _, flatCfg := range file.FlatLimiters {
+		file.Limiters = append(file.Limiters, flatCfg.LimiterConfig())
+	}
+	file.FlatLimiters = nil
+	includes := file.Include
+	file.Include = nil
+	if err := l.merge(path, file); err != nil {
+		return err
+	}
+	log.Debug().Str("config_path", path).Int("limiters", len(file.Limiters)).Msg("Helpers: Configuration file merged")
+
+	for _, include := range includes {
+		pattern := include
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid include '%s' in config file %s: %w", include, path, err)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("include '%s' in config file %s matches no file", include, path)
+		}
+		for _, match := range matches {
+			if err := l.load(match); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// merge adds the limiters and backend connections of the file at path to the configuration, and sets the sections
+// it defines. Each limiter key, backend connection name and other section may be defined by one file only.
+func (l *configLoader) merge(path string, file ConfigFile) error {
+	for _, limiterCfg := range file.Limiters {
+		// Empty keys, and keys repeated within a file, are reported by validation
+		if limiterCfg.Key == "" {
+			continue
+		}
+		if other, ok := l.limiters[limiterCfg.Key]; ok && other != path {
+			return fmt.Errorf("limiter '%s' is defined in both %s and %s", limiterCfg.Key, other, path)
+		}
+		l.limiters[limiterCfg.Key] = path
+	}
+	l.cfg.Limiters = append(l.cfg.Limiters, file.Limiters...)
+
+	for name, backend := range file.Backends {
+		if other, ok := l.backends[name]; ok {
+			return fmt.Errorf("backend connection '%s' is defined in both %s and %s", name, other, path)
+		}
+		l.backends[name] = path
+		if l.cfg.Backends == nil {
+			l.cfg.Backends = make(map[string]config.BackendConnectionConfig)
+		}
+		l.cfg.Backends[name] = backend
+	}
+
+	dst := reflect.ValueOf(&l.cfg).Elem()
+	src := reflect.ValueOf(file)
+	for i := 0; i < src.NumField(); i++ {
+		field := src.Type().Field(i)
+		switch field.Name {
+		case "Limiters", "FlatLimiters", "Backends", "Include":
+			continue
+		}
+		if src.Field(i).IsZero() {
+			continue
+		}
+		section, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if other, ok := l.sections[section]; ok {
+			return fmt.Errorf("section '%s' is defined in both %s and %s", section, other, path)
+		}
+		l.sections[section] = path
+		dst.Field(i).Set(src.Field(i))
+	}
+	return nil
+}
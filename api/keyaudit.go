@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/keyaudit"
+)
+
+// AuditKeysFromConfigPath loads configuration from the given path and audits the Redis keyspace of the limiter with
+// the given key (see keyaudit.Run), in the Redis it is configured with.
+func AuditKeysFromConfigPath(ctx context.Context, configPath, limiterKey string, opts keyaudit.Options) (keyaudit.Report, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Key audit failed: Error loading configuration")
+		return keyaudit.Report{}, fmt.Errorf("error loading configuration: %w", err)
+	}
+	var limiterCfg *config.LimiterConfig
+	for i := range cfgFile.Limiters {
+		if cfgFile.Limiters[i].Key == limiterKey {
+			limiterCfg = &cfgFile.Limiters[i]
+			break
+		}
+	}
+	if limiterCfg == nil {
+		return keyaudit.Report{}, fmt.Errorf("limiter '%s' is not configured in %s", limiterKey, configPath)
+	}
+	if limiterCfg.Backend != config.Redis {
+		return keyaudit.Report{}, fmt.Errorf("limiter '%s' uses the %s backend, only redis keyspaces can be audited", limiterKey, limiterCfg.Backend)
+	}
+	client, err := apiinternal.InitRedisClient(limiterCfg)
+	if err != nil {
+		return keyaudit.Report{}, err
+	}
+	defer client.Close()
+	return keyaudit.Run(ctx, client, limiterKey, opts)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/kubernetes"
+	"learn.ratelimiter/peers"
+)
+
+// BackendHealthCheck returns a readiness check reporting whether the backends of the limiters returned with closer by
+// NewLimitersFromConfigPath are reachable (e.g., a Redis PING of every backend connection). Limiters without a remote backend are always ready.
+func BackendHealthCheck(closer io.Closer) kubernetes.Check {
+	c, ok := closer.(*clientCloser)
+	if !ok {
+		return func(ctx context.Context) error { return nil }
+	}
+	return c.backends.Ping
+}
+
+// NewPeerDiscoveryFromConfig returns, if peers.kubernetes is configured, a discovery of node's peers from the Service's
+// EndpointSlices, already watching them in the background. It returns nil if peers are not discovered from Kubernetes.
+// The caller is responsible for closing the discovery.
+func NewPeerDiscoveryFromConfig(cfgFile *ConfigFile, node *peers.Node) (*kubernetes.PeerDiscovery, error) {
+	if cfgFile.Peers == nil || cfgFile.Peers.Kubernetes == nil || node == nil {
+		return nil, nil
+	}
+	client, err := kubernetes.NewInClusterClient()
+	if err != nil {
+		return nil, fmt.Errorf("peer discovery: %w", err)
+	}
+	discovery := kubernetes.NewPeerDiscovery(client, *cfgFile.Peers.Kubernetes, node.SetPeers)
+	discovery.Start()
+	return discovery, nil
+}
+
+// NewPeerDiscoveryFromConfigPath loads configuration from the given path and calls NewPeerDiscoveryFromConfig with it.
+func NewPeerDiscoveryFromConfigPath(configPath string, node *peers.Node) (*kubernetes.PeerDiscovery, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Peer discovery initialization failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewPeerDiscoveryFromConfig(cfgFile, node)
+}
@@ -0,0 +1,47 @@
+package api_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"learn.ratelimiter/api"
+)
+
+// TestLeakyBucketFromConfig tests that leaky bucket limiters are created from the configuration, and that their
+// parameters are validated.
+func TestLeakyBucketFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `limiters:
+  - key: "queue"
+    algorithm: "leaky_bucket"
+    backend: "in_memory"
+    leaky_bucket_params:
+      rate: 1
+      capacity: 2
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	limiters, _, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+
+	ctx := context.Background()
+	for i, want := range []bool{true, true, false} {
+		if allowed, err := limiters["queue"].Allow(ctx, "client1"); allowed != want || err != nil {
+			t.Errorf("Request %d: expected (%v, nil), got (%v, %v)", i+1, want, allowed, err)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(strings.Replace(data, "rate: 1", "rate: 0", 1)), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, _, _, err := api.NewLimitersFromConfigPath(path); err == nil || !strings.Contains(err.Error(), "rate must be a positive integer") {
+		t.Errorf("Expected a leaky bucket without rate to be rejected, got %v", err)
+	}
+}
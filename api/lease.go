@@ -0,0 +1,33 @@
+package api
+
+import (
+	"io"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	tblease "learn.ratelimiter/internal/tokenbucket/lease"
+	"learn.ratelimiter/types"
+)
+
+// withLease serves limiter's tokens from local leases if cfg configures them, returning the leasing limiter as the closer
+// that returns unused tokens. It returns limiter and a nil closer otherwise.
+func withLease(cfg config.LimiterConfig, limiter types.Limiter) (types.Limiter, io.Closer) {
+	if cfg.TokenBucketParams == nil || cfg.TokenBucketParams.Lease == nil {
+		return limiter, nil
+	}
+	source, ok := limiter.(tblease.Source)
+	if !ok {
+		log.Warn().Str("limiter_key", cfg.Key).Msg("API: Limiter does not support leases, serving requests from the backend")
+		return limiter, nil
+	}
+	leaseCfg := cfg.TokenBucketParams.Lease
+	ttl := leaseCfg.TTL
+	if ttl == 0 {
+		ttl = config.DefaultLeaseTTL
+	}
+	leased := tblease.NewLimiter(cfg.Key, source, leaseCfg.Size, ttl,
+		tblease.WithStalenessBudget(leaseCfg.StalenessBudget),
+		tblease.WithWarmStart(leaseCfg.WarmIdentifiers...))
+	return leased, leased
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/middleware"
+	"learn.ratelimiter/types"
+)
+
+// HelperLimiterKey is the limiter key LimitHTTP records metrics and logs under, as the helpers don't know the limiter's configuration key.
+const HelperLimiterKey = "default"
+
+// LimitHTTP wraps handler so each request is checked against limiter using the identifier returned by keyFn.
+// Rate limited requests are answered with 429 Too Many Requests, and requests without an identifier or failing the check with 500.
+// It is a shortcut for middleware.NewRateLimitMiddleware; use the middleware directly to set the limiter key, ban list or other options.
+func LimitHTTP(limiter types.Limiter, keyFn func(*http.Request) string, handler http.Handler) http.Handler {
+	m := middleware.NewRateLimitMiddleware(limiter, metrics.NewRateLimitMetrics(), HelperLimiterKey, "")
+	return m.Handle(handler.ServeHTTP, keyFn)
+}
+
+// LimitFunc calls fn if limiter allows a request for key, and returns its error.
+// It returns types.ErrRateLimited without calling fn if the request is denied, and the limiter's error if the check fails.
+func LimitFunc(limiter types.Limiter, key string, fn func() error) error {
+	allowed, err := limiter.Allow(context.Background(), key)
+	if err != nil {
+		return fmt.Errorf("rate limit check for '%s' failed: %w", key, err)
+	}
+	if !allowed {
+		return types.ErrRateLimited
+	}
+	return fn()
+}
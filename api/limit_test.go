@@ -0,0 +1,52 @@
+package api_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"learn.ratelimiter/api"
+	tbinmemory "learn.ratelimiter/internal/tokenbucket/inmemory"
+	"learn.ratelimiter/types"
+)
+
+// TestLimitHTTP tests that the one-line HTTP helper rejects requests beyond the limit with 429.
+func TestLimitHTTP(t *testing.T) {
+	handler := api.LimitHTTP(tbinmemory.NewLimiter("test-limit-http", 1, 2, 0), func(r *http.Request) string {
+		return r.Header.Get("X-User")
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	codes := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User", "alice")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != http.StatusNoContent || codes[1] != http.StatusNoContent || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("Expected two requests passed and the third limited, got %v", codes)
+	}
+}
+
+// TestLimitFunc tests that the function helper runs the call only when allowed and reports denials with ErrRateLimited.
+func TestLimitFunc(t *testing.T) {
+	limiter := tbinmemory.NewLimiter("test-limit-func", 1, 1, 0)
+	calls := 0
+	fn := func() error {
+		calls++
+		return nil
+	}
+	if err := api.LimitFunc(limiter, "job", fn); err != nil {
+		t.Fatalf("Expected first call to run, got %v", err)
+	}
+	if err := api.LimitFunc(limiter, "job", fn); !errors.Is(err, types.ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected fn to run once, ran %d times", calls)
+	}
+}
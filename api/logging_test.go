@@ -0,0 +1,35 @@
+package api_test
+
+import (
+	"testing"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/redact"
+)
+
+// TestHashKeyEnv tests that logging.hash_key_env sets the key identifiers are hashed with, and must be set.
+func TestHashKeyEnv(t *testing.T) {
+	defer redact.SetMode(config.IdentifierLogFull)
+	defer redact.SetHashKey(nil)
+	path := writeConfig(t, endpointTestLimiters+`
+logging:
+  identifiers: hashed
+  hash_key_env: TEST_RATELIMITER_HASH_KEY
+`)
+
+	t.Setenv("TEST_RATELIMITER_HASH_KEY", "")
+	if _, _, _, err := api.NewLimitersFromConfigPath(path); err == nil {
+		t.Error("Expected an error with the hash key environment variable unset")
+	}
+
+	t.Setenv("TEST_RATELIMITER_HASH_KEY", "shared-secret")
+	_, _, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+	if got, want := redact.Hash("203.0.113.7"), "6e6efea5a04f4dc1"; got != want {
+		t.Errorf("Expected identifiers hashed with the configured key, %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,77 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/readonly"
+)
+
+// TestMaxKeysEviction tests that identifiers evicted by the key cap start with a fresh budget through every decorator
+// a configuration can wrap around the limiter.
+func TestMaxKeysEviction(t *testing.T) {
+	decorators := `
+    max_keys:
+      limit: 1
+      policy: "evict"
+    stats:
+      window: 1m
+    history:
+      size: 5
+    unique_identifiers:
+      interval: 1m
+    identifier_limit:
+      max_length: 64
+`
+	for _, tc := range []struct {
+		name   string
+		config string
+	}{
+		{"window", `
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 1` + decorators},
+		{"regional", `
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 2
+    regional_budget:
+      region: "eu"
+      shares:
+        us: 50
+        eu: 50` + decorators},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			limiters, _, closer, err := api.NewLimitersFromConfigPath(writeConfig(t, tc.config), api.WithReadOnly(readonly.New()))
+			if err != nil {
+				t.Fatalf("Failed to create limiters: %v", err)
+			}
+			defer closer.Close()
+			limiter := limiters["api"]
+			ctx := context.Background()
+
+			if allowed, err := limiter.Allow(ctx, "client1"); err != nil || !allowed {
+				t.Fatalf("Expected the first request allowed, got %v, %v", allowed, err)
+			}
+			if allowed, _ := limiter.Allow(ctx, "client1"); allowed {
+				t.Fatal("Expected the second request denied by the limit of 1")
+			}
+			// client2 evicts client1, and client1 then evicts client2
+			if allowed, err := limiter.Allow(ctx, "client2"); err != nil || !allowed {
+				t.Fatalf("Expected client2 allowed, got %v, %v", allowed, err)
+			}
+			if allowed, err := limiter.Allow(ctx, "client1"); err != nil || !allowed {
+				t.Errorf("Expected the evicted client1 to start with a fresh budget, got %v, %v", allowed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"fmt"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/connregistry"
+	"learn.ratelimiter/internal/migration"
+	"learn.ratelimiter/types"
+)
+
+// withMigration checks limiter's requests against the backend cfg migrates it to too, if any. The decisions of the
+// target backend are enforced once cfg cuts over to it. Overrides and write budgets are applied to the limiter's own
+// backend only, so only the base limits are migrated.
+func withMigration(backends *connregistry.Registry, policy config.StartupPolicy, limiterFactory LimiterFactory, cfg config.LimiterConfig, limiter types.Limiter) (types.Limiter, error) {
+	targetCfg, ok := cfg.MigrationTargetConfig()
+	if !ok {
+		return limiter, nil
+	}
+	targetClients, err := limiterClients(backends, policy, targetCfg)
+	if err != nil {
+		return nil, fmt.Errorf("limiter '%s': failed to initialize migration target client: %w", cfg.Key, err)
+	}
+	target, err := limiterFactory.CreateLimiter(targetCfg, targetClients)
+	if err != nil {
+		return nil, fmt.Errorf("limiter '%s': failed to create migration target: %w", cfg.Key, err)
+	}
+	if cfg.Migration.Cutover {
+		return migration.NewLimiter(cfg.Key, target, limiter), nil
+	}
+	return migration.NewLimiter(cfg.Key, limiter, target), nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/mirror"
+)
+
+// NewMirrorFromConfig returns the denied request mirror cfgFile describes, already running, or nil if mirroring is not
+// configured. The caller must Close the mirror to flush buffered requests.
+func NewMirrorFromConfig(cfgFile *ConfigFile) (*mirror.Mirror, error) {
+	mirrorCfg := cfgFile.Mirror
+	if mirrorCfg == nil {
+		return nil, nil
+	}
+
+	var writer mirror.Writer
+	switch mirrorCfg.Sink {
+	case config.MirrorSinkHTTP:
+		log.Info().Str("url", mirrorCfg.URL).Msg("API: Creating HTTP mirror sink")
+		timeout := mirrorCfg.Timeout
+		if timeout <= 0 {
+			timeout = config.DefaultMirrorTimeout
+		}
+		writer = mirror.NewHTTPWriter(mirrorCfg.URL, timeout)
+	case config.MirrorSinkFile:
+		log.Info().Str("path", mirrorCfg.Path).Msg("API: Creating file mirror sink")
+		fileWriter, err := mirror.NewFileWriter(mirrorCfg.Path)
+		if err != nil {
+			return nil, fmt.Errorf("mirror: %w", err)
+		}
+		writer = fileWriter
+	case config.MirrorSinkStdout:
+		log.Info().Msg("API: Creating standard output mirror sink")
+		writer = mirror.NewStreamWriter(os.Stdout, "stdout")
+	}
+
+	opts := []mirror.Option{
+		mirror.WithSampleRate(mirrorCfg.SampleRate),
+		mirror.WithBatching(mirrorCfg.BatchSize, mirrorCfg.FlushInterval),
+		mirror.WithRedactors(mirror.RedactHeaders(mirrorCfg.RedactHeaders...)),
+	}
+	if mirrorCfg.IncludeBody {
+		opts = append(opts, mirror.WithBody(mirrorCfg.MaxBodyBytes))
+	}
+	if mirrorCfg.RedactIdentifiers {
+		opts = append(opts, mirror.WithRedactors(mirror.RedactIdentifiers()))
+	}
+	return mirror.New(writer, mirrorCfg.BufferSize, opts...), nil
+}
+
+// NewMirrorFromConfigPath loads configuration from the given path and calls NewMirrorFromConfig with it.
+func NewMirrorFromConfigPath(configPath string) (*mirror.Mirror, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Mirror initialization failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewMirrorFromConfig(cfgFile)
+}
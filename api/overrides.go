@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/faults"
+	"learn.ratelimiter/internal/override"
+	"learn.ratelimiter/overrides"
+	"learn.ratelimiter/peers"
+	"learn.ratelimiter/readonly"
+	"learn.ratelimiter/types"
+)
+
+// limiterOptions holds the optional behaviour of limiters created from a configuration file.
+type limiterOptions struct {
+	overrides *overrides.Table
+	peers     *peers.Node
+	readOnly  *readonly.Switch
+	faults    *faults.Injector
+}
+
+// LimiterOption configures optional behaviour of the limiters created by NewLimitersFromConfigPath and NewReloader.
+type LimiterOption func(*limiterOptions)
+
+// WithOverrides applies the per-identifier overrides in table to the limiters. Limiters with a regional budget ignore overrides.
+func WithOverrides(table *overrides.Table) LimiterOption {
+	return func(o *limiterOptions) {
+		o.overrides = table
+	}
+}
+
+// newLimiterOptions applies the options.
+func newLimiterOptions(opts []LimiterOption) limiterOptions {
+	var options limiterOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// withOverrides wraps the limiter created for cfg so identifiers with an override use scaled parameters, if overrides are enabled.
+func (o limiterOptions) withOverrides(limiterFactory LimiterFactory, cfg config.LimiterConfig, backendClients types.BackendClients, limiter types.Limiter) types.Limiter {
+	if o.overrides == nil {
+		return limiter
+	}
+	return override.NewLimiter(cfg.Key, limiter, o.overrides, func(multiplier float64) (types.Limiter, error) {
+		return newLimiter(limiterFactory, cfg.OverrideConfig(multiplier), backendClients)
+	})
+}
+
+// NewOverrideTableFromConfig creates the table of per-identifier overrides in the store configured under overrides (in
+// memory if none is configured), already loaded and refreshing in the background. The caller is responsible for closing
+// the table.
+func NewOverrideTableFromConfig(cfgFile *ConfigFile) (*overrides.Table, error) {
+	overridesCfg := config.OverridesConfig{}
+	if cfgFile.Overrides != nil {
+		overridesCfg = *cfgFile.Overrides
+	}
+	refreshInterval := overridesCfg.RefreshInterval
+	if refreshInterval <= 0 {
+		refreshInterval = config.DefaultOverrideRefreshInterval
+	}
+
+	var store overrides.Store
+	switch overridesCfg.Store {
+	case config.OverrideStoreRedis:
+		log.Info().Str("address", overridesCfg.RedisParams.Address).Msg("API: Creating Redis override store")
+		client, err := apiinternal.InitRedisClient(&config.LimiterConfig{RedisParams: overridesCfg.RedisParams})
+		if err != nil {
+			return nil, fmt.Errorf("override store: %w", err)
+		}
+		store = overrides.NewRedisStore(client)
+	default:
+		log.Info().Msg("API: Creating in-memory override store")
+		store = overrides.NewMemoryStore()
+	}
+
+	table := overrides.NewTable(store, refreshInterval)
+	table.Start()
+	return table, nil
+}
+
+// NewOverrideTableFromConfigPath loads configuration from the given path and calls NewOverrideTableFromConfig with it.
+func NewOverrideTableFromConfigPath(configPath string) (*overrides.Table, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Override initialization failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewOverrideTableFromConfig(cfgFile)
+}
@@ -0,0 +1,49 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/overrides"
+)
+
+// TestOverrides tests that an identifier with an override is limited by the scaled parameters until the override is removed.
+func TestOverrides(t *testing.T) {
+	path := writeConfig(t, `
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 2
+`)
+	table, err := api.NewOverrideTableFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create override table: %v", err)
+	}
+	defer table.Close()
+	limiters, _, closer, err := api.NewLimitersFromConfigPath(path, api.WithOverrides(table))
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+
+	ctx := context.Background()
+	if _, _, err := table.Set(ctx, overrides.Override{LimiterKey: "api", Identifier: "customer-x", Multiplier: 5, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("Failed to set override: %v", err)
+	}
+	if allowed := countAllowed(limiters["api"], "customer-x", 20); allowed != 10 {
+		t.Errorf("Expected 10 requests allowed with a 5x override, got %d", allowed)
+	}
+	if allowed := countAllowed(limiters["api"], "customer-y", 20); allowed != 2 {
+		t.Errorf("Expected 2 requests allowed without an override, got %d", allowed)
+	}
+
+	table.Delete(ctx, "api", "customer-x")
+	if allowed := countAllowed(limiters["api"], "customer-x", 20); allowed != 2 {
+		t.Errorf("Expected the base limit of 2 once the override is removed, got %d", allowed)
+	}
+}
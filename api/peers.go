@@ -0,0 +1,56 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/peers"
+	"learn.ratelimiter/types"
+)
+
+// WithPeers shares the in-memory limiters between the instances of node's peer group: each check is decided by the
+// instance owning its limiter key and identifier. Limiters with another backend or a regional budget are not shared.
+func WithPeers(node *peers.Node) LimiterOption {
+	return func(o *limiterOptions) {
+		o.peers = node
+	}
+}
+
+// withPeers returns a limiter routing the checks of the limiter created for cfg through the peer group, and the
+// limiter deciding the checks this instance owns, to be registered with the node; or limiter and nil if peer mode
+// is not enabled for cfg.
+func (o limiterOptions) withPeers(cfg config.LimiterConfig, limiter types.Limiter) (types.Limiter, types.Limiter) {
+	if o.peers == nil || cfg.Backend != config.InMemory {
+		return limiter, nil
+	}
+	return o.peers.Limiter(cfg.Key), limiter
+}
+
+// NewPeerNodeFromConfig returns the peer group member for this instance described under peers, or nil if peer mode is
+// not configured. Serve the node at peers.Path so peers can forward checks to it, and pass it to
+// NewLimitersFromConfig and NewReloader with WithPeers.
+func NewPeerNodeFromConfig(cfgFile *ConfigFile) (*peers.Node, error) {
+	if cfgFile.Peers == nil {
+		return nil, nil
+	}
+	if cfgFile.Peers.LocalAddress() == "" {
+		return nil, fmt.Errorf("peers.self is required, or set %s", config.PeerSelfEnv)
+	}
+	if cfgFile.Peers.Secret() == "" {
+		return nil, fmt.Errorf("peers.secret_env: environment variable '%s' is not set", cfgFile.Peers.SecretEnv)
+	}
+	return peers.NewNode(*cfgFile.Peers), nil
+}
+
+// NewPeerNodeFromConfigPath loads configuration from the given path and calls NewPeerNodeFromConfig with it.
+func NewPeerNodeFromConfigPath(configPath string) (*peers.Node, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Peer initialization failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewPeerNodeFromConfig(cfgFile)
+}
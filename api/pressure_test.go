@@ -0,0 +1,53 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/types"
+)
+
+// TestPressure tests that the pressure of an identifier is reported through the decorators wrapping a configured limiter.
+func TestPressure(t *testing.T) {
+	path := writeConfig(t, `
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 4
+    identifier_limit:
+      max_length: 32
+`)
+	limiters, _, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+
+	ctx := context.Background()
+	long := strings.Repeat("x", 100)
+	for _, identifier := range []string{"user1", long} {
+		countAllowed(limiters["api"], identifier, 2)
+		pressure, err := types.Pressure(ctx, limiters["api"], identifier)
+		if err != nil {
+			t.Fatalf("Pressure returned error: %v", err)
+		}
+		if pressure != 0.5 {
+			t.Errorf("Expected pressure 0.5 after 2 of 4 requests, got %v", pressure)
+		}
+	}
+
+	if _, err := types.Pressure(ctx, allowAll{}, "user1"); !errors.Is(err, types.ErrPressureUnsupported) {
+		t.Errorf("Expected ErrPressureUnsupported, got %v", err)
+	}
+}
+
+// allowAll is a limiter that cannot tell its pressure.
+type allowAll struct{}
+
+func (allowAll) Allow(context.Context, string) (bool, error) { return true, nil }
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/readonlymode"
+	"learn.ratelimiter/readonly"
+	"learn.ratelimiter/types"
+)
+
+// WithReadOnly answers the checks of the limiters the switch puts in read-only mode without writing to their backends.
+func WithReadOnly(sw *readonly.Switch) LimiterOption {
+	return func(o *limiterOptions) {
+		o.readOnly = sw
+	}
+}
+
+// withReadOnly wraps the limiter created for cfg so it follows the read-only switch, if one is set. It wraps the
+// decorators writing to the backend themselves (e.g., max_keys with Redis), so none of them runs in read-only mode.
+func (o limiterOptions) withReadOnly(cfg config.LimiterConfig, limiter types.Limiter) types.Limiter {
+	if o.readOnly == nil {
+		return limiter
+	}
+	return readonlymode.NewLimiter(cfg.Key, limiter, o.readOnly)
+}
+
+// NewReadOnlySwitchFromConfig creates the read-only switch, with the limiters listed under read_only in read-only mode.
+// Pass it to NewLimitersFromConfig and NewReloader with WithReadOnly, and to the admin API with admin.WithReadOnly.
+// The caller is responsible for closing the switch.
+func NewReadOnlySwitchFromConfig(cfgFile *ConfigFile) (*readonly.Switch, error) {
+	sw := readonly.New()
+	readOnlyCfg := cfgFile.ReadOnly
+	if readOnlyCfg == nil {
+		return sw, nil
+	}
+	var expiresAt time.Time
+	if readOnlyCfg.Duration > 0 {
+		expiresAt = time.Now().Add(readOnlyCfg.Duration).UTC()
+	}
+	keys := readOnlyCfg.Limiters
+	if readOnlyCfg.All {
+		keys = []string{readonly.Global}
+	}
+	for _, key := range keys {
+		sw.Set(readonly.Entry{LimiterKey: key, ExpiresAt: expiresAt, Reason: readOnlyCfg.Reason})
+	}
+	return sw, nil
+}
+
+// NewReadOnlySwitchFromConfigPath loads configuration from the given path and calls NewReadOnlySwitchFromConfig with it.
+func NewReadOnlySwitchFromConfigPath(configPath string) (*readonly.Switch, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Read-only switch initialization failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	return NewReadOnlySwitchFromConfig(cfgFile)
+}
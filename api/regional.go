@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/regional"
+	"learn.ratelimiter/types"
+)
+
+// newRegionalLimiter creates a limiter enforcing the local region's share of cfg's budget and, if reconciliation is configured,
+// a reconciler (not yet started) rebalancing it. Closing the reconciler closes its Redis client.
+func newRegionalLimiter(limiterFactory LimiterFactory, cfg config.LimiterConfig, backendClients types.BackendClients) (*regional.Limiter, *regional.Reconciler, error) {
+	regionalCfg := cfg.RegionalBudget
+	region := regionalCfg.LocalRegion()
+	if region == "" {
+		return nil, nil, fmt.Errorf("no region configured: set regional_budget.region or the %s environment variable", config.RegionEnv)
+	}
+	if _, ok := regionalCfg.Shares[region]; !ok {
+		return nil, nil, fmt.Errorf("region '%s' has no share in regional_budget.shares", region)
+	}
+
+	// Shares are configured as percentages
+	shares := make(map[string]float64, len(regionalCfg.Shares))
+	for name, percent := range regionalCfg.Shares {
+		shares[name] = percent / 100
+	}
+
+	limiter, err := regional.NewLimiter(cfg.Key, region, shares[region], func(share float64) (types.Limiter, error) {
+		return newLimiter(limiterFactory, cfg.RegionalConfig(region, share), backendClients)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if regionalCfg.Reconcile == nil {
+		return limiter, nil, nil
+	}
+
+	interval := regionalCfg.Reconcile.Interval
+	if interval <= 0 {
+		interval = config.DefaultReconcileInterval
+	}
+	client, err := apiinternal.InitRedisClient(&config.LimiterConfig{RedisParams: regionalCfg.Reconcile.RedisParams})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to the reconciliation store: %w", err)
+	}
+	store := regional.NewRedisStore(client, 10*interval)
+	reconciler := regional.NewReconciler(limiter, cfg.Key, shares, cfg.RatePerSecond(), interval, store)
+	return limiter, reconciler, nil
+}
@@ -0,0 +1,72 @@
+package api_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/config"
+)
+
+// TestRegionalBudget tests that a limiter with a regional budget enforces the local region's share.
+func TestRegionalBudget(t *testing.T) {
+	path := writeConfig(t, `
+limiters:
+  - key: "api"
+    algorithm: "token_bucket"
+    backend: "in_memory"
+    token_bucket_params:
+      rate: 10
+      capacity: 100
+    regional_budget:
+      region: "eu"
+      shares:
+        us: 60
+        eu: 30
+        ap: 10
+`)
+	limiters, _, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		if ok, _ := limiters["api"].Allow(context.Background(), "client1"); ok {
+			allowed++
+		}
+	}
+	if allowed != 30 {
+		t.Errorf("Expected 30 requests allowed for a 30%% share of capacity 100, got %d", allowed)
+	}
+}
+
+// TestRegionalBudgetRegionFromEnv tests that the local region falls back to the environment and must have a share.
+func TestRegionalBudgetRegionFromEnv(t *testing.T) {
+	path := writeConfig(t, `
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 100
+    regional_budget:
+      shares:
+        us: 50
+        eu: 50
+`)
+	t.Setenv(config.RegionEnv, "us")
+	if _, _, closer, err := api.NewLimitersFromConfigPath(path); err != nil {
+		t.Fatalf("Failed to create limiters with region from environment: %v", err)
+	} else {
+		closer.Close()
+	}
+
+	t.Setenv(config.RegionEnv, "ap")
+	if _, _, _, err := api.NewLimitersFromConfigPath(path); err == nil || !strings.Contains(err.Error(), "no share") {
+		t.Errorf("Expected error for a region without a share, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/rekey"
+)
+
+// RekeyFromConfigPath loads configuration from the given path and moves the Redis state of the limiter key from to the
+// limiter key to (see rekey.Run), in the Redis of the limiter configured under to, or under from if to is not configured yet.
+func RekeyFromConfigPath(ctx context.Context, configPath, from, to string, opts rekey.Options) (rekey.Report, error) {
+	cfgFile, err := apiinternal.LoadConfig(configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", configPath).Msg("API: Rekey failed: Error loading configuration")
+		return rekey.Report{}, fmt.Errorf("error loading configuration: %w", err)
+	}
+	var limiterCfg *config.LimiterConfig
+	for _, key := range []string{to, from} {
+		for i := range cfgFile.Limiters {
+			if cfgFile.Limiters[i].Key == key {
+				limiterCfg = &cfgFile.Limiters[i]
+				break
+			}
+		}
+		if limiterCfg != nil {
+			break
+		}
+	}
+	if limiterCfg == nil {
+		return rekey.Report{}, fmt.Errorf("neither limiter '%s' nor '%s' is configured in %s", to, from, configPath)
+	}
+	if limiterCfg.Backend != config.Redis {
+		return rekey.Report{}, fmt.Errorf("limiter '%s' uses the %s backend, only redis state can be moved", limiterCfg.Key, limiterCfg.Backend)
+	}
+	client, err := apiinternal.InitRedisClient(limiterCfg)
+	if err != nil {
+		return rekey.Report{}, err
+	}
+	defer client.Close()
+	return rekey.Run(ctx, client, from, to, opts)
+}
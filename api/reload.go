@@ -0,0 +1,243 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	apiinternal "learn.ratelimiter/api/internal"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/connregistry"
+	"learn.ratelimiter/internal/hotswap"
+	"learn.ratelimiter/limitlog"
+	"learn.ratelimiter/types"
+)
+
+// Reloader re-reads a configuration file and replaces running limiters whose configuration changed,
+// including their algorithm, without changing the limiters handed out by NewLimitersFromConfigPath.
+// Middleware and metrics bound to a limiter key keep working across reloads.
+//
+// Only keys that existed when the limiters were created are reloaded; added keys are logged and ignored, since
+// nothing is bound to them. Removed keys keep running until restart, unless the configuration's draining section
+// drains and then releases them (see config.DrainingConfig); a reload configuring a removed key again restores it.
+// Members of budget groups follow the limiter of their group; changes to the groups apply on restart.
+// Limiters with a regional budget (before or after the reload) are not reloaded, as their reconciliation runs
+// in the background for the lifetime of the process.
+type Reloader struct {
+	configPath string
+	limiters   map[string]*hotswap.Limiter
+	configs    map[string]config.LimiterConfig
+	options    limiterOptions
+
+	// backends holds the clients created by reloads, used by every limiter created by reloads.
+	backends *connregistry.Registry
+	// leases holds the closers of token leases created by reloads, by limiter key.
+	leases map[string]io.Closer
+	// draining holds the limiters removed from the configuration and not released yet, by limiter key.
+	// Released limiters have no configuration in configs.
+	draining map[string]*drain
+	mu       sync.Mutex
+}
+
+// NewReloader creates a reloader for the limiters and configurations returned by NewLimitersFromConfigPath for configPath.
+// The options should match those the limiters were created with.
+func NewReloader(configPath string, limiters map[string]types.Limiter, configs map[string]config.LimiterConfig, opts ...LimiterOption) *Reloader {
+	options := newLimiterOptions(opts)
+	r := &Reloader{
+		configPath: configPath,
+		limiters:   make(map[string]*hotswap.Limiter),
+		configs:    make(map[string]config.LimiterConfig),
+		options:    options,
+		leases:     make(map[string]io.Closer),
+		draining:   make(map[string]*drain),
+		backends:   newBackendRegistry(options.faults),
+	}
+	for key, limiter := range limiters {
+		if cfg, ok := configs[key]; ok && cfg.Key != key {
+			// Members of a budget group share their group's limiter, which is reloaded under its own key
+			continue
+		}
+		swappable, ok := limiter.(*hotswap.Limiter)
+		if !ok {
+			log.Warn().Str("limiter_key", key).Msg("API: Limiter was not created by NewLimitersFromConfigPath and will not be reloaded")
+			continue
+		}
+		r.limiters[key] = swappable
+		r.configs[key] = configs[key]
+	}
+	return r
+}
+
+// Reload loads the configuration file and swaps in a new limiter for every key whose configuration changed,
+// carrying state over as set by the limiter's state_transition. It returns the keys that were reloaded.
+// If the configuration is invalid or any limiter fails to be created, no limiter is replaced.
+func (r *Reloader) Reload() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log.Info().Str("config_path", r.configPath).Msg("API: Reloading limiter configuration")
+	cfgFile, err := apiinternal.LoadConfig(r.configPath)
+	if err != nil {
+		log.Error().Err(err).Str("config_path", r.configPath).Msg("API: Reload failed: Error loading configuration")
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+
+	if err := configureRedaction(cfgFile.Logging); err != nil {
+		log.Error().Err(err).Str("config_path", r.configPath).Msg("API: Reload failed: Error configuring identifier redaction")
+		return nil, err
+	}
+	limitlog.Configure(cfgFile.Limiters)
+
+	type replacement struct {
+		cfg     config.LimiterConfig
+		limiter types.Limiter
+		lease   io.Closer
+		// pressure stops watching the evictions of the limiter's keys once a later swap retires it.
+		pressure io.Closer
+		// local decides the checks this instance owns in peer mode, registered with the node once the reload succeeds.
+		local types.Limiter
+	}
+	var replacements []replacement
+	// fail returns the unused tokens of leases created by this reload and stops its eviction watches before reporting err
+	fail := func(err error) ([]string, error) {
+		for _, repl := range replacements {
+			if repl.lease != nil {
+				repl.lease.Close()
+			}
+			if repl.pressure != nil {
+				repl.pressure.Close()
+			}
+		}
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	// restored are the draining limiters configured again unchanged, which keep running as they are
+	var restored []string
+	for _, cfg := range cfgFile.Limiters {
+		seen[cfg.Key] = true
+		if _, ok := r.limiters[cfg.Key]; !ok {
+			log.Warn().Str("limiter_key", cfg.Key).Msg("API: Ignoring limiter added by reload, restart to use it")
+			continue
+		}
+		// Released limiters, without a configuration, and draining ones allowing every request are created again
+		previous, configured := r.configs[cfg.Key]
+		d, draining := r.draining[cfg.Key]
+		if configured && reflect.DeepEqual(previous, cfg) && !(draining && d.allowing) {
+			if draining {
+				restored = append(restored, cfg.Key)
+			}
+			continue
+		}
+		if previous.RegionalBudget != nil || cfg.RegionalBudget != nil {
+			log.Warn().Str("limiter_key", cfg.Key).Msg("API: Ignoring change to limiter with a regional budget, restart to apply it")
+			continue
+		}
+
+		limiterFactory, err := NewLimiterFactory(cfg)
+		if err != nil {
+			return fail(fmt.Errorf("limiter '%s': failed to get factory: %w", cfg.Key, err))
+		}
+		backendClients, err := limiterClients(r.backends, cfgFile.StartupPolicy, cfg)
+		if err != nil {
+			return fail(err)
+		}
+		limiter, err := newLimiter(limiterFactory, cfg, backendClients)
+		if err != nil {
+			log.Error().Err(err).Str("limiter_key", cfg.Key).Msg("API: Reload failed: Failed to create instance")
+			return fail(err)
+		}
+		limiter, err = withMigration(r.backends, cfgFile.StartupPolicy, limiterFactory, cfg, limiter)
+		if err != nil {
+			log.Error().Err(err).Str("limiter_key", cfg.Key).Msg("API: Reload failed: Failed to create migration target")
+			return fail(err)
+		}
+		limiter, leaseCloser := withLease(cfg, limiter)
+		limiter = r.options.withOverrides(limiterFactory, cfg, backendClients, limiter)
+		limiter, local := r.options.withPeers(cfg, limiter)
+		limiter, pressure := withMemoryPressure(cfg, backendClients, limiter)
+		limiter = withFailOpen(cfgFile.StartupPolicy, cfg, limiter)
+		limiter = withBulkhead(cfg, limiter)
+		limiter = withStats(cfg, limiter)
+		limiter = withHistory(cfg, limiter)
+		limiter = withMaxKeys(cfg, backendClients, limiter)
+		limiter = withUniqueIdentifiers(cfg, backendClients, limiter)
+		limiter = r.options.withReadOnly(cfg, limiter)
+		limiter = withIdentifierLimit(cfg, limiter)
+		replacements = append(replacements, replacement{cfg: cfg, limiter: limiter, lease: leaseCloser, pressure: pressure, local: local})
+	}
+	var removed []string
+	for key := range r.configs {
+		if !seen[key] {
+			if _, ok := r.draining[key]; !ok {
+				removed = append(removed, key)
+			}
+		}
+	}
+
+	for _, key := range restored {
+		r.stopDrain(key)
+	}
+	for _, key := range removed {
+		switch {
+		case cfgFile.Draining == nil:
+			log.Warn().Str("limiter_key", key).Msg("API: Limiter removed from configuration keeps running until restart")
+		case r.configs[key].RegionalBudget != nil:
+			log.Warn().Str("limiter_key", key).Msg("API: Limiter with a regional budget removed from configuration keeps running until restart")
+		default:
+			r.startDrain(key, *cfgFile.Draining)
+		}
+	}
+	reloaded := make([]string, 0, len(replacements))
+	for _, repl := range replacements {
+		r.stopDrain(repl.cfg.Key)
+		if repl.local != nil {
+			r.options.peers.Register(repl.cfg.Key, repl.local)
+		}
+		r.limiters[repl.cfg.Key].Swap(repl.limiter, repl.pressure, repl.cfg.Algorithm, repl.cfg.StateTransition)
+		// Leases of the replaced limiter created by an earlier reload return their tokens now; those created at startup
+		// are returned as they expire and when the limiters are closed
+		if previous, ok := r.leases[repl.cfg.Key]; ok {
+			previous.Close()
+			delete(r.leases, repl.cfg.Key)
+		}
+		if repl.lease != nil {
+			r.leases[repl.cfg.Key] = repl.lease
+		}
+		r.configs[repl.cfg.Key] = repl.cfg
+		recordLimiterConfig(repl.cfg)
+		reloaded = append(reloaded, repl.cfg.Key)
+	}
+	log.Info().Strs("reloaded", reloaded).Msg("API: Limiter configuration reloaded")
+	return reloaded, nil
+}
+
+// Configs returns a copy of the configuration of every limiter, as applied by the latest reload.
+func (r *Reloader) Configs() map[string]config.LimiterConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	configs := make(map[string]config.LimiterConfig, len(r.configs))
+	for key, cfg := range r.configs {
+		configs[key] = cfg
+	}
+	return configs
+}
+
+// Close returns the unused tokens of leases created by reloads and closes the backend clients created by reloads.
+func (r *Reloader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, lease := range r.leases {
+		if err := lease.Close(); err != nil {
+			log.Error().Err(err).Str("limiter_key", key).Msg("API: Error returning leased tokens")
+		}
+	}
+	clear(r.leases)
+	for _, d := range r.draining {
+		d.timer.Stop()
+	}
+	clear(r.draining)
+	return r.backends.Close()
+}
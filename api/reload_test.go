@@ -0,0 +1,112 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/types"
+)
+
+const reloadFixedWindow = `
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 5
+`
+
+// reloadSlidingWindow switches the "api" limiter to a sliding window with a larger limit.
+const reloadSlidingWindow = `
+limiters:
+  - key: "api"
+    algorithm: "sliding_window_counter"
+    backend: "in_memory"
+    state_transition: "%s"
+    window_params:
+      window: 1m
+      limit: 10
+`
+
+// countAllowed returns how many of n requests for the identifier the limiter allows.
+func countAllowed(limiter types.Limiter, identifier string, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if ok, _ := limiter.Allow(context.Background(), identifier); ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+// TestReloadSwapsAlgorithm tests that a reload changing the algorithm replaces the limiter behind the same key,
+// starting fresh or converting the used budget depending on the state transition.
+func TestReloadSwapsAlgorithm(t *testing.T) {
+	tests := []struct {
+		transition string
+		expected   int
+	}{
+		{transition: "fresh", expected: 10},
+		// 3 of 5 requests used before the reload are converted to 6 of 10
+		{transition: "convert", expected: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.transition, func(t *testing.T) {
+			path := writeConfig(t, reloadFixedWindow)
+			limiters, configs, closer, err := api.NewLimitersFromConfigPath(path)
+			if err != nil {
+				t.Fatalf("Failed to create limiters: %v", err)
+			}
+			defer closer.Close()
+			reloader := api.NewReloader(path, limiters, configs)
+			defer reloader.Close()
+
+			limiter := limiters["api"]
+			if allowed := countAllowed(limiter, "client1", 3); allowed != 3 {
+				t.Fatalf("Expected 3 requests allowed before reload, got %d", allowed)
+			}
+
+			if err := os.WriteFile(path, []byte(fmt.Sprintf(reloadSlidingWindow, tt.transition)), 0o600); err != nil {
+				t.Fatalf("Failed to rewrite config: %v", err)
+			}
+			reloaded, err := reloader.Reload()
+			if err != nil {
+				t.Fatalf("Reload failed: %v", err)
+			}
+			if len(reloaded) != 1 || reloaded[0] != "api" {
+				t.Fatalf("Expected limiter 'api' to be reloaded, got %v", reloaded)
+			}
+
+			// The limiter handed out before the reload now enforces the new configuration
+			if allowed := countAllowed(limiter, "client1", 20); allowed != tt.expected {
+				t.Errorf("Expected %d requests allowed after reload, got %d", tt.expected, allowed)
+			}
+		})
+	}
+}
+
+// TestReloadKeepsLimitersOnError tests that an invalid configuration leaves the running limiters untouched.
+func TestReloadKeepsLimitersOnError(t *testing.T) {
+	path := writeConfig(t, reloadFixedWindow)
+	limiters, configs, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+	reloader := api.NewReloader(path, limiters, configs)
+	defer reloader.Close()
+
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(reloadSlidingWindow, "replay")), 0o600); err != nil {
+		t.Fatalf("Failed to rewrite config: %v", err)
+	}
+	if _, err := reloader.Reload(); err == nil {
+		t.Fatal("Expected reload with an unsupported state transition to fail")
+	}
+	if allowed := countAllowed(limiters["api"], "client1", 10); allowed != 5 {
+		t.Errorf("Expected the fixed window limit of 5 to still apply, got %d allowed", allowed)
+	}
+}
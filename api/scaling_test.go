@@ -0,0 +1,156 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/testenv"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/middleware"
+	"learn.ratelimiter/peers"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testenv.Cleanup()
+	os.Exit(code)
+}
+
+// scalingMetrics is shared by the instances of the scaling tests, since metrics register globally.
+var scalingMetrics = metrics.NewRateLimitMetrics()
+
+// scalingInstances is the number of application instances the scaling tests run.
+const scalingInstances = 3
+
+// startInstance serves the limiter "api" of the configuration at path behind the rate limiting middleware,
+// as the example server does, on server. mux may already hold other routes, e.g., the peer endpoint.
+func startInstance(t *testing.T, path string, server *httptest.Server, mux *http.ServeMux, opts ...api.LimiterOption) {
+	t.Helper()
+	limiters, configs, closer, err := api.NewLimitersFromConfigPath(path, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	t.Cleanup(func() { closer.Close() })
+	rl := middleware.NewRateLimitMiddleware(limiters["api"], scalingMetrics, "api", configs["api"].Algorithm)
+	mux.HandleFunc("/", rl.Handle(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, func(r *http.Request) string {
+		return r.Header.Get("X-Client-ID")
+	}))
+	server.Config.Handler = mux
+	server.Start()
+	t.Cleanup(server.Close)
+}
+
+// sendConcurrently sends requests for identifier spread round-robin over servers from several goroutines
+// and returns how many were allowed.
+func sendConcurrently(t *testing.T, servers []*httptest.Server, identifier string, requests int) int {
+	t.Helper()
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(server *httptest.Server) {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			req.Header.Set("X-Client-ID", identifier)
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				t.Errorf("Request failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+			switch resp.StatusCode {
+			case http.StatusOK:
+				allowed.Add(1)
+			case http.StatusTooManyRequests:
+			default:
+				t.Errorf("Unexpected status %d", resp.StatusCode)
+			}
+		}(servers[i%len(servers)])
+	}
+	wg.Wait()
+	return int(allowed.Load())
+}
+
+// TestHorizontalScaling tests that a limit holds across several application instances serving the same
+// identifier concurrently, with shared state in Redis and with in-memory state owned by peers.
+func TestHorizontalScaling(t *testing.T) {
+	const limit = 20
+
+	t.Run("redis", func(t *testing.T) {
+		addr := testenv.Redis(t)
+		// A unique key keeps state left by earlier runs on a shared server from counting
+		path := writeConfig(t, fmt.Sprintf(`
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "redis"
+    window_params:
+      window: 1h
+      limit: %d
+    redis_params:
+      address: %q
+`, limit, addr))
+		identifier := fmt.Sprintf("scaling-%d", time.Now().UnixNano())
+
+		servers := make([]*httptest.Server, scalingInstances)
+		for i := range servers {
+			// Each instance loads the configuration itself, so it has its own Redis client
+			servers[i] = httptest.NewUnstartedServer(nil)
+			startInstance(t, path, servers[i], http.NewServeMux())
+		}
+		if allowed := sendConcurrently(t, servers, identifier, 3*limit); allowed != limit {
+			t.Errorf("Expected %d requests allowed across %d instances, got %d", limit, scalingInstances, allowed)
+		}
+	})
+
+	t.Run("peers", func(t *testing.T) {
+		t.Setenv("TEST_PEER_SECRET", "peer-secret")
+		servers := make([]*httptest.Server, scalingInstances)
+		addrs := make([]string, scalingInstances)
+		for i := range servers {
+			servers[i] = httptest.NewUnstartedServer(nil)
+			addrs[i] = servers[i].Listener.Addr().String()
+		}
+		for i, server := range servers {
+			path := writeConfig(t, fmt.Sprintf(`
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1h
+      limit: %d
+peers:
+  secret_env: TEST_PEER_SECRET
+  self: %q
+  static: ["%s"]
+  timeout: 1s
+  failure_mode: %q
+`, limit, addrs[i], strings.Join(addrs, `", "`), config.FailClosed))
+			node, err := api.NewPeerNodeFromConfigPath(path)
+			if err != nil {
+				t.Fatalf("Failed to create peer node: %v", err)
+			}
+			mux := http.NewServeMux()
+			mux.Handle(peers.Path, node)
+			startInstance(t, path, server, mux, api.WithPeers(node))
+		}
+		for i := 0; i < 5; i++ {
+			identifier := fmt.Sprintf("client%d", i)
+			if allowed := sendConcurrently(t, servers, identifier, 3*limit); allowed != limit {
+				t.Errorf("Expected %d requests allowed for %s across %d instances, got %d", limit, identifier, scalingInstances, allowed)
+			}
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package api_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/config"
+)
+
+// TestShorthandLimiter tests that requests_per_second, burst and per_minute_cap build a token bucket capped per minute.
+func TestShorthandLimiter(t *testing.T) {
+	path := writeConfig(t, `
+limiters:
+  - key: "api"
+    backend: "in_memory"
+    requests_per_second: 1
+    burst: 5
+    per_minute_cap: 3
+`)
+	limiters, configs, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+	if cfg := configs["api"]; cfg.Algorithm != config.TokenBucket || cfg.TokenBucketParams.Rate != 1 || cfg.TokenBucketParams.Capacity != 5 {
+		t.Errorf("Expected a token bucket with rate 1 and capacity 5, got %+v", cfg)
+	}
+
+	// The burst of 5 is capped at 3 per minute
+	ctx := context.Background()
+	for i, want := range []bool{true, true, true, false} {
+		if allowed, err := limiters["api"].Allow(ctx, "client1"); allowed != want || err != nil {
+			t.Fatalf("Request %d: expected (%v, nil), got (%v, %v)", i, want, allowed, err)
+		}
+	}
+}
+
+// TestShorthandLimiterConflict tests that the shorthand cannot be combined with an explicit algorithm.
+func TestShorthandLimiterConflict(t *testing.T) {
+	path := writeConfig(t, `
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    requests_per_second: 10
+    window_params:
+      window: 1m
+      limit: 10
+`)
+	_, _, _, err := api.NewLimitersFromConfigPath(path)
+	if err == nil || !strings.Contains(err.Error(), "requests_per_second") {
+		t.Errorf("Expected the shorthand rejected next to an explicit algorithm, got %v", err)
+	}
+}
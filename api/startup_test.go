@@ -0,0 +1,104 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/config"
+)
+
+// unreachableLimiter configures a limiter whose Redis backend nothing listens on.
+const unreachableLimiter = `
+limiters:
+  - key: "optional"
+    algorithm: "fixed_window_counter"
+    backend: "redis"
+    required: %t
+    window_params:
+      window: 1m
+      limit: 10
+    redis_params:
+      address: "127.0.0.1:1"
+      dial_timeout: 100ms
+`
+
+// TestStartupPolicy tests how each startup policy handles a limiter whose backend is unreachable.
+func TestStartupPolicy(t *testing.T) {
+	tests := []struct {
+		policy   config.StartupPolicy
+		required bool
+		wantErr  bool
+		// allowed and checkErr are the outcome of a check, if startup succeeds
+		allowed  bool
+		checkErr bool
+	}{
+		{policy: config.StartupStrict, wantErr: true},
+		{policy: config.StartupLazy, checkErr: true},
+		{policy: config.StartupLazy, required: true, wantErr: true},
+		{policy: config.StartupDegraded, allowed: true},
+		{policy: config.StartupDegraded, required: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/required=%t", tt.policy, tt.required), func(t *testing.T) {
+			path := writeConfig(t, fmt.Sprintf(unreachableLimiter, tt.required)+fmt.Sprintf("startup_policy: %q\n", tt.policy))
+			limiters, _, closer, err := api.NewLimitersFromConfigPath(path)
+			if tt.wantErr {
+				if err == nil {
+					closer.Close()
+					t.Fatal("Expected startup to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected startup to succeed, got %v", err)
+			}
+			defer closer.Close()
+
+			allowed, err := limiters["optional"].Allow(context.Background(), "client1")
+			if allowed != tt.allowed || (err != nil) != tt.checkErr {
+				t.Errorf("Expected allowed=%v and error=%v, got %v, %v", tt.allowed, tt.checkErr, allowed, err)
+			}
+		})
+	}
+}
+
+// TestStartupFailureRegistersNothing tests that when a limiter fails to start, the limiters created before it are
+// not left serving checks forwarded by peers.
+func TestStartupFailureRegistersNothing(t *testing.T) {
+	t.Setenv("TEST_PEER_SECRET", "peer-secret")
+	path := writeConfig(t, `
+peers:
+  secret_env: TEST_PEER_SECRET
+  self: "127.0.0.1:1"
+  static: ["127.0.0.1:1"]
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 10
+  - key: "unreachable"
+    algorithm: "fixed_window_counter"
+    backend: "redis"
+    window_params:
+      window: 1m
+      limit: 10
+    redis_params:
+      address: "127.0.0.1:1"
+      dial_timeout: 100ms
+`)
+	node, err := api.NewPeerNodeFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create peer node: %v", err)
+	}
+	if _, _, closer, err := api.NewLimitersFromConfigPath(path, api.WithPeers(node)); err == nil {
+		closer.Close()
+		t.Fatal("Expected startup to fail")
+	}
+	if _, err := node.Limiter("api").Allow(context.Background(), "client1"); err == nil {
+		t.Error("Expected the limiter created before the failure not to be served to peers")
+	}
+}
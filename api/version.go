@@ -0,0 +1,86 @@
+package api
+
+import (
+	"runtime"
+	"runtime/debug"
+	"slices"
+
+	"learn.ratelimiter/admin"
+	apiinternal "learn.ratelimiter/api/internal"
+)
+
+// Version is the release of the rate limiter library.
+const Version = "0.1.0"
+
+// Commit is the VCS revision the binary was built from. Set it with
+// -ldflags "-X learn.ratelimiter/api.Commit=<revision>"; it defaults to the revision recorded by the Go toolchain.
+var Commit string
+
+// commit returns Commit, or the VCS revision recorded in the binary's build info if it is not set.
+func commit() string {
+	if Commit != "" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return ""
+}
+
+// versionInfo describes the running rate limiter and what its configuration uses, for GET /admin/version.
+func versionInfo(cfgFile *apiinternal.ConfigFile) admin.VersionInfo {
+	info := admin.VersionInfo{
+		Version:    Version,
+		Commit:     commit(),
+		GoVersion:  runtime.Version(),
+		Backends:   []string{},
+		Algorithms: []string{},
+		Features:   []string{},
+	}
+	add := func(list []string, name string, enabled bool) []string {
+		if enabled && !slices.Contains(list, name) {
+			return append(list, name)
+		}
+		return list
+	}
+	for _, cfg := range cfgFile.Limiters {
+		info.Backends = add(info.Backends, string(cfg.Backend), true)
+		info.Algorithms = add(info.Algorithms, string(cfg.Algorithm), true)
+		if cfg.Migration != nil {
+			info.Backends = add(info.Backends, string(cfg.Migration.Backend), true)
+		}
+		info.Features = add(info.Features, "write_budget", cfg.WriteBudget != nil)
+		info.Features = add(info.Features, "identifier_metrics", cfg.IdentifierMetrics != nil)
+		info.Features = add(info.Features, "regional_budget", cfg.RegionalBudget != nil)
+		info.Features = add(info.Features, "lease", cfg.TokenBucketParams != nil && cfg.TokenBucketParams.Lease != nil)
+		info.Features = add(info.Features, "bulkhead", cfg.Bulkhead != nil)
+		info.Features = add(info.Features, "migration", cfg.Migration != nil)
+		info.Features = add(info.Features, "memory_pressure", cfg.MemoryPressure != nil)
+		info.Features = add(info.Features, "identifier_limit", cfg.IdentifierLimit != nil)
+		info.Features = add(info.Features, "max_keys", cfg.MaxKeys != nil)
+		info.Features = add(info.Features, "unique_identifiers", cfg.UniqueIdentifiers != nil)
+		info.Features = add(info.Features, "stats", cfg.Stats != nil)
+		info.Features = add(info.Features, "history", cfg.History != nil)
+	}
+	info.Features = add(info.Features, "admin_auth", cfgFile.Admin != nil && cfgFile.Admin.Auth != nil)
+	info.Features = add(info.Features, "decision_sink", cfgFile.DecisionSink != nil)
+	info.Features = add(info.Features, "mirror", cfgFile.Mirror != nil)
+	info.Features = add(info.Features, "overrides", cfgFile.Overrides != nil)
+	info.Features = add(info.Features, "bans", cfgFile.Bans != nil)
+	info.Features = add(info.Features, "api_keys", cfgFile.APIKeys != nil)
+	info.Features = add(info.Features, "connections", cfgFile.Connections != nil)
+	info.Features = add(info.Features, "autoscaling", cfgFile.Autoscaling != nil)
+	info.Features = add(info.Features, "anomaly_detection", cfgFile.AnomalyDetection != nil)
+	info.Features = add(info.Features, "denial_report", cfgFile.DenialReport != nil)
+	info.Features = add(info.Features, "peers", cfgFile.Peers != nil)
+	info.Features = add(info.Features, "read_only", cfgFile.ReadOnly != nil)
+	info.Features = add(info.Features, "draining", cfgFile.Draining != nil)
+	for _, list := range [][]string{info.Backends, info.Algorithms, info.Features} {
+		slices.Sort(list)
+	}
+	return info
+}
@@ -0,0 +1,56 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"learn.ratelimiter/admin"
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/banlist"
+)
+
+// TestVersionEndpoint tests that the version endpoint is served only when configured, and describes the configuration.
+func TestVersionEndpoint(t *testing.T) {
+	for _, expose := range []bool{false, true} {
+		cfg := endpointTestLimiters + `
+    stats:
+      window: 5m
+`
+		if expose {
+			cfg += `
+admin:
+  expose_version: true
+`
+		}
+		handler, auditSink, err := api.NewAdminHandlerFromConfigPath(writeConfig(t, cfg), banlist.New())
+		if err != nil {
+			t.Fatalf("Failed to create admin handler: %v", err)
+		}
+		defer auditSink.Close()
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/version", nil))
+		if !expose {
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("Expected no version endpoint unless configured, got %d", rec.Code)
+			}
+			continue
+		}
+		var info admin.VersionInfo
+		if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+			t.Fatalf("Failed to decode version: %v", err)
+		}
+		if info.Version != api.Version || info.GoVersion == "" {
+			t.Errorf("Expected version %s and the Go version, got %+v", api.Version, info)
+		}
+		if !slices.Equal(info.Backends, []string{"in_memory"}) || !slices.Equal(info.Algorithms, []string{"fixed_window_counter"}) {
+			t.Errorf("Expected the configured backend and algorithm, got %+v", info)
+		}
+		if !slices.Equal(info.Features, []string{"stats"}) {
+			t.Errorf("Expected the stats feature, got %v", info.Features)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Package api provides the main interface for initializing and using the rate limiters.
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// minPollInterval and maxPollInterval bound how often Wait retries a denied request. maxPollInterval also bounds how
+// far ahead Wait reserves units when it has no deadline.
+const (
+	minPollInterval = time.Millisecond
+	maxPollInterval = time.Second
+)
+
+// Waiter blocks callers until a limiter admits their request, up to a maximum wait.
+type Waiter struct {
+	limiter      types.Limiter
+	limiterKey   string
+	maxWait      time.Duration
+	pollInterval time.Duration
+}
+
+// NewWaiter creates a Waiter for the given limiter.
+// The maximum wait is taken from the limiter configuration and the retry interval is derived from its algorithm parameters.
+func NewWaiter(limiter types.Limiter, cfg config.LimiterConfig) *Waiter {
+	interval := pollInterval(cfg)
+	log.Info().Str("limiter_key", cfg.Key).Dur("max_wait", cfg.MaxWait).Dur("poll_interval", interval).Msg("API: Waiter initialized")
+	return &Waiter{
+		limiter:      limiter,
+		limiterKey:   cfg.Key,
+		maxWait:      cfg.MaxWait,
+		pollInterval: interval,
+	}
+}
+
+// Wait blocks until a request for the identifier is allowed, the configured maximum wait elapses, or the context is done.
+// It returns types.ErrWaitTimeout if the maximum wait elapsed and the context error if the context was done first.
+func (w *Waiter) Wait(ctx context.Context, identifier string) error {
+	return w.WaitTimeout(ctx, identifier, w.maxWait)
+}
+
+// WaitTimeout is like Wait but overrides the configured maximum wait for this call.
+// A maxWait of 0 waits until the request is allowed or the context is done.
+func (w *Waiter) WaitTimeout(ctx context.Context, identifier string, maxWait time.Duration) error {
+	return w.wait(ctx, identifier, 1, maxWait)
+}
+
+// WaitN blocks until a request costing n units is allowed for the identifier, the configured maximum wait elapses, or the context is done.
+// The limiter must implement types.CostLimiter.
+func (w *Waiter) WaitN(ctx context.Context, identifier string, n int) error {
+	if _, ok := w.limiter.(types.CostLimiter); !ok {
+		return fmt.Errorf("limiter '%s' does not support AllowN", w.limiterKey)
+	}
+	return w.wait(ctx, identifier, n, w.maxWait)
+}
+
+// wait reserves n units until a reservation is admitted, then sleeps for its delay. Limiters implementing
+// types.ReserveLimiter admit the request ahead of time if its units free up before the deadline, and tell how long a
+// denied request should wait; others are retried after the time needed to free up n units. Units reserved are not
+// returned if the context is done during the delay.
+func (w *Waiter) wait(ctx context.Context, identifier string, n int, maxWait time.Duration) error {
+	var deadline time.Time
+	if maxWait > 0 {
+		deadline = time.Now().Add(maxWait)
+	}
+
+	for {
+		// Without a deadline, reservations are bounded by the poll interval rather than made indefinitely ahead
+		window := maxPollInterval
+		if !deadline.IsZero() {
+			window = time.Until(deadline)
+		}
+		if ctxDeadline, ok := ctx.Deadline(); ok {
+			window = min(window, time.Until(ctxDeadline))
+		}
+		reservation, err := types.Reserve(ctx, w.limiter, identifier, n, max(window, 0))
+		if err != nil {
+			return err
+		}
+
+		sleep := reservation.Delay
+		if !reservation.OK {
+			if sleep <= 0 {
+				sleep = min(w.pollInterval*time.Duration(n), maxPollInterval)
+			}
+			sleep = max(sleep, minPollInterval)
+			if !deadline.IsZero() {
+				remaining := time.Until(deadline)
+				if remaining <= 0 {
+					log.Debug().Str("limiter_key", w.limiterKey).Str("identifier", redact.Identifier(identifier)).Dur("max_wait", maxWait).Msg("API: Wait timed out")
+					return types.ErrWaitTimeout
+				}
+				sleep = min(sleep, remaining)
+			}
+		}
+		if sleep > 0 {
+			timer := time.NewTimer(sleep)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if reservation.OK {
+			return nil
+		}
+	}
+}
+
+// pollInterval returns the expected time for one unit of budget to free up under the configured algorithm.
+func pollInterval(cfg config.LimiterConfig) time.Duration {
+	var interval time.Duration
+	switch {
+	case cfg.TokenBucketParams != nil && cfg.TokenBucketParams.Rate > 0:
+		interval = time.Second / time.Duration(cfg.TokenBucketParams.Rate)
+	case cfg.LeakyBucketParams != nil && cfg.LeakyBucketParams.Rate > 0:
+		interval = time.Second / time.Duration(cfg.LeakyBucketParams.Rate)
+	case cfg.WindowParams != nil && cfg.WindowParams.Limit > 0:
+		interval = cfg.WindowParams.Window / time.Duration(cfg.WindowParams.Limit)
+	default:
+		interval = maxPollInterval
+	}
+	return min(max(interval, minPollInterval), maxPollInterval)
+}
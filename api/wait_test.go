@@ -0,0 +1,125 @@
+// Package api_test contains tests for the rate limiter API helpers.
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/config"
+	tbinmemory "learn.ratelimiter/internal/tokenbucket/inmemory"
+	"learn.ratelimiter/types"
+)
+
+func newTokenBucketConfig(key string, rate, capacity int, maxWait time.Duration) config.LimiterConfig {
+	return config.LimiterConfig{
+		Key:               key,
+		Algorithm:         config.TokenBucket,
+		Backend:           config.InMemory,
+		MaxWait:           maxWait,
+		TokenBucketParams: &config.TokenBucketConfig{Rate: rate, Capacity: capacity},
+	}
+}
+
+// TestWaitBlocksUntilAllowed tests that Wait returns once a token has been refilled.
+func TestWaitBlocksUntilAllowed(t *testing.T) {
+	cfg := newTokenBucketConfig("test-wait", 20, 1, time.Second)
+	waiter := api.NewWaiter(tbinmemory.NewLimiter(cfg.Key, 20, 1, 0), cfg)
+	ctx := context.Background()
+
+	if err := waiter.Wait(ctx, "user1"); err != nil {
+		t.Fatalf("First Wait returned error: %v", err)
+	}
+
+	start := time.Now()
+	if err := waiter.Wait(ctx, "user1"); err != nil {
+		t.Fatalf("Second Wait returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 25*time.Millisecond {
+		t.Errorf("Second Wait returned after %v, expected it to block for a refill", elapsed)
+	}
+}
+
+// TestWaitTimeout tests that Wait gives up with ErrWaitTimeout after the configured maximum wait.
+func TestWaitTimeout(t *testing.T) {
+	cfg := newTokenBucketConfig("test-wait-timeout", 1, 1, 50*time.Millisecond)
+	waiter := api.NewWaiter(tbinmemory.NewLimiter(cfg.Key, 1, 1, 0), cfg)
+	ctx := context.Background()
+
+	if err := waiter.Wait(ctx, "user1"); err != nil {
+		t.Fatalf("First Wait returned error: %v", err)
+	}
+
+	start := time.Now()
+	err := waiter.Wait(ctx, "user1")
+	if !errors.Is(err, types.ErrWaitTimeout) {
+		t.Fatalf("Expected ErrWaitTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Wait returned after %v, expected roughly the 50ms maximum wait", elapsed)
+	}
+
+	// A per-call override takes precedence over the configured maximum wait
+	err = waiter.WaitTimeout(ctx, "user1", 10*time.Millisecond)
+	if !errors.Is(err, types.ErrWaitTimeout) {
+		t.Fatalf("Expected ErrWaitTimeout with override, got %v", err)
+	}
+}
+
+// TestWaitContextCancelled tests that Wait returns the context error when the context is done first.
+func TestWaitContextCancelled(t *testing.T) {
+	cfg := newTokenBucketConfig("test-wait-cancel", 1, 1, 0)
+	waiter := api.NewWaiter(tbinmemory.NewLimiter(cfg.Key, 1, 1, 0), cfg)
+
+	if err := waiter.Wait(context.Background(), "user1"); err != nil {
+		t.Fatalf("First Wait returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := waiter.Wait(ctx, "user1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// reserveLimiter admits every reservation after a fixed delay, counting the reservations made.
+type reserveLimiter struct {
+	delay time.Duration
+	calls int
+}
+
+func (l *reserveLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return false, errors.New("unexpected Allow")
+}
+
+func (l *reserveLimiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	l.calls++
+	return types.Reservation{OK: true, Delay: l.delay}, nil
+}
+
+// TestWaitReservation tests that Wait makes a single reservation and sleeps for its delay, returning the context
+// error if the context is done first.
+func TestWaitReservation(t *testing.T) {
+	cfg := newTokenBucketConfig("test-wait-reservation", 1, 1, time.Second)
+	limiter := &reserveLimiter{delay: 40 * time.Millisecond}
+	waiter := api.NewWaiter(limiter, cfg)
+
+	start := time.Now()
+	if err := waiter.Wait(context.Background(), "user1"); err != nil {
+		t.Fatalf("Wait returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < limiter.delay {
+		t.Errorf("Wait returned after %v, expected it to sleep for the %v delay", elapsed, limiter.delay)
+	}
+	if limiter.calls != 1 {
+		t.Errorf("Expected 1 reservation, got %d", limiter.calls)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := waiter.Wait(ctx, "user1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
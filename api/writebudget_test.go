@@ -0,0 +1,76 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/internal/testenv"
+	"learn.ratelimiter/types"
+)
+
+// TestWriteBudgetNamespace tests that no read identifier shares the Redis state of a write budget.
+func TestWriteBudgetNamespace(t *testing.T) {
+	addr := testenv.Redis(t)
+	// A unique key keeps state left by earlier runs on a shared server from counting
+	key := fmt.Sprintf("write-budget-%d", time.Now().UnixNano())
+	path := writeConfig(t, fmt.Sprintf(`
+limiters:
+  - key: %q
+    algorithm: "fixed_window_counter"
+    backend: "redis"
+    window_params:
+      window: 1h
+      limit: 1
+    write_budget:
+      window_params:
+        window: 1h
+        limit: 1
+    redis_params:
+      address: %q
+`, key, addr))
+	limiters, _, closer, err := api.NewLimitersFromConfigPath(path)
+	if err != nil {
+		t.Fatalf("Failed to create limiters: %v", err)
+	}
+	defer closer.Close()
+	limiter := limiters[key]
+
+	writeCtx := types.WithOperation(context.Background(), types.OperationWrite)
+	if allowed, err := limiter.Allow(writeCtx, "user1"); err != nil || !allowed {
+		t.Fatalf("Expected the first write allowed, got %v, %v", allowed, err)
+	}
+	// The key of this read would be that of user1's writes if the suffix started with the key separator
+	if allowed, err := limiter.Allow(context.Background(), "write:user1"); err != nil || !allowed {
+		t.Errorf("Expected the first read of 'write:user1' allowed, got %v, %v", allowed, err)
+	}
+}
+
+// TestWriteBudgetKeyReserved tests that a limiter cannot use the key of another limiter's write budget.
+func TestWriteBudgetKeyReserved(t *testing.T) {
+	path := writeConfig(t, `
+limiters:
+  - key: "api"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 10
+    write_budget:
+      window_params:
+        window: 1m
+        limit: 1
+  - key: "api#write"
+    algorithm: "fixed_window_counter"
+    backend: "in_memory"
+    window_params:
+      window: 1m
+      limit: 10
+`)
+	if _, _, _, err := api.NewLimitersFromConfigPath(path); err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Errorf("Expected the write budget's key rejected, got %v", err)
+	}
+}
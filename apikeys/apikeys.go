@@ -0,0 +1,171 @@
+// Package apikeys resolves API keys to the plan whose limits apply to them, from keys defined in the configuration
+// or kept in Redis. Keys are only held as SHA-256 hashes, and clients are identified by the key's name.
+package apikeys
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// APIKey describes the owner of an API key.
+type APIKey struct {
+	// Name identifies the key's owner; it is used as the rate limiting identifier instead of the key itself.
+	Name string `json:"name"`
+	// Plan is the plan whose limits apply to the key.
+	Plan string `json:"plan"`
+}
+
+// Hash returns the hex-encoded SHA-256 hash under which a key is stored.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Store provides API keys.
+type Store interface {
+	// List returns every key, indexed by its Hash.
+	List(ctx context.Context) (map[string]APIKey, error)
+}
+
+// StaticStore is a Store holding a fixed set of keys, such as those defined in the configuration.
+type StaticStore struct {
+	keys map[string]APIKey
+}
+
+// NewStaticStore creates a store holding the given keys, indexed by the plaintext key.
+func NewStaticStore(keys map[string]APIKey) *StaticStore {
+	hashed := make(map[string]APIKey, len(keys))
+	for key, apiKey := range keys {
+		hashed[Hash(key)] = apiKey
+	}
+	return &StaticStore{keys: hashed}
+}
+
+// List returns the keys.
+func (s *StaticStore) List(_ context.Context) (map[string]APIKey, error) {
+	return s.keys, nil
+}
+
+// Registry caches the keys of its stores for lookups on the request path, refreshing them in the background.
+// When stores define the same key, the last store wins.
+type Registry struct {
+	stores          []Store
+	refreshInterval time.Duration
+
+	// current is replaced, never modified, so lookups need no lock.
+	current   atomic.Pointer[map[string]APIKey]
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewRegistry creates a registry of the keys in stores, refreshed every refreshInterval once started.
+func NewRegistry(refreshInterval time.Duration, stores ...Store) *Registry {
+	r := &Registry{
+		stores:          stores,
+		refreshInterval: refreshInterval,
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+	r.current.Store(&map[string]APIKey{})
+	return r
+}
+
+// Start loads the keys and keeps refreshing them in the background until Close is called.
+// A failed initial load is logged; lookups fail until a refresh succeeds.
+func (r *Registry) Start() {
+	r.startOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), r.refreshInterval)
+		if err := r.Refresh(ctx); err != nil {
+			log.Warn().Err(err).Msg("APIKeys: Initial load failed, starting without API keys")
+		}
+		cancel()
+		go r.run()
+	})
+}
+
+// run refreshes the keys on every tick until stopped.
+func (r *Registry) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), r.refreshInterval)
+			if err := r.Refresh(ctx); err != nil {
+				log.Warn().Err(err).Msg("APIKeys: Refresh failed, keeping the cached API keys")
+			}
+			cancel()
+		}
+	}
+}
+
+// Refresh replaces the cached keys with those currently in the stores. If any store fails, the cache is left unchanged.
+func (r *Registry) Refresh(ctx context.Context) error {
+	keys := make(map[string]APIKey)
+	for _, store := range r.stores {
+		stored, err := store.List(ctx)
+		if err != nil {
+			return err
+		}
+		for hash, apiKey := range stored {
+			keys[hash] = apiKey
+		}
+	}
+	r.current.Store(&keys)
+	log.Debug().Int("count", len(keys)).Msg("APIKeys: API keys loaded")
+	return nil
+}
+
+// Lookup returns the owner of the API key, with false if the key is unknown.
+func (r *Registry) Lookup(key string) (APIKey, bool) {
+	if key == "" {
+		return APIKey{}, false
+	}
+	apiKey, ok := (*r.current.Load())[Hash(key)]
+	return apiKey, ok
+}
+
+// Close stops background refreshes and closes the stores implementing io.Closer.
+// It is safe to call more than once, and before Start.
+func (r *Registry) Close() error {
+	var err error
+	r.stopOnce.Do(func() {
+		close(r.stop)
+		r.startOnce.Do(func() { close(r.done) })
+		<-r.done
+		for _, store := range r.stores {
+			if closer, ok := store.(io.Closer); ok {
+				if closeErr := closer.Close(); closeErr != nil {
+					err = closeErr
+				}
+			}
+		}
+	})
+	return err
+}
+
+// apiKeyContextKey is the context key under which the resolved API key is stored.
+type apiKeyContextKey struct{}
+
+// WithAPIKey returns a copy of ctx carrying the resolved API key.
+func WithAPIKey(ctx context.Context, apiKey APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, apiKey)
+}
+
+// FromContext returns the API key resolved for the request, with false if there is none.
+func FromContext(ctx context.Context) (APIKey, bool) {
+	apiKey, ok := ctx.Value(apiKeyContextKey{}).(APIKey)
+	return apiKey, ok
+}
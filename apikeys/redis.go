@@ -0,0 +1,60 @@
+package apikeys
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// RedisKey is the Redis hash holding API keys. Each field is a key's Hash and holds its APIKey as JSON.
+const RedisKey = "ratelimiter:apikeys"
+
+// RedisStore is a Store kept in a Redis hash shared by all instances, so keys can be issued and revoked without a restart.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a store in the given Redis instance.
+// The store takes ownership of the client and closes it on Close.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Close closes the Redis client.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// List returns the keys in the hash, skipping malformed entries.
+func (s *RedisStore) List(ctx context.Context) (map[string]APIKey, error) {
+	fields, err := s.client.HGetAll(ctx, RedisKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]APIKey, len(fields))
+	for hash, value := range fields {
+		var apiKey APIKey
+		if err := json.Unmarshal([]byte(value), &apiKey); err != nil || apiKey.Name == "" {
+			log.Warn().Str("key_hash", hash).Msg("APIKeys: Skipping malformed API key")
+			continue
+		}
+		keys[hash] = apiKey
+	}
+	return keys, nil
+}
+
+// Set issues the API key, or updates its owner.
+func (s *RedisStore) Set(ctx context.Context, key string, apiKey APIKey) error {
+	data, err := json.Marshal(apiKey)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, RedisKey, Hash(key), data).Err()
+}
+
+// Delete revokes the API key.
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.client.HDel(ctx, RedisKey, Hash(key)).Err()
+}
@@ -0,0 +1,250 @@
+// Package autoscale summarizes how close each limiter runs to its limits over sliding windows, as hints for autoscaling
+// policies: e.g., a HorizontalPodAutoscaler or KEDA scaler adding capacity once utilization stays above 80% for 5m.
+package autoscale
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/metrics"
+)
+
+// Defaults used when no windows or no positive resolution are given.
+var (
+	DefaultWindows    = []time.Duration{time.Minute, 5 * time.Minute}
+	DefaultResolution = 10 * time.Second
+)
+
+// Hint summarizes the checks of one limiter over one window. Requests with no pressure reading (see Hints.Observe)
+// count towards the denial rate only.
+type Hint struct {
+	// Requests is the number of checks in the window.
+	Requests int64 `json:"requests"`
+	// Utilization is the mean fraction of the budget in use after each check, between 0 and 1. Denied checks count as 1.
+	Utilization float64 `json:"utilization"`
+	// SustainedUtilization is the lowest utilization of any interval of the resolution within the window, intervals
+	// without checks counting as 0. It exceeds a threshold only if utilization exceeded it throughout the window.
+	SustainedUtilization float64 `json:"sustained_utilization"`
+	// DenialRate is the fraction of checks denied, between 0 and 1.
+	DenialRate float64 `json:"denial_rate"`
+}
+
+// bucket aggregates the checks of one interval of the resolution.
+type bucket struct {
+	index    int64 // Interval number since the Unix epoch; identifies which interval the bucket holds
+	requests int64
+	denied   int64
+	sampled  int64   // Checks with a pressure reading
+	pressure float64 // Sum of the pressure readings
+}
+
+// utilization returns the mean pressure of the bucket's checks, or 0 if none had a reading.
+func (b *bucket) utilization() float64 {
+	if b.sampled == 0 {
+		return 0
+	}
+	return b.pressure / float64(b.sampled)
+}
+
+// Hints aggregates the checks of each limiter in intervals of the resolution, and summarizes the intervals completed
+// within each window. The interval in progress is left out, so hints lag by at most the resolution.
+type Hints struct {
+	windows    []time.Duration
+	resolution time.Duration
+
+	mu       sync.Mutex
+	limiters map[string][]bucket // Ring of buckets per limiter key, covering the longest window
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates hints over the given windows (DefaultWindows if empty), aggregating checks in intervals of resolution
+// (DefaultResolution if not positive), and starts publishing them as metrics every resolution. Call Close to stop.
+// Windows are rounded up to a multiple of the resolution.
+func New(windows []time.Duration, resolution time.Duration) *Hints {
+	if len(windows) == 0 {
+		windows = DefaultWindows
+	}
+	if resolution <= 0 {
+		resolution = DefaultResolution
+	}
+	h := &Hints{
+		windows:    make([]time.Duration, len(windows)),
+		resolution: resolution,
+		limiters:   make(map[string][]bucket),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for i, window := range windows {
+		h.windows[i] = max((window+resolution-1)/resolution, 1) * resolution
+	}
+	log.Info().Strs("windows", windowNames(h.windows)).Dur("resolution", resolution).Msg("Autoscale: Starting autoscaling hints")
+	go h.run()
+	return h
+}
+
+// Observe records a check of the limiter made now. pressure is the fraction of the identifier's budget in use after
+// an allowed check, or a negative value if it is not known; denied checks count as fully used.
+func (h *Hints) Observe(limiterKey string, allowed bool, pressure float64) {
+	h.ObserveAt(limiterKey, allowed, pressure, time.Now())
+}
+
+// ObserveAt records a check of the limiter made at time t, as Observe does.
+func (h *Hints) ObserveAt(limiterKey string, allowed bool, pressure float64, t time.Time) {
+	index := t.UnixNano() / int64(h.resolution)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ring, ok := h.limiters[limiterKey]
+	if !ok {
+		ring = make([]bucket, h.ringSize())
+		h.limiters[limiterKey] = ring
+	}
+	b := &ring[index%int64(len(ring))]
+	if b.index > index {
+		// Older than the longest window
+		return
+	}
+	if b.index != index {
+		*b = bucket{index: index}
+	}
+	b.requests++
+	if !allowed {
+		b.denied++
+		pressure = 1
+	}
+	if pressure >= 0 {
+		b.sampled++
+		b.pressure += min(pressure, 1)
+	}
+}
+
+// Summary returns the hints of every limiter observed, by limiter key and window name (e.g., "5m").
+func (h *Hints) Summary() map[string]map[string]Hint {
+	return h.SummaryAt(time.Now())
+}
+
+// SummaryAt returns the hints of every limiter observed at time now, as Summary does.
+func (h *Hints) SummaryAt(now time.Time) map[string]map[string]Hint {
+	current := now.UnixNano() / int64(h.resolution)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	summary := make(map[string]map[string]Hint, len(h.limiters))
+	for limiterKey, ring := range h.limiters {
+		hints := make(map[string]Hint, len(h.windows))
+		for _, window := range h.windows {
+			hints[windowName(window)] = summarize(ring, current, int64(window/h.resolution))
+		}
+		summary[limiterKey] = hints
+	}
+	return summary
+}
+
+// summarize returns the hint for the n intervals completed before the interval current.
+func summarize(ring []bucket, current, n int64) Hint {
+	var hint Hint
+	var denied, sampled int64
+	var pressure float64
+	sustained := 1.0
+	for index := current - n; index < current; index++ {
+		b := &ring[index%int64(len(ring))]
+		if b.index != index {
+			// No checks in this interval
+			sustained = 0
+			continue
+		}
+		hint.Requests += b.requests
+		denied += b.denied
+		sampled += b.sampled
+		pressure += b.pressure
+		sustained = min(sustained, b.utilization())
+	}
+	if hint.Requests > 0 {
+		hint.DenialRate = float64(denied) / float64(hint.Requests)
+	}
+	if sampled > 0 {
+		hint.Utilization = pressure / float64(sampled)
+	}
+	hint.SustainedUtilization = sustained
+	return hint
+}
+
+// ServeHTTP writes the summary as JSON (e.g., for the KEDA metrics-api scaler), by limiter key and window name.
+func (h *Hints) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"limiters": h.Summary()}); err != nil {
+		log.Warn().Err(err).Msg("Autoscale: Failed to write hints")
+	}
+}
+
+// Close stops publishing hints as metrics.
+func (h *Hints) Close() error {
+	h.closeOnce.Do(func() {
+		close(h.stop)
+		<-h.done
+	})
+	return nil
+}
+
+// run publishes the hints as metrics every resolution until the hints are closed.
+func (h *Hints) run() {
+	defer close(h.done)
+	ticker := time.NewTicker(h.resolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.publish()
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// publish sets the autoscaling gauges of every limiter observed.
+func (h *Hints) publish() {
+	for limiterKey, hints := range h.Summary() {
+		for window, hint := range hints {
+			metrics.SetAutoscaleHint(limiterKey, window, hint.Utilization, hint.SustainedUtilization, hint.DenialRate)
+		}
+	}
+}
+
+// ringSize returns the number of buckets covering the longest window.
+func (h *Hints) ringSize() int {
+	longest := h.windows[0]
+	for _, window := range h.windows[1:] {
+		longest = max(longest, window)
+	}
+	// One more bucket for the interval in progress
+	return int(longest/h.resolution) + 1
+}
+
+// windowName formats a window as written in configuration, e.g., "5m" rather than "5m0s".
+func windowName(window time.Duration) string {
+	name := window.String()
+	if strings.HasSuffix(name, "m0s") {
+		name = strings.TrimSuffix(name, "0s")
+	}
+	if strings.HasSuffix(name, "h0m") {
+		name = strings.TrimSuffix(name, "0m")
+	}
+	return name
+}
+
+// windowNames returns the names of the windows, sorted.
+func windowNames(windows []time.Duration) []string {
+	names := make([]string, len(windows))
+	for i, window := range windows {
+		names[i] = windowName(window)
+	}
+	sort.Strings(names)
+	return names
+}
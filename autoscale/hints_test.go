@@ -0,0 +1,119 @@
+package autoscale_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/autoscale"
+)
+
+// start is aligned to the resolutions used below, so observations at start fall at the beginning of an interval.
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func approx(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+// TestSummary tests utilization and denial rates over completed intervals only.
+func TestSummary(t *testing.T) {
+	hints := autoscale.New([]time.Duration{time.Minute}, 10*time.Second)
+	defer hints.Close()
+	hints.ObserveAt("api", true, 0.5, start)
+	hints.ObserveAt("api", true, 0.7, start)
+	hints.ObserveAt("api", false, 0.2, start)                  // Denied checks count as fully used
+	hints.ObserveAt("api", true, -1, start)                    // No pressure reading: counted in the denial rate only
+	hints.ObserveAt("api", true, 1, start.Add(10*time.Second)) // Interval in progress below
+
+	hint := hints.SummaryAt(start.Add(15 * time.Second))["api"]["1m"]
+	if hint.Requests != 4 {
+		t.Fatalf("Expected 4 requests in completed intervals, got %d", hint.Requests)
+	}
+	if want := (0.5 + 0.7 + 1) / 3; !approx(hint.Utilization, want) {
+		t.Errorf("Expected utilization %v, got %v", want, hint.Utilization)
+	}
+	if !approx(hint.DenialRate, 0.25) {
+		t.Errorf("Expected denial rate 0.25, got %v", hint.DenialRate)
+	}
+	// Most of the window precedes the first observation
+	if hint.SustainedUtilization != 0 {
+		t.Errorf("Expected no sustained utilization, got %v", hint.SustainedUtilization)
+	}
+}
+
+// TestSustainedUtilization tests that sustained utilization is the lowest utilization of any interval in the window,
+// including idle intervals.
+func TestSustainedUtilization(t *testing.T) {
+	hints := autoscale.New([]time.Duration{time.Minute, 5 * time.Minute}, 10*time.Second)
+	defer hints.Close()
+	for i := 0; i < 6; i++ {
+		hints.ObserveAt("api", true, 0.9-float64(i)*0.02, start.Add(time.Duration(i)*10*time.Second))
+	}
+
+	hints1m := hints.SummaryAt(start.Add(time.Minute))["api"]
+	if got := hints1m["1m"].SustainedUtilization; !approx(got, 0.8) {
+		t.Errorf("Expected sustained utilization 0.8 over 1m, got %v", got)
+	}
+	if got := hints1m["5m"].SustainedUtilization; got != 0 {
+		t.Errorf("Expected no sustained utilization over 5m, got %v", got)
+	}
+
+	// An idle interval ends the sustained utilization
+	if got := hints.SummaryAt(start.Add(70 * time.Second))["api"]["1m"]; got.SustainedUtilization != 0 || got.Requests != 5 {
+		t.Errorf("Expected 5 requests and no sustained utilization after an idle interval, got %+v", got)
+	}
+}
+
+// TestWindowRounding tests that windows are rounded up to a multiple of the resolution and named as configured.
+func TestWindowRounding(t *testing.T) {
+	hints := autoscale.New([]time.Duration{90 * time.Second, 2 * time.Hour}, time.Minute)
+	defer hints.Close()
+	hints.ObserveAt("api", true, 0.5, start)
+
+	summary := hints.SummaryAt(start.Add(time.Minute))["api"]
+	for _, window := range []string{"2m", "2h"} {
+		if hint, ok := summary[window]; !ok || hint.Requests != 1 {
+			t.Errorf("Expected 1 request in window %s, got %+v (present: %v)", window, hint, ok)
+		}
+	}
+}
+
+// TestOldObservations tests that observations older than the longest window are dropped.
+func TestOldObservations(t *testing.T) {
+	hints := autoscale.New([]time.Duration{time.Minute}, 10*time.Second)
+	defer hints.Close()
+	hints.ObserveAt("api", true, 0.5, start.Add(70*time.Second))
+	hints.ObserveAt("api", true, 0.5, start) // Same bucket of the ring as the previous observation
+
+	if got := hints.SummaryAt(start.Add(80 * time.Second))["api"]["1m"].Requests; got != 1 {
+		t.Errorf("Expected only the recent request, got %d", got)
+	}
+}
+
+// TestServeHTTP tests the JSON summary.
+func TestServeHTTP(t *testing.T) {
+	hints := autoscale.New(nil, 10*time.Millisecond)
+	defer hints.Close()
+	hints.Observe("api", false, 0)
+	time.Sleep(20 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	hints.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/autoscale", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", ct)
+	}
+	var body struct {
+		Limiters map[string]map[string]autoscale.Hint `json:"limiters"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode summary: %v", err)
+	}
+	hint, ok := body.Limiters["api"]["1m"]
+	if !ok {
+		t.Fatalf("Expected a 1m hint for api, got %+v", body.Limiters)
+	}
+	if hint.Requests != 1 || hint.DenialRate != 1 || hint.Utilization != 1 {
+		t.Errorf("Unexpected hint: %+v", hint)
+	}
+}
@@ -0,0 +1,105 @@
+// Package bandwidth provides io.Reader and io.Writer wrappers that pace bytes through a token bucket rate limiter.
+package bandwidth
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	ratelimiter "learn.ratelimiter/api"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// Limiter paces byte streams through a token bucket where each token is one byte.
+// The bucket rate is the sustained throughput in bytes per second and its capacity is the largest burst in bytes.
+type Limiter struct {
+	waiter *ratelimiter.Waiter
+	key    string
+	// burst is the largest number of bytes charged in a single call, bounded by the bucket capacity.
+	burst int
+}
+
+// NewLimiter creates a bandwidth Limiter from a token bucket limiter and its configuration.
+// Any backend supported by the token bucket can be used, so limits can be shared between instances.
+func NewLimiter(limiter types.Limiter, cfg config.LimiterConfig) (*Limiter, error) {
+	if cfg.Algorithm != config.TokenBucket || cfg.TokenBucketParams == nil {
+		return nil, fmt.Errorf("bandwidth limiting requires a token_bucket limiter, got '%s' for key '%s'", cfg.Algorithm, cfg.Key)
+	}
+	if _, ok := limiter.(types.CostLimiter); !ok {
+		return nil, fmt.Errorf("limiter '%s' does not support AllowN", cfg.Key)
+	}
+	log.Info().Str("limiter_key", cfg.Key).Int("bytes_per_second", cfg.TokenBucketParams.Rate).Int("burst_bytes", cfg.TokenBucketParams.Capacity).Msg("Bandwidth: Limiter initialized")
+	return &Limiter{
+		waiter: ratelimiter.NewWaiter(limiter, cfg),
+		key:    cfg.Key,
+		burst:  cfg.TokenBucketParams.Capacity,
+	}, nil
+}
+
+// Reader returns an io.Reader that reads from r no faster than the limiter allows for the identifier.
+// Use a connection address as the identifier to limit per connection, or a user ID to share a budget across connections.
+func (l *Limiter) Reader(ctx context.Context, r io.Reader, identifier string) io.Reader {
+	return &reader{ctx: ctx, r: r, limiter: l, identifier: identifier}
+}
+
+// Writer returns an io.Writer that writes to w no faster than the limiter allows for the identifier.
+func (l *Limiter) Writer(ctx context.Context, w io.Writer, identifier string) io.Writer {
+	return &writer{ctx: ctx, w: w, limiter: l, identifier: identifier}
+}
+
+// reader is the paced io.Reader returned by Limiter.Reader.
+type reader struct {
+	ctx        context.Context
+	r          io.Reader
+	limiter    *Limiter
+	identifier string
+}
+
+// Read reads at most one burst of bytes and blocks until the bytes read have been paid for.
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > r.limiter.burst {
+		p = p[:r.limiter.burst]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.waiter.WaitN(r.ctx, r.identifier, n); waitErr != nil {
+			log.Debug().Err(waitErr).Str("limiter_key", r.limiter.key).Str("identifier", redact.Identifier(r.identifier)).Msg("Bandwidth: Read pacing failed")
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// writer is the paced io.Writer returned by Limiter.Writer.
+type writer struct {
+	ctx        context.Context
+	w          io.Writer
+	limiter    *Limiter
+	identifier string
+}
+
+// Write writes p in chunks of at most one burst, blocking before each chunk until it has been paid for.
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > w.limiter.burst {
+			chunk = chunk[:w.limiter.burst]
+		}
+		if err := w.limiter.waiter.WaitN(w.ctx, w.identifier, len(chunk)); err != nil {
+			log.Debug().Err(err).Str("limiter_key", w.limiter.key).Str("identifier", redact.Identifier(w.identifier)).Msg("Bandwidth: Write pacing failed")
+			return written, err
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
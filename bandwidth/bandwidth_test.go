@@ -0,0 +1,79 @@
+// Package bandwidth_test contains tests for the bandwidth limiting wrappers.
+package bandwidth_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/bandwidth"
+	"learn.ratelimiter/config"
+	tbinmemory "learn.ratelimiter/internal/tokenbucket/inmemory"
+)
+
+func newBandwidthLimiter(t *testing.T, key string, bytesPerSecond, burst int) *bandwidth.Limiter {
+	cfg := config.LimiterConfig{
+		Key:               key,
+		Algorithm:         config.TokenBucket,
+		Backend:           config.InMemory,
+		TokenBucketParams: &config.TokenBucketConfig{Rate: bytesPerSecond, Capacity: burst},
+	}
+	limiter, err := bandwidth.NewLimiter(tbinmemory.NewLimiter(key, bytesPerSecond, burst, 0), cfg)
+	if err != nil {
+		t.Fatalf("NewLimiter returned error: %v", err)
+	}
+	return limiter
+}
+
+// TestWriterPacesBytes tests that writes beyond the burst are slowed to the configured rate.
+func TestWriterPacesBytes(t *testing.T) {
+	limiter := newBandwidthLimiter(t, "test-bandwidth-writer", 1000, 100)
+	var buf bytes.Buffer
+	w := limiter.Writer(context.Background(), &buf, "conn1")
+
+	start := time.Now()
+	n, err := w.Write(make([]byte, 300))
+	if err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	if n != 300 || buf.Len() != 300 {
+		t.Fatalf("Expected 300 bytes written, got %d (buffer %d)", n, buf.Len())
+	}
+	// The first 100 bytes are a burst; the remaining 200 need about 200ms at 1000 bytes/sec
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Write of 300 bytes took %v, expected it to be paced", elapsed)
+	}
+}
+
+// TestReaderPacesBytes tests that reads beyond the burst are slowed to the configured rate.
+func TestReaderPacesBytes(t *testing.T) {
+	limiter := newBandwidthLimiter(t, "test-bandwidth-reader", 1000, 100)
+	r := limiter.Reader(context.Background(), bytes.NewReader(make([]byte, 300)), "conn1")
+
+	start := time.Now()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll returned error: %v", err)
+	}
+	if len(data) != 300 {
+		t.Fatalf("Expected 300 bytes read, got %d", len(data))
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Read of 300 bytes took %v, expected it to be paced", elapsed)
+	}
+}
+
+// TestNewLimiterRequiresTokenBucket tests that other algorithms are rejected.
+func TestNewLimiterRequiresTokenBucket(t *testing.T) {
+	cfg := config.LimiterConfig{
+		Key:          "test-bandwidth-window",
+		Algorithm:    config.FixedWindowCounter,
+		Backend:      config.InMemory,
+		WindowParams: &config.WindowConfig{Window: time.Second, Limit: 10},
+	}
+	if _, err := bandwidth.NewLimiter(tbinmemory.NewLimiter(cfg.Key, 10, 10, 0), cfg); err == nil {
+		t.Fatal("Expected an error for a fixed window configuration")
+	}
+}
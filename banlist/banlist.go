@@ -0,0 +1,191 @@
+// Package banlist provides a list of banned identifiers, checked by the middleware before consulting a limiter.
+package banlist
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry describes a banned identifier.
+type Entry struct {
+	// LimiterKey is the key of the limiter the ban applies to.
+	LimiterKey string `json:"limiter_key"`
+	// Identifier is the banned identifier (e.g., client IP or user ID).
+	Identifier string `json:"identifier"`
+	// ExpiresAt is when the ban is lifted; the zero value means the ban is permanent.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// expired reports whether the ban has been lifted at the given time.
+func (e Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// List is a concurrency-safe set of banned identifiers per limiter.
+type List struct {
+	mu sync.RWMutex
+	// entries maps a limiter key to its banned identifiers.
+	entries map[string]map[string]Entry
+	// sync shares changes with other instances, if the list is kept in a shared store (see RedisSync).
+	sync syncer
+}
+
+// syncer is told of the changes made to a list, after they were applied to it.
+type syncer interface {
+	banned(entry Entry)
+	unbanned(limiterKey, identifier string)
+	merged(entries []Entry)
+	replaced(entries []Entry)
+}
+
+// New creates an empty ban list.
+func New() *List {
+	return &List{entries: make(map[string]map[string]Entry)}
+}
+
+// Ban bans the identifier for the limiter. A ttl of 0 bans it permanently.
+// It returns the new ban and the ban it replaced, with false if the identifier was not already banned.
+func (l *List) Ban(limiterKey, identifier string, ttl time.Duration) (Entry, Entry, bool) {
+	entry := Entry{LimiterKey: limiterKey, Identifier: identifier}
+	if ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	banned, ok := l.entries[limiterKey]
+	if !ok {
+		banned = make(map[string]Entry)
+		l.entries[limiterKey] = banned
+	}
+	previous, existed := banned[identifier]
+	banned[identifier] = entry
+	if l.sync != nil {
+		l.sync.banned(entry)
+	}
+	return entry, previous, existed && !previous.expired(time.Now())
+}
+
+// Unban lifts the ban on the identifier for the limiter.
+// It returns the lifted ban and false if the identifier was not banned.
+func (l *List) Unban(limiterKey, identifier string) (Entry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sync != nil {
+		// The ban may be known to other instances only, e.g., if this one missed a change
+		l.sync.unbanned(limiterKey, identifier)
+	}
+	previous, ok := l.entries[limiterKey][identifier]
+	if !ok {
+		return Entry{}, false
+	}
+	delete(l.entries[limiterKey], identifier)
+	return previous, !previous.expired(time.Now())
+}
+
+// IsBanned reports whether the identifier is currently banned for the limiter.
+func (l *List) IsBanned(limiterKey, identifier string) bool {
+	l.mu.RLock()
+	entry, ok := l.entries[limiterKey][identifier]
+	l.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	if entry.expired(time.Now()) {
+		l.mu.Lock()
+		// Only remove the entry if it was not replaced in the meantime
+		if current, ok := l.entries[limiterKey][identifier]; ok && current == entry {
+			delete(l.entries[limiterKey], identifier)
+		}
+		l.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// Entries returns the active bans for the limiter, or for all limiters if limiterKey is empty,
+// sorted by limiter key and identifier.
+func (l *List) Entries(limiterKey string) []Entry {
+	now := time.Now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var entries []Entry
+	for key, banned := range l.entries {
+		if limiterKey != "" && key != limiterKey {
+			continue
+		}
+		for _, entry := range banned {
+			if !entry.expired(now) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].LimiterKey != entries[j].LimiterKey {
+			return entries[i].LimiterKey < entries[j].LimiterKey
+		}
+		return entries[i].Identifier < entries[j].Identifier
+	})
+	return entries
+}
+
+// Merge adds the entries, keeping their expiry times and replacing existing bans of the same identifiers.
+// Expired entries are skipped. It returns the number of entries added.
+func (l *List) Merge(entries []Entry) int {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sync != nil {
+		l.sync.merged(entries)
+	}
+	return l.add(entries, now)
+}
+
+// Replace replaces all bans with the entries, keeping their expiry times. Expired entries are skipped.
+// It returns the number of entries added and the number of active bans removed because they are not among the entries.
+func (l *List) Replace(entries []Entry) (int, int) {
+	now := time.Now()
+	kept := make(map[string]map[string]bool)
+	for _, entry := range entries {
+		if kept[entry.LimiterKey] == nil {
+			kept[entry.LimiterKey] = make(map[string]bool)
+		}
+		kept[entry.LimiterKey][entry.Identifier] = !entry.expired(now)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	removed := 0
+	for key, banned := range l.entries {
+		for identifier, entry := range banned {
+			if !entry.expired(now) && !kept[key][identifier] {
+				removed++
+			}
+		}
+	}
+	l.entries = make(map[string]map[string]Entry)
+	if l.sync != nil {
+		l.sync.replaced(entries)
+	}
+	return l.add(entries, now), removed
+}
+
+// add stores the unexpired entries and returns how many were stored. The caller must hold the write lock.
+func (l *List) add(entries []Entry, now time.Time) int {
+	added := 0
+	for _, entry := range entries {
+		if entry.expired(now) {
+			continue
+		}
+		banned, ok := l.entries[entry.LimiterKey]
+		if !ok {
+			banned = make(map[string]Entry)
+			l.entries[entry.LimiterKey] = banned
+		}
+		banned[entry.Identifier] = entry
+		added++
+	}
+	return added
+}
@@ -0,0 +1,327 @@
+package banlist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// RedisKey is the Redis sorted set holding the bans shared by all instances. Redis cannot expire the members of a
+// set, so each member is scored with the Unix time in milliseconds at which its ban is lifted, or 0 if it is permanent.
+const RedisKey = "ratelimiter:bans"
+
+// RedisChannel is the Redis channel on which instances announce the changes they make to the bans.
+const RedisChannel = "ratelimiter:bans:changes"
+
+const (
+	// retryDelay is how long the sync waits before receiving again after the subscription failed.
+	retryDelay = time.Second
+	// redisTimeout bounds each load of the bans and each write of a change.
+	redisTimeout = 5 * time.Second
+	// writeQueueSize is the number of changes waiting to be written before changing the list blocks.
+	writeQueueSize = 1024
+)
+
+// Operations of the changes published on RedisChannel.
+const (
+	opBan    = "ban"
+	opUnban  = "unban"
+	opReload = "reload"
+)
+
+// change is a change to the bans, as published on RedisChannel.
+type change struct {
+	// Origin identifies the instance that made the change, so it does not apply it twice.
+	Origin string `json:"origin"`
+	// Op is "ban", "unban", or "reload" when several bans changed and instances reload them all.
+	Op    string `json:"op"`
+	Entry Entry  `json:"entry"`
+}
+
+// write is a change to apply to the sorted set, then to publish.
+type write struct {
+	apply  func(ctx context.Context, pipe redis.Pipeliner)
+	change change
+}
+
+// RedisSync keeps a list in a Redis sorted set shared by all instances. The list remains the local copy checked for
+// every request: changes made to it are written to Redis in the background, in order, and published so other
+// instances apply them within milliseconds, and changes published by other instances are applied to it. Instances
+// reload all bans whenever they (re)subscribe, so changes missed while disconnected are not lost.
+type RedisSync struct {
+	client *redis.Client
+	list   *List
+	origin string
+
+	pubsub    *redis.PubSub
+	writes    chan write
+	received  chan struct{}
+	written   chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+var _ syncer = (*RedisSync)(nil)
+
+// NewRedisSync creates a sync of the list with the given Redis instance.
+// The sync takes ownership of the client and closes it on Close.
+func NewRedisSync(client *redis.Client, list *List) *RedisSync {
+	return &RedisSync{
+		client:   client,
+		list:     list,
+		origin:   strconv.FormatUint(rand.Uint64(), 36),
+		writes:   make(chan write, writeQueueSize),
+		received: make(chan struct{}),
+		written:  make(chan struct{}),
+	}
+}
+
+// Start subscribes to the changes of other instances, replaces the bans of the list with those in Redis, and shares
+// the changes made to the list from then on until Close is called. A failed initial load is logged; the list keeps
+// its bans and is reloaded once the subscription succeeds.
+func (s *RedisSync) Start() {
+	s.startOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		defer cancel()
+		// Subscribing before loading ensures no change is missed in between
+		s.pubsub = s.client.Subscribe(ctx, RedisChannel)
+		loaded := false
+		if _, err := s.pubsub.Receive(ctx); err != nil {
+			log.Warn().Err(err).Str("channel", RedisChannel).Msg("Bans: Failed to subscribe to ban changes, retrying")
+		} else if err := s.Refresh(ctx); err != nil {
+			log.Warn().Err(err).Msg("Bans: Initial load failed, keeping the local bans")
+		} else {
+			loaded = true
+		}
+
+		s.list.mu.Lock()
+		s.list.sync = s
+		s.list.mu.Unlock()
+		log.Info().Bool("loaded", loaded).Msg("Bans: Sharing bans through Redis")
+		go s.receive()
+		go s.write()
+	})
+}
+
+// Refresh replaces the bans of the list with those in Redis, removing expired bans from Redis.
+func (s *RedisSync) Refresh(ctx context.Context) error {
+	nowMillis := time.Now().UnixMilli()
+	if err := s.client.ZRemRangeByScore(ctx, RedisKey, "(0", strconv.FormatInt(nowMillis, 10)).Err(); err != nil {
+		return err
+	}
+	zs, err := s.client.ZRangeWithScores(ctx, RedisKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	entries := make([]Entry, 0, len(zs))
+	for _, z := range zs {
+		var key [2]string
+		member, _ := z.Member.(string)
+		if err := json.Unmarshal([]byte(member), &key); err != nil {
+			log.Warn().Err(err).Str("member", member).Msg("Bans: Skipping malformed ban")
+			continue
+		}
+		entry := Entry{LimiterKey: key[0], Identifier: key[1]}
+		if z.Score > 0 {
+			entry.ExpiresAt = time.UnixMilli(int64(z.Score))
+		}
+		entries = append(entries, entry)
+	}
+
+	now := time.Now()
+	s.list.mu.Lock()
+	s.list.entries = make(map[string]map[string]Entry)
+	s.list.add(entries, now)
+	s.list.mu.Unlock()
+	return nil
+}
+
+// Close stops sharing the changes made to the list, after writing those still queued, and closes the Redis client.
+// The list keeps its bans. It is safe to call more than once, and before Start.
+func (s *RedisSync) Close() error {
+	var err error
+	s.stopOnce.Do(func() {
+		s.list.mu.Lock()
+		if s.list.sync == s {
+			s.list.sync = nil
+		}
+		s.list.mu.Unlock()
+		// Changes are queued while holding the list's lock, so none is queued anymore
+		close(s.writes)
+		s.startOnce.Do(func() {
+			close(s.received)
+			close(s.written)
+		})
+		<-s.written
+		if s.pubsub != nil {
+			s.pubsub.Close()
+		}
+		<-s.received
+		err = s.client.Close()
+	})
+	return err
+}
+
+// member returns the member of the sorted set identifying the identifier's ban for the limiter.
+// Both parts are JSON encoded so neither can contain the separator.
+func member(limiterKey, identifier string) string {
+	data, _ := json.Marshal([2]string{limiterKey, identifier})
+	return string(data)
+}
+
+// score returns the score of the ban in the sorted set.
+func score(entry Entry) float64 {
+	if entry.ExpiresAt.IsZero() {
+		return 0
+	}
+	return float64(entry.ExpiresAt.UnixMilli())
+}
+
+// members returns the members of the sorted set for the unexpired entries.
+func members(entries []Entry) []*redis.Z {
+	now := time.Now()
+	var zs []*redis.Z
+	for _, entry := range entries {
+		if !entry.expired(now) {
+			zs = append(zs, &redis.Z{Score: score(entry), Member: member(entry.LimiterKey, entry.Identifier)})
+		}
+	}
+	return zs
+}
+
+// banned queues the ban to be written.
+func (s *RedisSync) banned(entry Entry) {
+	s.writes <- write{
+		apply: func(ctx context.Context, pipe redis.Pipeliner) {
+			pipe.ZAdd(ctx, RedisKey, &redis.Z{Score: score(entry), Member: member(entry.LimiterKey, entry.Identifier)})
+		},
+		change: change{Op: opBan, Entry: entry},
+	}
+}
+
+// unbanned queues the removal of the ban to be written.
+func (s *RedisSync) unbanned(limiterKey, identifier string) {
+	s.writes <- write{
+		apply: func(ctx context.Context, pipe redis.Pipeliner) {
+			pipe.ZRem(ctx, RedisKey, member(limiterKey, identifier))
+		},
+		change: change{Op: opUnban, Entry: Entry{LimiterKey: limiterKey, Identifier: identifier}},
+	}
+}
+
+// merged queues the bans added to be written.
+func (s *RedisSync) merged(entries []Entry) {
+	zs := members(entries)
+	s.writes <- write{
+		apply: func(ctx context.Context, pipe redis.Pipeliner) {
+			if len(zs) > 0 {
+				pipe.ZAdd(ctx, RedisKey, zs...)
+			}
+		},
+		change: change{Op: opReload},
+	}
+}
+
+// replaced queues the replacement of all bans to be written.
+func (s *RedisSync) replaced(entries []Entry) {
+	zs := members(entries)
+	s.writes <- write{
+		apply: func(ctx context.Context, pipe redis.Pipeliner) {
+			pipe.Del(ctx, RedisKey)
+			if len(zs) > 0 {
+				pipe.ZAdd(ctx, RedisKey, zs...)
+			}
+		},
+		change: change{Op: opReload},
+	}
+}
+
+// write writes the queued changes and publishes them until the queue is closed. A change that fails to be written is
+// logged and dropped; instances keep the bans they had until the next change or reload.
+func (s *RedisSync) write() {
+	defer close(s.written)
+	for w := range s.writes {
+		w.change.Origin = s.origin
+		data, err := json.Marshal(w.change)
+		if err != nil {
+			log.Error().Err(err).Msg("Bans: Failed to encode ban change")
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			w.apply(ctx, pipe)
+			pipe.Publish(ctx, RedisChannel, data)
+			return nil
+		})
+		cancel()
+		if err != nil {
+			log.Warn().Err(err).Str("op", w.change.Op).Str("limiter_key", w.change.Entry.LimiterKey).Msg("Bans: Failed to share ban change")
+		}
+	}
+}
+
+// receive applies the changes published by other instances until the sync is closed, reloading all bans whenever
+// the subscription is renewed after a disconnection.
+func (s *RedisSync) receive() {
+	defer close(s.received)
+	ctx := context.Background()
+	for {
+		msg, err := s.pubsub.Receive(ctx)
+		if errors.Is(err, redis.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("channel", RedisChannel).Msg("Bans: Failed to receive ban changes, retrying")
+			time.Sleep(retryDelay)
+			continue
+		}
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			s.reload()
+		case *redis.Message:
+			s.apply(msg.Payload)
+		}
+	}
+}
+
+// reload replaces the bans of the list with those in Redis, logging failures.
+func (s *RedisSync) reload() {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := s.Refresh(ctx); err != nil {
+		log.Warn().Err(err).Msg("Bans: Reload failed, keeping the local bans")
+	}
+}
+
+// apply applies a change published by another instance to the list, without sharing it again.
+func (s *RedisSync) apply(payload string) {
+	var c change
+	if err := json.Unmarshal([]byte(payload), &c); err != nil {
+		log.Warn().Err(err).Msg("Bans: Skipping malformed ban change")
+		return
+	}
+	if c.Origin == s.origin {
+		return
+	}
+	switch c.Op {
+	case opBan:
+		s.list.mu.Lock()
+		s.list.add([]Entry{c.Entry}, time.Now())
+		s.list.mu.Unlock()
+	case opUnban:
+		s.list.mu.Lock()
+		delete(s.list.entries[c.Entry.LimiterKey], c.Entry.Identifier)
+		s.list.mu.Unlock()
+	case opReload:
+		s.reload()
+	default:
+		log.Warn().Str("op", c.Op).Msg("Bans: Skipping unknown ban change")
+	}
+}
@@ -0,0 +1,62 @@
+// Package banlist_test contains tests for ban lists.
+package banlist_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/banlist"
+	"learn.ratelimiter/internal/testenv"
+)
+
+// TestRedisSync tests that bans made on one instance reach another through Redis, and new instances load them.
+func TestRedisSync(t *testing.T) {
+	addr := testenv.Redis(t)
+	newSync := func(list *banlist.List) *banlist.RedisSync {
+		s := banlist.NewRedisSync(redis.NewClient(&redis.Options{Addr: addr}), list)
+		s.Start()
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	if err := client.Del(context.Background(), banlist.RedisKey).Err(); err != nil {
+		t.Fatalf("Failed to clear bans: %v", err)
+	}
+
+	local, remote := banlist.New(), banlist.New()
+	newSync(local)
+	newSync(remote)
+	local.Ban("api", "203.0.113.7", 0)
+	local.Ban("api", "203.0.113.8", time.Minute)
+	local.Unban("api", "203.0.113.8")
+	eventually(t, func() bool {
+		return remote.IsBanned("api", "203.0.113.7") && !remote.IsBanned("api", "203.0.113.8")
+	}, "Expected the remote instance to apply the changes")
+
+	remote.Replace([]banlist.Entry{{LimiterKey: "login", Identifier: "user-1"}})
+	eventually(t, func() bool {
+		return local.IsBanned("login", "user-1") && !local.IsBanned("api", "203.0.113.7")
+	}, "Expected the local instance to reload the replaced bans")
+
+	late := banlist.New()
+	newSync(late)
+	if entries := late.Entries(""); len(entries) != 1 || entries[0].Identifier != "user-1" {
+		t.Errorf("Expected a new instance to load the shared bans, got %v", entries)
+	}
+}
+
+// eventually fails the test with message unless condition holds within a second.
+func eventually(t *testing.T, condition func() bool, message string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,118 @@
+package banlist
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Format is an encoding of a list of bans for bulk import and export.
+type Format string
+
+// Constants for supported formats.
+const (
+	// FormatJSON is a JSON array of entries, as returned by the admin API. It is the default.
+	FormatJSON Format = "json"
+	// FormatCSV is a CSV file with the header row limiter_key,identifier,expires_at,
+	// where expires_at is an RFC 3339 time or empty for permanent bans.
+	FormatCSV Format = "csv"
+)
+
+// csvHeader is the header row of the CSV format.
+var csvHeader = []string{"limiter_key", "identifier", "expires_at"}
+
+// ParseFormat returns the format with the given name, or FormatJSON if name is empty.
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case "", FormatJSON:
+		return FormatJSON, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	default:
+		return "", fmt.Errorf("unsupported format '%s'", name)
+	}
+}
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	if f == FormatCSV {
+		return "text/csv"
+	}
+	return "application/json"
+}
+
+// Export writes the entries to w in the given format.
+func Export(w io.Writer, entries []Entry, format Format) error {
+	if format != FormatCSV {
+		if entries == nil {
+			entries = []Entry{}
+		}
+		return json.NewEncoder(w).Encode(entries)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		expiresAt := ""
+		if !entry.ExpiresAt.IsZero() {
+			expiresAt = entry.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		if err := cw.Write([]string{entry.LimiterKey, entry.Identifier, expiresAt}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Import reads entries in the given format from r. Every entry must have a limiter key and an identifier.
+func Import(r io.Reader, format Format) ([]Entry, error) {
+	var entries []Entry
+	if format != FormatCSV {
+		if err := json.NewDecoder(r).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		for i, entry := range entries {
+			if entry.LimiterKey == "" || entry.Identifier == "" {
+				return nil, fmt.Errorf("entry %d: limiter_key and identifier are required", i+1)
+			}
+		}
+		return entries, nil
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+	for i, column := range csvHeader {
+		if header[i] != column {
+			return nil, fmt.Errorf("invalid CSV header: expected column %d to be '%s', got '%s'", i+1, column, header[i])
+		}
+	}
+	for row := 2; ; row++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		entry := Entry{LimiterKey: record[0], Identifier: record[1]}
+		if entry.LimiterKey == "" || entry.Identifier == "" {
+			return nil, fmt.Errorf("row %d: limiter_key and identifier are required", row)
+		}
+		if record[2] != "" {
+			if entry.ExpiresAt, err = time.Parse(time.RFC3339, record[2]); err != nil {
+				return nil, fmt.Errorf("row %d: invalid expires_at '%s'", row, record[2])
+			}
+		}
+		entries = append(entries, entry)
+	}
+}
@@ -0,0 +1,90 @@
+// Command ratelimit-keyaudit scans the Redis keyspace of a limiter and reports the keys without a TTL, the keys idle
+// longest and an estimate of the memory used, to find keys leaked by script bugs or older versions. It only reads
+// Redis, so it can run against a limiter serving requests.
+//
+// Usage:
+//
+//	ratelimit-keyaudit [-config FILE] -limiter KEY [-sample N] [-oldest N] [-memory-samples N] [-json]
+//
+// The Redis connection is that of the limiter in the configuration.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/keyaudit"
+)
+
+func main() {
+	flags := flag.NewFlagSet("ratelimit-keyaudit", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "Path to the configuration file, or a directory of them")
+	limiterKey := flags.String("limiter", "", "Key of the limiter to audit")
+	sample := flags.Int("sample", keyaudit.DefaultSampleSize, "Number of keys without a TTL listed in the report")
+	oldest := flags.Int("oldest", keyaudit.DefaultOldest, "Number of keys idle longest listed in the report")
+	memorySamples := flags.Int("memory-samples", keyaudit.DefaultMemorySamples, "Number of keys measured with MEMORY USAGE")
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	flags.Parse(os.Args[1:])
+
+	if *limiterKey == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	// Limiter logs at info level and above would drown the report
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
+	// Zero lists or measures no key, not the default
+	opts := keyaudit.Options{SampleSize: noneIfZero(*sample), Oldest: noneIfZero(*oldest), MemorySamples: noneIfZero(*memorySamples)}
+	report, err := api.AuditKeysFromConfigPath(context.Background(), *configPath, *limiterKey, opts)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		printReport(report)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ratelimit-keyaudit:", err)
+		os.Exit(1)
+	}
+}
+
+// noneIfZero maps a zero flag to the negative option value selecting none.
+func noneIfZero(n int) int {
+	if n == 0 {
+		return -1
+	}
+	return n
+}
+
+// printReport prints the report for humans.
+func printReport(report keyaudit.Report) {
+	fmt.Printf("Limiter key '%s'\nScanned: %d\nWithout TTL: %d\n", report.LimiterKey, report.Scanned, report.WithoutTTL)
+	for _, prefix := range report.Prefixes {
+		fmt.Printf("  %s*: %d keys, %d without TTL\n", prefix.Prefix, prefix.Keys, prefix.WithoutTTL)
+	}
+	for _, key := range report.WithoutTTLSample {
+		fmt.Printf("  NO TTL %s\n", key)
+	}
+	if report.IdleUnavailable {
+		fmt.Println("Oldest keys: unavailable, Redis does not track idle times (LFU maxmemory-policy)")
+	} else if len(report.Oldest) > 0 {
+		fmt.Println("Oldest keys (idle longest):")
+		for _, key := range report.Oldest {
+			line := fmt.Sprintf("  %s idle %s", key.Key, key.Idle)
+			if key.TTL > 0 {
+				line += fmt.Sprintf(" (ttl %s)", key.TTL)
+			} else {
+				line += " (no ttl)"
+			}
+			fmt.Println(line)
+		}
+	}
+	fmt.Printf("Memory: %d bytes in %d keys sampled, about %d bytes in total\n", report.SampledMemoryBytes, report.MemorySampled, report.EstimatedMemoryBytes)
+}
@@ -0,0 +1,81 @@
+// Command ratelimit-rekey moves the Redis state of a limiter to a new limiter key, so renaming a limiter in the
+// configuration does not reset the limits of its identifiers. Keys keep their TTL. Run it with -dry-run first to
+// report the keys that would be moved and those that already exist under the new key.
+//
+// Usage:
+//
+//	ratelimit-rekey [-config FILE] -from KEY -to KEY [-dry-run] [-copy] [-overwrite] [-sample N] [-json]
+//
+// The Redis connection is that of the limiter configured under the new key, or under the old one.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/rekey"
+)
+
+func main() {
+	flags := flag.NewFlagSet("ratelimit-rekey", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "Path to the configuration file, or a directory of them")
+	from := flags.String("from", "", "Old limiter key")
+	to := flags.String("to", "", "New limiter key")
+	dryRun := flags.Bool("dry-run", false, "Report the keys that would be moved without writing anything")
+	copyKeys := flags.Bool("copy", false, "Keep the keys under the old limiter key")
+	overwrite := flags.Bool("overwrite", false, "Replace keys already present under the new limiter key instead of skipping them")
+	sample := flags.Int("sample", rekey.DefaultSampleSize, "Number of moved keys listed in the report")
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	flags.Parse(os.Args[1:])
+
+	if *from == "" || *to == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	// Limiter logs at info level and above would drown the report
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
+	sampleSize := *sample
+	if sampleSize == 0 {
+		sampleSize = -1 // Zero lists no key, not the default
+	}
+	opts := rekey.Options{DryRun: *dryRun, Copy: *copyKeys, Overwrite: *overwrite, SampleSize: sampleSize}
+	report, err := api.RekeyFromConfigPath(context.Background(), *configPath, *from, *to, opts)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		printReport(report)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ratelimit-rekey:", err)
+		os.Exit(1)
+	}
+}
+
+// printReport prints the report for humans.
+func printReport(report rekey.Report) {
+	verb := "Moved"
+	if report.DryRun {
+		verb = "Would move"
+	}
+	fmt.Printf("Limiter key '%s' -> '%s'\nScanned: %d\n%s: %d\nConflicts (new key exists): %d\nExpired during the run: %d\n",
+		report.From, report.To, report.Scanned, verb, report.Moved, report.Conflicts, report.Expired)
+	for _, move := range report.Sample {
+		line := fmt.Sprintf("  %s -> %s", move.From, move.To)
+		if move.TTL > 0 {
+			line += fmt.Sprintf(" (ttl %s)", move.TTL)
+		}
+		if move.Conflict {
+			line += " CONFLICT"
+		}
+		fmt.Println(line)
+	}
+}
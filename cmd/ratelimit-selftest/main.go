@@ -0,0 +1,143 @@
+// Command ratelimit-selftest checks that a configured limiter never admits more requests than its limit allows
+// under concurrency, e.g., to verify a new Redis deployment before sending production traffic to it.
+// Concurrent workers hammer one fresh identifier and the number of admitted requests is compared with the most the
+// limiter's parameters allow over the duration of the run. Over-admission means the backend does not update state atomically.
+//
+// Usage:
+//
+//	ratelimit-selftest [-config FILE] -limiter KEY [-workers N] [-requests N] [-identifier ID]
+//
+// It exits with status 1 if the limiter over-admitted or failed to decide every request.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"learn.ratelimiter/api"
+	"learn.ratelimiter/config"
+)
+
+// result counts the outcome of the requests sent by all workers.
+type result struct {
+	allowed atomic.Int64
+	denied  atomic.Int64
+	errors  atomic.Int64
+	// firstErr is the first error returned by the limiter.
+	firstErr atomic.Pointer[error]
+}
+
+func main() {
+	flags := flag.NewFlagSet("ratelimit-selftest", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "Path to the configuration file, or a directory of them")
+	limiterKey := flags.String("limiter", "", "Key of the limiter to test")
+	workers := flags.Int("workers", 32, "Number of concurrent workers")
+	requests := flags.Int("requests", 1000, "Number of requests sent by each worker")
+	identifier := flags.String("identifier", "", "Identifier to test with (default a fresh selftest-<timestamp> identifier)")
+	flags.Parse(os.Args[1:])
+
+	if *limiterKey == "" || *workers <= 0 || *requests <= 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *identifier == "" {
+		*identifier = fmt.Sprintf("selftest-%d", time.Now().UnixNano())
+	}
+	// Limiter logs at info level and above would drown the report
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
+	if err := run(*configPath, *limiterKey, *identifier, *workers, *requests); err != nil {
+		fmt.Fprintln(os.Stderr, "ratelimit-selftest:", err)
+		os.Exit(1)
+	}
+}
+
+// run sends workers*requests requests for identifier to the limiter concurrently and checks the admitted count.
+func run(configPath, limiterKey, identifier string, workers, requests int) error {
+	limiters, configs, closer, err := api.NewLimitersFromConfigPath(configPath)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	limiter, ok := limiters[limiterKey]
+	if !ok {
+		return fmt.Errorf("limiter '%s' not found in %s", limiterKey, configPath)
+	}
+	cfg := configs[limiterKey]
+
+	fmt.Printf("Testing limiter '%s' (%s, %s) with %d workers x %d requests for identifier %q\n", limiterKey, cfg.Algorithm, cfg.Backend, workers, requests, identifier)
+	var res result
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < requests; j++ {
+				allowed, err := limiter.Allow(context.Background(), identifier)
+				switch {
+				case err != nil:
+					res.errors.Add(1)
+					res.firstErr.CompareAndSwap(nil, &err)
+				case allowed:
+					res.allowed.Add(1)
+				default:
+					res.denied.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	limit, err := maxAdmitted(cfg, elapsed)
+	if err != nil {
+		return err
+	}
+	allowed := res.allowed.Load()
+	fmt.Printf("Elapsed: %s\nAllowed: %d\nDenied: %d\nErrors: %d\nMost allowed by the limit: %d\n", elapsed.Round(time.Millisecond), allowed, res.denied.Load(), res.errors.Load(), limit)
+
+	if errs := res.errors.Load(); errs > 0 {
+		return fmt.Errorf("%d requests failed, first error: %w", errs, *res.firstErr.Load())
+	}
+	if allowed > limit {
+		return fmt.Errorf("over-admission: %d requests allowed, at most %d expected", allowed, limit)
+	}
+	fmt.Println("OK: no over-admission")
+	return nil
+}
+
+// maxAdmitted returns the most requests the limiter's parameters allow for one identifier over elapsed,
+// starting from a fresh identifier and counting every window or refill the run may have touched.
+func maxAdmitted(cfg config.LimiterConfig, elapsed time.Duration) (int64, error) {
+	switch cfg.Algorithm {
+	case config.FixedWindowCounter, config.SlidingWindowCounter, config.SlidingWindowLog:
+		// Sliding windows never admit more than the limit within one fixed window either
+		windows := int64(math.Ceil(float64(elapsed)/float64(cfg.WindowParams.Window))) + 1
+		return windows * cfg.WindowParams.Limit, nil
+	case config.TokenBucket:
+		params := cfg.TokenBucketParams
+		limit := int64(params.Capacity+params.MaxDebt) + refilled(params.Rate, elapsed)
+		if params.Lease != nil {
+			limit += int64(params.Lease.StalenessBudget)
+		}
+		return limit, nil
+	case config.LeakyBucket:
+		return int64(cfg.LeakyBucketParams.Capacity) + refilled(cfg.LeakyBucketParams.Rate, elapsed), nil
+	default:
+		return 0, fmt.Errorf("algorithm '%s' is not supported by the self-test", cfg.Algorithm)
+	}
+}
+
+// refilled returns the number of tokens added at rate per second over elapsed, rounded up.
+func refilled(rate int, elapsed time.Duration) int64 {
+	return int64(math.Ceil(float64(rate) * elapsed.Seconds()))
+}
@@ -0,0 +1,66 @@
+package config
+
+import "reflect"
+
+// WithDefaults returns the configuration with the fields it leaves unset taken from defaults. Nested parameters (e.g.,
+// redis_params) are merged field by field, so a limiter can override a single parameter of the defaults. Algorithm
+// parameters are inherited only by limiters whose algorithm uses them, and backend parameters only by limiters using
+// the backend of the defaults; a limiter naming a connection does not inherit redis_params, and one setting its own
+// backend parameters does not inherit the connection. Both configurations must have their shorthand expanded (see
+// ExpandShorthand). Zero values (e.g., false or 0) cannot override a default, since they are indistinguishable from
+// unset fields.
+func (c LimiterConfig) WithDefaults(defaults LimiterConfig) LimiterConfig {
+	defaults.Key = ""
+	// The shorthand is expanded into the algorithm and its parameters, which are inherited instead
+	defaults.RequestsPerSecond, defaults.Burst = 0, 0
+	switch c.Algorithm {
+	case "":
+	case FixedWindowCounter, SlidingWindowCounter, SlidingWindowLog:
+		defaults.TokenBucketParams, defaults.LeakyBucketParams = nil, nil
+	case TokenBucket:
+		defaults.WindowParams, defaults.LeakyBucketParams = nil, nil
+	case LeakyBucket:
+		defaults.WindowParams, defaults.TokenBucketParams = nil, nil
+	}
+	if c.Backend != "" && c.Backend != defaults.Backend {
+		defaults.Connection, defaults.RedisParams, defaults.MemcacheParams = "", nil, nil
+	}
+	switch {
+	case c.Connection != "":
+		defaults.RedisParams, defaults.MemcacheParams = nil, nil
+	case !isZero(c.RedisParams) || !isZero(c.MemcacheParams):
+		defaults.Connection = ""
+	case defaults.Connection != "":
+		// Flat limiters have empty backend parameters when they set none
+		c.RedisParams, c.MemcacheParams = nil, nil
+	}
+	mergeDefaults(reflect.ValueOf(&c).Elem(), reflect.ValueOf(defaults))
+	return c
+}
+
+// mergeDefaults sets the zero fields of the struct dst to those of defaults, merging pointers to structs field by
+// field into a copy, so configurations inheriting the same defaults share no parameters.
+func mergeDefaults(dst, defaults reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		field, def := dst.Field(i), defaults.Field(i)
+		switch {
+		case !field.CanSet() || def.IsZero():
+		case field.Kind() == reflect.Pointer && field.Type().Elem().Kind() == reflect.Struct:
+			merged := reflect.New(field.Type().Elem())
+			if !field.IsNil() {
+				merged.Elem().Set(field.Elem())
+			}
+			mergeDefaults(merged.Elem(), def.Elem())
+			field.Set(merged)
+		case field.Kind() == reflect.Struct:
+			mergeDefaults(field, def)
+		case field.IsZero():
+			field.Set(def)
+		}
+	}
+}
+
+// isZero reports whether the pointer is nil or points to a zero value.
+func isZero[T any](p *T) bool {
+	return p == nil || reflect.ValueOf(p).Elem().IsZero()
+}
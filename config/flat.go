@@ -0,0 +1,123 @@
+package config
+
+import "time"
+
+// FlatLimiterConfig is a flattened, single-level form of LimiterConfig for configuration generated by tools such as
+// Terraform or HCL (e.g., with jsonencode). Durations are plain numbers of seconds instead of duration strings, and
+// algorithm and backend parameters are top-level fields; only those of the chosen algorithm and backend are used.
+// Options without a flat field (e.g., regional_budget or bulkhead) require the nested limiters form.
+type FlatLimiterConfig struct {
+	// Key is a unique identifier for this rate limiter configuration.
+	Key string `yaml:"key"`
+	// Algorithm is the rate limiting algorithm to use (e.g., "token_bucket").
+	Algorithm AlgorithmType `yaml:"algorithm"`
+	// Backend is the storage backend to use (e.g., "in_memory", "redis").
+	Backend BackendType `yaml:"backend"`
+	// MaxWaitSeconds is the maximum time Wait blocks, in seconds (0 waits until the context is done).
+	MaxWaitSeconds float64 `yaml:"max_wait_seconds,omitempty"`
+
+	// WindowSeconds is the window length of window algorithms, in seconds.
+	WindowSeconds float64 `yaml:"window_seconds,omitempty"`
+	// Limit is the number of requests allowed within the window.
+	Limit int64 `yaml:"limit,omitempty"`
+	// CacheDenials caches over-limit identifiers locally until the window ends (fixed window only).
+	CacheDenials bool `yaml:"cache_denials,omitempty"`
+	// WindowAlignment is where windows start (fixed window only): "first_request" or "wall_clock".
+	WindowAlignment WindowAlignment `yaml:"window_alignment,omitempty"`
+
+	// Rate is the refill (token bucket) or leak (leaky bucket) rate, in tokens per second.
+	Rate int `yaml:"rate,omitempty"`
+	// Capacity is the maximum number of tokens the bucket can hold.
+	Capacity int `yaml:"capacity,omitempty"`
+	// MaxDebt is the number of tokens a request may borrow against future refill (token bucket only).
+	MaxDebt int `yaml:"max_debt,omitempty"`
+	// ServerTime refills the bucket by the Redis server's clock (token bucket with the Redis backend only).
+	ServerTime bool `yaml:"server_time,omitempty"`
+
+	// Connection optionally names an entry of the top-level backends section to use instead of the prefixed
+	// backend fields below.
+	Connection string `yaml:"connection,omitempty"`
+	// RedisAddress is the address of the Redis server (e.g., "localhost:6379").
+	RedisAddress string `yaml:"redis_address,omitempty"`
+	// RedisPassword is the password for Redis authentication.
+	RedisPassword string `yaml:"redis_password,omitempty"`
+	// RedisDB is the Redis database to use.
+	RedisDB int `yaml:"redis_db,omitempty"`
+	// RedisPoolSize is the maximum number of connections in the connection pool.
+	RedisPoolSize int `yaml:"redis_pool_size,omitempty"`
+	// RedisDialTimeoutSeconds is the timeout for establishing a connection, in seconds.
+	RedisDialTimeoutSeconds float64 `yaml:"redis_dial_timeout_seconds,omitempty"`
+	// RedisReadTimeoutSeconds is the timeout for reading from the server, in seconds.
+	RedisReadTimeoutSeconds float64 `yaml:"redis_read_timeout_seconds,omitempty"`
+	// RedisWriteTimeoutSeconds is the timeout for writing to the server, in seconds.
+	RedisWriteTimeoutSeconds float64 `yaml:"redis_write_timeout_seconds,omitempty"`
+	// RedisKeyCacheSize is the number of Redis keys of frequent identifiers the limiter caches.
+	RedisKeyCacheSize int `yaml:"redis_key_cache_size,omitempty"`
+
+	// MemcacheAddresses are the addresses of the Memcache servers.
+	MemcacheAddresses []string `yaml:"memcache_addresses,omitempty"`
+	// MemcacheCodec is the encoding of stored state: "json" (default), "msgpack" or "protobuf".
+	MemcacheCodec string `yaml:"memcache_codec,omitempty"`
+	// MemcacheCompression compresses large stored state: "none" (default) or "snappy".
+	MemcacheCompression string `yaml:"memcache_compression,omitempty"`
+	// MemcacheCompressionThreshold is the smallest encoded state, in bytes, that is compressed.
+	MemcacheCompressionThreshold int `yaml:"memcache_compression_threshold,omitempty"`
+}
+
+// LimiterConfig expands the flat configuration into the nested LimiterConfig, keeping only the parameters of its
+// algorithm and backend. The result is validated like any other limiter configuration.
+func (f FlatLimiterConfig) LimiterConfig() LimiterConfig {
+	cfg := LimiterConfig{
+		Key:        f.Key,
+		Algorithm:  f.Algorithm,
+		Backend:    f.Backend,
+		MaxWait:    seconds(f.MaxWaitSeconds),
+		Connection: f.Connection,
+	}
+	switch f.Algorithm {
+	case FixedWindowCounter, SlidingWindowCounter, SlidingWindowLog:
+		cfg.WindowParams = &WindowConfig{
+			Window:       seconds(f.WindowSeconds),
+			Limit:        f.Limit,
+			CacheDenials: f.CacheDenials,
+			Alignment:    f.WindowAlignment,
+		}
+	case TokenBucket:
+		cfg.TokenBucketParams = &TokenBucketConfig{
+			Rate:       f.Rate,
+			Capacity:   f.Capacity,
+			MaxDebt:    f.MaxDebt,
+			ServerTime: f.ServerTime,
+		}
+	case LeakyBucket:
+		cfg.LeakyBucketParams = &LeakyBucketConfig{Rate: f.Rate, Capacity: f.Capacity}
+	}
+	switch {
+	case f.Connection != "":
+		// The backend parameters come from the named connection
+	case f.Backend == Redis:
+		cfg.RedisParams = &RedisBackendConfig{
+			Address:      f.RedisAddress,
+			Password:     f.RedisPassword,
+			DB:           f.RedisDB,
+			PoolSize:     f.RedisPoolSize,
+			DialTimeout:  seconds(f.RedisDialTimeoutSeconds),
+			ReadTimeout:  seconds(f.RedisReadTimeoutSeconds),
+			WriteTimeout: seconds(f.RedisWriteTimeoutSeconds),
+			KeyCacheSize: f.RedisKeyCacheSize,
+		}
+	case f.Backend == Memcache:
+		cfg.MemcacheParams = &MemcacheBackendConfig{
+			Addresses:            f.MemcacheAddresses,
+			Codec:                f.MemcacheCodec,
+			Compression:          f.MemcacheCompression,
+			CompressionThreshold: f.MemcacheCompressionThreshold,
+		}
+	}
+	return cfg
+}
+
+// seconds converts a number of seconds to a time.Duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
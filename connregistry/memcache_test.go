@@ -0,0 +1,59 @@
+//go:build !nomemcache
+
+package connregistry_test
+
+import (
+	"context"
+	"testing"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/connregistry"
+	"learn.ratelimiter/internal/memcacheclient"
+)
+
+// TestMemcacheClients tests that limiters with identical Memcache parameters share a client, reported with its
+// addresses, and that Memcache limiters get an error without a Memcache dialer.
+func TestMemcacheClients(t *testing.T) {
+	dials := 0
+	registry := connregistry.New(nil, connregistry.WithMemcacheDialer(func(params config.MemcacheBackendConfig, ping bool) (connregistry.MemcacheClient, error) {
+		dials++
+		return memcacheclient.New(&params)
+	}))
+	defer registry.Close()
+
+	memcacheConfig := func(key string, addresses ...string) config.LimiterConfig {
+		return config.LimiterConfig{Key: key, Backend: config.Memcache, MemcacheParams: &config.MemcacheBackendConfig{Addresses: addresses}}
+	}
+	a, err := registry.LazyClients(memcacheConfig("a", unreachable))
+	if err != nil || a.MemcacheClient == nil {
+		t.Fatalf("Expected a Memcache client, got %+v, %v", a, err)
+	}
+	b, _ := registry.LazyClients(memcacheConfig("b", unreachable))
+	c, _ := registry.LazyClients(memcacheConfig("c", unreachable, "127.0.0.1:2"))
+	if a.MemcacheClient != b.MemcacheClient {
+		t.Error("Expected limiters with identical parameters to share a client")
+	}
+	if a.MemcacheClient == c.MemcacheClient {
+		t.Error("Expected limiters with different addresses to get different clients")
+	}
+	if dials != 2 {
+		t.Errorf("Expected 2 clients created, got %d", dials)
+	}
+	if _, err := registry.Clients(memcacheConfig("d", unreachable)); err == nil {
+		t.Error("Expected the shared connection to be checked for a limiter needing it")
+	}
+
+	statuses := registry.Health(context.Background())
+	if len(statuses) != 2 || statuses[0].Name != "127.0.0.1:1" || statuses[1].Name != "127.0.0.1:1,127.0.0.1:2" {
+		t.Fatalf("Expected 2 connections named by their addresses, got %+v", statuses)
+	}
+	for _, status := range statuses {
+		if status.Backend != config.Memcache || status.Healthy {
+			t.Errorf("Expected unhealthy Memcache connection %q, got %+v", status.Name, status)
+		}
+	}
+
+	if _, err := connregistry.New(nil).Clients(memcacheConfig("e", unreachable)); err == nil {
+		t.Error("Expected an error for a Memcache limiter without a Memcache dialer")
+	}
+}
@@ -0,0 +1,311 @@
+// Package connregistry manages the backend connections used by limiters. Connections are created on first use and
+// shared by every limiter with identical connection parameters, whether given inline or through a named connection,
+// and their health is reported per connection.
+package connregistry
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/types"
+)
+
+// checkTimeout bounds the check of a connection created lazily once a limiter needs its backend to be reachable.
+const checkTimeout = 5 * time.Second
+
+// RedisDialer creates a Redis client for the given parameters. If ping is true, it returns an error if the server
+// is unreachable; otherwise the client connects on first use.
+type RedisDialer func(params config.RedisBackendConfig, ping bool) (*redis.Client, error)
+
+// MemcacheDialer creates a Memcache client for the given parameters. If ping is true, it returns an error if the
+// servers are unreachable; otherwise the client connects on first use.
+type MemcacheDialer func(params config.MemcacheBackendConfig, ping bool) (MemcacheClient, error)
+
+// MemcacheClient is a Memcache client created by a MemcacheDialer, such as a memcacheclient.Client. The registry
+// only depends on this interface, so builds with the nomemcache tag do not link a Memcache client.
+type MemcacheClient interface {
+	// Unwrap returns the client given to limiters.
+	Unwrap() *types.MemcacheClient
+	// Ping checks that every server is reachable.
+	Ping() error
+	// Close releases the client's connections.
+	Close() error
+}
+
+// Status is the health of one backend connection.
+type Status struct {
+	// Name identifies the connection: its first name in the backends section, or its address and database
+	// (for Memcache, its comma-separated addresses) if only used with inline parameters.
+	Name string `json:"name"`
+	// Names are all the backends section entries sharing the connection.
+	Names   []string           `json:"names,omitempty"`
+	Backend config.BackendType `json:"backend"`
+	Address string             `json:"address"`
+	DB      int                `json:"db"`
+	Healthy bool               `json:"healthy"`
+	// Error is the health check failure, if any.
+	Error string `json:"error,omitempty"`
+	// TotalConns and IdleConns are the sizes of the connection's pool.
+	TotalConns int `json:"total_conns"`
+	IdleConns  int `json:"idle_conns"`
+}
+
+// redisConn is a Redis client shared by the limiters with the same parameters.
+type redisConn struct {
+	params config.RedisBackendConfig
+	names  []string
+	client *redis.Client
+	// checked reports whether the server answered when the connection was created or first needed checking.
+	checked bool
+}
+
+// name returns the name identifying the connection in statuses and metrics.
+func (c *redisConn) name() string {
+	if len(c.names) > 0 {
+		return c.names[0]
+	}
+	return fmt.Sprintf("%s/%d", c.params.Address, c.params.DB)
+}
+
+// memcacheConn is a Memcache client shared by the limiters with the same parameters.
+type memcacheConn struct {
+	params config.MemcacheBackendConfig
+	names  []string
+	client MemcacheClient
+	// checked reports whether the servers answered when the connection was created or first needed checking.
+	checked bool
+}
+
+// name returns the name identifying the connection in statuses and metrics.
+func (c *memcacheConn) name() string {
+	if len(c.names) > 0 {
+		return c.names[0]
+	}
+	return strings.Join(c.params.Addresses, ",")
+}
+
+// memcacheKey returns the key of the Memcache connection for params, which hold a slice and are not comparable.
+func memcacheKey(params config.MemcacheBackendConfig) string {
+	return fmt.Sprintf("%#v", params)
+}
+
+// Registry creates backend connections on first use and reuses them for identical parameters.
+// A connection whose creation fails is not remembered, so it is created again the next time a limiter needs it;
+// once created, the client redials dropped connections on demand. It is safe for concurrent use.
+type Registry struct {
+	dialRedis    RedisDialer
+	dialMemcache MemcacheDialer
+
+	mu sync.Mutex
+	// redis holds the Redis connections by their parameters.
+	redis map[config.RedisBackendConfig]*redisConn
+	// memcache holds the Memcache connections by the key of their parameters (see memcacheKey).
+	memcache map[string]*memcacheConn
+}
+
+// Option configures optional behaviour of a Registry.
+type Option func(*Registry)
+
+// WithMemcacheDialer creates Memcache clients with dial. Without it, limiters using the Memcache backend get an error.
+func WithMemcacheDialer(dial MemcacheDialer) Option {
+	return func(r *Registry) {
+		r.dialMemcache = dial
+	}
+}
+
+// New creates an empty registry creating Redis clients with dialRedis.
+func New(dialRedis RedisDialer, opts ...Option) *Registry {
+	r := &Registry{
+		dialRedis: dialRedis,
+		redis:     make(map[config.RedisBackendConfig]*redisConn),
+		memcache:  make(map[string]*memcacheConn),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Clients returns the backend clients needed by cfg, creating its connection on first use and returning an error
+// if its backend is unreachable. cfg.Connection, if set, is recorded as a name of the connection.
+func (r *Registry) Clients(cfg config.LimiterConfig) (types.BackendClients, error) {
+	return r.clients(cfg, true)
+}
+
+// LazyClients is like Clients, but a connection created by it is not checked: it connects on first use, so checks
+// fail with an error until the backend is reachable. Connections created by either method are shared.
+func (r *Registry) LazyClients(cfg config.LimiterConfig) (types.BackendClients, error) {
+	return r.clients(cfg, false)
+}
+
+// clients returns the backend clients needed by cfg, creating its connection with ping on first use.
+func (r *Registry) clients(cfg config.LimiterConfig, ping bool) (types.BackendClients, error) {
+	if cfg.Backend == config.Memcache {
+		return r.memcacheClients(cfg, ping)
+	}
+	if cfg.Backend != config.Redis {
+		return types.BackendClients{}, nil
+	}
+	if cfg.RedisParams == nil {
+		return types.BackendClients{}, fmt.Errorf("redis backend selected but redis_params are missing for limiter '%s'", cfg.Key)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conn, ok := r.redis[*cfg.RedisParams]
+	if !ok {
+		client, err := r.dialRedis(*cfg.RedisParams, ping)
+		if err != nil {
+			return types.BackendClients{}, err
+		}
+		conn = &redisConn{params: *cfg.RedisParams, client: client, checked: ping}
+		r.redis[conn.params] = conn
+		log.Info().Str("address", conn.params.Address).Int("db", conn.params.DB).Bool("checked", ping).Msg("Registry: Redis connection created")
+	} else if ping && !conn.checked {
+		// A connection created lazily is shared with a limiter needing a reachable backend, so it is checked now
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		defer cancel()
+		if err := conn.client.Ping(ctx).Err(); err != nil {
+			return types.BackendClients{}, fmt.Errorf("failed to connect to Redis at %s: %w", conn.params.Address, err)
+		}
+		conn.checked = true
+	}
+	if cfg.Connection != "" && !slices.Contains(conn.names, cfg.Connection) {
+		conn.names = append(conn.names, cfg.Connection)
+	}
+	return types.BackendClients{RedisClient: conn.client}, nil
+}
+
+// memcacheClients returns the Memcache client needed by cfg, creating its connection with ping on first use.
+func (r *Registry) memcacheClients(cfg config.LimiterConfig, ping bool) (types.BackendClients, error) {
+	if cfg.MemcacheParams == nil {
+		return types.BackendClients{}, fmt.Errorf("memcache backend selected but memcache_params are missing for limiter '%s'", cfg.Key)
+	}
+	if r.dialMemcache == nil {
+		return types.BackendClients{}, fmt.Errorf("memcache backend selected but memcache connections are not supported for limiter '%s'", cfg.Key)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := memcacheKey(*cfg.MemcacheParams)
+	conn, ok := r.memcache[key]
+	if !ok {
+		client, err := r.dialMemcache(*cfg.MemcacheParams, ping)
+		if err != nil {
+			return types.BackendClients{}, err
+		}
+		conn = &memcacheConn{params: *cfg.MemcacheParams, client: client, checked: ping}
+		r.memcache[key] = conn
+		log.Info().Strs("addresses", conn.params.Addresses).Bool("checked", ping).Msg("Registry: Memcache connection created")
+	} else if ping && !conn.checked {
+		// A connection created lazily is shared with a limiter needing a reachable backend, so it is checked now
+		if err := conn.client.Ping(); err != nil {
+			return types.BackendClients{}, fmt.Errorf("failed to connect to Memcache at %s: %w", conn.name(), err)
+		}
+		conn.checked = true
+	}
+	if cfg.Connection != "" && !slices.Contains(conn.names, cfg.Connection) {
+		conn.names = append(conn.names, cfg.Connection)
+	}
+	return types.BackendClients{MemcacheClient: conn.client.Unwrap()}, nil
+}
+
+// Health checks every connection, records the results in the backend connection metrics and returns them
+// ordered by name.
+func (r *Registry) Health(ctx context.Context) []Status {
+	r.mu.Lock()
+	conns := make([]*redisConn, 0, len(r.redis))
+	statuses := make([]Status, 0, len(r.redis)+len(r.memcache))
+	for _, conn := range r.redis {
+		conns = append(conns, conn)
+		statuses = append(statuses, Status{
+			Name:    conn.name(),
+			Names:   slices.Clone(conn.names),
+			Backend: config.Redis,
+			Address: conn.params.Address,
+			DB:      conn.params.DB,
+		})
+	}
+	memcacheConns := make([]*memcacheConn, 0, len(r.memcache))
+	for _, conn := range r.memcache {
+		memcacheConns = append(memcacheConns, conn)
+		statuses = append(statuses, Status{
+			Name:    conn.name(),
+			Names:   slices.Clone(conn.names),
+			Backend: config.Memcache,
+			Address: strings.Join(conn.params.Addresses, ","),
+		})
+	}
+	r.mu.Unlock()
+
+	// Connections are pinged without holding the lock, so a slow backend does not block limiter creation
+	for i, conn := range conns {
+		status := &statuses[i]
+		if err := conn.client.Ping(ctx).Err(); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Healthy = true
+		}
+		stats := conn.client.PoolStats()
+		status.TotalConns, status.IdleConns = int(stats.TotalConns), int(stats.IdleConns)
+		metrics.SetBackendConnectionHealth(status.Name, string(status.Backend), status.Healthy, status.TotalConns, status.IdleConns)
+	}
+	// Memcache clients do not report their pool sizes, and ping every server without a context
+	for i, conn := range memcacheConns {
+		status := &statuses[len(conns)+i]
+		if err := conn.client.Ping(); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Healthy = true
+		}
+		metrics.SetBackendConnectionHealth(status.Name, string(status.Backend), status.Healthy, 0, 0)
+	}
+	slices.SortFunc(statuses, func(a, b Status) int { return cmp.Compare(a.Name, b.Name) })
+	return statuses
+}
+
+// Ping checks every connection and returns an error naming the unhealthy ones, if any.
+func (r *Registry) Ping(ctx context.Context) error {
+	var errs []error
+	for _, status := range r.Health(ctx) {
+		if !status.Healthy {
+			errs = append(errs, fmt.Errorf("%s connection '%s': %s", status.Backend, status.Name, status.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every connection. Connections needed afterwards are created again.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for _, conn := range r.redis {
+		log.Info().Str("connection", conn.name()).Msg("Registry: Closing Redis connection...")
+		if err := conn.client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close Redis connection '%s': %w", conn.name(), err))
+			log.Error().Err(err).Str("connection", conn.name()).Msg("Registry: Error closing Redis connection")
+		}
+	}
+	clear(r.redis)
+	for _, conn := range r.memcache {
+		log.Info().Str("connection", conn.name()).Msg("Registry: Closing Memcache connection...")
+		if err := conn.client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close Memcache connection '%s': %w", conn.name(), err))
+			log.Error().Err(err).Str("connection", conn.name()).Msg("Registry: Error closing Memcache connection")
+		}
+	}
+	clear(r.memcache)
+	return errors.Join(errs...)
+}
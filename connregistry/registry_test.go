@@ -0,0 +1,127 @@
+package connregistry_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/connregistry"
+)
+
+// unreachable is an address nothing listens on, so clients are created but never connect.
+const unreachable = "127.0.0.1:1"
+
+// countingDialer returns a dialer creating clients without connecting, and the number of clients it created.
+func countingDialer() (connregistry.RedisDialer, *int) {
+	dials := 0
+	return func(params config.RedisBackendConfig, ping bool) (*redis.Client, error) {
+		dials++
+		return redis.NewClient(&redis.Options{Addr: params.Address, DB: params.DB, DialTimeout: 100 * time.Millisecond, MaxRetries: -1}), nil
+	}, &dials
+}
+
+func redisConfig(key, connection string, params config.RedisBackendConfig) config.LimiterConfig {
+	return config.LimiterConfig{Key: key, Backend: config.Redis, Connection: connection, RedisParams: &params}
+}
+
+// TestClientsReuse tests that limiters with identical parameters share a client and others get their own.
+func TestClientsReuse(t *testing.T) {
+	dial, dials := countingDialer()
+	registry := connregistry.New(dial)
+	defer registry.Close()
+
+	primary := config.RedisBackendConfig{Address: unreachable}
+	a, err := registry.Clients(redisConfig("a", "sessions", primary))
+	if err != nil {
+		t.Fatalf("Clients failed: %v", err)
+	}
+	b, _ := registry.Clients(redisConfig("b", "", primary))
+	c, _ := registry.Clients(redisConfig("c", "cache", config.RedisBackendConfig{Address: unreachable, DB: 1}))
+	if a.RedisClient != b.RedisClient {
+		t.Error("Expected limiters with identical parameters to share a client")
+	}
+	if a.RedisClient == c.RedisClient {
+		t.Error("Expected limiters with different databases to get different clients")
+	}
+	if *dials != 2 {
+		t.Errorf("Expected 2 clients created, got %d", *dials)
+	}
+
+	if clients, err := registry.Clients(config.LimiterConfig{Key: "d", Backend: config.InMemory}); err != nil || clients.RedisClient != nil {
+		t.Errorf("Expected no clients for an in-memory limiter, got %+v, %v", clients, err)
+	}
+	if *dials != 2 {
+		t.Errorf("Expected no client created for an in-memory limiter, got %d created", *dials)
+	}
+}
+
+// TestClientsRetry tests that a connection whose creation failed is created again on the next use.
+func TestClientsRetry(t *testing.T) {
+	fail := true
+	registry := connregistry.New(func(params config.RedisBackendConfig, ping bool) (*redis.Client, error) {
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		return redis.NewClient(&redis.Options{Addr: params.Address}), nil
+	})
+	defer registry.Close()
+
+	cfg := redisConfig("a", "", config.RedisBackendConfig{Address: unreachable})
+	if _, err := registry.Clients(cfg); err == nil {
+		t.Fatal("Expected the failed creation to be returned")
+	}
+	fail = false
+	if clients, err := registry.Clients(cfg); err != nil || clients.RedisClient == nil {
+		t.Errorf("Expected the connection to be created on retry, got %+v, %v", clients, err)
+	}
+}
+
+// TestHealth tests that unreachable connections are reported by name.
+func TestHealth(t *testing.T) {
+	dial, _ := countingDialer()
+	registry := connregistry.New(dial)
+	defer registry.Close()
+
+	registry.Clients(redisConfig("a", "sessions", config.RedisBackendConfig{Address: unreachable}))
+	registry.Clients(redisConfig("b", "", config.RedisBackendConfig{Address: unreachable, DB: 3}))
+
+	statuses := registry.Health(context.Background())
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 connections, got %+v", statuses)
+	}
+	if statuses[0].Name != "127.0.0.1:1/3" || statuses[1].Name != "sessions" {
+		t.Errorf("Expected connections ordered by name, got %q and %q", statuses[0].Name, statuses[1].Name)
+	}
+	for _, status := range statuses {
+		if status.Healthy || status.Error == "" {
+			t.Errorf("Expected connection %q to be unhealthy, got %+v", status.Name, status)
+		}
+	}
+	if err := registry.Ping(context.Background()); err == nil || !strings.Contains(err.Error(), "'sessions'") {
+		t.Errorf("Expected Ping to name the unhealthy connection, got %v", err)
+	}
+}
+
+// TestLazyClients tests that a connection created lazily is checked once a limiter needs its backend reachable.
+func TestLazyClients(t *testing.T) {
+	dial, dials := countingDialer()
+	registry := connregistry.New(dial)
+	defer registry.Close()
+
+	params := config.RedisBackendConfig{Address: unreachable}
+	lazy, err := registry.LazyClients(redisConfig("optional", "", params))
+	if err != nil || lazy.RedisClient == nil {
+		t.Fatalf("Expected an unchecked client, got %+v, %v", lazy, err)
+	}
+	if _, err := registry.Clients(redisConfig("required", "", params)); err == nil {
+		t.Error("Expected the shared connection to be checked for a limiter needing it")
+	}
+	if *dials != 1 {
+		t.Errorf("Expected the connection to be created once, got %d", *dials)
+	}
+}
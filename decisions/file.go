@@ -0,0 +1,72 @@
+package decisions
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// FileWriter appends decisions to a file as JSON lines.
+type FileWriter struct {
+	path string
+	file *os.File
+}
+
+// NewFileWriter opens (or creates) the file at path for appending.
+func NewFileWriter(path string) (*FileWriter, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open decision log '%s': %w", path, err)
+	}
+	return &FileWriter{path: path, file: file}, nil
+}
+
+// Write appends the decisions to the file, one JSON object per line.
+func (w *FileWriter) Write(_ context.Context, decisions []Decision) error {
+	return writeJSONLines(w.file, w.path, decisions)
+}
+
+// Close closes the file.
+func (w *FileWriter) Close() error {
+	return w.file.Close()
+}
+
+// StreamWriter writes decisions as JSON lines to a stream it does not own, such as standard output,
+// so log shippers can collect them separately from the human-readable logs.
+type StreamWriter struct {
+	name string
+	out  io.Writer
+}
+
+// NewStreamWriter creates a writer of JSON lines to out, named name in errors.
+func NewStreamWriter(out io.Writer, name string) *StreamWriter {
+	return &StreamWriter{name: name, out: out}
+}
+
+// Write writes the decisions to the stream, one JSON object per line.
+func (w *StreamWriter) Write(_ context.Context, decisions []Decision) error {
+	return writeJSONLines(w.out, w.name, decisions)
+}
+
+// Close does nothing, since the stream is owned by the caller.
+func (w *StreamWriter) Close() error {
+	return nil
+}
+
+// writeJSONLines writes the decisions to out through a buffer, one JSON object per line.
+func writeJSONLines(out io.Writer, name string, decisions []Decision) error {
+	buf := bufio.NewWriter(out)
+	encoder := json.NewEncoder(buf)
+	for _, d := range decisions {
+		if err := encoder.Encode(d); err != nil {
+			return fmt.Errorf("write decision log '%s': %w", name, err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("write decision log '%s': %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package decisions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultStream is the Redis stream used by a Redis writer created without a stream name.
+const DefaultStream = "ratelimiter:decisions"
+
+// streamField is the stream entry field holding the JSON-encoded decision.
+const streamField = "decision"
+
+// RedisStreamWriter appends decisions to a Redis stream, one entry per decision, in a single round trip per batch.
+type RedisStreamWriter struct {
+	client *redis.Client
+	stream string
+	// maxLen approximately caps the stream length; 0 keeps all entries.
+	maxLen int64
+}
+
+// NewRedisStreamWriter creates a writer appending to the given Redis stream, trimmed to about maxLen entries if maxLen is positive.
+// The writer takes ownership of the client and closes it on Close.
+func NewRedisStreamWriter(client *redis.Client, stream string, maxLen int64) *RedisStreamWriter {
+	if stream == "" {
+		stream = DefaultStream
+	}
+	return &RedisStreamWriter{client: client, stream: stream, maxLen: maxLen}
+}
+
+// Write appends the decisions to the stream.
+func (w *RedisStreamWriter) Write(ctx context.Context, decisions []Decision) error {
+	_, err := w.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, d := range decisions {
+			data, err := json.Marshal(d)
+			if err != nil {
+				return fmt.Errorf("marshal decision: %w", err)
+			}
+			args := &redis.XAddArgs{
+				Stream: w.stream,
+				Values: map[string]interface{}{streamField: data},
+			}
+			if w.maxLen > 0 {
+				args.MaxLen = w.maxLen
+				args.Approx = true
+			}
+			pipe.XAdd(ctx, args)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("append to decision stream '%s': %w", w.stream, err)
+	}
+	return nil
+}
+
+// Close closes the Redis client.
+func (w *RedisStreamWriter) Close() error {
+	return w.client.Close()
+}
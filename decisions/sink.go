@@ -0,0 +1,253 @@
+// Package decisions replicates rate limiting decisions to a secondary store (e.g., for analytics) asynchronously,
+// so recording a decision never waits on the store.
+package decisions
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/metrics"
+)
+
+// Decision is the outcome of rate limiting one request.
+// Its JSON field names are a stable format ingested by analytics and abuse pipelines: add fields, never rename them.
+type Decision struct {
+	Time       time.Time `json:"time"`
+	LimiterKey string    `json:"limiter_key"`
+	Algorithm  string    `json:"algorithm,omitempty"`
+	Identifier string    `json:"identifier"`
+	Allowed    bool      `json:"allowed"`
+	// Status is the HTTP status the request was answered with (200 if it was passed on).
+	Status int `json:"status"`
+	// Cost is the number of units the request was charged.
+	Cost int    `json:"cost"`
+	Path string `json:"path,omitempty"`
+	// Tag is the tag the middleware assigned to the request, if any.
+	Tag string `json:"tag,omitempty"`
+	// Policy names the limit that denied a rate limited request: the limiter key, or the limit within it that denied
+	// the request (see types.Result.Policy). It is empty for other decisions.
+	Policy string `json:"policy,omitempty"`
+	// ErrorClass is the class of the error the limiter failed with (see errclass.Classify), for requests answered
+	// with 500 or 503 because of it. It is empty for other decisions.
+	ErrorClass string `json:"error_class,omitempty"`
+}
+
+// Writer stores batches of decisions. Implement it to replicate decisions to other stores (e.g., Kafka).
+type Writer interface {
+	// Write stores the decisions, oldest first.
+	Write(ctx context.Context, decisions []Decision) error
+	io.Closer
+}
+
+// OverflowPolicy decides what happens to a decision recorded while the buffer is full.
+type OverflowPolicy string
+
+// Constants for supported overflow policies.
+const (
+	// DropNewest discards the decision being recorded. It is the default.
+	DropNewest OverflowPolicy = "drop_newest"
+	// DropOldest discards the oldest buffered decision to make room.
+	DropOldest OverflowPolicy = "drop_oldest"
+	// Block waits for room in the buffer, adding latency to the request recording the decision.
+	Block OverflowPolicy = "block"
+)
+
+// Defaults used when an option is not given or not positive.
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultBufferSize    = 10000
+)
+
+// Reasons decisions are dropped, used as the reason label of the dropped decisions metric.
+const (
+	DropReasonOverflow   = "overflow"
+	DropReasonWriteError = "write_error"
+)
+
+// Sink buffers decisions and writes them in batches from a background goroutine.
+type Sink struct {
+	writer        Writer
+	sampleRate    float64
+	batchSize     int
+	flushInterval time.Duration
+	bufferSize    int
+	overflow      OverflowPolicy
+
+	queue     chan Decision
+	stop      chan struct{}
+	done      chan struct{}
+	closed    atomic.Bool
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Option configures optional behaviour of a Sink.
+type Option func(*Sink)
+
+// WithSampleRate replicates only the given fraction of decisions, chosen at random. Rates outside (0, 1) replicate every decision.
+func WithSampleRate(rate float64) Option {
+	return func(s *Sink) {
+		if rate > 0 && rate < 1 {
+			s.sampleRate = rate
+		}
+	}
+}
+
+// WithBatchSize writes at most n decisions at once (DefaultBatchSize if n is not positive).
+func WithBatchSize(n int) Option {
+	return func(s *Sink) {
+		if n > 0 {
+			s.batchSize = n
+		}
+	}
+}
+
+// WithFlushInterval writes buffered decisions at least this often (DefaultFlushInterval if d is not positive).
+func WithFlushInterval(d time.Duration) Option {
+	return func(s *Sink) {
+		if d > 0 {
+			s.flushInterval = d
+		}
+	}
+}
+
+// WithBuffer buffers up to size decisions waiting to be written (DefaultBufferSize if size is not positive)
+// and applies the overflow policy when the buffer is full (DropNewest if empty).
+func WithBuffer(size int, overflow OverflowPolicy) Option {
+	return func(s *Sink) {
+		if size > 0 {
+			s.bufferSize = size
+		}
+		if overflow != "" {
+			s.overflow = overflow
+		}
+	}
+}
+
+// NewSink creates a sink writing decisions to writer and starts its background goroutine.
+// The sink takes ownership of the writer and closes it on Close.
+func NewSink(writer Writer, opts ...Option) *Sink {
+	s := &Sink{
+		writer:        writer,
+		sampleRate:    1,
+		batchSize:     DefaultBatchSize,
+		flushInterval: DefaultFlushInterval,
+		bufferSize:    DefaultBufferSize,
+		overflow:      DropNewest,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.queue = make(chan Decision, s.bufferSize)
+	log.Info().Float64("sample_rate", s.sampleRate).Int("batch_size", s.batchSize).Dur("flush_interval", s.flushInterval).Int("buffer_size", s.bufferSize).Str("overflow", string(s.overflow)).Msg("Decisions: Starting decision sink")
+	go s.run()
+	return s
+}
+
+// Record queues the decision for writing, subject to sampling and the overflow policy.
+// It only blocks with the Block policy while the buffer is full. Decisions recorded after Close are discarded.
+func (s *Sink) Record(d Decision) {
+	if s.closed.Load() || (s.sampleRate < 1 && rand.Float64() >= s.sampleRate) {
+		return
+	}
+	select {
+	case s.queue <- d:
+		return
+	default:
+	}
+
+	switch s.overflow {
+	case Block:
+		select {
+		case s.queue <- d:
+		case <-s.stop:
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.queue <- d:
+				return
+			default:
+			}
+			select {
+			case <-s.queue:
+				metrics.RecordDecisionsDropped(DropReasonOverflow, 1)
+			default:
+			}
+		}
+	default:
+		metrics.RecordDecisionsDropped(DropReasonOverflow, 1)
+	}
+}
+
+// Buffered returns the number of decisions waiting to be picked up by the background goroutine.
+func (s *Sink) Buffered() int {
+	return len(s.queue)
+}
+
+// run batches queued decisions until the sink is closed, then writes what is left.
+func (s *Sink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	batch := make([]Decision, 0, s.batchSize)
+	for {
+		select {
+		case d := <-s.queue:
+			batch = append(batch, d)
+			if len(batch) >= s.batchSize {
+				batch = s.flush(batch)
+			}
+		case <-ticker.C:
+			batch = s.flush(batch)
+		case <-s.stop:
+			for {
+				select {
+				case d := <-s.queue:
+					batch = append(batch, d)
+					if len(batch) >= s.batchSize {
+						batch = s.flush(batch)
+					}
+				default:
+					s.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes the batch, if any, and returns it emptied for reuse. Failed batches are dropped rather than retried,
+// so an unavailable store cannot grow memory without bound.
+func (s *Sink) flush(batch []Decision) []Decision {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.writer.Write(ctx, batch); err != nil {
+		log.Warn().Err(err).Int("count", len(batch)).Msg("Decisions: Failed to write decisions, dropping batch")
+		metrics.RecordDecisionsDropped(DropReasonWriteError, len(batch))
+	}
+	return batch[:0]
+}
+
+// Close stops accepting decisions, writes those still buffered and closes the writer. It is safe to call more than once.
+func (s *Sink) Close() error {
+	s.closeOnce.Do(func() {
+		s.closed.Store(true)
+		close(s.stop)
+		<-s.done
+		s.closeErr = s.writer.Close()
+	})
+	return s.closeErr
+}
@@ -0,0 +1,211 @@
+// Package decisions_test contains tests for the decision sink.
+package decisions_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/decisions"
+)
+
+// recordingWriter keeps every batch written to it. If release is set, writes wait until it is closed.
+type recordingWriter struct {
+	mu      sync.Mutex
+	batches [][]decisions.Decision
+	release chan struct{}
+	closed  bool
+}
+
+func (w *recordingWriter) Write(_ context.Context, batch []decisions.Decision) error {
+	if w.release != nil {
+		<-w.release
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.batches = append(w.batches, append([]decisions.Decision(nil), batch...))
+	return nil
+}
+
+func (w *recordingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
+
+// identifiers returns the identifiers of all written decisions, in order.
+func (w *recordingWriter) identifiers() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var ids []string
+	for _, batch := range w.batches {
+		for _, d := range batch {
+			ids = append(ids, d.Identifier)
+		}
+	}
+	return ids
+}
+
+func decision(identifier string) decisions.Decision {
+	return decisions.Decision{Time: time.Now(), LimiterKey: "api", Identifier: identifier, Allowed: true, Status: 200, Cost: 1}
+}
+
+// TestBatching tests that decisions are written in batches of at most the batch size and flushed on Close.
+func TestBatching(t *testing.T) {
+	writer := &recordingWriter{}
+	sink := decisions.NewSink(writer, decisions.WithBatchSize(2), decisions.WithFlushInterval(time.Hour))
+	for _, id := range []string{"a", "b", "c"} {
+		sink.Record(decision(id))
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	if got := writer.identifiers(); len(got) != 3 || got[0] != "a" || got[2] != "c" {
+		t.Errorf("Expected decisions a, b, c in order, got %v", got)
+	}
+	for _, batch := range writer.batches {
+		if len(batch) > 2 {
+			t.Errorf("Expected batches of at most 2 decisions, got %d", len(batch))
+		}
+	}
+	if !writer.closed {
+		t.Error("Expected Close to close the writer")
+	}
+
+	// Decisions recorded after Close are discarded
+	sink.Record(decision("d"))
+	if got := writer.identifiers(); len(got) != 3 {
+		t.Errorf("Expected no decisions written after Close, got %v", got)
+	}
+}
+
+// TestFlushInterval tests that buffered decisions are written once the flush interval passes.
+func TestFlushInterval(t *testing.T) {
+	writer := &recordingWriter{}
+	sink := decisions.NewSink(writer, decisions.WithFlushInterval(10*time.Millisecond))
+	defer sink.Close()
+	sink.Record(decision("a"))
+
+	deadline := time.Now().Add(time.Second)
+	for len(writer.identifiers()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := writer.identifiers(); len(got) != 1 {
+		t.Errorf("Expected the decision to be flushed, got %v", got)
+	}
+}
+
+// TestSampling tests that only about the sampled fraction of decisions is written.
+func TestSampling(t *testing.T) {
+	writer := &recordingWriter{}
+	sink := decisions.NewSink(writer, decisions.WithSampleRate(0.1))
+	for i := 0; i < 2000; i++ {
+		sink.Record(decision("a"))
+	}
+	sink.Close()
+	if got := len(writer.identifiers()); got < 100 || got > 300 {
+		t.Errorf("Expected about 200 of 2000 decisions at a 10%% sample rate, got %d", got)
+	}
+}
+
+// TestOverflow tests the drop policies while the writer is stalled.
+func TestOverflow(t *testing.T) {
+	testCases := []struct {
+		policy decisions.OverflowPolicy
+		want   []string
+	}{
+		{policy: decisions.DropNewest, want: []string{"a", "b", "c"}},
+		{policy: decisions.DropOldest, want: []string{"a", "d", "e"}},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			writer := &recordingWriter{release: make(chan struct{})}
+			sink := decisions.NewSink(writer, decisions.WithBatchSize(1), decisions.WithBuffer(2, tc.policy))
+
+			// The first decision is taken by the stalled writer, so the buffer holds the next two
+			sink.Record(decision("a"))
+			deadline := time.Now().Add(time.Second)
+			for sink.Buffered() > 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			for _, id := range []string{"b", "c", "d", "e"} {
+				sink.Record(decision(id))
+			}
+			close(writer.release)
+			sink.Close()
+
+			got := writer.identifiers()
+			if len(got) != len(tc.want) {
+				t.Fatalf("Expected %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("Expected %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+// TestFileWriter tests that decisions are appended to the file as JSON lines.
+func TestFileWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	writer, err := decisions.NewFileWriter(path)
+	if err != nil {
+		t.Fatalf("NewFileWriter returned error: %v", err)
+	}
+	sink := decisions.NewSink(writer)
+	sink.Record(decision("a"))
+	sink.Record(decision("b"))
+	sink.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open decision log: %v", err)
+	}
+	defer file.Close()
+	var ids []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var d decisions.Decision
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			t.Fatalf("Failed to decode line %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, d.Identifier)
+	}
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("Expected decisions a and b, got %v", ids)
+	}
+}
+
+// TestStreamWriterFields tests that decisions are written as JSON lines with stable field names.
+func TestStreamWriterFields(t *testing.T) {
+	var out strings.Builder
+	writer := decisions.NewStreamWriter(&out, "test")
+	d := decisions.Decision{
+		Time:       time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		LimiterKey: "api",
+		Algorithm:  "token_bucket",
+		Identifier: "client1",
+		Allowed:    false,
+		Status:     429,
+		Cost:       1,
+		Path:       "/items",
+		Tag:        "catalog",
+	}
+	if err := writer.Write(context.Background(), []decisions.Decision{d, d}); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	want := `{"time":"2024-05-01T12:00:00Z","limiter_key":"api","algorithm":"token_bucket","identifier":"client1","allowed":false,"status":429,"cost":1,"path":"/items","tag":"catalog"}` + "\n"
+	if out.String() != want+want {
+		t.Errorf("Unexpected decision log:\n%s\nwant:\n%s", out.String(), want+want)
+	}
+}
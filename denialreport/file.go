@@ -0,0 +1,36 @@
+package denialreport
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// File returns a handler appending each report as a JSON line to the file at path, created if needed. The file is
+// opened for each report, since reports complete once a day, so it can be rotated freely. Failures are logged.
+func File(path string) Handler {
+	return func(report Report) {
+		if err := appendLine(path, report); err != nil {
+			log.Warn().Err(err).Str("path", path).Str("limiter_key", report.LimiterKey).Str("day", report.Day).Msg("DenialReport: Failed to export report")
+		}
+	}
+}
+
+// appendLine appends the report as a JSON line to the file at path.
+func appendLine(path string, report Report) error {
+	line, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("marshal report: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,260 @@
+// Package denialreport computes, per limiter and per day, the fraction of requests denied and the identifiers denied
+// most, so product teams can judge whether limits are too strict, in the manner of an SLO error budget report.
+package denialreport
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+)
+
+// DayLayout is the format of report days, which are UTC calendar days.
+const DayLayout = "2006-01-02"
+
+// rollInterval is how often the reporter checks whether the day has ended.
+const rollInterval = time.Minute
+
+// IdentifierDenials counts the denied requests of one identifier.
+type IdentifierDenials struct {
+	Identifier string `json:"identifier"`
+	Denied     int64  `json:"denied"`
+}
+
+// Report describes the denials of one limiter over one day.
+// Its JSON field names are a stable format ingested by reporting pipelines: add fields, never rename them.
+type Report struct {
+	LimiterKey string `json:"limiter_key"`
+	// Day is the UTC day of the report, formatted with DayLayout.
+	Day string `json:"day"`
+	// Complete is false for the day in progress.
+	Complete bool  `json:"complete"`
+	Requests int64 `json:"requests"`
+	Denied   int64 `json:"denied"`
+	// DeniedFraction is Denied divided by Requests, between 0 and 1.
+	DeniedFraction float64 `json:"denied_fraction"`
+	// TopIdentifiers are the identifiers denied most, most denied first.
+	TopIdentifiers []IdentifierDenials `json:"top_identifiers"`
+	// UntrackedDenials counts the denials of identifiers first denied once the most identifiers tracked per day was
+	// reached; they are missing from TopIdentifiers.
+	UntrackedDenials int64 `json:"untracked_denials,omitempty"`
+}
+
+// Handler is called with the report of each limiter once its day is complete, from the reporter's goroutine.
+// Handlers should return promptly.
+type Handler func(Report)
+
+// day counts the decisions of one limiter over one day.
+type day struct {
+	requests  int64
+	denied    int64
+	untracked int64
+	// identifiers counts the denials of each denied identifier, up to the most identifiers tracked.
+	identifiers map[string]int64
+}
+
+// Reporter counts the decisions of each limiter per UTC day, keeping the reports of the days retained.
+type Reporter struct {
+	retention      int
+	topIdentifiers int
+	maxIdentifiers int
+	handlers       []Handler
+
+	mu       sync.Mutex
+	today    string
+	current  map[string]*day // By limiter key, for today
+	complete []Report        // Reports of the days completed, oldest first
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a reporter as cfg describes, calling handlers with each completed report, and starts closing days as
+// they end. Call Close to stop.
+func New(cfg config.DenialReportConfig, handlers ...Handler) *Reporter {
+	r := &Reporter{
+		retention:      cfg.RetentionDays,
+		topIdentifiers: cfg.TopIdentifiers,
+		maxIdentifiers: cfg.MaxIdentifiers,
+		handlers:       handlers,
+		today:          time.Now().UTC().Format(DayLayout),
+		current:        make(map[string]*day),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	if r.retention <= 0 {
+		r.retention = config.DefaultDenialReportRetentionDays
+	}
+	if r.topIdentifiers <= 0 {
+		r.topIdentifiers = config.DefaultDenialReportTopIdentifiers
+	}
+	if r.maxIdentifiers <= 0 {
+		r.maxIdentifiers = config.DefaultDenialReportMaxIdentifiers
+	}
+	log.Info().Int("retention_days", r.retention).Int("top_identifiers", r.topIdentifiers).Msg("DenialReport: Starting daily denial reports")
+	go r.run()
+	return r
+}
+
+// Observe records a decision of the limiter for the identifier in the current day.
+func (r *Reporter) Observe(limiterKey, identifier string, allowed bool) {
+	r.ObserveAt(limiterKey, identifier, allowed, time.Now())
+}
+
+// ObserveAt records a decision of the limiter for the identifier made at time t, closing the previous day first if
+// t is on a later day.
+func (r *Reporter) ObserveAt(limiterKey, identifier string, allowed bool, t time.Time) {
+	r.mu.Lock()
+	completed := r.roll(t)
+	d, ok := r.current[limiterKey]
+	if !ok {
+		d = &day{identifiers: make(map[string]int64)}
+		r.current[limiterKey] = d
+	}
+	d.requests++
+	if !allowed {
+		d.denied++
+		if _, tracked := d.identifiers[identifier]; tracked || len(d.identifiers) < r.maxIdentifiers {
+			d.identifiers[identifier]++
+		} else {
+			d.untracked++
+		}
+	}
+	r.mu.Unlock()
+	r.report(completed)
+}
+
+// Roll closes the current day if time now is on a later day, and returns the reports completed after passing them
+// to the handlers.
+func (r *Reporter) Roll(now time.Time) []Report {
+	r.mu.Lock()
+	completed := r.roll(now)
+	r.mu.Unlock()
+	r.report(completed)
+	return completed
+}
+
+// Reports returns the reports of the limiter with the given key, or of every limiter if it is empty, for the given
+// day, or every day retained if it is empty, including the day in progress. They are sorted by day, newest first,
+// then by limiter key.
+func (r *Reporter) Reports(limiterKey, day string) []Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reports := []Report{}
+	match := func(report Report) bool {
+		return (limiterKey == "" || report.LimiterKey == limiterKey) && (day == "" || report.Day == day)
+	}
+	for key, d := range r.current {
+		if report := r.build(key, r.today, d, false); match(report) {
+			reports = append(reports, report)
+		}
+	}
+	for _, report := range r.complete {
+		if match(report) {
+			reports = append(reports, report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Day != reports[j].Day {
+			return reports[i].Day > reports[j].Day
+		}
+		return reports[i].LimiterKey < reports[j].LimiterKey
+	})
+	return reports
+}
+
+// Close stops closing days.
+func (r *Reporter) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+	})
+	return nil
+}
+
+// roll completes the current day if now is on a later one, dropping reports older than the retention, and returns
+// the reports completed. The caller holds r.mu.
+func (r *Reporter) roll(now time.Time) []Report {
+	today := now.UTC().Format(DayLayout)
+	if today <= r.today {
+		return nil
+	}
+	completed := make([]Report, 0, len(r.current))
+	for key, d := range r.current {
+		completed = append(completed, r.build(key, r.today, d, true))
+	}
+	sort.Slice(completed, func(i, j int) bool { return completed[i].LimiterKey < completed[j].LimiterKey })
+	r.complete = append(r.complete, completed...)
+	r.today = today
+	r.current = make(map[string]*day)
+
+	// The day in progress counts toward the retention
+	oldest := now.UTC().AddDate(0, 0, 1-r.retention).Format(DayLayout)
+	kept := r.complete[:0]
+	for _, report := range r.complete {
+		if report.Day >= oldest {
+			kept = append(kept, report)
+		}
+	}
+	r.complete = kept
+	return completed
+}
+
+// build computes the report of a limiter's day. The caller holds r.mu.
+func (r *Reporter) build(limiterKey, dayName string, d *day, complete bool) Report {
+	report := Report{
+		LimiterKey:       limiterKey,
+		Day:              dayName,
+		Complete:         complete,
+		Requests:         d.requests,
+		Denied:           d.denied,
+		TopIdentifiers:   make([]IdentifierDenials, 0, min(len(d.identifiers), r.topIdentifiers)),
+		UntrackedDenials: d.untracked,
+	}
+	if d.requests > 0 {
+		report.DeniedFraction = float64(d.denied) / float64(d.requests)
+	}
+	for identifier, denied := range d.identifiers {
+		report.TopIdentifiers = append(report.TopIdentifiers, IdentifierDenials{Identifier: identifier, Denied: denied})
+	}
+	sort.Slice(report.TopIdentifiers, func(i, j int) bool {
+		a, b := report.TopIdentifiers[i], report.TopIdentifiers[j]
+		if a.Denied != b.Denied {
+			return a.Denied > b.Denied
+		}
+		return a.Identifier < b.Identifier
+	})
+	if len(report.TopIdentifiers) > r.topIdentifiers {
+		report.TopIdentifiers = report.TopIdentifiers[:r.topIdentifiers]
+	}
+	return report
+}
+
+// report logs the completed reports and passes them to the handlers.
+func (r *Reporter) report(completed []Report) {
+	for _, report := range completed {
+		log.Info().Str("limiter_key", report.LimiterKey).Str("day", report.Day).Int64("requests", report.Requests).Float64("denied_fraction", report.DeniedFraction).Msg("DenialReport: Daily denial report completed")
+		for _, handler := range r.handlers {
+			handler(report)
+		}
+	}
+}
+
+// run closes the current day once it ends, until the reporter is closed.
+func (r *Reporter) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(rollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			r.Roll(now)
+		case <-r.stop:
+			return
+		}
+	}
+}
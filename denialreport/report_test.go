@@ -0,0 +1,126 @@
+package denialreport_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/denialreport"
+)
+
+// tomorrow returns noon of the UTC day after the current one. Observing it closes the reporter's own day, so tests
+// control every later day.
+func tomorrow() time.Time {
+	y, m, d := time.Now().UTC().AddDate(0, 0, 1).Date()
+	return time.Date(y, m, d, 12, 0, 0, 0, time.UTC)
+}
+
+// TestDailyReport tests that a day's report counts the denials of each limiter and lists the identifiers denied
+// most, and is passed to the handlers once the day ends.
+func TestDailyReport(t *testing.T) {
+	var handled []denialreport.Report
+	r := denialreport.New(config.DenialReportConfig{TopIdentifiers: 2}, func(report denialreport.Report) {
+		handled = append(handled, report)
+	})
+	defer r.Close()
+
+	day := tomorrow()
+	for i := 0; i < 6; i++ {
+		r.ObserveAt("api", "a", false, day)
+	}
+	for i := 0; i < 3; i++ {
+		r.ObserveAt("api", "b", false, day)
+	}
+	r.ObserveAt("api", "c", false, day)
+	for i := 0; i < 10; i++ {
+		r.ObserveAt("api", "d", true, day)
+	}
+	r.ObserveAt("login", "a", true, day)
+	handled = nil
+
+	reports := r.Reports("api", "")
+	if len(reports) != 1 || reports[0].Complete {
+		t.Fatalf("Expected the day in progress, got %+v", reports)
+	}
+
+	completed := r.Roll(day.AddDate(0, 0, 1))
+	if len(completed) != 2 || len(handled) != 2 {
+		t.Fatalf("Expected a report per limiter, got %+v (handled %+v)", completed, handled)
+	}
+	api := completed[0]
+	if api.LimiterKey != "api" || api.Day != day.Format(denialreport.DayLayout) || !api.Complete {
+		t.Errorf("Expected the complete report of api for %s, got %+v", day.Format(denialreport.DayLayout), api)
+	}
+	if api.Requests != 20 || api.Denied != 10 || api.DeniedFraction != 0.5 {
+		t.Errorf("Expected 10 of 20 requests denied, got %d of %d (%v)", api.Denied, api.Requests, api.DeniedFraction)
+	}
+	want := []denialreport.IdentifierDenials{{Identifier: "a", Denied: 6}, {Identifier: "b", Denied: 3}}
+	if len(api.TopIdentifiers) != len(want) || api.TopIdentifiers[0] != want[0] || api.TopIdentifiers[1] != want[1] {
+		t.Errorf("Expected top identifiers %+v, got %+v", want, api.TopIdentifiers)
+	}
+	if login := completed[1]; login.LimiterKey != "login" || login.Denied != 0 || len(login.TopIdentifiers) != 0 {
+		t.Errorf("Expected no denials for login, got %+v", login)
+	}
+}
+
+// TestMaxIdentifiers tests that the denials of identifiers beyond the most tracked are counted as untracked.
+func TestMaxIdentifiers(t *testing.T) {
+	r := denialreport.New(config.DenialReportConfig{MaxIdentifiers: 2})
+	defer r.Close()
+	day := tomorrow()
+	for _, identifier := range []string{"a", "b", "c", "a", "d"} {
+		r.ObserveAt("api", identifier, false, day)
+	}
+	reports := r.Reports("api", day.Format(denialreport.DayLayout))
+	if len(reports) != 1 {
+		t.Fatalf("Expected one report, got %+v", reports)
+	}
+	if reports[0].Denied != 5 || reports[0].UntrackedDenials != 2 || len(reports[0].TopIdentifiers) != 2 {
+		t.Errorf("Expected 5 denials, 2 of them untracked, got %+v", reports[0])
+	}
+}
+
+// TestRetention tests that reports are listed newest first and dropped once older than the retention.
+func TestRetention(t *testing.T) {
+	r := denialreport.New(config.DenialReportConfig{RetentionDays: 2})
+	defer r.Close()
+	day := tomorrow()
+	for i := 0; i < 3; i++ {
+		r.ObserveAt("api", "a", false, day.AddDate(0, 0, i))
+	}
+	reports := r.Reports("", "")
+	if len(reports) != 2 {
+		t.Fatalf("Expected the reports of 2 days, got %+v", reports)
+	}
+	if reports[0].Day != day.AddDate(0, 0, 2).Format(denialreport.DayLayout) || reports[0].Complete {
+		t.Errorf("Expected the day in progress first, got %+v", reports[0])
+	}
+	if reports[1].Day != day.AddDate(0, 0, 1).Format(denialreport.DayLayout) || !reports[1].Complete {
+		t.Errorf("Expected the previous day second, got %+v", reports[1])
+	}
+}
+
+// TestFile tests that completed reports are appended to the export file as JSON lines.
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denials.jsonl")
+	r := denialreport.New(config.DenialReportConfig{}, denialreport.File(path))
+	defer r.Close()
+	day := tomorrow()
+	r.ObserveAt("api", "a", false, day)
+	r.Roll(day.AddDate(0, 0, 1))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	var report denialreport.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Failed to decode export %q: %v", data, err)
+	}
+	if report.LimiterKey != "api" || report.Denied != 1 || !report.Complete {
+		t.Errorf("Expected the report of api, got %+v", report)
+	}
+}
@@ -0,0 +1,116 @@
+// Package dialer opens backend connections (Redis, Memcache) through a proxy or a custom dialer, for environments
+// where the cache tier is only reachable through a SOCKS5 or HTTP proxy, or an SSH tunnel.
+package dialer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DialFunc opens a connection to addr on the named network (e.g., "tcp"), like net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// registered holds the dialers registered by name.
+var registered sync.Map // name -> DialFunc
+
+// Register makes dial available to backend configurations under name (their dialer field), e.g., to open connections
+// through an SSH tunnel set up by the program. Register dialers before loading the configuration that uses them.
+// Registering a name again replaces its dialer.
+func Register(name string, dial DialFunc) {
+	registered.Store(name, dial)
+}
+
+// Lookup returns the dialer registered under name, and false if there is none.
+func Lookup(name string) (DialFunc, bool) {
+	dial, ok := registered.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return dial.(DialFunc), true
+}
+
+// Check reports whether a backend's proxy URL and dialer name are usable, without connecting.
+func Check(proxyURL, name string) error {
+	if name != "" {
+		if _, ok := Lookup(name); !ok {
+			return fmt.Errorf("no dialer registered as '%s'", name)
+		}
+	}
+	if proxyURL != "" {
+		if _, err := parseProxy(proxyURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// New returns the DialFunc of a backend: a direct dial with timeout, or the dialer registered under name if set,
+// tunneled through the proxy at proxyURL if set. It returns nil if neither is set, so clients keep their own dialer.
+func New(proxyURL, name string, timeout time.Duration) (DialFunc, error) {
+	if proxyURL == "" && name == "" {
+		return nil, nil
+	}
+	forward := (&net.Dialer{Timeout: timeout, KeepAlive: 5 * time.Minute}).DialContext
+	if name != "" {
+		dial, ok := Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("no dialer registered as '%s'", name)
+		}
+		forward = dial
+	}
+	if proxyURL == "" {
+		return forward, nil
+	}
+	proxy, err := parseProxy(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		conn, err := forward(ctx, "tcp", proxy.Host)
+		if err != nil {
+			return nil, fmt.Errorf("dial proxy %s: %w", proxy.Host, err)
+		}
+		// The handshake is bounded by the context's deadline, and the connection's deadline is cleared afterwards
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		tunneled := conn
+		if proxy.Scheme == "http" {
+			tunneled, err = connectHTTP(conn, proxy, addr)
+		} else {
+			err = connectSOCKS5(conn, proxy, addr)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("connect to %s through proxy %s: %w", addr, proxy.Host, err)
+		}
+		tunneled.SetDeadline(time.Time{})
+		return tunneled, nil
+	}, nil
+}
+
+// parseProxy parses a socks5:// or http:// proxy URL with an optional user and password.
+func parseProxy(rawURL string) (*url.URL, error) {
+	proxy, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch proxy.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme '%s', expected socks5 or http", proxy.Scheme)
+	}
+	if proxy.Hostname() == "" || proxy.Port() == "" {
+		return nil, fmt.Errorf("proxy URL must include a host and port")
+	}
+	return proxy, nil
+}
@@ -0,0 +1,241 @@
+// Package dialer_test contains tests for proxied backend connections.
+package dialer_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/dialer"
+)
+
+// listen serves each connection accepted on a local port with serve, until the test ends.
+func listen(t *testing.T, serve func(net.Conn)) string {
+	t.Helper()
+	addr, err := listenOn(t, "127.0.0.1", serve)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	return addr
+}
+
+// listenOn serves each connection accepted on a port of host with serve, until the test ends.
+func listenOn(t *testing.T, host string, serve func(net.Conn)) (string, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return "", err
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String(), nil
+}
+
+// echo writes back what it reads.
+func echo(conn net.Conn) {
+	io.Copy(conn, conn)
+}
+
+// tunnel copies between conn and a new connection to target.
+func tunnel(conn net.Conn, target string) {
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+// socks5Proxy returns a SOCKS5 server accepting user "u" with password "p", connecting to the requested port on
+// localhost. requested receives the host name of each request.
+func socks5Proxy(t *testing.T, requested chan<- string) string {
+	return listen(t, func(conn net.Conn) {
+		// read reads a field of n bytes, or of the length given by the byte before it if n is 0
+		var read func(n int) []byte
+		read = func(n int) []byte {
+			if n == 0 {
+				n = int(read(1)[0])
+			}
+			field := make([]byte, n)
+			io.ReadFull(conn, field)
+			return field
+		}
+		read(1) // Version
+		read(0) // Authentication methods
+		conn.Write([]byte{5, 2})
+		read(1) // Authentication version
+		if user, password := read(0), read(0); string(user) != "u" || string(password) != "p" {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+		read(4) // Version, command, reserved and domain address type
+		host := read(0)
+		port := binary.BigEndian.Uint16(read(2))
+		requested <- string(host)
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+		tunnel(conn, net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))))
+	})
+}
+
+// roundTrip checks that dial reaches the echo server at addr.
+func roundTrip(t *testing.T, dial dialer.DialFunc, addr string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+		t.Errorf("Expected ping echoed, got %q (%v)", reply, err)
+	}
+}
+
+// TestSOCKS5 tests that connections are tunneled through an authenticating SOCKS5 proxy, which resolves host names.
+func TestSOCKS5(t *testing.T) {
+	_, port, _ := net.SplitHostPort(listen(t, echo))
+	requested := make(chan string, 1)
+	dial, err := dialer.New("socks5://u:p@"+socks5Proxy(t, requested), "", time.Second)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	roundTrip(t, dial, net.JoinHostPort("cache.internal", port))
+	if host := <-requested; host != "cache.internal" {
+		t.Errorf("Expected the proxy to resolve cache.internal, got %q", host)
+	}
+}
+
+// TestHTTPConnect tests that connections are tunneled through an HTTP proxy with CONNECT.
+func TestHTTPConnect(t *testing.T) {
+	target := listen(t, echo)
+	proxy := listen(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		req, err := http.ReadRequest(reader)
+		if err != nil || req.Method != http.MethodConnect || req.Host != target {
+			conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+			return
+		}
+		if auth := req.Header.Get("Proxy-Authorization"); auth != "" {
+			t.Errorf("Expected no proxy credentials, got %q", auth)
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		tunnel(conn, target)
+	})
+	dial, err := dialer.New("http://"+proxy, "", time.Second)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	roundTrip(t, dial, target)
+
+	// A rejected CONNECT fails the dial and closes the connection to the proxy
+	closed := make(chan struct{})
+	rejecting := listen(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		if _, err := http.ReadRequest(reader); err != nil {
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+		if _, err := reader.ReadByte(); err == io.EOF {
+			close(closed)
+		}
+	})
+	dial, err = dialer.New("http://"+rejecting, "", time.Second)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if conn, err := dial(context.Background(), "tcp", target); err == nil || !strings.Contains(err.Error(), "407") {
+		if conn != nil {
+			conn.Close()
+		}
+		t.Fatalf("Expected the dial to fail with the proxy's 407, got %v", err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("Expected the connection to the proxy to be closed")
+	}
+}
+
+// TestRegisteredDialer tests that a registered dialer opens connections, and that unknown names and invalid proxies
+// are reported.
+func TestRegisteredDialer(t *testing.T) {
+	target := listen(t, echo)
+	used := false
+	dialer.Register("test_tunnel", func(ctx context.Context, network, addr string) (net.Conn, error) {
+		used = true
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	})
+	dial, err := dialer.New("", "test_tunnel", time.Second)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	roundTrip(t, dial, target)
+	if !used {
+		t.Error("Expected the registered dialer to be used")
+	}
+
+	if err := dialer.Check("", "unknown_tunnel"); err == nil {
+		t.Error("Expected an error for an unregistered dialer")
+	}
+	if err := dialer.Check("ftp://proxy:21", ""); err == nil {
+		t.Error("Expected an error for an unsupported proxy scheme")
+	}
+	if dial, err := dialer.New("", "", time.Second); dial != nil || err != nil {
+		t.Errorf("Expected no dialer without proxy or name, got (%v, %v)", dial != nil, err)
+	}
+}
+
+// TestRefreshing tests that a connection to an address the host does not resolve to fails its writes with io.EOF
+// once the host has been resolved, so clients redial, while connections to a resolved address keep working.
+func TestRefreshing(t *testing.T) {
+	stale, err := listenOn(t, "127.0.0.2", echo)
+	if err != nil {
+		t.Skipf("127.0.0.2 is not available: %v", err)
+	}
+	dial := dialer.Refreshing("localhost:6379", time.Millisecond, time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := dial(ctx, "tcp", stale)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	for {
+		_, err := conn.Write([]byte("ping"))
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Expected io.EOF once localhost was resolved, got %v", err)
+		}
+		if ctx.Err() != nil {
+			t.Fatal("Expected the connection to 127.0.0.2 retired")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	roundTrip(t, dial, listen(t, echo))
+}
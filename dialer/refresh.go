@@ -0,0 +1,121 @@
+package dialer
+
+import (
+	"context"
+	"io"
+	"maps"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/metrics"
+)
+
+// Events of backend address refreshes, used as the event label of the refresh metric.
+const (
+	RefreshChanged = "changed"
+	RefreshError   = "error"
+	RefreshRetired = "retired"
+)
+
+// resolution is the set of addresses a host resolved to, and when.
+type resolution struct {
+	addrs map[netip.Addr]bool // nil until the host has been resolved
+	at    time.Time
+}
+
+// refresher re-resolves a host at most once per interval, when its connections are used.
+type refresher struct {
+	address  string // Backend address, as configured
+	host     string
+	interval time.Duration
+
+	current   atomic.Pointer[resolution]
+	resolving atomic.Bool
+}
+
+// Refreshing returns a DialFunc connecting directly to the backend at address (host:port), whose connections retire
+// once the host no longer resolves to their address, e.g., after a managed endpoint failed over. The host is
+// re-resolved at most every interval, when a connection is used. A retired connection fails its next write with
+// io.EOF, before anything is sent, so clients retrying on io.EOF (e.g., go-redis) redial to a current address.
+// Addresses that are IPs never change, so their connections are not wrapped.
+func Refreshing(address string, interval, timeout time.Duration) DialFunc {
+	netDialer := &net.Dialer{Timeout: timeout, KeepAlive: 5 * time.Minute}
+	host, _, err := net.SplitHostPort(address)
+	if _, ipErr := netip.ParseAddr(host); err != nil || ipErr == nil {
+		return netDialer.DialContext
+	}
+	r := &refresher{address: address, host: host, interval: interval}
+	r.current.Store(&resolution{})
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := netDialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		remote, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+		if err != nil {
+			return conn, nil
+		}
+		r.stale(remote.Addr().Unmap(), time.Now())
+		return &refreshingConn{Conn: conn, refresher: r, addr: remote.Addr().Unmap()}, nil
+	}
+}
+
+// stale reports whether the host no longer resolves to addr, starting a resolution in the background if the last
+// one is older than the interval. Until the host has been resolved, no address is stale.
+func (r *refresher) stale(addr netip.Addr, now time.Time) bool {
+	current := r.current.Load()
+	if now.Sub(current.at) >= r.interval && r.resolving.CompareAndSwap(false, true) {
+		go r.resolve()
+	}
+	return current.addrs != nil && !current.addrs[addr]
+}
+
+// resolve looks the host up and records the addresses it resolves to. Failed lookups keep the previous addresses.
+func (r *refresher) resolve() {
+	defer r.resolving.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	previous := r.current.Load()
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", r.host)
+	if err != nil || len(ips) == 0 {
+		log.Warn().Err(err).Str("address", r.address).Msg("Dialer: Failed to re-resolve backend address")
+		metrics.RecordBackendRefresh(r.address, RefreshError)
+		r.current.Store(&resolution{addrs: previous.addrs, at: time.Now()})
+		return
+	}
+	addrs := make(map[netip.Addr]bool, len(ips))
+	for _, ip := range ips {
+		addrs[ip.Unmap()] = true
+	}
+	if previous.addrs != nil && !maps.Equal(addrs, previous.addrs) {
+		log.Info().Str("address", r.address).Int("addresses", len(addrs)).Msg("Dialer: Backend address resolves to new addresses, retiring connections to old ones")
+		metrics.RecordBackendRefresh(r.address, RefreshChanged)
+	}
+	r.current.Store(&resolution{addrs: addrs, at: time.Now()})
+}
+
+// refreshingConn is a connection that retires once its address is stale.
+type refreshingConn struct {
+	net.Conn
+	refresher *refresher
+	addr      netip.Addr
+	retired   bool
+}
+
+// Write writes to the connection, or closes it and returns io.EOF if its address is stale.
+func (c *refreshingConn) Write(p []byte) (int, error) {
+	if c.retired {
+		return 0, io.EOF
+	}
+	if c.refresher.stale(c.addr, time.Now()) {
+		c.retired = true
+		c.Conn.Close()
+		metrics.RecordBackendRefresh(c.refresher.address, RefreshRetired)
+		return 0, io.EOF
+	}
+	return c.Conn.Write(p)
+}
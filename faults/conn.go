@@ -0,0 +1,46 @@
+package faults
+
+import (
+	"context"
+	"net"
+)
+
+// DialFunc creates network connections, like net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Dial returns a DialFunc creating connections with dial that inject the faults currently set, for clients without
+// command hooks such as the Memcache client. Each write, carrying one command or several pipelined ones, is delayed
+// by the latency and failed before it is sent at the error rate; each successful read fails at the partial rate,
+// after the server executed the commands it answers.
+func (i *Injector) Dial(dial DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &faultyConn{Conn: conn, injector: i}, nil
+	}
+}
+
+// faultyConn is a connection injecting the faults of its injector into its writes and reads.
+type faultyConn struct {
+	net.Conn
+	injector *Injector
+}
+
+// Write delays the write and fails it before it is sent at the error rate.
+func (c *faultyConn) Write(p []byte) (int, error) {
+	if err := c.injector.before(context.Background()); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(p)
+}
+
+// Read fails the read at the partial rate, as when a reply is lost.
+func (c *faultyConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err == nil && hit(c.injector.faults.Load().PartialRate) {
+		return 0, ErrInjected
+	}
+	return n, err
+}
@@ -0,0 +1,7 @@
+//go:build chaos
+
+package faults
+
+// Enabled reports whether the build serves fault injection at runtime (e.g., through the admin API). It is only set
+// in builds with the chaos tag, so production builds cannot inject faults; tests can use an Injector in every build.
+const Enabled = true
@@ -0,0 +1,137 @@
+// Package faults injects latency and failures into the commands sent to Redis and Memcache, so fail-open and other
+// failure handling can be exercised realistically in tests and staging. An Injector is a go-redis hook: add it to a
+// client with AddHook, or to every limiter client with api.WithFaults. Clients without hooks, such as the Memcache
+// client, dial through Injector.Dial instead. It injects nothing until faults are set.
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// ErrInjected is the error of the commands failed by an injector.
+var ErrInjected = errors.New("faults: injected backend failure")
+
+// Faults describes the faults injected into each command, or each pipeline for latency.
+type Faults struct {
+	// Latency delays every command before it is sent.
+	Latency time.Duration
+	// Jitter adds a random delay of up to Jitter to Latency.
+	Jitter time.Duration
+	// ErrorRate is the fraction of commands failed with ErrInjected before they are sent, between 0 and 1.
+	// A pipeline fails as a whole.
+	ErrorRate float64
+	// PartialRate is the fraction of commands failed with ErrInjected after Redis executed them, between 0 and 1, as
+	// when a reply is lost: their writes apply although they fail. Each command of a pipeline fails independently.
+	PartialRate float64
+}
+
+// Validate checks that the durations are not negative and the rates are between 0 and 1.
+func (f Faults) Validate() error {
+	if f.Latency < 0 || f.Jitter < 0 {
+		return fmt.Errorf("latency and jitter must not be negative")
+	}
+	if f.ErrorRate < 0 || f.ErrorRate > 1 || f.PartialRate < 0 || f.PartialRate > 1 {
+		return fmt.Errorf("error_rate and partial_rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// Injector injects the faults currently set into the commands of the clients it is added to. It is safe for
+// concurrent use, and faults can be changed while commands run.
+type Injector struct {
+	faults atomic.Pointer[Faults]
+}
+
+var _ redis.Hook = (*Injector)(nil)
+
+// New creates an injector injecting no fault.
+func New() *Injector {
+	i := &Injector{}
+	i.faults.Store(&Faults{})
+	return i
+}
+
+// Set replaces the faults injected from now on.
+func (i *Injector) Set(f Faults) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	i.faults.Store(&f)
+	log.Warn().Dur("latency", f.Latency).Dur("jitter", f.Jitter).Float64("error_rate", f.ErrorRate).Float64("partial_rate", f.PartialRate).Msg("Faults: Injecting backend faults")
+	return nil
+}
+
+// Clear stops injecting faults.
+func (i *Injector) Clear() {
+	i.faults.Store(&Faults{})
+	log.Info().Msg("Faults: Backend fault injection cleared")
+}
+
+// Faults returns the faults currently injected.
+func (i *Injector) Faults() Faults {
+	return *i.faults.Load()
+}
+
+// BeforeProcess delays the command and fails it before it is sent at the error rate.
+func (i *Injector) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, i.before(ctx)
+}
+
+// AfterProcess fails the executed command at the partial rate.
+func (i *Injector) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if cmd.Err() == nil && hit(i.faults.Load().PartialRate) {
+		return ErrInjected
+	}
+	return nil
+}
+
+// BeforeProcessPipeline delays the pipeline and fails it as a whole before it is sent at the error rate.
+func (i *Injector) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, i.before(ctx)
+}
+
+// AfterProcessPipeline fails each executed command of the pipeline at the partial rate, leaving the others' replies.
+func (i *Injector) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	rate := i.faults.Load().PartialRate
+	for _, cmd := range cmds {
+		if cmd.Err() == nil && hit(rate) {
+			cmd.SetErr(ErrInjected)
+		}
+	}
+	return nil
+}
+
+// before waits for the latency, or until ctx is done, then fails at the error rate.
+func (i *Injector) before(ctx context.Context) error {
+	f := i.faults.Load()
+	delay := f.Latency
+	if f.Jitter > 0 {
+		delay += rand.N(f.Jitter)
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if hit(f.ErrorRate) {
+		return ErrInjected
+	}
+	return nil
+}
+
+// hit reports whether a fault with the given rate occurs.
+func hit(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
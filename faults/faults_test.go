@@ -0,0 +1,135 @@
+// Package faults_test contains tests for backend fault injection.
+package faults_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/faults"
+	"learn.ratelimiter/internal/testenv"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testenv.Cleanup()
+	os.Exit(code)
+}
+
+// TestValidate tests that negative durations and rates outside [0, 1] are rejected.
+func TestValidate(t *testing.T) {
+	injector := faults.New()
+	for _, f := range []faults.Faults{{Latency: -time.Second}, {Jitter: -time.Second}, {ErrorRate: 1.5}, {PartialRate: -0.1}} {
+		if err := injector.Set(f); err == nil {
+			t.Errorf("Expected %+v rejected", f)
+		}
+	}
+	if got := injector.Faults(); got != (faults.Faults{}) {
+		t.Errorf("Expected no fault injected after rejected sets, got %+v", got)
+	}
+}
+
+// TestErrorsAndLatency tests that commands fail before being sent at the error rate, and are delayed by the latency.
+func TestErrorsAndLatency(t *testing.T) {
+	injector := faults.New()
+	// Nothing listens on the address, so any command reaching the network would fail with another error
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+	client.AddHook(injector)
+
+	if err := injector.Set(faults.Faults{ErrorRate: 1}); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	if err := client.Get(context.Background(), "key").Err(); !errors.Is(err, faults.ErrInjected) {
+		t.Errorf("Expected the injected error, got %v", err)
+	}
+	pipe := client.Pipeline()
+	get := pipe.Get(context.Background(), "key")
+	pipe.Exec(context.Background())
+	if !errors.Is(get.Err(), faults.ErrInjected) {
+		t.Errorf("Expected the pipeline failed by the injected error, got %v", get.Err())
+	}
+
+	if err := injector.Set(faults.Faults{Latency: time.Hour}); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := client.Get(ctx, "key").Err(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the delayed command to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected the command delayed until its deadline, took %s", elapsed)
+	}
+}
+
+// TestPartialFailures tests that commands failed after execution still apply their writes.
+func TestPartialFailures(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	defer client.Close()
+	injector := faults.New()
+	client.AddHook(injector)
+	ctx := context.Background()
+	key := fmt.Sprintf("faults_%d", time.Now().UnixNano())
+	defer client.Del(ctx, key)
+
+	if err := injector.Set(faults.Faults{PartialRate: 1}); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	if err := client.Incr(ctx, key).Err(); !errors.Is(err, faults.ErrInjected) {
+		t.Errorf("Expected the injected error, got %v", err)
+	}
+	injector.Clear()
+	if value, err := client.Get(ctx, key).Int(); err != nil || value != 1 {
+		t.Errorf("Expected the failed write applied, got (%d, %v)", value, err)
+	}
+}
+
+// TestDial tests that connections created by Dial fail writes before they are sent at the error rate, and reads of
+// delivered replies at the partial rate.
+func TestDial(t *testing.T) {
+	injector := faults.New()
+	server := make(chan net.Conn, 1)
+	dial := injector.Dial(func(context.Context, string, string) (net.Conn, error) {
+		client, peer := net.Pipe()
+		server <- peer
+		return client, nil
+	})
+	conn, err := dial(context.Background(), "tcp", "memcache:11211")
+	if err != nil {
+		t.Fatalf("Dial returned error: %v", err)
+	}
+	defer conn.Close()
+	peer := <-server
+	defer peer.Close()
+
+	if err := injector.Set(faults.Faults{ErrorRate: 1}); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	// The pipe is unbuffered, so a write reaching it would block without a reader
+	if _, err := conn.Write([]byte("get key\r\n")); !errors.Is(err, faults.ErrInjected) {
+		t.Errorf("Expected the injected error, got %v", err)
+	}
+
+	if err := injector.Set(faults.Faults{PartialRate: 1}); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	go func() {
+		buf := make([]byte, 64)
+		n, _ := peer.Read(buf)
+		peer.Write(buf[:n])
+	}()
+	if _, err := conn.Write([]byte("get key\r\n")); err != nil {
+		t.Fatalf("Expected the write sent, got %v", err)
+	}
+	if _, err := conn.Read(make([]byte, 64)); !errors.Is(err, faults.ErrInjected) {
+		t.Errorf("Expected the delivered reply failed by the injected error, got %v", err)
+	}
+}
@@ -11,6 +11,7 @@ require (
 require (
 	github.com/bradfitz/gomemcache v0.0.0-20250403215159-8d39553ac7cf
 	github.com/prometheus/client_golang v1.22.0
+	google.golang.org/protobuf v1.36.5
 )
 
 require (
@@ -25,5 +26,4 @@ require (
 	github.com/prometheus/common v0.62.0 // indirect
 	github.com/prometheus/procfs v0.15.1 // indirect
 	golang.org/x/sys v0.30.0 // indirect
-	google.golang.org/protobuf v1.36.5 // indirect
 )
@@ -0,0 +1,144 @@
+// Package backendkey composes the keys limiters store state under in remote backends (e.g., "api:user1"
+// for the limiter key "api" and the identifier "user1"). Keys are built in pooled buffers, and the keys of the
+// most frequent identifiers can be cached, since formatting a key on every check shows up in profiles at high request rates.
+package backendkey
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Separator separates the parts of a key.
+const Separator = ":"
+
+// bufferPool holds the buffers keys are composed in.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 128)
+		return &buf
+	},
+}
+
+// Builder composes the keys of one limiter from a fixed prefix and identifiers.
+type Builder struct {
+	prefix string
+	cache  *cache // nil if caching is disabled
+}
+
+// NewBuilder creates a builder of keys made of the given parts followed by the identifier, all joined by Separator.
+// If cacheSize is positive, up to cacheSize keys of the most frequent identifiers are cached.
+func NewBuilder(cacheSize int, parts ...string) *Builder {
+	b := &Builder{prefix: join(parts...) + Separator}
+	if cacheSize > 0 {
+		b.cache = &cache{size: cacheSize}
+	}
+	return b
+}
+
+// Key returns the key for identifier.
+func (b *Builder) Key(identifier string) string {
+	if b.cache == nil {
+		return b.compose(identifier)
+	}
+	if key, ok := b.cache.get(identifier); ok {
+		return key
+	}
+	key := b.compose(identifier)
+	// Index the cache by the identifier within the key, so it does not keep the caller's string alive
+	b.cache.add(key[len(b.prefix):], key)
+	return key
+}
+
+// compose builds the key for identifier in a pooled buffer, allocating only the returned string.
+func (b *Builder) compose(identifier string) string {
+	bufp := bufferPool.Get().(*[]byte)
+	buf := append(append((*bufp)[:0], b.prefix...), identifier...)
+	key := string(buf)
+	*bufp = buf
+	bufferPool.Put(bufp)
+	return key
+}
+
+// join joins parts with Separator in a pooled buffer.
+func join(parts ...string) string {
+	bufp := bufferPool.Get().(*[]byte)
+	buf := (*bufp)[:0]
+	for i, part := range parts {
+		if i > 0 {
+			buf = append(buf, Separator...)
+		}
+		buf = append(buf, part...)
+	}
+	key := string(buf)
+	*bufp = buf
+	bufferPool.Put(bufp)
+	return key
+}
+
+// maxHits caps the hit count of a cached key, so hot keys stop writing to a shared counter.
+const maxHits = 255
+
+// cachedKey is a cached key and the number of hits since the last sweep.
+type cachedKey struct {
+	key  string
+	hits atomic.Uint32
+}
+
+// cache holds up to size keys by identifier. Once full, every size misses it sweeps out the keys not hit since
+// the previous sweep and halves the hit counts of the others, so frequent identifiers stay while rare ones make room.
+type cache struct {
+	size int
+
+	keys sync.Map // identifier -> *cachedKey
+
+	mu     sync.Mutex // Serializes additions and sweeps
+	count  int
+	misses int // Misses since the last sweep while full
+}
+
+// get returns the cached key for identifier.
+func (c *cache) get(identifier string) (string, bool) {
+	v, ok := c.keys.Load(identifier)
+	if !ok {
+		return "", false
+	}
+	entry := v.(*cachedKey)
+	if entry.hits.Load() < maxHits {
+		entry.hits.Add(1)
+	}
+	return entry.key, true
+}
+
+// add caches the key for identifier if there is room, sweeping the cache when it has been full for size misses.
+func (c *cache) add(identifier, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.count >= c.size {
+		c.misses++
+		if c.misses < c.size {
+			return
+		}
+		c.sweep()
+		if c.count >= c.size {
+			return
+		}
+	}
+	if _, loaded := c.keys.LoadOrStore(identifier, &cachedKey{key: key}); !loaded {
+		c.count++
+	}
+}
+
+// sweep removes the keys not hit since the previous sweep and halves the hit counts of the others.
+func (c *cache) sweep() {
+	c.misses = 0
+	c.keys.Range(func(identifier, v interface{}) bool {
+		entry := v.(*cachedKey)
+		if hits := entry.hits.Load(); hits == 0 {
+			c.keys.Delete(identifier)
+			c.count--
+		} else {
+			entry.hits.Store(hits / 2)
+		}
+		return true
+	})
+}
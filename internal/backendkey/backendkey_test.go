@@ -0,0 +1,59 @@
+// Package backendkey_test contains tests for the backend key builder.
+package backendkey_test
+
+import (
+	"fmt"
+	"testing"
+
+	"learn.ratelimiter/internal/backendkey"
+)
+
+// TestBuilderKey tests that keys join the parts and the identifier, with and without caching.
+func TestBuilderKey(t *testing.T) {
+	for _, cacheSize := range []int{0, 2} {
+		b := backendkey.NewBuilder(cacheSize, "leaky_bucket", "api")
+		for i := 0; i < 3; i++ {
+			for _, identifier := range []string{"user1", "user2", "user3", ""} {
+				if key, want := b.Key(identifier), "leaky_bucket:api:"+identifier; key != want {
+					t.Errorf("Expected key %q with cache size %d, got %q", want, cacheSize, key)
+				}
+			}
+		}
+	}
+}
+
+// TestBuilderCachesFrequentKeys tests that cached keys are returned without allocating, and that frequent
+// identifiers keep their place in a full cache while rare ones pass through.
+func TestBuilderCachesFrequentKeys(t *testing.T) {
+	b := backendkey.NewBuilder(2, "api")
+	b.Key("hot1")
+	b.Key("hot2")
+	for i := 0; i < 100; i++ {
+		b.Key("hot1")
+		b.Key("hot2")
+		b.Key(fmt.Sprintf("rare%d", i))
+	}
+	for _, identifier := range []string{"hot1", "hot2"} {
+		if allocs := testing.AllocsPerRun(100, func() { b.Key(identifier) }); allocs != 0 {
+			t.Errorf("Expected the key of frequent identifier %s to be cached, got %v allocations per call", identifier, allocs)
+		}
+	}
+	if key := b.Key("rare"); key != "api:rare" {
+		t.Errorf("Expected key api:rare, got %q", key)
+	}
+}
+
+// BenchmarkBuilderKey measures composing keys with and without caching, run with -benchmem to report allocations.
+func BenchmarkBuilderKey(b *testing.B) {
+	for _, cacheSize := range []int{0, 1024} {
+		b.Run(fmt.Sprintf("cache=%d", cacheSize), func(b *testing.B) {
+			builder := backendkey.NewBuilder(cacheSize, "api")
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					builder.Key("user1")
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// Package bulkhead provides a limiter decorator capping the number of simultaneous calls to a limiter's backend,
+// so a slow backend (e.g., Redis) cannot consume all server goroutines and connections.
+package bulkhead
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// Limiter delegates to a limiter while fewer than the configured number of calls are in flight.
+// Requests arriving at capacity do not wait: they are allowed (fail open) or rejected with types.ErrBackendSaturated (fail closed).
+type Limiter struct {
+	key      string // Limiter key from config
+	limiter  types.Limiter
+	slots    chan struct{}
+	failOpen bool
+}
+
+// NewLimiter creates a bulkhead around limiter allowing cfg.MaxInFlight simultaneous calls.
+func NewLimiter(key string, limiter types.Limiter, cfg config.BulkheadConfig) *Limiter {
+	return &Limiter{
+		key:      key,
+		limiter:  limiter,
+		slots:    make(chan struct{}, cfg.MaxInFlight),
+		failOpen: cfg.FailureMode == config.FailOpen,
+	}
+}
+
+// Allow checks if a request for the given identifier is allowed, applying the failure mode if the bulkhead is full.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	if !l.acquire(identifier) {
+		return l.saturated()
+	}
+	defer l.release()
+	return l.limiter.Allow(ctx, identifier)
+}
+
+// AllowN checks if a request costing n units is allowed, applying the failure mode if the bulkhead is full.
+// Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	if err := types.CheckCost(n); err != nil {
+		return false, err
+	}
+	if !l.acquire(identifier) {
+		return l.saturated()
+	}
+	defer l.release()
+	if costLimiter, ok := l.limiter.(types.CostLimiter); ok {
+		return costLimiter.AllowN(ctx, identifier, n)
+	}
+	return l.limiter.Allow(ctx, identifier)
+}
+
+// AllowAt checks if a request is allowed at time t, applying the failure mode if the bulkhead is full.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	timeLimiter, ok := l.limiter.(types.TimeLimiter)
+	if !ok {
+		return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+	}
+	if !l.acquire(identifier) {
+		return l.saturated()
+	}
+	defer l.release()
+	return timeLimiter.AllowAt(ctx, identifier, t)
+}
+
+// AllowKey checks if a request for the composite key is allowed, applying the failure mode if the bulkhead is full.
+func (l *Limiter) AllowKey(ctx context.Context, key types.Key) (bool, error) {
+	if !l.acquire(key.String()) {
+		return l.saturated()
+	}
+	defer l.release()
+	return types.AllowKey(ctx, l.limiter, key)
+}
+
+// Forget drops the identifier's state in the wrapped limiter. It takes no slot, since it makes no backend call.
+func (l *Limiter) Forget(identifier string) {
+	types.Forget(l.limiter, identifier)
+}
+
+// Pressure returns the fraction of the identifier's budget in use. Reading it takes a slot like a check does;
+// at capacity it fails with types.ErrBackendSaturated whatever the failure mode, since there is no decision to fail open.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	if !l.acquire(identifier) {
+		return 0, types.ErrBackendSaturated
+	}
+	defer l.release()
+	return types.Pressure(ctx, l.limiter, identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget is fully restored, taking a slot like Pressure does.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	if !l.acquire(identifier) {
+		return time.Time{}, types.ErrBackendSaturated
+	}
+	defer l.release()
+	return types.ResetTime(ctx, l.limiter, identifier)
+}
+
+// Reserve reserves a request costing n units, applying the failure mode if the bulkhead is full.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Reservation{}, err
+	}
+	if !l.acquire(identifier) {
+		allowed, err := l.saturated()
+		return types.Reservation{OK: allowed}, err
+	}
+	defer l.release()
+	return types.Reserve(ctx, l.limiter, identifier, n, maxWait)
+}
+
+// AllowDetailed checks a request costing n units with its result, applying the failure mode if the bulkhead is full.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
+	if !l.acquire(identifier) {
+		allowed, err := l.saturated()
+		return types.Result{Allowed: allowed, Limit: -1, Remaining: -1}, err
+	}
+	defer l.release()
+	return types.AllowDetailed(ctx, l.limiter, identifier, n)
+}
+
+// InFlight returns the number of backend calls currently in flight.
+func (l *Limiter) InFlight() int {
+	return len(l.slots)
+}
+
+// acquire takes a slot without waiting and reports whether one was free.
+func (l *Limiter) acquire(identifier string) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		log.Warn().Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Int("max_in_flight", cap(l.slots)).Bool("fail_open", l.failOpen).Msg("Bulkhead: Backend calls at capacity, applying failure mode")
+		return false
+	}
+}
+
+// release frees the slot taken by acquire.
+func (l *Limiter) release() {
+	<-l.slots
+}
+
+// saturated returns the outcome of the failure mode for a request arriving at capacity.
+func (l *Limiter) saturated() (bool, error) {
+	if l.failOpen {
+		metrics.RecordBulkheadSaturated(l.key, string(config.FailOpen))
+		return true, nil
+	}
+	metrics.RecordBulkheadSaturated(l.key, string(config.FailClosed))
+	return false, types.ErrBackendSaturated
+}
@@ -0,0 +1,65 @@
+// Package bulkhead_test contains tests for the bulkhead limiter.
+package bulkhead_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/bulkhead"
+	"learn.ratelimiter/types"
+)
+
+// blockingLimiter allows every request once release is closed, simulating a slow backend.
+type blockingLimiter struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return true, nil
+}
+
+// TestBulkheadFailureMode tests that requests arriving while the backend calls are at capacity get the failure mode immediately.
+func TestBulkheadFailureMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode    config.FailureMode
+		allowed bool
+		err     error
+	}{
+		{mode: config.FailClosed, allowed: false, err: types.ErrBackendSaturated},
+		{mode: config.FailOpen, allowed: true, err: nil},
+	} {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			backend := &blockingLimiter{started: make(chan struct{}, 2), release: make(chan struct{})}
+			limiter := bulkhead.NewLimiter("test_bulkhead", backend, config.BulkheadConfig{MaxInFlight: 2, FailureMode: tc.mode})
+
+			done := make(chan struct{})
+			for i := 0; i < 2; i++ {
+				go func() {
+					limiter.Allow(context.Background(), "client1")
+					done <- struct{}{}
+				}()
+				<-backend.started
+			}
+			if n := limiter.InFlight(); n != 2 {
+				t.Fatalf("Expected 2 calls in flight, got %d", n)
+			}
+
+			allowed, err := limiter.Allow(context.Background(), "client1")
+			if allowed != tc.allowed || !errors.Is(err, tc.err) {
+				t.Errorf("Expected (%v, %v) at capacity, got (%v, %v)", tc.allowed, tc.err, allowed, err)
+			}
+
+			close(backend.release)
+			<-done
+			<-done
+			if allowed, err := limiter.Allow(context.Background(), "client1"); !allowed || err != nil {
+				t.Errorf("Expected request to reach the backend once calls completed, got (%v, %v)", allowed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Package capped provides a limiter allowing a request only if both a limiter and a cap on top of it allow it, e.g., a
+// token bucket absorbing bursts and a per-minute fixed window bounding the sustained rate.
+package capped
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/types"
+)
+
+// Limiter checks the limiter first and the cap only for requests it allowed, so requests denied by the limiter do not
+// consume the cap. Requests denied by the cap have consumed the limiter's budget; with a token bucket absorbing bursts,
+// that budget refills within seconds while the cap's window lasts a minute.
+type Limiter struct {
+	key     string // Limiter key from config
+	limiter types.Limiter
+	cap     types.Limiter
+	// capPolicy names the cap in the results of the requests it denies (see types.Result.Policy).
+	capPolicy string
+}
+
+// Option configures optional behaviour of a Limiter.
+type Option func(*Limiter)
+
+// WithCapPolicy names the cap policy in the detailed results of the requests the cap denies, e.g., the key its
+// state is stored under, so clients can tell them from requests denied by the limiter.
+func WithCapPolicy(policy string) Option {
+	return func(l *Limiter) {
+		l.capPolicy = policy
+	}
+}
+
+// NewLimiter creates a limiter applying cap on top of limiter.
+func NewLimiter(key string, limiter, cap types.Limiter, opts ...Option) *Limiter {
+	log.Info().Str("limiter_key", key).Msg("Limiter: Initialized with a cap")
+	l := &Limiter{key: key, limiter: limiter, cap: cap}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Allow checks if a request for the identifier is allowed by both the limiter and the cap.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.check(func(limiter types.Limiter) (bool, error) {
+		return limiter.Allow(ctx, identifier)
+	})
+}
+
+// AllowN checks if a request costing n units for the identifier is allowed by both the limiter and the cap, charging n
+// units to each. Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	return l.check(func(limiter types.Limiter) (bool, error) {
+		if costLimiter, ok := limiter.(types.CostLimiter); ok {
+			return costLimiter.AllowN(ctx, identifier, n)
+		}
+		return limiter.Allow(ctx, identifier)
+	})
+}
+
+// AllowAt checks if a request for the identifier is allowed at time t by both the limiter and the cap.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	return l.check(func(limiter types.Limiter) (bool, error) {
+		timeLimiter, ok := limiter.(types.TimeLimiter)
+		if !ok {
+			return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+		}
+		return timeLimiter.AllowAt(ctx, identifier, t)
+	})
+}
+
+// AllowKey checks if a request for the composite key is allowed by both the limiter and the cap.
+func (l *Limiter) AllowKey(ctx context.Context, key types.Key) (bool, error) {
+	return l.check(func(limiter types.Limiter) (bool, error) {
+		return types.AllowKey(ctx, limiter, key)
+	})
+}
+
+// KeyCount returns the key count of the limiter, and false if it cannot tell.
+func (l *Limiter) KeyCount() (int, bool) {
+	if keyCounter, ok := l.limiter.(types.KeyCounter); ok {
+		return keyCounter.KeyCount()
+	}
+	return 0, false
+}
+
+// Pressure returns the larger fraction of the identifier's budget in use in the limiter and the cap, or the limiter's
+// alone if the cap cannot tell.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	pressure, err := types.Pressure(ctx, l.limiter, identifier)
+	if err != nil {
+		return 0, err
+	}
+	if capPressure, err := types.Pressure(ctx, l.cap, identifier); err == nil {
+		pressure = max(pressure, capPressure)
+	}
+	return pressure, nil
+}
+
+// ResetTime returns the later time at which the identifier's budget is fully restored in the limiter and the cap, or
+// the limiter's alone if the cap cannot tell.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	reset, err := types.ResetTime(ctx, l.limiter, identifier)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if capReset, err := types.ResetTime(ctx, l.cap, identifier); err == nil && capReset.After(reset) {
+		reset = capReset
+	}
+	return reset, nil
+}
+
+// Reserve reserves a request costing n units in the limiter, then in the cap if the limiter admitted it, waiting for
+// the later of the two. Like the other checks, units the limiter reserved are not returned if the cap denies them.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	reservation, err := types.Reserve(ctx, l.limiter, identifier, n, maxWait)
+	if err != nil || !reservation.OK {
+		return reservation, err
+	}
+	capReservation, err := types.Reserve(ctx, l.cap, identifier, n, max(maxWait-reservation.Delay, 0))
+	if err != nil || !capReservation.OK {
+		return capReservation, err
+	}
+	return types.Reservation{OK: true, Delay: max(reservation.Delay, capReservation.Delay)}, nil
+}
+
+// AllowDetailed checks a request costing n units in the limiter, then in the cap if the limiter allowed it. The result
+// is the tighter of the two: the smaller budget left, the later reset and the longer retry. A request denied by the cap
+// is attributed to the cap policy (see WithCapPolicy).
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	result, err := types.AllowDetailed(ctx, l.limiter, identifier, n)
+	if err != nil || !result.Allowed {
+		return result, err
+	}
+	capResult, err := types.AllowDetailed(ctx, l.cap, identifier, n)
+	if err != nil {
+		return capResult, err
+	}
+	if capResult.Remaining >= 0 && (result.Remaining < 0 || capResult.Remaining < result.Remaining) {
+		result.Limit, result.Remaining = capResult.Limit, capResult.Remaining
+	}
+	if capResult.ResetAt.After(result.ResetAt) {
+		result.ResetAt = capResult.ResetAt
+	}
+	result.Allowed = capResult.Allowed
+	result.RetryAfter = max(result.RetryAfter, capResult.RetryAfter)
+	if !result.Allowed {
+		result.Policy = cmp.Or(capResult.Policy, l.capPolicy)
+	}
+	return result, nil
+}
+
+// Stats returns the requests allowed and denied for the identifier by the limiter.
+func (l *Limiter) Stats(ctx context.Context, identifier string) (types.IdentifierStats, error) {
+	return types.Stats(ctx, l.limiter, identifier)
+}
+
+// Forget drops the identifier's state in the limiter and the cap, if they keep it.
+func (l *Limiter) Forget(identifier string) {
+	types.Forget(l.limiter, identifier)
+	types.Forget(l.cap, identifier)
+}
+
+// check applies the check to the limiter, then to the cap if the limiter allowed the request.
+func (l *Limiter) check(apply func(types.Limiter) (bool, error)) (bool, error) {
+	allowed, err := apply(l.limiter)
+	if err != nil || !allowed {
+		return allowed, err
+	}
+	return apply(l.cap)
+}
@@ -0,0 +1,42 @@
+// Package capped_test contains tests for applying a cap on top of a limiter.
+package capped_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/internal/capped"
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/types"
+)
+
+// TestCapped tests that requests need both the limiter and the cap, and that requests denied by the limiter do not
+// consume the cap.
+func TestCapped(t *testing.T) {
+	burst := fcinmemory.NewLimiter("test_capped", time.Minute, 2)
+	cap := fcinmemory.NewLimiter("test_capped:per_minute", time.Minute, 3)
+	limiter := capped.NewLimiter("test_capped", burst, cap)
+	ctx := context.Background()
+
+	for i, want := range []bool{true, true, false, false} {
+		if allowed, err := limiter.Allow(ctx, "client1"); allowed != want || err != nil {
+			t.Fatalf("Request %d: expected (%v, nil), got (%v, %v)", i, want, allowed, err)
+		}
+	}
+	if pressure, _ := types.Pressure(ctx, cap, "client1"); pressure >= 1 {
+		t.Errorf("Expected requests denied by the limiter not to consume the cap, pressure %v", pressure)
+	}
+	if pressure, _ := limiter.Pressure(ctx, "client1"); pressure != 1 {
+		t.Errorf("Expected the limiter's exhausted budget as pressure, got %v", pressure)
+	}
+
+	// The cap denies what the limiter allows
+	limiter = capped.NewLimiter("test_capped", fcinmemory.NewLimiter("test_capped", time.Minute, 10), cap)
+	if allowed, _ := limiter.Allow(ctx, "client1"); !allowed {
+		t.Fatal("Expected the third request within the cap allowed")
+	}
+	if allowed, _ := limiter.Allow(ctx, "client1"); allowed {
+		t.Error("Expected the request over the cap denied")
+	}
+}
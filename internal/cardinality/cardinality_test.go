@@ -0,0 +1,81 @@
+// Package cardinality_test contains tests for the distinct identifier estimates.
+package cardinality_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/internal/cardinality"
+	"learn.ratelimiter/internal/testenv"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testenv.Cleanup()
+	os.Exit(code)
+}
+
+// TestSketchCount tests that the estimate stays within a few percent of the number of distinct values,
+// both while the sketch is sparse and once it is dense.
+func TestSketchCount(t *testing.T) {
+	for _, n := range []int{100, 5000, 200000} {
+		var sketch cardinality.Sketch
+		for i := 0; i < n; i++ {
+			sketch.Add("user" + strconv.Itoa(i))
+			sketch.Add("user" + strconv.Itoa(i/2)) // Repeated values do not count
+		}
+		if got := float64(sketch.Count()); math.Abs(got-float64(n)) > 0.03*float64(n) {
+			t.Errorf("Expected about %d distinct values, got %.0f", n, got)
+		}
+	}
+}
+
+// TestSketchAdd tests that only values not added before may change the sketch.
+func TestSketchAdd(t *testing.T) {
+	var sketch cardinality.Sketch
+	if !sketch.Add("client1") {
+		t.Error("Expected the first value to change an empty sketch")
+	}
+	if sketch.Add("client1") {
+		t.Error("Expected a value added before to leave the sketch unchanged")
+	}
+}
+
+// TestSketchMatchesRedis tests that values leaving the sketch unchanged also leave unchanged a Redis HyperLogLog
+// holding the same values, which merging in Redis relies on.
+func TestSketchMatchesRedis(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	key := fmt.Sprintf("cardinality_test:%d", time.Now().UnixNano())
+	defer client.Del(ctx, key)
+
+	var sketch cardinality.Sketch
+	for i := 0; i < 5000; i++ {
+		value := "user" + strconv.Itoa(i)
+		if !sketch.Add(value) {
+			continue
+		}
+		if err := client.PFAdd(ctx, key, value).Err(); err != nil {
+			t.Fatalf("PFADD failed: %v", err)
+		}
+	}
+	for i := 0; i < 5000; i++ {
+		value := "user" + strconv.Itoa(i)
+		changed, err := client.PFAdd(ctx, key, value).Result()
+		if err != nil {
+			t.Fatalf("PFADD failed: %v", err)
+		}
+		if changed == 1 {
+			t.Fatalf("Expected %q to leave the Redis HyperLogLog unchanged, as it left the sketch", value)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package cardinality
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Sketch parameters, matching Redis's HyperLogLog: 2^14 registers, hashed with MurmurHash64A and Redis's seed.
+const (
+	precision = 14
+	registers = 1 << precision
+	hllSeed   = 0xadc83b19
+)
+
+// Sketch is a HyperLogLog estimating the number of distinct strings added to it, with a standard error of about 0.8%.
+// It hashes and buckets strings like Redis does, so a string leaving a sketch unchanged also leaves unchanged a Redis
+// HyperLogLog that every string changing the sketch was added to.
+type Sketch struct {
+	registers [registers]uint8
+}
+
+// Add adds value to the sketch and reports whether it changed the sketch. A value that does not change it
+// has probably been added before.
+func (s *Sketch) Add(value string) bool {
+	hash := murmurHash64A([]byte(value), hllSeed)
+	index := hash & (registers - 1)
+	// The rank is one more than the run of zeros above the index bits, at most 64-precision+1
+	hash >>= precision
+	hash |= 1 << (64 - precision)
+	rank := uint8(1)
+	for hash&1 == 0 {
+		rank++
+		hash >>= 1
+	}
+	if rank <= s.registers[index] {
+		return false
+	}
+	s.registers[index] = rank
+	return true
+}
+
+// Count returns the estimated number of distinct values added, using linear counting while the sketch is sparse.
+func (s *Sketch) Count() uint64 {
+	sum := 0.0
+	zeros := 0
+	for _, rank := range s.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	const m = float64(registers)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// murmurHash64A is Austin Appleby's MurmurHash64A, as used by Redis on little-endian machines.
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ uint64(len(data))*m
+
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * i)
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
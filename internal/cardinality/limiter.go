@@ -0,0 +1,223 @@
+// Package cardinality provides a limiter decorator estimating the number of distinct identifiers checked per interval
+// with a HyperLogLog and exporting it as a metric, a signal for detecting distributed attacks and for sizing backends.
+package cardinality
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/types"
+)
+
+// flushSize is the number of identifiers buffered before they are added to the Redis HyperLogLog.
+const flushSize = 128
+
+// Limiter delegates to a limiter, counting the distinct identifiers it checks in each interval.
+// The estimate of an interval is exported when the first request of a later interval is checked.
+type Limiter struct {
+	key      string // Limiter key from config
+	limiter  types.Limiter
+	interval time.Duration
+	client   *redis.Client // Redis holding the merged HyperLogLog, nil to count this instance's identifiers only
+
+	mu      sync.Mutex
+	current int64 // Index of the interval counted by sketch
+	sketch  *Sketch
+	pending []string // Identifiers changing the sketch, not yet added to the Redis HyperLogLog
+}
+
+// NewLimiter creates a decorator around limiter counting the distinct identifiers of this instance as cfg describes.
+func NewLimiter(key string, limiter types.Limiter, cfg config.UniqueIdentifiersConfig) *Limiter {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = config.DefaultUniqueIdentifiersInterval
+	}
+	return &Limiter{
+		key:      key,
+		limiter:  limiter,
+		interval: interval,
+		current:  time.Now().UnixNano() / int64(interval),
+		sketch:   &Sketch{},
+	}
+}
+
+// NewRedisLimiter creates a decorator around limiter counting the distinct identifiers of all instances as cfg
+// describes, in a HyperLogLog per interval kept in Redis. Only identifiers changing the local sketch are sent,
+// since the others cannot change the merged HyperLogLog either. They are sent in batches, so the exported estimate
+// misses the last batch of other instances that have not checked a request since the interval ended.
+func NewRedisLimiter(key string, limiter types.Limiter, cfg config.UniqueIdentifiersConfig, client *redis.Client) *Limiter {
+	l := NewLimiter(key, limiter, cfg)
+	l.client = client
+	return l
+}
+
+// Allow checks if a request for the identifier is allowed, counting the identifier.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	l.record(identifier, time.Now())
+	return l.limiter.Allow(ctx, identifier)
+}
+
+// AllowN checks if a request costing n units for the identifier is allowed, counting the identifier.
+// Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	if err := types.CheckCost(n); err != nil {
+		return false, err
+	}
+	l.record(identifier, time.Now())
+	if costLimiter, ok := l.limiter.(types.CostLimiter); ok {
+		return costLimiter.AllowN(ctx, identifier, n)
+	}
+	return l.limiter.Allow(ctx, identifier)
+}
+
+// AllowAt checks if a request for the identifier is allowed at time t, counting the identifier in the current interval.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	timeLimiter, ok := l.limiter.(types.TimeLimiter)
+	if !ok {
+		return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+	}
+	l.record(identifier, time.Now())
+	return timeLimiter.AllowAt(ctx, identifier, t)
+}
+
+// AllowKey checks if a request for the composite key is allowed, counting the key's canonical encoding.
+func (l *Limiter) AllowKey(ctx context.Context, key types.Key) (bool, error) {
+	l.record(key.String(), time.Now())
+	return types.AllowKey(ctx, l.limiter, key)
+}
+
+// KeyCount returns the key count of the wrapped limiter, and false if it cannot tell.
+func (l *Limiter) KeyCount() (int, bool) {
+	if keyCounter, ok := l.limiter.(types.KeyCounter); ok {
+		return keyCounter.KeyCount()
+	}
+	return 0, false
+}
+
+// Forget drops the identifier's state in the wrapped limiter. It stays counted in the current interval.
+func (l *Limiter) Forget(identifier string) {
+	types.Forget(l.limiter, identifier)
+}
+
+// Pressure returns the fraction of the identifier's budget in use in the wrapped limiter.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	return types.Pressure(ctx, l.limiter, identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget is fully restored in the wrapped limiter.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	return types.ResetTime(ctx, l.limiter, identifier)
+}
+
+// Reserve reserves a request costing n units for the identifier, counting the identifier.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Reservation{}, err
+	}
+	l.record(identifier, time.Now())
+	return types.Reserve(ctx, l.limiter, identifier, n, maxWait)
+}
+
+// AllowDetailed checks a request costing n units for the identifier with its result, counting the identifier.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
+	l.record(identifier, time.Now())
+	return types.AllowDetailed(ctx, l.limiter, identifier, n)
+}
+
+// Stats returns the requests allowed and denied for the identifier in the wrapped limiter.
+func (l *Limiter) Stats(ctx context.Context, identifier string) (types.IdentifierStats, error) {
+	return types.Stats(ctx, l.limiter, identifier)
+}
+
+// History returns the latest decisions for the identifier in the wrapped limiter.
+func (l *Limiter) History(ctx context.Context, identifier string) ([]types.Decision, error) {
+	return types.History(ctx, l.limiter, identifier)
+}
+
+// record counts the identifier in the interval running at time now, exporting the estimate of the previous
+// interval first if now is in a later one.
+func (l *Limiter) record(identifier string, now time.Time) {
+	index := now.UnixNano() / int64(l.interval)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if index > l.current {
+		l.report(l.current, index, l.sketch, l.pending)
+		l.current = index
+		l.sketch = &Sketch{}
+		l.pending = nil
+	}
+	if !l.sketch.Add(identifier) || l.client == nil {
+		return
+	}
+	l.pending = append(l.pending, identifier)
+	if len(l.pending) >= flushSize {
+		go l.flush(l.current, l.pending)
+		l.pending = nil
+	}
+}
+
+// report exports the estimate of the interval before next, given the sketch and unsent identifiers of interval
+// finished. Intervals without requests between them count no identifiers. The caller holds l.mu.
+func (l *Limiter) report(finished, next int64, sketch *Sketch, pending []string) {
+	if l.client == nil {
+		if next == finished+1 {
+			metrics.SetUniqueIdentifiers(l.key, sketch.Count())
+		} else {
+			metrics.SetUniqueIdentifiers(l.key, 0)
+		}
+		return
+	}
+	go func() {
+		l.flush(finished, pending)
+		if next != finished+1 {
+			metrics.SetUniqueIdentifiers(l.key, 0)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), l.interval)
+		defer cancel()
+		count, err := l.client.PFCount(ctx, l.redisKey(finished)).Uint64()
+		if err != nil {
+			log.Warn().Err(err).Str("limiter_key", l.key).Msg("Limiter: Failed to count unique identifiers in Redis")
+			return
+		}
+		metrics.SetUniqueIdentifiers(l.key, count)
+	}()
+}
+
+// flush adds the identifiers to the Redis HyperLogLog of the interval, which expires once the next interval ended.
+func (l *Limiter) flush(index int64, identifiers []string) {
+	if len(identifiers) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.interval)
+	defer cancel()
+	values := make([]interface{}, len(identifiers))
+	for i, identifier := range identifiers {
+		values[i] = identifier
+	}
+	key := l.redisKey(index)
+	_, err := l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.PFAdd(ctx, key, values...)
+		pipe.PExpire(ctx, key, 2*l.interval)
+		return nil
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("limiter_key", l.key).Int("identifiers", len(identifiers)).Msg("Limiter: Failed to add unique identifiers to Redis")
+	}
+}
+
+// redisKey returns the key of the Redis HyperLogLog of the interval.
+func (l *Limiter) redisKey(index int64) string {
+	return "unique_identifiers:" + l.key + ":" + strconv.FormatInt(index, 10)
+}
@@ -0,0 +1,29 @@
+// Package clock defines how limiters handle time moving backwards.
+//
+// Limiters read the wall clock (time.Now) or take times from callers (types.TimeLimiter.AllowAt), and keep the latest time
+// seen for each key in their state. Time can move backwards between two checks of a key: callers replay events out of order,
+// instances sharing a backend have skewed clocks, and NTP steps the wall clock back. Times from time.Now carry a monotonic
+// reading immune to clock steps, but times given to AllowAt and times stored by remote backends (Unix times in Redis,
+// encoded times in Memcache) do not.
+//
+// Every algorithm handles it the same way: a time earlier than the latest time seen for a key is treated as that latest time
+// (see Clamp). Elapsed time is therefore never negative, so a step back neither refills nor drains a key's budget, nor starts
+// a new window: the request is evaluated as if it arrived right after the previous one. Refills and windows resume once time
+// passes the latest time seen. The Lua scripts of the Redis limiters apply the same rule to the Unix milliseconds they store.
+package clock
+
+import "time"
+
+// Clamp returns now, or latest if now is earlier, where latest is the latest time seen for a key.
+// Limiters then store the result as the key's latest time seen.
+func Clamp(now, latest time.Time) time.Time {
+	if now.Before(latest) {
+		return latest
+	}
+	return now
+}
+
+// Elapsed returns the time elapsed from latest to now, or 0 if now is earlier.
+func Elapsed(latest, now time.Time) time.Duration {
+	return max(now.Sub(latest), 0)
+}
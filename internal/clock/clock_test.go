@@ -0,0 +1,162 @@
+package clock_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/internal/clock"
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	fcredis "learn.ratelimiter/internal/fixedcounter/redis"
+	lbinmemory "learn.ratelimiter/internal/leakybucket/inmemory"
+	lbredis "learn.ratelimiter/internal/leakybucket/redis"
+	swinmemory "learn.ratelimiter/internal/slidingwindowcounter/inmemory"
+	swredis "learn.ratelimiter/internal/slidingwindowcounter/redis"
+	"learn.ratelimiter/internal/testenv"
+	tbinmemory "learn.ratelimiter/internal/tokenbucket/inmemory"
+	tbmemcache "learn.ratelimiter/internal/tokenbucket/memcache"
+	tbredis "learn.ratelimiter/internal/tokenbucket/redis"
+	"learn.ratelimiter/types"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testenv.Cleanup()
+	os.Exit(code)
+}
+
+// TestClamp tests that Clamp never returns a time earlier than the latest time seen.
+func TestClamp(t *testing.T) {
+	latest := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"later", latest.Add(time.Second), latest.Add(time.Second)},
+		{"equal", latest, latest},
+		{"earlier", latest.Add(-time.Hour), latest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clock.Clamp(tt.now, latest); !got.Equal(tt.want) {
+				t.Errorf("Clamp(%v, %v) = %v, want %v", tt.now, latest, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestElapsed tests that Elapsed is never negative.
+func TestElapsed(t *testing.T) {
+	latest := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if got := clock.Elapsed(latest, latest.Add(time.Second)); got != time.Second {
+		t.Errorf("Expected 1s elapsed, got %v", got)
+	}
+	if got := clock.Elapsed(latest, latest.Add(-time.Hour)); got != 0 {
+		t.Errorf("Expected no time elapsed going backwards, got %v", got)
+	}
+}
+
+// budget is the number of requests every limiter under test allows at once.
+const budget = 5
+
+// backwardsLimiter creates a limiter allowing budget requests at once, fully recovered within an hour.
+type backwardsLimiter func(t *testing.T, key string) types.TimeLimiter
+
+// backwardsLimiters returns the limiters of every algorithm and backend. Remote backends are skipped
+// when testenv cannot provide a server.
+func backwardsLimiters() map[string]backwardsLimiter {
+	return map[string]backwardsLimiter{
+		"fixed_window/in_memory": func(t *testing.T, key string) types.TimeLimiter {
+			return fcinmemory.NewLimiter(key, time.Minute, budget)
+		},
+		"sliding_window/in_memory": func(t *testing.T, key string) types.TimeLimiter {
+			return swinmemory.NewLimiter(key, time.Minute, budget)
+		},
+		"token_bucket/in_memory": func(t *testing.T, key string) types.TimeLimiter {
+			return tbinmemory.NewLimiter(key, 1, budget, 0)
+		},
+		"leaky_bucket/in_memory": func(t *testing.T, key string) types.TimeLimiter {
+			return lbinmemory.NewLimiter(key, 1, budget).(types.TimeLimiter)
+		},
+		"token_bucket/memcache": func(t *testing.T, key string) types.TimeLimiter {
+			client := memcache.New(testenv.Memcached(t))
+			return tbmemcache.NewLimiter(key, 1, budget, 0, client, nil).(types.TimeLimiter)
+		},
+		"fixed_window/redis": func(t *testing.T, key string) types.TimeLimiter {
+			return fcredis.NewLimiter(redisClient(t), key, time.Minute, budget, false)
+		},
+		"sliding_window/redis": func(t *testing.T, key string) types.TimeLimiter {
+			return swredis.NewLimiter(key, time.Minute, budget, redisClient(t))
+		},
+		"token_bucket/redis": func(t *testing.T, key string) types.TimeLimiter {
+			return tbredis.NewLimiter(key, 1, budget, 0, redisClient(t)).(types.TimeLimiter)
+		},
+		"leaky_bucket/redis": func(t *testing.T, key string) types.TimeLimiter {
+			return lbredis.NewLimiter(key, 1, budget, redisClient(t)).(types.TimeLimiter)
+		},
+	}
+}
+
+// redisClient returns a client of the Redis server provided by testenv.
+func redisClient(t *testing.T) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// allowed returns how many of n requests at time at are allowed.
+func allowed(t *testing.T, limiter types.TimeLimiter, identifier string, at time.Time, n int) int {
+	t.Helper()
+	count := 0
+	for i := 0; i < n; i++ {
+		ok, err := limiter.AllowAt(context.Background(), identifier, at)
+		if err != nil {
+			t.Fatalf("AllowAt returned error: %v", err)
+		}
+		if ok {
+			count++
+		}
+	}
+	return count
+}
+
+// TestBackwardsTime specifies the behavior of every algorithm when time moves backwards: a time earlier than
+// the latest time seen for a key is treated as that latest time, so it neither refills, drains nor resets the budget.
+func TestBackwardsTime(t *testing.T) {
+	for name, newLimiter := range backwardsLimiters() {
+		t.Run(name, func(t *testing.T) {
+			// Start from the current time, so remote backends do not expire state in the middle of the test
+			start := time.Now()
+			key := fmt.Sprintf("backwards-%d", start.UnixNano())
+
+			t.Run("does not refill", func(t *testing.T) {
+				limiter := newLimiter(t, key+"-refill")
+				if got := allowed(t, limiter, "user1", start, budget+1); got != budget {
+					t.Fatalf("Expected %d requests allowed at start, got %d", budget, got)
+				}
+				if got := allowed(t, limiter, "user1", start.Add(-time.Hour), 1); got != 0 {
+					t.Error("Request an hour earlier should be denied while the budget is spent")
+				}
+				if got := allowed(t, limiter, "user1", start.Add(time.Hour), 1); got != 1 {
+					t.Error("Request an hour later should be allowed once time passes the latest time seen")
+				}
+			})
+
+			t.Run("does not drain", func(t *testing.T) {
+				limiter := newLimiter(t, key+"-drain")
+				if got := allowed(t, limiter, "user1", start, 1); got != 1 {
+					t.Fatal("First request should be allowed")
+				}
+				if got := allowed(t, limiter, "user1", start.Add(-time.Hour), budget); got != budget-1 {
+					t.Errorf("Expected the remaining %d requests allowed an hour earlier, got %d", budget-1, got)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,220 @@
+// Package codec provides pluggable serialization of limiter state stored as opaque values (e.g., in Memcache).
+//
+// Binary codecs prefix their payload with a small header identifying the codec and payload version,
+// so any codec can read values written by any other, and values written as plain JSON by earlier releases
+// are still read (and rewritten in the configured format on the next update). Large payloads can additionally
+// be compressed (see Compress); compressed payloads are likewise detected on read.
+//
+// State types are flat structs whose fields carry a `codec:"<number>"` tag. The number identifies the field
+// on the wire and must never be reused; fields unknown to the reader are skipped, so fields can be added safely.
+// Supported field types are signed integers, float64, bool, string, time.Time and []int64.
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Codec encodes and decodes limiter state.
+type Codec interface {
+	// Name returns the codec name used in configuration.
+	Name() string
+	// Marshal encodes the state pointed to by v.
+	Marshal(v any) ([]byte, error)
+	// Unmarshal decodes data written by any codec into the state pointed to by v.
+	Unmarshal(data []byte, v any) error
+}
+
+// Codec names used in configuration.
+const (
+	NameJSON     = "json"
+	NameMsgPack  = "msgpack"
+	NameProtobuf = "protobuf"
+)
+
+// Version is the payload version written by the binary codecs.
+const Version = 1
+
+// headerMagic starts every binary payload. It is never the first byte of JSON, and is unused in msgpack.
+const headerMagic = 0xc1
+
+// headerSize is the length of the binary payload header: magic, codec ID and version.
+const headerSize = 3
+
+// Codec IDs stored in the binary payload header.
+const (
+	idMsgPack  byte = 1
+	idProtobuf byte = 2
+)
+
+// ErrUnsupportedVersion is returned when a payload was written by a newer, incompatible release.
+var ErrUnsupportedVersion = errors.New("codec: unsupported state version")
+
+// New returns the codec with the given name. An empty name selects JSON.
+func New(name string) (Codec, error) {
+	switch name {
+	case "", NameJSON:
+		return JSON, nil
+	case NameMsgPack:
+		return MsgPack, nil
+	case NameProtobuf:
+		return Protobuf, nil
+	default:
+		return nil, fmt.Errorf("unsupported codec '%s'", name)
+	}
+}
+
+// Unmarshal decodes data written by any codec, detecting the format and any compression from the payload, into the state pointed to by v.
+func Unmarshal(data []byte, v any) error {
+	data, compressed, err := decompress(data)
+	if err != nil {
+		return err
+	}
+	if compressed && len(data) > 0 && data[0] == compressedMagic {
+		return fmt.Errorf("codec: nested compression")
+	}
+	if len(data) == 0 || data[0] != headerMagic {
+		return unmarshalJSON(data, v)
+	}
+	if len(data) < headerSize {
+		return fmt.Errorf("codec: truncated header")
+	}
+	if data[2] > Version {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[2])
+	}
+	fields, err := fieldsFor(v)
+	if err != nil {
+		return err
+	}
+	switch data[1] {
+	case idMsgPack:
+		return unmarshalMsgPack(data[headerSize:], fields)
+	case idProtobuf:
+		return unmarshalProtobuf(data[headerSize:], fields)
+	default:
+		return fmt.Errorf("codec: unknown codec id %d", data[1])
+	}
+}
+
+// header returns a new payload buffer starting with the binary header for the codec.
+func header(id byte) []byte {
+	return append(make([]byte, 0, 32), headerMagic, id, Version)
+}
+
+// field is a tagged struct field of a state value.
+type field struct {
+	num   int
+	value reflect.Value
+}
+
+// kind classifies the field for encoding.
+func (f field) kind() fieldKind {
+	switch {
+	case f.value.Type() == timeType:
+		return kindTime
+	case f.value.Kind() == reflect.Slice && f.value.Type().Elem().Kind() == reflect.Int64:
+		return kindInt64s
+	}
+	switch f.value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return kindInt
+	case reflect.Float64:
+		return kindFloat
+	case reflect.Bool:
+		return kindBool
+	case reflect.String:
+		return kindString
+	}
+	return kindUnsupported
+}
+
+// fieldKind is the wire representation of a field.
+type fieldKind int
+
+const (
+	kindUnsupported fieldKind = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindString
+	kindTime
+	kindInt64s
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// fieldIndexes caches the tagged field numbers and indexes of each state type.
+var fieldIndexes sync.Map // reflect.Type -> []fieldIndex
+
+type fieldIndex struct {
+	num   int
+	index int
+}
+
+// fieldsFor returns the tagged fields of the struct pointed to by v.
+func fieldsFor(v any) ([]field, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("codec: state must be a non-nil pointer to a struct, got %T", v)
+	}
+	rv = rv.Elem()
+	indexes, err := fieldIndexesFor(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]field, len(indexes))
+	for i, idx := range indexes {
+		fields[i] = field{num: idx.num, value: rv.Field(idx.index)}
+	}
+	return fields, nil
+}
+
+// fieldIndexesFor parses and validates the codec tags of the state type.
+func fieldIndexesFor(t reflect.Type) ([]fieldIndex, error) {
+	if cached, ok := fieldIndexes.Load(t); ok {
+		return cached.([]fieldIndex), nil
+	}
+	var indexes []fieldIndex
+	seen := make(map[int]bool)
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("codec")
+		if !ok {
+			continue
+		}
+		if !t.Field(i).IsExported() {
+			return nil, fmt.Errorf("codec: tagged field %s.%s must be exported", t.Name(), t.Field(i).Name)
+		}
+		num, err := strconv.Atoi(tag)
+		// Field numbers are kept small so they encode as a single byte in every codec
+		if err != nil || num < 1 || num > 15 || seen[num] {
+			return nil, fmt.Errorf("codec: invalid field number '%s' on %s.%s", tag, t.Name(), t.Field(i).Name)
+		}
+		if (field{value: reflect.New(t.Field(i).Type).Elem()}).kind() == kindUnsupported {
+			return nil, fmt.Errorf("codec: unsupported type %s for %s.%s", t.Field(i).Type, t.Name(), t.Field(i).Name)
+		}
+		seen[num] = true
+		indexes = append(indexes, fieldIndex{num: num, index: i})
+	}
+	fieldIndexes.Store(t, indexes)
+	return indexes, nil
+}
+
+// timeToNanos encodes a time as Unix nanoseconds, with the zero time as 0.
+func timeToNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// nanosToTime decodes Unix nanoseconds written by timeToNanos.
+func nanosToTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
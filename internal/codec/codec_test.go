@@ -0,0 +1,102 @@
+// Package codec_test contains tests for the limiter state codecs.
+package codec_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/internal/codec"
+)
+
+type testState struct {
+	Tokens     int64     `json:"tokens" codec:"1"`
+	LastRefill time.Time `json:"last_refill" codec:"2"`
+	Rate       float64   `json:"rate" codec:"3"`
+	Paused     bool      `json:"paused" codec:"4"`
+	Owner      string    `json:"owner" codec:"5"`
+	Timestamps []int64   `json:"timestamps" codec:"6"`
+}
+
+// olderState is testState as written by a release that only had the first two fields.
+type olderState struct {
+	Tokens     int64     `json:"tokens" codec:"1"`
+	LastRefill time.Time `json:"last_refill" codec:"2"`
+}
+
+func newTestState() testState {
+	return testState{
+		Tokens:     -42,
+		LastRefill: time.Unix(1700000000, 123456789),
+		Rate:       2.5,
+		Paused:     true,
+		Owner:      "client1",
+		Timestamps: []int64{1, -300, 1 << 40},
+	}
+}
+
+// TestRoundTrip tests that every codec decodes what it encodes, and what every other codec encodes.
+func TestRoundTrip(t *testing.T) {
+	codecs := []codec.Codec{codec.JSON, codec.MsgPack, codec.Protobuf}
+	want := newTestState()
+	for _, writer := range codecs {
+		data, err := writer.Marshal(&want)
+		if err != nil {
+			t.Fatalf("%s: Marshal returned error: %v", writer.Name(), err)
+		}
+		for _, reader := range codecs {
+			var got testState
+			if err := reader.Unmarshal(data, &got); err != nil {
+				t.Fatalf("%s reading %s: Unmarshal returned error: %v", reader.Name(), writer.Name(), err)
+			}
+			if !got.LastRefill.Equal(want.LastRefill) {
+				t.Errorf("%s reading %s: LastRefill = %v, want %v", reader.Name(), writer.Name(), got.LastRefill, want.LastRefill)
+			}
+			got.LastRefill = want.LastRefill
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s reading %s: got %+v, want %+v", reader.Name(), writer.Name(), got, want)
+			}
+		}
+	}
+}
+
+// TestBinarySmallerThanJSON tests that the binary codecs produce more compact payloads than JSON.
+func TestBinarySmallerThanJSON(t *testing.T) {
+	state := olderState{Tokens: 17, LastRefill: time.Now()}
+	jsonData, _ := codec.JSON.Marshal(&state)
+	for _, c := range []codec.Codec{codec.MsgPack, codec.Protobuf} {
+		data, err := c.Marshal(&state)
+		if err != nil {
+			t.Fatalf("%s: Marshal returned error: %v", c.Name(), err)
+		}
+		if len(data) >= len(jsonData) {
+			t.Errorf("%s payload is %d bytes, JSON is %d", c.Name(), len(data), len(jsonData))
+		}
+	}
+}
+
+// TestUnknownFieldsSkipped tests that a reader ignores fields added by a newer writer.
+func TestUnknownFieldsSkipped(t *testing.T) {
+	newer := newTestState()
+	for _, c := range []codec.Codec{codec.MsgPack, codec.Protobuf} {
+		data, _ := c.Marshal(&newer)
+		var got olderState
+		if err := c.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: Unmarshal returned error: %v", c.Name(), err)
+		}
+		if got.Tokens != newer.Tokens || !got.LastRefill.Equal(newer.LastRefill) {
+			t.Errorf("%s: got %+v", c.Name(), got)
+		}
+	}
+}
+
+// TestUnsupportedVersion tests that payloads from a newer payload version are rejected rather than misread.
+func TestUnsupportedVersion(t *testing.T) {
+	state := olderState{Tokens: 1}
+	data, _ := codec.MsgPack.Marshal(&state)
+	data[2] = codec.Version + 1
+	if err := codec.Unmarshal(data, &state); !errors.Is(err, codec.ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+}
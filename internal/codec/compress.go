@@ -0,0 +1,85 @@
+package codec
+
+import (
+	"fmt"
+)
+
+// Compression algorithm names used in configuration.
+const (
+	CompressionNone   = "none"
+	CompressionSnappy = "snappy"
+)
+
+// DefaultCompressionThreshold is the smallest encoded payload compressed when no positive threshold is given.
+// Small states such as a token bucket rarely shrink, so only larger payloads are worth the CPU.
+const DefaultCompressionThreshold = 256
+
+// compressedMagic starts every compressed payload. Like headerMagic, it is never the first byte of JSON or of another codec's payload.
+const compressedMagic = 0xc2
+
+// Compression IDs stored after compressedMagic.
+const (
+	idSnappy byte = 1
+)
+
+// compressedCodec wraps a codec, compressing payloads at or above a size threshold.
+type compressedCodec struct {
+	Codec
+	threshold int
+}
+
+// Compress wraps the codec so encoded payloads of at least threshold bytes are compressed with the named algorithm
+// (DefaultCompressionThreshold if threshold is not positive). Payloads are only stored compressed if that makes them smaller.
+// Compressed payloads are detected on read, so compression can be enabled or disabled without resetting state.
+// An empty or "none" algorithm returns the codec unchanged.
+func Compress(c Codec, algorithm string, threshold int) (Codec, error) {
+	switch algorithm {
+	case "", CompressionNone:
+		return c, nil
+	case CompressionSnappy:
+		if threshold <= 0 {
+			threshold = DefaultCompressionThreshold
+		}
+		return compressedCodec{Codec: c, threshold: threshold}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression '%s'", algorithm)
+	}
+}
+
+// Name returns the wrapped codec's name with the compression appended, e.g. "msgpack+snappy".
+func (c compressedCodec) Name() string {
+	return c.Codec.Name() + "+" + CompressionSnappy
+}
+
+// Marshal encodes the state with the wrapped codec and compresses the result if it is large enough to benefit.
+func (c compressedCodec) Marshal(v any) ([]byte, error) {
+	data, err := c.Codec.Marshal(v)
+	if err != nil || len(data) < c.threshold {
+		return data, err
+	}
+	compressed := append([]byte{compressedMagic, idSnappy}, snappyEncode(data)...)
+	if len(compressed) >= len(data) {
+		return data, nil
+	}
+	return compressed, nil
+}
+
+// Unmarshal decodes data written by any codec, compressed or not.
+func (compressedCodec) Unmarshal(data []byte, v any) error { return Unmarshal(data, v) }
+
+// decompress returns the decompressed payload if data is compressed, and false otherwise.
+func decompress(data []byte) ([]byte, bool, error) {
+	if len(data) == 0 || data[0] != compressedMagic {
+		return data, false, nil
+	}
+	if len(data) < 2 {
+		return nil, true, fmt.Errorf("codec: truncated compression header")
+	}
+	switch data[1] {
+	case idSnappy:
+		decoded, err := snappyDecode(data[2:])
+		return decoded, true, err
+	default:
+		return nil, true, fmt.Errorf("codec: unknown compression id %d", data[1])
+	}
+}
@@ -0,0 +1,69 @@
+package codec_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"learn.ratelimiter/internal/codec"
+)
+
+// TestCompressRoundTrip tests that large payloads are compressed, small ones are not, and both are read by any codec.
+func TestCompressRoundTrip(t *testing.T) {
+	large := testState{Owner: "client1"}
+	for i := 0; i < 500; i++ {
+		large.Timestamps = append(large.Timestamps, 1700000000000+int64(i%10))
+	}
+	small := testState{Tokens: 3}
+
+	for _, inner := range []codec.Codec{codec.JSON, codec.MsgPack, codec.Protobuf} {
+		c, err := codec.Compress(inner, codec.CompressionSnappy, 0)
+		if err != nil {
+			t.Fatalf("Compress returned error: %v", err)
+		}
+		uncompressed, _ := inner.Marshal(&large)
+		compressed, err := c.Marshal(&large)
+		if err != nil {
+			t.Fatalf("%s: Marshal returned error: %v", c.Name(), err)
+		}
+		if len(compressed) >= len(uncompressed) {
+			t.Errorf("%s: compressed payload is %d bytes, uncompressed %d", c.Name(), len(compressed), len(uncompressed))
+		}
+		var got testState
+		// Decoding detects compression regardless of the reading codec
+		if err := codec.JSON.Unmarshal(compressed, &got); err != nil {
+			t.Fatalf("%s: Unmarshal returned error: %v", c.Name(), err)
+		}
+		if !reflect.DeepEqual(got.Timestamps, large.Timestamps) || got.Owner != large.Owner {
+			t.Errorf("%s: decoded state does not match", c.Name())
+		}
+
+		smallData, _ := c.Marshal(&small)
+		plain, _ := inner.Marshal(&small)
+		if !bytes.Equal(smallData, plain) {
+			t.Errorf("%s: expected payload below the threshold to be stored uncompressed", c.Name())
+		}
+	}
+}
+
+// TestSnappyBlockCompatibility tests decoding blocks using the copy forms emitted by other Snappy encoders.
+func TestSnappyBlockCompatibility(t *testing.T) {
+	// Each block decodes to {"owner":"abcdabcdabcd"}: a literal, a copy of 8 bytes from 4 bytes back, and a literal
+	prefix := append([]byte{24, 13 << 2}, `{"owner":"abcd`...)
+	suffix := []byte{1 << 2, '"', '}'}
+	copies := map[string][]byte{
+		"copy1": {0x01 | 4<<2, 4},
+		"copy2": {0x02 | 7<<2, 4, 0},
+		"copy4": {0x03 | 7<<2, 4, 0, 0, 0},
+	}
+	for name, cp := range copies {
+		block := append(append(append([]byte{}, prefix...), cp...), suffix...)
+		var got testState
+		if err := codec.Unmarshal(append([]byte{0xc2, 0x01}, block...), &got); err != nil {
+			t.Fatalf("%s: Unmarshal returned error: %v", name, err)
+		}
+		if got.Owner != "abcdabcdabcd" {
+			t.Errorf("%s: decoded owner %q", name, got.Owner)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSON encodes state as JSON using the struct's json tags. It is the default and the format written by earlier releases.
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+// Name returns "json".
+func (jsonCodec) Name() string { return NameJSON }
+
+// Marshal encodes the state as JSON.
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("codec: marshal json: %w", err)
+	}
+	return data, nil
+}
+
+// Unmarshal decodes data written by any codec.
+func (jsonCodec) Unmarshal(data []byte, v any) error { return Unmarshal(data, v) }
+
+// unmarshalJSON decodes a JSON payload.
+func unmarshalJSON(data []byte, v any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("codec: unmarshal json: %w", err)
+	}
+	return nil
+}
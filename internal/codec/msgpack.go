@@ -0,0 +1,335 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// MsgPack encodes state as a MessagePack map keyed by the codec tag number.
+// Integers and times (as Unix nanoseconds) use the smallest integer encoding that fits.
+var MsgPack Codec = msgPackCodec{}
+
+type msgPackCodec struct{}
+
+// Name returns "msgpack".
+func (msgPackCodec) Name() string { return NameMsgPack }
+
+// Marshal encodes the state as MessagePack behind the binary header.
+func (msgPackCodec) Marshal(v any) ([]byte, error) {
+	fields, err := fieldsFor(v)
+	if err != nil {
+		return nil, err
+	}
+	b := header(idMsgPack)
+	// Field numbers are at most 15, so the map always fits a fixmap
+	b = append(b, 0x80|byte(len(fields)))
+	for _, f := range fields {
+		b = appendMsgPackInt(b, int64(f.num))
+		switch f.kind() {
+		case kindInt:
+			b = appendMsgPackInt(b, f.value.Int())
+		case kindTime:
+			b = appendMsgPackInt(b, timeToNanos(f.value.Interface().(time.Time)))
+		case kindFloat:
+			b = append(b, 0xcb)
+			b = binary.BigEndian.AppendUint64(b, math.Float64bits(f.value.Float()))
+		case kindBool:
+			if f.value.Bool() {
+				b = append(b, 0xc3)
+			} else {
+				b = append(b, 0xc2)
+			}
+		case kindString:
+			b = appendMsgPackString(b, f.value.String())
+		case kindInt64s:
+			values := f.value.Interface().([]int64)
+			b = appendMsgPackArrayHeader(b, len(values))
+			for _, n := range values {
+				b = appendMsgPackInt(b, n)
+			}
+		}
+	}
+	return b, nil
+}
+
+// Unmarshal decodes data written by any codec.
+func (msgPackCodec) Unmarshal(data []byte, v any) error { return Unmarshal(data, v) }
+
+// appendMsgPackInt appends n using the smallest MessagePack integer format.
+func appendMsgPackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= 127:
+		return append(b, byte(n))
+	case n >= -32 && n < 0:
+		return append(b, byte(n))
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		return append(b, 0xd0, byte(n))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+	}
+}
+
+// appendMsgPackString appends s as a MessagePack string.
+func appendMsgPackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+// appendMsgPackArrayHeader appends the header of a MessagePack array of n elements.
+func appendMsgPackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+// unmarshalMsgPack decodes a MessagePack map payload into the fields, skipping unknown keys.
+func unmarshalMsgPack(b []byte, fields []field) error {
+	d := &msgPackDecoder{b: b}
+	value, err := d.value()
+	if err != nil {
+		return err
+	}
+	entries, ok := value.(map[int64]any)
+	if !ok {
+		return fmt.Errorf("codec: msgpack: payload is not a map")
+	}
+	for _, f := range fields {
+		v, ok := entries[int64(f.num)]
+		if !ok {
+			continue
+		}
+		if err := setMsgPackField(f, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setMsgPackField assigns a decoded MessagePack value to the field.
+func setMsgPackField(f field, v any) error {
+	mismatch := fmt.Errorf("codec: msgpack: unexpected %T for field %d", v, f.num)
+	switch f.kind() {
+	case kindInt, kindTime:
+		n, ok := v.(int64)
+		if !ok {
+			return mismatch
+		}
+		if f.kind() == kindTime {
+			f.value.Set(reflect.ValueOf(nanosToTime(n)))
+		} else {
+			f.value.SetInt(n)
+		}
+	case kindFloat:
+		switch n := v.(type) {
+		case float64:
+			f.value.SetFloat(n)
+		case int64:
+			f.value.SetFloat(float64(n))
+		default:
+			return mismatch
+		}
+	case kindBool:
+		b, ok := v.(bool)
+		if !ok {
+			return mismatch
+		}
+		f.value.SetBool(b)
+	case kindString:
+		s, ok := v.(string)
+		if !ok {
+			return mismatch
+		}
+		f.value.SetString(s)
+	case kindInt64s:
+		items, ok := v.([]any)
+		if !ok {
+			return mismatch
+		}
+		values := make([]int64, len(items))
+		for i, item := range items {
+			if values[i], ok = item.(int64); !ok {
+				return mismatch
+			}
+		}
+		f.value.Set(reflect.ValueOf(values))
+	}
+	return nil
+}
+
+// msgPackDecoder decodes the subset of MessagePack written by the codec: nil, bools, integers, floats, strings,
+// arrays and maps with integer keys. Binary and extension values are rejected.
+type msgPackDecoder struct {
+	b []byte
+}
+
+// next consumes and returns n bytes.
+func (d *msgPackDecoder) next(n int) ([]byte, error) {
+	if len(d.b) < n {
+		return nil, fmt.Errorf("codec: msgpack: unexpected end of payload")
+	}
+	p := d.b[:n]
+	d.b = d.b[n:]
+	return p, nil
+}
+
+// uint reads an unsigned big-endian integer of the given byte size.
+func (d *msgPackDecoder) uint(size int) (uint64, error) {
+	p, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range p {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+// value decodes the next value.
+func (d *msgPackDecoder) value() (any, error) {
+	p, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := p[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.mapOf(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.arrayOf(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.string(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("codec: msgpack: integer overflows int64")
+		}
+		return int64(n), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend from the encoded width
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, nil
+	case 0xca:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 0xcb:
+		n, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(n), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.string(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayOf(int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(int(n))
+	}
+	return nil, fmt.Errorf("codec: msgpack: unsupported type byte 0x%x", c)
+}
+
+// string decodes a string of n bytes.
+func (d *msgPackDecoder) string(n int) (any, error) {
+	p, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(p), nil
+}
+
+// arrayOf decodes an array of n values.
+func (d *msgPackDecoder) arrayOf(n int) (any, error) {
+	if n > len(d.b) {
+		return nil, fmt.Errorf("codec: msgpack: array length %d exceeds payload", n)
+	}
+	items := make([]any, n)
+	for i := range items {
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		items[i] = v
+	}
+	return items, nil
+}
+
+// mapOf decodes a map of n entries with integer keys.
+func (d *msgPackDecoder) mapOf(n int) (any, error) {
+	if n > len(d.b) {
+		return nil, fmt.Errorf("codec: msgpack: map length %d exceeds payload", n)
+	}
+	entries := make(map[int64]any, n)
+	for i := 0; i < n; i++ {
+		key, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		k, ok := key.(int64)
+		if !ok {
+			return nil, fmt.Errorf("codec: msgpack: unsupported map key %T", key)
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		entries[k] = v
+	}
+	return entries, nil
+}
@@ -0,0 +1,131 @@
+package codec
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Protobuf encodes state in the protocol buffers wire format, using the codec tag as the field number.
+// Integers and times are encoded as sint64, floats as double, and []int64 as packed sint64.
+var Protobuf Codec = protobufCodec{}
+
+type protobufCodec struct{}
+
+// Name returns "protobuf".
+func (protobufCodec) Name() string { return NameProtobuf }
+
+// Marshal encodes the state in the protocol buffers wire format behind the binary header.
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	fields, err := fieldsFor(v)
+	if err != nil {
+		return nil, err
+	}
+	b := header(idProtobuf)
+	for _, f := range fields {
+		num := protowire.Number(f.num)
+		switch f.kind() {
+		case kindInt:
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, protowire.EncodeZigZag(f.value.Int()))
+		case kindTime:
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, protowire.EncodeZigZag(timeToNanos(f.value.Interface().(time.Time))))
+		case kindFloat:
+			b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+			b = protowire.AppendFixed64(b, math.Float64bits(f.value.Float()))
+		case kindBool:
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, protowire.EncodeBool(f.value.Bool()))
+		case kindString:
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, f.value.String())
+		case kindInt64s:
+			var packed []byte
+			for _, n := range f.value.Interface().([]int64) {
+				packed = protowire.AppendVarint(packed, protowire.EncodeZigZag(n))
+			}
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendBytes(b, packed)
+		}
+	}
+	return b, nil
+}
+
+// Unmarshal decodes data written by any codec.
+func (protobufCodec) Unmarshal(data []byte, v any) error { return Unmarshal(data, v) }
+
+// unmarshalProtobuf decodes a protocol buffers payload into the fields, skipping unknown field numbers.
+func unmarshalProtobuf(b []byte, fields []field) error {
+	byNum := make(map[protowire.Number]field, len(fields))
+	for _, f := range fields {
+		byNum[protowire.Number(f.num)] = f
+	}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("codec: protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+		f, known := byNum[num]
+		if !known {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return fmt.Errorf("codec: protobuf: %w", protowire.ParseError(n))
+			}
+			b = b[n:]
+			continue
+		}
+
+		switch f.kind() {
+		case kindInt, kindTime, kindBool:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 || typ != protowire.VarintType {
+				return fmt.Errorf("codec: protobuf: invalid varint for field %d", num)
+			}
+			b = b[n:]
+			switch f.kind() {
+			case kindInt:
+				f.value.SetInt(protowire.DecodeZigZag(v))
+			case kindTime:
+				f.value.Set(reflect.ValueOf(nanosToTime(protowire.DecodeZigZag(v))))
+			case kindBool:
+				f.value.SetBool(protowire.DecodeBool(v))
+			}
+		case kindFloat:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 || typ != protowire.Fixed64Type {
+				return fmt.Errorf("codec: protobuf: invalid double for field %d", num)
+			}
+			b = b[n:]
+			f.value.SetFloat(math.Float64frombits(v))
+		case kindString:
+			v, n := protowire.ConsumeString(b)
+			if n < 0 || typ != protowire.BytesType {
+				return fmt.Errorf("codec: protobuf: invalid string for field %d", num)
+			}
+			b = b[n:]
+			f.value.SetString(v)
+		case kindInt64s:
+			packed, n := protowire.ConsumeBytes(b)
+			if n < 0 || typ != protowire.BytesType {
+				return fmt.Errorf("codec: protobuf: invalid packed field %d", num)
+			}
+			b = b[n:]
+			var values []int64
+			for len(packed) > 0 {
+				v, n := protowire.ConsumeVarint(packed)
+				if n < 0 {
+					return fmt.Errorf("codec: protobuf: invalid packed varint for field %d", num)
+				}
+				packed = packed[n:]
+				values = append(values, protowire.DecodeZigZag(v))
+			}
+			f.value.Set(reflect.ValueOf(values))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// This file implements the Snappy block format (https://github.com/google/snappy/blob/main/format_description.txt).
+// The encoder favours simplicity over ratio: it finds 4-byte matches with a single hash table and emits
+// literals and 2-byte-offset copies. The decoder accepts every element type, so it reads blocks from any Snappy encoder.
+
+var errSnappyCorrupt = errors.New("codec: snappy: corrupt input")
+
+// maxSnappyDecodedLen bounds the decoded size accepted from a block, protecting against corrupt or hostile lengths.
+const maxSnappyDecodedLen = 64 << 20
+
+const (
+	snappyTagLiteral = 0x00
+	snappyTagCopy1   = 0x01
+	snappyTagCopy2   = 0x02
+	snappyTagCopy4   = 0x03
+
+	snappyTableBits = 14
+	// snappyMaxOffset is the largest offset a 2-byte-offset copy can express.
+	snappyMaxOffset = 1<<16 - 1
+)
+
+// snappyEncode returns the Snappy block encoding of src.
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)/2+16), uint64(len(src)))
+	if len(src) < 4 {
+		return appendSnappyLiteral(dst, src)
+	}
+
+	// table maps a hash of 4 bytes to the last position they were seen at, plus one
+	var table [1 << snappyTableBits]int32
+	literalStart := 0
+	for i := 0; i+4 <= len(src); {
+		current := binary.LittleEndian.Uint32(src[i:])
+		h := (current * 0x1e35a7bd) >> (32 - snappyTableBits)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || i-candidate > snappyMaxOffset || binary.LittleEndian.Uint32(src[candidate:]) != current {
+			i++
+			continue
+		}
+
+		dst = appendSnappyLiteral(dst, src[literalStart:i])
+		length := 4
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+		dst = appendSnappyCopy(dst, i-candidate, length)
+		i += length
+		literalStart = i
+	}
+	return appendSnappyLiteral(dst, src[literalStart:])
+}
+
+// appendSnappyLiteral appends a literal element holding lit.
+func appendSnappyLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := uint32(len(lit) - 1)
+	if n < 60 {
+		dst = append(dst, byte(n)<<2|snappyTagLiteral)
+	} else {
+		// Tags 60-63 are followed by the length minus one in 1-4 little-endian bytes
+		size := (bits.Len32(n) + 7) / 8
+		dst = append(dst, byte(59+size)<<2|snappyTagLiteral)
+		for j := 0; j < size; j++ {
+			dst = append(dst, byte(n>>(8*j)))
+		}
+	}
+	return append(dst, lit...)
+}
+
+// appendSnappyCopy appends copy elements repeating length bytes from offset bytes back.
+func appendSnappyCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		n := min(length, 64)
+		dst = append(dst, byte(n-1)<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		length -= n
+	}
+	return dst
+}
+
+// snappyDecode returns the decoded form of the Snappy block src.
+func snappyDecode(src []byte) ([]byte, error) {
+	decodedLen, n := binary.Uvarint(src)
+	if n <= 0 || decodedLen > maxSnappyDecodedLen {
+		return nil, errSnappyCorrupt
+	}
+	src = src[n:]
+	dst := make([]byte, 0, decodedLen)
+
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 0x03 {
+		case snappyTagLiteral:
+			length = int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				size := length - 59
+				if len(src) < size {
+					return nil, errSnappyCorrupt
+				}
+				length = 0
+				for j := 0; j < size; j++ {
+					length |= int(src[j]) << (8 * j)
+				}
+				src = src[size:]
+			}
+			length++
+			if length > len(src) || len(dst)+length > int(decodedLen) {
+				return nil, errSnappyCorrupt
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case snappyTagCopy1:
+			if len(src) < 2 {
+				return nil, errSnappyCorrupt
+			}
+			length = 4 + int(tag>>2)&0x07
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case snappyTagCopy2:
+			if len(src) < 3 {
+				return nil, errSnappyCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case snappyTagCopy4:
+			if len(src) < 5 {
+				return nil, errSnappyCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) || len(dst)+length > int(decodedLen) {
+			return nil, errSnappyCorrupt
+		}
+		// Copies may overlap their own output, so copy byte by byte
+		start := len(dst) - offset
+		for j := 0; j < length; j++ {
+			dst = append(dst, dst[start+j])
+		}
+	}
+	if len(dst) != int(decodedLen) {
+		return nil, errSnappyCorrupt
+	}
+	return dst, nil
+}
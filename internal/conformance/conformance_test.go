@@ -0,0 +1,299 @@
+package conformance_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/go-redis/redis/v8"
+
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	fcredis "learn.ratelimiter/internal/fixedcounter/redis"
+	lbinmemory "learn.ratelimiter/internal/leakybucket/inmemory"
+	lbmemcache "learn.ratelimiter/internal/leakybucket/memcache"
+	lbredis "learn.ratelimiter/internal/leakybucket/redis"
+	swinmemory "learn.ratelimiter/internal/slidingwindowcounter/inmemory"
+	swcmemcache "learn.ratelimiter/internal/slidingwindowcounter/memcache"
+	swredis "learn.ratelimiter/internal/slidingwindowcounter/redis"
+	"learn.ratelimiter/internal/testenv"
+	tbinmemory "learn.ratelimiter/internal/tokenbucket/inmemory"
+	tbmemcache "learn.ratelimiter/internal/tokenbucket/memcache"
+	tbredis "learn.ratelimiter/internal/tokenbucket/redis"
+	"learn.ratelimiter/types"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testenv.Cleanup()
+	os.Exit(code)
+}
+
+const (
+	// limit is the window limit and bucket capacity of every limiter under test.
+	limit = 3
+	// window is the window size of the window algorithms.
+	window = time.Minute
+	// rate is the refill and leak rate of the bucket algorithms, in tokens per second.
+	rate = 1
+)
+
+// step is a burst of requests of a trace, all at the same time.
+type step struct {
+	// at is the time of the requests since the start of the trace, which is a multiple of window.
+	at         time.Duration
+	identifier string
+	requests   int
+	// allowed is the number of the requests the specification allows.
+	allowed int
+}
+
+// newLimiter creates a limiter with the given key for one backend of an algorithm.
+type newLimiter func(t *testing.T, key string) types.TimeLimiter
+
+// spec is the trace of an algorithm and its limiters on every backend implementing it.
+type spec struct {
+	name     string
+	trace    []step
+	backends map[string]newLimiter
+}
+
+// specs returns the traces of every algorithm. Remote backends are skipped when testenv cannot provide a server.
+func specs() []spec {
+	return []spec{
+		{
+			name: "fixed_window/wall_clock",
+			trace: []step{
+				{10 * time.Second, "user1", 4, 3},
+				{10 * time.Second, "user2", 3, 3},
+				{window - time.Millisecond, "user1", 1, 0},
+				// The next window starts where the previous one ends
+				{window, "user1", 4, 3},
+				{window + time.Second, "user1", 1, 0},
+				{2*window + 30*time.Second, "user1", 2, 2},
+			},
+			backends: map[string]newLimiter{
+				"in_memory": func(t *testing.T, key string) types.TimeLimiter {
+					return fcinmemory.NewLimiter(key, window, limit, fcinmemory.WithWallClockAlignment())
+				},
+				"redis": func(t *testing.T, key string) types.TimeLimiter {
+					return fcredis.NewLimiter(redisClient(t), key, window, limit, false)
+				},
+			},
+		},
+		{
+			name: "fixed_window/first_request",
+			trace: []step{
+				{10 * time.Second, "user1", 4, 3},
+				{window, "user1", 1, 0},
+				// The window includes its end
+				{window + 10*time.Second, "user1", 1, 0},
+				{window + 10*time.Second + time.Millisecond, "user1", 4, 3},
+				{2*window + 10*time.Second, "user1", 1, 0},
+				{2*window + 10*time.Second, "user2", 3, 3},
+			},
+			backends: map[string]newLimiter{
+				"in_memory": func(t *testing.T, key string) types.TimeLimiter {
+					return fcinmemory.NewLimiter(key, window, limit)
+				},
+				"redis": func(t *testing.T, key string) types.TimeLimiter {
+					return fcredis.NewLimiter(redisClient(t), key, window, limit, false, fcredis.WithFirstRequestAlignment())
+				},
+			},
+		},
+		{
+			name: "sliding_window",
+			trace: []step{
+				{0, "user1", 3, 3},
+				{30 * time.Second, "user1", 1, 0},
+				{30 * time.Second, "user2", 3, 3},
+				// The previous window fully overlaps the sliding window at the start of the next one
+				{window, "user1", 1, 0},
+				// Half of the previous window's 3 requests count, so one more fits
+				{window + 30*time.Second, "user1", 2, 1},
+				// A quarter of them count next to the 1 in the current window
+				{window + 45*time.Second, "user1", 2, 1},
+				// Neither of the last two windows had requests
+				{3*window + 20*time.Second, "user1", 4, 3},
+			},
+			backends: map[string]newLimiter{
+				"in_memory": func(t *testing.T, key string) types.TimeLimiter {
+					return swinmemory.NewLimiter(key, window, limit)
+				},
+				"redis": func(t *testing.T, key string) types.TimeLimiter {
+					return swredis.NewLimiter(key, window, limit, redisClient(t))
+				},
+				"memcache": func(t *testing.T, key string) types.TimeLimiter {
+					client := memcache.New(testenv.Memcached(t))
+					return swcmemcache.NewLimiter(key, window, limit, client, nil).(types.TimeLimiter)
+				},
+			},
+		},
+		{
+			name: "token_bucket",
+			trace: []step{
+				{0, "user1", 4, 3},
+				{0, "user2", 3, 3},
+				{999 * time.Millisecond, "user1", 1, 0},
+				{time.Second, "user1", 2, 1},
+				// Denied requests keep the time towards the next token
+				{1500 * time.Millisecond, "user1", 1, 0},
+				{2 * time.Second, "user1", 1, 1},
+				// A refill keeps the time beyond the whole tokens it adds
+				{3500 * time.Millisecond, "user1", 1, 1},
+				{4 * time.Second, "user1", 1, 1},
+				// A full bucket accumulates no time towards the next token
+				{30*time.Second + 900*time.Millisecond, "user1", 1, 1},
+				{31 * time.Second, "user1", 3, 2},
+			},
+			backends: map[string]newLimiter{
+				"in_memory": func(t *testing.T, key string) types.TimeLimiter {
+					return tbinmemory.NewLimiter(key, rate, limit, 0)
+				},
+				"redis": func(t *testing.T, key string) types.TimeLimiter {
+					return tbredis.NewLimiter(key, rate, limit, 0, redisClient(t)).(types.TimeLimiter)
+				},
+				"memcache": func(t *testing.T, key string) types.TimeLimiter {
+					client := memcache.New(testenv.Memcached(t))
+					return tbmemcache.NewLimiter(key, rate, limit, 0, client, nil).(types.TimeLimiter)
+				},
+			},
+		},
+		{
+			name: "leaky_bucket",
+			trace: []step{
+				{0, "user1", 4, 3},
+				{500 * time.Millisecond, "user1", 1, 0},
+				{500 * time.Millisecond, "user2", 3, 3},
+				{time.Second, "user1", 2, 1},
+				{3 * time.Second, "user1", 3, 2},
+			},
+			backends: map[string]newLimiter{
+				"in_memory": func(t *testing.T, key string) types.TimeLimiter {
+					return lbinmemory.NewLimiter(key, rate, limit).(types.TimeLimiter)
+				},
+				"redis": func(t *testing.T, key string) types.TimeLimiter {
+					return lbredis.NewLimiter(key, rate, limit, redisClient(t)).(types.TimeLimiter)
+				},
+				"memcache": func(t *testing.T, key string) types.TimeLimiter {
+					client := memcache.New(testenv.Memcached(t))
+					return lbmemcache.NewLimiter(key, rate, limit, client, nil).(types.TimeLimiter)
+				},
+			},
+		},
+	}
+}
+
+// redisClient returns a client of the Redis server provided by testenv.
+func redisClient(t *testing.T) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// TestConformance tests that every backend of an algorithm allows the requests of its trace the specification allows.
+func TestConformance(t *testing.T) {
+	// Start at a window boundary near the current time, so remote backends do not expire state in the middle of a trace
+	now := time.Now().UnixMilli()
+	start := time.UnixMilli(now - now%window.Milliseconds())
+	for _, spec := range specs() {
+		for backend, newLimiter := range spec.backends {
+			t.Run(spec.name+"/"+backend, func(t *testing.T) {
+				limiter := newLimiter(t, fmt.Sprintf("conformance-%d", time.Now().UnixNano()))
+				for i, step := range spec.trace {
+					allowed := 0
+					for j := 0; j < step.requests; j++ {
+						ok, err := limiter.AllowAt(context.Background(), step.identifier, start.Add(step.at))
+						if err != nil {
+							t.Fatalf("Step %d: AllowAt returned error: %v", i, err)
+						}
+						if ok {
+							allowed++
+						}
+					}
+					if allowed != step.allowed {
+						t.Errorf("Step %d (%s at +%v): expected %d of %d requests allowed, got %d", i, step.identifier, step.at, step.allowed, step.requests, allowed)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestConcurrentRequests tests that no backend allows more requests than the limit when they arrive at once, as
+// when several instances check the same identifier. Memcache limiters update state with cas, so they may give up
+// with an error under contention, but never allow a request a concurrent one already took the budget of.
+func TestConcurrentRequests(t *testing.T) {
+	const requests = 4 * limit
+	now := time.Now().UnixMilli()
+	start := time.UnixMilli(now - now%window.Milliseconds())
+	for _, spec := range specs() {
+		for backend, newLimiter := range spec.backends {
+			t.Run(spec.name+"/"+backend, func(t *testing.T) {
+				limiter := newLimiter(t, fmt.Sprintf("concurrent-%d", time.Now().UnixNano()))
+				var (
+					wg      sync.WaitGroup
+					mu      sync.Mutex
+					allowed int
+					errs    int
+				)
+				for range requests {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						ok, err := limiter.AllowAt(context.Background(), "user1", start)
+						mu.Lock()
+						defer mu.Unlock()
+						switch {
+						case err != nil:
+							errs++
+						case ok:
+							allowed++
+						}
+					}()
+				}
+				wg.Wait()
+				if allowed > limit {
+					t.Errorf("Expected at most %d of %d concurrent requests allowed, got %d", limit, requests, allowed)
+				}
+				if errs == 0 && allowed != limit {
+					t.Errorf("Expected %d of %d concurrent requests allowed, got %d", limit, requests, allowed)
+				}
+			})
+		}
+	}
+}
+
+// TestInvalidCost tests that every backend rejects requests costing less than one unit without charging the budget.
+func TestInvalidCost(t *testing.T) {
+	ctx := context.Background()
+	for _, spec := range specs() {
+		for backend, newLimiter := range spec.backends {
+			t.Run(spec.name+"/"+backend, func(t *testing.T) {
+				limiter := newLimiter(t, fmt.Sprintf("invalid-cost-%d", time.Now().UnixNano()))
+				costLimiter, ok := limiter.(types.CostLimiter)
+				if !ok {
+					t.Skip("Limiter does not support AllowN")
+				}
+				for _, n := range []int{0, -limit} {
+					if _, err := costLimiter.AllowN(ctx, "user1", n); !errors.Is(err, types.ErrInvalidCost) {
+						t.Errorf("AllowN(%d): expected ErrInvalidCost, got %v", n, err)
+					}
+					if _, err := types.AllowDetailed(ctx, limiter, "user1", n); !errors.Is(err, types.ErrInvalidCost) {
+						t.Errorf("AllowDetailed(%d): expected ErrInvalidCost, got %v", n, err)
+					}
+					if _, err := types.Reserve(ctx, limiter, "user1", n, 0); !errors.Is(err, types.ErrInvalidCost) {
+						t.Errorf("Reserve(%d): expected ErrInvalidCost, got %v", n, err)
+					}
+				}
+				if allowed, err := costLimiter.AllowN(ctx, "user1", limit); err != nil || !allowed {
+					t.Errorf("Expected the whole budget left after invalid requests, got %v, %v", allowed, err)
+				}
+			})
+		}
+	}
+}
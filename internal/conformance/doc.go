@@ -0,0 +1,27 @@
+// Package conformance specifies the behavior every backend of an algorithm shares, so a limiter admits the same
+// requests whichever backend keeps its state. Its tests replay scripted traces of request times (see
+// types.TimeLimiter.AllowAt) against each backend of each algorithm and expect the admissions the rules below give.
+//
+// All algorithms:
+//   - State is kept per identifier: identifiers never share a budget.
+//   - Denied requests consume no budget.
+//   - Remote backends keep times in Unix milliseconds, so behavior is only specified to the millisecond.
+//   - A time earlier than the latest time seen for an identifier is treated as that latest time (see clock).
+//
+// Fixed window counter: windows aligned to the wall clock start at multiples of the window size since the Unix epoch
+// and end where the next one starts. Windows aligned to the first request start at the first request after the
+// previous window ended and include their end. Each backend has its own default alignment
+// (see config.DefaultWindowAlignment), but both alignments behave the same on every backend.
+//
+// Sliding window counter: windows start at multiples of the window size since the Unix epoch. A request is allowed if
+// the count of the current window, plus the count of the previous window weighted by the share of it the sliding
+// window ending now still overlaps, plus the request's cost does not exceed the limit.
+//
+// Token bucket: a bucket starts full and refills whole tokens at the configured rate. The time elapsed towards the
+// next token is kept across requests, including denied ones, but none accumulates while the bucket is full.
+//
+// Leaky bucket: a bucket starts empty and drains continuously at the configured rate. A request is allowed if it
+// fits in the capacity left.
+//
+// The Memcache backend only implements the token bucket.
+package conformance
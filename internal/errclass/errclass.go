@@ -0,0 +1,123 @@
+// Package errclass classifies the errors returned by limiters by their cause, so backend failures are counted and
+// answered by kind: a backend timing out or unreachable may serve the same request moments later, stored state that
+// cannot be decoded will not.
+package errclass
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/internal/codec"
+	"learn.ratelimiter/internal/mempressure"
+	"learn.ratelimiter/types"
+)
+
+// Class is the kind of a limiter error, used as the class label of the backend errors metric.
+type Class string
+
+// Classes returned by Classify.
+const (
+	// Timeout is a backend call that did not complete in time, including the wait for a pooled connection.
+	Timeout Class = "timeout"
+	// Connection is a backend that could not be reached or closed the connection.
+	Connection Class = "connection"
+	// NoScript is Redis missing a Lua script it was asked to run by hash, e.g., after a restart.
+	NoScript Class = "noscript"
+	// OutOfMemory is Redis rejecting a write because it reached maxmemory.
+	OutOfMemory Class = "oom"
+	// Saturated is a bulkhead failing a check closed because too many backend calls are in flight.
+	Saturated Class = "saturated"
+	// Serialization is stored state that could not be encoded or decoded, including state written by a newer release.
+	Serialization Class = "serialization"
+	// Canceled is a check abandoned because the request's context was cancelled, e.g., the client went away.
+	Canceled Class = "canceled"
+	// Other is any other error.
+	Other Class = "other"
+)
+
+// Classify returns the class of err, which must not be nil. Wrapped errors are classified by their cause.
+func Classify(err error) Class {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case errors.Is(err, types.ErrBackendSaturated):
+		return Saturated
+	case errors.Is(err, types.ErrBackendOutOfMemory) || mempressure.IsOOM(err):
+		return OutOfMemory
+	case isNoScript(err):
+		return NoScript
+	case isSerialization(err):
+		return Serialization
+	case isTimeout(err):
+		return Timeout
+	case isConnection(err):
+		return Connection
+	}
+	return Other
+}
+
+// Transient reports whether errors of the class come from the state of the backend at the time of the check, so
+// the same request may succeed when retried later.
+func (c Class) Transient() bool {
+	switch c {
+	case Timeout, Connection, NoScript, OutOfMemory, Saturated:
+		return true
+	}
+	return false
+}
+
+// isNoScript reports whether err is Redis answering NOSCRIPT to an EVALSHA.
+func isNoScript(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(redisErr.Error(), "NOSCRIPT")
+}
+
+// isSerialization reports whether err is a failure to encode or decode stored state or a backend reply.
+func isSerialization(err error) bool {
+	var (
+		syntaxErr           *json.SyntaxError
+		typeErr             *json.UnmarshalTypeError
+		numErr              *strconv.NumError
+		unsupportedTypeErr  *json.UnsupportedTypeError
+		unsupportedValueErr *json.UnsupportedValueError
+	)
+	return errors.Is(err, types.ErrIncompatibleState) || errors.Is(err, codec.ErrUnsupportedVersion) ||
+		errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.As(err, &numErr) ||
+		errors.As(err, &unsupportedTypeErr) || errors.As(err, &unsupportedValueErr)
+}
+
+// isTimeout reports whether err is a deadline being exceeded, by the request's context, a network call or the wait
+// for a pooled Redis connection.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// go-redis does not export its pool timeout error
+	return strings.Contains(err.Error(), "redis: connection pool timeout")
+}
+
+// isConnection reports whether err is a backend refusing, resetting or closing a connection, or one that could not be
+// dialled at all.
+func isConnection(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, redis.ErrClosed) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr)
+}
@@ -0,0 +1,70 @@
+// Package errclass_test contains tests for the classification of limiter errors.
+package errclass_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"learn.ratelimiter/internal/codec"
+	"learn.ratelimiter/internal/errclass"
+	"learn.ratelimiter/types"
+)
+
+// redisError is an error replied by Redis.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+func (redisError) RedisError()     {}
+
+// TestClassify tests that wrapped backend errors are classified by their cause, and that only failures of the
+// backend at the time of the check are transient.
+func TestClassify(t *testing.T) {
+	var syntaxErr *json.SyntaxError
+	errors.As(json.Unmarshal([]byte("{"), &struct{}{}), &syntaxErr)
+	_, numErr := strconv.ParseInt("x", 10, 64)
+
+	for _, tc := range []struct {
+		err       error
+		want      errclass.Class
+		transient bool
+	}{
+		{context.DeadlineExceeded, errclass.Timeout, true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, errclass.Timeout, true},
+		{errors.New("redis: connection pool timeout"), errclass.Timeout, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, errclass.Connection, true},
+		{io.EOF, errclass.Connection, true},
+		{redisError("NOSCRIPT No matching script. Please use EVAL."), errclass.NoScript, true},
+		{redisError("OOM command not allowed when used memory > 'maxmemory'."), errclass.OutOfMemory, true},
+		{types.ErrBackendOutOfMemory, errclass.OutOfMemory, true},
+		{types.ErrBackendSaturated, errclass.Saturated, true},
+		{types.ErrIncompatibleState, errclass.Serialization, false},
+		{codec.ErrUnsupportedVersion, errclass.Serialization, false},
+		{syntaxErr, errclass.Serialization, false},
+		{numErr, errclass.Serialization, false},
+		{context.Canceled, errclass.Canceled, false},
+		{redisError("ERR wrong number of arguments"), errclass.Other, false},
+		{errors.New("unexpected"), errclass.Other, false},
+	} {
+		err := fmt.Errorf("limiter 'api': %w", tc.err)
+		if got := errclass.Classify(err); got != tc.want {
+			t.Errorf("Classify(%v) = %q, want %q", err, got, tc.want)
+		}
+		if got := tc.want.Transient(); got != tc.transient {
+			t.Errorf("%q.Transient() = %v, want %v", tc.want, got, tc.transient)
+		}
+	}
+}
+
+// timeoutError is a network error reporting a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
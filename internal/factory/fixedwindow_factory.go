@@ -7,7 +7,9 @@ import (
 	"github.com/rs/zerolog/log" // Import zerolog's global logger
 
 	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/codec"
 	inmemoryfc "learn.ratelimiter/internal/fixedcounter/inmemory"
+	fcpacing "learn.ratelimiter/internal/fixedcounter/pacing"
 	redisfc "learn.ratelimiter/internal/fixedcounter/redis"
 	"learn.ratelimiter/types"
 )
@@ -29,18 +31,30 @@ func (f *FixedWindowFactory) CreateLimiter(cfg config.LimiterConfig, clients typ
 		log.Error().Err(err).Str("factory", "FixedWindowCounter").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
 		return nil, err
 	}
+	var pacer *fcpacing.Pacer
+	if smoothing := cfg.WindowParams.Smoothing; smoothing != nil {
+		pacer = &fcpacing.Pacer{BurstFraction: smoothing.BurstFraction, Delay: smoothing.Mode == config.SmoothingDelay}
+	}
 	switch cfg.Backend {
 	case config.InMemory:
 		log.Info().Str("factory", "FixedWindowCounter").Str("backend", "InMemory").Str("limiter_key", cfg.Key).Dur("window", cfg.WindowParams.Window).Int64("limit", cfg.WindowParams.Limit).Msg("Factory: Creating in-memory limiter")
-		return inmemoryfc.NewLimiter(cfg.Key, cfg.WindowParams.Window, cfg.WindowParams.Limit), nil
+		opts := []inmemoryfc.Option{inmemoryfc.WithPacer(pacer)}
+		if alignment(cfg) == config.AlignWallClock {
+			opts = append(opts, inmemoryfc.WithWallClockAlignment())
+		}
+		return inmemoryfc.NewLimiter(cfg.Key, cfg.WindowParams.Window, cfg.WindowParams.Limit, opts...), nil
 	case config.Redis:
-		log.Info().Str("factory", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", cfg.Key).Dur("window", cfg.WindowParams.Window).Int64("limit", cfg.WindowParams.Limit).Msg("Factory: Creating Redis limiter")
+		log.Info().Str("factory", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", cfg.Key).Dur("window", cfg.WindowParams.Window).Int64("limit", cfg.WindowParams.Limit).Bool("cache_denials", cfg.WindowParams.CacheDenials).Msg("Factory: Creating Redis limiter")
 		if clients.RedisClient == nil {
 			err := fmt.Errorf("redis client is required but not provided for redis backend for key '%s'", cfg.Key)
 			log.Error().Err(err).Str("factory", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
 			return nil, err
 		}
-		return redisfc.NewLimiter(clients.RedisClient, cfg.Key, cfg.WindowParams.Window, cfg.WindowParams.Limit), nil
+		opts := []redisfc.Option{redisfc.WithPacer(pacer), redisfc.WithKeyCache(keyCacheSize(cfg))}
+		if alignment(cfg) == config.AlignFirstRequest {
+			opts = append(opts, redisfc.WithFirstRequestAlignment())
+		}
+		return redisfc.NewLimiter(clients.RedisClient, cfg.Key, cfg.WindowParams.Window, cfg.WindowParams.Limit, cfg.WindowParams.CacheDenials, opts...), nil
 	case config.Memcache:
 		err := fmt.Errorf("memcache backend not yet implemented for fixed window counter for key '%s'", cfg.Key)
 		log.Error().Err(err).Str("factory", "FixedWindowCounter").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
@@ -51,3 +65,35 @@ func (f *FixedWindowFactory) CreateLimiter(cfg config.LimiterConfig, clients typ
 		return nil, err
 	}
 }
+
+// keyCacheSize returns the number of Redis keys the limiter caches, from its redis_params.
+func keyCacheSize(cfg config.LimiterConfig) int {
+	if cfg.RedisParams == nil {
+		return 0
+	}
+	return cfg.RedisParams.KeyCacheSize
+}
+
+// memcacheCodec returns the encoding of the limiter's stored state, from its memcache_params.
+func memcacheCodec(cfg config.LimiterConfig) (codec.Codec, error) {
+	if cfg.MemcacheParams == nil {
+		return codec.JSON, nil
+	}
+	c, err := codec.New(cfg.MemcacheParams.Codec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memcache codec for key '%s': %w", cfg.Key, err)
+	}
+	c, err = codec.Compress(c, cfg.MemcacheParams.Compression, cfg.MemcacheParams.CompressionThreshold)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memcache compression for key '%s': %w", cfg.Key, err)
+	}
+	return c, nil
+}
+
+// alignment returns where the limiter's windows start, defaulting to the backend's historical alignment.
+func alignment(cfg config.LimiterConfig) config.WindowAlignment {
+	if cfg.WindowParams.Alignment != "" {
+		return cfg.WindowParams.Alignment
+	}
+	return config.DefaultWindowAlignment(cfg.Backend)
+}
@@ -0,0 +1,62 @@
+package factory
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	lbinmemory "learn.ratelimiter/internal/leakybucket/inmemory"
+	lbredis "learn.ratelimiter/internal/leakybucket/redis"
+	"learn.ratelimiter/types"
+)
+
+// LeakyBucketFactory creates limiters using the Leaky Bucket algorithm.
+type LeakyBucketFactory struct{}
+
+// NewLeakyBucketFactory returns a new LeakyBucketFactory instance.
+func NewLeakyBucketFactory() (*LeakyBucketFactory, error) {
+	return &LeakyBucketFactory{}, nil
+}
+
+// CreateLimiter creates a Leaky Bucket limiter based on the configuration and backend clients.
+// It takes a LimiterConfig and BackendClients and returns a types.Limiter or an error.
+func (*LeakyBucketFactory) CreateLimiter(cfg config.LimiterConfig, clients types.BackendClients) (types.Limiter, error) {
+	log.Info().Str("factory", "LeakyBucket").Str("limiter_key", cfg.Key).Str("backend", string(cfg.Backend)).Msg("Factory: Creating limiter")
+	if cfg.LeakyBucketParams == nil {
+		err := fmt.Errorf("leaky bucket parameters are missing in config for key '%s'", cfg.Key)
+		log.Error().Err(err).Str("factory", "LeakyBucket").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+		return nil, err
+	}
+
+	switch cfg.Backend {
+	case config.InMemory:
+		log.Info().Str("factory", "LeakyBucket").Str("backend", "InMemory").Str("limiter_key", cfg.Key).Int("rate", cfg.LeakyBucketParams.Rate).Int("capacity", cfg.LeakyBucketParams.Capacity).Msg("Factory: Creating in-memory limiter")
+		return lbinmemory.NewLimiter(cfg.Key, cfg.LeakyBucketParams.Rate, cfg.LeakyBucketParams.Capacity), nil
+	case config.Redis:
+		log.Info().Str("factory", "LeakyBucket").Str("backend", "Redis").Str("limiter_key", cfg.Key).Int("rate", cfg.LeakyBucketParams.Rate).Int("capacity", cfg.LeakyBucketParams.Capacity).Msg("Factory: Creating Redis limiter")
+		if clients.RedisClient == nil {
+			err := fmt.Errorf("redis client is required but not provided for redis backend for key '%s'", cfg.Key)
+			log.Error().Err(err).Str("factory", "LeakyBucket").Str("backend", "Redis").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+			return nil, err
+		}
+		return lbredis.NewLimiter(cfg.Key, cfg.LeakyBucketParams.Rate, cfg.LeakyBucketParams.Capacity, clients.RedisClient, lbredis.WithKeyCache(keyCacheSize(cfg))), nil
+	case config.Memcache:
+		log.Info().Str("factory", "LeakyBucket").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Int("rate", cfg.LeakyBucketParams.Rate).Int("capacity", cfg.LeakyBucketParams.Capacity).Msg("Factory: Creating Memcache limiter")
+		if clients.MemcacheClient == nil {
+			err := fmt.Errorf("memcache client is required but not provided for memcache backend for key '%s'", cfg.Key)
+			log.Error().Err(err).Str("factory", "LeakyBucket").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+			return nil, err
+		}
+		stateCodec, err := memcacheCodec(cfg)
+		if err != nil {
+			log.Error().Err(err).Str("factory", "LeakyBucket").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+			return nil, err
+		}
+		return newLeakyBucketMemcache(cfg, clients.MemcacheClient, stateCodec)
+	default:
+		err := fmt.Errorf("unsupported backend type '%s' for leaky bucket for key '%s'", cfg.Backend, cfg.Key)
+		log.Error().Err(err).Str("factory", "LeakyBucket").Str("backend", string(cfg.Backend)).Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+		return nil, err
+	}
+}
@@ -0,0 +1,52 @@
+//go:build !nomemcache
+
+package factory
+
+import (
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/codec"
+	lbmemcache "learn.ratelimiter/internal/leakybucket/memcache"
+	swcmemcache "learn.ratelimiter/internal/slidingwindowcounter/memcache"
+	swlmemcache "learn.ratelimiter/internal/slidingwindowlog/memcache"
+	tbmemcache "learn.ratelimiter/internal/tokenbucket/memcache"
+	"learn.ratelimiter/types"
+)
+
+// The Memcache limiters are created here rather than in the factories, so builds with the nomemcache tag do not link
+// them (see memcache_excluded.go). Their configuration has been checked by the factories.
+
+// newTokenBucketMemcache creates a Memcache Token Bucket limiter of cfg storing state with stateCodec.
+func newTokenBucketMemcache(cfg config.LimiterConfig, client *types.MemcacheClient, stateCodec codec.Codec) (types.Limiter, error) {
+	var opts []tbmemcache.Option
+	if cfg.MemcacheParams.ProxyCompatible {
+		opts = append(opts, tbmemcache.WithoutCAS())
+	}
+	return tbmemcache.NewLimiter(cfg.Key, cfg.TokenBucketParams.Rate, cfg.TokenBucketParams.Capacity, cfg.TokenBucketParams.MaxDebt, client, stateCodec, opts...), nil
+}
+
+// newLeakyBucketMemcache creates a Memcache Leaky Bucket limiter of cfg storing state with stateCodec.
+func newLeakyBucketMemcache(cfg config.LimiterConfig, client *types.MemcacheClient, stateCodec codec.Codec) (types.Limiter, error) {
+	var opts []lbmemcache.Option
+	if cfg.MemcacheParams.ProxyCompatible {
+		opts = append(opts, lbmemcache.WithoutCAS())
+	}
+	return lbmemcache.NewLimiter(cfg.Key, cfg.LeakyBucketParams.Rate, cfg.LeakyBucketParams.Capacity, client, stateCodec, opts...), nil
+}
+
+// newSlidingWindowCounterMemcache creates a Memcache Sliding Window Counter limiter of cfg storing state with stateCodec.
+func newSlidingWindowCounterMemcache(cfg config.LimiterConfig, client *types.MemcacheClient, stateCodec codec.Codec) (types.Limiter, error) {
+	var opts []swcmemcache.Option
+	if cfg.MemcacheParams.ProxyCompatible {
+		opts = append(opts, swcmemcache.WithoutCAS())
+	}
+	return swcmemcache.NewLimiter(cfg.Key, cfg.WindowParams.Window, cfg.WindowParams.Limit, client, stateCodec, opts...), nil
+}
+
+// newSlidingWindowLogMemcache creates a Memcache Sliding Window Log limiter of cfg storing state with stateCodec.
+func newSlidingWindowLogMemcache(cfg config.LimiterConfig, client *types.MemcacheClient, stateCodec codec.Codec) (types.Limiter, error) {
+	var opts []swlmemcache.Option
+	if cfg.MemcacheParams.ProxyCompatible {
+		opts = append(opts, swlmemcache.WithoutCAS())
+	}
+	return swlmemcache.NewLimiter(cfg.Key, cfg.WindowParams.Window, cfg.WindowParams.Limit, client, stateCodec, opts...), nil
+}
@@ -0,0 +1,36 @@
+//go:build nomemcache
+
+package factory
+
+import (
+	"fmt"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/codec"
+	"learn.ratelimiter/types"
+)
+
+// errMemcacheExcluded returns the error of creating a Memcache limiter of cfg in a build with the nomemcache tag.
+func errMemcacheExcluded(cfg config.LimiterConfig) error {
+	return fmt.Errorf("memcache backend is excluded from this build (nomemcache tag) for key '%s'", cfg.Key)
+}
+
+// newTokenBucketMemcache returns an error: the Memcache limiters are not linked in this build.
+func newTokenBucketMemcache(cfg config.LimiterConfig, _ *types.MemcacheClient, _ codec.Codec) (types.Limiter, error) {
+	return nil, errMemcacheExcluded(cfg)
+}
+
+// newLeakyBucketMemcache returns an error: the Memcache limiters are not linked in this build.
+func newLeakyBucketMemcache(cfg config.LimiterConfig, _ *types.MemcacheClient, _ codec.Codec) (types.Limiter, error) {
+	return nil, errMemcacheExcluded(cfg)
+}
+
+// newSlidingWindowCounterMemcache returns an error: the Memcache limiters are not linked in this build.
+func newSlidingWindowCounterMemcache(cfg config.LimiterConfig, _ *types.MemcacheClient, _ codec.Codec) (types.Limiter, error) {
+	return nil, errMemcacheExcluded(cfg)
+}
+
+// newSlidingWindowLogMemcache returns an error: the Memcache limiters are not linked in this build.
+func newSlidingWindowLogMemcache(cfg config.LimiterConfig, _ *types.MemcacheClient, _ codec.Codec) (types.Limiter, error) {
+	return nil, errMemcacheExcluded(cfg)
+}
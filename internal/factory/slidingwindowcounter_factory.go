@@ -43,12 +43,21 @@ func (*SlidingWindowCounterFactory) CreateLimiter(cfg config.LimiterConfig, clie
 			log.Error().Err(err).Str("factory", "SlidingWindowCounter").Str("backend", "Redis").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
 			return nil, err
 		}
-		return swredis.NewLimiter(cfg.Key, cfg.WindowParams.Window, cfg.WindowParams.Limit, clients.RedisClient), nil
+		return swredis.NewLimiter(cfg.Key, cfg.WindowParams.Window, cfg.WindowParams.Limit, clients.RedisClient, swredis.WithKeyCache(keyCacheSize(cfg))), nil
 
 	case config.Memcache:
-		err := fmt.Errorf("memcache backend not yet implemented for sliding window counter for key '%s'", cfg.Key)
-		log.Error().Err(err).Str("factory", "SlidingWindowCounter").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
-		return nil, err
+		log.Info().Str("factory", "SlidingWindowCounter").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Dur("window", cfg.WindowParams.Window).Int64("limit", cfg.WindowParams.Limit).Msg("Factory: Creating Memcache limiter")
+		if clients.MemcacheClient == nil {
+			err := fmt.Errorf("memcache client is required but not provided for memcache backend for key '%s'", cfg.Key)
+			log.Error().Err(err).Str("factory", "SlidingWindowCounter").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+			return nil, err
+		}
+		stateCodec, err := memcacheCodec(cfg)
+		if err != nil {
+			log.Error().Err(err).Str("factory", "SlidingWindowCounter").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+			return nil, err
+		}
+		return newSlidingWindowCounterMemcache(cfg, clients.MemcacheClient, stateCodec)
 	default:
 		err := fmt.Errorf("unsupported backend type '%s' for sliding window counter for key '%s'", cfg.Backend, cfg.Key)
 		log.Error().Err(err).Str("factory", "SlidingWindowCounter").Str("backend", string(cfg.Backend)).Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
@@ -0,0 +1,62 @@
+package factory
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	swlinmemory "learn.ratelimiter/internal/slidingwindowlog/inmemory"
+	swlredis "learn.ratelimiter/internal/slidingwindowlog/redis"
+	"learn.ratelimiter/types"
+)
+
+// SlidingWindowLogFactory creates limiters using the Sliding Window Log algorithm.
+type SlidingWindowLogFactory struct{}
+
+// NewSlidingWindowLogFactory returns a new SlidingWindowLogFactory instance.
+func NewSlidingWindowLogFactory() (*SlidingWindowLogFactory, error) {
+	return &SlidingWindowLogFactory{}, nil
+}
+
+// CreateLimiter creates a Sliding Window Log limiter based on the configuration and backend clients.
+// It takes a LimiterConfig and BackendClients and returns a types.Limiter or an error.
+func (*SlidingWindowLogFactory) CreateLimiter(cfg config.LimiterConfig, clients types.BackendClients) (types.Limiter, error) {
+	log.Info().Str("factory", "SlidingWindowLog").Str("limiter_key", cfg.Key).Str("backend", string(cfg.Backend)).Msg("Factory: Creating limiter")
+	if cfg.WindowParams == nil {
+		err := fmt.Errorf("sliding window log parameters are missing in config for key '%s'", cfg.Key)
+		log.Error().Err(err).Str("factory", "SlidingWindowLog").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+		return nil, err
+	}
+
+	switch cfg.Backend {
+	case config.InMemory:
+		log.Info().Str("factory", "SlidingWindowLog").Str("backend", "InMemory").Str("limiter_key", cfg.Key).Dur("window", cfg.WindowParams.Window).Int64("limit", cfg.WindowParams.Limit).Msg("Factory: Creating in-memory limiter")
+		return swlinmemory.NewLimiter(cfg.Key, cfg.WindowParams.Window, cfg.WindowParams.Limit), nil
+	case config.Redis:
+		log.Info().Str("factory", "SlidingWindowLog").Str("backend", "Redis").Str("limiter_key", cfg.Key).Dur("window", cfg.WindowParams.Window).Int64("limit", cfg.WindowParams.Limit).Msg("Factory: Creating Redis limiter")
+		if clients.RedisClient == nil {
+			err := fmt.Errorf("redis client is required but not provided for redis backend for key '%s'", cfg.Key)
+			log.Error().Err(err).Str("factory", "SlidingWindowLog").Str("backend", "Redis").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+			return nil, err
+		}
+		return swlredis.NewLimiter(cfg.Key, cfg.WindowParams.Window, cfg.WindowParams.Limit, clients.RedisClient, swlredis.WithKeyCache(keyCacheSize(cfg))), nil
+	case config.Memcache:
+		log.Info().Str("factory", "SlidingWindowLog").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Dur("window", cfg.WindowParams.Window).Int64("limit", cfg.WindowParams.Limit).Msg("Factory: Creating Memcache limiter")
+		if clients.MemcacheClient == nil {
+			err := fmt.Errorf("memcache client is required but not provided for memcache backend for key '%s'", cfg.Key)
+			log.Error().Err(err).Str("factory", "SlidingWindowLog").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+			return nil, err
+		}
+		stateCodec, err := memcacheCodec(cfg)
+		if err != nil {
+			log.Error().Err(err).Str("factory", "SlidingWindowLog").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+			return nil, err
+		}
+		return newSlidingWindowLogMemcache(cfg, clients.MemcacheClient, stateCodec)
+	default:
+		err := fmt.Errorf("unsupported backend type '%s' for sliding window log for key '%s'", cfg.Backend, cfg.Key)
+		log.Error().Err(err).Str("factory", "SlidingWindowLog").Str("backend", string(cfg.Backend)).Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+		return nil, err
+	}
+}
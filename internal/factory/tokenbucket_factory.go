@@ -33,23 +33,32 @@ func (*TokenBucketFactory) CreateLimiter(cfg config.LimiterConfig, clients types
 	switch cfg.Backend {
 	case config.InMemory:
 		// Added parameters to log
-		log.Info().Str("factory", "TokenBucket").Str("backend", "InMemory").Str("limiter_key", cfg.Key).Int("rate", cfg.TokenBucketParams.Rate).Int("capacity", cfg.TokenBucketParams.Capacity).Msg("Factory: Creating in-memory limiter")
+		log.Info().Str("factory", "TokenBucket").Str("backend", "InMemory").Str("limiter_key", cfg.Key).Int("rate", cfg.TokenBucketParams.Rate).Int("capacity", cfg.TokenBucketParams.Capacity).Int("max_debt", cfg.TokenBucketParams.MaxDebt).Msg("Factory: Creating in-memory limiter")
 		// Assuming the inmemory package has a New function matching the signature
-		return tbinmemory.NewLimiter(cfg.Key, cfg.TokenBucketParams.Rate, cfg.TokenBucketParams.Capacity), nil // Pass key to in-memory limiter
+		return tbinmemory.NewLimiter(cfg.Key, cfg.TokenBucketParams.Rate, cfg.TokenBucketParams.Capacity, cfg.TokenBucketParams.MaxDebt), nil // Pass key to in-memory limiter
 	case config.Redis:
 		// Added parameters to log
-		log.Info().Str("factory", "TokenBucket").Str("backend", "Redis").Str("limiter_key", cfg.Key).Int("rate", cfg.TokenBucketParams.Rate).Int("capacity", cfg.TokenBucketParams.Capacity).Msg("Factory: Creating Redis limiter")
+		log.Info().Str("factory", "TokenBucket").Str("backend", "Redis").Str("limiter_key", cfg.Key).Int("rate", cfg.TokenBucketParams.Rate).Int("capacity", cfg.TokenBucketParams.Capacity).Int("max_debt", cfg.TokenBucketParams.MaxDebt).Msg("Factory: Creating Redis limiter")
 		if clients.RedisClient == nil {
 			err := fmt.Errorf("redis client is required but not provided for redis backend for key '%s'", cfg.Key)
 			log.Error().Err(err).Str("factory", "TokenBucket").Str("backend", "Redis").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
 			return nil, err
 		}
-		return redistb.NewLimiter(cfg.Key, cfg.TokenBucketParams.Rate, cfg.TokenBucketParams.Capacity, clients.RedisClient), nil
+		return redistb.NewLimiter(cfg.Key, cfg.TokenBucketParams.Rate, cfg.TokenBucketParams.Capacity, cfg.TokenBucketParams.MaxDebt, clients.RedisClient, redistb.WithKeyCache(keyCacheSize(cfg)), redistb.WithServerTime(cfg.TokenBucketParams.ServerTime)), nil
 
 	case config.Memcache:
-		err := fmt.Errorf("memcache backend not yet implemented for token bucket for key '%s'", cfg.Key)
-		log.Error().Err(err).Str("factory", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
-		return nil, err
+		log.Info().Str("factory", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Int("rate", cfg.TokenBucketParams.Rate).Int("capacity", cfg.TokenBucketParams.Capacity).Int("max_debt", cfg.TokenBucketParams.MaxDebt).Msg("Factory: Creating Memcache limiter")
+		if clients.MemcacheClient == nil {
+			err := fmt.Errorf("memcache client is required but not provided for memcache backend for key '%s'", cfg.Key)
+			log.Error().Err(err).Str("factory", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+			return nil, err
+		}
+		stateCodec, err := memcacheCodec(cfg)
+		if err != nil {
+			log.Error().Err(err).Str("factory", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
+			return nil, err
+		}
+		return newTokenBucketMemcache(cfg, clients.MemcacheClient, stateCodec)
 	default:
 		err := fmt.Errorf("unsupported backend type '%s' for token bucket for key '%s'", cfg.Backend, cfg.Key)
 		log.Error().Err(err).Str("factory", "TokenBucket").Str("backend", string(cfg.Backend)).Str("limiter_key", cfg.Key).Msg("Factory: Creation failed")
@@ -0,0 +1,117 @@
+// Package failopen provides a limiter decorator allowing the requests whose check fails with an error, for limiters
+// started in degraded mode (startup_policy: degraded), whose backend may be unreachable.
+package failopen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// Limiter delegates to a limiter and allows requests whose check fails with an error other than the cancellation of
+// the request's context. Decisions the limiter makes are returned unchanged.
+type Limiter struct {
+	key     string // Limiter key from config
+	limiter types.Limiter
+}
+
+// NewLimiter creates a limiter failing open around limiter.
+func NewLimiter(key string, limiter types.Limiter) *Limiter {
+	return &Limiter{key: key, limiter: limiter}
+}
+
+// Allow checks if a request for the given identifier is allowed, allowing it if the check fails.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	allowed, err := l.limiter.Allow(ctx, identifier)
+	return l.outcome(ctx, identifier, allowed, err)
+}
+
+// AllowN checks if a request costing n units is allowed, allowing it if the check fails.
+// Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	if err := types.CheckCost(n); err != nil {
+		return false, err
+	}
+	costLimiter, ok := l.limiter.(types.CostLimiter)
+	if !ok {
+		return l.Allow(ctx, identifier)
+	}
+	allowed, err := costLimiter.AllowN(ctx, identifier, n)
+	return l.outcome(ctx, identifier, allowed, err)
+}
+
+// AllowAt checks if a request is allowed at time t, allowing it if the check fails.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	timeLimiter, ok := l.limiter.(types.TimeLimiter)
+	if !ok {
+		return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+	}
+	allowed, err := timeLimiter.AllowAt(ctx, identifier, t)
+	return l.outcome(ctx, identifier, allowed, err)
+}
+
+// AllowKey checks if a request for the composite key is allowed, allowing it if the check fails.
+func (l *Limiter) AllowKey(ctx context.Context, key types.Key) (bool, error) {
+	allowed, err := types.AllowKey(ctx, l.limiter, key)
+	return l.outcome(ctx, key.String(), allowed, err)
+}
+
+// Forget drops the identifier's state in the wrapped limiter.
+func (l *Limiter) Forget(identifier string) {
+	types.Forget(l.limiter, identifier)
+}
+
+// Pressure returns the fraction of the identifier's budget in use. Errors are returned, since there is no decision
+// to fail open.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	return types.Pressure(ctx, l.limiter, identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget is fully restored in the wrapped limiter.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	return types.ResetTime(ctx, l.limiter, identifier)
+}
+
+// Reserve reserves a request costing n units in the wrapped limiter, admitting it without delay if the check fails.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Reservation{}, err
+	}
+	reservation, err := types.Reserve(ctx, l.limiter, identifier, n, maxWait)
+	if err != nil {
+		allowed, err := l.outcome(ctx, identifier, false, err)
+		return types.Reservation{OK: allowed}, err
+	}
+	return reservation, nil
+}
+
+// AllowDetailed checks a request costing n units in the wrapped limiter with its result, which carries only the
+// decision if the check fails.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
+	result, err := types.AllowDetailed(ctx, l.limiter, identifier, n)
+	if err != nil {
+		allowed, err := l.outcome(ctx, identifier, false, err)
+		return types.Result{Allowed: allowed, Limit: -1, Remaining: -1}, err
+	}
+	return result, nil
+}
+
+// outcome allows the request if its check failed, unless the request itself was cancelled.
+func (l *Limiter) outcome(ctx context.Context, identifier string, allowed bool, err error) (bool, error) {
+	if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return allowed, err
+	}
+	log.Warn().Err(err).Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Check failed in degraded mode, allowing request")
+	metrics.RecordFailOpen(l.key)
+	return true, nil
+}
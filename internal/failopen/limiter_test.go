@@ -0,0 +1,48 @@
+// Package failopen_test contains tests for the fail-open limiter.
+package failopen_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"learn.ratelimiter/internal/failopen"
+	"learn.ratelimiter/types"
+)
+
+// failingLimiter returns err from every check, or denies the request if err is nil.
+type failingLimiter struct {
+	err error
+}
+
+func (f *failingLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return false, f.err
+}
+
+// TestFailOpen tests that failed checks are allowed while decisions and cancellations are returned unchanged.
+func TestFailOpen(t *testing.T) {
+	backend := &failingLimiter{err: errors.New("connection refused")}
+	limiter := failopen.NewLimiter("test_failopen", backend)
+
+	if allowed, err := limiter.Allow(context.Background(), "client1"); !allowed || err != nil {
+		t.Errorf("Expected a failed check to be allowed, got %v, %v", allowed, err)
+	}
+	if allowed, err := limiter.AllowN(context.Background(), "client1", 5); !allowed || err != nil {
+		t.Errorf("Expected a failed AllowN to fall back to Allow and be allowed, got %v, %v", allowed, err)
+	}
+	if allowed, err := limiter.AllowN(context.Background(), "client1", 0); allowed || !errors.Is(err, types.ErrInvalidCost) {
+		t.Errorf("Expected a request costing nothing rejected rather than allowed, got %v, %v", allowed, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	backend.err = context.Canceled
+	if allowed, err := limiter.Allow(ctx, "client1"); allowed || !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled check to return its error, got %v, %v", allowed, err)
+	}
+
+	backend.err = nil
+	if allowed, err := limiter.Allow(context.Background(), "client1"); allowed || err != nil {
+		t.Errorf("Expected a denial to be returned unchanged, got %v, %v", allowed, err)
+	}
+}
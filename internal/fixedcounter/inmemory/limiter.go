@@ -4,10 +4,16 @@ package fcinmemory
 import (
 	"context"
 	"fmt"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/internal/clock"
+	fcpacing "learn.ratelimiter/internal/fixedcounter/pacing"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
 )
 
 // CounterState holds the state for a single identifier's counter.
@@ -15,6 +21,8 @@ type CounterState struct {
 	mu        sync.Mutex
 	Count     int64
 	WindowEnd time.Time
+	// LastSeen is the latest request time observed, used to guard against time moving backwards.
+	LastSeen time.Time
 }
 
 // Limiter implements the Fixed Window Counter algorithm using in-memory storage.
@@ -25,57 +33,278 @@ type Limiter struct {
 	limit  int64
 
 	counters sync.Map // Map identifier (e.g., user ID, IP) to *CounterState
+
+	// pacer, if set, spreads the budget over the window.
+	pacer *fcpacing.Pacer
+	// wallClock aligns windows to multiples of the window size since the Unix epoch instead of starting them at the
+	// first request, like the Redis limiter.
+	wallClock bool
+}
+
+// Option configures optional behaviour of a Limiter.
+type Option func(*Limiter)
+
+// WithPacer spreads the window's budget over the window as described by the pacer.
+func WithPacer(pacer *fcpacing.Pacer) Option {
+	return func(l *Limiter) {
+		l.pacer = pacer
+	}
+}
+
+// WithWallClockAlignment starts windows at multiples of the window size since the Unix epoch, as the Redis limiter
+// does, instead of at each identifier's first request.
+func WithWallClockAlignment() Option {
+	return func(l *Limiter) {
+		l.wallClock = true
+	}
 }
 
 // NewLimiter creates a new in-memory Fixed Window Counter limiter.
-// It takes a unique key for the limiter, the size of the window, and the maximum limit of requests within the window.
-func NewLimiter(key string, window time.Duration, limit int64) *Limiter {
-	log.Info().Str("limiter_type", "FixedWindowCounter").Str("backend", "InMemory").Str("limiter_key", key).Dur("window", window).Int64("limit", limit).Msg("Limiter: Initialized")
-	return &Limiter{
+// It takes a unique key for the limiter, the size of the window, the maximum limit of requests within the window, and optional behaviour.
+func NewLimiter(key string, window time.Duration, limit int64, opts ...Option) *Limiter {
+	l := &Limiter{
 		key:      key,
 		window:   window,
 		limit:    limit,
 		counters: sync.Map{},
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	log.Info().Str("limiter_type", "FixedWindowCounter").Str("backend", "InMemory").Str("limiter_key", key).Dur("window", window).Int64("limit", limit).Bool("paced", l.pacer != nil).Bool("wall_clock", l.wallClock).Msg("Limiter: Initialized")
+	return l
 }
 
 // Allow checks if a request for the given identifier is allowed based on the Fixed Window Counter algorithm.
 // It takes a context and an identifier and returns true if the request is allowed, false otherwise, and an error if any occurred.
 func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
-	stateIface, _ := l.counters.LoadOrStore(identifier, &CounterState{})
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request costing n units for the given identifier fits in the remaining budget of the current window.
+// With a delaying pacer, a request beyond the budget released so far waits until enough is released or the context is done.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	result, err := l.AllowDetailed(ctx, identifier, n)
+	return result.Allowed, err
+}
+
+// AllowDetailed checks a request costing n units for the given identifier as AllowN does, with the budget left in the
+// current window, its end and, for a denied request, when the budget covering it is released.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	var maxDelay time.Duration
+	if l.pacer != nil && l.pacer.Delay {
+		maxDelay = l.window
+	}
+	result, delay, err := l.allow(ctx, identifier, n, time.Now(), maxDelay)
+	if err != nil || !result.Allowed || delay <= 0 {
+		return result, err
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// The reserved budget is not returned, as the window may have rolled over meanwhile
+		return types.Result{}, ctx.Err()
+	case <-timer.C:
+		return result, nil
+	}
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+// Requests beyond the budget released by a pacer are denied rather than delayed, since t is not the wall clock.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	result, _, err := l.allow(ctx, identifier, 1, t, 0)
+	return result.Allowed, err
+}
+
+// Reserve admits a request costing n units for the identifier if it fits in the remaining budget of the current window,
+// and, with a pacer, if enough budget is released within maxWait, in which case it must wait for the release before
+// proceeding. Budget of later windows cannot be reserved: a request denied because the window's budget is spent
+// should be retried once the next window starts.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	result, delay, err := l.allow(ctx, identifier, n, time.Now(), maxWait)
+	if !result.Allowed {
+		delay = result.RetryAfter
+	}
+	return types.Reservation{OK: result.Allowed, Delay: delay}, err
+}
+
+// allow evaluates a request costing n units at time now. If the request is admitted but must first wait up to maxDelay
+// for a pacer to release enough budget, the budget is reserved and the wait is returned. If it is denied, the result
+// carries the time until it could be admitted, unless it never can.
+func (l *Limiter) allow(ctx context.Context, identifier string, n int, now time.Time, maxDelay time.Duration) (types.Result, time.Duration, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, 0, err
+	}
+	// Load before LoadOrStore, so checks of known identifiers do not allocate a state to discard
+	stateIface, ok := l.counters.Load(identifier)
+	if !ok {
+		stateIface, _ = l.counters.LoadOrStore(identifier, &CounterState{})
+	}
 
 	state, ok := stateIface.(*CounterState)
 	if !ok {
 		err := fmt.Errorf("unexpected state type for identifier %s in in-memory limiter '%s'", identifier, l.key)
 		// Added limiter key and identifier to error log
-		log.Error().Err(err).Str("limiter_type", "FixedWindowCounter").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Error in Allow")
-		return false, err
+		log.Error().Err(err).Str("limiter_type", "FixedWindowCounter").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Error in Allow")
+		return types.Result{}, 0, err
 	}
 
 	state.mu.Lock()
 	defer state.mu.Unlock()
 
-	now := time.Now()
+	// Never let time move backwards for this identifier
+	now = clock.Clamp(now, state.LastSeen)
+	state.LastSeen = now
 
 	// Check if context is cancelled before proceeding
 	select {
 	case <-ctx.Done():
 		// Added limiter key and identifier to log
-		log.Warn().Err(ctx.Err()).Str("limiter_type", "FixedWindowCounter").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Context cancelled during check")
-		return false, ctx.Err()
+		log.Warn().Err(ctx.Err()).Str("limiter_type", "FixedWindowCounter").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Context cancelled during check")
+		return types.Result{}, 0, ctx.Err()
 	default:
 		// Continue
 	}
 
-	if now.After(state.WindowEnd) {
+	if l.windowEnded(state, now) {
 		state.Count = 0
-		state.WindowEnd = now.Add(l.window)
+		state.WindowEnd = l.windowEnd(now)
 	}
 
-	if state.Count < l.limit {
-		state.Count++
-		return true, nil
+	needed := state.Count + int64(n)
+	if needed > l.limit {
+		var retryAfter time.Duration
+		if int64(n) <= l.limit {
+			retryAfter = l.nextWindow(state).Sub(now)
+		}
+		return l.result(state, false, retryAfter, now), 0, nil
 	}
 
-	return false, nil
+	var delay time.Duration
+	elapsed := l.window - state.WindowEnd.Sub(now)
+	if needed > l.pacer.Allowance(l.limit, elapsed, l.window) {
+		delay = l.pacer.ReleasedAt(l.limit, needed, l.window) - elapsed
+		if delay > maxDelay {
+			return l.result(state, false, delay, now), 0, nil
+		}
+	}
+	state.Count = needed
+	return l.result(state, true, 0, now), delay, nil
+}
+
+// result returns the result of a decision on the identifier's counter at time now. The caller holds state.mu.
+func (l *Limiter) result(state *CounterState, allowed bool, retryAfter time.Duration, now time.Time) types.Result {
+	resetAt := state.WindowEnd
+	if state.Count == 0 {
+		resetAt = now
+	}
+	return types.Result{
+		Allowed:    allowed,
+		Limit:      l.limit,
+		Remaining:  max(l.limit-state.Count, 0),
+		ResetAt:    resetAt,
+		RetryAfter: retryAfter,
+	}
+}
+
+// Usage returns the fraction of the limit each identifier has used in its current window at time now.
+// Identifiers whose window has ended are left out.
+func (l *Limiter) Usage(now time.Time) map[string]float64 {
+	usage := make(map[string]float64)
+	l.counters.Range(func(identifier, stateIface interface{}) bool {
+		state, ok := stateIface.(*CounterState)
+		if !ok {
+			return true
+		}
+		state.mu.Lock()
+		if !l.windowEnded(state, now) && state.Count > 0 {
+			usage[identifier.(string)] = min(float64(state.Count)/float64(l.limit), 1)
+		}
+		state.mu.Unlock()
+		return true
+	})
+	return usage
+}
+
+// Pressure returns the fraction of the limit the identifier has used in its current window.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	stateIface, ok := l.counters.Load(identifier)
+	if !ok {
+		return 0, nil
+	}
+	state := stateIface.(*CounterState)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if l.windowEnded(state, clock.Clamp(time.Now(), state.LastSeen)) {
+		return 0, nil
+	}
+	return min(float64(state.Count)/float64(l.limit), 1), nil
+}
+
+// ResetTime returns the end of the identifier's current window, or now if it has used none of the limit.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	now := time.Now()
+	stateIface, ok := l.counters.Load(identifier)
+	if !ok {
+		return now, nil
+	}
+	state := stateIface.(*CounterState)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if l.windowEnded(state, clock.Clamp(now, state.LastSeen)) || state.Count == 0 {
+		return now, nil
+	}
+	return state.WindowEnd, nil
+}
+
+// KeyCount returns the number of identifiers with a counter, including idle ones, since counters are only dropped by Forget.
+func (l *Limiter) KeyCount() (int, bool) {
+	count := 0
+	l.counters.Range(func(_, _ interface{}) bool {
+		count++
+		return true
+	})
+	return count, true
+}
+
+// Forget drops the identifier's counter, so its next request starts a new window.
+func (l *Limiter) Forget(identifier string) {
+	l.counters.Delete(identifier)
+}
+
+// SetUsage starts a window for the identifier at time now with the given fraction of the limit already used.
+func (l *Limiter) SetUsage(identifier string, used float64, now time.Time) {
+	l.counters.Store(identifier, &CounterState{
+		Count:     int64(math.Round(min(max(used, 0), 1) * float64(l.limit))),
+		WindowEnd: l.windowEnd(now),
+		LastSeen:  now,
+	})
+}
+
+// windowEnd returns the end of the window starting or, for wall-clock windows, running at time now.
+func (l *Limiter) windowEnd(now time.Time) time.Time {
+	if !l.wallClock {
+		return now.Add(l.window)
+	}
+	windowMillis := max(l.window.Milliseconds(), 1)
+	return time.UnixMilli(now.UnixMilli()/windowMillis*windowMillis + windowMillis)
+}
+
+// nextWindow returns the start of the window after the identifier's current one.
+func (l *Limiter) nextWindow(state *CounterState) time.Time {
+	if l.wallClock {
+		return state.WindowEnd
+	}
+	// Windows starting at the first request include their end
+	return state.WindowEnd.Add(time.Nanosecond)
+}
+
+// windowEnded reports whether the identifier's window has ended at time now. Windows starting at the first request
+// include their end; wall-clock windows end where the next one starts.
+func (l *Limiter) windowEnded(state *CounterState, now time.Time) bool {
+	if l.wallClock {
+		return !now.Before(state.WindowEnd)
+	}
+	return now.After(state.WindowEnd)
 }
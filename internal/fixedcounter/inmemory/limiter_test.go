@@ -3,10 +3,12 @@ package fcinmemory_test
 
 import (
 	"context"
+	"math"
 	"testing"
 	"time"
 
 	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	fcpacing "learn.ratelimiter/internal/fixedcounter/pacing"
 )
 
 func TestFixedWindowLimiter(t *testing.T) {
@@ -53,3 +55,187 @@ func TestFixedWindowLimiter(t *testing.T) {
 		t.Fatalf("Request for different identifier unexpectedly denied")
 	}
 }
+
+func TestFixedWindowLimiterAllowAt(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("test_fixed_window_event_time", time.Minute, 2)
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Two events fill the window that starts at the first event time
+	for i := 0; i < 2; i++ {
+		allowed, err := limiter.AllowAt(ctx, "user1", start.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatalf("AllowAt failed: %v", err)
+		}
+		if !allowed {
+			t.Fatalf("Event %d unexpectedly denied", i+1)
+		}
+	}
+
+	// An out-of-order event from before the window is evaluated in the current window, not a new one
+	allowed, err := limiter.AllowAt(ctx, "user1", start.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("AllowAt failed: %v", err)
+	}
+	if allowed {
+		t.Fatalf("Out-of-order event unexpectedly allowed")
+	}
+
+	// An event after the window ends starts a new window regardless of the wall clock
+	allowed, err = limiter.AllowAt(ctx, "user1", start.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("AllowAt failed: %v", err)
+	}
+	if !allowed {
+		t.Fatalf("Event in next window unexpectedly denied")
+	}
+}
+
+// TestFixedWindowLimiterPacingDeny tests that a paced window releases only the burst fraction at first and the rest over the window.
+func TestFixedWindowLimiterPacingDeny(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("test_fixed_window_pacing", 10*time.Second, 10, fcinmemory.WithPacer(&fcpacing.Pacer{BurstFraction: 0.5}))
+	ctx := context.Background()
+	start := time.Unix(1700000000, 0)
+
+	for i := 0; i < 5; i++ {
+		if allowed, _ := limiter.AllowAt(ctx, "user1", start); !allowed {
+			t.Fatalf("Request %d within the burst fraction unexpectedly denied", i+1)
+		}
+	}
+	if allowed, _ := limiter.AllowAt(ctx, "user1", start); allowed {
+		t.Fatal("Expected request beyond the burst fraction to be denied")
+	}
+
+	// 20% into the window, another 10% of the rest (one request) has been released
+	if allowed, _ := limiter.AllowAt(ctx, "user1", start.Add(2*time.Second)); !allowed {
+		t.Fatal("Expected released budget to allow a request")
+	}
+	if allowed, _ := limiter.AllowAt(ctx, "user1", start.Add(2*time.Second)); allowed {
+		t.Fatal("Expected request beyond the released budget to be denied")
+	}
+
+	// At the end of the window the whole limit is available
+	allowedCount := 0
+	for i := 0; i < 10; i++ {
+		if allowed, _ := limiter.AllowAt(ctx, "user1", start.Add(10*time.Second)); allowed {
+			allowedCount++
+		}
+	}
+	if allowedCount != 4 {
+		t.Errorf("Expected the remaining 4 requests to be allowed at the end of the window, got %d", allowedCount)
+	}
+}
+
+// TestFixedWindowLimiterPacingDelay tests that a delaying pacer makes requests beyond the released budget wait.
+func TestFixedWindowLimiterPacingDelay(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("test_fixed_window_pacing_delay", 200*time.Millisecond, 4, fcinmemory.WithPacer(&fcpacing.Pacer{BurstFraction: 0.5, Delay: true}))
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.Allow(ctx, "user1"); !allowed {
+			t.Fatalf("Request %d within the burst fraction unexpectedly denied", i+1)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("Expected requests within the burst fraction to proceed immediately, took %v", elapsed)
+	}
+
+	// The third request is released halfway through the window
+	if allowed, err := limiter.Allow(ctx, "user1"); !allowed || err != nil {
+		t.Fatalf("Expected delayed request to be allowed, got %v, %v", allowed, err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected the third request to wait about 100ms, took %v", elapsed)
+	}
+
+	// A request whose context ends while waiting is not admitted
+	cancelled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if allowed, err := limiter.Allow(cancelled, "user1"); allowed || err == nil {
+		t.Errorf("Expected cancelled wait to fail, got %v, %v", allowed, err)
+	}
+}
+
+// TestAllowDoesNotAllocate tests that checking an identifier with existing state allocates nothing.
+func TestAllowDoesNotAllocate(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("bench_fixed_window", time.Minute, math.MaxInt64)
+	ctx := context.Background()
+	limiter.Allow(ctx, "user1")
+	if allocs := testing.AllocsPerRun(1000, func() { limiter.Allow(ctx, "user1") }); allocs != 0 {
+		t.Errorf("Expected Allow not to allocate, got %v allocations per call", allocs)
+	}
+}
+
+// BenchmarkAllow measures checking an identifier with existing state, run with -benchmem to report allocations.
+func BenchmarkAllow(b *testing.B) {
+	limiter := fcinmemory.NewLimiter("bench_fixed_window", time.Minute, math.MaxInt64)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			limiter.Allow(ctx, "user1")
+		}
+	})
+}
+
+// TestPressure tests that Pressure reports the fraction of the window's limit in use without charging it.
+func TestPressure(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("test_pressure", time.Minute, 4)
+	ctx := context.Background()
+
+	for _, want := range []float64{0, 0.5, 1} {
+		pressure, err := limiter.Pressure(ctx, "user1")
+		if err != nil {
+			t.Fatalf("Pressure returned error: %v", err)
+		}
+		if math.Abs(pressure-want) > 0.01 {
+			t.Errorf("Expected pressure %v, got %v", want, pressure)
+		}
+		for i := 0; i < 2; i++ {
+			limiter.Allow(ctx, "user1")
+		}
+	}
+	if allowed, _ := limiter.Allow(ctx, "user1"); allowed {
+		t.Error("Request should be denied at full pressure")
+	}
+	if pressure, _ := limiter.Pressure(ctx, "user2"); pressure != 0 {
+		t.Errorf("Expected no pressure for an identifier without state, got %v", pressure)
+	}
+}
+
+// TestWindowAlignment tests that windows start at the first request by default and at multiples of the window size
+// since the Unix epoch with wall-clock alignment.
+func TestWindowAlignment(t *testing.T) {
+	ctx := context.Background()
+	// 40s into a minute
+	start := time.Unix(1_700_000_020, 0)
+
+	t.Run("first_request", func(t *testing.T) {
+		limiter := fcinmemory.NewLimiter("test_first_request", time.Minute, 1)
+		if allowed, _ := limiter.AllowAt(ctx, "user1", start); !allowed {
+			t.Fatal("Expected the first request to be allowed")
+		}
+		// The window runs for a minute from the first request, past the minute boundary
+		if allowed, _ := limiter.AllowAt(ctx, "user1", start.Add(30*time.Second)); allowed {
+			t.Error("Expected a request within a minute of the first to be denied")
+		}
+		if allowed, _ := limiter.AllowAt(ctx, "user1", start.Add(61*time.Second)); !allowed {
+			t.Error("Expected a request after the window to be allowed")
+		}
+	})
+
+	t.Run("wall_clock", func(t *testing.T) {
+		limiter := fcinmemory.NewLimiter("test_wall_clock", time.Minute, 1, fcinmemory.WithWallClockAlignment())
+		if allowed, _ := limiter.AllowAt(ctx, "user1", start); !allowed {
+			t.Fatal("Expected the first request to be allowed")
+		}
+		if allowed, _ := limiter.AllowAt(ctx, "user1", start.Add(19*time.Second)); allowed {
+			t.Error("Expected a request before the minute boundary to be denied")
+		}
+		// The next window starts at the minute boundary, 20s after the first request
+		if allowed, _ := limiter.AllowAt(ctx, "user1", start.Add(20*time.Second)); !allowed {
+			t.Error("Expected a request at the minute boundary to be allowed")
+		}
+	})
+}
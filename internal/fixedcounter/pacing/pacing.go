@@ -0,0 +1,41 @@
+// Package fcpacing spreads a fixed window's budget over the window, preventing the double burst a client can send
+// by spending a whole budget at the end of one window and another at the start of the next.
+package fcpacing
+
+import (
+	"math"
+	"time"
+)
+
+// Pacer releases a fixed window's budget gradually: BurstFraction of the limit is available as soon as the window starts,
+// and the rest is released linearly until the whole limit is available at the end of the window.
+// A nil Pacer releases the whole limit at once.
+type Pacer struct {
+	// BurstFraction is the fraction of the limit available at the start of the window, between 0 and 1.
+	BurstFraction float64
+	// Delay makes requests beyond the released budget wait until enough is released, instead of being denied.
+	Delay bool
+}
+
+// Allowance returns the budget released elapsed into a window of the given size. At least one unit is always released.
+func (p *Pacer) Allowance(limit int64, elapsed, window time.Duration) int64 {
+	if p == nil || p.BurstFraction >= 1 || elapsed >= window {
+		return limit
+	}
+	progress := max(float64(elapsed)/float64(window), 0)
+	// The epsilon absorbs rounding so the allowance at ReleasedAt(needed) is never just below needed
+	released := int64(float64(limit)*(p.BurstFraction+(1-p.BurstFraction)*progress) + 1e-9)
+	return min(max(released, 1), limit)
+}
+
+// ReleasedAt returns how far into a window of the given size the released budget reaches needed units (0 if it does from the start).
+func (p *Pacer) ReleasedAt(limit, needed int64, window time.Duration) time.Duration {
+	if p == nil || p.BurstFraction >= 1 || needed <= 1 {
+		return 0
+	}
+	progress := (float64(needed)/float64(limit) - p.BurstFraction) / (1 - p.BurstFraction)
+	if progress <= 0 {
+		return 0
+	}
+	return min(time.Duration(math.Ceil(progress*float64(window))), window)
+}
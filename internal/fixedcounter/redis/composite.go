@@ -0,0 +1,109 @@
+package fcredis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/redisargs"
+	"learn.ratelimiter/internal/redisscripts"
+	"learn.ratelimiter/internal/redisstate"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// Limit is one limit of a CompositeLimiter: at most Limit units per Window, counted under the limiter key Key.
+type Limit struct {
+	Key    string
+	Window time.Duration
+	Limit  int64
+}
+
+// CompositeLimiter enforces several Fixed Window Counter limits (e.g., 10 per second and 1000 per hour) with a single Lua script,
+// so a request consumes budget from every limit or from none, without rolling back limits checked earlier.
+// Each limit's state has the same layout and Redis key as a Limiter with the same key, so both can share it.
+// With Redis Cluster, the limit keys must hash to the same slot (e.g., share a {hash tag}).
+type CompositeLimiter struct {
+	client *redis.Client
+	key    string // Limiter key from config
+	limits []Limit
+	script *redisscripts.Script
+}
+
+// NewCompositeLimiter creates a Redis-based limiter allowing a request only if all limits allow it.
+func NewCompositeLimiter(client *redis.Client, key string, limits []Limit) *CompositeLimiter {
+	log.Info().Str("limiter_type", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", key).Int("limits", len(limits)).Msg("Limiter: Initialized composite")
+	return &CompositeLimiter{
+		client: client,
+		key:    key,
+		limits: limits,
+		script: redisscripts.FixedWindowCompositeAllow,
+	}
+}
+
+// Allow checks if a request for the given identifier is allowed by every limit.
+func (l *CompositeLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	result, err := l.allow(ctx, identifier, 1, time.Now())
+	return result.Allowed, err
+}
+
+// AllowN checks if a request costing n units for the given identifier fits in the remaining budget of every limit.
+func (l *CompositeLimiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return result.Allowed, err
+}
+
+// AllowAt checks if a request for the given identifier is allowed by every limit at time t instead of the wall clock.
+func (l *CompositeLimiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	result, err := l.allow(ctx, identifier, 1, t)
+	return result.Allowed, err
+}
+
+// AllowDetailed checks a request costing n units for the given identifier as AllowN does. A denied request's result
+// names the limit that denied it in Policy, with that limit's budget; the budget left in each limit is not computed,
+// so Remaining is negative, and so is Limit for an allowed request.
+func (l *CompositeLimiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	return l.allow(ctx, identifier, n, time.Now())
+}
+
+// allow evaluates a request costing n units at time now against all limits in one script call.
+func (l *CompositeLimiter) allow(ctx context.Context, identifier string, n int, now time.Time) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
+	args := redisargs.Get().Add(now.UnixMilli(), n, redisstate.SchemaVersion)
+	defer args.Release()
+	for _, limit := range l.limits {
+		args.Keys = append(args.Keys, limit.Key+":"+identifier)
+		args.Add(limit.Window.Milliseconds(), limit.Limit, max(int64(limit.Window.Seconds()), 1))
+	}
+
+	result, err := l.script.Run(ctx, l.client, args.Keys, args.Values...).Result()
+	if err != nil {
+		log.Error().Err(err).Str("limiter_type", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Redis composite script execution failed")
+		return types.Result{}, fmt.Errorf("redis script execution failed for limiter '%s', identifier '%s': %w", l.key, redact.Identifier(identifier), err)
+	}
+
+	values, err := redisstate.Ints(result, 3)
+	if err != nil {
+		err = fmt.Errorf("%w for key '%s', identifier '%s'", err, l.key, redact.Identifier(identifier))
+		log.Error().Err(err).Str("limiter_type", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Type("result_type", result).Msg("Limiter: Unexpected script result type")
+		return types.Result{}, err
+	}
+	if err := redisstate.Check(l.key, config.FixedWindowCounter, values[1]); err != nil {
+		return types.Result{}, err
+	}
+
+	decision := types.Result{Allowed: values[0] == 1, Limit: -1, Remaining: -1}
+	if !decision.Allowed {
+		if i := values[2]; i >= 1 && int(i) <= len(l.limits) {
+			decision.Policy, decision.Limit = l.limits[i-1].Key, l.limits[i-1].Limit
+			log.Debug().Str("limiter_type", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("denied_by", decision.Policy).Msg("Limiter: Request denied by composite limit")
+		}
+	}
+	return decision, nil
+}
@@ -4,10 +4,21 @@ package fcredis
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/backendkey"
+	fcpacing "learn.ratelimiter/internal/fixedcounter/pacing"
+	"learn.ratelimiter/internal/redisargs"
+	"learn.ratelimiter/internal/redisscripts"
+	"learn.ratelimiter/internal/redisstate"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
 )
 
 // Limiter implements the Fixed Window Counter algorithm using Redis.
@@ -17,29 +28,139 @@ type Limiter struct {
 	key    string // Limiter key from config
 	window time.Duration
 	limit  int64
-	script *redis.Script
+	script *redisscripts.Script
+	// keys composes the Redis key of each identifier.
+	keys *backendkey.Builder
+
+	// cacheDenials enables the local denial cache.
+	cacheDenials bool
+	// denied maps an identifier to the end of the window (in milliseconds) in which it was denied.
+	denied sync.Map
+	// nextSweepMillis is the earliest time at which expired denial cache entries are swept.
+	nextSweepMillis int64
+	sweepMu         sync.Mutex
+
+	// pacer, if set, spreads the budget over the window.
+	pacer *fcpacing.Pacer
+	// firstRequest starts each identifier's window at its first request instead of at multiples of the window size,
+	// like the in-memory limiter.
+	firstRequest bool
+}
+
+// Option configures optional behaviour of a Limiter.
+type Option func(*Limiter)
+
+// WithPacer spreads the window's budget over the window as described by the pacer.
+func WithPacer(pacer *fcpacing.Pacer) Option {
+	return func(l *Limiter) {
+		l.pacer = pacer
+	}
+}
+
+// WithKeyCache caches the Redis keys of up to size frequent identifiers instead of composing them on every check.
+func WithKeyCache(size int) Option {
+	return func(l *Limiter) {
+		l.keys = backendkey.NewBuilder(size, l.key)
+	}
+}
+
+// WithFirstRequestAlignment starts each identifier's window at its first request after the previous window ended,
+// as the in-memory limiter does, instead of at multiples of the window size since the Unix epoch.
+func WithFirstRequestAlignment() Option {
+	return func(l *Limiter) {
+		l.firstRequest = true
+	}
 }
 
 // NewLimiter creates a new Redis-based Fixed Window Counter limiter.
-// It takes a Redis client instance, a unique key for the limiter, the size of the window, and the maximum limit of requests within the window.
-func NewLimiter(client *redis.Client, key string, window time.Duration, limit int64) *Limiter {
-	log.Info().Str("limiter_type", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", key).Dur("window", window).Int64("limit", limit).Msg("Limiter: Initialized")
-	return &Limiter{
-		client: client,
-		key:    key, // Store the key
-		window: window,
-		limit:  limit,
-		script: redisAllowScript,
+// It takes a Redis client instance, a unique key for the limiter, the size of the window, the maximum limit of requests within the window,
+// whether over-limit identifiers should be cached locally until their window ends, and optional behaviour.
+func NewLimiter(client *redis.Client, key string, window time.Duration, limit int64, cacheDenials bool, opts ...Option) *Limiter {
+	l := &Limiter{
+		client:       client,
+		key:          key, // Store the key
+		window:       window,
+		limit:        limit,
+		script:       redisscripts.FixedWindowAllow,
+		keys:         backendkey.NewBuilder(0, key),
+		cacheDenials: cacheDenials,
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	log.Info().Str("limiter_type", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", key).Dur("window", window).Int64("limit", limit).Bool("cache_denials", cacheDenials).Bool("paced", l.pacer != nil).Bool("first_request", l.firstRequest).Msg("Limiter: Initialized")
+	return l
 }
 
 // Allow checks if a request for the given identifier is allowed using a Redis Lua script.
 // It takes a context and an identifier and returns true if the request is allowed, false otherwise, and an error if any occurred.
 func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
-	redisKey := l.key + ":" + identifier
+	return l.AllowN(ctx, identifier, 1)
+}
 
-	nowMillis := time.Now().UnixMilli()
+// AllowN checks if a request costing n units for the given identifier fits in the remaining budget of the current window.
+// With a delaying pacer, a request beyond the budget released so far waits until enough is released or the context is done.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	result, err := l.AllowDetailed(ctx, identifier, n)
+	return result.Allowed, err
+}
+
+// AllowDetailed checks a request costing n units for the given identifier as AllowN does, with the budget left in the
+// current window, its end and, for a denied request, when the budget covering it is released, all from the script.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	result, delay, err := l.allow(ctx, identifier, n, time.Now(), true)
+	if err != nil || !result.Allowed || delay <= 0 {
+		return result, err
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// The reserved budget is not returned, as the window may have rolled over meanwhile
+		return types.Result{}, ctx.Err()
+	case <-timer.C:
+		return result, nil
+	}
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+// The script treats times earlier than the latest time seen for the identifier as that latest time.
+// Requests beyond the budget released by a pacer are denied rather than delayed, since t is not the wall clock.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	result, _, err := l.allow(ctx, identifier, 1, t, false)
+	return result.Allowed, err
+}
+
+// Reserve approximates a reservation: the request is checked once, and, with a delaying pacer, admitted ahead of the
+// release of its budget, which it must wait for before proceeding. A denied request carries the time until the pacer
+// releases enough budget or the next window starts. maxWait is not used, since the script decides whether to reserve.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	result, delay, err := l.allow(ctx, identifier, n, time.Now(), true)
+	if !result.Allowed {
+		delay = result.RetryAfter
+	}
+	return types.Reservation{OK: result.Allowed, Delay: delay}, err
+}
+
+// allow evaluates a request costing n units at time now. If the request is admitted but must first wait for a delaying pacer
+// to release enough budget (only if canDelay), the budget is reserved and the wait is returned. If it is denied, the result
+// carries the time until it could be admitted, or 0 if it is unknown or it never can be.
+func (l *Limiter) allow(ctx context.Context, identifier string, n int, now time.Time, canDelay bool) (types.Result, time.Duration, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, 0, err
+	}
+	redisKey := l.keys.Key(identifier)
+
+	nowMillis := now.UnixMilli()
 	windowMillis := l.window.Milliseconds()
+
+	if l.cacheDenials {
+		if windowEndMillis, ok := l.cachedDenial(identifier, nowMillis); ok {
+			// Denials are cached only once the window's budget is spent
+			log.Debug().Str("limiter_type", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Request denied from local denial cache")
+			return l.denial(l.limit, windowEndMillis, nowMillis), 0, nil
+		}
+	}
 	expirySeconds := int64(l.window.Seconds()) // Use window duration for expiry
 
 	// Ensure expiry is at least 1 second if window is very short
@@ -47,22 +168,173 @@ func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
 		expirySeconds = 1
 	}
 
-	result, err := l.script.Run(ctx, l.client, []string{redisKey}, nowMillis, windowMillis, l.limit, expirySeconds).Result()
+	burstFraction, delay := 1.0, false
+	if l.pacer != nil {
+		burstFraction, delay = l.pacer.BurstFraction, l.pacer.Delay && canDelay
+	}
+	delayArg, firstRequestArg := 0, 0
+	if delay {
+		delayArg = 1
+	}
+	if l.firstRequest {
+		firstRequestArg = 1
+	}
+
+	args := redisargs.Get(redisKey).Add(nowMillis, windowMillis, l.limit, expirySeconds, n, redisstate.SchemaVersion, burstFraction, delayArg, firstRequestArg)
+	defer args.Release()
+	result, err := l.script.Run(ctx, l.client, args.Keys, args.Values...).Result()
 	if err != nil {
 		// Added limiter key and identifier to error log
-		log.Error().Err(err).Str("limiter_type", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", identifier).Str("redis_key", redisKey).Msg("Limiter: Redis script execution failed")
-		return false, fmt.Errorf("redis script execution failed for limiter '%s', identifier '%s': %w", l.key, identifier, err)
+		log.Error().Err(err).Str("limiter_type", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Redis script execution failed")
+		return types.Result{}, 0, fmt.Errorf("redis script execution failed for limiter '%s', identifier '%s': %w", l.key, redact.Identifier(identifier), err)
 	}
 
-	allowed, ok := result.(int64)
-	if !ok {
-		err := fmt.Errorf("unexpected script result type: %T for key '%s', identifier '%s'", result, l.key, identifier)
+	values, err := redisstate.Ints(result, 5)
+	if err != nil {
+		err = fmt.Errorf("%w for key '%s', identifier '%s'", err, l.key, redact.Identifier(identifier))
 		// Added limiter key and identifier to error log
-		log.Error().Err(err).Str("limiter_type", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", identifier).Str("redis_key", redisKey).Type("result_type", result).Msg("Limiter: Unexpected script result type")
-		return false, err
+		log.Error().Err(err).Str("limiter_type", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Type("result_type", result).Msg("Limiter: Unexpected script result type")
+		return types.Result{}, 0, err
+	}
+	if err := redisstate.Check(l.key, config.FixedWindowCounter, values[1]); err != nil {
+		return types.Result{}, 0, err
 	}
 
-	isAllowed := allowed == 1
+	// The script returns the start of the window the request was counted in, so its end is known exactly
+	windowEndMillis := values[3] + windowMillis
+	waitMillis, count := values[2], values[4]
+	if values[0] == 1 {
+		return types.Result{
+			Allowed:   true,
+			Limit:     l.limit,
+			Remaining: max(l.limit-count, 0),
+			ResetAt:   time.UnixMilli(windowEndMillis),
+		}, time.Duration(waitMillis) * time.Millisecond, nil
+	}
+
+	// Only a denied single-unit request proves the window's budget is exhausted; a larger request may fail while budget remains,
+	// and a request denied by the pacer (with a wait) can succeed later in the window.
+	if l.cacheDenials && n == 1 && waitMillis == 0 {
+		l.denied.Store(identifier, windowEndMillis)
+		l.sweepDenials(nowMillis)
+	}
+	if waitMillis == 0 && int64(n) > l.limit {
+		// The request never fits in a window
+		return types.Result{Limit: l.limit, Remaining: max(l.limit-count, 0), ResetAt: time.UnixMilli(windowEndMillis)}, 0, nil
+	}
+	denied := l.denial(count, windowEndMillis, nowMillis)
+	if waitMillis > 0 {
+		denied.RetryAfter = time.Duration(waitMillis) * time.Millisecond
+	}
+	return denied, 0, nil
+}
+
+// denial returns the result of a request denied with count units spent in the window ending at windowEndMillis, to be
+// retried once the next window starts.
+func (l *Limiter) denial(count, windowEndMillis, nowMillis int64) types.Result {
+	retryMillis := windowEndMillis - nowMillis
+	if l.firstRequest {
+		// Windows starting at the first request include their end
+		retryMillis++
+	}
+	return types.Result{
+		Limit:      l.limit,
+		Remaining:  max(l.limit-count, 0),
+		ResetAt:    time.UnixMilli(windowEndMillis),
+		RetryAfter: time.Duration(retryMillis) * time.Millisecond,
+	}
+}
+
+// Pressure returns the fraction of the limit the identifier has used in the current window.
+// It reads the counter without charging it.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	count, _, err := l.current(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	return min(count/float64(l.limit), 1), nil
+}
+
+// ResetTime returns the end of the identifier's current window, or now if it has used none of the limit.
+// It reads the counter without charging it.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	count, windowEndMillis, err := l.current(ctx, identifier)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if count <= 0 {
+		return time.Now(), nil
+	}
+	return time.UnixMilli(windowEndMillis), nil
+}
+
+// current reads the identifier's count in the current window and the end of the window in milliseconds.
+func (l *Limiter) current(ctx context.Context, identifier string) (float64, int64, error) {
+	redisKey := l.keys.Key(identifier)
+	fields, err := l.client.HGetAll(ctx, redisKey).Result()
+	if err != nil {
+		log.Error().Err(err).Str("limiter_type", "FixedWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Redis pressure read failed")
+		return 0, 0, fmt.Errorf("redis pressure read failed for limiter '%s', identifier '%s': %w", l.key, redact.Identifier(identifier), err)
+	}
+	if err := redisstate.CheckVersion(l.key, config.FixedWindowCounter, fieldValue(fields, redisstate.VersionField)); err != nil {
+		return 0, 0, err
+	}
+	// Evaluate at the latest time seen for the key, as the script does, if the clock is behind it
+	nowMillis := time.Now().UnixMilli()
+	if lastSeen, ok := redisstate.Float(fieldValue(fields, "ts")); ok {
+		nowMillis = max(nowMillis, int64(lastSeen))
+	}
+	windowMillis := l.window.Milliseconds()
+	windowStartMillis := nowMillis / windowMillis * windowMillis
+	if l.firstRequest {
+		start, ok := redisstate.Float(fieldValue(fields, "ws"))
+		if !ok || nowMillis > int64(start)+windowMillis {
+			return 0, 0, nil
+		}
+		windowStartMillis = int64(start)
+	}
+	count, _ := redisstate.Float(fieldValue(fields, strconv.FormatInt(windowStartMillis, 10)))
+	return count, windowStartMillis + windowMillis, nil
+}
+
+// fieldValue returns the value of the hash field as read by HMGET: a string, or nil if the field is absent.
+func fieldValue(fields map[string]string, field string) interface{} {
+	if value, ok := fields[field]; ok {
+		return value
+	}
+	return nil
+}
+
+// cachedDenial reports whether the identifier was denied earlier in the window containing nowMillis, and returns the
+// end of that window. Entries from a previous window are removed, so the cache is invalidated exactly on window rollover.
+func (l *Limiter) cachedDenial(identifier string, nowMillis int64) (int64, bool) {
+	v, ok := l.denied.Load(identifier)
+	if !ok {
+		return 0, false
+	}
+	windowEndMillis := v.(int64)
+	if nowMillis < windowEndMillis {
+		return windowEndMillis, true
+	}
+	l.denied.CompareAndDelete(identifier, windowEndMillis)
+	return 0, false
+}
+
+// sweepDenials removes expired entries from the denial cache at most once per window,
+// so identifiers that stop sending requests do not accumulate.
+func (l *Limiter) sweepDenials(nowMillis int64) {
+	l.sweepMu.Lock()
+	if nowMillis < l.nextSweepMillis {
+		l.sweepMu.Unlock()
+		return
+	}
+	l.nextSweepMillis = nowMillis + l.window.Milliseconds()
+	l.sweepMu.Unlock()
 
-	return isAllowed, nil
+	l.denied.Range(func(k, v any) bool {
+		if nowMillis >= v.(int64) {
+			l.denied.CompareAndDelete(k, v)
+		}
+		return true
+	})
 }
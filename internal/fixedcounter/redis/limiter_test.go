@@ -0,0 +1,78 @@
+// Package fcredis_test contains tests for the Redis fixed window counter.
+package fcredis_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	fcredis "learn.ratelimiter/internal/fixedcounter/redis"
+	"learn.ratelimiter/internal/testenv"
+)
+
+// TestWindowAlignment tests that windows start at multiples of the window size by default and at the first request
+// with first-request alignment, as in the in-memory limiter.
+func TestWindowAlignment(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	defer client.Close()
+	ctx := context.Background()
+	// 40s into a minute
+	start := time.Unix(1_700_000_020, 0)
+	// A unique identifier keeps state left by earlier runs on a shared server from counting
+	identifier := fmt.Sprintf("alignment-%d", time.Now().UnixNano())
+
+	t.Run("wall_clock", func(t *testing.T) {
+		limiter := fcredis.NewLimiter(client, "test_wall_clock", time.Minute, 1, false)
+		if allowed, err := limiter.AllowAt(ctx, identifier, start); err != nil || !allowed {
+			t.Fatalf("Expected the first request to be allowed, got %v, %v", allowed, err)
+		}
+		if allowed, _ := limiter.AllowAt(ctx, identifier, start.Add(19*time.Second)); allowed {
+			t.Error("Expected a request before the minute boundary to be denied")
+		}
+		if allowed, _ := limiter.AllowAt(ctx, identifier, start.Add(20*time.Second)); !allowed {
+			t.Error("Expected a request at the minute boundary to be allowed")
+		}
+	})
+
+	t.Run("first_request", func(t *testing.T) {
+		limiter := fcredis.NewLimiter(client, "test_first_request", time.Minute, 1, true, fcredis.WithFirstRequestAlignment())
+		if allowed, err := limiter.AllowAt(ctx, identifier, start); err != nil || !allowed {
+			t.Fatalf("Expected the first request to be allowed, got %v, %v", allowed, err)
+		}
+		if allowed, _ := limiter.AllowAt(ctx, identifier, start.Add(30*time.Second)); allowed {
+			t.Error("Expected a request within a minute of the first to be denied")
+		}
+		// The denial is cached until the window started by the first request ends
+		if allowed, _ := limiter.AllowAt(ctx, identifier, start.Add(61*time.Second)); !allowed {
+			t.Error("Expected a request after the window to be allowed")
+		}
+	})
+}
+
+// TestCachedDenial tests that requests denied from the local denial cache report the window's budget as spent.
+func TestCachedDenial(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	defer client.Close()
+	ctx := context.Background()
+	identifier := fmt.Sprintf("cached-denial-%d", time.Now().UnixNano())
+	limiter := fcredis.NewLimiter(client, "test_cached_denial", time.Minute, 2, true)
+
+	for i := 0; i < 2; i++ {
+		if result, err := limiter.AllowDetailed(ctx, identifier, 1); err != nil || !result.Allowed {
+			t.Fatalf("Expected request %d to be allowed, got %+v, %v", i, result, err)
+		}
+	}
+	// The first denial is decided by Redis and cached, the second by the cache
+	for i := 0; i < 2; i++ {
+		result, err := limiter.AllowDetailed(ctx, identifier, 1)
+		if err != nil || result.Allowed {
+			t.Fatalf("Expected denial %d, got %+v, %v", i, result, err)
+		}
+		if result.Remaining != 0 || result.Limit != 2 || result.RetryAfter <= 0 {
+			t.Errorf("Denial %d: expected no budget remaining of 2 and a retry time, got %+v", i, result)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Package history provides a limiter decorator keeping the latest decisions per identifier in a ring buffer, for
+// support tooling answering what exactly happened to a client at a given time.
+package history
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/types"
+)
+
+// ring holds the latest decisions of one identifier.
+type ring struct {
+	decisions []types.Decision
+	next      int // Index the next decision is written at
+	full      bool
+}
+
+// add writes the decision over the oldest one once the ring is full.
+func (r *ring) add(decision types.Decision) {
+	r.decisions[r.next] = decision
+	r.next = (r.next + 1) % len(r.decisions)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// latest returns the time of the latest decision.
+func (r *ring) latest() time.Time {
+	return r.decisions[(r.next+len(r.decisions)-1)%len(r.decisions)].Time
+}
+
+// Limiter delegates to a limiter, keeping its latest decisions per identifier in memory.
+type Limiter struct {
+	key            string // Limiter key from config
+	limiter        types.Limiter
+	size           int
+	retention      time.Duration
+	maxIdentifiers int
+
+	mu          sync.Mutex
+	identifiers map[string]*ring
+	pruned      time.Time // Time of the latest prune, so a full map is scanned at most once per minute
+}
+
+// pruneInterval is the least time between two scans of a full map for idle identifiers.
+const pruneInterval = time.Minute
+
+// NewLimiter creates a decorator around limiter keeping its decisions as cfg describes.
+func NewLimiter(key string, limiter types.Limiter, cfg config.HistoryConfig) *Limiter {
+	size := cfg.Size
+	if size <= 0 {
+		size = config.DefaultHistorySize
+	}
+	retention := cfg.Retention
+	if retention <= 0 {
+		retention = config.DefaultHistoryRetention
+	}
+	maxIdentifiers := cfg.MaxIdentifiers
+	if maxIdentifiers <= 0 {
+		maxIdentifiers = config.DefaultHistoryMaxIdentifiers
+	}
+	return &Limiter{
+		key:            key,
+		limiter:        limiter,
+		size:           size,
+		retention:      retention,
+		maxIdentifiers: maxIdentifiers,
+		identifiers:    make(map[string]*ring),
+	}
+}
+
+// Allow checks if a request for the identifier is allowed, keeping the decision.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	allowed, err := l.limiter.Allow(ctx, identifier)
+	l.record(ctx, identifier, 1, allowed, err, time.Now())
+	return allowed, err
+}
+
+// AllowN checks if a request costing n units for the identifier is allowed, keeping the decision.
+// Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	if costLimiter, ok := l.limiter.(types.CostLimiter); ok {
+		allowed, err := costLimiter.AllowN(ctx, identifier, n)
+		l.record(ctx, identifier, n, allowed, err, time.Now())
+		return allowed, err
+	}
+	allowed, err := l.limiter.Allow(ctx, identifier)
+	l.record(ctx, identifier, 1, allowed, err, time.Now())
+	return allowed, err
+}
+
+// AllowAt checks if a request for the identifier is allowed at time t, keeping the decision at time t.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	timeLimiter, ok := l.limiter.(types.TimeLimiter)
+	if !ok {
+		return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+	}
+	allowed, err := timeLimiter.AllowAt(ctx, identifier, t)
+	l.record(ctx, identifier, 1, allowed, err, t)
+	return allowed, err
+}
+
+// AllowKey checks if a request for the composite key is allowed, keeping the decision under the key's canonical encoding.
+func (l *Limiter) AllowKey(ctx context.Context, key types.Key) (bool, error) {
+	allowed, err := types.AllowKey(ctx, l.limiter, key)
+	l.record(ctx, key.String(), 1, allowed, err, time.Now())
+	return allowed, err
+}
+
+// KeyCount returns the key count of the wrapped limiter, and false if it cannot tell.
+func (l *Limiter) KeyCount() (int, bool) {
+	if keyCounter, ok := l.limiter.(types.KeyCounter); ok {
+		return keyCounter.KeyCount()
+	}
+	return 0, false
+}
+
+// Forget drops the identifier's state in the wrapped limiter. Its history is kept, since it describes past decisions.
+func (l *Limiter) Forget(identifier string) {
+	types.Forget(l.limiter, identifier)
+}
+
+// Pressure returns the fraction of the identifier's budget in use in the wrapped limiter.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	return types.Pressure(ctx, l.limiter, identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget is fully restored in the wrapped limiter.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	return types.ResetTime(ctx, l.limiter, identifier)
+}
+
+// Reserve reserves a request costing n units for the identifier, keeping the decision. Limiters that do not support
+// AllowN are charged a single unit.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	reservation, err := types.Reserve(ctx, l.limiter, identifier, n, maxWait)
+	cost := n
+	if _, ok := l.limiter.(types.CostLimiter); !ok {
+		cost = 1
+	}
+	l.record(ctx, identifier, cost, reservation.OK, err, time.Now())
+	return reservation, err
+}
+
+// AllowDetailed checks a request costing n units for the identifier with its result, keeping the decision. Limiters
+// that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	result, err := types.AllowDetailed(ctx, l.limiter, identifier, n)
+	cost := n
+	if _, ok := l.limiter.(types.CostLimiter); !ok {
+		cost = 1
+	}
+	l.record(ctx, identifier, cost, result.Allowed, err, time.Now())
+	return result, err
+}
+
+// Stats returns the requests allowed and denied for the identifier in the wrapped limiter.
+func (l *Limiter) Stats(ctx context.Context, identifier string) (types.IdentifierStats, error) {
+	return types.Stats(ctx, l.limiter, identifier)
+}
+
+// History returns the latest decisions for the identifier within the retention, oldest first.
+func (l *Limiter) History(ctx context.Context, identifier string) ([]types.Decision, error) {
+	return l.HistoryAt(identifier, time.Now()), nil
+}
+
+// HistoryAt returns the latest decisions for the identifier within the retention ending at time now, oldest first.
+func (l *Limiter) HistoryAt(identifier string, now time.Time) []types.Decision {
+	decisions := []types.Decision{}
+	oldest := now.Add(-l.retention)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.identifiers[identifier]
+	if !ok {
+		return decisions
+	}
+	start, n := 0, r.next
+	if r.full {
+		start, n = r.next, len(r.decisions)
+	}
+	for i := 0; i < n; i++ {
+		if decision := r.decisions[(start+i)%len(r.decisions)]; decision.Time.After(oldest) {
+			decisions = append(decisions, decision)
+		}
+	}
+	return decisions
+}
+
+// record keeps the decision for the identifier at time t, with the budget remaining read from the wrapped limiter.
+func (l *Limiter) record(ctx context.Context, identifier string, cost int, allowed bool, err error, t time.Time) {
+	decision := types.Decision{Time: t, Allowed: allowed, Cost: cost, Remaining: -1}
+	if err != nil {
+		decision.Allowed = false
+		decision.Err = err.Error()
+	} else if pressure, pressureErr := types.Pressure(ctx, l.limiter, identifier); pressureErr == nil {
+		decision.Remaining = max(1-pressure, 0)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.identifiers[identifier]
+	if !ok {
+		if len(l.identifiers) >= l.maxIdentifiers && t.Sub(l.pruned) >= pruneInterval {
+			l.prune(t)
+		}
+		if len(l.identifiers) >= l.maxIdentifiers {
+			return
+		}
+		r = &ring{decisions: make([]types.Decision, l.size)}
+		l.identifiers[identifier] = r
+	}
+	r.add(decision)
+}
+
+// prune forgets the identifiers without decisions within the retention ending at time now.
+func (l *Limiter) prune(now time.Time) {
+	l.pruned = now
+	oldest := now.Add(-l.retention)
+	for identifier, r := range l.identifiers {
+		if !r.latest().After(oldest) {
+			delete(l.identifiers, identifier)
+		}
+	}
+}
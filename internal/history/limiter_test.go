@@ -0,0 +1,103 @@
+// Package history_test contains tests for the per-identifier decision history.
+package history_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/config"
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/internal/history"
+	"learn.ratelimiter/types"
+)
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// failingLimiter fails every check.
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return false, errors.New("backend unavailable")
+}
+
+// TestHistory tests that each decision is kept with the budget remaining after it.
+func TestHistory(t *testing.T) {
+	limiter := history.NewLimiter("test_history", fcinmemory.NewLimiter("test_history", time.Hour, 2), config.HistoryConfig{})
+	for i := 0; i < 3; i++ {
+		limiter.Allow(context.Background(), "user1")
+	}
+
+	decisions, err := types.History(context.Background(), limiter, "user1")
+	if err != nil {
+		t.Fatalf("History returned error: %v", err)
+	}
+	if len(decisions) != 3 {
+		t.Fatalf("Expected 3 decisions, got %+v", decisions)
+	}
+	for i, want := range []struct {
+		allowed   bool
+		remaining float64
+	}{{true, 0.5}, {true, 0}, {false, 0}} {
+		if d := decisions[i]; d.Allowed != want.allowed || d.Remaining != want.remaining || d.Cost != 1 || d.Time.IsZero() {
+			t.Errorf("Decision %d: expected allowed=%v remaining=%v, got %+v", i, want.allowed, want.remaining, d)
+		}
+	}
+	if decisions, _ := limiter.History(context.Background(), "user2"); len(decisions) != 0 {
+		t.Errorf("Expected no decisions for an unknown identifier, got %+v", decisions)
+	}
+}
+
+// TestRing tests that only the latest decisions within the retention are kept, oldest first.
+func TestRing(t *testing.T) {
+	limiter := history.NewLimiter("test_history_ring", fcinmemory.NewLimiter("test_history_ring", time.Hour, 100),
+		config.HistoryConfig{Size: 3, Retention: 10 * time.Minute})
+	for i := 0; i < 5; i++ {
+		limiter.AllowAt(context.Background(), "user1", start.Add(time.Duration(i)*time.Minute))
+	}
+
+	decisions := limiter.HistoryAt("user1", start.Add(5*time.Minute))
+	if len(decisions) != 3 {
+		t.Fatalf("Expected the 3 latest decisions, got %+v", decisions)
+	}
+	for i, d := range decisions {
+		if want := start.Add(time.Duration(i+2) * time.Minute); !d.Time.Equal(want) {
+			t.Errorf("Decision %d: expected time %v, got %v", i, want, d.Time)
+		}
+	}
+
+	// Decisions leave the history once the retention has passed
+	if decisions := limiter.HistoryAt("user1", start.Add(13*time.Minute)); len(decisions) != 1 {
+		t.Errorf("Expected the decision within the retention only, got %+v", decisions)
+	}
+}
+
+// TestMaxIdentifiers tests that identifiers over the cap get no history until others have been idle for the retention.
+func TestMaxIdentifiers(t *testing.T) {
+	limiter := history.NewLimiter("test_history_max", fcinmemory.NewLimiter("test_history_max", time.Hour, 100),
+		config.HistoryConfig{Retention: 10 * time.Minute, MaxIdentifiers: 1})
+	limiter.AllowAt(context.Background(), "user1", start)
+	limiter.AllowAt(context.Background(), "user2", start)
+	if decisions := limiter.HistoryAt("user2", start); len(decisions) != 0 {
+		t.Errorf("Expected no history for user2 while the cap is reached, got %+v", decisions)
+	}
+
+	later := start.Add(10 * time.Minute)
+	limiter.AllowAt(context.Background(), "user2", later)
+	if decisions := limiter.HistoryAt("user2", later); len(decisions) != 1 {
+		t.Errorf("Expected a history for user2 once user1 was idle for the retention, got %+v", decisions)
+	}
+}
+
+// TestErrors tests that failed checks are kept as denials with their error.
+func TestErrors(t *testing.T) {
+	limiter := history.NewLimiter("test_history_errors", failingLimiter{}, config.HistoryConfig{})
+	if _, err := limiter.AllowN(context.Background(), "user1", 3); err == nil {
+		t.Fatal("Expected the limiter error")
+	}
+	decisions, _ := limiter.History(context.Background(), "user1")
+	if len(decisions) != 1 || decisions[0].Allowed || decisions[0].Err != "backend unavailable" || decisions[0].Remaining >= 0 || decisions[0].Cost != 1 {
+		t.Errorf("Expected the failed check with an unknown budget, got %+v", decisions)
+	}
+}
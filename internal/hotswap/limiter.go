@@ -0,0 +1,155 @@
+// Package hotswap provides a limiter whose implementation can be replaced at runtime (e.g., on configuration reload)
+// while callers keep holding the same limiter under the same key.
+package hotswap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/types"
+)
+
+// current is the limiter currently serving requests, the algorithm it implements and what releases it once retired.
+type current struct {
+	limiter   types.Limiter
+	algorithm config.AlgorithmType
+	closer    io.Closer
+}
+
+// Limiter delegates to a replaceable limiter. Middleware, waiters and metrics bound to it keep working across swaps.
+type Limiter struct {
+	key     string // Limiter key from config
+	current atomic.Pointer[current]
+	// mu serializes swaps.
+	mu sync.Mutex
+}
+
+// NewLimiter creates a swappable limiter initially delegating to limiter, which implements the given algorithm.
+// closer, if not nil, releases what limiter holds once a swap retires it.
+func NewLimiter(key string, algorithm config.AlgorithmType, limiter types.Limiter, closer io.Closer) *Limiter {
+	l := &Limiter{key: key}
+	l.current.Store(&current{limiter: limiter, algorithm: algorithm, closer: closer})
+	return l
+}
+
+// Allow checks if a request for the given identifier is allowed by the current limiter.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.current.Load().limiter.Allow(ctx, identifier)
+}
+
+// AllowN checks if a request costing n units for the given identifier is allowed by the current limiter.
+// Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	limiter := l.current.Load().limiter
+	if costLimiter, ok := limiter.(types.CostLimiter); ok {
+		return costLimiter.AllowN(ctx, identifier, n)
+	}
+	return limiter.Allow(ctx, identifier)
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t by the current limiter.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	if timeLimiter, ok := l.current.Load().limiter.(types.TimeLimiter); ok {
+		return timeLimiter.AllowAt(ctx, identifier, t)
+	}
+	return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+}
+
+// AllowKey checks if a request for the composite key is allowed by the current limiter.
+func (l *Limiter) AllowKey(ctx context.Context, key types.Key) (bool, error) {
+	return types.AllowKey(ctx, l.current.Load().limiter, key)
+}
+
+// Algorithm returns the algorithm of the current limiter.
+func (l *Limiter) Algorithm() config.AlgorithmType {
+	return l.current.Load().algorithm
+}
+
+// KeyCount returns the number of identifiers the current limiter holds state for, and false if it cannot tell.
+func (l *Limiter) KeyCount() (int, bool) {
+	if keyCounter, ok := l.current.Load().limiter.(types.KeyCounter); ok {
+		return keyCounter.KeyCount()
+	}
+	return 0, false
+}
+
+// Forget drops the identifier's state in the current limiter.
+func (l *Limiter) Forget(identifier string) {
+	types.Forget(l.current.Load().limiter, identifier)
+}
+
+// Pressure returns the fraction of the identifier's budget in use in the current limiter.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	return types.Pressure(ctx, l.current.Load().limiter, identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget is fully restored in the current limiter.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	return types.ResetTime(ctx, l.current.Load().limiter, identifier)
+}
+
+// Reserve reserves a request costing n units in the current limiter.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	return types.Reserve(ctx, l.current.Load().limiter, identifier, n, maxWait)
+}
+
+// AllowDetailed checks a request costing n units in the current limiter, with its result.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	return types.AllowDetailed(ctx, l.current.Load().limiter, identifier, n)
+}
+
+// Stats returns the requests allowed and denied for the identifier by the current limiter.
+// Counts restart when a reload replaces the limiter.
+func (l *Limiter) Stats(ctx context.Context, identifier string) (types.IdentifierStats, error) {
+	return types.Stats(ctx, l.current.Load().limiter, identifier)
+}
+
+// History returns the latest decisions for the identifier by the current limiter.
+// The history restarts when a reload replaces the limiter.
+func (l *Limiter) History(ctx context.Context, identifier string) ([]types.Decision, error) {
+	return types.History(ctx, l.current.Load().limiter, identifier)
+}
+
+// Swap replaces the current limiter with next, which implements the given algorithm, and closes the closer of the
+// current limiter. closer, if not nil, releases what next holds once it is retired in turn.
+// With StateTransitionConvert, each identifier's used fraction of the budget is copied from the current limiter to next
+// when both implement types.UsageLimiter; otherwise next starts with its own state, which for remote backends (e.g., Redis)
+// is whatever the new algorithm finds under the key. Swap returns the number of identifiers whose state was converted.
+//
+// Requests already evaluated by the previous limiter are not replayed, so requests racing with the swap may be counted by either limiter.
+func (l *Limiter) Swap(next types.Limiter, closer io.Closer, algorithm config.AlgorithmType, transition config.StateTransition) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	previous := l.current.Load()
+
+	converted := 0
+	if transition == config.StateTransitionConvert {
+		from, fromOK := previous.limiter.(types.UsageLimiter)
+		to, toOK := next.(types.UsageLimiter)
+		if fromOK && toOK {
+			now := time.Now()
+			for identifier, used := range from.Usage(now) {
+				to.SetUsage(identifier, used, now)
+				converted++
+			}
+		} else {
+			log.Warn().Str("limiter_key", l.key).Str("previous_algorithm", string(previous.algorithm)).Str("algorithm", string(algorithm)).Msg("Limiter: State conversion not supported by these limiters, starting fresh")
+		}
+	}
+
+	l.current.Store(&current{limiter: next, algorithm: algorithm, closer: closer})
+	if previous.closer != nil {
+		if err := previous.closer.Close(); err != nil {
+			log.Warn().Err(err).Str("limiter_key", l.key).Msg("Limiter: Failed to release swapped out limiter")
+		}
+	}
+	log.Info().Str("limiter_key", l.key).Str("previous_algorithm", string(previous.algorithm)).Str("algorithm", string(algorithm)).Str("state_transition", string(transition)).Int("converted_identifiers", converted).Msg("Limiter: Swapped limiter implementation")
+	return converted
+}
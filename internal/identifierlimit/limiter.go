@@ -0,0 +1,197 @@
+// Package identifierlimit provides a limiter decorator bounding the length of identifiers before they reach the backend,
+// so huge identifiers (e.g., oversized header values) cannot become huge Redis keys or bloat in-memory state.
+package identifierlimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// hashLength is the number of hex digits of the hash ending a truncated identifier.
+const hashLength = 16
+
+// hashSeparator separates the truncated identifier from its hash.
+const hashSeparator = "~"
+
+// Limiter delegates to a limiter with identifiers of at most the configured length.
+// Longer identifiers are truncated and end with a hash of the whole identifier (hash policy),
+// or rejected with types.ErrIdentifierTooLong (reject policy).
+type Limiter struct {
+	key       string // Limiter key from config
+	limiter   types.Limiter
+	maxLength int
+	policy    config.IdentifierPolicy
+}
+
+// NewLimiter creates a decorator around limiter applying cfg to identifiers.
+func NewLimiter(key string, limiter types.Limiter, cfg config.IdentifierLimitConfig) *Limiter {
+	policy := cfg.Policy
+	if policy == "" {
+		policy = config.IdentifierPolicyHash
+	}
+	return &Limiter{
+		key:       key,
+		limiter:   limiter,
+		maxLength: cfg.MaxLength,
+		policy:    policy,
+	}
+}
+
+// Allow checks if a request for the identifier, bounded in length, is allowed.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	identifier, err := l.identifier(identifier)
+	if err != nil {
+		return false, err
+	}
+	return l.limiter.Allow(ctx, identifier)
+}
+
+// AllowN checks if a request costing n units for the identifier, bounded in length, is allowed.
+// Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	identifier, err := l.identifier(identifier)
+	if err != nil {
+		return false, err
+	}
+	if costLimiter, ok := l.limiter.(types.CostLimiter); ok {
+		return costLimiter.AllowN(ctx, identifier, n)
+	}
+	return l.limiter.Allow(ctx, identifier)
+}
+
+// AllowAt checks if a request for the identifier, bounded in length, is allowed at time t.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	timeLimiter, ok := l.limiter.(types.TimeLimiter)
+	if !ok {
+		return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+	}
+	identifier, err := l.identifier(identifier)
+	if err != nil {
+		return false, err
+	}
+	return timeLimiter.AllowAt(ctx, identifier, t)
+}
+
+// AllowKey checks if a request for the composite key is allowed. A key whose canonical encoding is too long
+// is checked as an identifier bounded in length instead.
+func (l *Limiter) AllowKey(ctx context.Context, key types.Key) (bool, error) {
+	encoded := key.String()
+	if len(encoded) <= l.maxLength {
+		return types.AllowKey(ctx, l.limiter, key)
+	}
+	return l.Allow(ctx, encoded)
+}
+
+// KeyCount returns the key count of the wrapped limiter, and false if it cannot tell.
+func (l *Limiter) KeyCount() (int, bool) {
+	if keyCounter, ok := l.limiter.(types.KeyCounter); ok {
+		return keyCounter.KeyCount()
+	}
+	return 0, false
+}
+
+// Forget drops the state of the identifier, bounded in length, in the wrapped limiter. Identifiers rejected for their
+// length have none.
+func (l *Limiter) Forget(identifier string) {
+	if len(identifier) > l.maxLength {
+		if l.policy == config.IdentifierPolicyReject {
+			return
+		}
+		identifier = Truncate(identifier, l.maxLength)
+	}
+	types.Forget(l.limiter, identifier)
+}
+
+// Pressure returns the fraction of the budget in use for the identifier, bounded in length.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	identifier, err := l.identifier(identifier)
+	if err != nil {
+		return 0, err
+	}
+	return types.Pressure(ctx, l.limiter, identifier)
+}
+
+// ResetTime returns the time at which the budget of the identifier, bounded in length, is fully restored.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	identifier, err := l.identifier(identifier)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return types.ResetTime(ctx, l.limiter, identifier)
+}
+
+// Reserve reserves a request costing n units for the identifier, bounded in length.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	identifier, err := l.identifier(identifier)
+	if err != nil {
+		return types.Reservation{}, err
+	}
+	return types.Reserve(ctx, l.limiter, identifier, n, maxWait)
+}
+
+// AllowDetailed checks a request costing n units for the identifier, bounded in length, with its result.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	identifier, err := l.identifier(identifier)
+	if err != nil {
+		return types.Result{}, err
+	}
+	return types.AllowDetailed(ctx, l.limiter, identifier, n)
+}
+
+// Stats returns the requests allowed and denied for the identifier, bounded in length.
+func (l *Limiter) Stats(ctx context.Context, identifier string) (types.IdentifierStats, error) {
+	identifier, err := l.identifier(identifier)
+	if err != nil {
+		return types.IdentifierStats{}, err
+	}
+	return types.Stats(ctx, l.limiter, identifier)
+}
+
+// History returns the latest decisions for the identifier, bounded in length.
+func (l *Limiter) History(ctx context.Context, identifier string) ([]types.Decision, error) {
+	identifier, err := l.identifier(identifier)
+	if err != nil {
+		return nil, err
+	}
+	return types.History(ctx, l.limiter, identifier)
+}
+
+// identifier returns the identifier to pass to the wrapped limiter, applying the policy if it is too long.
+func (l *Limiter) identifier(identifier string) (string, error) {
+	if len(identifier) <= l.maxLength {
+		return identifier, nil
+	}
+	metrics.RecordOversizedIdentifier(l.key, string(l.policy))
+	if l.policy == config.IdentifierPolicyReject {
+		log.Warn().Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Int("length", len(identifier)).Int("max_length", l.maxLength).Msg("Limiter: Identifier too long, rejecting request")
+		return "", fmt.Errorf("%w: %d bytes for limiter '%s', at most %d allowed", types.ErrIdentifierTooLong, len(identifier), l.key, l.maxLength)
+	}
+	return Truncate(identifier, l.maxLength), nil
+}
+
+// Truncate returns identifier unchanged if it has at most maxLength bytes. Otherwise it returns its beginning
+// followed by a hash of the whole identifier, at most maxLength bytes in total, so distinct identifiers stay distinct.
+// maxLength must be at least config.MinHashedIdentifierLength.
+func Truncate(identifier string, maxLength int) string {
+	if len(identifier) <= maxLength {
+		return identifier
+	}
+	sum := sha256.Sum256([]byte(identifier))
+	cut := maxLength - len(hashSeparator) - hashLength
+	// Cut at the start of a character, so the truncated identifier stays valid UTF-8
+	for cut > 0 && !utf8.RuneStart(identifier[cut]) {
+		cut--
+	}
+	return identifier[:cut] + hashSeparator + hex.EncodeToString(sum[:hashLength/2])
+}
@@ -0,0 +1,82 @@
+// Package identifierlimit_test contains tests for the identifier length limit.
+package identifierlimit_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/identifierlimit"
+	"learn.ratelimiter/types"
+)
+
+// recordingLimiter allows every request and records the identifiers it was asked about.
+type recordingLimiter struct {
+	identifiers []string
+}
+
+func (r *recordingLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	r.identifiers = append(r.identifiers, identifier)
+	return true, nil
+}
+
+// TestIdentifierLimitHash tests that long identifiers are truncated to distinct identifiers of the maximum length,
+// while short ones pass unchanged.
+func TestIdentifierLimitHash(t *testing.T) {
+	backend := &recordingLimiter{}
+	limiter := identifierlimit.NewLimiter("test_identifier_limit", backend, config.IdentifierLimitConfig{MaxLength: 40})
+
+	long1, long2 := strings.Repeat("a", 1000)+"1", strings.Repeat("a", 1000)+"2"
+	for _, identifier := range []string{"client1", long1, long2, long1} {
+		if allowed, err := limiter.Allow(context.Background(), identifier); !allowed || err != nil {
+			t.Fatalf("Expected request allowed, got (%v, %v)", allowed, err)
+		}
+	}
+
+	if backend.identifiers[0] != "client1" {
+		t.Errorf("Expected short identifier unchanged, got %q", backend.identifiers[0])
+	}
+	for _, identifier := range backend.identifiers[1:] {
+		if len(identifier) > 40 || !strings.HasPrefix(identifier, "aaaa") {
+			t.Errorf("Expected a truncated identifier of at most 40 bytes, got %q", identifier)
+		}
+	}
+	if backend.identifiers[1] == backend.identifiers[2] {
+		t.Errorf("Expected distinct long identifiers to stay distinct, both became %q", backend.identifiers[1])
+	}
+	if backend.identifiers[1] != backend.identifiers[3] {
+		t.Errorf("Expected the same long identifier to be truncated the same way, got %q and %q", backend.identifiers[1], backend.identifiers[3])
+	}
+}
+
+// TestIdentifierLimitReject tests that long identifiers are rejected without reaching the wrapped limiter.
+func TestIdentifierLimitReject(t *testing.T) {
+	backend := &recordingLimiter{}
+	limiter := identifierlimit.NewLimiter("test_identifier_limit", backend, config.IdentifierLimitConfig{MaxLength: 8, Policy: config.IdentifierPolicyReject})
+
+	if allowed, err := limiter.Allow(context.Background(), "client123"); allowed || !errors.Is(err, types.ErrIdentifierTooLong) {
+		t.Errorf("Expected ErrIdentifierTooLong for a long identifier, got (%v, %v)", allowed, err)
+	}
+	if allowed, err := limiter.AllowKey(context.Background(), types.KeyOf("tenant", "client123")); allowed || !errors.Is(err, types.ErrIdentifierTooLong) {
+		t.Errorf("Expected ErrIdentifierTooLong for a long composite key, got (%v, %v)", allowed, err)
+	}
+	if allowed, err := limiter.Allow(context.Background(), "client1"); !allowed || err != nil {
+		t.Errorf("Expected a short identifier allowed, got (%v, %v)", allowed, err)
+	}
+	if len(backend.identifiers) != 1 {
+		t.Errorf("Expected only the short identifier to reach the limiter, got %q", backend.identifiers)
+	}
+}
+
+// TestTruncateKeepsUTF8 tests that truncation does not split a multi-byte character.
+func TestTruncateKeepsUTF8(t *testing.T) {
+	for length := config.MinHashedIdentifierLength; length < config.MinHashedIdentifierLength+4; length++ {
+		truncated := identifierlimit.Truncate(strings.Repeat("é", 100), length)
+		if len(truncated) > length || !utf8.ValidString(truncated) {
+			t.Errorf("Expected valid UTF-8 of at most %d bytes, got %q", length, truncated)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Package ketama provides a consistent hash ring of servers compatible with libketama (and the ketama distribution of
+// twemproxy and most Memcache clients), so adding or removing a server only moves the keys of that server.
+package ketama
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// pointsPerServer is the number of points each server has on the ring: 40 MD5 digests of 4 points each.
+const pointsPerServer = 160
+
+// ErrNoServers is returned by PickServer when the ring has no servers.
+var ErrNoServers = errors.New("ketama: no servers configured")
+
+// point is a position of a server on the ring.
+type point struct {
+	hash uint32
+	addr net.Addr
+}
+
+// Ring maps keys to servers by hashing both onto a ring. It is safe for concurrent use.
+type Ring struct {
+	mu     sync.RWMutex
+	points []point // Sorted by hash
+	addrs  []net.Addr
+}
+
+// SetServers resolves the servers (host:port, or a path containing "/" for a Unix socket) and replaces the ring.
+// Points are derived from the servers as given, so a server keeps its keys when its address changes.
+// The ring is left unchanged if any server fails to resolve.
+func (r *Ring) SetServers(servers ...string) error {
+	addrs := make([]net.Addr, len(servers))
+	points := make([]point, 0, len(servers)*pointsPerServer)
+	for i, server := range servers {
+		addr, err := resolve(server)
+		if err != nil {
+			return err
+		}
+		addrs[i] = addr
+		for j := 0; j < pointsPerServer/4; j++ {
+			digest := md5.Sum([]byte(server + "-" + strconv.Itoa(j)))
+			for k := 0; k < 4; k++ {
+				points = append(points, point{hash: binary.LittleEndian.Uint32(digest[k*4:]), addr: addr})
+			}
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.points = points
+	r.addrs = addrs
+	return nil
+}
+
+// PickServer returns the server of the first point at or after the key's position on the ring.
+func (r *Ring) PickServer(key string) (net.Addr, error) {
+	digest := md5.Sum([]byte(key))
+	hash := binary.LittleEndian.Uint32(digest[:4])
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.points) == 0 {
+		return nil, ErrNoServers
+	}
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].addr, nil
+}
+
+// Each calls f with each server, in the order they were set, stopping at the first error.
+func (r *Ring) Each(f func(net.Addr) error) error {
+	r.mu.RLock()
+	addrs := r.addrs
+	r.mu.RUnlock()
+	for _, addr := range addrs {
+		if err := f(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve resolves a server like gomemcache's ServerList does.
+func resolve(server string) (net.Addr, error) {
+	if strings.Contains(server, "/") {
+		return net.ResolveUnixAddr("unix", server)
+	}
+	return net.ResolveTCPAddr("tcp", server)
+}
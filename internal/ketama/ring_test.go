@@ -0,0 +1,79 @@
+// Package ketama_test contains tests for the consistent hash ring.
+package ketama_test
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+
+	"learn.ratelimiter/internal/ketama"
+)
+
+// pick returns the server picked for each of n keys.
+func pick(t *testing.T, ring *ketama.Ring, n int) []string {
+	t.Helper()
+	servers := make([]string, n)
+	for i := range servers {
+		addr, err := ring.PickServer("key" + strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("PickServer returned error: %v", err)
+		}
+		servers[i] = addr.String()
+	}
+	return servers
+}
+
+// TestRingBalance tests that keys are spread over every server.
+func TestRingBalance(t *testing.T) {
+	var ring ketama.Ring
+	if err := ring.SetServers("127.0.0.1:11211", "127.0.0.2:11211", "127.0.0.3:11211"); err != nil {
+		t.Fatalf("SetServers returned error: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, server := range pick(t, &ring, 30000) {
+		counts[server]++
+	}
+	for server, count := range counts {
+		if count < 7000 || count > 13000 {
+			t.Errorf("Expected about a third of the keys on %s, got %d", server, count)
+		}
+	}
+	if len(counts) != 3 {
+		t.Errorf("Expected keys on 3 servers, got %v", counts)
+	}
+}
+
+// TestRingRemoveServer tests that removing a server only moves the keys it held.
+func TestRingRemoveServer(t *testing.T) {
+	var ring ketama.Ring
+	ring.SetServers("127.0.0.1:11211", "127.0.0.2:11211", "127.0.0.3:11211")
+	before := pick(t, &ring, 10000)
+	ring.SetServers("127.0.0.1:11211", "127.0.0.3:11211")
+	after := pick(t, &ring, 10000)
+	for i := range before {
+		if before[i] != "127.0.0.2:11211" && before[i] != after[i] {
+			t.Fatalf("Expected key %d to stay on %s, moved to %s", i, before[i], after[i])
+		}
+	}
+}
+
+// TestRingEmpty tests that an empty ring reports that it has no servers, and that a failed update keeps the ring.
+func TestRingEmpty(t *testing.T) {
+	var ring ketama.Ring
+	if _, err := ring.PickServer("key"); !errors.Is(err, ketama.ErrNoServers) {
+		t.Errorf("Expected ErrNoServers, got %v", err)
+	}
+	ring.SetServers("127.0.0.1:11211")
+	if err := ring.SetServers("127.0.0.1:notaport"); err == nil {
+		t.Error("Expected an error for an invalid server")
+	}
+	var servers []string
+	ring.Each(func(addr net.Addr) error {
+		servers = append(servers, addr.String())
+		return nil
+	})
+	if len(servers) != 1 || servers[0] != "127.0.0.1:11211" {
+		t.Errorf("Expected the ring unchanged after a failed update, got %v", servers)
+	}
+}
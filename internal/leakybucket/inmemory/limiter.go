@@ -9,15 +9,23 @@ import (
 
 	"github.com/rs/zerolog/log"
 
+	"learn.ratelimiter/internal/clock"
+	"learn.ratelimiter/redact"
 	"learn.ratelimiter/types"
 )
 
 // limiter is the in-memory implementation of the Leaky Bucket.
+// It keeps a bucket for each identifier in a sync.Map, like the Redis limiter keeps a key for each identifier.
 type limiter struct {
 	key      string
 	rate     int
 	capacity int
-	mu       sync.Mutex
+	buckets  sync.Map
+}
+
+// bucket is the leaky bucket of one identifier.
+type bucket struct {
+	mu sync.Mutex
 	// currentLevel is the current number of tokens in the bucket.
 	currentLevel float64
 	// lastLeak is the last time tokens were leaked from the bucket.
@@ -25,35 +33,144 @@ type limiter struct {
 }
 
 // NewLimiter creates a new in-memory Leaky Bucket limiter.
-func NewLimiter(key string, rate, capacity int) types.Limiter {
+func NewLimiter(key string, rate, capacity int) types.CostLimiter {
 	log.Info().Str("limiter_type", "LeakyBucket").Str("backend", "InMemory").Str("limiter_key", key).Int("rate", rate).Int("capacity", capacity).Msg("Limiter: Initialized")
 	return &limiter{
-		key:          key,
-		rate:         rate,
-		capacity:     capacity,
-		currentLevel: 0,
-		lastLeak:     time.Now(),
+		key:      key,
+		rate:     rate,
+		capacity: capacity,
 	}
 }
 
 // Allow checks if a request for the given identifier is allowed based on the Leaky Bucket algorithm.
 func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request adding n units to the bucket is allowed based on the Leaky Bucket algorithm.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return result.Allowed, err
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	result, err := l.allow(ctx, identifier, 1, t)
+	return result.Allowed, err
+}
+
+// AllowDetailed checks a request adding n units to the identifier's bucket as AllowN does, with the room left in the
+// bucket, when it is empty again and, for a denied request, when it has leaked enough to hold the request.
+func (l *limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	return l.allow(ctx, identifier, n, time.Now())
+}
 
+// allow evaluates a request adding n units at time now.
+func (l *limiter) allow(ctx context.Context, identifier string, n int, now time.Time) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
+	// Load before LoadOrStore, so checks of known identifiers do not allocate a bucket to discard
+	value, ok := l.buckets.Load(identifier)
+	if !ok {
+		value, _ = l.buckets.LoadOrStore(identifier, &bucket{lastLeak: now})
+	}
+	b := value.(*bucket)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	l.leak(b, now)
+
+	result := types.Result{Limit: int64(l.capacity)}
+	if b.currentLevel+float64(n) <= float64(l.capacity) {
+		b.currentLevel += float64(n)
+		result.Allowed = true
+		log.Debug().Str("limiter_type", "LeakyBucket").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Float64("current_level", b.currentLevel).Msg("Limiter: Request allowed")
+	} else {
+		if n <= l.capacity {
+			excess := b.currentLevel + float64(n) - float64(l.capacity)
+			result.RetryAfter = time.Duration(excess / float64(l.rate) * float64(time.Second))
+		}
+		log.Debug().Str("limiter_type", "LeakyBucket").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Float64("current_level", b.currentLevel).Msg("Limiter: Request denied")
+	}
+	result.Remaining = int64(math.Floor(max(float64(l.capacity)-b.currentLevel, 0)))
+	result.ResetAt = b.lastLeak.Add(time.Duration(b.currentLevel / float64(l.rate) * float64(time.Second)))
+	return result, nil
+}
+
+// Reserve adds n units to the identifier's bucket if it has room for them, or will have leaked enough within maxWait.
+// In the latter case the bucket holds more than its capacity, denying other requests until it has leaked the excess,
+// and the request must wait for the leak before proceeding.
+func (l *limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Reservation{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return types.Reservation{}, err
+	}
 	now := time.Now()
-	elapsed := now.Sub(l.lastLeak)
+	value, ok := l.buckets.Load(identifier)
+	if !ok {
+		value, _ = l.buckets.LoadOrStore(identifier, &bucket{lastLeak: now})
+	}
+	b := value.(*bucket)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	l.leak(b, now)
+
+	if n > l.capacity {
+		return types.Reservation{}, nil
+	}
+	excess := b.currentLevel + float64(n) - float64(l.capacity)
+	delay := time.Duration(max(excess, 0) / float64(l.rate) * float64(time.Second))
+	if delay > maxWait {
+		return types.Reservation{Delay: delay}, nil
+	}
+	b.currentLevel += float64(n)
+	return types.Reservation{OK: true, Delay: delay}, nil
+}
+
+// leak removes the units leaked from the bucket since its last leak, up to time now. The caller holds b.mu.
+func (l *limiter) leak(b *bucket, now time.Time) {
+	// Never let time move backwards for this bucket
+	now = clock.Clamp(now, b.lastLeak)
+	elapsed := clock.Elapsed(b.lastLeak, now)
 	leakedAmount := elapsed.Seconds() * float64(l.rate)
 
-	l.currentLevel = math.Max(0, l.currentLevel-leakedAmount)
-	l.lastLeak = now
+	b.currentLevel = math.Max(0, b.currentLevel-leakedAmount)
+	b.lastLeak = now
+}
+
+// Pressure returns the fraction of the identifier's bucket that is full now.
+func (l *limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	value, ok := l.buckets.Load(identifier)
+	if !ok {
+		return 0, nil
+	}
+	b := value.(*bucket)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	leaked := clock.Elapsed(b.lastLeak, time.Now()).Seconds() * float64(l.rate)
+	return min(math.Max(0, b.currentLevel-leaked)/float64(l.capacity), 1), nil
+}
 
-	if l.currentLevel+1 <= float64(l.capacity) {
-		l.currentLevel++
-		log.Debug().Str("limiter_type", "LeakyBucket").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", identifier).Float64("current_level", l.currentLevel).Msg("Limiter: Request allowed")
-		return true, nil
-	} else {
-		log.Debug().Str("limiter_type", "LeakyBucket").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", identifier).Float64("current_level", l.currentLevel).Msg("Limiter: Request denied")
-		return false, nil
+// ResetTime returns the time at which the identifier's bucket is empty again, or now if it is empty.
+func (l *limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	now := time.Now()
+	value, ok := l.buckets.Load(identifier)
+	if !ok {
+		return now, nil
+	}
+	b := value.(*bucket)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	empty := b.lastLeak.Add(time.Duration(b.currentLevel / float64(l.rate) * float64(time.Second)))
+	if !empty.After(now) {
+		return now, nil
 	}
+	return empty, nil
+}
+
+// Forget drops the identifier's bucket, so its next request finds an empty bucket.
+func (l *limiter) Forget(identifier string) {
+	l.buckets.Delete(identifier)
 }
@@ -2,10 +2,12 @@ package lbinmemory_test
 
 import (
 	"context"
+	"math"
 	"testing"
 	"time"
 
 	lbinmemory "learn.ratelimiter/internal/leakybucket/inmemory"
+	"learn.ratelimiter/types"
 )
 
 func TestLeakyBucketLimiter(t *testing.T) {
@@ -82,3 +84,99 @@ func TestLeakyBucketLimiter(t *testing.T) {
 		}
 	})
 }
+
+// TestAllowDoesNotAllocate tests that checking an identifier with existing state allocates nothing.
+func TestAllowDoesNotAllocate(t *testing.T) {
+	limiter := lbinmemory.NewLimiter("bench_leaky_bucket", math.MaxInt32, math.MaxInt32)
+	ctx := context.Background()
+	limiter.Allow(ctx, "user1")
+	if allocs := testing.AllocsPerRun(1000, func() { limiter.Allow(ctx, "user1") }); allocs != 0 {
+		t.Errorf("Expected Allow not to allocate, got %v allocations per call", allocs)
+	}
+}
+
+// BenchmarkAllow measures checking an identifier with existing state, run with -benchmem to report allocations.
+func BenchmarkAllow(b *testing.B) {
+	limiter := lbinmemory.NewLimiter("bench_leaky_bucket", math.MaxInt32, math.MaxInt32)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			limiter.Allow(ctx, "user1")
+		}
+	})
+}
+
+// TestPressure tests that Pressure reports the fraction of the bucket in use without charging it.
+func TestPressure(t *testing.T) {
+	limiter := lbinmemory.NewLimiter("test_pressure", 1, 4).(types.PressureLimiter)
+	ctx := context.Background()
+
+	for _, want := range []float64{0, 0.5, 1} {
+		pressure, err := limiter.Pressure(ctx, "user1")
+		if err != nil {
+			t.Fatalf("Pressure returned error: %v", err)
+		}
+		if math.Abs(pressure-want) > 0.01 {
+			t.Errorf("Expected pressure %v, got %v", want, pressure)
+		}
+		for i := 0; i < 2; i++ {
+			limiter.Allow(ctx, "user1")
+		}
+	}
+	if allowed, _ := limiter.Allow(ctx, "user1"); allowed {
+		t.Error("Request should be denied at full pressure")
+	}
+	// Each identifier has its own bucket
+	if pressure, _ := limiter.Pressure(ctx, "user2"); pressure != 0 {
+		t.Errorf("Expected no pressure for another identifier, got %v", pressure)
+	}
+}
+
+// TestResetTime tests that ResetTime reports when the bucket is empty again.
+func TestResetTime(t *testing.T) {
+	limiter := lbinmemory.NewLimiter("test_reset_time", 1, 4).(types.ResetLimiter)
+	ctx := context.Background()
+
+	start := time.Now()
+	if reset, err := limiter.ResetTime(ctx, "user1"); err != nil || reset.Before(start) || reset.After(time.Now()) {
+		t.Fatalf("Expected a reset now for an identifier without state, got %s, %v", reset, err)
+	}
+	limiter.Allow(ctx, "user1")
+	limiter.Allow(ctx, "user1")
+	reset, err := limiter.ResetTime(ctx, "user1")
+	if err != nil {
+		t.Fatalf("ResetTime returned error: %v", err)
+	}
+	if want := start.Add(2 * time.Second); reset.Sub(want).Abs() > 100*time.Millisecond {
+		t.Errorf("Expected a reset at %s, got %s", want, reset)
+	}
+}
+
+// TestReserve tests that reservations admit requests the bucket leaks room for within the maximum wait, with the
+// delay before they may proceed, and deny the others with the delay until they fit.
+func TestReserve(t *testing.T) {
+	limiter := lbinmemory.NewLimiter("test_reserve", 10, 2).(types.ReserveLimiter)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name      string
+		n         int
+		maxWait   time.Duration
+		wantOK    bool
+		wantDelay time.Duration
+	}{
+		{"room", 2, 0, true, 0},
+		{"beyond max wait", 1, 50 * time.Millisecond, false, 100 * time.Millisecond},
+		{"within max wait", 1, 200 * time.Millisecond, true, 100 * time.Millisecond},
+		{"behind the reservation", 1, 150 * time.Millisecond, false, 200 * time.Millisecond},
+	} {
+		reservation, err := limiter.Reserve(ctx, "user1", tc.n, tc.maxWait)
+		if err != nil {
+			t.Fatalf("%s: Reserve returned error: %v", tc.name, err)
+		}
+		if reservation.OK != tc.wantOK || reservation.Delay.Round(10*time.Millisecond) != tc.wantDelay {
+			t.Errorf("%s: Expected OK %v with delay %s, got %+v", tc.name, tc.wantOK, tc.wantDelay, reservation)
+		}
+	}
+}
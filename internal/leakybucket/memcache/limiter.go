@@ -0,0 +1,165 @@
+// Package lbmemcache provides a Memcache implementation of the Leaky Bucket rate limiting algorithm.
+package lbmemcache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/rs/zerolog/log"
+
+	"learn.ratelimiter/internal/clock"
+	"learn.ratelimiter/internal/codec"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// maxAttempts is the number of times a request reads and updates the bucket before giving up, when other requests
+// update it in between.
+const maxAttempts = 5
+
+// limiter is the Memcache implementation of the Leaky Bucket.
+type limiter struct {
+	key      string
+	rate     int
+	capacity int
+	client   *memcache.Client
+	codec    codec.Codec // encoding of stored state; any format is read
+	noCAS    bool        // update state with set instead of cas, for proxies without cas
+}
+
+// Option configures optional behaviour of a limiter.
+type Option func(*limiter)
+
+// WithoutCAS updates state with set instead of cas, for servers behind proxies that do not support cas (see
+// tbmemcache.WithoutCAS). Concurrent requests for the same identifier may then overwrite each other's update.
+func WithoutCAS() Option {
+	return func(l *limiter) {
+		l.noCAS = true
+	}
+}
+
+// leakyBucketState represents the level of an identifier's bucket stored in Memcache.
+type leakyBucketState struct {
+	Level    float64   `json:"level" codec:"1"`
+	LastLeak time.Time `json:"last_leak" codec:"2"`
+}
+
+// NewLimiter creates a new Memcache Leaky Bucket limiter storing state with the given codec (JSON if nil).
+// State written by any codec is read, so the codec can be changed without resetting buckets. Buckets are created
+// with add and updated with cas, so concurrent requests from any instance are counted exactly (see WithoutCAS).
+func NewLimiter(key string, rate, capacity int, client *memcache.Client, stateCodec codec.Codec, opts ...Option) types.CostLimiter {
+	if stateCodec == nil {
+		stateCodec = codec.JSON
+	}
+	l := &limiter{
+		key:      key,
+		rate:     rate,
+		capacity: capacity,
+		client:   client,
+		codec:    stateCodec,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	log.Info().Str("limiter_type", "LeakyBucket").Str("backend", "Memcache").Str("limiter_key", key).Int("rate", rate).Int("capacity", capacity).Str("codec", stateCodec.Name()).Bool("cas", !l.noCAS).Msg("Limiter: Initialized")
+	return l
+}
+
+// Allow checks if a request for the given identifier is allowed based on the Leaky Bucket algorithm.
+func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request adding n units to the bucket is allowed based on the Leaky Bucket algorithm.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	return l.allow(ctx, identifier, n, time.Now())
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+// Times earlier than the bucket's last leak are treated as that last leak.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	return l.allow(ctx, identifier, 1, t)
+}
+
+// allow evaluates a request adding n units at time now. Without CAS, the updated state overwrites any update made
+// by another instance since it was read.
+func (l *limiter) allow(ctx context.Context, identifier string, n int, now time.Time) (bool, error) {
+	if err := types.CheckCost(n); err != nil {
+		return false, err
+	}
+	itemKey := "leaky_bucket:" + l.key + ":" + identifier
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		item, err := l.client.Get(itemKey)
+		if err != nil && err != memcache.ErrCacheMiss {
+			log.Error().Err(err).Str("limiter_type", "LeakyBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to get state from Memcache")
+			return false, fmt.Errorf("get state from memcache: %w", err)
+		}
+
+		state := &leakyBucketState{LastLeak: now}
+		if item != nil {
+			if err := l.codec.Unmarshal(item.Value, state); err != nil {
+				log.Error().Err(err).Str("limiter_type", "LeakyBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to unmarshal state from Memcache")
+				return false, fmt.Errorf("unmarshal state: %w", err)
+			}
+		}
+
+		if !l.fill(state, float64(n), now) {
+			// A denied request leaves the stored state untouched, since the leak is computed from it on the next request
+			log.Debug().Str("limiter_type", "LeakyBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Float64("current_level", state.Level).Msg("Limiter: Request denied")
+			return false, nil
+		}
+
+		value, err := l.codec.Marshal(state)
+		if err != nil {
+			log.Error().Err(err).Str("limiter_type", "LeakyBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to marshal state for Memcache")
+			return false, fmt.Errorf("marshal state: %w", err)
+		}
+		// The bucket expires once it has leaked empty
+		expiration := int32(max(math.Ceil(state.Level/float64(l.rate)), 1))
+		switch {
+		case item == nil:
+			// Add fails if another request created the bucket since it was read
+			err = l.client.Add(&memcache.Item{Key: itemKey, Value: value, Expiration: expiration})
+		case l.noCAS:
+			err = l.client.Set(&memcache.Item{Key: itemKey, Value: value, Expiration: expiration})
+		default:
+			item.Value = value
+			item.Expiration = expiration
+			err = l.client.CompareAndSwap(item)
+		}
+		if err == memcache.ErrNotStored || err == memcache.ErrCASConflict {
+			// The bucket was created, updated or evicted since it was read
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Str("limiter_type", "LeakyBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to set state in Memcache")
+			return false, fmt.Errorf("set state in memcache: %w", err)
+		}
+		log.Debug().Str("limiter_type", "LeakyBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Float64("current_level", state.Level).Msg("Limiter: Request allowed")
+		return true, nil
+	}
+
+	err := fmt.Errorf("state of identifier changed by %d concurrent requests", maxAttempts)
+	log.Warn().Err(err).Str("limiter_type", "LeakyBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Too much contention updating state in Memcache")
+	return false, fmt.Errorf("update state in memcache: %w", err)
+}
+
+// fill leaks the bucket up to time now and adds cost units to it if they fit, as the in-memory limiter does.
+// It reports whether the units were added.
+func (l *limiter) fill(state *leakyBucketState, cost float64, now time.Time) bool {
+	// Never let time move backwards for this bucket
+	now = clock.Clamp(now, state.LastLeak)
+	leaked := clock.Elapsed(state.LastLeak, now).Seconds() * float64(l.rate)
+	state.Level = math.Max(0, state.Level-leaked)
+	state.LastLeak = now
+
+	if state.Level+cost > float64(l.capacity) {
+		return false
+	}
+	state.Level += cost
+	return true
+}
@@ -3,98 +3,170 @@ package lbredis
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log"
 
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/backendkey"
+	"learn.ratelimiter/internal/clock"
+	"learn.ratelimiter/internal/redisargs"
+	"learn.ratelimiter/internal/redisscripts"
+	"learn.ratelimiter/internal/redisstate"
+	"learn.ratelimiter/redact"
 	"learn.ratelimiter/types"
 )
 
-const leakyBucketLuaScript = `
--- KEYS[1]: The key for the bucket state (e.g., leaky_bucket:limiter_key:identifier)
--- ARGV[1]: Capacity of the bucket
--- ARGV[2]: Leak rate (tokens per second)
--- ARGV[3]: Current timestamp in milliseconds
-
-local capacity = tonumber(ARGV[1])
-local rate = tonumber(ARGV[2])
-local now = tonumber(ARGV[3])
-
-local res = redis.call('GET', KEYS[1])
-
-local currentLevel = 0
-local lastLeak = now
-
-if res then
-    local state = cjson.decode(res)
-    currentLevel = tonumber(state['currentLevel'])
-    lastLeak = tonumber(state['lastLeak'])
-end
-
-local elapsed = (now - lastLeak) / 1000 -- elapsed time in seconds
-local leakedAmount = elapsed * rate
-
-currentLevel = math.max(0, currentLevel - leakedAmount)
-
-local allowed = false
-if currentLevel + 1 <= capacity then
-    currentLevel = currentLevel + 1
-    allowed = true
-end
-
-lastLeak = now
-
-local newState = cjson.encode({currentLevel = currentLevel, lastLeak = lastLeak})
-redis.call('SET', KEYS[1], newState)
-
-if allowed then
-    return 1
-else
-    return 0
-end
-`
-
 // limiter is the Redis implementation of the Leaky Bucket.
 type limiter struct {
 	key      string
 	rate     int
 	capacity int
 	client   *redis.Client
-	script   *redis.Script
+	script   *redisscripts.Script
+	keys     *backendkey.Builder // Composes the Redis key of each identifier
+}
+
+// Option configures optional behaviour of a limiter.
+type Option func(*limiter)
+
+// WithKeyCache caches the Redis keys of up to size frequent identifiers instead of composing them on every check.
+func WithKeyCache(size int) Option {
+	return func(l *limiter) {
+		l.keys = backendkey.NewBuilder(size, "leaky_bucket", l.key)
+	}
 }
 
 // NewLimiter creates a new Redis Leaky Bucket limiter.
-func NewLimiter(key string, rate, capacity int, client *redis.Client) types.Limiter {
+func NewLimiter(key string, rate, capacity int, client *redis.Client, opts ...Option) types.CostLimiter {
 	log.Info().Str("limiter_type", "LeakyBucket").Str("backend", "Redis").Str("limiter_key", key).Int("rate", rate).Int("capacity", capacity).Msg("Limiter: Initialized")
-	script := redis.NewScript(leakyBucketLuaScript)
-	return &limiter{
+	l := &limiter{
 		key:      key,
 		rate:     rate,
 		capacity: capacity,
 		client:   client,
-		script:   script,
+		script:   redisscripts.LeakyBucketAllow,
+		keys:     backendkey.NewBuilder(0, "leaky_bucket", key),
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 // Allow checks if a request for the given identifier is allowed based on the Leaky Bucket algorithm.
 func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
-	itemKey := fmt.Sprintf("leaky_bucket:%s:%s", l.key, identifier)
-	now := time.Now().UnixNano() / int64(time.Millisecond)
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request adding n units to the bucket is allowed based on the Leaky Bucket algorithm.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return result.Allowed, err
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+// The script treats times earlier than the last leak time as the last leak time.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	result, err := l.allow(ctx, identifier, 1, t)
+	return result.Allowed, err
+}
+
+// AllowDetailed checks a request adding n units to the identifier's bucket as AllowN does, with the room left in the
+// bucket, when it is empty again and, for a denied request, when it has leaked enough to hold the request, all
+// computed by the script.
+func (l *limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	return l.allow(ctx, identifier, n, time.Now())
+}
 
-	result, err := l.script.Run(ctx, l.client, []string{itemKey}, l.capacity, l.rate, now).Result()
+// Pressure returns the fraction of the identifier's bucket that is full now. It reads the bucket without charging it.
+func (l *limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	level, err := l.level(ctx, identifier)
 	if err != nil {
-		log.Error().Err(err).Str("limiter_type", "LeakyBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Failed to run Lua script")
-		return false, fmt.Errorf("run leaky bucket lua script: %w", err)
+		return 0, err
 	}
+	return min(level/float64(l.capacity), 1), nil
+}
+
+// ResetTime returns the time at which the identifier's bucket is empty again, or now if it is empty. It reads the
+// bucket without charging it.
+func (l *limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	level, err := l.level(ctx, identifier)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(time.Duration(level / float64(l.rate) * float64(time.Second))), nil
+}
+
+// level reads the identifier's bucket and returns its level once leaked.
+func (l *limiter) level(ctx context.Context, identifier string) (float64, error) {
+	itemKey := l.keys.Key(identifier)
+	value, err := l.client.Get(ctx, itemKey).Bytes()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		log.Error().Err(err).Str("limiter_type", "LeakyBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to read bucket for pressure")
+		return 0, fmt.Errorf("read leaky bucket state: %w", err)
+	}
+	var state struct {
+		CurrentLevel float64  `json:"currentLevel"`
+		LastLeak     float64  `json:"lastLeak"`
+		Version      *float64 `json:"v"`
+	}
+	if err := json.Unmarshal(value, &state); err != nil {
+		return 0, fmt.Errorf("decode leaky bucket state: %w", err)
+	}
+	if state.Version != nil && *state.Version > redisstate.SchemaVersion {
+		return 0, redisstate.Check(l.key, config.LeakyBucket, redisstate.StatusNewer)
+	}
+	leaked := clock.Elapsed(time.UnixMilli(int64(state.LastLeak)), time.Now()).Seconds() * float64(l.rate)
+	return math.Max(0, state.CurrentLevel-leaked), nil
+}
+
+// Reserve approximates a reservation: the request is checked once, and a denied one carries the time the bucket takes
+// to leak enough for it. Units are not added ahead of the leak, so maxWait is not used, and a retry after the delay
+// may be denied if other requests filled the bucket meanwhile.
+func (l *limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return types.Reservation{OK: result.Allowed, Delay: result.RetryAfter}, err
+}
+
+// allow evaluates a request adding n units at time t.
+func (l *limiter) allow(ctx context.Context, identifier string, n int, t time.Time) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
+	itemKey := l.keys.Key(identifier)
+	now := t.UnixMilli()
 
-	allowed, ok := result.(int64)
-	if !ok {
-		err := fmt.Errorf("unexpected result type from redis script: %T", result)
-		log.Error().Err(err).Str("limiter_type", "LeakyBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Unexpected script result")
-		return false, err
+	args := redisargs.Get(itemKey).Add(l.capacity, l.rate, now, n, redisstate.SchemaVersion)
+	defer args.Release()
+	result, err := l.script.Run(ctx, l.client, args.Keys, args.Values...).Result()
+	if err != nil {
+		log.Error().Err(err).Str("limiter_type", "LeakyBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to run Lua script")
+		return types.Result{}, fmt.Errorf("run leaky bucket lua script: %w", err)
+	}
+
+	// The script returns {allowed, status, remaining, reset_ms, retry_ms}
+	values, err := redisstate.Ints(result, 5)
+	if err != nil {
+		log.Error().Err(err).Str("limiter_type", "LeakyBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Unexpected script result")
+		return types.Result{}, err
+	}
+	if err := redisstate.Check(l.key, config.LeakyBucket, values[1]); err != nil {
+		return types.Result{}, err
 	}
 
-	return allowed == 1, nil
+	return types.Result{
+		Allowed:    values[0] == 1,
+		Limit:      int64(l.capacity),
+		Remaining:  values[2],
+		ResetAt:    time.Now().Add(time.Duration(values[3]) * time.Millisecond),
+		RetryAfter: time.Duration(values[4]) * time.Millisecond,
+	}, nil
 }
@@ -0,0 +1,296 @@
+// Package maxkeys provides a limiter decorator capping the distinct identifiers a limiter tracks, so an
+// identifier-spraying attack cannot grow in-memory state or the number of Redis keys without bound.
+package maxkeys
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/redisscripts"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// tracker decides whether identifiers fit within the cap.
+type tracker interface {
+	// admit reports whether the identifier is tracked at time now, tracking it if there is room.
+	// evicted is the identifier dropped to make room for it, if any.
+	admit(ctx context.Context, identifier string, now time.Time) (admitted bool, evicted string, err error)
+}
+
+// Limiter delegates to a limiter the requests of at most the configured number of distinct identifiers.
+// New identifiers beyond the cap are rejected with types.ErrTooManyKeys (reject policy), checked against a budget
+// shared under config.OverflowIdentifier (overflow policy), or make room by evicting the identifier seen least
+// recently (evict policy).
+type Limiter struct {
+	key     string // Limiter key from config
+	limiter types.Limiter
+	policy  config.KeyOverflowPolicy
+	tracker tracker
+}
+
+// NewLimiter creates a decorator around limiter capping its identifiers as cfg describes, counting them in memory.
+func NewLimiter(key string, limiter types.Limiter, cfg config.MaxKeysConfig) *Limiter {
+	policy := cfg.Policy
+	if policy == "" {
+		policy = config.KeyOverflowReject
+	}
+	return &Limiter{
+		key:     key,
+		limiter: limiter,
+		policy:  policy,
+		tracker: &localTracker{
+			limit:       cfg.Limit,
+			window:      window(cfg),
+			evict:       policy == config.KeyOverflowEvict,
+			identifiers: make(map[string]*list.Element),
+			order:       list.New(),
+		},
+	}
+}
+
+// NewRedisLimiter creates a decorator around limiter capping its identifiers as cfg describes, estimating the
+// identifiers seen by all instances in a HyperLogLog kept in Redis. The estimate is approximate: a small share
+// of new identifiers may pass for known ones. The evict policy is not supported.
+func NewRedisLimiter(key string, limiter types.Limiter, cfg config.MaxKeysConfig, client *redis.Client) *Limiter {
+	l := NewLimiter(key, limiter, cfg)
+	l.tracker = &redisTracker{
+		key:    key,
+		limit:  cfg.Limit,
+		window: window(cfg),
+		client: client,
+	}
+	return l
+}
+
+// window returns the window of cfg, or the default window if none is configured.
+func window(cfg config.MaxKeysConfig) time.Duration {
+	if cfg.Window <= 0 {
+		return config.DefaultMaxKeysWindow
+	}
+	return cfg.Window
+}
+
+// Allow checks if a request for the identifier, within the cap, is allowed.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	identifier, err := l.identifier(ctx, identifier)
+	if err != nil {
+		return false, err
+	}
+	return l.limiter.Allow(ctx, identifier)
+}
+
+// AllowN checks if a request costing n units for the identifier, within the cap, is allowed.
+// Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	if err := types.CheckCost(n); err != nil {
+		return false, err
+	}
+	identifier, err := l.identifier(ctx, identifier)
+	if err != nil {
+		return false, err
+	}
+	if costLimiter, ok := l.limiter.(types.CostLimiter); ok {
+		return costLimiter.AllowN(ctx, identifier, n)
+	}
+	return l.limiter.Allow(ctx, identifier)
+}
+
+// AllowAt checks if a request for the identifier, within the cap, is allowed at time t.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	timeLimiter, ok := l.limiter.(types.TimeLimiter)
+	if !ok {
+		return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+	}
+	identifier, err := l.identifier(ctx, identifier)
+	if err != nil {
+		return false, err
+	}
+	return timeLimiter.AllowAt(ctx, identifier, t)
+}
+
+// KeyCount returns the key count of the wrapped limiter, and false if it cannot tell.
+func (l *Limiter) KeyCount() (int, bool) {
+	if keyCounter, ok := l.limiter.(types.KeyCounter); ok {
+		return keyCounter.KeyCount()
+	}
+	return 0, false
+}
+
+// Forget drops the identifier's state in the wrapped limiter. It stays tracked until it is idle for the window or
+// evicted.
+func (l *Limiter) Forget(identifier string) {
+	types.Forget(l.limiter, identifier)
+}
+
+// Pressure returns the fraction of the identifier's budget in use in the wrapped limiter, without tracking it.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	return types.Pressure(ctx, l.limiter, identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget is fully restored in the wrapped limiter, without tracking it.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	return types.ResetTime(ctx, l.limiter, identifier)
+}
+
+// Reserve reserves a request costing n units for the identifier, within the cap.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Reservation{}, err
+	}
+	identifier, err := l.identifier(ctx, identifier)
+	if err != nil {
+		return types.Reservation{}, err
+	}
+	return types.Reserve(ctx, l.limiter, identifier, n, maxWait)
+}
+
+// AllowDetailed checks a request costing n units for the identifier, within the cap, with its result.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
+	identifier, err := l.identifier(ctx, identifier)
+	if err != nil {
+		return types.Result{}, err
+	}
+	return types.AllowDetailed(ctx, l.limiter, identifier, n)
+}
+
+// Stats returns the requests allowed and denied for the identifier in the wrapped limiter, without tracking it.
+func (l *Limiter) Stats(ctx context.Context, identifier string) (types.IdentifierStats, error) {
+	return types.Stats(ctx, l.limiter, identifier)
+}
+
+// History returns the latest decisions for the identifier in the wrapped limiter, without tracking it.
+func (l *Limiter) History(ctx context.Context, identifier string) ([]types.Decision, error) {
+	return types.History(ctx, l.limiter, identifier)
+}
+
+// identifier returns the identifier to pass to the wrapped limiter, applying the policy if it is new and the cap is reached.
+func (l *Limiter) identifier(ctx context.Context, identifier string) (string, error) {
+	admitted, evicted, err := l.tracker.admit(ctx, identifier, time.Now())
+	if err != nil {
+		log.Error().Err(err).Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to track identifier")
+		return "", fmt.Errorf("limiter '%s': track identifier: %w", l.key, err)
+	}
+	if evicted != "" {
+		metrics.RecordKeyOverflow(l.key, string(config.KeyOverflowEvict))
+		types.Forget(l.limiter, evicted)
+		log.Debug().Str("limiter_key", l.key).Str("identifier", redact.Identifier(evicted)).Msg("Limiter: Evicted identifier to make room for a new one")
+	}
+	if admitted {
+		return identifier, nil
+	}
+	metrics.RecordKeyOverflow(l.key, string(l.policy))
+	if l.policy == config.KeyOverflowShare {
+		return config.OverflowIdentifier, nil
+	}
+	log.Debug().Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Too many identifiers, rejecting new identifier")
+	return "", fmt.Errorf("%w: limiter '%s' tracks its maximum number of identifiers", types.ErrTooManyKeys, l.key)
+}
+
+// localTracker tracks the identifiers seen by this instance, ordered by when they were last seen.
+type localTracker struct {
+	limit  int
+	window time.Duration
+	evict  bool
+
+	mu          sync.Mutex
+	identifiers map[string]*list.Element // Values are *entry
+	order       *list.List               // Most recently seen first
+}
+
+// entry is a tracked identifier.
+type entry struct {
+	identifier string
+	lastSeen   time.Time
+}
+
+// admit tracks the identifier, dropping identifiers idle for a whole window first and, with the evict policy,
+// the identifier seen least recently when the cap is still reached.
+func (t *localTracker) admit(ctx context.Context, identifier string, now time.Time) (bool, string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if element, ok := t.identifiers[identifier]; ok {
+		element.Value.(*entry).lastSeen = now
+		t.order.MoveToFront(element)
+		return true, "", nil
+	}
+
+	for oldest := t.order.Back(); oldest != nil && now.Sub(oldest.Value.(*entry).lastSeen) >= t.window; oldest = t.order.Back() {
+		t.remove(oldest)
+	}
+	var evicted string
+	if len(t.identifiers) >= t.limit {
+		if !t.evict {
+			return false, "", nil
+		}
+		oldest := t.order.Back()
+		evicted = oldest.Value.(*entry).identifier
+		t.remove(oldest)
+	}
+	t.identifiers[identifier] = t.order.PushFront(&entry{identifier: identifier, lastSeen: now})
+	return true, evicted, nil
+}
+
+// remove stops tracking the identifier of element. The caller holds t.mu.
+func (t *localTracker) remove(element *list.Element) {
+	delete(t.identifiers, element.Value.(*entry).identifier)
+	t.order.Remove(element)
+}
+
+// redisTracker estimates the identifiers seen by all instances in a HyperLogLog per window. Identifiers counted
+// by this instance in the current window are remembered, so their requests do not need a script run.
+type redisTracker struct {
+	key    string // Limiter key from config
+	limit  int
+	window time.Duration
+	client *redis.Client
+
+	mu       sync.Mutex
+	current  int64 // Index of the window the known identifiers were counted in
+	admitted map[string]struct{}
+}
+
+// admit counts the identifier in the current window's HyperLogLog unless it is new and the cap is reached.
+func (t *redisTracker) admit(ctx context.Context, identifier string, now time.Time) (bool, string, error) {
+	index := now.UnixNano() / int64(t.window)
+	t.mu.Lock()
+	if index != t.current {
+		t.current = index
+		t.admitted = make(map[string]struct{})
+	}
+	_, known := t.admitted[identifier]
+	t.mu.Unlock()
+	if known {
+		return true, "", nil
+	}
+
+	// The hash tag keeps both keys in one slot with Redis Cluster
+	prefix := "max_keys:{" + t.key + "}:"
+	keys := []string{prefix + strconv.FormatInt(index, 10), prefix + "scratch"}
+	result, err := redisscripts.MaxKeysAdmit.Run(ctx, t.client, keys, identifier, t.limit, (2 * t.window).Milliseconds()).Int()
+	if err != nil {
+		return false, "", fmt.Errorf("run max keys lua script: %w", err)
+	}
+	if result != 1 {
+		return false, "", nil
+	}
+
+	t.mu.Lock()
+	if index == t.current && len(t.admitted) < t.limit {
+		t.admitted[identifier] = struct{}{}
+	}
+	t.mu.Unlock()
+	return true, "", nil
+}
@@ -0,0 +1,101 @@
+// Package maxkeys_test contains tests for the cap on distinct identifiers.
+package maxkeys_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/config"
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/internal/maxkeys"
+	"learn.ratelimiter/types"
+)
+
+// recordingLimiter allows every request and records the identifiers it was asked about.
+type recordingLimiter struct {
+	identifiers []string
+}
+
+func (r *recordingLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	r.identifiers = append(r.identifiers, identifier)
+	return true, nil
+}
+
+// TestMaxKeysReject tests that new identifiers beyond the cap are rejected while known ones keep being checked.
+func TestMaxKeysReject(t *testing.T) {
+	limiter := maxkeys.NewLimiter("test_max_keys_reject", &recordingLimiter{}, config.MaxKeysConfig{Limit: 2})
+	ctx := context.Background()
+
+	for _, identifier := range []string{"a", "b", "a"} {
+		if allowed, err := limiter.Allow(ctx, identifier); !allowed || err != nil {
+			t.Fatalf("Expected request for %q allowed, got (%v, %v)", identifier, allowed, err)
+		}
+	}
+	if _, err := limiter.Allow(ctx, "c"); !errors.Is(err, types.ErrTooManyKeys) {
+		t.Errorf("Expected ErrTooManyKeys for a third identifier, got %v", err)
+	}
+	if allowed, err := limiter.Allow(ctx, "b"); !allowed || err != nil {
+		t.Errorf("Expected request for a known identifier allowed, got (%v, %v)", allowed, err)
+	}
+}
+
+// TestMaxKeysOverflow tests that new identifiers beyond the cap share the overflow budget.
+func TestMaxKeysOverflow(t *testing.T) {
+	backend := &recordingLimiter{}
+	limiter := maxkeys.NewLimiter("test_max_keys_overflow", backend, config.MaxKeysConfig{Limit: 1, Policy: config.KeyOverflowShare})
+
+	for _, identifier := range []string{"a", "b", "c"} {
+		if allowed, err := limiter.Allow(context.Background(), identifier); !allowed || err != nil {
+			t.Fatalf("Expected request for %q allowed, got (%v, %v)", identifier, allowed, err)
+		}
+	}
+
+	expected := []string{"a", config.OverflowIdentifier, config.OverflowIdentifier}
+	for i, identifier := range backend.identifiers {
+		if identifier != expected[i] {
+			t.Errorf("Expected request %d checked as %q, got %q", i, expected[i], identifier)
+		}
+	}
+}
+
+// TestMaxKeysEvict tests that a new identifier beyond the cap evicts the identifier seen least recently,
+// whose state is dropped so it starts with a fresh budget.
+func TestMaxKeysEvict(t *testing.T) {
+	base := fcinmemory.NewLimiter("test_max_keys_evict", time.Minute, 1)
+	limiter := maxkeys.NewLimiter("test_max_keys_evict", base, config.MaxKeysConfig{Limit: 2, Policy: config.KeyOverflowEvict})
+	ctx := context.Background()
+
+	for _, identifier := range []string{"a", "b", "c"} {
+		if allowed, err := limiter.Allow(ctx, identifier); !allowed || err != nil {
+			t.Fatalf("Expected first request for %q allowed, got (%v, %v)", identifier, allowed, err)
+		}
+	}
+	if count, _ := base.KeyCount(); count != 2 {
+		t.Errorf("Expected 2 identifiers with state after an eviction, got %d", count)
+	}
+	if allowed, _ := limiter.Allow(ctx, "c"); allowed {
+		t.Error("Expected the second request for a tracked identifier denied")
+	}
+	if allowed, _ := limiter.Allow(ctx, "a"); !allowed {
+		t.Error("Expected the evicted identifier to start with a fresh budget")
+	}
+}
+
+// TestMaxKeysWindow tests that identifiers idle for a whole window stop counting towards the cap.
+func TestMaxKeysWindow(t *testing.T) {
+	limiter := maxkeys.NewLimiter("test_max_keys_window", &recordingLimiter{}, config.MaxKeysConfig{Limit: 1, Window: 20 * time.Millisecond})
+	ctx := context.Background()
+
+	if _, err := limiter.Allow(ctx, "a"); err != nil {
+		t.Fatalf("Expected first identifier allowed, got %v", err)
+	}
+	if _, err := limiter.Allow(ctx, "b"); !errors.Is(err, types.ErrTooManyKeys) {
+		t.Fatalf("Expected ErrTooManyKeys within the window, got %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := limiter.Allow(ctx, "b"); err != nil {
+		t.Errorf("Expected a new identifier allowed once the first was idle for a window, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package memcacheclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"learn.ratelimiter/dialer"
+)
+
+// authenticate returns a DialFunc authenticating each connection opened by dial with Memcached's text protocol
+// authentication: a set command, of any key, whose value is the username and password separated by a space.
+func authenticate(dial dialer.DialFunc, username, password string) dialer.DialFunc {
+	credentials := username + " " + password
+	command := fmt.Sprintf("set auth 0 0 %d\r\n%s\r\n", len(credentials), credentials)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		if err := login(conn, command); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("authenticate to memcache server %s: %w", addr, err)
+		}
+		conn.SetDeadline(time.Time{})
+		return conn, nil
+	}
+}
+
+// login sends the authentication command and checks that the server stored it.
+func login(conn net.Conn, command string) error {
+	if _, err := io.WriteString(conn, command); err != nil {
+		return err
+	}
+	// The reply is read a byte at a time, so nothing after it is consumed before the client reads the connection
+	var reply strings.Builder
+	b := make([]byte, 1)
+	for !strings.HasSuffix(reply.String(), "\r\n") {
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return err
+		}
+		reply.WriteByte(b[0])
+	}
+	if reply.String() != "STORED\r\n" {
+		return fmt.Errorf("server replied %q", strings.TrimSpace(reply.String()))
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Package memcacheclient creates Memcache clients from backend configuration.
+package memcacheclient
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/dialer"
+	"learn.ratelimiter/internal/ketama"
+	"learn.ratelimiter/metrics"
+)
+
+// selector is a memcache.ServerSelector whose servers can be replaced.
+type selector interface {
+	memcache.ServerSelector
+	SetServers(servers ...string) error
+}
+
+// Client is a Memcache client whose server addresses are optionally re-resolved in the background.
+type Client struct {
+	*memcache.Client
+	servers   selector
+	addresses []string
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a client of the Memcache servers of params, distributing keys with their hashing, and connecting through
+// their proxy or registered dialer and authenticating with their credentials, if any. Dials are bounded by the
+// client's timeout. With a resolve interval, the servers' host names are resolved again every interval, so keys move
+// to a server whose address changed. Call Close to stop.
+func New(params *config.MemcacheBackendConfig) (*Client, error) {
+	var servers selector = &memcache.ServerList{}
+	if params.Hashing == config.MemcacheHashingKetama {
+		servers = &ketama.Ring{}
+	}
+	if err := servers.SetServers(params.Addresses...); err != nil {
+		return nil, fmt.Errorf("resolve memcache servers: %w", err)
+	}
+	c := &Client{
+		Client:    memcache.NewFromSelector(servers),
+		servers:   servers,
+		addresses: params.Addresses,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if params.Timeout > 0 {
+		c.Timeout = params.Timeout
+	}
+	if params.MaxIdleConns > 0 {
+		c.MaxIdleConns = params.MaxIdleConns
+	}
+	dial, err := dialer.New(params.Proxy, params.Dialer, 0)
+	if err != nil {
+		return nil, fmt.Errorf("memcache dialer: %w", err)
+	}
+	if params.Username != "" {
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		dial = authenticate(dial, params.Username, params.Password)
+	}
+	if dial != nil {
+		c.DialContext = dial
+	}
+	if params.ResolveInterval > 0 {
+		go c.refresh(params.ResolveInterval)
+	} else {
+		close(c.done)
+	}
+	return c, nil
+}
+
+// refresh resolves the server addresses every interval until the client is closed. Failed resolutions keep the
+// previous addresses.
+func (c *Client) refresh(interval time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	previous := c.resolved()
+	for {
+		select {
+		case <-ticker.C:
+			// SetServers only replaces the addresses once every server resolved
+			if err := c.servers.SetServers(c.addresses...); err != nil {
+				log.Warn().Err(err).Strs("addresses", c.addresses).Msg("Memcache: Failed to re-resolve server addresses")
+				for _, address := range c.addresses {
+					metrics.RecordBackendRefresh(address, dialer.RefreshError)
+				}
+				continue
+			}
+			current := c.resolved()
+			if !slices.Equal(current, previous) {
+				log.Info().Strs("addresses", c.addresses).Msg("Memcache: Server addresses resolve to new addresses")
+				for _, address := range c.addresses {
+					metrics.RecordBackendRefresh(address, dialer.RefreshChanged)
+				}
+			}
+			previous = current
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// resolved returns the resolved server addresses, in server order.
+func (c *Client) resolved() []string {
+	var addrs []string
+	c.servers.Each(func(addr net.Addr) error {
+		addrs = append(addrs, addr.String())
+		return nil
+	})
+	return addrs
+}
+
+// Unwrap returns the underlying client, which limiters use.
+func (c *Client) Unwrap() *memcache.Client {
+	return c.Client
+}
+
+// Close stops re-resolving server addresses and closes idle connections.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+	})
+	return c.Client.Close()
+}
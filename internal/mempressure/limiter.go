@@ -0,0 +1,232 @@
+// Package mempressure provides a limiter decorator handling Redis running out of memory: checks Redis rejects with
+// an OOM error are answered by a failure mode, and identifiers whose keys Redis evicted can be denied for a while
+// instead of silently starting over with a fresh budget.
+package mempressure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// Limiter delegates to a Redis limiter, applying the failure mode to checks Redis rejects for lack of memory and
+// the eviction policy to identifiers reported by Evicted.
+type Limiter struct {
+	key      string // Limiter key from config
+	limiter  types.Limiter
+	failOpen bool
+	deny     bool
+	penalty  time.Duration
+
+	mu      sync.Mutex
+	evicted map[string]time.Time // Identifiers denied by the eviction policy, with the end of their penalty
+	swept   int                  // Size of evicted after expired penalties were last dropped
+
+	watchers []*watcher // Watchers reporting evictions to the limiter, guarded by watchersMu
+}
+
+// NewLimiter creates a decorator around limiter handling memory pressure as cfg describes. The deny eviction
+// policy denies evicted identifiers for penalty.
+func NewLimiter(key string, limiter types.Limiter, cfg config.MemoryPressureConfig, penalty time.Duration) *Limiter {
+	return &Limiter{
+		key:      key,
+		limiter:  limiter,
+		failOpen: cfg.OnOOM == config.FailOpen,
+		deny:     cfg.EvictionPolicy == config.EvictionDeny,
+		penalty:  penalty,
+		evicted:  make(map[string]time.Time),
+	}
+}
+
+// IsOOM reports whether err is Redis rejecting a command because it reached maxmemory. Scripts failing on a write
+// report the OOM error within their own error on older Redis releases.
+func IsOOM(err error) bool {
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		return false
+	}
+	msg := redisErr.Error()
+	return strings.HasPrefix(msg, "OOM ") || strings.Contains(msg, "OOM command not allowed")
+}
+
+// Allow checks if a request for the identifier is allowed, unless it is denied by the eviction policy.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	if l.denied(identifier) {
+		return false, nil
+	}
+	allowed, err := l.limiter.Allow(ctx, identifier)
+	return l.outcome(identifier, allowed, err)
+}
+
+// AllowN checks if a request costing n units for the identifier is allowed, unless it is denied by the eviction policy.
+// Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	costLimiter, ok := l.limiter.(types.CostLimiter)
+	if !ok {
+		return l.Allow(ctx, identifier)
+	}
+	if l.denied(identifier) {
+		return false, nil
+	}
+	allowed, err := costLimiter.AllowN(ctx, identifier, n)
+	return l.outcome(identifier, allowed, err)
+}
+
+// AllowAt checks if a request for the identifier is allowed at time t, unless it is denied by the eviction policy.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	timeLimiter, ok := l.limiter.(types.TimeLimiter)
+	if !ok {
+		return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+	}
+	if l.denied(identifier) {
+		return false, nil
+	}
+	allowed, err := timeLimiter.AllowAt(ctx, identifier, t)
+	return l.outcome(identifier, allowed, err)
+}
+
+// AllowKey checks if a request for the composite key is allowed, unless it is denied by the eviction policy.
+func (l *Limiter) AllowKey(ctx context.Context, key types.Key) (bool, error) {
+	identifier := key.String()
+	if l.denied(identifier) {
+		return false, nil
+	}
+	allowed, err := types.AllowKey(ctx, l.limiter, key)
+	return l.outcome(identifier, allowed, err)
+}
+
+// KeyCount returns the key count of the wrapped limiter, and false if it cannot tell.
+func (l *Limiter) KeyCount() (int, bool) {
+	if keyCounter, ok := l.limiter.(types.KeyCounter); ok {
+		return keyCounter.KeyCount()
+	}
+	return 0, false
+}
+
+// Forget drops the identifier's state in the wrapped limiter, along with any penalty of the eviction policy.
+func (l *Limiter) Forget(identifier string) {
+	l.mu.Lock()
+	delete(l.evicted, identifier)
+	l.mu.Unlock()
+	types.Forget(l.limiter, identifier)
+}
+
+// Pressure returns the fraction of the identifier's budget in use in the wrapped limiter.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	return types.Pressure(ctx, l.limiter, identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget is fully restored in the wrapped limiter.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	return types.ResetTime(ctx, l.limiter, identifier)
+}
+
+// Reserve reserves a request costing n units for the identifier in the wrapped limiter, unless it is denied by the
+// eviction policy.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	if l.denied(identifier) {
+		return types.Reservation{}, nil
+	}
+	reservation, err := types.Reserve(ctx, l.limiter, identifier, n, maxWait)
+	if err != nil {
+		allowed, err := l.outcome(identifier, false, err)
+		return types.Reservation{OK: allowed}, err
+	}
+	return reservation, nil
+}
+
+// AllowDetailed checks a request costing n units for the identifier in the wrapped limiter, unless it is denied by the
+// eviction policy, in which case its result carries only the decision.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	if l.denied(identifier) {
+		return types.Result{Limit: -1, Remaining: -1}, nil
+	}
+	result, err := types.AllowDetailed(ctx, l.limiter, identifier, n)
+	if err != nil {
+		allowed, err := l.outcome(identifier, false, err)
+		return types.Result{Allowed: allowed, Limit: -1, Remaining: -1}, err
+	}
+	return result, nil
+}
+
+// Stats returns the requests allowed and denied for the identifier in the wrapped limiter.
+func (l *Limiter) Stats(ctx context.Context, identifier string) (types.IdentifierStats, error) {
+	return types.Stats(ctx, l.limiter, identifier)
+}
+
+// Close stops reporting evictions to the limiter, so a limiter retired by a reload is no longer reachable from the
+// watchers it was registered with. It does not close the wrapped limiter.
+func (l *Limiter) Close() error {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+	for _, w := range l.watchers {
+		w.unregister(l)
+	}
+	l.watchers = nil
+	return nil
+}
+
+// Evicted records that Redis evicted the state of the identifier, denying its requests for the penalty under the
+// deny policy.
+func (l *Limiter) Evicted(identifier string) {
+	metrics.RecordMemoryPressure(l.key, metrics.MemoryPressureEvicted)
+	log.Warn().Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Bool("deny", l.deny).Msg("Limiter: Redis evicted the state of an identifier")
+	if !l.deny {
+		return
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.evicted[identifier] = now.Add(l.penalty)
+	if len(l.evicted) >= 2*max(l.swept, 64) {
+		// Mass evictions grow the map; expired penalties are dropped whenever it doubled
+		for evicted, until := range l.evicted {
+			if !now.Before(until) {
+				delete(l.evicted, evicted)
+			}
+		}
+		l.swept = len(l.evicted)
+	}
+}
+
+// denied reports whether the identifier's requests are denied by the eviction policy.
+func (l *Limiter) denied(identifier string) bool {
+	if !l.deny {
+		return false
+	}
+	l.mu.Lock()
+	until, ok := l.evicted[identifier]
+	if ok && !time.Now().Before(until) {
+		delete(l.evicted, identifier)
+		ok = false
+	}
+	l.mu.Unlock()
+	if ok {
+		metrics.RecordMemoryPressure(l.key, metrics.MemoryPressureDenied)
+	}
+	return ok
+}
+
+// outcome applies the failure mode to a check Redis rejected for lack of memory, returning other outcomes unchanged.
+func (l *Limiter) outcome(identifier string, allowed bool, err error) (bool, error) {
+	if err == nil || !IsOOM(err) {
+		return allowed, err
+	}
+	metrics.RecordMemoryPressure(l.key, metrics.MemoryPressureOOM)
+	log.Warn().Err(err).Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Bool("fail_open", l.failOpen).Msg("Limiter: Redis is out of memory, applying failure mode")
+	if l.failOpen {
+		return true, nil
+	}
+	return false, fmt.Errorf("%w: limiter '%s': %v", types.ErrBackendOutOfMemory, l.key, err)
+}
@@ -0,0 +1,147 @@
+// Package mempressure_test contains tests for the handling of Redis memory pressure.
+package mempressure_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/mempressure"
+	"learn.ratelimiter/internal/testenv"
+	"learn.ratelimiter/types"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testenv.Cleanup()
+	os.Exit(code)
+}
+
+// redisError is an error replied by Redis.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+func (redisError) RedisError()     {}
+
+// failingLimiter returns err from every check, or allows the request if err is nil.
+type failingLimiter struct {
+	err error
+}
+
+func (f *failingLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return f.err == nil, f.err
+}
+
+// TestOOM tests that checks Redis rejects for lack of memory are answered by the failure mode, and other errors returned unchanged.
+func TestOOM(t *testing.T) {
+	oom := fmt.Errorf("run token bucket lua script: %w", redisError("OOM command not allowed when used memory > 'maxmemory'."))
+	backend := &failingLimiter{err: oom}
+
+	closed := mempressure.NewLimiter("test_oom_closed", backend, config.MemoryPressureConfig{}, time.Minute)
+	if allowed, err := closed.Allow(context.Background(), "client1"); allowed || !errors.Is(err, types.ErrBackendOutOfMemory) {
+		t.Errorf("Expected ErrBackendOutOfMemory when failing closed, got (%v, %v)", allowed, err)
+	}
+	open := mempressure.NewLimiter("test_oom_open", backend, config.MemoryPressureConfig{OnOOM: config.FailOpen}, time.Minute)
+	if allowed, err := open.Allow(context.Background(), "client1"); !allowed || err != nil {
+		t.Errorf("Expected the request allowed when failing open, got (%v, %v)", allowed, err)
+	}
+
+	backend.err = errors.New("connection refused")
+	if allowed, err := open.Allow(context.Background(), "client1"); allowed || err != backend.err {
+		t.Errorf("Expected other errors returned unchanged, got (%v, %v)", allowed, err)
+	}
+}
+
+// TestEvictionDeny tests that an evicted identifier is denied for the penalty under the deny policy.
+func TestEvictionDeny(t *testing.T) {
+	cfg := config.MemoryPressureConfig{WatchEvictions: true, EvictionPolicy: config.EvictionDeny}
+	limiter := mempressure.NewLimiter("test_eviction_deny", &failingLimiter{}, cfg, 30*time.Millisecond)
+	ctx := context.Background()
+
+	limiter.Evicted("client1")
+	if allowed, _ := limiter.Allow(ctx, "client1"); allowed {
+		t.Error("Expected the evicted identifier denied during its penalty")
+	}
+	if allowed, _ := limiter.Allow(ctx, "client2"); !allowed {
+		t.Error("Expected other identifiers checked as usual")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if allowed, _ := limiter.Allow(ctx, "client1"); !allowed {
+		t.Error("Expected the evicted identifier checked again once its penalty is over")
+	}
+}
+
+// TestWatch tests that eviction notifications published by Redis reach the limiter owning the evicted key.
+func TestWatch(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cfg := config.MemoryPressureConfig{WatchEvictions: true, EvictionPolicy: config.EvictionDeny}
+	limiter := mempressure.NewLimiter("test_watch", &failingLimiter{}, cfg, time.Minute)
+	other := mempressure.NewLimiter("test_watch:v2", &failingLimiter{}, cfg, time.Minute)
+	mempressure.Watch(client, "test_watch:", limiter)
+	mempressure.Watch(client, "test_watch:v2:", other)
+
+	// Evicting keys takes filling Redis up to maxmemory, so the notification is published as Redis would
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := client.Publish(ctx, "__keyevent@0__:evicted", "test_watch:v2:client1").Err(); err != nil {
+			t.Fatalf("PUBLISH failed: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if allowed, _ := other.Allow(ctx, "client1"); !allowed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the evicted identifier to be denied")
+		}
+	}
+	if allowed, _ := limiter.Allow(ctx, "v2:client1"); !allowed {
+		t.Error("Expected the key reported to the limiter with the longest matching prefix only")
+	}
+}
+
+// TestWatchClose tests that a closed limiter no longer receives the eviction notifications of its keys.
+func TestWatchClose(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cfg := config.MemoryPressureConfig{WatchEvictions: true, EvictionPolicy: config.EvictionDeny}
+	retired := mempressure.NewLimiter("test_watch_close", &failingLimiter{}, cfg, time.Minute)
+	other := mempressure.NewLimiter("test_watch_other", &failingLimiter{}, cfg, time.Minute)
+	mempressure.Watch(client, "test_watch_close:", retired)
+	mempressure.Watch(client, "test_watch_other:", other)
+	if err := retired.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Once the limiter still watching is notified, the closed one would have been too
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for _, key := range []string{"test_watch_close:client1", "test_watch_other:client1"} {
+			if err := client.Publish(ctx, "__keyevent@0__:evicted", key).Err(); err != nil {
+				t.Fatalf("PUBLISH failed: %v", err)
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		if allowed, _ := other.Allow(ctx, "client1"); !allowed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the evicted identifier of the limiter still watching to be denied")
+		}
+	}
+	if allowed, _ := retired.Allow(ctx, "client1"); !allowed {
+		t.Error("Expected the closed limiter not to be notified of evictions")
+	}
+}
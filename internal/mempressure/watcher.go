@@ -0,0 +1,138 @@
+package mempressure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// retryDelay is how long the watcher waits before subscribing again after the subscription failed.
+const retryDelay = time.Second
+
+// watchers holds the eviction watcher of each Redis client, so limiters sharing a client share one subscription.
+// watchersMu also guards the watchers registered with each Limiter.
+var (
+	watchersMu sync.Mutex
+	watchers   = make(map[*redis.Client]*watcher)
+)
+
+// watcher forwards the eviction notifications of a Redis database to the limiters owning the evicted keys.
+type watcher struct {
+	client *redis.Client
+	ctx    context.Context
+	cancel context.CancelFunc // Ends the subscription once no limiter is left
+
+	mu       sync.Mutex
+	limiters map[string]*Limiter // By the prefix of their Redis keys
+}
+
+// Watch reports the keys starting with prefix that Redis evicts from client's database to l, as the identifier
+// following the prefix. It replaces the limiter watching prefix before, e.g., when a configuration reload replaced it.
+// The first call for a client subscribes to its eviction notifications until the client is closed, or until every
+// limiter watching it was closed.
+func Watch(client *redis.Client, prefix string, l *Limiter) {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+	w, ok := watchers[client]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		w = &watcher{client: client, ctx: ctx, cancel: cancel, limiters: make(map[string]*Limiter)}
+		watchers[client] = w
+		go w.run()
+	}
+	w.mu.Lock()
+	w.limiters[prefix] = l
+	w.mu.Unlock()
+	if !slices.Contains(l.watchers, w) {
+		l.watchers = append(l.watchers, w)
+	}
+}
+
+// unregister stops reporting evictions to l, unsubscribing once no limiter is left. The caller holds watchersMu.
+func (w *watcher) unregister(l *Limiter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for prefix, owner := range w.limiters {
+		if owner == l {
+			delete(w.limiters, prefix)
+		}
+	}
+	if len(w.limiters) == 0 {
+		w.cancel()
+		if watchers[w.client] == w {
+			delete(watchers, w.client)
+		}
+	}
+}
+
+// run receives eviction notifications until the client is closed or the last limiter unregistered.
+func (w *watcher) run() {
+	defer func() {
+		watchersMu.Lock()
+		if watchers[w.client] == w {
+			delete(watchers, w.client)
+		}
+		watchersMu.Unlock()
+	}()
+	ctx := w.ctx
+	w.checkNotifications(ctx)
+	channel := fmt.Sprintf("__keyevent@%d__:evicted", w.client.Options().DB)
+	pubsub := w.client.Subscribe(ctx, channel)
+	defer w.cancel()
+	// Receiving blocks regardless of ctx, so the subscription is closed once ctx ends
+	go func() {
+		<-ctx.Done()
+		pubsub.Close()
+	}()
+	for {
+		msg, err := pubsub.ReceiveMessage(ctx)
+		if errors.Is(err, redis.ErrClosed) || ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("channel", channel).Msg("Limiter: Failed to receive Redis eviction notifications, retrying")
+			time.Sleep(retryDelay)
+			continue
+		}
+		w.dispatch(msg.Payload)
+	}
+}
+
+// dispatch reports the evicted key to the limiter with the longest matching prefix, since limiter keys may
+// themselves contain the key separator.
+func (w *watcher) dispatch(key string) {
+	w.mu.Lock()
+	var owner *Limiter
+	var identifier string
+	longest := -1
+	for prefix, l := range w.limiters {
+		if len(prefix) > longest && strings.HasPrefix(key, prefix) {
+			owner, identifier, longest = l, key[len(prefix):], len(prefix)
+		}
+	}
+	w.mu.Unlock()
+	if owner != nil {
+		owner.Evicted(identifier)
+	}
+}
+
+// checkNotifications warns if Redis does not publish eviction notifications. Managed Redis services may not allow
+// reading the configuration, in which case nothing is reported.
+func (w *watcher) checkNotifications(ctx context.Context) {
+	values, err := w.client.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil || len(values) < 2 {
+		log.Debug().Err(err).Msg("Limiter: Could not read notify-keyspace-events, assuming eviction notifications are enabled")
+		return
+	}
+	flags, _ := values[1].(string)
+	if !strings.Contains(flags, "E") || !(strings.Contains(flags, "e") || strings.Contains(flags, "A")) {
+		log.Warn().Str("notify_keyspace_events", flags).Msg("Limiter: Redis does not publish eviction notifications, set notify-keyspace-events to include \"Ee\" to detect evicted limiter keys")
+	}
+}
@@ -0,0 +1,161 @@
+// Package migration provides a limiter decorator checking requests against two backends while limits are moved
+// from one to the other, enforcing the primary's decisions and reporting where the secondary's diverge.
+package migration
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// Limiter applies every check to a primary and a secondary limiter concurrently, so both backends hold the state of
+// every identifier, and returns the primary's decision. Errors of the secondary are logged and counted, never returned.
+// Once the secondary has seen traffic for a full window (or the time to refill a bucket), it holds the same state as
+// the primary and the two can be swapped.
+type Limiter struct {
+	key       string // Limiter key from config
+	primary   types.Limiter
+	secondary types.Limiter
+}
+
+// NewLimiter creates a limiter enforcing primary's decisions while checking secondary too.
+func NewLimiter(key string, primary, secondary types.Limiter) *Limiter {
+	log.Info().Str("limiter_key", key).Msg("Limiter: Checking requests against both backends for migration")
+	return &Limiter{key: key, primary: primary, secondary: secondary}
+}
+
+// Allow checks if a request for the identifier is allowed by the primary, checking it against the secondary too.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.check(ctx, identifier, func(limiter types.Limiter) (bool, error) {
+		return limiter.Allow(ctx, identifier)
+	})
+}
+
+// AllowN checks if a request costing n units for the identifier is allowed by the primary, checking it against the
+// secondary too. Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	return l.check(ctx, identifier, func(limiter types.Limiter) (bool, error) {
+		if costLimiter, ok := limiter.(types.CostLimiter); ok {
+			return costLimiter.AllowN(ctx, identifier, n)
+		}
+		return limiter.Allow(ctx, identifier)
+	})
+}
+
+// AllowAt checks if a request for the identifier is allowed at time t by the primary, checking it against the
+// secondary too.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	if _, ok := l.primary.(types.TimeLimiter); !ok {
+		return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+	}
+	return l.check(ctx, identifier, func(limiter types.Limiter) (bool, error) {
+		timeLimiter, ok := limiter.(types.TimeLimiter)
+		if !ok {
+			return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+		}
+		return timeLimiter.AllowAt(ctx, identifier, t)
+	})
+}
+
+// AllowKey checks if a request for the composite key is allowed by the primary, checking it against the secondary too.
+func (l *Limiter) AllowKey(ctx context.Context, key types.Key) (bool, error) {
+	return l.check(ctx, key.String(), func(limiter types.Limiter) (bool, error) {
+		return types.AllowKey(ctx, limiter, key)
+	})
+}
+
+// AllowDetailed checks a request costing n units for the identifier against both limiters, and returns the primary's
+// result.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	var result types.Result
+	_, err := l.check(ctx, identifier, func(limiter types.Limiter) (bool, error) {
+		detailed, err := types.AllowDetailed(ctx, limiter, identifier, n)
+		if limiter == l.primary {
+			result = detailed
+		}
+		return detailed.Allowed, err
+	})
+	return result, err
+}
+
+// Reserve reserves a request costing n units for the identifier in both limiters, and returns the primary's
+// reservation.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	var reservation types.Reservation
+	_, err := l.check(ctx, identifier, func(limiter types.Limiter) (bool, error) {
+		reserved, err := types.Reserve(ctx, limiter, identifier, n, maxWait)
+		if limiter == l.primary {
+			reservation = reserved
+		}
+		return reserved.OK, err
+	})
+	return reservation, err
+}
+
+// KeyCount returns the key count of the primary, and false if it cannot tell.
+func (l *Limiter) KeyCount() (int, bool) {
+	if keyCounter, ok := l.primary.(types.KeyCounter); ok {
+		return keyCounter.KeyCount()
+	}
+	return 0, false
+}
+
+// Pressure returns the fraction of the identifier's budget in use in the primary.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	return types.Pressure(ctx, l.primary, identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget is fully restored in the primary.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	return types.ResetTime(ctx, l.primary, identifier)
+}
+
+// Stats returns the requests allowed and denied for the identifier in the primary.
+func (l *Limiter) Stats(ctx context.Context, identifier string) (types.IdentifierStats, error) {
+	return types.Stats(ctx, l.primary, identifier)
+}
+
+// Forget drops the identifier's state in both limiters, if they keep it.
+func (l *Limiter) Forget(identifier string) {
+	types.Forget(l.primary, identifier)
+	types.Forget(l.secondary, identifier)
+}
+
+// secondaryResult is the outcome of a check against the secondary.
+type secondaryResult struct {
+	allowed bool
+	err     error
+}
+
+// check applies the check to both limiters concurrently, returns the primary's outcome and records how the
+// secondary's compares.
+func (l *Limiter) check(ctx context.Context, identifier string, apply func(types.Limiter) (bool, error)) (bool, error) {
+	done := make(chan secondaryResult, 1)
+	go func() {
+		allowed, err := apply(l.secondary)
+		done <- secondaryResult{allowed: allowed, err: err}
+	}()
+	allowed, err := apply(l.primary)
+	secondary := <-done
+
+	switch {
+	case secondary.err != nil:
+		metrics.RecordMigrationCheck(l.key, metrics.MigrationSecondaryError)
+		log.Warn().Err(secondary.err).Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Migration secondary check failed")
+	case err != nil:
+		// Only the secondary decided, so there is nothing to compare
+	case allowed == secondary.allowed:
+		metrics.RecordMigrationCheck(l.key, metrics.MigrationAgree)
+	case allowed:
+		metrics.RecordMigrationCheck(l.key, metrics.MigrationPrimaryAllowed)
+	default:
+		metrics.RecordMigrationCheck(l.key, metrics.MigrationPrimaryDenied)
+	}
+	return allowed, err
+}
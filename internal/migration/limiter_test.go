@@ -0,0 +1,88 @@
+// Package migration_test contains tests for checking requests against two backends during a migration.
+package migration_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/internal/migration"
+	"learn.ratelimiter/types"
+)
+
+// failingLimiter fails every check, like an unreachable backend.
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string) (bool, error) {
+	return false, errors.New("backend unreachable")
+}
+
+// TestMigration tests that both backends are charged and the primary's decisions are enforced.
+func TestMigration(t *testing.T) {
+	primary := fcinmemory.NewLimiter("test_migration", time.Minute, 3)
+	secondary := fcinmemory.NewLimiter("test_migration", time.Minute, 1)
+	limiter := migration.NewLimiter("test_migration", primary, secondary)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if allowed, err := limiter.Allow(ctx, "client1"); !allowed || err != nil {
+			t.Fatalf("Expected request %d allowed by the primary, got (%v, %v)", i, allowed, err)
+		}
+	}
+	if allowed, _ := limiter.Allow(ctx, "client1"); allowed {
+		t.Error("Expected request denied once the primary's limit was reached")
+	}
+	if pressure, _ := types.Pressure(ctx, secondary, "client1"); pressure != 1 {
+		t.Errorf("Expected the secondary charged too, pressure %v", pressure)
+	}
+	if pressure, _ := limiter.Pressure(ctx, "client1"); pressure != 1 {
+		t.Errorf("Expected the primary's pressure, got %v", pressure)
+	}
+}
+
+// TestMigrationCutover tests that swapping the backends enforces the state the target built up.
+func TestMigrationCutover(t *testing.T) {
+	current := fcinmemory.NewLimiter("test_migration_cutover", time.Minute, 2)
+	target := fcinmemory.NewLimiter("test_migration_cutover", time.Minute, 2)
+	ctx := context.Background()
+
+	migration.NewLimiter("test_migration_cutover", current, target).Allow(ctx, "client1")
+	cutover := migration.NewLimiter("test_migration_cutover", target, current)
+	if allowed, _ := cutover.Allow(ctx, "client1"); !allowed {
+		t.Fatal("Expected request allowed by the target below the limit")
+	}
+	if allowed, _ := cutover.Allow(ctx, "client1"); allowed {
+		t.Error("Expected request denied by the target, which holds the state written before cutover")
+	}
+}
+
+// TestMigrationSecondaryError tests that errors of the secondary are not returned.
+func TestMigrationSecondaryError(t *testing.T) {
+	primary := fcinmemory.NewLimiter("test_migration_error", time.Minute, 1)
+	limiter := migration.NewLimiter("test_migration_error", primary, failingLimiter{})
+	if allowed, err := limiter.Allow(context.Background(), "client1"); !allowed || err != nil {
+		t.Errorf("Expected the primary's decision despite the secondary failing, got (%v, %v)", allowed, err)
+	}
+}
+
+// TestMigrationDetailed tests that detailed checks and reservations charge both backends and return the primary's
+// outcome.
+func TestMigrationDetailed(t *testing.T) {
+	primary := fcinmemory.NewLimiter("test_migration_detailed", time.Minute, 3)
+	secondary := fcinmemory.NewLimiter("test_migration_detailed", time.Minute, 2)
+	limiter := migration.NewLimiter("test_migration_detailed", primary, secondary)
+	ctx := context.Background()
+
+	result, err := limiter.AllowDetailed(ctx, "client1", 2)
+	if err != nil || !result.Allowed || result.Limit != 3 || result.Remaining != 1 {
+		t.Errorf("Expected the primary's result with 1 of 3 remaining, got %+v, %v", result, err)
+	}
+	if reservation, err := limiter.Reserve(ctx, "client1", 1, 0); err != nil || !reservation.OK {
+		t.Errorf("Expected the reservation admitted by the primary, got %+v, %v", reservation, err)
+	}
+	if pressure, _ := types.Pressure(ctx, secondary, "client1"); pressure != 1 {
+		t.Errorf("Expected the secondary charged too, pressure %v", pressure)
+	}
+}
@@ -0,0 +1,186 @@
+// Package override provides a limiter that applies per-identifier overrides by sending overridden identifiers
+// to a limiter with scaled parameters.
+package override
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/overrides"
+	"learn.ratelimiter/types"
+)
+
+// evictInterval bounds how often scaled limiters whose multiplier is no longer in use are looked for.
+const evictInterval = time.Minute
+
+// Builder creates the limiter enforcing the limiter's parameters multiplied by multiplier.
+type Builder func(multiplier float64) (types.Limiter, error)
+
+// Limiter checks identifiers with an active override against a limiter built for the override's multiplier,
+// and all other identifiers against the base limiter. Scaled limiters keep their state under their own key,
+// so an identifier starts with a fresh budget when its override is applied or reverts. Scaled limiters are released
+// once no active override uses their multiplier.
+type Limiter struct {
+	key   string // Limiter key from config
+	base  types.Limiter
+	table *overrides.Table
+	build Builder
+
+	// scaled holds the limiter for each multiplier in use, created on first use.
+	scaled sync.Map
+	// mu serializes the creation and eviction of scaled limiters.
+	mu sync.Mutex
+	// evicted is when scaled limiters were last looked for eviction, in Unix nanoseconds.
+	evicted atomic.Int64
+}
+
+// NewLimiter creates a limiter applying the overrides in table for the limiter key, using build to create scaled limiters.
+func NewLimiter(key string, base types.Limiter, table *overrides.Table, build Builder) *Limiter {
+	return &Limiter{key: key, base: base, table: table, build: build}
+}
+
+// Allow checks if a request for the given identifier is allowed, taking its override into account.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.limiter(identifier).Allow(ctx, identifier)
+}
+
+// AllowN checks if a request costing n units for the given identifier is allowed, taking its override into account.
+// Limiters that do not support AllowN can only be charged a single unit; other costs return an error.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	if err := types.CheckCost(n); err != nil {
+		return false, err
+	}
+	limiter := l.limiter(identifier)
+	if costLimiter, ok := limiter.(types.CostLimiter); ok {
+		return costLimiter.AllowN(ctx, identifier, n)
+	}
+	if n != 1 {
+		return false, fmt.Errorf("limiter '%s' does not support AllowN", l.key)
+	}
+	return limiter.Allow(ctx, identifier)
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t, taking its current override into account.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	if timeLimiter, ok := l.limiter(identifier).(types.TimeLimiter); ok {
+		return timeLimiter.AllowAt(ctx, identifier, t)
+	}
+	return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+}
+
+// KeyCount returns the number of identifiers with state in the base and scaled limiters, and false if any of them cannot tell.
+// An identifier whose override changed is counted by each limiter holding state for it.
+func (l *Limiter) KeyCount() (int, bool) {
+	total, known := keyCount(l.base)
+	l.scaled.Range(func(_, scaled interface{}) bool {
+		count, ok := keyCount(scaled.(types.Limiter))
+		total += count
+		known = known && ok
+		return known
+	})
+	return total, known
+}
+
+// Forget drops the identifier's state in the base and scaled limiters.
+func (l *Limiter) Forget(identifier string) {
+	types.Forget(l.base, identifier)
+	l.scaled.Range(func(_, scaled interface{}) bool {
+		types.Forget(scaled.(types.Limiter), identifier)
+		return true
+	})
+}
+
+// Pressure returns the fraction of the identifier's budget in use, in the limiter for its current override.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	return types.Pressure(ctx, l.limiter(identifier), identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget is fully restored in the limiter for its current override.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	return types.ResetTime(ctx, l.limiter(identifier), identifier)
+}
+
+// Reserve reserves a request costing n units in the limiter applying to the identifier.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	return types.Reserve(ctx, l.limiter(identifier), identifier, n, maxWait)
+}
+
+// AllowDetailed checks a request costing n units in the limiter applying to the identifier, with its result.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	return types.AllowDetailed(ctx, l.limiter(identifier), identifier, n)
+}
+
+// keyCount returns the limiter's key count if it implements types.KeyCounter.
+func keyCount(limiter types.Limiter) (int, bool) {
+	if keyCounter, ok := limiter.(types.KeyCounter); ok {
+		return keyCounter.KeyCount()
+	}
+	return 0, false
+}
+
+// limiter returns the limiter for the identifier's override, or the base limiter if it has none
+// or the scaled limiter cannot be created.
+func (l *Limiter) limiter(identifier string) types.Limiter {
+	l.evictUnused(time.Now())
+	multiplier, ok := l.table.Multiplier(l.key, identifier)
+	if !ok {
+		return l.base
+	}
+	if scaled, ok := l.scaled.Load(multiplier); ok {
+		return scaled.(types.Limiter)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if scaled, ok := l.scaled.Load(multiplier); ok {
+		return scaled.(types.Limiter)
+	}
+	// A multiplier coming into use is the usual sign of an edited override, whose previous multiplier may be unused now
+	l.evictUnusedLocked()
+	scaled, err := l.build(multiplier)
+	if err != nil {
+		log.Error().Err(err).Str("limiter_key", l.key).Float64("multiplier", multiplier).Msg("Limiter: Failed to create limiter for override, using the base limiter")
+		return l.base
+	}
+	l.scaled.Store(multiplier, scaled)
+	log.Info().Str("limiter_key", l.key).Float64("multiplier", multiplier).Msg("Limiter: Created limiter for override")
+	return scaled
+}
+
+// evictUnused releases the scaled limiters whose multiplier no active override uses, at most once per evictInterval,
+// so overrides that were removed or expired do not keep their limiters.
+func (l *Limiter) evictUnused(now time.Time) {
+	last := l.evicted.Load()
+	if now.UnixNano()-last < int64(evictInterval) || !l.evicted.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.evictUnusedLocked()
+}
+
+// evictUnusedLocked releases the scaled limiters whose multiplier no active override uses, closing those implementing
+// io.Closer. The caller must hold mu.
+func (l *Limiter) evictUnusedLocked() {
+	inUse := l.table.Multipliers(l.key)
+	l.scaled.Range(func(key, scaled interface{}) bool {
+		multiplier := key.(float64)
+		if inUse[multiplier] {
+			return true
+		}
+		l.scaled.Delete(multiplier)
+		if closer, ok := scaled.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Warn().Err(err).Str("limiter_key", l.key).Float64("multiplier", multiplier).Msg("Limiter: Failed to close limiter for override")
+			}
+		}
+		log.Info().Str("limiter_key", l.key).Float64("multiplier", multiplier).Msg("Limiter: Released limiter for override no longer in use")
+		return true
+	})
+}
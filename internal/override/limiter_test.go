@@ -0,0 +1,72 @@
+// Package override_test contains tests for the override limiter.
+package override_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/internal/override"
+	"learn.ratelimiter/overrides"
+	"learn.ratelimiter/types"
+)
+
+// closingLimiter allows every request and records whether it was closed. It does not support AllowN.
+type closingLimiter struct {
+	closed bool
+}
+
+func (l *closingLimiter) Allow(context.Context, string) (bool, error) { return true, nil }
+
+func (l *closingLimiter) Close() error {
+	l.closed = true
+	return nil
+}
+
+// TestScaledLimiterEviction tests that the limiter of a multiplier no longer used by any override is released.
+func TestScaledLimiterEviction(t *testing.T) {
+	table := overrides.NewTable(overrides.NewMemoryStore(), time.Hour)
+	defer table.Close()
+	built := make(map[float64]*closingLimiter)
+	limiter := override.NewLimiter("api", &closingLimiter{}, table, func(multiplier float64) (types.Limiter, error) {
+		built[multiplier] = &closingLimiter{}
+		return built[multiplier], nil
+	})
+
+	ctx := context.Background()
+	table.Set(ctx, overrides.Override{LimiterKey: "api", Identifier: "customer-x", Multiplier: 5})
+	limiter.Allow(ctx, "customer-x")
+	table.Set(ctx, overrides.Override{LimiterKey: "api", Identifier: "customer-x", Multiplier: 3})
+	limiter.Allow(ctx, "customer-x")
+
+	if built[5] == nil || built[3] == nil {
+		t.Fatalf("Expected limiters built for multipliers 5 and 3, got %v", built)
+	}
+	if !built[5].closed {
+		t.Error("Expected the limiter of the edited override's previous multiplier to be closed")
+	}
+	if built[3].closed {
+		t.Error("Expected the limiter of the multiplier in use to be kept")
+	}
+}
+
+// TestAllowNWithoutCostSupport tests that costs other than one unit are refused rather than charged a single unit.
+func TestAllowNWithoutCostSupport(t *testing.T) {
+	table := overrides.NewTable(overrides.NewMemoryStore(), time.Hour)
+	defer table.Close()
+	limiter := override.NewLimiter("api", &closingLimiter{}, table, func(float64) (types.Limiter, error) {
+		return &closingLimiter{}, nil
+	})
+
+	ctx := context.Background()
+	if allowed, err := limiter.AllowN(ctx, "customer-x", 1); !allowed || err != nil {
+		t.Errorf("Expected a single unit to be charged, got (%v, %v)", allowed, err)
+	}
+	if allowed, err := limiter.AllowN(ctx, "customer-x", 5); allowed || err == nil {
+		t.Errorf("Expected an error for a cost of 5, got (%v, %v)", allowed, err)
+	}
+	if _, err := limiter.AllowN(ctx, "customer-x", 0); !errors.Is(err, types.ErrInvalidCost) {
+		t.Errorf("Expected ErrInvalidCost for a cost of 0, got %v", err)
+	}
+}
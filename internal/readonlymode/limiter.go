@@ -0,0 +1,151 @@
+// Package readonlymode provides a limiter decorator answering checks without writing to the backend while the
+// limiter is in read-only mode (see package readonly).
+package readonlymode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/readonly"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// Limiter delegates to a limiter unless the switch puts it in read-only mode. Read-only checks only read the
+// identifier's budget (see types.Pressure) and deny the request if it is exhausted, so requests are not counted:
+// identifiers below their limit when read-only mode starts stay allowed until it ends, whatever their rate.
+// Checks of limiters that cannot tell their budget, or whose read fails, are allowed.
+type Limiter struct {
+	key     string // Limiter key from config
+	limiter types.Limiter
+	sw      *readonly.Switch
+}
+
+// NewLimiter creates a decorator around limiter applying the read-only mode the switch sets for key.
+func NewLimiter(key string, limiter types.Limiter, sw *readonly.Switch) *Limiter {
+	return &Limiter{key: key, limiter: limiter, sw: sw}
+}
+
+// Allow checks if a request for the identifier is allowed.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	if l.sw.Active(l.key) {
+		return l.evaluate(ctx, identifier), nil
+	}
+	return l.limiter.Allow(ctx, identifier)
+}
+
+// AllowN checks if a request costing n units for the identifier is allowed. In read-only mode, it is allowed
+// unless the budget is exhausted, whatever n. Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	if err := types.CheckCost(n); err != nil {
+		return false, err
+	}
+	if l.sw.Active(l.key) {
+		return l.evaluate(ctx, identifier), nil
+	}
+	if costLimiter, ok := l.limiter.(types.CostLimiter); ok {
+		return costLimiter.AllowN(ctx, identifier, n)
+	}
+	return l.limiter.Allow(ctx, identifier)
+}
+
+// AllowAt checks if a request for the identifier is allowed at time t. In read-only mode, the budget is read at
+// the current time.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	timeLimiter, ok := l.limiter.(types.TimeLimiter)
+	if !ok {
+		return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+	}
+	if l.sw.Active(l.key) {
+		return l.evaluate(ctx, identifier), nil
+	}
+	return timeLimiter.AllowAt(ctx, identifier, t)
+}
+
+// AllowKey checks if a request for the composite key is allowed.
+func (l *Limiter) AllowKey(ctx context.Context, key types.Key) (bool, error) {
+	if l.sw.Active(l.key) {
+		return l.evaluate(ctx, key.String()), nil
+	}
+	return types.AllowKey(ctx, l.limiter, key)
+}
+
+// KeyCount returns the key count of the wrapped limiter, and false if it cannot tell.
+func (l *Limiter) KeyCount() (int, bool) {
+	if keyCounter, ok := l.limiter.(types.KeyCounter); ok {
+		return keyCounter.KeyCount()
+	}
+	return 0, false
+}
+
+// Forget drops the identifier's state in the wrapped limiter, in read-only mode too.
+func (l *Limiter) Forget(identifier string) {
+	types.Forget(l.limiter, identifier)
+}
+
+// Pressure returns the fraction of the identifier's budget in use in the wrapped limiter.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	return types.Pressure(ctx, l.limiter, identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget is fully restored in the wrapped limiter.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	return types.ResetTime(ctx, l.limiter, identifier)
+}
+
+// Reserve reserves a request costing n units for the identifier. In read-only mode nothing is reserved: the request
+// is admitted without delay unless the budget is exhausted, like AllowN.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Reservation{}, err
+	}
+	if l.sw.Active(l.key) {
+		return types.Reservation{OK: l.evaluate(ctx, identifier)}, nil
+	}
+	return types.Reserve(ctx, l.limiter, identifier, n, maxWait)
+}
+
+// AllowDetailed checks a request costing n units for the identifier with its result. In read-only mode nothing is
+// charged, and the result carries only the decision, like AllowN's.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
+	if l.sw.Active(l.key) {
+		return types.Result{Allowed: l.evaluate(ctx, identifier), Limit: -1, Remaining: -1}, nil
+	}
+	return types.AllowDetailed(ctx, l.limiter, identifier, n)
+}
+
+// Stats returns the requests allowed and denied for the identifier in the wrapped limiter.
+func (l *Limiter) Stats(ctx context.Context, identifier string) (types.IdentifierStats, error) {
+	return types.Stats(ctx, l.limiter, identifier)
+}
+
+// History returns the latest decisions for the identifier in the wrapped limiter.
+func (l *Limiter) History(ctx context.Context, identifier string) ([]types.Decision, error) {
+	return types.History(ctx, l.limiter, identifier)
+}
+
+// evaluate decides a request in read-only mode from the identifier's budget, without writing it.
+func (l *Limiter) evaluate(ctx context.Context, identifier string) bool {
+	pressure, err := types.Pressure(ctx, l.limiter, identifier)
+	if err != nil {
+		if !errors.Is(err, types.ErrPressureUnsupported) {
+			log.Warn().Err(err).Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to read budget in read-only mode, allowing request")
+		}
+		metrics.RecordReadOnlyCheck(l.key, metrics.ReadOnlyUnevaluated)
+		return true
+	}
+	if pressure >= 1 {
+		metrics.RecordReadOnlyCheck(l.key, metrics.ReadOnlyDenied)
+		return false
+	}
+	metrics.RecordReadOnlyCheck(l.key, metrics.ReadOnlyAllowed)
+	return true
+}
@@ -0,0 +1,40 @@
+// Package readonlymode_test contains tests for answering checks in read-only mode.
+package readonlymode_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/internal/readonlymode"
+	"learn.ratelimiter/readonly"
+	"learn.ratelimiter/types"
+)
+
+// TestReadOnly tests that read-only checks are decided from the current state without counting requests.
+func TestReadOnly(t *testing.T) {
+	base := fcinmemory.NewLimiter("test_read_only", time.Minute, 2)
+	sw := readonly.New()
+	defer sw.Close()
+	limiter := readonlymode.NewLimiter("test_read_only", base, sw)
+	ctx := context.Background()
+
+	limiter.Allow(ctx, "client1")
+	sw.Set(readonly.Entry{LimiterKey: "test_read_only"})
+	for i := 0; i < 5; i++ {
+		if allowed, err := limiter.Allow(ctx, "client1"); !allowed || err != nil {
+			t.Fatalf("Expected read-only check %d allowed below the limit, got (%v, %v)", i, allowed, err)
+		}
+	}
+	if pressure, _ := types.Pressure(ctx, base, "client1"); pressure != 0.5 {
+		t.Errorf("Expected read-only checks not to be counted, pressure %v", pressure)
+	}
+
+	sw.Clear("test_read_only")
+	limiter.Allow(ctx, "client1")
+	sw.Set(readonly.Entry{LimiterKey: readonly.Global})
+	if allowed, _ := limiter.Allow(ctx, "client1"); allowed {
+		t.Error("Expected read-only checks denied once the limit was reached")
+	}
+}
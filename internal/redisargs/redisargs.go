@@ -0,0 +1,39 @@
+// Package redisargs reuses the key and argument slices passed to Redis scripts, so limiter checks do not allocate
+// them on every call. go-redis copies both into the command it builds, so they may be reused once Run returns.
+package redisargs
+
+import "sync"
+
+// Args holds the keys and arguments of one script call.
+type Args struct {
+	Keys   []string
+	Values []interface{}
+}
+
+var pool = sync.Pool{
+	New: func() interface{} {
+		return &Args{Keys: make([]string, 0, 1), Values: make([]interface{}, 0, 8)}
+	},
+}
+
+// Get returns Args from the pool holding the given keys and no arguments. Call Release once the script has run.
+func Get(keys ...string) *Args {
+	a := pool.Get().(*Args)
+	a.Keys = append(a.Keys, keys...)
+	return a
+}
+
+// Add appends values to the arguments and returns a for chaining.
+func (a *Args) Add(values ...interface{}) *Args {
+	a.Values = append(a.Values, values...)
+	return a
+}
+
+// Release empties a and returns it to the pool. a must not be used afterwards.
+func (a *Args) Release() {
+	// Clear the references, so pooled slices do not keep keys and values alive
+	clear(a.Keys)
+	clear(a.Values)
+	a.Keys, a.Values = a.Keys[:0], a.Values[:0]
+	pool.Put(a)
+}
@@ -0,0 +1,37 @@
+// Package redisargs_test contains tests for the pooled Redis script arguments.
+package redisargs_test
+
+import (
+	"testing"
+
+	"learn.ratelimiter/internal/redisargs"
+)
+
+// TestArgs tests that Args hold the keys and values added, and start empty after being released.
+func TestArgs(t *testing.T) {
+	args := redisargs.Get("limiter:user1").Add(int64(1000), 5, "x")
+	if len(args.Keys) != 1 || args.Keys[0] != "limiter:user1" {
+		t.Errorf("Expected keys [limiter:user1], got %v", args.Keys)
+	}
+	if len(args.Values) != 3 || args.Values[0] != int64(1000) || args.Values[1] != 5 || args.Values[2] != "x" {
+		t.Errorf("Expected values [1000 5 x], got %v", args.Values)
+	}
+	args.Release()
+
+	args = redisargs.Get()
+	defer args.Release()
+	if len(args.Keys) != 0 || len(args.Values) != 0 {
+		t.Errorf("Expected empty args from the pool, got keys %v and values %v", args.Keys, args.Values)
+	}
+}
+
+// TestArgsDoNotAllocate tests that reused Args allocate nothing for small arguments.
+func TestArgsDoNotAllocate(t *testing.T) {
+	key := "limiter:user1"
+	redisargs.Get(key).Add(1, 2).Release()
+	if allocs := testing.AllocsPerRun(1000, func() {
+		redisargs.Get(key).Add(1, 2, 3, 4, 5).Release()
+	}); allocs != 0 {
+		t.Errorf("Expected reused Args not to allocate, got %v allocations per call", allocs)
+	}
+}
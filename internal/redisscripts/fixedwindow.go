@@ -0,0 +1,157 @@
+package redisscripts
+
+// FixedWindowAllow is the Lua script for the Fixed Window Counter algorithm.
+// KEYS[1]: The Redis key for the counter (e.g., "rate_limit:api:user123")
+// ARGV[1]: Current timestamp in milliseconds
+// ARGV[2]: Window duration in milliseconds
+// ARGV[3]: Limit
+// ARGV[4]: Expiry time for the key in seconds (should be >= window duration)
+// ARGV[5]: Cost of the request (usually 1)
+// ARGV[6]: Schema version to write (see redisstate)
+// ARGV[7]: Fraction of the limit available at the start of the window; the rest is released linearly over the window (1 disables pacing)
+// ARGV[8]: 1 if requests beyond the released budget are delayed instead of denied
+// ARGV[9]: 1 if windows start at the key's first request after the previous window ended (kept in the 'ws' field, the
+// window including its end) instead of at multiples of the window duration
+// Returns {allowed, status, wait_ms, window_start_ms, count}: allowed is 1 if the request is allowed, 0 if denied, and status is a redisstate status.
+// wait_ms is how long until enough budget is released for a request beyond the paced budget: an admitted request must wait that long
+// before proceeding (its budget is reserved), and a denied one could retry then. It is 0 if the window's whole budget is spent.
+// window_start_ms is the start of the window the request was counted in, and count is the window's count after the decision.
+// Denied requests do not consume budget.
+// The latest timestamp seen is kept in the 'ts' field so earlier timestamps are treated as the latest one.
+// Unversioned state uses the same fields, so upgrading only adds the 'v' field.
+var FixedWindowAllow = newScript("fixed_window_allow", `
+	local key = KEYS[1]
+	local now_ms = tonumber(ARGV[1])
+	local window_ms = tonumber(ARGV[2])
+	local limit = tonumber(ARGV[3])
+	local expiry_sec = tonumber(ARGV[4])
+	local cost = tonumber(ARGV[5]) or 1
+	local schema_version = tonumber(ARGV[6])
+	local burst_fraction = tonumber(ARGV[7]) or 1
+	local delay = ARGV[8] == '1'
+	local first_request = ARGV[9] == '1'
+
+	-- Leave state written by a newer release untouched
+	local status = 0
+	local stored_version = tonumber(redis.call('HGET', key, 'v'))
+	if stored_version == nil then
+		if redis.call('EXISTS', key) == 1 then
+			status = 1
+		end
+	elseif stored_version > schema_version then
+		return {0, 2, 0, 0, 0}
+	end
+
+	-- Never let time move backwards for this key
+	local last_ts = tonumber(redis.call('HGET', key, 'ts'))
+	if last_ts and now_ms < last_ts then
+		now_ms = last_ts
+	end
+	redis.call('HSET', key, 'ts', now_ms, 'v', schema_version)
+
+	local window_start_ms
+	if first_request then
+		window_start_ms = tonumber(redis.call('HGET', key, 'ws'))
+		if window_start_ms == nil or now_ms > window_start_ms + window_ms then
+			if window_start_ms then
+				redis.call('HDEL', key, tostring(window_start_ms))
+			end
+			window_start_ms = now_ms
+			redis.call('HSET', key, 'ws', window_start_ms)
+		end
+	else
+		window_start_ms = math.floor(now_ms / window_ms) * window_ms
+	end
+
+	local field = tostring(window_start_ms)
+
+	local count = redis.call('HINCRBY', key, field, cost)
+
+	if count == cost then
+		redis.call('EXPIRE', key, expiry_sec)
+	end
+
+	if count > limit then
+		-- Refund the cost so a denied request does not consume budget
+		redis.call('HINCRBY', key, field, -cost)
+		return {0, status, 0, window_start_ms, count - cost}
+	end
+
+	if burst_fraction < 1 then
+		-- Budget released so far: the burst fraction plus a linear share of the rest (at least one unit)
+		local elapsed_ms = now_ms - window_start_ms
+		local allowance = math.floor(limit * (burst_fraction + (1 - burst_fraction) * elapsed_ms / window_ms) + 1e-9)
+		if allowance < 1 then
+			allowance = 1
+		end
+		if count > allowance then
+			local released_at_ms = math.ceil((count / limit - burst_fraction) / (1 - burst_fraction) * window_ms)
+			local wait_ms = math.max(released_at_ms - elapsed_ms, 1)
+			if delay then
+				return {1, status, wait_ms, window_start_ms, count}
+			end
+			redis.call('HINCRBY', key, field, -cost)
+			return {0, status, wait_ms, window_start_ms, count - cost}
+		end
+	end
+
+	return {1, status, 0, window_start_ms, count}
+`)
+
+// FixedWindowCompositeAllow is the Lua script for a composite of Fixed Window Counter limits that must all allow a request.
+// Every limit is checked before any is updated, so the request consumes budget from all limits or from none.
+// KEYS[i]: The Redis key for the counter of limit i, laid out as for FixedWindowAllow
+// ARGV[1]: Current timestamp in milliseconds
+// ARGV[2]: Cost of the request (usually 1)
+// ARGV[3]: Schema version to write (see redisstate)
+// ARGV[4+3*(i-1)], ARGV[5+3*(i-1)], ARGV[6+3*(i-1)]: Window duration in milliseconds, limit and expiry in seconds of limit i
+// Returns {allowed, status, limit}: allowed is 1 if every limit allows the request, status is a redisstate status,
+// and limit is the 1-based index of the first limit that denied it (0 if allowed).
+// Denied requests leave all counters untouched.
+var FixedWindowCompositeAllow = newScript("fixed_window_composite_allow", `
+	local now_ms = tonumber(ARGV[1])
+	local cost = tonumber(ARGV[2]) or 1
+	local schema_version = tonumber(ARGV[3])
+
+	local status = 0
+	local fields = {}
+	local times = {}
+	for i, key in ipairs(KEYS) do
+		local window_ms = tonumber(ARGV[4 + 3 * (i - 1)])
+		local limit = tonumber(ARGV[5 + 3 * (i - 1)])
+
+		-- Leave state written by a newer release untouched
+		local state = redis.call('HMGET', key, 'v', 'ts')
+		local stored_version = tonumber(state[1])
+		if stored_version == nil then
+			if redis.call('EXISTS', key) == 1 then
+				status = 1
+			end
+		elseif stored_version > schema_version then
+			return {0, 2, i}
+		end
+
+		-- Never let time move backwards for this key
+		local key_now_ms = now_ms
+		local last_ts = tonumber(state[2])
+		if last_ts and key_now_ms < last_ts then
+			key_now_ms = last_ts
+		end
+		times[i] = key_now_ms
+
+		local field = tostring(math.floor(key_now_ms / window_ms) * window_ms)
+		fields[i] = field
+		local count = tonumber(redis.call('HGET', key, field)) or 0
+		if count + cost > limit then
+			return {0, status, i}
+		end
+	end
+
+	for i, key in ipairs(KEYS) do
+		redis.call('HSET', key, 'ts', times[i], 'v', schema_version)
+		if redis.call('HINCRBY', key, fields[i], cost) == cost then
+			redis.call('EXPIRE', key, tonumber(ARGV[6 + 3 * (i - 1)]))
+		end
+	end
+	return {1, status, 0}
+`)
@@ -0,0 +1,74 @@
+package redisscripts
+
+// LeakyBucketAllow is the Lua script used by the Redis Leaky Bucket to atomically leak, check and fill the bucket.
+// Its arguments and result are described at its top.
+var LeakyBucketAllow = newScript("leaky_bucket_allow", `
+-- KEYS[1]: The key for the bucket state (e.g., leaky_bucket:limiter_key:identifier)
+-- ARGV[1]: Capacity of the bucket
+-- ARGV[2]: Leak rate (tokens per second)
+-- ARGV[3]: Current timestamp in milliseconds
+-- ARGV[4]: Cost of the request (usually 1)
+-- ARGV[5]: Schema version to write (see redisstate)
+-- Returns {allowed, status, remaining, reset_ms, retry_ms}, where status is a redisstate status, remaining is the
+-- whole units the bucket has room for, reset_ms is the time until it is empty, and retry_ms is the time until it has
+-- leaked enough for a denied request (0 if allowed or if it never can)
+
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4]) or 1
+local schemaVersion = tonumber(ARGV[5])
+
+local res = redis.call('GET', KEYS[1])
+
+local currentLevel = 0
+local lastLeak = now
+local status = 0
+
+if res then
+    local state = cjson.decode(res)
+    -- Leave state written by a newer release untouched; unversioned state shares this layout and only gains the version
+    local storedVersion = tonumber(state['v'])
+    if storedVersion == nil then
+        status = 1
+    elseif storedVersion > schemaVersion then
+        return {0, 2, 0, 0, 0}
+    end
+    currentLevel = tonumber(state['currentLevel'])
+    lastLeak = tonumber(state['lastLeak'])
+end
+
+-- Never let time move backwards for this bucket
+if now < lastLeak then
+    now = lastLeak
+end
+
+local elapsed = (now - lastLeak) / 1000 -- elapsed time in seconds
+local leakedAmount = elapsed * rate
+
+currentLevel = math.max(0, currentLevel - leakedAmount)
+
+local allowed = false
+if currentLevel + cost <= capacity then
+    currentLevel = currentLevel + cost
+    allowed = true
+end
+
+lastLeak = now
+
+local newState = cjson.encode({currentLevel = currentLevel, lastLeak = lastLeak, v = schemaVersion})
+redis.call('SET', KEYS[1], newState)
+
+local remaining = math.max(math.floor(capacity - currentLevel), 0)
+local resetMs = math.ceil(currentLevel / rate * 1000)
+local retryMs = 0
+if not allowed and cost <= capacity then
+    retryMs = math.ceil((currentLevel + cost - capacity) / rate * 1000)
+end
+
+if allowed then
+    return {1, status, remaining, resetMs, retryMs}
+else
+    return {0, status, remaining, resetMs, retryMs}
+end
+`)
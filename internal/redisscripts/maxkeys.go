@@ -0,0 +1,27 @@
+package redisscripts
+
+// MaxKeysAdmit counts an identifier in the HyperLogLog estimating the distinct identifiers of a limiter in a window,
+// unless it is new and the estimate has reached the cap. Identifiers are tested against a copy once the cap is reached,
+// so rejected identifiers do not grow the estimate.
+// KEYS[1]: HyperLogLog of the identifiers seen in the window
+// KEYS[2]: Scratch key in the same slot as KEYS[1], deleted before returning
+// ARGV[1]: Identifier
+// ARGV[2]: Maximum number of distinct identifiers
+// ARGV[3]: Expiry of the HyperLogLog in milliseconds, set when the window's first identifier is counted
+// Returns 1 if the identifier is counted within the cap, 0 if it is new and the cap is reached.
+var MaxKeysAdmit = newScript("max_keys_admit", `
+local count = redis.call('PFCOUNT', KEYS[1])
+if count < tonumber(ARGV[2]) then
+	redis.call('PFADD', KEYS[1], ARGV[1])
+	if count == 0 then
+		redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	end
+	return 1
+end
+
+-- Identifiers already counted leave the estimate unchanged
+redis.call('PFMERGE', KEYS[2], KEYS[1])
+local added = redis.call('PFADD', KEYS[2], ARGV[1])
+redis.call('DEL', KEYS[2])
+return 1 - added
+`)
@@ -0,0 +1,9 @@
+package redisscripts
+
+// OverridesDeleteIfUnchanged deletes a hash field only if it still holds the given value.
+var OverridesDeleteIfUnchanged = newScript("overrides_delete_if_unchanged", `
+if redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return 0
+`)
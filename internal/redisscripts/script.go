@@ -0,0 +1,82 @@
+// Package redisscripts holds the Lua scripts run by the Redis backends, so limiters, stores and tests share one
+// definition of each script and its hash.
+//
+// Scripts run by hash and are only sent in full when the server's script cache does not hold them yet, e.g., after a
+// restart or SCRIPT FLUSH. Every run and every full load is recorded in the metrics package under the script's name.
+package redisscripts
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/metrics"
+)
+
+// Script is a named Lua script cached by the server under its SHA1 hash.
+type Script struct {
+	name   string
+	script *redis.Script
+}
+
+// scripts lists every script defined by the package, in definition order, for LoadAll.
+var scripts []*Script
+
+// newScript defines the script src under name, which labels its metrics.
+func newScript(name, src string) *Script {
+	s := &Script{name: name, script: redis.NewScript(src)}
+	scripts = append(scripts, s)
+	return s
+}
+
+// All returns the scripts defined by the package.
+func All() []*Script {
+	return append([]*Script(nil), scripts...)
+}
+
+// Name returns the name labelling the script's metrics.
+func (s *Script) Name() string {
+	return s.name
+}
+
+// Hash returns the SHA1 hash the server caches the script under.
+func (s *Script) Hash() string {
+	return s.script.Hash()
+}
+
+// Load sends the script to the server's script cache.
+func (s *Script) Load(ctx context.Context, c redis.Scripter) error {
+	if err := s.script.Load(ctx, c).Err(); err != nil {
+		return err
+	}
+	metrics.RecordRedisScriptLoad(s.name, metrics.RedisScriptPreload)
+	return nil
+}
+
+// Run runs the script by hash, sending it in full if the server does not have it cached.
+func (s *Script) Run(ctx context.Context, c redis.Scripter, keys []string, args ...interface{}) *redis.Cmd {
+	cmd := s.script.EvalSha(ctx, c, keys, args...)
+	if err := cmd.Err(); err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		metrics.RecordRedisScriptLoad(s.name, metrics.RedisScriptNoScript)
+		cmd = s.script.Eval(ctx, c, keys, args...)
+	}
+	err := cmd.Err()
+	if err == redis.Nil {
+		err = nil
+	}
+	metrics.RecordRedisScriptRun(s.name, err)
+	return cmd
+}
+
+// LoadAll sends every script defined by the package to the server's script cache, so the first run of each does
+// not have to send it in full.
+func LoadAll(ctx context.Context, c redis.Scripter) error {
+	for _, s := range scripts {
+		if err := s.Load(ctx, c); err != nil {
+			return fmt.Errorf("load redis script %s: %w", s.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Package redisscripts_test contains tests for the shared Redis Lua scripts.
+package redisscripts_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/internal/redisscripts"
+	"learn.ratelimiter/internal/testenv"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testenv.Cleanup()
+	os.Exit(code)
+}
+
+// setupRedisClient returns a client for the Redis server provided by testenv.
+func setupRedisClient(t *testing.T) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// TestScriptsDistinct tests that every script has its own name and hash, since both identify it.
+func TestScriptsDistinct(t *testing.T) {
+	names := make(map[string]bool)
+	hashes := make(map[string]bool)
+	for _, s := range redisscripts.All() {
+		if names[s.Name()] {
+			t.Errorf("Duplicate script name %q", s.Name())
+		}
+		if hashes[s.Hash()] {
+			t.Errorf("Script %q duplicates the hash of another script", s.Name())
+		}
+		names[s.Name()] = true
+		hashes[s.Hash()] = true
+	}
+	if len(names) == 0 {
+		t.Error("Expected scripts to be defined")
+	}
+}
+
+// TestRunSendsMissingScript tests that a script missing from the server's cache is sent in full and cached.
+func TestRunSendsMissingScript(t *testing.T) {
+	client := setupRedisClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.ScriptFlush(ctx).Err(); err != nil {
+		t.Fatalf("Failed to flush scripts: %v", err)
+	}
+	key := fmt.Sprintf("redisscripts_test:%d", time.Now().UnixNano())
+	defer client.Del(ctx, key)
+	if err := client.HSet(ctx, key, "f", "value").Err(); err != nil {
+		t.Fatalf("Failed to set field: %v", err)
+	}
+
+	deleted, err := redisscripts.OverridesDeleteIfUnchanged.Run(ctx, client, []string{key}, "f", "value").Int()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected the unchanged field to be deleted, got %d", deleted)
+	}
+	exists, err := client.ScriptExists(ctx, redisscripts.OverridesDeleteIfUnchanged.Hash()).Result()
+	if err != nil {
+		t.Fatalf("Failed to check script: %v", err)
+	}
+	if !exists[0] {
+		t.Error("Expected the script to be cached after its first run")
+	}
+}
+
+// TestLoadAll tests that LoadAll caches every script on the server.
+func TestLoadAll(t *testing.T) {
+	client := setupRedisClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.ScriptFlush(ctx).Err(); err != nil {
+		t.Fatalf("Failed to flush scripts: %v", err)
+	}
+	if err := redisscripts.LoadAll(ctx, client); err != nil {
+		t.Fatalf("LoadAll failed: %v", err)
+	}
+	scripts := redisscripts.All()
+	hashes := make([]string, len(scripts))
+	for i, s := range scripts {
+		hashes[i] = s.Hash()
+	}
+	exists, err := client.ScriptExists(ctx, hashes...).Result()
+	if err != nil {
+		t.Fatalf("Failed to check scripts: %v", err)
+	}
+	for i, ok := range exists {
+		if !ok {
+			t.Errorf("Expected script %q to be cached", scripts[i].Name())
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package redisscripts
+
+// SlidingLogAllow is the Lua script used by the Redis Sliding Window Log to atomically check and log a request.
+// The key is a sorted set holding one member per unit allowed within the window, scored by the time it was allowed in
+// milliseconds. It takes the key, current time, window size, limit, request cost and a nonce unique to the request
+// as arguments. It returns {allowed, remaining, reset_ms, retry_ms}: allowed is 1 if the request is allowed, 0 if
+// denied, remaining is the units left in the window, reset_ms is the time until the key's latest request leaves the
+// window, and retry_ms is the time until a denied request fits (0 if allowed or if it never can).
+var SlidingLogAllow = newScript("sliding_log_allow", `
+local key = KEYS[1] -- Identifier for the rate limit (e.g., user ID, IP address)
+local now = tonumber(ARGV[1]) -- Current time in milliseconds
+local windowSizeMillis = tonumber(ARGV[2]) -- Window size in milliseconds
+local limit = tonumber(ARGV[3]) -- The maximum allowed requests
+local cost = tonumber(ARGV[4]) or 1 -- Cost of the request (usually 1)
+local nonce = ARGV[5] -- Makes the members of this request unique
+
+-- Never let time move backwards for this key: the latest member is the latest time seen
+local latest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+if latest[2] and now < tonumber(latest[2]) then
+    now = tonumber(latest[2])
+end
+
+-- Drop the units that left the window (now - windowSizeMillis, now]
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - windowSizeMillis)
+local count = redis.call('ZCARD', key)
+
+local allowed = count + cost <= limit
+local retryMs = 0
+if allowed then
+    local members = {}
+    for i = 1, cost do
+        members[#members + 1] = now
+        members[#members + 1] = nonce .. ':' .. i
+    end
+    redis.call('ZADD', key, unpack(members))
+    redis.call('PEXPIRE', key, windowSizeMillis)
+    count = count + cost
+elseif cost <= limit then
+    -- The request fits once the oldest units in excess have left the window
+    local excess = count + cost - limit
+    local oldest = redis.call('ZRANGE', key, excess - 1, excess - 1, 'WITHSCORES')
+    retryMs = math.max(tonumber(oldest[2]) + windowSizeMillis - now, 0)
+end
+
+local resetMs = 0
+latest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+if latest[2] then
+    resetMs = tonumber(latest[2]) + windowSizeMillis - now
+end
+return {allowed and 1 or 0, math.max(limit - count, 0), resetMs, retryMs}
+`)
@@ -0,0 +1,115 @@
+package redisscripts
+
+// SlidingWindowAllow is the Lua script used by the Redis Sliding Window Counter to atomically check and update the counter.
+// It takes the key, current time, window size, limit, request cost and schema version (see redisstate) as arguments.
+// It returns {allowed, status, remaining, reset_ms, retry_ms}: allowed is 1 if the request is allowed, 0 if denied,
+// status is a redisstate status, remaining is the whole units left in the weighted count, reset_ms is the time until
+// the key's requests no longer weigh in it, and retry_ms is the time until a denied request fits (0 if allowed or if
+// it never can).
+var SlidingWindowAllow = newScript("sliding_window_allow", `
+local key = KEYS[1] -- Identifier for the rate limit (e.g., user ID, IP address)
+local now = tonumber(ARGV[1]) -- Current time in milliseconds
+local windowSizeMillis = tonumber(ARGV[2]) -- Window size in milliseconds
+local limit = tonumber(ARGV[3]) -- The maximum allowed requests
+local cost = tonumber(ARGV[4]) or 1 -- Cost of the request (usually 1)
+local schemaVersion = tonumber(ARGV[5]) -- Schema version written with the state
+
+-- Field names in the Redis Hash
+local FIELD_PREV_COUNT = 'pc'
+local FIELD_CUR_COUNT = 'cc'
+local FIELD_CUR_WINDOW_START = 'cws'
+local FIELD_LAST_SEEN = 'ts'
+local FIELD_VERSION = 'v'
+
+-- Leave state written by a newer release untouched; unversioned state shares this layout and only gains the version field
+local status = 0
+local storedVersion = tonumber(redis.call('HGET', key, FIELD_VERSION))
+if storedVersion == nil then
+    if redis.call('EXISTS', key) == 1 then
+        status = 1
+    end
+elseif storedVersion > schemaVersion then
+    return {0, 2, 0, 0, 0}
+end
+
+-- Never let time move backwards for this key
+local lastSeen = tonumber(redis.call('HGET', key, FIELD_LAST_SEEN))
+if lastSeen and now < lastSeen then
+    now = lastSeen
+end
+
+-- Get the current state of the counter for this identifier
+-- Returns a table: {previousWindowCount, currentWindowCount, currentWindowStart}
+local currentCounter = redis.call('HMGET', key, FIELD_PREV_COUNT, FIELD_CUR_COUNT, FIELD_CUR_WINDOW_START)
+
+local previousWindowCount = tonumber(currentCounter[1]) or 0
+local currentWindowCount = tonumber(currentCounter[2]) or 0
+local currentWindowStart = tonumber(currentCounter[3]) or 0
+
+-- If the counter is new or very old, initialize it
+if currentWindowStart == 0 or now - currentWindowStart >= windowSizeMillis * 2 then
+    -- Reset both counts if we're well outside the current window
+    previousWindowCount = 0
+    currentWindowCount = 0
+    currentWindowStart = now - (now % windowSizeMillis) -- Truncate to the start of the current window
+elseif now - currentWindowStart >= windowSizeMillis then
+    -- We've entered the next window, so the current count becomes the previous one
+    previousWindowCount = currentWindowCount
+    currentWindowCount = 0
+    currentWindowStart = currentWindowStart + windowSizeMillis
+end
+
+-- Weigh the previous window by the share of it the sliding window [now - windowSizeMillis, now] still overlaps;
+-- the current window counts in full
+local previousOverlap = 1 - (now - currentWindowStart) / windowSizeMillis
+local totalRequests = currentWindowCount + previousWindowCount * previousOverlap
+
+-- Check if limit is exceeded
+local allowed = totalRequests + cost <= limit
+local retryMs = 0
+if allowed then
+    currentWindowCount = currentWindowCount + cost
+    totalRequests = totalRequests + cost
+elseif cost <= limit then
+    local free = limit - cost
+    local elapsed = now - currentWindowStart
+    if currentWindowCount <= free and previousWindowCount > 0 then
+        -- The previous count weighs (1 - elapsed/window) in the current window
+        retryMs = windowSizeMillis * (1 - (free - currentWindowCount) / previousWindowCount) - elapsed
+    elseif currentWindowCount > 0 then
+        -- The current count weighs (1 - elapsed/window) in the next window
+        retryMs = windowSizeMillis - elapsed + windowSizeMillis * math.max(1 - free / currentWindowCount, 0)
+    end
+    retryMs = math.max(math.ceil(retryMs), 0)
+end
+
+local remaining = math.max(math.floor(limit - totalRequests), 0)
+local resetMs = 0
+if currentWindowCount > 0 then
+    -- The current window's requests weigh until the end of the next window
+    resetMs = currentWindowStart + 2 * windowSizeMillis - now
+elseif previousWindowCount > 0 then
+    resetMs = currentWindowStart + windowSizeMillis - now
+end
+
+if allowed then
+    -- Update the counter in Redis
+    redis.call('HMSET', key,
+               FIELD_PREV_COUNT, previousWindowCount,
+               FIELD_CUR_COUNT, currentWindowCount,
+               FIELD_CUR_WINDOW_START, currentWindowStart,
+               FIELD_LAST_SEEN, now,
+               FIELD_VERSION, schemaVersion)
+    -- Set expiry on the key to clean up old identifiers.
+    -- Set expiry to at least 2 * windowSizeMillis to ensure both current and previous window data is available.
+    -- Add some buffer, e.g., an extra window size.
+    redis.call('PEXPIRE', key, windowSizeMillis * 3) -- e.g., 3 times the window size for safety
+    return {1, status, remaining, resetMs, retryMs} -- Allowed
+else
+    -- Do not update counts if denied, but mark upgraded state as current
+    if status == 1 then
+        redis.call('HSET', key, FIELD_VERSION, schemaVersion)
+    end
+    return {0, status, remaining, resetMs, retryMs} -- Denied
+end
+`)
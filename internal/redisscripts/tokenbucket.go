@@ -0,0 +1,210 @@
+package redisscripts
+
+// TokenBucketAllow is the Lua script used by the Redis Token Bucket to atomically check and update the bucket state.
+// It takes the bucket key, capacity, rate, current timestamp, requested tokens, maximum debt, schema version and whether to
+// use the server's clock as arguments.
+var TokenBucketAllow = newScript("token_bucket_allow", `
+		-- Lua script for Token Bucket algorithm
+		-- KEYS[1]: bucket key
+		-- ARGV[1]: capacity
+		-- ARGV[2]: rate (tokens per second)
+		-- ARGV[3]: current timestamp in milliseconds
+		-- ARGV[4]: tokens to consume (usually 1)
+		-- ARGV[5]: maximum debt (tokens that may be borrowed against future refill, 0 disables debt mode)
+		-- ARGV[6]: schema version to write (see redisstate)
+		-- ARGV[7]: 1 to use the server's clock (TIME) instead of ARGV[3]
+		-- Returns {allowed, tokens, status, stale, reset_ms, retry_ms}, where status is a redisstate status,
+		-- stale is 1 if the timestamp was earlier than the last refill time, reset_ms is the time until the bucket is
+		-- full again, and retry_ms is the time until a denied request could be allowed (0 if allowed or if it never can)
+
+		local key = KEYS[1]
+		local capacity = tonumber(ARGV[1])
+		local rate = tonumber(ARGV[2])
+		local now = tonumber(ARGV[3])
+		local requested = tonumber(ARGV[4])
+		local max_debt = tonumber(ARGV[5]) or 0
+		local schema_version = tonumber(ARGV[6])
+
+		if ARGV[7] == '1' then
+			-- Replicate the writes rather than the script, which is not deterministic once it reads the clock (Redis < 5)
+			if redis.replicate_commands then
+				redis.replicate_commands()
+			end
+			local server_time = redis.call('TIME')
+			now = tonumber(server_time[1]) * 1000 + math.floor(tonumber(server_time[2]) / 1000)
+		end
+
+		-- A bucket in debt needs to refill from -max_debt, so account for it in the TTL
+		local fill_time = (capacity + max_debt) / rate
+		local ttl = math.ceil(fill_time) * 2 -- Set TTL to twice the fill time as a safety margin
+
+		local bucket_info = redis.call('HMGET', key, 'tokens', 'last_refill_time', 'v')
+		local tokens = tonumber(bucket_info[1])
+		local last_refill_time = tonumber(bucket_info[2])
+		local stored_version = tonumber(bucket_info[3])
+
+		-- Leave state written by a newer release untouched; unversioned state shares this layout and only gains the version field
+		local status = 0
+		if stored_version == nil then
+			if tokens ~= nil then
+				status = 1
+			end
+		elseif stored_version > schema_version then
+			return {0, 0, 2, 0, 0, 0}
+		end
+
+		local stale = 0
+		if tokens == nil then
+			tokens = capacity
+			last_refill_time = now
+		else
+			-- Never let time move backwards for this bucket: a stale timestamp (clock skew or a replay) is evaluated
+			-- at the last refill time, so it neither refills nor drains the bucket
+			if now < last_refill_time then
+				now = last_refill_time
+				stale = 1
+			end
+			-- Refill whole tokens, keeping the time towards the next token unless the bucket is full; the last
+			-- refill time stays in whole milliseconds, since Lua numbers lose precision when stored as strings
+			local time_since_last_refill = now - last_refill_time
+			local refill_amount = math.floor(time_since_last_refill * rate / 1000)
+			if tokens + refill_amount >= capacity then
+				tokens = capacity
+				last_refill_time = now
+			elseif refill_amount > 0 then
+				tokens = tokens + refill_amount
+				last_refill_time = last_refill_time + math.floor(refill_amount * 1000 / rate)
+			end
+		end
+
+		local allowed = 0
+		if tokens >= requested then
+			allowed = 1
+			tokens = tokens - requested
+		elseif max_debt > 0 and tokens >= 0 and tokens - requested >= -max_debt then
+			-- Borrow against future refill; the bucket denies until the debt is repaid
+			allowed = 1
+			tokens = tokens - requested
+		end
+
+		redis.call('HMSET', key, 'tokens', tokens, 'last_refill_time', last_refill_time, 'v', schema_version)
+		redis.call('EXPIRE', key, ttl)
+
+		-- Whole tokens are refilled at regular intervals from the last refill time
+		local reset_ms = 0
+		if tokens < capacity then
+			reset_ms = math.max(last_refill_time + math.ceil((capacity - tokens) * 1000 / rate) - now, 0)
+		end
+		local retry_ms = 0
+		if allowed == 0 and requested <= capacity + max_debt then
+			-- In debt mode the request is allowed once the bucket is out of debt and holds all but max_debt tokens
+			local needed = requested
+			if max_debt > 0 then
+				needed = math.max(requested - max_debt, 0)
+			end
+			retry_ms = math.max(last_refill_time + math.ceil((needed - tokens) * 1000 / rate) - now, 0)
+		end
+
+		return {allowed, tokens, status, stale, reset_ms, retry_ms}
+	`)
+
+// TokenBucketLease reserves tokens from the bucket for an instance to serve locally.
+// It refills the bucket like TokenBucketAllow and grants as many of the requested tokens as are available.
+// KEYS[1]: bucket key
+// ARGV[1]: capacity
+// ARGV[2]: rate (tokens per second)
+// ARGV[3]: current timestamp in milliseconds
+// ARGV[4]: tokens requested
+// ARGV[5]: schema version to write (see redisstate)
+// ARGV[6]: 1 to use the server's clock (TIME) instead of ARGV[3]
+// Returns {granted, status, stale}, where status is a redisstate status and stale is 1 if the timestamp was earlier
+// than the last refill time.
+var TokenBucketLease = newScript("token_bucket_lease", `
+	local key = KEYS[1]
+	local capacity = tonumber(ARGV[1])
+	local rate = tonumber(ARGV[2])
+	local now = tonumber(ARGV[3])
+	local requested = tonumber(ARGV[4])
+	local schema_version = tonumber(ARGV[5])
+	local ttl = math.ceil(capacity / rate) * 2
+
+	if ARGV[6] == '1' then
+		if redis.replicate_commands then
+			redis.replicate_commands()
+		end
+		local server_time = redis.call('TIME')
+		now = tonumber(server_time[1]) * 1000 + math.floor(tonumber(server_time[2]) / 1000)
+	end
+
+	local bucket_info = redis.call('HMGET', key, 'tokens', 'last_refill_time', 'v')
+	local tokens = tonumber(bucket_info[1])
+	local last_refill_time = tonumber(bucket_info[2])
+	local stored_version = tonumber(bucket_info[3])
+
+	local status = 0
+	if stored_version == nil then
+		if tokens ~= nil then
+			status = 1
+		end
+	elseif stored_version > schema_version then
+		return {0, 2, 0}
+	end
+
+	local stale = 0
+	if tokens == nil then
+		tokens = capacity
+		last_refill_time = now
+	else
+		if now < last_refill_time then
+			now = last_refill_time
+			stale = 1
+		end
+		local refill_amount = math.floor((now - last_refill_time) * rate / 1000)
+		if tokens + refill_amount >= capacity then
+			tokens = capacity
+			last_refill_time = now
+		elseif refill_amount > 0 then
+			tokens = tokens + refill_amount
+			last_refill_time = last_refill_time + math.floor(refill_amount * 1000 / rate)
+		end
+	end
+
+	local granted = math.max(math.min(requested, tokens), 0)
+	tokens = tokens - granted
+
+	redis.call('HMSET', key, 'tokens', tokens, 'last_refill_time', last_refill_time, 'v', schema_version)
+	redis.call('EXPIRE', key, ttl)
+
+	return {granted, status, stale}
+`)
+
+// TokenBucketRelease returns unused leased tokens to the bucket, up to its capacity.
+// Buckets that no longer exist are left alone, since a new bucket starts full.
+// KEYS[1]: bucket key
+// ARGV[1]: capacity
+// ARGV[2]: tokens returned
+// ARGV[3]: schema version (see redisstate)
+// Returns {tokens, status}: the tokens in the bucket afterwards and a redisstate status.
+var TokenBucketRelease = newScript("token_bucket_release", `
+	local key = KEYS[1]
+	local capacity = tonumber(ARGV[1])
+	local returned = tonumber(ARGV[2])
+	local schema_version = tonumber(ARGV[3])
+
+	local bucket_info = redis.call('HMGET', key, 'tokens', 'v')
+	local tokens = tonumber(bucket_info[1])
+	local stored_version = tonumber(bucket_info[2])
+	if tokens == nil then
+		return {0, 0}
+	end
+	local status = 0
+	if stored_version == nil then
+		status = 1
+	elseif stored_version > schema_version then
+		return {0, 2}
+	end
+
+	tokens = math.min(capacity, tokens + returned)
+	redis.call('HSET', key, 'tokens', tokens, 'v', schema_version)
+	return {tokens, status}
+`)
@@ -0,0 +1,88 @@
+// Package redisstate defines the schema versioning shared by the Redis limiter scripts.
+//
+// Every script stores SchemaVersion in the VersionField of the state it writes. State without a version was written
+// by a release predating versioning; scripts upgrade it in place. State with a higher version was written by a newer
+// release with an incompatible layout; scripts leave it untouched rather than corrupt it, so a rolling deployment
+// running mixed releases never misreads counters.
+package redisstate
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/types"
+)
+
+// SchemaVersion is the state layout version written by the scripts. Version 1 is the unversioned layout of earlier releases.
+// Bump it only for incompatible layout changes, and teach the scripts to upgrade the previous layout.
+const SchemaVersion = 2
+
+// VersionField is the hash field (or JSON property) holding the schema version.
+const VersionField = "v"
+
+// Status codes returned by the scripts describing the state they found.
+const (
+	// StatusCurrent means the state was absent or already in the current layout.
+	StatusCurrent int64 = 0
+	// StatusUpgraded means the state was in an older layout and has been upgraded.
+	StatusUpgraded int64 = 1
+	// StatusNewer means the state was written by a newer release and was left untouched.
+	StatusNewer int64 = 2
+)
+
+// Check interprets the status returned by a script, recording a metric when the state was not in the current layout.
+// It returns an error wrapping types.ErrIncompatibleState for StatusNewer.
+func Check(limiterKey string, algorithm config.AlgorithmType, status int64) error {
+	switch status {
+	case StatusCurrent:
+		return nil
+	case StatusUpgraded:
+		metrics.RecordStateSchemaMismatch(limiterKey, string(algorithm), metrics.StateSchemaOlder)
+		log.Debug().Str("limiter_key", limiterKey).Str("algorithm", string(algorithm)).Msg("Limiter: Upgraded state written by an older release")
+		return nil
+	case StatusNewer:
+		metrics.RecordStateSchemaMismatch(limiterKey, string(algorithm), metrics.StateSchemaNewer)
+		log.Warn().Str("limiter_key", limiterKey).Str("algorithm", string(algorithm)).Int("schema_version", SchemaVersion).Msg("Limiter: State written by a newer release left untouched")
+		return fmt.Errorf("limiter '%s': %w", limiterKey, types.ErrIncompatibleState)
+	default:
+		return fmt.Errorf("limiter '%s': unknown script status %d", limiterKey, status)
+	}
+}
+
+// CheckVersion checks the schema version read from stored state outside a script (nil if absent), as Check does
+// for script statuses: it returns an error wrapping types.ErrIncompatibleState if the state was written by a newer release.
+func CheckVersion(limiterKey string, algorithm config.AlgorithmType, version interface{}) error {
+	if v, ok := Float(version); ok && v > SchemaVersion {
+		return Check(limiterKey, algorithm, StatusNewer)
+	}
+	return nil
+}
+
+// Float converts a field read with HMGET, which is nil if the field is absent. It returns false for absent or malformed fields.
+func Float(field interface{}) (float64, bool) {
+	s, ok := field.(string)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// Ints converts a script result that is an array of n integers, such as {allowed, status}.
+func Ints(result interface{}, n int) ([]int64, error) {
+	items, ok := result.([]interface{})
+	if !ok || len(items) != n {
+		return nil, fmt.Errorf("unexpected script result: %v (%T)", result, result)
+	}
+	values := make([]int64, n)
+	for i, item := range items {
+		if values[i], ok = item.(int64); !ok {
+			return nil, fmt.Errorf("unexpected script result element %d type: %T", i, item)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,27 @@
+// Package redisstate_test contains tests for the Redis script schema versioning.
+package redisstate_test
+
+import (
+	"errors"
+	"testing"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/redisstate"
+	"learn.ratelimiter/types"
+)
+
+// TestCheck tests that only state from a newer release is reported as an error.
+func TestCheck(t *testing.T) {
+	if err := redisstate.Check("test", config.TokenBucket, redisstate.StatusCurrent); err != nil {
+		t.Errorf("Expected no error for current state, got %v", err)
+	}
+	if err := redisstate.Check("test", config.TokenBucket, redisstate.StatusUpgraded); err != nil {
+		t.Errorf("Expected no error for upgraded state, got %v", err)
+	}
+	if err := redisstate.Check("test", config.TokenBucket, redisstate.StatusNewer); !errors.Is(err, types.ErrIncompatibleState) {
+		t.Errorf("Expected ErrIncompatibleState for newer state, got %v", err)
+	}
+	if err := redisstate.Check("test", config.TokenBucket, 99); err == nil {
+		t.Error("Expected an error for an unknown status")
+	}
+}
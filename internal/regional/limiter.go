@@ -0,0 +1,149 @@
+// Package regional provides a limiter that enforces one region's share of a global budget split between regions,
+// and a background reconciler that rebalances unused budget between regions through a shared store.
+package regional
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/types"
+)
+
+// Builder creates the limiter enforcing the given share (a fraction of the global budget) for the local region.
+type Builder func(share float64) (types.Limiter, error)
+
+// budget is the limiter currently enforcing the region's share.
+type budget struct {
+	limiter types.Limiter
+	share   float64
+}
+
+// Limiter enforces the local region's share of a limiter's global budget.
+// The share can be changed at runtime (see Reconciler); the underlying limiter is rebuilt with the scaled parameters.
+// Backends that keep state remotely (e.g., Redis) keep it across rebuilds, while in-memory state starts afresh.
+type Limiter struct {
+	key    string // Limiter key from config
+	region string
+	build  Builder
+
+	current atomic.Pointer[budget]
+	// requests counts the units requested (allowed or denied) since the last call to takeRequests.
+	requests atomic.Int64
+	// mu serializes share changes.
+	mu sync.Mutex
+}
+
+// NewLimiter creates a limiter enforcing share (a fraction of the global budget) for the region, using build to create the underlying limiter.
+func NewLimiter(key, region string, share float64, build Builder) (*Limiter, error) {
+	limiter, err := build(share)
+	if err != nil {
+		return nil, err
+	}
+	l := &Limiter{
+		key:    key,
+		region: region,
+		build:  build,
+	}
+	l.current.Store(&budget{limiter: limiter, share: share})
+	metrics.SetRegionShare(key, region, share)
+	log.Info().Str("limiter_key", key).Str("region", region).Float64("share", share).Msg("Limiter: Initialized with regional budget")
+	return l, nil
+}
+
+// Allow checks if a request for the given identifier is allowed by the region's budget.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	l.requests.Add(1)
+	return l.current.Load().limiter.Allow(ctx, identifier)
+}
+
+// AllowN checks if a request costing n units for the given identifier is allowed by the region's budget.
+// Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	if err := types.CheckCost(n); err != nil {
+		return false, err
+	}
+	l.requests.Add(int64(n))
+	limiter := l.current.Load().limiter
+	if costLimiter, ok := limiter.(types.CostLimiter); ok {
+		return costLimiter.AllowN(ctx, identifier, n)
+	}
+	return limiter.Allow(ctx, identifier)
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t by the region's budget.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	if timeLimiter, ok := l.current.Load().limiter.(types.TimeLimiter); ok {
+		l.requests.Add(1)
+		return timeLimiter.AllowAt(ctx, identifier, t)
+	}
+	return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+}
+
+// AllowDetailed checks a request costing n units for the given identifier against the region's budget, and returns
+// its result.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
+	l.requests.Add(int64(n))
+	return types.AllowDetailed(ctx, l.current.Load().limiter, identifier, n)
+}
+
+// Reserve reserves a request costing n units for the given identifier in the region's budget.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Reservation{}, err
+	}
+	l.requests.Add(int64(n))
+	return types.Reserve(ctx, l.current.Load().limiter, identifier, n, maxWait)
+}
+
+// Pressure returns the fraction of the identifier's share of the budget in use.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	return types.Pressure(ctx, l.current.Load().limiter, identifier)
+}
+
+// ResetTime returns the time at which the identifier's share of the budget is fully restored.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	return types.ResetTime(ctx, l.current.Load().limiter, identifier)
+}
+
+// Forget drops the identifier's state in the limiter enforcing the region's share.
+func (l *Limiter) Forget(identifier string) {
+	types.Forget(l.current.Load().limiter, identifier)
+}
+
+// Region returns the region whose budget the limiter enforces.
+func (l *Limiter) Region() string {
+	return l.region
+}
+
+// Share returns the fraction of the global budget currently enforced.
+func (l *Limiter) Share() float64 {
+	return l.current.Load().share
+}
+
+// SetShare rebuilds the underlying limiter to enforce a new fraction of the global budget.
+// On error the previous limiter stays in place.
+func (l *Limiter) SetShare(share float64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limiter, err := l.build(share)
+	if err != nil {
+		return fmt.Errorf("limiter '%s': failed to rebuild regional budget: %w", l.key, err)
+	}
+	l.current.Store(&budget{limiter: limiter, share: share})
+	metrics.SetRegionShare(l.key, l.region, share)
+	return nil
+}
+
+// takeRequests returns the units requested since the previous call and resets the count.
+func (l *Limiter) takeRequests() int64 {
+	return l.requests.Swap(0)
+}
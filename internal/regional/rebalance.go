@@ -0,0 +1,65 @@
+package regional
+
+import "sort"
+
+// DonationFraction is the fraction of its unused budget a region lends to busier regions on each reconciliation.
+// Regions keep the rest as headroom for sudden increases in their own traffic.
+const DonationFraction = 0.5
+
+// Rebalance returns the shares for the next interval. shares holds each region's configured fraction of the global budget
+// (adding up to 1) and demand the fraction of the global budget each region requested during the last interval.
+//
+// Regions using less than their configured share lend part of the difference to regions using more,
+// in proportion to how far those exceed their share and never beyond what they requested. Regions missing from demand
+// (e.g., ones that have not reported recently) keep their configured share. The returned shares add up to 1,
+// and every region computes the same result from the same demand, so the global budget is never exceeded.
+func Rebalance(shares, demand map[string]float64) map[string]float64 {
+	regions := sortedRegions(shares)
+	var available, excess float64
+	for _, region := range regions {
+		share := shares[region]
+		d, ok := demand[region]
+		if !ok {
+			continue
+		}
+		if d < share {
+			available += (share - d) * DonationFraction
+		} else {
+			excess += d - share
+		}
+	}
+
+	result := make(map[string]float64, len(shares))
+	if available == 0 || excess == 0 {
+		for region, share := range shares {
+			result[region] = share
+		}
+		return result
+	}
+
+	// Lend no more than busier regions can use
+	lent := min(available, excess)
+	for _, region := range regions {
+		share := shares[region]
+		d, ok := demand[region]
+		switch {
+		case !ok:
+			result[region] = share
+		case d < share:
+			result[region] = share - (share-d)*DonationFraction*lent/available
+		default:
+			result[region] = share + (d-share)*lent/excess
+		}
+	}
+	return result
+}
+
+// sortedRegions returns the regions in a stable order, so floating point sums don't depend on map iteration.
+func sortedRegions(shares map[string]float64) []string {
+	regions := make([]string, 0, len(shares))
+	for region := range shares {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
@@ -0,0 +1,230 @@
+package regional
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// staleIntervals is the number of reconciliation intervals after which a region's published demand is ignored.
+const staleIntervals = 3
+
+// minShareChange is the smallest share change applied, so small fluctuations in demand don't rebuild the limiter.
+const minShareChange = 0.005
+
+// Store exchanges per-region demand between the regions of a limiter.
+type Store interface {
+	// Publish records the region's demand, as a fraction of the global budget, observed at time at.
+	Publish(ctx context.Context, limiterKey, region string, demand float64, at time.Time) error
+	// Demand returns the latest demand of every region published at or after since.
+	Demand(ctx context.Context, limiterKey string, since time.Time) (map[string]float64, error)
+}
+
+// Reconciler periodically publishes the local region's demand and adjusts its share of the global budget
+// so that budget left unused by quieter regions is lent to busier ones (see Rebalance).
+type Reconciler struct {
+	limiter *Limiter
+	key     string // Limiter key from config
+	// shares holds each region's configured fraction of the global budget.
+	shares map[string]float64
+	// ratePerSecond is the global budget in requests per second, used to express demand as a fraction of it.
+	ratePerSecond float64
+	interval      time.Duration
+	store         Store
+
+	lastRun   time.Time
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewReconciler creates a reconciler adjusting the limiter's share every interval, given the configured shares
+// (fractions adding up to 1) and the global budget in requests per second.
+func NewReconciler(limiter *Limiter, key string, shares map[string]float64, ratePerSecond float64, interval time.Duration, store Store) *Reconciler {
+	return &Reconciler{
+		limiter:       limiter,
+		key:           key,
+		shares:        shares,
+		ratePerSecond: ratePerSecond,
+		interval:      interval,
+		store:         store,
+		lastRun:       time.Now(),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Start runs reconciliation in the background every interval until Close is called.
+func (r *Reconciler) Start() {
+	r.startOnce.Do(func() {
+		log.Info().Str("limiter_key", r.key).Str("region", r.limiter.Region()).Dur("interval", r.interval).Msg("Limiter: Starting regional budget reconciliation")
+		go r.run()
+	})
+}
+
+// run reconciles on every tick until stopped.
+func (r *Reconciler) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+			if err := r.Reconcile(ctx, now); err != nil {
+				log.Warn().Err(err).Str("limiter_key", r.key).Str("region", r.limiter.Region()).Msg("Limiter: Regional budget reconciliation failed, keeping the current share")
+			}
+			cancel()
+		}
+	}
+}
+
+// Reconcile publishes the demand observed since the previous round and applies the rebalanced share for the local region.
+func (r *Reconciler) Reconcile(ctx context.Context, now time.Time) error {
+	elapsed := now.Sub(r.lastRun)
+	if elapsed <= 0 {
+		return nil
+	}
+	r.lastRun = now
+	requests := r.limiter.takeRequests()
+	demand := float64(requests) / elapsed.Seconds() / r.ratePerSecond
+
+	region := r.limiter.Region()
+	if err := r.store.Publish(ctx, r.key, region, demand, now); err != nil {
+		return fmt.Errorf("publish demand for limiter '%s': %w", r.key, err)
+	}
+	demands, err := r.store.Demand(ctx, r.key, now.Add(-staleIntervals*r.interval))
+	if err != nil {
+		return fmt.Errorf("read demand for limiter '%s': %w", r.key, err)
+	}
+
+	share := Rebalance(r.shares, demands)[region]
+	if math.Abs(share-r.limiter.Share()) < minShareChange {
+		return nil
+	}
+	log.Info().Str("limiter_key", r.key).Str("region", region).Float64("previous_share", r.limiter.Share()).Float64("share", share).Float64("demand", demand).Msg("Limiter: Rebalanced regional budget")
+	return r.limiter.SetShare(share)
+}
+
+// Close stops background reconciliation and closes the store if it implements io.Closer.
+// It is safe to call more than once, and before Start.
+func (r *Reconciler) Close() error {
+	var err error
+	r.stopOnce.Do(func() {
+		close(r.stop)
+		r.startOnce.Do(func() { close(r.done) })
+		<-r.done
+		if closer, ok := r.store.(io.Closer); ok {
+			err = closer.Close()
+		}
+	})
+	return err
+}
+
+// MemoryStore is a Store kept in process memory, for tests and single-process setups.
+type MemoryStore struct {
+	mu      sync.Mutex
+	demands map[string]map[string]demandEntry
+}
+
+// demandEntry is a published demand and when it was observed.
+type demandEntry struct {
+	demand float64
+	at     time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{demands: make(map[string]map[string]demandEntry)}
+}
+
+// Publish records the region's demand.
+func (s *MemoryStore) Publish(_ context.Context, limiterKey, region string, demand float64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.demands[limiterKey] == nil {
+		s.demands[limiterKey] = make(map[string]demandEntry)
+	}
+	s.demands[limiterKey][region] = demandEntry{demand: demand, at: at}
+	return nil
+}
+
+// Demand returns the demand of every region published at or after since.
+func (s *MemoryStore) Demand(_ context.Context, limiterKey string, since time.Time) (map[string]float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make(map[string]float64)
+	for region, entry := range s.demands[limiterKey] {
+		if !entry.at.Before(since) {
+			result[region] = entry.demand
+		}
+	}
+	return result, nil
+}
+
+// RedisKeyPrefix prefixes the Redis hash holding a limiter's regional demand.
+const RedisKeyPrefix = "ratelimiter:regions:"
+
+// RedisStore is a Store kept in a Redis hash per limiter, shared by all regions.
+// Each field is a region and holds "<demand>|<unix milliseconds>".
+type RedisStore struct {
+	client *redis.Client
+	// ttl expires the hash of a limiter no region publishes to anymore.
+	ttl time.Duration
+}
+
+// NewRedisStore creates a store in the given Redis instance. Hashes expire after ttl without updates.
+// The store takes ownership of the client and closes it on Close.
+func NewRedisStore(client *redis.Client, ttl time.Duration) *RedisStore {
+	return &RedisStore{client: client, ttl: ttl}
+}
+
+// Close closes the Redis client.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// Publish records the region's demand in the limiter's hash.
+func (s *RedisStore) Publish(ctx context.Context, limiterKey, region string, demand float64, at time.Time) error {
+	key := RedisKeyPrefix + limiterKey
+	value := strconv.FormatFloat(demand, 'g', -1, 64) + "|" + strconv.FormatInt(at.UnixMilli(), 10)
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, region, value)
+		pipe.PExpire(ctx, key, s.ttl)
+		return nil
+	})
+	return err
+}
+
+// Demand returns the demand of every region published at or after since.
+func (s *RedisStore) Demand(ctx context.Context, limiterKey string, since time.Time) (map[string]float64, error) {
+	fields, err := s.client.HGetAll(ctx, RedisKeyPrefix+limiterKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]float64)
+	for region, value := range fields {
+		demandStr, atStr, ok := strings.Cut(value, "|")
+		demand, demandErr := strconv.ParseFloat(demandStr, 64)
+		atMillis, atErr := strconv.ParseInt(atStr, 10, 64)
+		if !ok || demandErr != nil || atErr != nil {
+			log.Warn().Str("limiter_key", limiterKey).Str("region", region).Str("value", value).Msg("Limiter: Skipping malformed regional demand entry")
+			continue
+		}
+		if atMillis >= since.UnixMilli() {
+			result[region] = demand
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,151 @@
+// Package regional_test contains tests for regional budgets.
+package regional_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/internal/regional"
+	"learn.ratelimiter/types"
+)
+
+// globalLimit is the per-minute budget split between regions in these tests.
+const globalLimit = 1000
+
+// newRegionalLimiter returns a regional fixed window limiter enforcing share of globalLimit per minute.
+func newRegionalLimiter(t *testing.T, region string, share float64) *regional.Limiter {
+	t.Helper()
+	limiter, err := regional.NewLimiter("api", region, share, func(share float64) (types.Limiter, error) {
+		return fcinmemory.NewLimiter("api:region:"+region, time.Minute, int64(math.Round(globalLimit*share))), nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to create regional limiter: %v", err)
+	}
+	return limiter
+}
+
+// allowedCount returns how many of n requests the limiter allows.
+func allowedCount(limiter types.Limiter, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if ok, _ := limiter.Allow(context.Background(), "client1"); ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+// TestRegionalShare tests that a region only admits its share of the global budget.
+func TestRegionalShare(t *testing.T) {
+	limiter := newRegionalLimiter(t, "eu", 0.3)
+	if got := allowedCount(limiter, globalLimit); got != 300 {
+		t.Errorf("Expected 300 requests allowed for a 30%% share, got %d", got)
+	}
+	if err := limiter.SetShare(0.5); err != nil {
+		t.Fatalf("SetShare returned error: %v", err)
+	}
+	if got := limiter.Share(); got != 0.5 {
+		t.Errorf("Expected share 0.5, got %v", got)
+	}
+}
+
+// TestRebalance tests that unused budget is lent to busier regions without exceeding the global budget.
+func TestRebalance(t *testing.T) {
+	shares := map[string]float64{"us": 0.6, "eu": 0.3, "ap": 0.1}
+	testCases := []struct {
+		name   string
+		demand map[string]float64
+		want   map[string]float64
+	}{
+		{
+			name:   "Within shares",
+			demand: map[string]float64{"us": 0.5, "eu": 0.2, "ap": 0.1},
+			want:   shares,
+		},
+		{
+			name:   "Busy region borrows half of the unused budget",
+			demand: map[string]float64{"us": 0.2, "eu": 0.3, "ap": 0.5},
+			want:   map[string]float64{"us": 0.4, "eu": 0.3, "ap": 0.3},
+		},
+		{
+			name:   "Borrowing is capped at demand",
+			demand: map[string]float64{"us": 0, "eu": 0.3, "ap": 0.15},
+			want:   map[string]float64{"us": 0.55, "eu": 0.3, "ap": 0.15},
+		},
+		{
+			name:   "Silent regions keep their share",
+			demand: map[string]float64{"eu": 0, "ap": 0.4},
+			want:   map[string]float64{"us": 0.6, "eu": 0.15, "ap": 0.25},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := regional.Rebalance(shares, tc.demand)
+			var total float64
+			for region, want := range tc.want {
+				if math.Abs(got[region]-want) > 1e-9 {
+					t.Errorf("Region %s: expected share %v, got %v", region, want, got[region])
+				}
+				total += got[region]
+			}
+			if math.Abs(total-1) > 1e-9 {
+				t.Errorf("Expected shares to add up to 1, got %v", total)
+			}
+		})
+	}
+}
+
+// TestReconcile tests that reconcilers sharing a store move budget from an idle region to a busy one.
+func TestReconcile(t *testing.T) {
+	shares := map[string]float64{"us": 0.5, "eu": 0.5}
+	// 1000 requests per minute
+	ratePerSecond := globalLimit / 60.0
+	store := regional.NewMemoryStore()
+	us := newRegionalLimiter(t, "us", 0.5)
+	eu := newRegionalLimiter(t, "eu", 0.5)
+	usReconciler := regional.NewReconciler(us, "api", shares, ratePerSecond, time.Minute, store)
+	euReconciler := regional.NewReconciler(eu, "api", shares, ratePerSecond, time.Minute, store)
+	defer usReconciler.Close()
+	defer euReconciler.Close()
+
+	// Over the next minute, us requests its whole share plus the global budget while eu stays idle
+	allowedCount(us, globalLimit*3/2)
+	now := time.Now().Add(time.Minute)
+	ctx := context.Background()
+	if err := euReconciler.Reconcile(ctx, now); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := usReconciler.Reconcile(ctx, now); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if err := euReconciler.Reconcile(ctx, now.Add(time.Second)); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+
+	if got := us.Share(); math.Abs(got-0.75) > 0.01 {
+		t.Errorf("Expected busy region share of about 0.75, got %v", got)
+	}
+	if got := eu.Share(); math.Abs(got-0.25) > 0.01 {
+		t.Errorf("Expected idle region share of about 0.25, got %v", got)
+	}
+}
+
+// TestRegionalDetailed tests that detailed checks and reservations are decided by the region's share.
+func TestRegionalDetailed(t *testing.T) {
+	limiter := newRegionalLimiter(t, "eu", 0.3)
+	ctx := context.Background()
+
+	result, err := limiter.AllowDetailed(ctx, "client1", 100)
+	if err != nil || !result.Allowed || result.Limit != 300 || result.Remaining != 200 {
+		t.Errorf("Expected 200 of the share of 300 remaining, got %+v, %v", result, err)
+	}
+	if reservation, err := limiter.Reserve(ctx, "client1", 250, 0); err != nil || reservation.OK {
+		t.Errorf("Expected a reservation beyond the share denied, got %+v, %v", reservation, err)
+	}
+	if pressure, err := limiter.Pressure(ctx, "client1"); err != nil || math.Abs(pressure-1.0/3) > 1e-9 {
+		t.Errorf("Expected a third of the share in use, got %v, %v", pressure, err)
+	}
+}
@@ -4,10 +4,15 @@ package swinmemory
 import (
 	"context"
 	"fmt"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/internal/clock"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
 )
 
 // limiter is the in-memory implementation of the Sliding Window Counter.
@@ -23,6 +28,7 @@ type slidingWindowCounter struct {
 	previousWindowCount int
 	currentWindowCount  int
 	currentWindowStart  time.Time
+	lastSeen            time.Time // latest request time observed, used to guard against time moving backwards
 	mu                  sync.Mutex
 }
 
@@ -41,13 +47,42 @@ func NewLimiter(key string, windowSize time.Duration, limit int64) *limiter {
 // Allow checks if a request is allowed for the given identifier based on the Sliding Window Counter algorithm.
 // It takes a context and an identifier and returns true if the request is allowed, false otherwise, and an error if any occurred.
 func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request costing n units for the given identifier fits in the weighted count of the sliding window.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return result.Allowed, err
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	result, err := l.allow(ctx, identifier, 1, t)
+	return result.Allowed, err
+}
 
-	tempCounter, _ := l.counter.LoadOrStore(identifier, l.initializeWindowCounter(0))
+// AllowDetailed checks a request costing n units for the given identifier as AllowN does, with the budget left in the
+// weighted count, when the identifier's requests no longer weigh in it and, for a denied request, when it fits.
+func (l *limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	return l.allow(ctx, identifier, n, time.Now())
+}
+
+// allow evaluates a request costing n units at time now.
+func (l *limiter) allow(ctx context.Context, identifier string, n int, now time.Time) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
+	// Load before LoadOrStore, so checks of known identifiers do not allocate a counter to discard
+	tempCounter, ok := l.counter.Load(identifier)
+	if !ok {
+		tempCounter, _ = l.counter.LoadOrStore(identifier, l.initializeWindowCounter(l.windowStart(now)))
+	}
 	currentCounter, ok := tempCounter.(*slidingWindowCounter)
 	if !ok {
 		err := fmt.Errorf("unexpected state type for identifier %s in in-memory limiter '%s'", identifier, l.key)
-		log.Error().Err(err).Str("limiter_type", "SlidingWindowCounter").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Error in Allow")
-		return false, err
+		log.Error().Err(err).Str("limiter_type", "SlidingWindowCounter").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Error in Allow")
+		return types.Result{}, err
 	}
 	currentCounter.mu.Lock()
 	defer currentCounter.mu.Unlock()
@@ -55,13 +90,15 @@ func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
 	// Check if context is cancelled before proceeding
 	select {
 	case <-ctx.Done():
-		log.Warn().Err(ctx.Err()).Str("limiter_type", "SlidingWindowCounter").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Context cancelled during check")
-		return false, ctx.Err()
+		log.Warn().Err(ctx.Err()).Str("limiter_type", "SlidingWindowCounter").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Context cancelled during check")
+		return types.Result{}, ctx.Err()
 	default:
 		// Continue
 	}
 
-	now := time.Now()
+	// Never let time move backwards for this identifier
+	now = clock.Clamp(now, currentCounter.lastSeen)
+	currentCounter.lastSeen = now
 
 	// Slide the window if necessary
 	for now.Sub(currentCounter.currentWindowStart) >= l.windowSize {
@@ -86,20 +123,157 @@ func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
 	// Total requests in the sliding window
 	totalRequests := float64(currentCounter.currentWindowCount) + float64(currentCounter.previousWindowCount)*percentagePreviousOverlap
 
+	result := types.Result{Limit: l.limit}
 	// Check if allowing the current request would exceed the limit
-	if totalRequests+1 <= float64(l.limit) {
-		currentCounter.currentWindowCount++
-		return true, nil
+	if totalRequests+float64(n) <= float64(l.limit) {
+		currentCounter.currentWindowCount += n
+		totalRequests += float64(n)
+		result.Allowed = true
+	} else if int64(n) <= l.limit {
+		result.RetryAfter = max(l.fitsAt(currentCounter, n).Sub(now), 0)
+	}
+	result.Remaining = int64(math.Floor(max(float64(l.limit)-totalRequests, 0)))
+	switch {
+	case currentCounter.currentWindowCount > 0:
+		// The current window's requests weigh until the end of the next window
+		result.ResetAt = currentCounter.currentWindowStart.Add(2 * l.windowSize)
+	case currentCounter.previousWindowCount > 0:
+		result.ResetAt = currentCounter.currentWindowStart.Add(l.windowSize)
+	default:
+		result.ResetAt = now
 	}
+	return result, nil
+}
 
-	return false, nil
+// Reserve checks if a request costing n units for the identifier fits in the weighted count of the sliding window.
+// Budget cannot be reserved ahead of time, since it frees up as the previous window's requests weigh less: a denied
+// request carries the time after which it fits, if it ever does. maxWait is not used.
+func (l *limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return types.Reservation{OK: result.Allowed, Delay: result.RetryAfter}, err
+}
 
+// fitsAt returns when n more units fit in the weighted count, once the previous window's requests weigh less, or once
+// the current window's requests do in the next window. The caller holds counter.mu, and n is at most the limit.
+func (l *limiter) fitsAt(counter *slidingWindowCounter, n int) time.Time {
+	window := float64(l.windowSize)
+	free := float64(l.limit) - float64(n) - float64(counter.currentWindowCount)
+	if free >= 0 && counter.previousWindowCount > 0 {
+		// The previous count weighs (1 - elapsed/window) in the current window
+		return counter.currentWindowStart.Add(time.Duration(window * (1 - free/float64(counter.previousWindowCount))))
+	}
+	// The current count weighs (1 - elapsed/window) in the next window
+	free = float64(l.limit) - float64(n)
+	next := counter.currentWindowStart.Add(l.windowSize)
+	return next.Add(time.Duration(window * max(1-free/float64(counter.currentWindowCount), 0)))
 }
 
-func (l *limiter) initializeWindowCounter(previousWindowCount int) *slidingWindowCounter {
+func (l *limiter) initializeWindowCounter(start time.Time) *slidingWindowCounter {
 	return &slidingWindowCounter{
-		previousWindowCount: previousWindowCount,
+		previousWindowCount: 0,
 		currentWindowCount:  0,
-		currentWindowStart:  time.Now(), // Initial window starts now
+		currentWindowStart:  start,
+		lastSeen:            start,
+	}
+}
+
+// windowStart returns the start of the window running at time now. Windows start at multiples of the window size
+// since the Unix epoch, in milliseconds, like those of the Redis limiter.
+func (l *limiter) windowStart(now time.Time) time.Time {
+	windowMillis := max(l.windowSize.Milliseconds(), 1)
+	return time.UnixMilli(now.UnixMilli() / windowMillis * windowMillis)
+}
+
+// Usage returns the fraction of the limit each identifier has used in the sliding window ending at time now.
+// Identifiers with no requests in the window are left out.
+func (l *limiter) Usage(now time.Time) map[string]float64 {
+	usage := make(map[string]float64)
+	l.counter.Range(func(identifier, counterIface interface{}) bool {
+		counter, ok := counterIface.(*slidingWindowCounter)
+		if !ok {
+			return true
+		}
+		counter.mu.Lock()
+		defer counter.mu.Unlock()
+		if used := l.used(counter, now); used > 0 {
+			usage[identifier.(string)] = used
+		}
+		return true
+	})
+	return usage
+}
+
+// Pressure returns the fraction of the limit the identifier has used in the sliding window ending now.
+func (l *limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	counterIface, ok := l.counter.Load(identifier)
+	if !ok {
+		return 0, nil
+	}
+	counter := counterIface.(*slidingWindowCounter)
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	return l.used(counter, clock.Clamp(time.Now(), counter.lastSeen)), nil
+}
+
+// used returns the fraction of the limit counted in the sliding window ending at time now. The caller holds counter.mu.
+func (l *limiter) used(counter *slidingWindowCounter, now time.Time) float64 {
+	elapsed := now.Sub(counter.currentWindowStart)
+	var total float64
+	switch {
+	case elapsed < 0 || elapsed >= 2*l.windowSize:
+		// Either state from the future, which is never expected, or state too old to count
+		return 0
+	case elapsed >= l.windowSize:
+		total = float64(counter.currentWindowCount) * float64(2*l.windowSize-elapsed) / float64(l.windowSize)
+	default:
+		total = float64(counter.currentWindowCount) + float64(counter.previousWindowCount)*float64(l.windowSize-elapsed)/float64(l.windowSize)
+	}
+	return min(total/float64(l.limit), 1)
+}
+
+// ResetTime returns the time at which the identifier's requests no longer weigh in the sliding window, or now if none do.
+func (l *limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	now := time.Now()
+	counterIface, ok := l.counter.Load(identifier)
+	if !ok {
+		return now, nil
 	}
+	counter := counterIface.(*slidingWindowCounter)
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	elapsed := clock.Clamp(now, counter.lastSeen).Sub(counter.currentWindowStart)
+	switch {
+	case elapsed < 0 || elapsed >= 2*l.windowSize:
+		return now, nil
+	case counter.currentWindowCount > 0:
+		// The current window's requests weigh until the end of the next window
+		return counter.currentWindowStart.Add(2 * l.windowSize), nil
+	case elapsed < l.windowSize && counter.previousWindowCount > 0:
+		return counter.currentWindowStart.Add(l.windowSize), nil
+	default:
+		return now, nil
+	}
+}
+
+// KeyCount returns the number of identifiers with a counter, including idle ones, since counters are only dropped by Forget.
+func (l *limiter) KeyCount() (int, bool) {
+	count := 0
+	l.counter.Range(func(_, _ interface{}) bool {
+		count++
+		return true
+	})
+	return count, true
+}
+
+// Forget drops the identifier's counts, so its next request starts with an empty window.
+func (l *limiter) Forget(identifier string) {
+	l.counter.Delete(identifier)
+}
+
+// SetUsage replaces the identifier's counts with a window starting at time now whose previous window used the given fraction of the limit,
+// so the used budget is released gradually over the next window.
+func (l *limiter) SetUsage(identifier string, used float64, now time.Time) {
+	counter := l.initializeWindowCounter(now)
+	counter.previousWindowCount = int(math.Round(min(max(used, 0), 1) * float64(l.limit)))
+	l.counter.Store(identifier, counter)
 }
@@ -3,6 +3,7 @@ package swinmemory_test
 
 import (
 	"context"
+	"math"
 	"testing"
 	"time"
 
@@ -13,10 +14,12 @@ func TestSlidingWindowLimiter(t *testing.T) {
 	t.Run("SlidingWindowBehavior", func(t *testing.T) {
 		limiter := swinmemory.NewLimiter("test_sliding_window_behavior", 100*time.Millisecond, 3)
 		ctx := context.Background()
+		// Windows start at multiples of the window size since the Unix epoch
+		windowStart := time.UnixMilli(1_700_000_000_000)
 
 		// Fill the window
 		for i := 0; i < 3; i++ {
-			allowed, err := limiter.Allow(ctx, "user_sliding")
+			allowed, err := limiter.AllowAt(ctx, "user_sliding", windowStart.Add(10*time.Millisecond))
 			if err != nil {
 				t.Fatalf("Allow failed: %v", err)
 			}
@@ -26,7 +29,7 @@ func TestSlidingWindowLimiter(t *testing.T) {
 		}
 
 		// Attempt one more request, should be denied
-		allowed, err := limiter.Allow(ctx, "user_sliding")
+		allowed, err := limiter.AllowAt(ctx, "user_sliding", windowStart.Add(10*time.Millisecond))
 		if err != nil {
 			t.Fatalf("Allow failed: %v", err)
 		}
@@ -34,23 +37,22 @@ func TestSlidingWindowLimiter(t *testing.T) {
 			t.Fatalf("Request unexpectedly allowed after limit")
 		}
 
-		time.Sleep(120 * time.Millisecond) // Move more than 1 into the window
-
-		// After 120ms, the weighted count should be 2.4.
+		// 20ms into the next window, the weighted count should be 3 * 0.8 = 2.4.
 		// Allowing one more request would make it 3.4, exceeding the limit of 3.
 		// Both subsequent requests should be denied.
+		later := windowStart.Add(120 * time.Millisecond)
 
 		// Attempt one more request, should be denied
-		allowed, err = limiter.Allow(ctx, "user_sliding")
+		allowed, err = limiter.AllowAt(ctx, "user_sliding", later)
 		if err != nil {
 			t.Fatalf("Allow failed: %v", err)
 		}
 		if allowed {
-			t.Fatalf("Request unexpectedly allowed after 120ms sleep")
+			t.Fatalf("Request unexpectedly allowed 20ms into the next window")
 		}
 
 		// Attempt another request, should also be denied
-		allowed, err = limiter.Allow(ctx, "user_sliding")
+		allowed, err = limiter.AllowAt(ctx, "user_sliding", later)
 		if err != nil {
 			t.Fatalf("Allow failed: %v", err)
 		}
@@ -72,3 +74,70 @@ func TestSlidingWindowLimiter(t *testing.T) {
 		}
 	})
 }
+
+// TestAllowDoesNotAllocate tests that checking an identifier with existing state allocates nothing.
+func TestAllowDoesNotAllocate(t *testing.T) {
+	limiter := swinmemory.NewLimiter("bench_sliding_window", time.Minute, math.MaxInt64)
+	ctx := context.Background()
+	limiter.Allow(ctx, "user1")
+	if allocs := testing.AllocsPerRun(1000, func() { limiter.Allow(ctx, "user1") }); allocs != 0 {
+		t.Errorf("Expected Allow not to allocate, got %v allocations per call", allocs)
+	}
+}
+
+// BenchmarkAllow measures checking an identifier with existing state, run with -benchmem to report allocations.
+func BenchmarkAllow(b *testing.B) {
+	limiter := swinmemory.NewLimiter("bench_sliding_window", time.Minute, math.MaxInt64)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			limiter.Allow(ctx, "user1")
+		}
+	})
+}
+
+// TestPressure tests that Pressure reports the fraction of the sliding window's limit in use without charging it.
+func TestPressure(t *testing.T) {
+	limiter := swinmemory.NewLimiter("test_pressure", time.Minute, 4)
+	ctx := context.Background()
+
+	for _, want := range []float64{0, 0.5, 1} {
+		pressure, err := limiter.Pressure(ctx, "user1")
+		if err != nil {
+			t.Fatalf("Pressure returned error: %v", err)
+		}
+		if math.Abs(pressure-want) > 0.01 {
+			t.Errorf("Expected pressure %v, got %v", want, pressure)
+		}
+		for i := 0; i < 2; i++ {
+			limiter.Allow(ctx, "user1")
+		}
+	}
+	if allowed, _ := limiter.Allow(ctx, "user1"); allowed {
+		t.Error("Request should be denied at full pressure")
+	}
+	if pressure, _ := limiter.Pressure(ctx, "user2"); pressure != 0 {
+		t.Errorf("Expected no pressure for an identifier without state, got %v", pressure)
+	}
+}
+
+// TestResetTime tests that ResetTime reports the end of the window after the one holding the identifier's requests,
+// when they stop weighing in the sliding window.
+func TestResetTime(t *testing.T) {
+	limiter := swinmemory.NewLimiter("test_reset_time", time.Minute, 4)
+	ctx := context.Background()
+
+	start := time.Now()
+	if reset, err := limiter.ResetTime(ctx, "user1"); err != nil || reset.Before(start) || reset.After(time.Now()) {
+		t.Fatalf("Expected a reset now for an identifier without state, got %s, %v", reset, err)
+	}
+	limiter.Allow(ctx, "user1")
+	reset, err := limiter.ResetTime(ctx, "user1")
+	if err != nil {
+		t.Fatalf("ResetTime returned error: %v", err)
+	}
+	if reset.Before(start.Add(time.Minute)) || reset.After(time.Now().Add(2*time.Minute)) {
+		t.Errorf("Expected a reset between one and two windows from now, got %s", reset)
+	}
+}
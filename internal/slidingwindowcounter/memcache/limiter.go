@@ -1,4 +1,181 @@
 // Package swcmemcache provides a Memcache implementation of the Sliding Window Counter rate limiting algorithm.
 package swcmemcache
 
-// TODO: Implement Memcache backend for Sliding Window Counter
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/rs/zerolog/log"
+
+	"learn.ratelimiter/internal/clock"
+	"learn.ratelimiter/internal/codec"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// maxAttempts is the number of times a request reads and updates the counter before giving up, when other requests
+// update it in between.
+const maxAttempts = 5
+
+// limiter is the Memcache implementation of the Sliding Window Counter.
+type limiter struct {
+	key        string
+	windowSize time.Duration
+	limit      int64
+	client     *memcache.Client
+	codec      codec.Codec // encoding of stored state; any format is read
+	noCAS      bool        // update state with set instead of cas, for proxies without cas
+}
+
+// Option configures optional behaviour of a limiter.
+type Option func(*limiter)
+
+// WithoutCAS updates state with set instead of cas, for servers behind proxies that do not support cas (see
+// tbmemcache.WithoutCAS). Concurrent requests for the same identifier may then overwrite each other's update.
+func WithoutCAS() Option {
+	return func(l *limiter) {
+		l.noCAS = true
+	}
+}
+
+// slidingWindowState represents the counts of an identifier's current and previous windows stored in Memcache.
+type slidingWindowState struct {
+	PreviousCount int64     `json:"previous_count" codec:"1"`
+	CurrentCount  int64     `json:"current_count" codec:"2"`
+	WindowStart   time.Time `json:"window_start" codec:"3"`
+	LastSeen      time.Time `json:"last_seen" codec:"4"`
+}
+
+// NewLimiter creates a new Memcache Sliding Window Counter limiter storing state with the given codec (JSON if nil).
+// State written by any codec is read, so the codec can be changed without resetting counters. Counters are created
+// with add and updated with cas, so concurrent requests from any instance are counted exactly (see WithoutCAS).
+func NewLimiter(key string, windowSize time.Duration, limit int64, client *memcache.Client, stateCodec codec.Codec, opts ...Option) types.CostLimiter {
+	if stateCodec == nil {
+		stateCodec = codec.JSON
+	}
+	l := &limiter{
+		key:        key,
+		windowSize: windowSize,
+		limit:      limit,
+		client:     client,
+		codec:      stateCodec,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	log.Info().Str("limiter_type", "SlidingWindowCounter").Str("backend", "Memcache").Str("limiter_key", key).Dur("window", windowSize).Int64("limit", limit).Str("codec", stateCodec.Name()).Bool("cas", !l.noCAS).Msg("Limiter: Initialized")
+	return l
+}
+
+// Allow checks if a request for the given identifier is allowed based on the Sliding Window Counter algorithm.
+func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request costing n units for the given identifier fits in the weighted count of the sliding window.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	return l.allow(ctx, identifier, n, time.Now())
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+// Times earlier than the latest time seen for the identifier are treated as that latest time.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	return l.allow(ctx, identifier, 1, t)
+}
+
+// allow evaluates a request costing n units at time now. Without CAS, the updated state overwrites any update made
+// by another instance since it was read.
+func (l *limiter) allow(ctx context.Context, identifier string, n int, now time.Time) (bool, error) {
+	if err := types.CheckCost(n); err != nil {
+		return false, err
+	}
+	itemKey := l.key + ":" + identifier
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		item, err := l.client.Get(itemKey)
+		if err != nil && err != memcache.ErrCacheMiss {
+			log.Error().Err(err).Str("limiter_type", "SlidingWindowCounter").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to get state from Memcache")
+			return false, fmt.Errorf("get state from memcache: %w", err)
+		}
+
+		state := &slidingWindowState{}
+		if item != nil {
+			if err := l.codec.Unmarshal(item.Value, state); err != nil {
+				log.Error().Err(err).Str("limiter_type", "SlidingWindowCounter").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to unmarshal state from Memcache")
+				return false, fmt.Errorf("unmarshal state: %w", err)
+			}
+		}
+
+		if !l.take(state, int64(n), now) {
+			// A denied request leaves the stored state untouched, since windows are moved from it on the next request
+			log.Debug().Str("limiter_type", "SlidingWindowCounter").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Int64("current_count", state.CurrentCount).Msg("Limiter: Request denied")
+			return false, nil
+		}
+
+		value, err := l.codec.Marshal(state)
+		if err != nil {
+			log.Error().Err(err).Str("limiter_type", "SlidingWindowCounter").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to marshal state for Memcache")
+			return false, fmt.Errorf("marshal state: %w", err)
+		}
+		// The current count weighs until the end of the next window
+		expiration := int32(math.Ceil((2 * l.windowSize).Seconds()))
+		switch {
+		case item == nil:
+			// Add fails if another request created the counter since it was read
+			err = l.client.Add(&memcache.Item{Key: itemKey, Value: value, Expiration: expiration})
+		case l.noCAS:
+			err = l.client.Set(&memcache.Item{Key: itemKey, Value: value, Expiration: expiration})
+		default:
+			item.Value = value
+			item.Expiration = expiration
+			err = l.client.CompareAndSwap(item)
+		}
+		if err == memcache.ErrNotStored || err == memcache.ErrCASConflict {
+			// The counter was created, updated or evicted since it was read
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Str("limiter_type", "SlidingWindowCounter").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to set state in Memcache")
+			return false, fmt.Errorf("set state in memcache: %w", err)
+		}
+		log.Debug().Str("limiter_type", "SlidingWindowCounter").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Int64("current_count", state.CurrentCount).Msg("Limiter: Request allowed")
+		return true, nil
+	}
+
+	err := fmt.Errorf("state of identifier changed by %d concurrent requests", maxAttempts)
+	log.Warn().Err(err).Str("limiter_type", "SlidingWindowCounter").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Too much contention updating state in Memcache")
+	return false, fmt.Errorf("update state in memcache: %w", err)
+}
+
+// take moves the counter to the window running at time now and counts a request costing cost units if it fits in
+// the weighted count, as the Redis script does. It reports whether the request was counted.
+func (l *limiter) take(state *slidingWindowState, cost int64, now time.Time) bool {
+	// Never let time move backwards for this counter
+	now = clock.Clamp(now, state.LastSeen)
+	nowMillis := now.UnixMilli()
+	windowMillis := max(l.windowSize.Milliseconds(), 1)
+
+	// Windows start at multiples of the window size since the Unix epoch, in milliseconds
+	elapsed := nowMillis - state.WindowStart.UnixMilli()
+	switch {
+	case state.WindowStart.IsZero() || elapsed >= 2*windowMillis:
+		state.PreviousCount, state.CurrentCount = 0, 0
+		state.WindowStart = time.UnixMilli(nowMillis / windowMillis * windowMillis)
+	case elapsed >= windowMillis:
+		state.PreviousCount, state.CurrentCount = state.CurrentCount, 0
+		state.WindowStart = state.WindowStart.Add(time.Duration(windowMillis) * time.Millisecond)
+	}
+
+	// Weigh the previous window by the share of it the sliding window still overlaps
+	previousOverlap := 1 - float64(nowMillis-state.WindowStart.UnixMilli())/float64(windowMillis)
+	total := float64(state.CurrentCount) + float64(state.PreviousCount)*previousOverlap
+	if total+float64(cost) > float64(l.limit) {
+		return false
+	}
+	state.CurrentCount += cost
+	state.LastSeen = now
+	return true
+}
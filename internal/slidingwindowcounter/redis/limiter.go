@@ -8,6 +8,14 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/backendkey"
+	"learn.ratelimiter/internal/redisargs"
+	"learn.ratelimiter/internal/redisscripts"
+	"learn.ratelimiter/internal/redisstate"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
 )
 
 // limiter is the Redis implementation of the Sliding Window Counter.
@@ -17,57 +25,189 @@ type limiter struct {
 	client     *redis.Client
 	windowSize time.Duration
 	limit      int64
-	script     *redis.Script
+	script     *redisscripts.Script
+	keys       *backendkey.Builder // Composes the Redis key of each identifier
+}
+
+// Option configures optional behaviour of a limiter.
+type Option func(*limiter)
+
+// WithKeyCache caches the Redis keys of up to size frequent identifiers instead of composing them on every check.
+func WithKeyCache(size int) Option {
+	return func(l *limiter) {
+		l.keys = backendkey.NewBuilder(size, l.key)
+	}
 }
 
 // NewLimiter creates a new Redis-based Sliding Window Counter limiter.
-// It takes a unique key for the limiter, the size of the sliding window, the maximum limit of requests within the window, and a Redis client instance.
-func NewLimiter(key string, windowSize time.Duration, limit int64, client *redis.Client) *limiter {
+// It takes a unique key for the limiter, the size of the sliding window, the maximum limit of requests within the window, a Redis client instance,
+// and optional behaviour.
+func NewLimiter(key string, windowSize time.Duration, limit int64, client *redis.Client, opts ...Option) *limiter {
 	log.Info().Str("limiter_type", "SlidingWindowCounter").Str("backend", "Redis").Str("limiter_key", key).Dur("window", windowSize).Int64("limit", limit).Msg("Limiter: Initialized")
-	return &limiter{
+	l := &limiter{
 		key:        key, // Store the key
 		windowSize: windowSize,
 		limit:      limit,
 		client:     client,
-		script:     redisAllowScript,
+		script:     redisscripts.SlidingWindowAllow,
+		keys:       backendkey.NewBuilder(0, key),
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 // Allow checks if a request is allowed for the given identifier based on the Sliding Window Counter algorithm using Redis.
 // It executes a Lua script on Redis to atomically check and update the counter.
 // It takes a context and an identifier and returns true if the request is allowed, false otherwise, and an error if any occurred.
 func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request costing n units for the given identifier is allowed based on the Sliding Window Counter algorithm using Redis.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return result.Allowed, err
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+// The script treats times earlier than the latest time seen for the identifier as that latest time.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	result, err := l.allow(ctx, identifier, 1, t)
+	return result.Allowed, err
+}
+
+// AllowDetailed checks a request costing n units for the given identifier as AllowN does, with the budget left in the
+// weighted count, when the identifier's requests no longer weigh in it and, for a denied request, when it fits, all
+// computed by the script.
+func (l *limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	return l.allow(ctx, identifier, n, time.Now())
+}
+
+// Pressure returns the fraction of the limit the identifier has used in the sliding window ending now,
+// weighted as the script weighs it. It reads the counter without charging it.
+func (l *limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	w, err := l.read(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	total := w.currentCount + w.previousCount*(1-w.elapsed/w.windowMillis)
+	return min(total/float64(l.limit), 1), nil
+}
+
+// ResetTime returns the time at which the identifier's requests no longer weigh in the sliding window, or now if none
+// do. It reads the counter without charging it.
+func (l *limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	w, err := l.read(ctx, identifier)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch {
+	case w.currentCount > 0:
+		// The current window's requests weigh until the end of the next window
+		return time.UnixMilli(int64(w.start + 2*w.windowMillis)), nil
+	case w.previousCount > 0:
+		return time.UnixMilli(int64(w.start + w.windowMillis)), nil
+	default:
+		return time.Now(), nil
+	}
+}
+
+// Reserve approximates a reservation: the request is checked once, and a denied one carries the time after which it
+// fits in the weighted count. Budget cannot be reserved ahead of time, so maxWait is not used, and a retry after the
+// delay may be denied if other requests were counted meanwhile.
+func (l *limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return types.Reservation{OK: result.Allowed, Delay: result.RetryAfter}, err
+}
+
+// windows is the state of an identifier's counter as the script would see it now, all times in milliseconds.
+type windows struct {
+	previousCount, currentCount float64
+	start                       float64 // Start of the current window
+	elapsed                     float64 // Time since start
+	windowMillis                float64
+}
+
+// read reads the identifier's counter and moves it to the window running now, as the script would.
+func (l *limiter) read(ctx context.Context, identifier string) (windows, error) {
+	redisKey := l.keys.Key(identifier)
+	fields, err := l.client.HMGet(ctx, redisKey, "pc", "cc", "cws", "ts", redisstate.VersionField).Result()
+	if err != nil {
+		log.Error().Err(err).Str("limiter_type", "SlidingWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Redis pressure read failed")
+		return windows{}, fmt.Errorf("redis pressure read failed for limiter '%s', identifier '%s': %w", l.key, redact.Identifier(identifier), err)
+	}
+	if err := redisstate.CheckVersion(l.key, config.SlidingWindowCounter, fields[4]); err != nil {
+		return windows{}, err
+	}
+	w := windows{windowMillis: float64(l.windowSize.Milliseconds())}
+	w.previousCount, _ = redisstate.Float(fields[0])
+	w.currentCount, _ = redisstate.Float(fields[1])
+	w.start, _ = redisstate.Float(fields[2])
+	now := float64(time.Now().UnixMilli())
+	if lastSeen, ok := redisstate.Float(fields[3]); ok {
+		now = max(now, lastSeen)
+	}
+	w.elapsed = now - w.start
+	switch {
+	case w.start == 0 || w.elapsed >= 2*w.windowMillis:
+		return windows{windowMillis: w.windowMillis}, nil
+	case w.elapsed >= w.windowMillis:
+		// The script moves to a new window, so the current count becomes the previous one
+		w.previousCount, w.currentCount = w.currentCount, 0
+		w.start += w.windowMillis
+		w.elapsed -= w.windowMillis
+	}
+	return w, nil
+}
+
+// allow evaluates a request costing n units at time t.
+func (l *limiter) allow(ctx context.Context, identifier string, n int, t time.Time) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
 	// Construct the specific key for this identifier
-	redisKey := l.key + ":" + identifier
+	redisKey := l.keys.Key(identifier)
 
-	// Get current time in milliseconds
-	now := time.Now().UnixMilli()
+	// Get request time in milliseconds
+	now := t.UnixMilli()
 
 	// Window size in milliseconds
 	windowSizeMillis := l.windowSize.Milliseconds()
 
 	// Execute the Lua script
 	// KEYS: [itemKey]
-	// ARGV: [now, windowSizeMillis, limit]
+	// ARGV: [now, windowSizeMillis, limit, cost, schemaVersion]
 
-	result, err := l.script.Run(ctx, l.client, []string{redisKey}, now, windowSizeMillis, l.limit).Result()
+	args := redisargs.Get(redisKey).Add(now, windowSizeMillis, l.limit, n, redisstate.SchemaVersion)
+	defer args.Release()
+	result, err := l.script.Run(ctx, l.client, args.Keys, args.Values...).Result()
 
 	if err != nil {
 		// Added limiter key and identifier to error log
-		log.Error().Err(err).Str("limiter_type", "SlidingWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", identifier).Str("redis_key", redisKey).Msg("Limiter: Error executing script")
-		return false, fmt.Errorf("redis script error for limiter '%s', identifier '%s': %w", l.key, identifier, err) // Deny in case of error
+		log.Error().Err(err).Str("limiter_type", "SlidingWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Error executing script")
+		return types.Result{}, fmt.Errorf("redis script error for limiter '%s', identifier '%s': %w", l.key, redact.Identifier(identifier), err) // Deny in case of error
 	}
 
-	// The script returns 1 for allowed, 0 for denied
-	allowed, ok := result.(int64)
-	if !ok {
-		err := fmt.Errorf("unexpected result type from Redis script for key '%s': %T", redisKey, result)
+	// The script returns {allowed, status, remaining, reset_ms, retry_ms}: 1 for allowed, 0 for denied, the redisstate
+	// status, and the budget left with the times until it is restored and until a denied request fits
+	values, err := redisstate.Ints(result, 5)
+	if err != nil {
+		err = fmt.Errorf("%w for key '%s'", err, redisKey)
 		// Added limiter key and identifier to error log
-		log.Error().Err(err).Str("limiter_type", "SlidingWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", identifier).Str("redis_key", redisKey).Type("result_type", result).Msg("Limiter: Unexpected result type from script")
-		return false, err // Deny if result is not int64
+		log.Error().Err(err).Str("limiter_type", "SlidingWindowCounter").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Type("result_type", result).Msg("Limiter: Unexpected result type from script")
+		return types.Result{}, err // Deny if result is malformed
+	}
+	if err := redisstate.Check(l.key, config.SlidingWindowCounter, values[1]); err != nil {
+		return types.Result{}, err
 	}
 
-	isAllowed := allowed == 1
-
-	return isAllowed, nil
+	return types.Result{
+		Allowed:    values[0] == 1,
+		Limit:      l.limit,
+		Remaining:  values[2],
+		ResetAt:    time.Now().Add(time.Duration(values[3]) * time.Millisecond),
+		RetryAfter: time.Duration(values[4]) * time.Millisecond,
+	}, nil
 }
@@ -0,0 +1,205 @@
+// Package swlinmemory provides an in-memory implementation of the Sliding Window Log rate limiting algorithm.
+package swlinmemory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/internal/clock"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// limiter is the in-memory implementation of the Sliding Window Log.
+// It stores the log of each identifier in a sync.Map.
+type limiter struct {
+	key        string // Limiter key from config
+	logs       sync.Map
+	windowSize time.Duration
+	limit      int64
+}
+
+// entry is an allowed request in a log.
+type entry struct {
+	at   time.Time
+	cost int64
+}
+
+// requestLog holds the requests allowed for an identifier within the last window, oldest first. Times earlier than
+// the latest are treated as the latest (see clock), so entries are appended in order and expired ones are pruned by
+// binary search.
+type requestLog struct {
+	entries  []entry
+	total    int64     // Sum of the costs of entries
+	lastSeen time.Time // latest request time observed, used to guard against time moving backwards
+	mu       sync.Mutex
+}
+
+// NewLimiter creates a new in-memory Sliding Window Log limiter.
+// It takes a unique key for the limiter, the size of the sliding window, and the maximum limit of requests within the window.
+func NewLimiter(key string, windowSize time.Duration, limit int64) *limiter {
+	log.Info().Str("limiter_type", "SlidingWindowLog").Str("backend", "InMemory").Str("limiter_key", key).Dur("window", windowSize).Int64("limit", limit).Msg("Limiter: Initialized")
+	return &limiter{
+		key:        key,
+		windowSize: windowSize,
+		limit:      limit,
+	}
+}
+
+// Allow checks if a request is allowed for the given identifier based on the Sliding Window Log algorithm.
+func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request costing n units for the given identifier fits in the requests logged over the last window.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return result.Allowed, err
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	result, err := l.allow(ctx, identifier, 1, t)
+	return result.Allowed, err
+}
+
+// AllowDetailed checks a request costing n units for the given identifier as AllowN does, with the budget left in the
+// window, when the identifier's logged requests all leave it and, for a denied request, when enough of them have.
+func (l *limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	return l.allow(ctx, identifier, n, time.Now())
+}
+
+// Reserve checks if a request costing n units for the identifier fits in the window. Budget cannot be reserved ahead
+// of time, since it frees up as logged requests leave the window: a denied request carries the time after which it
+// fits, if it ever does. maxWait is not used.
+func (l *limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return types.Reservation{OK: result.Allowed, Delay: result.RetryAfter}, err
+}
+
+// allow evaluates a request costing n units at time now.
+func (l *limiter) allow(ctx context.Context, identifier string, n int, now time.Time) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
+	// Load before LoadOrStore, so checks of known identifiers do not allocate a log to discard
+	logIface, ok := l.logs.Load(identifier)
+	if !ok {
+		logIface, _ = l.logs.LoadOrStore(identifier, &requestLog{lastSeen: now})
+	}
+	requests, ok := logIface.(*requestLog)
+	if !ok {
+		err := fmt.Errorf("unexpected state type for identifier %s in in-memory limiter '%s'", identifier, l.key)
+		log.Error().Err(err).Str("limiter_type", "SlidingWindowLog").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Error in Allow")
+		return types.Result{}, err
+	}
+	requests.mu.Lock()
+	defer requests.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		log.Warn().Err(ctx.Err()).Str("limiter_type", "SlidingWindowLog").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Context cancelled during check")
+		return types.Result{}, ctx.Err()
+	default:
+	}
+
+	// Never let time move backwards for this identifier
+	now = clock.Clamp(now, requests.lastSeen)
+	requests.lastSeen = now
+	l.prune(requests, now)
+
+	cost := int64(n)
+	result := types.Result{Limit: l.limit}
+	if requests.total+cost <= l.limit {
+		requests.entries = append(requests.entries, entry{at: now, cost: cost})
+		requests.total += cost
+		result.Allowed = true
+	} else if cost <= l.limit {
+		result.RetryAfter = l.fitsAt(requests, cost).Sub(now)
+	}
+	result.Remaining = max(l.limit-requests.total, 0)
+	result.ResetAt = now
+	if len(requests.entries) > 0 {
+		result.ResetAt = requests.entries[len(requests.entries)-1].at.Add(l.windowSize)
+	}
+	return result, nil
+}
+
+// prune drops the requests that left the window ending at time now. The caller holds requests.mu.
+func (l *limiter) prune(requests *requestLog, now time.Time) {
+	start := now.Add(-l.windowSize)
+	expired := sort.Search(len(requests.entries), func(i int) bool {
+		return requests.entries[i].at.After(start)
+	})
+	if expired == 0 {
+		return
+	}
+	for _, e := range requests.entries[:expired] {
+		requests.total -= e.cost
+	}
+	// Copy the live entries to the front, so the backing array does not grow with every window
+	requests.entries = append(requests.entries[:0], requests.entries[expired:]...)
+}
+
+// fitsAt returns when enough logged requests have left the window for cost more units to fit. The caller holds
+// requests.mu, and cost is at most the limit.
+func (l *limiter) fitsAt(requests *requestLog, cost int64) time.Time {
+	excess := requests.total + cost - l.limit
+	for _, e := range requests.entries {
+		excess -= e.cost
+		if excess <= 0 {
+			return e.at.Add(l.windowSize)
+		}
+	}
+	return requests.lastSeen
+}
+
+// Pressure returns the fraction of the limit the identifier has used in the window ending now.
+func (l *limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	logIface, ok := l.logs.Load(identifier)
+	if !ok {
+		return 0, nil
+	}
+	requests := logIface.(*requestLog)
+	requests.mu.Lock()
+	defer requests.mu.Unlock()
+	l.prune(requests, clock.Clamp(time.Now(), requests.lastSeen))
+	return min(float64(requests.total)/float64(l.limit), 1), nil
+}
+
+// ResetTime returns the time at which the identifier's latest logged request leaves the window, or now if none is in it.
+func (l *limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	now := time.Now()
+	logIface, ok := l.logs.Load(identifier)
+	if !ok {
+		return now, nil
+	}
+	requests := logIface.(*requestLog)
+	requests.mu.Lock()
+	defer requests.mu.Unlock()
+	l.prune(requests, clock.Clamp(now, requests.lastSeen))
+	if len(requests.entries) == 0 {
+		return now, nil
+	}
+	return requests.entries[len(requests.entries)-1].at.Add(l.windowSize), nil
+}
+
+// KeyCount returns the number of identifiers with a log, including idle ones, since logs are only dropped by Forget.
+func (l *limiter) KeyCount() (int, bool) {
+	count := 0
+	l.logs.Range(func(_, _ interface{}) bool {
+		count++
+		return true
+	})
+	return count, true
+}
+
+// Forget drops the identifier's log, so its next request starts with an empty window.
+func (l *limiter) Forget(identifier string) {
+	l.logs.Delete(identifier)
+}
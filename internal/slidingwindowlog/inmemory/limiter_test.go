@@ -0,0 +1,92 @@
+// Package swlinmemory_test contains tests for the in-memory sliding window log.
+package swlinmemory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	swlinmemory "learn.ratelimiter/internal/slidingwindowlog/inmemory"
+)
+
+// TestSlidingWindowLog tests that requests are counted exactly over the window ending at each request, whatever the
+// window boundaries.
+func TestSlidingWindowLog(t *testing.T) {
+	limiter := swlinmemory.NewLimiter("test_sliding_log", 100*time.Millisecond, 3)
+	ctx := context.Background()
+	start := time.UnixMilli(1_700_000_000_090)
+
+	for i, tc := range []struct {
+		offset  time.Duration
+		allowed bool
+	}{
+		{0, true},
+		{5 * time.Millisecond, true},
+		{10 * time.Millisecond, true},
+		{50 * time.Millisecond, false},
+		// The first request leaves the window only once a full window has passed since it
+		{100 * time.Millisecond, true},
+		{101 * time.Millisecond, false},
+		{105 * time.Millisecond, true},
+		// A time earlier than the latest seen is treated as the latest
+		{20 * time.Millisecond, false},
+	} {
+		allowed, err := limiter.AllowAt(ctx, "client1", start.Add(tc.offset))
+		if err != nil {
+			t.Fatalf("AllowAt failed: %v", err)
+		}
+		if allowed != tc.allowed {
+			t.Errorf("Request %d at +%v: expected allowed=%v, got %v", i+1, tc.offset, tc.allowed, allowed)
+		}
+	}
+}
+
+// TestAllowDetailed tests that costs are logged in full, and that a denied request carries the time at which enough
+// logged requests have left the window for it to fit.
+func TestAllowDetailed(t *testing.T) {
+	limiter := swlinmemory.NewLimiter("test_sliding_log_detailed", time.Minute, 5)
+	ctx := context.Background()
+
+	result, err := limiter.AllowDetailed(ctx, "client1", 3)
+	if err != nil {
+		t.Fatalf("AllowDetailed failed: %v", err)
+	}
+	if !result.Allowed || result.Limit != 5 || result.Remaining != 2 {
+		t.Fatalf("Expected 3 units allowed with 2 remaining, got %+v", result)
+	}
+	if wait := time.Until(result.ResetAt); wait <= 59*time.Second || wait > time.Minute {
+		t.Errorf("Expected the budget restored in about a minute, got %v", wait)
+	}
+
+	result, err = limiter.AllowDetailed(ctx, "client1", 3)
+	if err != nil {
+		t.Fatalf("AllowDetailed failed: %v", err)
+	}
+	if result.Allowed || result.Remaining != 2 {
+		t.Fatalf("Expected 3 more units denied with 2 remaining, got %+v", result)
+	}
+	if result.RetryAfter <= 59*time.Second || result.RetryAfter > time.Minute {
+		t.Errorf("Expected a retry once the first request leaves the window, got %v", result.RetryAfter)
+	}
+
+	if result, _ := limiter.AllowDetailed(ctx, "client1", 6); result.Allowed || result.RetryAfter != 0 {
+		t.Errorf("Expected a request above the limit denied without retry time, got %+v", result)
+	}
+	if pressure, _ := limiter.Pressure(ctx, "client1"); pressure != 0.6 {
+		t.Errorf("Expected pressure 0.6, got %v", pressure)
+	}
+}
+
+// BenchmarkAllowFullLog measures checks against a log holding a full window of 1k requests.
+func BenchmarkAllowFullLog(b *testing.B) {
+	limiter := swlinmemory.NewLimiter("bench_sliding_log", time.Second, 1000)
+	ctx := context.Background()
+	start := time.UnixMilli(1_700_000_000_000)
+	for i := 0; i < 1000; i++ {
+		limiter.AllowAt(ctx, "client1", start.Add(time.Duration(i)*time.Millisecond))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		limiter.AllowAt(ctx, "client1", start.Add(time.Second+time.Duration(i)*time.Millisecond))
+	}
+}
@@ -0,0 +1,182 @@
+// Package swlmemcache provides a Memcache implementation of the Sliding Window Log rate limiting algorithm.
+package swlmemcache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/rs/zerolog/log"
+
+	"learn.ratelimiter/internal/clock"
+	"learn.ratelimiter/internal/codec"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// maxAttempts is the number of times a request reads and updates the log before giving up, when other requests
+// update it in between.
+const maxAttempts = 5
+
+// limiter is the Memcache implementation of the Sliding Window Log.
+type limiter struct {
+	key        string
+	windowSize time.Duration
+	limit      int64
+	client     *memcache.Client
+	codec      codec.Codec // encoding of stored state; any format is read
+	noCAS      bool        // update state with set instead of cas, for proxies without cas
+}
+
+// Option configures optional behaviour of a limiter.
+type Option func(*limiter)
+
+// WithoutCAS updates state with set instead of cas, for servers behind proxies that do not support cas (see
+// tbmemcache.WithoutCAS). Concurrent requests for the same identifier may then overwrite each other's update.
+func WithoutCAS() Option {
+	return func(l *limiter) {
+		l.noCAS = true
+	}
+}
+
+// slidingLogState represents the requests allowed for an identifier within the last window, oldest first, stored in
+// Memcache. Times earlier than the latest are treated as the latest (see clock), so times are appended in order and
+// expired requests are pruned by binary search.
+type slidingLogState struct {
+	Times []int64 `json:"times" codec:"1"` // Unix milliseconds at which each request was allowed
+	Costs []int64 `json:"costs" codec:"2"` // Cost of each request
+}
+
+// NewLimiter creates a new Memcache Sliding Window Log limiter storing state with the given codec (JSON if nil).
+// State written by any codec is read, so the codec can be changed without resetting logs. Logs are created with add
+// and updated with cas, so concurrent requests from any instance are counted exactly (see WithoutCAS).
+func NewLimiter(key string, windowSize time.Duration, limit int64, client *memcache.Client, stateCodec codec.Codec, opts ...Option) types.CostLimiter {
+	if stateCodec == nil {
+		stateCodec = codec.JSON
+	}
+	l := &limiter{
+		key:        key,
+		windowSize: windowSize,
+		limit:      limit,
+		client:     client,
+		codec:      stateCodec,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	log.Info().Str("limiter_type", "SlidingWindowLog").Str("backend", "Memcache").Str("limiter_key", key).Dur("window", windowSize).Int64("limit", limit).Str("codec", stateCodec.Name()).Bool("cas", !l.noCAS).Msg("Limiter: Initialized")
+	return l
+}
+
+// Allow checks if a request for the given identifier is allowed based on the Sliding Window Log algorithm.
+func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request costing n units for the given identifier fits in the requests logged over the last window.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	return l.allow(ctx, identifier, n, time.Now())
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+// Times earlier than the latest logged request are treated as the latest logged request.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	return l.allow(ctx, identifier, 1, t)
+}
+
+// allow evaluates a request costing n units at time now. Without CAS, the updated log overwrites any update made by
+// another instance since it was read.
+func (l *limiter) allow(ctx context.Context, identifier string, n int, now time.Time) (bool, error) {
+	if err := types.CheckCost(n); err != nil {
+		return false, err
+	}
+	itemKey := "sliding_log:" + l.key + ":" + identifier
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		item, err := l.client.Get(itemKey)
+		if err != nil && err != memcache.ErrCacheMiss {
+			log.Error().Err(err).Str("limiter_type", "SlidingWindowLog").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to get state from Memcache")
+			return false, fmt.Errorf("get state from memcache: %w", err)
+		}
+
+		state := &slidingLogState{}
+		if item != nil {
+			if err := l.codec.Unmarshal(item.Value, state); err != nil {
+				log.Error().Err(err).Str("limiter_type", "SlidingWindowLog").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to unmarshal state from Memcache")
+				return false, fmt.Errorf("unmarshal state: %w", err)
+			}
+			if len(state.Costs) != len(state.Times) {
+				return false, fmt.Errorf("unmarshal state: %d times for %d costs", len(state.Times), len(state.Costs))
+			}
+		}
+
+		if !l.take(state, int64(n), now) {
+			// A denied request leaves the stored log untouched, since expired requests are pruned on the next update
+			log.Debug().Str("limiter_type", "SlidingWindowLog").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Int("requests", len(state.Times)).Msg("Limiter: Request denied")
+			return false, nil
+		}
+
+		value, err := l.codec.Marshal(state)
+		if err != nil {
+			log.Error().Err(err).Str("limiter_type", "SlidingWindowLog").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to marshal state for Memcache")
+			return false, fmt.Errorf("marshal state: %w", err)
+		}
+		// The log expires once its latest request has left the window
+		expiration := int32(math.Ceil(l.windowSize.Seconds()))
+		switch {
+		case item == nil:
+			// Add fails if another request created the log since it was read
+			err = l.client.Add(&memcache.Item{Key: itemKey, Value: value, Expiration: expiration})
+		case l.noCAS:
+			err = l.client.Set(&memcache.Item{Key: itemKey, Value: value, Expiration: expiration})
+		default:
+			item.Value = value
+			item.Expiration = expiration
+			err = l.client.CompareAndSwap(item)
+		}
+		if err == memcache.ErrNotStored || err == memcache.ErrCASConflict {
+			// The log was created, updated or evicted since it was read
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Str("limiter_type", "SlidingWindowLog").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to set state in Memcache")
+			return false, fmt.Errorf("set state in memcache: %w", err)
+		}
+		log.Debug().Str("limiter_type", "SlidingWindowLog").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Int("requests", len(state.Times)).Msg("Limiter: Request allowed")
+		return true, nil
+	}
+
+	err := fmt.Errorf("state of identifier changed by %d concurrent requests", maxAttempts)
+	log.Warn().Err(err).Str("limiter_type", "SlidingWindowLog").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Too much contention updating state in Memcache")
+	return false, fmt.Errorf("update state in memcache: %w", err)
+}
+
+// take prunes the requests that left the window ending at time now and logs a request costing cost units if it fits.
+// It reports whether the request was logged.
+func (l *limiter) take(state *slidingLogState, cost int64, now time.Time) bool {
+	nowMillis := now.UnixMilli()
+	if last := len(state.Times) - 1; last >= 0 {
+		// Never let time move backwards for this log
+		nowMillis = clock.Clamp(now, time.UnixMilli(state.Times[last])).UnixMilli()
+	}
+
+	start := nowMillis - l.windowSize.Milliseconds()
+	expired := sort.Search(len(state.Times), func(i int) bool {
+		return state.Times[i] > start
+	})
+	state.Times, state.Costs = state.Times[expired:], state.Costs[expired:]
+
+	var total int64
+	for _, c := range state.Costs {
+		total += c
+	}
+	if total+cost > l.limit {
+		return false
+	}
+	state.Times = append(state.Times, nowMillis)
+	state.Costs = append(state.Costs, cost)
+	return true
+}
@@ -0,0 +1,56 @@
+// Package swlmemcache_test contains benchmarks for the Memcache sliding window log.
+package swlmemcache_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+
+	"learn.ratelimiter/internal/codec"
+	swlmemcache "learn.ratelimiter/internal/slidingwindowlog/memcache"
+	"learn.ratelimiter/internal/testenv"
+	"learn.ratelimiter/types"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testenv.Cleanup()
+	os.Exit(code)
+}
+
+// BenchmarkAllowFullLog measures requests against logs of 10 and 1000 timestamps, each pruning the oldest request and
+// logging itself. The difference between the two is the cost of decoding, pruning and encoding the longer log.
+func BenchmarkAllowFullLog(b *testing.B) {
+	client := memcache.New(testenv.Memcached(b))
+	for _, name := range []string{codec.NameJSON, codec.NameMsgPack} {
+		stateCodec, err := codec.New(name)
+		if err != nil {
+			b.Fatalf("New(%q) returned error: %v", name, err)
+		}
+		for _, size := range []int64{10, 1000} {
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				// The window outlasts the benchmark, so the log never expires in Memcache
+				window := time.Hour
+				step := window / time.Duration(size)
+				limiter := swlmemcache.NewLimiter(fmt.Sprintf("bench_sliding_log_%d", time.Now().UnixNano()), window, size, client, stateCodec).(types.TimeLimiter)
+				ctx := context.Background()
+				start := time.UnixMilli(1_700_000_000_000)
+				for i := int64(0); i < size; i++ {
+					if allowed, err := limiter.AllowAt(ctx, "client1", start.Add(time.Duration(i)*step)); err != nil || !allowed {
+						b.Fatalf("Filling the log: AllowAt returned (%v, %v)", allowed, err)
+					}
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := limiter.AllowAt(ctx, "client1", start.Add(window+time.Duration(i)*step)); err != nil {
+						b.Fatalf("AllowAt returned error: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
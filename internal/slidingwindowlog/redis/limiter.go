@@ -0,0 +1,158 @@
+// Package swlredis provides a Redis implementation of the Sliding Window Log rate limiting algorithm.
+package swlredis
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/internal/backendkey"
+	"learn.ratelimiter/internal/redisargs"
+	"learn.ratelimiter/internal/redisscripts"
+	"learn.ratelimiter/internal/redisstate"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// limiter is the Redis implementation of the Sliding Window Log.
+// It uses a Redis sorted set per identifier holding one member per unit allowed within the window.
+type limiter struct {
+	key        string // Limiter key from config
+	client     *redis.Client
+	windowSize time.Duration
+	limit      int64
+	script     *redisscripts.Script
+	keys       *backendkey.Builder // Composes the Redis key of each identifier
+}
+
+// Option configures optional behaviour of a limiter.
+type Option func(*limiter)
+
+// WithKeyCache caches the Redis keys of up to size frequent identifiers instead of composing them on every check.
+func WithKeyCache(size int) Option {
+	return func(l *limiter) {
+		l.keys = backendkey.NewBuilder(size, "sliding_log", l.key)
+	}
+}
+
+// NewLimiter creates a new Redis-based Sliding Window Log limiter.
+// It takes a unique key for the limiter, the size of the sliding window, the maximum limit of requests within the window, a Redis client instance,
+// and optional behaviour. Sorted sets are kept under keys prefixed with "sliding_log", so they never collide with the
+// hashes of a sliding window counter with the same key.
+func NewLimiter(key string, windowSize time.Duration, limit int64, client *redis.Client, opts ...Option) *limiter {
+	log.Info().Str("limiter_type", "SlidingWindowLog").Str("backend", "Redis").Str("limiter_key", key).Dur("window", windowSize).Int64("limit", limit).Msg("Limiter: Initialized")
+	l := &limiter{
+		key:        key,
+		windowSize: windowSize,
+		limit:      limit,
+		client:     client,
+		script:     redisscripts.SlidingLogAllow,
+		keys:       backendkey.NewBuilder(0, "sliding_log", key),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Allow checks if a request is allowed for the given identifier based on the Sliding Window Log algorithm using Redis.
+// It executes a Lua script on Redis to atomically check and log the request.
+func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request costing n units for the given identifier fits in the requests logged over the last window.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return result.Allowed, err
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+// The script treats times earlier than the latest time logged for the identifier as that latest time.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	result, err := l.allow(ctx, identifier, 1, t)
+	return result.Allowed, err
+}
+
+// AllowDetailed checks a request costing n units for the given identifier as AllowN does, with the budget left in the
+// window, when the identifier's logged requests all leave it and, for a denied request, when enough of them have, all
+// computed by the script.
+func (l *limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	return l.allow(ctx, identifier, n, time.Now())
+}
+
+// Reserve approximates a reservation: the request is checked once, and a denied one carries the time after which it
+// fits in the window. Budget cannot be reserved ahead of time, so maxWait is not used, and a retry after the delay
+// may be denied if other requests were logged meanwhile.
+func (l *limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return types.Reservation{OK: result.Allowed, Delay: result.RetryAfter}, err
+}
+
+// Pressure returns the fraction of the limit the identifier has used in the window ending now.
+// It counts the logged units without logging a request.
+func (l *limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	redisKey := l.keys.Key(identifier)
+	start := time.Now().Add(-l.windowSize).UnixMilli()
+	count, err := l.client.ZCount(ctx, redisKey, "("+strconv.FormatInt(start, 10), "+inf").Result()
+	if err != nil {
+		log.Error().Err(err).Str("limiter_type", "SlidingWindowLog").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Redis pressure read failed")
+		return 0, fmt.Errorf("redis pressure read failed for limiter '%s', identifier '%s': %w", l.key, redact.Identifier(identifier), err)
+	}
+	return min(float64(count)/float64(l.limit), 1), nil
+}
+
+// ResetTime returns the time at which the identifier's latest logged request leaves the window, or now if none is in it.
+func (l *limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	redisKey := l.keys.Key(identifier)
+	latest, err := l.client.ZRangeWithScores(ctx, redisKey, -1, -1).Result()
+	if err != nil {
+		log.Error().Err(err).Str("limiter_type", "SlidingWindowLog").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Redis reset time read failed")
+		return time.Time{}, fmt.Errorf("redis reset time read failed for limiter '%s', identifier '%s': %w", l.key, redact.Identifier(identifier), err)
+	}
+	now := time.Now()
+	if len(latest) == 0 {
+		return now, nil
+	}
+	return time.UnixMilli(int64(latest[0].Score)).Add(l.windowSize), nil
+}
+
+// allow evaluates a request costing n units at time t.
+func (l *limiter) allow(ctx context.Context, identifier string, n int, t time.Time) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
+	redisKey := l.keys.Key(identifier)
+
+	// KEYS: [itemKey]
+	// ARGV: [now, windowSizeMillis, limit, cost, nonce]
+	// The nonce keeps the members logged by concurrent requests in the same millisecond distinct
+	nonce := strconv.FormatUint(rand.Uint64(), 36)
+	args := redisargs.Get(redisKey).Add(t.UnixMilli(), l.windowSize.Milliseconds(), l.limit, n, nonce)
+	defer args.Release()
+	result, err := l.script.Run(ctx, l.client, args.Keys, args.Values...).Result()
+	if err != nil {
+		log.Error().Err(err).Str("limiter_type", "SlidingWindowLog").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Error executing script")
+		return types.Result{}, fmt.Errorf("redis script error for limiter '%s', identifier '%s': %w", l.key, redact.Identifier(identifier), err)
+	}
+
+	// The script returns {allowed, remaining, reset_ms, retry_ms}
+	values, err := redisstate.Ints(result, 4)
+	if err != nil {
+		err = fmt.Errorf("%w for key '%s'", err, redisKey)
+		log.Error().Err(err).Str("limiter_type", "SlidingWindowLog").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Type("result_type", result).Msg("Limiter: Unexpected result type from script")
+		return types.Result{}, err
+	}
+	return types.Result{
+		Allowed:    values[0] == 1,
+		Limit:      l.limit,
+		Remaining:  values[1],
+		ResetAt:    time.Now().Add(time.Duration(values[2]) * time.Millisecond),
+		RetryAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,50 @@
+// Package swlredis_test contains tests for the Redis sliding window log.
+package swlredis_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	swlredis "learn.ratelimiter/internal/slidingwindowlog/redis"
+	"learn.ratelimiter/internal/testenv"
+)
+
+// TestSlidingWindowLog tests that requests are counted exactly over the window ending at each request, as in the
+// in-memory limiter.
+func TestSlidingWindowLog(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	defer client.Close()
+	ctx := context.Background()
+	limiter := swlredis.NewLimiter("test_sliding_log", 100*time.Millisecond, 3, client)
+	start := time.UnixMilli(1_700_000_000_090)
+	// A unique identifier keeps state left by earlier runs on a shared server from counting
+	identifier := fmt.Sprintf("log-%d", time.Now().UnixNano())
+
+	for i, tc := range []struct {
+		offset  time.Duration
+		allowed bool
+	}{
+		{0, true},
+		{5 * time.Millisecond, true},
+		{10 * time.Millisecond, true},
+		{50 * time.Millisecond, false},
+		// The first request leaves the window only once a full window has passed since it
+		{100 * time.Millisecond, true},
+		{101 * time.Millisecond, false},
+		{105 * time.Millisecond, true},
+		// A time earlier than the latest logged is treated as the latest
+		{20 * time.Millisecond, false},
+	} {
+		allowed, err := limiter.AllowAt(ctx, identifier, start.Add(tc.offset))
+		if err != nil {
+			t.Fatalf("AllowAt failed: %v", err)
+		}
+		if allowed != tc.allowed {
+			t.Errorf("Request %d at +%v: expected allowed=%v, got %v", i+1, tc.offset, tc.allowed, allowed)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+// Package soak detects accounting drift: limiters admitting more, or fewer, requests than their parameters allow over
+// long runs, e.g., from rounding or floating point errors accumulating in an algorithm or backend. Its tests send a
+// steady stream of requests for one identifier, several times faster than the limit, to each backend of each
+// algorithm and compare the requests admitted with the most the parameters allow over the run:
+//
+//   - Fixed and sliding window counters: the limit per window the run touched.
+//   - Token bucket: the capacity plus the whole tokens refilled over the run.
+//   - Leaky bucket: the capacity plus the requests drained over the run.
+//
+// Admitting more is always a failure. Admitting less is drift once the shortfall from what an exact limiter admits
+// under sustained overload exceeds a tolerance. That is the maximum, except for sliding window counters, which admit
+// one request less than the limit per window, and fewer in the partial windows a run starts and ends in.
+//
+// TestSoakFakeClock replays the run with AllowAt, so hours pass in seconds. It simulates 10 minutes by default.
+// TestSoakRealClock sends the requests with Allow over wall clock time, and only runs when a duration is set. Both
+// are configured by environment variables:
+//
+//   - RATELIMITER_SOAK_DURATION (e.g., "6h"): the duration simulated, and that of the real clock run.
+//   - RATELIMITER_SOAK_TOLERANCE (e.g., "0.02"): the largest shortfall allowed, as a fraction of the requests expected (default 0.01).
+//
+// For example:
+//
+//	RATELIMITER_SOAK_DURATION=6h go test -timeout 0 -v ./internal/soak
+//
+// Remote backends are provided by testenv, and skipped when it cannot provide a server.
+package soak
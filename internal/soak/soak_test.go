@@ -0,0 +1,230 @@
+package soak_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/go-redis/redis/v8"
+
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	fcredis "learn.ratelimiter/internal/fixedcounter/redis"
+	lbinmemory "learn.ratelimiter/internal/leakybucket/inmemory"
+	lbredis "learn.ratelimiter/internal/leakybucket/redis"
+	swinmemory "learn.ratelimiter/internal/slidingwindowcounter/inmemory"
+	swredis "learn.ratelimiter/internal/slidingwindowcounter/redis"
+	"learn.ratelimiter/internal/testenv"
+	tbinmemory "learn.ratelimiter/internal/tokenbucket/inmemory"
+	tbmemcache "learn.ratelimiter/internal/tokenbucket/memcache"
+	tbredis "learn.ratelimiter/internal/tokenbucket/redis"
+	"learn.ratelimiter/types"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testenv.Cleanup()
+	os.Exit(code)
+}
+
+// Environment variables configuring the soak tests.
+const (
+	durationEnv  = "RATELIMITER_SOAK_DURATION"
+	toleranceEnv = "RATELIMITER_SOAK_TOLERANCE"
+)
+
+const (
+	// defaultSimulated is the duration the fake clock run simulates unless durationEnv is set.
+	defaultSimulated = 10 * time.Minute
+	// defaultTolerance is the largest shortfall allowed unless toleranceEnv is set.
+	defaultTolerance = 0.01
+
+	// limit, window and rate are deliberately not round, so rounding errors do not cancel out.
+	// limit is the window limit and bucket capacity of every limiter under test.
+	limit = 13
+	// window is the window size of the window algorithms.
+	window = 7 * time.Second
+	// rate is the refill and leak rate of the bucket algorithms, in tokens per second.
+	rate = 3
+	// interval is the time between two requests, several times faster than any of the limits above.
+	interval = 97 * time.Millisecond
+)
+
+// pair creates the limiter of one algorithm and backend, and returns the most and the fewest requests it should
+// admit for one identifier between two request times under sustained overload.
+type pair struct {
+	newLimiter  func(t *testing.T, key string) types.TimeLimiter
+	maxAdmitted func(first, last time.Time) int64
+	minAdmitted func(first, last time.Time) int64
+}
+
+// windowMax returns the limit per window touched between first and last, windows starting at multiples of the
+// window size since the Unix epoch. A fixed window counter admits exactly that under sustained overload.
+func windowMax(first, last time.Time) int64 {
+	windows := last.UnixNano()/int64(window) - first.UnixNano()/int64(window) + 1
+	return windows * limit
+}
+
+// slidingMin returns one request less than the limit per window entirely between first and last. The sliding
+// window counter only admits requests while the count of the current window plus the weighted count of the previous
+// one stays below the limit, and the previous window still weighs when the current one ends, so a window admits one
+// request less than the limit under sustained overload. The partial first and last windows admit fewer.
+func slidingMin(first, last time.Time) int64 {
+	windows := last.UnixNano()/int64(window) - first.UnixNano()/int64(window) - 1
+	return max(windows, 0) * (limit - 1)
+}
+
+// bucketMax returns the capacity plus the whole tokens refilled or drained between first and last. A bucket admits
+// exactly that under sustained overload.
+func bucketMax(first, last time.Time) int64 {
+	return limit + int64(math.Floor(rate*last.Sub(first).Seconds()))
+}
+
+// pairs returns every algorithm and backend pair.
+func pairs() map[string]pair {
+	return map[string]pair{
+		"fixed_window/in_memory": {func(t *testing.T, key string) types.TimeLimiter {
+			return fcinmemory.NewLimiter(key, window, limit, fcinmemory.WithWallClockAlignment())
+		}, windowMax, windowMax},
+		"fixed_window/redis": {func(t *testing.T, key string) types.TimeLimiter {
+			return fcredis.NewLimiter(redisClient(t), key, window, limit, false)
+		}, windowMax, windowMax},
+		"sliding_window/in_memory": {func(t *testing.T, key string) types.TimeLimiter {
+			return swinmemory.NewLimiter(key, window, limit)
+		}, windowMax, slidingMin},
+		"sliding_window/redis": {func(t *testing.T, key string) types.TimeLimiter {
+			return swredis.NewLimiter(key, window, limit, redisClient(t))
+		}, windowMax, slidingMin},
+		"token_bucket/in_memory": {func(t *testing.T, key string) types.TimeLimiter {
+			return tbinmemory.NewLimiter(key, rate, limit, 0)
+		}, bucketMax, bucketMax},
+		"token_bucket/redis": {func(t *testing.T, key string) types.TimeLimiter {
+			return tbredis.NewLimiter(key, rate, limit, 0, redisClient(t)).(types.TimeLimiter)
+		}, bucketMax, bucketMax},
+		"token_bucket/memcache": {func(t *testing.T, key string) types.TimeLimiter {
+			client := memcache.New(testenv.Memcached(t))
+			return tbmemcache.NewLimiter(key, rate, limit, 0, client, nil).(types.TimeLimiter)
+		}, bucketMax, bucketMax},
+		"leaky_bucket/in_memory": {func(t *testing.T, key string) types.TimeLimiter {
+			return lbinmemory.NewLimiter(key, rate, limit).(types.TimeLimiter)
+		}, bucketMax, bucketMax},
+		"leaky_bucket/redis": {func(t *testing.T, key string) types.TimeLimiter {
+			return lbredis.NewLimiter(key, rate, limit, redisClient(t)).(types.TimeLimiter)
+		}, bucketMax, bucketMax},
+	}
+}
+
+// redisClient returns a client of the Redis server provided by testenv.
+func redisClient(t *testing.T) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// duration returns the duration set in durationEnv, and false if it is unset.
+func duration(t *testing.T) (time.Duration, bool) {
+	value := os.Getenv(durationEnv)
+	if value == "" {
+		return 0, false
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		t.Fatalf("Invalid %s '%s'", durationEnv, value)
+	}
+	return d, true
+}
+
+// tolerance returns the tolerance set in toleranceEnv, or defaultTolerance.
+func tolerance(t *testing.T) float64 {
+	value := os.Getenv(toleranceEnv)
+	if value == "" {
+		return defaultTolerance
+	}
+	tolerance, err := strconv.ParseFloat(value, 64)
+	if err != nil || tolerance < 0 || tolerance > 1 {
+		t.Fatalf("Invalid %s '%s'", toleranceEnv, value)
+	}
+	return tolerance
+}
+
+// check compares the requests admitted between the first and last request with the most and fewest the pair
+// should admit.
+func check(t *testing.T, p pair, admitted int64, first, last time.Time) {
+	t.Helper()
+	most, fewest := p.maxAdmitted(first, last), p.minAdmitted(first, last)
+	t.Logf("Admitted %d, expected between %d and %d over %s", admitted, fewest, most, last.Sub(first))
+	if admitted > most {
+		t.Errorf("Over-admission: %d requests admitted, at most %d allowed over %s", admitted, most, last.Sub(first))
+	}
+	if shortfall, tol := float64(fewest-admitted)/float64(max(fewest, 1)), tolerance(t); shortfall > tol {
+		t.Errorf("Drift: %d requests admitted, %.4f%% short of the %d expected over %s, tolerance %.4f%%", admitted, 100*shortfall, fewest, last.Sub(first), 100*tol)
+	}
+}
+
+// TestSoakFakeClock tests that no pair drifts over the duration simulated with AllowAt.
+func TestSoakFakeClock(t *testing.T) {
+	simulated, ok := duration(t)
+	if !ok {
+		simulated = defaultSimulated
+	}
+	// Start at a window boundary near the current time, so remote backends do not expire state during the run
+	now := time.Now().UnixNano()
+	start := time.Unix(0, now-now%int64(window))
+	for name, p := range pairs() {
+		t.Run(name, func(t *testing.T) {
+			limiter := p.newLimiter(t, fmt.Sprintf("soak-fake-%d", time.Now().UnixNano()))
+			var admitted int64
+			last := start
+			for at := start; at.Sub(start) <= simulated; at = at.Add(interval) {
+				allowed, err := limiter.AllowAt(context.Background(), "soak", at)
+				if err != nil {
+					t.Fatalf("AllowAt at +%s returned error: %v", at.Sub(start), err)
+				}
+				if allowed {
+					admitted++
+				}
+				last = at
+			}
+			check(t, p, admitted, start, last)
+		})
+	}
+}
+
+// TestSoakRealClock tests that no pair drifts over the duration set in RATELIMITER_SOAK_DURATION, checked with Allow.
+// Pairs run in parallel.
+func TestSoakRealClock(t *testing.T) {
+	d, ok := duration(t)
+	if !ok {
+		t.Skipf("Set %s to run the real clock soak test", durationEnv)
+	}
+	for name, p := range pairs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			limiter := p.newLimiter(t, fmt.Sprintf("soak-real-%d", time.Now().UnixNano()))
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			var admitted int64
+			var first, last time.Time
+			for deadline := time.Now().Add(d); time.Now().Before(deadline); <-ticker.C {
+				before := time.Now()
+				allowed, err := limiter.Allow(context.Background(), "soak")
+				if err != nil {
+					t.Fatalf("Allow returned error: %v", err)
+				}
+				if first.IsZero() {
+					first = before
+				}
+				// The limiter decided between before and now, so count every window and refill up to now
+				last = time.Now()
+				if allowed {
+					admitted++
+				}
+			}
+			check(t, p, admitted, first, last)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Package splitbudget provides a limiter that keeps separate read and write budgets under one limiter key.
+package splitbudget
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/types"
+)
+
+// limiter dispatches each request to the read or write budget based on the operation stored in the request context.
+type limiter struct {
+	key   string // Limiter key from config
+	read  types.Limiter
+	write types.Limiter
+}
+
+// NewLimiter creates a limiter that selects between a read and a write budget.
+// Requests are treated as reads unless their context carries types.OperationWrite (set by the HTTP middleware for mutating methods).
+func NewLimiter(key string, read, write types.Limiter) types.CostLimiter {
+	log.Info().Str("limiter_key", key).Msg("Limiter: Initialized with separate read and write budgets")
+	return &limiter{
+		key:   key,
+		read:  read,
+		write: write,
+	}
+}
+
+// Allow checks if a request for the given identifier is allowed by the budget matching the request's operation.
+func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.budget(ctx).Allow(ctx, identifier)
+}
+
+// AllowN checks if a request costing n units for the given identifier is allowed by the budget matching the request's operation.
+// Budgets that do not support AllowN are charged a single unit.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	budget := l.budget(ctx)
+	if costLimiter, ok := budget.(types.CostLimiter); ok {
+		return costLimiter.AllowN(ctx, identifier, n)
+	}
+	return budget.Allow(ctx, identifier)
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t by the budget matching the request's operation.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	if timeLimiter, ok := l.budget(ctx).(types.TimeLimiter); ok {
+		return timeLimiter.AllowAt(ctx, identifier, t)
+	}
+	return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+}
+
+// AllowDetailed checks a request costing n units for the given identifier with the budget matching the request's
+// operation, and returns its result.
+func (l *limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	return types.AllowDetailed(ctx, l.budget(ctx), identifier, n)
+}
+
+// Reserve reserves a request costing n units for the given identifier in the budget matching the request's operation.
+func (l *limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	return types.Reserve(ctx, l.budget(ctx), identifier, n, maxWait)
+}
+
+// Pressure returns the fraction of the identifier's budget in use for the request's operation.
+func (l *limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	return types.Pressure(ctx, l.budget(ctx), identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget for the request's operation is fully restored.
+func (l *limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	return types.ResetTime(ctx, l.budget(ctx), identifier)
+}
+
+// Forget drops the identifier's state in both budgets.
+func (l *limiter) Forget(identifier string) {
+	types.Forget(l.read, identifier)
+	types.Forget(l.write, identifier)
+}
+
+// budget returns the sub-budget for the operation stored in ctx.
+func (l *limiter) budget(ctx context.Context) types.Limiter {
+	if types.OperationFromContext(ctx) == types.OperationWrite {
+		return l.write
+	}
+	return l.read
+}
@@ -0,0 +1,46 @@
+// Package splitbudget_test contains tests for limiters with separate read and write budgets.
+package splitbudget_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/internal/splitbudget"
+	"learn.ratelimiter/types"
+)
+
+// TestOptionalMethods tests that detailed checks, reservations, pressure and reset times use the budget of the
+// request's operation.
+func TestOptionalMethods(t *testing.T) {
+	read := fcinmemory.NewLimiter("test_split:read", time.Minute, 4)
+	write := fcinmemory.NewLimiter("test_split#write", time.Minute, 2)
+	limiter := splitbudget.NewLimiter("test_split", read, write)
+	readCtx := context.Background()
+	writeCtx := types.WithOperation(readCtx, types.OperationWrite)
+
+	result, err := types.AllowDetailed(writeCtx, limiter, "client1", 1)
+	if err != nil || !result.Allowed || result.Limit != 2 || result.Remaining != 1 {
+		t.Errorf("Expected a write allowed by the write budget of 2, got %+v, %v", result, err)
+	}
+	if reservation, err := types.Reserve(readCtx, limiter, "client1", 2, 0); err != nil || !reservation.OK {
+		t.Errorf("Expected reads reserved in the read budget, got %+v, %v", reservation, err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		want float64
+	}{
+		{"read", readCtx, 0.5},
+		{"write", writeCtx, 0.5},
+	} {
+		if pressure, err := types.Pressure(tc.ctx, limiter, "client1"); err != nil || pressure != tc.want {
+			t.Errorf("%s: expected pressure %v, got %v, %v", tc.name, tc.want, pressure, err)
+		}
+		if resetAt, err := types.ResetTime(tc.ctx, limiter, "client1"); err != nil || !resetAt.After(time.Now()) {
+			t.Errorf("%s: expected the budget restored in the future, got %v, %v", tc.name, resetAt, err)
+		}
+	}
+}
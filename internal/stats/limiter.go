@@ -0,0 +1,210 @@
+// Package stats provides a limiter decorator counting the requests allowed and denied per identifier over a rolling
+// window, for support tooling answering whether a client is being throttled right now and how much.
+package stats
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/types"
+)
+
+// buckets is the number of intervals a window is counted in. Counts cover the current interval and the intervals
+// completed within the window, so they lag by at most a tenth of the window.
+const buckets = 10
+
+// bucket counts the decisions of one interval.
+type bucket struct {
+	index   int64 // Interval number since the Unix epoch; identifies which interval the bucket holds
+	allowed int64
+	denied  int64
+}
+
+// counts is the ring of buckets of one identifier.
+type counts struct {
+	ring [buckets]bucket
+	last int64 // Index of the latest interval counted
+}
+
+// Limiter delegates to a limiter, counting its decisions per identifier in memory.
+type Limiter struct {
+	key            string // Limiter key from config
+	limiter        types.Limiter
+	window         time.Duration
+	interval       time.Duration
+	maxIdentifiers int
+
+	mu          sync.Mutex
+	identifiers map[string]*counts
+	pruned      int64 // Interval of the latest prune, so a full map is scanned at most once per interval
+}
+
+// NewLimiter creates a decorator around limiter counting its decisions as cfg describes.
+func NewLimiter(key string, limiter types.Limiter, cfg config.StatsConfig) *Limiter {
+	window := cfg.Window
+	if window <= 0 {
+		window = config.DefaultStatsWindow
+	}
+	maxIdentifiers := cfg.MaxIdentifiers
+	if maxIdentifiers <= 0 {
+		maxIdentifiers = config.DefaultStatsMaxIdentifiers
+	}
+	return &Limiter{
+		key:            key,
+		limiter:        limiter,
+		window:         window,
+		interval:       max(window/buckets, 1),
+		maxIdentifiers: maxIdentifiers,
+		identifiers:    make(map[string]*counts),
+	}
+}
+
+// Allow checks if a request for the identifier is allowed, counting the decision.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	allowed, err := l.limiter.Allow(ctx, identifier)
+	l.record(identifier, allowed, err, time.Now())
+	return allowed, err
+}
+
+// AllowN checks if a request costing n units for the identifier is allowed, counting the decision as one request.
+// Limiters that do not support AllowN are charged a single unit.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	var allowed bool
+	var err error
+	if costLimiter, ok := l.limiter.(types.CostLimiter); ok {
+		allowed, err = costLimiter.AllowN(ctx, identifier, n)
+	} else {
+		allowed, err = l.limiter.Allow(ctx, identifier)
+	}
+	l.record(identifier, allowed, err, time.Now())
+	return allowed, err
+}
+
+// AllowAt checks if a request for the identifier is allowed at time t, counting the decision at time t.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	timeLimiter, ok := l.limiter.(types.TimeLimiter)
+	if !ok {
+		return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+	}
+	allowed, err := timeLimiter.AllowAt(ctx, identifier, t)
+	l.record(identifier, allowed, err, t)
+	return allowed, err
+}
+
+// AllowKey checks if a request for the composite key is allowed, counting the decision under the key's canonical encoding.
+func (l *Limiter) AllowKey(ctx context.Context, key types.Key) (bool, error) {
+	allowed, err := types.AllowKey(ctx, l.limiter, key)
+	l.record(key.String(), allowed, err, time.Now())
+	return allowed, err
+}
+
+// KeyCount returns the key count of the wrapped limiter, and false if it cannot tell.
+func (l *Limiter) KeyCount() (int, bool) {
+	if keyCounter, ok := l.limiter.(types.KeyCounter); ok {
+		return keyCounter.KeyCount()
+	}
+	return 0, false
+}
+
+// Forget drops the identifier's state in the wrapped limiter. Its counts are kept, since they describe past decisions.
+func (l *Limiter) Forget(identifier string) {
+	types.Forget(l.limiter, identifier)
+}
+
+// Pressure returns the fraction of the identifier's budget in use in the wrapped limiter.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	return types.Pressure(ctx, l.limiter, identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget is fully restored in the wrapped limiter.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	return types.ResetTime(ctx, l.limiter, identifier)
+}
+
+// Reserve reserves a request costing n units for the identifier, counting the decision as one request.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	reservation, err := types.Reserve(ctx, l.limiter, identifier, n, maxWait)
+	l.record(identifier, reservation.OK, err, time.Now())
+	return reservation, err
+}
+
+// AllowDetailed checks a request costing n units for the identifier with its result, counting the decision as one
+// request.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	result, err := types.AllowDetailed(ctx, l.limiter, identifier, n)
+	l.record(identifier, result.Allowed, err, time.Now())
+	return result, err
+}
+
+// Stats returns the requests allowed and denied for the identifier over the window.
+func (l *Limiter) Stats(ctx context.Context, identifier string) (types.IdentifierStats, error) {
+	return l.StatsAt(identifier, time.Now()), nil
+}
+
+// StatsAt returns the requests allowed and denied for the identifier over the window ending at time now.
+func (l *Limiter) StatsAt(identifier string, now time.Time) types.IdentifierStats {
+	stats := types.IdentifierStats{Window: l.window}
+	current := now.UnixNano() / int64(l.interval)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.identifiers[identifier]
+	if !ok {
+		return stats
+	}
+	for i := range c.ring {
+		b := &c.ring[i]
+		if b.index > current-buckets && b.index <= current {
+			stats.Allowed += b.allowed
+			stats.Denied += b.denied
+		}
+	}
+	return stats
+}
+
+// record counts the decision for the identifier at time t. Failed checks are not counted.
+func (l *Limiter) record(identifier string, allowed bool, err error, t time.Time) {
+	if err != nil {
+		return
+	}
+	index := t.UnixNano() / int64(l.interval)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.identifiers[identifier]
+	if !ok {
+		if len(l.identifiers) >= l.maxIdentifiers && l.pruned != index {
+			l.prune(index)
+		}
+		if len(l.identifiers) >= l.maxIdentifiers {
+			return
+		}
+		c = &counts{}
+		l.identifiers[identifier] = c
+	}
+	b := &c.ring[index%buckets]
+	if b.index > index {
+		// Older than the window
+		return
+	}
+	if b.index != index {
+		*b = bucket{index: index}
+	}
+	if allowed {
+		b.allowed++
+	} else {
+		b.denied++
+	}
+	c.last = max(c.last, index)
+}
+
+// prune forgets the identifiers without decisions within the window ending at interval current.
+func (l *Limiter) prune(current int64) {
+	l.pruned = current
+	for identifier, c := range l.identifiers {
+		if c.last <= current-buckets {
+			delete(l.identifiers, identifier)
+		}
+	}
+}
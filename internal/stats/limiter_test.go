@@ -0,0 +1,91 @@
+// Package stats_test contains tests for the per-identifier stats.
+package stats_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/config"
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/internal/stats"
+	"learn.ratelimiter/types"
+)
+
+// start is aligned to the intervals of the windows used below.
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// failingLimiter fails every check.
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return false, errors.New("backend unavailable")
+}
+
+// allowAt makes n checks of the identifier at time t.
+func allowAt(t *testing.T, limiter *stats.Limiter, identifier string, at time.Time, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := limiter.AllowAt(context.Background(), identifier, at); err != nil {
+			t.Fatalf("AllowAt returned error: %v", err)
+		}
+	}
+}
+
+// TestStats tests that allowed and denied requests are counted per identifier over the rolling window.
+func TestStats(t *testing.T) {
+	limiter := stats.NewLimiter("test_stats", fcinmemory.NewLimiter("test_stats", time.Hour, 3), config.StatsConfig{Window: 10 * time.Minute})
+	allowAt(t, limiter, "user1", start, 5)
+	allowAt(t, limiter, "user2", start, 1)
+
+	got := limiter.StatsAt("user1", start.Add(time.Minute))
+	want := types.IdentifierStats{Allowed: 3, Denied: 2, Window: 10 * time.Minute}
+	if got != want {
+		t.Errorf("Expected %+v for user1, got %+v", want, got)
+	}
+	if got := limiter.StatsAt("user2", start); got.Allowed != 1 || got.Denied != 0 {
+		t.Errorf("Expected 1 allowed request for user2, got %+v", got)
+	}
+	if got := limiter.StatsAt("user3", start); got.Allowed != 0 || got.Denied != 0 {
+		t.Errorf("Expected no requests for an unknown identifier, got %+v", got)
+	}
+
+	// Requests leave the counts once the window has passed
+	if got := limiter.StatsAt("user1", start.Add(10*time.Minute)); got.Allowed != 0 || got.Denied != 0 {
+		t.Errorf("Expected no requests once the window has passed, got %+v", got)
+	}
+
+	// Through the StatsLimiter interface
+	if got, err := types.Stats(context.Background(), limiter, "unknown"); err != nil || got.Window != 10*time.Minute {
+		t.Errorf("Expected stats through types.Stats, got (%+v, %v)", got, err)
+	}
+}
+
+// TestMaxIdentifiers tests that identifiers over the cap are not counted until others have been idle for a window.
+func TestMaxIdentifiers(t *testing.T) {
+	limiter := stats.NewLimiter("test_stats_max", fcinmemory.NewLimiter("test_stats_max", time.Hour, 100),
+		config.StatsConfig{Window: 10 * time.Minute, MaxIdentifiers: 1})
+	allowAt(t, limiter, "user1", start, 1)
+	allowAt(t, limiter, "user2", start, 1)
+	if got := limiter.StatsAt("user2", start); got.Allowed != 0 {
+		t.Errorf("Expected user2 not counted while the cap is reached, got %+v", got)
+	}
+
+	later := start.Add(10 * time.Minute)
+	allowAt(t, limiter, "user2", later, 1)
+	if got := limiter.StatsAt("user2", later); got.Allowed != 1 {
+		t.Errorf("Expected user2 counted once user1 was idle for a window, got %+v", got)
+	}
+}
+
+// TestErrorsNotCounted tests that failed checks are not counted.
+func TestErrorsNotCounted(t *testing.T) {
+	limiter := stats.NewLimiter("test_stats_errors", failingLimiter{}, config.StatsConfig{})
+	if _, err := limiter.Allow(context.Background(), "user1"); err == nil {
+		t.Fatal("Expected the limiter error")
+	}
+	if got, _ := limiter.Stats(context.Background(), "user1"); got.Allowed != 0 || got.Denied != 0 || got.Window != config.DefaultStatsWindow {
+		t.Errorf("Expected no requests counted in the default window, got %+v", got)
+	}
+}
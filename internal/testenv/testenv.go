@@ -0,0 +1,226 @@
+// Package testenv provides the backends integration tests run against, starting them in Docker containers when
+// no running instance is configured, so tests do not depend on services listening at fixed addresses.
+//
+// A backend is found, in order: at the address in its environment variable (e.g., RATELIMITER_TEST_REDIS_ADDR),
+// at the CI service address when CI=true, in a new container if the docker command is available, or at its default
+// local address. Tests are skipped if none answers.
+package testenv
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Environment variables naming running backends to test against.
+const (
+	RedisAddrEnv     = "RATELIMITER_TEST_REDIS_ADDR"
+	MemcachedAddrEnv = "RATELIMITER_TEST_MEMCACHED_ADDR"
+)
+
+// Container images started when no backend is configured.
+const (
+	RedisImage     = "redis:7-alpine"
+	MemcachedImage = "memcached:1.6-alpine"
+)
+
+// ContainerLabel labels the containers started by tests, e.g., to remove leftovers with
+// docker rm -f $(docker ps -q --filter label=learn.ratelimiter.testenv).
+const ContainerLabel = "learn.ratelimiter.testenv"
+
+// readyTimeout bounds how long a started container may take to accept connections.
+const readyTimeout = 30 * time.Second
+
+// backend describes how to find and start one kind of backend.
+type backend struct {
+	name    string
+	env     string
+	ciAddr  string // Address of the service container in CI
+	local   string // Default local address
+	image   string
+	port    int
+	isReady func(addr string) error
+
+	// Containers are started once per test binary and shared by its tests.
+	once sync.Once
+	addr string
+	err  error
+}
+
+var (
+	redisBackend = &backend{
+		name:    "Redis",
+		env:     RedisAddrEnv,
+		ciAddr:  "redis:6379",
+		local:   "localhost:6379",
+		image:   RedisImage,
+		port:    6379,
+		isReady: pingRedis,
+	}
+	memcachedBackend = &backend{
+		name:    "Memcached",
+		env:     MemcachedAddrEnv,
+		ciAddr:  "memcached:11211",
+		local:   "localhost:11211",
+		image:   MemcachedImage,
+		port:    11211,
+		isReady: pingMemcached,
+	}
+)
+
+// Redis returns the address of a Redis server for the test, skipping the test if none is available.
+// Tests share the server, so they should use their own keys.
+func Redis(t testing.TB) string {
+	return redisBackend.get(t)
+}
+
+// Memcached returns the address of a Memcached server for the test, skipping the test if none is available.
+// Tests share the server, so they should use their own keys.
+func Memcached(t testing.TB) string {
+	return memcachedBackend.get(t)
+}
+
+// get returns the backend's address, starting a container on first use if needed.
+func (b *backend) get(t testing.TB) string {
+	t.Helper()
+	if addr := os.Getenv(b.env); addr != "" {
+		return addr
+	}
+	if os.Getenv("CI") == "true" {
+		return b.ciAddr
+	}
+	b.once.Do(func() {
+		b.addr, b.err = b.find()
+	})
+	if b.err != nil {
+		t.Skipf("No %s available (set %s or install Docker): %v", b.name, b.env, b.err)
+	}
+	return b.addr
+}
+
+// find starts a container if Docker is available, and falls back to the default local address.
+func (b *backend) find() (string, error) {
+	var containerErr error
+	if _, err := exec.LookPath("docker"); err == nil {
+		addr, err := b.start()
+		if err == nil {
+			return addr, nil
+		}
+		containerErr = err
+	}
+	if err := b.isReady(b.local); err != nil {
+		if containerErr != nil {
+			return "", fmt.Errorf("starting container: %v; %s: %w", containerErr, b.local, err)
+		}
+		return "", fmt.Errorf("%s: %w", b.local, err)
+	}
+	return b.local, nil
+}
+
+// start runs the backend's image with its port published on a random local port and waits until it is ready.
+// The container runs until Cleanup removes it; containers left behind by interrupted runs carry the ContainerLabel label.
+func (b *backend) start() (string, error) {
+	out, err := exec.Command("docker", "run", "-d", "--rm", "--label", ContainerLabel,
+		"-p", fmt.Sprintf("127.0.0.1::%d", b.port), b.image).Output()
+	if err != nil {
+		return "", fmt.Errorf("docker run %s: %w", b.image, commandError(err))
+	}
+	id := strings.TrimSpace(string(out))
+	containers.add(id)
+
+	out, err = exec.Command("docker", "port", id, fmt.Sprintf("%d/tcp", b.port)).Output()
+	if err != nil {
+		return "", fmt.Errorf("docker port: %w", commandError(err))
+	}
+	// The first line is the published address, e.g., 127.0.0.1:49153
+	addr := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+
+	deadline := time.Now().Add(readyTimeout)
+	for {
+		err := b.isReady(addr)
+		if err == nil {
+			return addr, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("%s container not ready after %s: %w", b.name, readyTimeout, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// commandError includes the standard error of a failed command in err.
+func commandError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
+
+// containerSet records the containers started by the test binary.
+type containerSet struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+var containers containerSet
+
+func (s *containerSet) add(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids = append(s.ids, id)
+}
+
+// Cleanup removes the containers started by the test binary. Call it from TestMain after m.Run:
+//
+//	func TestMain(m *testing.M) {
+//		code := m.Run()
+//		testenv.Cleanup()
+//		os.Exit(code)
+//	}
+func Cleanup() {
+	containers.mu.Lock()
+	defer containers.mu.Unlock()
+	for _, id := range containers.ids {
+		exec.Command("docker", "rm", "-f", id).Run()
+	}
+	containers.ids = nil
+}
+
+// pingRedis checks that a Redis server answers at addr.
+func pingRedis(addr string) error {
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1})
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return client.Ping(ctx).Err()
+}
+
+// pingMemcached checks that a Memcached server answers the version command at addr.
+func pingMemcached(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte("version\r\n")); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "VERSION") {
+		return fmt.Errorf("unexpected answer to version: %q", strings.TrimSpace(line))
+	}
+	return nil
+}
@@ -8,6 +8,10 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/internal/clock"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
 )
 
 // limiter is the in-memory implementation of the Token Bucket.
@@ -17,67 +21,245 @@ type limiter struct {
 	buckets  map[string]*tokenBucket
 	rate     int
 	capacity int
+	maxDebt  int // Maximum number of tokens that may be borrowed against future refill
 	mu       sync.Mutex
 }
 
 type tokenBucket struct {
-	tokens     int
+	tokens     int // Negative while the bucket is in debt
 	capacity   int
 	lastRefill time.Time
 }
 
 // NewLimiter creates a new in-memory Token Bucket limiter.
-// It takes a unique key for the limiter, the rate at which tokens are added, and the maximum capacity of the bucket.
-func NewLimiter(key string, rate, capacity int) *limiter {
-	log.Info().Str("limiter_type", "TokenBucket").Str("backend", "InMemory").Str("limiter_key", key).Int("rate", rate).Int("capacity", capacity).Msg("Limiter: Initialized")
+// It takes a unique key for the limiter, the rate at which tokens are added, the maximum capacity of the bucket,
+// and the maximum debt a request may borrow against future refill (0 disables debt mode).
+func NewLimiter(key string, rate, capacity, maxDebt int) *limiter {
+	log.Info().Str("limiter_type", "TokenBucket").Str("backend", "InMemory").Str("limiter_key", key).Int("rate", rate).Int("capacity", capacity).Int("max_debt", maxDebt).Msg("Limiter: Initialized")
 	return &limiter{
 		key:      key, // Store the key
 		buckets:  make(map[string]*tokenBucket),
 		rate:     rate,
 		capacity: capacity,
+		maxDebt:  maxDebt,
 	}
 }
 
 // Allow checks if a request for the given identifier is allowed based on the Token Bucket algorithm.
 // It takes a context and an identifier and returns true if the request is allowed, false otherwise, and an error if any occurred.
 func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request consuming n tokens for the given identifier is allowed based on the Token Bucket algorithm.
+// In debt mode a request larger than the remaining tokens is admitted by borrowing up to maxDebt tokens,
+// after which the bucket denies all requests until refill has repaid the debt.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now())
+	return result.Allowed, err
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	result, err := l.allow(ctx, identifier, 1, t)
+	return result.Allowed, err
+}
+
+// AllowDetailed checks a request consuming n tokens for the given identifier as AllowN does, with the tokens left in
+// the bucket, when it is full again and, for a denied request, when the bucket holds enough tokens for it.
+func (l *limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	return l.allow(ctx, identifier, n, time.Now())
+}
+
+// allow evaluates a request consuming n tokens at time now.
+func (l *limiter) allow(ctx context.Context, identifier string, n int, now time.Time) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	bucket, now := l.refill(identifier, now)
+
+	// Check if context is cancelled before proceeding
+	select {
+	case <-ctx.Done():
+		// Added limiter key and identifier to log
+		log.Warn().Err(ctx.Err()).Str("limiter_type", "TokenBucket").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Context cancelled during check")
+		return types.Result{}, ctx.Err()
+	default:
+		// Continue
+	}
+
+	if bucket.tokens >= n {
+		bucket.tokens -= n
+		return l.result(bucket, true, 0, now), nil
+	}
+
+	if l.maxDebt > 0 && bucket.tokens >= 0 && bucket.tokens-n >= -l.maxDebt {
+		bucket.tokens -= n
+		log.Debug().Str("limiter_type", "TokenBucket").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Int("tokens", bucket.tokens).Msg("Limiter: Request allowed by borrowing tokens")
+		return l.result(bucket, true, 0, now), nil
+	}
+
+	var retryAfter time.Duration
+	if n <= bucket.capacity+l.maxDebt {
+		// In debt mode the request is admitted once the bucket is out of debt and holds all but maxDebt tokens
+		need := n
+		if l.maxDebt > 0 {
+			need = max(n-l.maxDebt, 0)
+		}
+		retryAfter = bucket.lastRefill.Add(time.Duration(need-bucket.tokens) * time.Second / time.Duration(l.rate)).Sub(now)
+	}
+	return l.result(bucket, false, max(retryAfter, 0), now), nil
+}
+
+// result returns the result of a decision on the bucket at time now. The caller holds l.mu.
+func (l *limiter) result(bucket *tokenBucket, allowed bool, retryAfter time.Duration, now time.Time) types.Result {
+	resetAt := now
+	if bucket.tokens < bucket.capacity {
+		resetAt = bucket.lastRefill.Add(time.Duration(bucket.capacity-bucket.tokens) * time.Second / time.Duration(l.rate))
+	}
+	return types.Result{
+		Allowed:    allowed,
+		Limit:      int64(bucket.capacity),
+		Remaining:  int64(max(bucket.tokens, 0)),
+		ResetAt:    resetAt,
+		RetryAfter: retryAfter,
+	}
+}
+
+// Reserve charges n tokens for the identifier if the bucket holds them, or will have refilled them within maxWait. In
+// the latter case the bucket goes into debt, denying other requests until refill repays it, and the request must wait
+// for the refill before proceeding.
+func (l *limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Reservation{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return types.Reservation{}, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, now := l.refill(identifier, time.Now())
+	if bucket.tokens >= n {
+		bucket.tokens -= n
+		return types.Reservation{OK: true}, nil
+	}
+	if n > bucket.capacity {
+		return types.Reservation{}, nil
+	}
+	// Whole tokens are refilled at regular intervals from the last refill
+	delay := bucket.lastRefill.Add(time.Duration(n-bucket.tokens) * time.Second / time.Duration(l.rate)).Sub(now)
+	if delay > maxWait {
+		return types.Reservation{Delay: delay}, nil
+	}
+	bucket.tokens -= n
+	log.Debug().Str("limiter_type", "TokenBucket").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Dur("delay", delay).Msg("Limiter: Request reserved ahead of refill")
+	return types.Reservation{OK: true, Delay: delay}, nil
+}
+
+// refill returns the identifier's bucket refilled at time now, created full if it has none, and now clamped to its
+// last refill. The caller holds l.mu.
+func (l *limiter) refill(identifier string, now time.Time) (*tokenBucket, time.Time) {
 	bucket, exists := l.buckets[identifier]
 	if !exists {
 		// Added limiter key and identifier to log
-		log.Debug().Str("limiter_type", "TokenBucket").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Creating new token bucket")
-		l.buckets[identifier] = &tokenBucket{
+		log.Debug().Str("limiter_type", "TokenBucket").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Creating new token bucket")
+		bucket = &tokenBucket{
 			tokens:     l.capacity,
 			capacity:   l.capacity,
-			lastRefill: time.Now(),
+			lastRefill: now,
 		}
-		bucket = l.buckets[identifier]
+		l.buckets[identifier] = bucket
 	}
 
-	// Refill tokens
-	now := time.Now()
-	numTokensAdded := int(math.Floor(now.Sub(bucket.lastRefill).Seconds() * float64(l.rate)))
-	if numTokensAdded > 0 {
-		bucket.tokens = min(bucket.capacity, bucket.tokens+numTokensAdded)
-		bucket.lastRefill = now // Update last refill time
+	// Never let time move backwards for this bucket
+	now = clock.Clamp(now, bucket.lastRefill)
+
+	// Refill whole tokens, keeping the time towards the next token unless the bucket is full
+	numTokensAdded := int(math.Floor(clock.Elapsed(bucket.lastRefill, now).Seconds() * float64(l.rate)))
+	if bucket.tokens+numTokensAdded >= bucket.capacity {
+		bucket.tokens = bucket.capacity
+		bucket.lastRefill = now
+	} else if numTokensAdded > 0 {
+		bucket.tokens += numTokensAdded
+		bucket.lastRefill = bucket.lastRefill.Add(time.Duration(numTokensAdded) * time.Second / time.Duration(l.rate))
 	}
+	return bucket, now
+}
 
-	// Check if context is cancelled before proceeding
-	select {
-	case <-ctx.Done():
-		// Added limiter key and identifier to log
-		log.Warn().Err(ctx.Err()).Str("limiter_type", "TokenBucket").Str("backend", "InMemory").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Context cancelled during check")
-		return false, ctx.Err()
-	default:
-		// Continue
+// Usage returns the fraction of the capacity each identifier has spent at time now, counting debt as fully spent.
+// Identifiers whose bucket has refilled are left out.
+func (l *limiter) Usage(now time.Time) map[string]float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	usage := make(map[string]float64)
+	for identifier, bucket := range l.buckets {
+		if used := l.used(bucket, now); used > 0 {
+			usage[identifier] = used
+		}
+	}
+	return usage
+}
+
+// Pressure returns the fraction of the identifier's bucket that is empty now, 1 while the bucket is in debt.
+func (l *limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[identifier]
+	if !ok {
+		return 0, nil
 	}
+	return l.used(bucket, time.Now()), nil
+}
+
+// used returns the fraction of the bucket that is empty at time now, once refilled. The caller holds l.mu.
+func (l *limiter) used(bucket *tokenBucket, now time.Time) float64 {
+	refilled := clock.Elapsed(bucket.lastRefill, now).Seconds() * float64(l.rate)
+	tokens := min(float64(bucket.capacity), float64(bucket.tokens)+refilled)
+	return min(1-tokens/float64(bucket.capacity), 1)
+}
 
-	if bucket.tokens > 0 {
-		bucket.tokens -= 1
-		return true, nil
+// ResetTime returns the time at which the identifier's bucket is full again, or now if it is full.
+func (l *limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[identifier]
+	if !ok {
+		return now, nil
+	}
+	missing := float64(bucket.capacity - bucket.tokens)
+	full := bucket.lastRefill.Add(time.Duration(missing / float64(l.rate) * float64(time.Second)))
+	if !full.After(now) {
+		return now, nil
 	}
+	return full, nil
+}
 
-	return false, nil
+// KeyCount returns the number of identifiers with a bucket, including refilled ones, since buckets are only dropped by Forget.
+func (l *limiter) KeyCount() (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets), true
+}
+
+// Forget drops the identifier's bucket, so its next request finds a full bucket.
+func (l *limiter) Forget(identifier string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.buckets, identifier)
+}
+
+// SetUsage replaces the identifier's bucket with one refilled at time now holding the unused fraction of the capacity.
+func (l *limiter) SetUsage(identifier string, used float64, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buckets[identifier] = &tokenBucket{
+		tokens:     l.capacity - int(math.Round(min(max(used, 0), 1)*float64(l.capacity))),
+		capacity:   l.capacity,
+		lastRefill: now,
+	}
 }
@@ -3,6 +3,7 @@ package tbinmemory_test
 
 import (
 	"context"
+	"math"
 	"testing"
 	"time"
 
@@ -15,7 +16,7 @@ func TestNewLimiter(t *testing.T) {
 	rate := 10
 	capacity := 5
 
-	limiter := tbinmemory.NewLimiter(key, rate, capacity)
+	limiter := tbinmemory.NewLimiter(key, rate, capacity, 0)
 
 	if limiter == nil {
 		t.Fatal("NewLimiter returned nil")
@@ -34,7 +35,7 @@ func TestAllowBasic(t *testing.T) {
 	rate := 1     // 1 token per second
 	capacity := 2 // capacity of 2
 
-	limiter := tbinmemory.NewLimiter(key, rate, capacity)
+	limiter := tbinmemory.NewLimiter(key, rate, capacity, 0)
 	ctx := context.Background()
 
 	// First request should be allowed
@@ -71,7 +72,7 @@ func TestAllowRefill(t *testing.T) {
 	rate := 1     // 1 token per second
 	capacity := 2 // capacity of 2
 
-	limiter := tbinmemory.NewLimiter(key, rate, capacity)
+	limiter := tbinmemory.NewLimiter(key, rate, capacity, 0)
 	ctx := context.Background()
 
 	// Exhaust tokens
@@ -122,7 +123,7 @@ func TestAllowMultipleIdentifiers(t *testing.T) {
 	rate := 1     // 1 token per second
 	capacity := 1 // capacity of 1
 
-	limiter := tbinmemory.NewLimiter(key, rate, capacity)
+	limiter := tbinmemory.NewLimiter(key, rate, capacity, 0)
 	ctx := context.Background()
 
 	// Request for userA should be allowed
@@ -168,7 +169,7 @@ func TestAllowContextCancellation(t *testing.T) {
 	rate := 100 // High rate so it doesn't block on tokens
 	capacity := 100
 
-	limiter := tbinmemory.NewLimiter(key, rate, capacity)
+	limiter := tbinmemory.NewLimiter(key, rate, capacity, 0)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel the context immediately
@@ -185,3 +186,214 @@ func TestAllowContextCancellation(t *testing.T) {
 		t.Error("Allow should return false when context is cancelled")
 	}
 }
+
+// TestAllowNDebtMode tests that debt mode admits an oversized request once and then denies until the debt is repaid.
+func TestAllowNDebtMode(t *testing.T) {
+	key := "test-key-debt"
+	rate := 10    // 10 tokens per second
+	capacity := 5 // capacity of 5
+	maxDebt := 5  // may borrow up to 5 tokens
+
+	limiter := tbinmemory.NewLimiter(key, rate, capacity, maxDebt)
+	ctx := context.Background()
+
+	// A request larger than the remaining tokens is admitted by borrowing
+	allowed, err := limiter.AllowN(ctx, "batch", 8)
+	if err != nil {
+		t.Fatalf("AllowN returned error: %v", err)
+	}
+	if !allowed {
+		t.Fatal("Request within capacity plus max debt should be allowed")
+	}
+
+	// The bucket is in debt, so even a single token is denied
+	allowed, err = limiter.AllowN(ctx, "batch", 1)
+	if err != nil {
+		t.Fatalf("AllowN returned error: %v", err)
+	}
+	if allowed {
+		t.Error("Request should be denied while the bucket is in debt")
+	}
+
+	// A request exceeding capacity plus max debt is never admitted
+	allowed, err = limiter.AllowN(ctx, "other", 11)
+	if err != nil {
+		t.Fatalf("AllowN returned error: %v", err)
+	}
+	if allowed {
+		t.Error("Request larger than capacity plus max debt should be denied")
+	}
+
+	// Wait for the debt of 3 tokens to be repaid and one more token to refill
+	time.Sleep(450 * time.Millisecond)
+
+	allowed, err = limiter.AllowN(ctx, "batch", 1)
+	if err != nil {
+		t.Fatalf("AllowN returned error after repayment: %v", err)
+	}
+	if !allowed {
+		t.Error("Request should be allowed once the debt is repaid")
+	}
+}
+
+// TestAllowAtBackwardsTime tests that event times earlier than the last refill do not refill or drain the bucket.
+func TestAllowAtBackwardsTime(t *testing.T) {
+	limiter := tbinmemory.NewLimiter("test-key-event-time", 1, 1, 0)
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	allowed, err := limiter.AllowAt(ctx, "user1", start)
+	if err != nil || !allowed {
+		t.Fatalf("First event should be allowed, got %v, %v", allowed, err)
+	}
+
+	// Going back in time must not be treated as elapsed time
+	allowed, err = limiter.AllowAt(ctx, "user1", start.Add(-10*time.Second))
+	if err != nil {
+		t.Fatalf("AllowAt returned error: %v", err)
+	}
+	if allowed {
+		t.Error("Event with an earlier timestamp should be denied while the bucket is empty")
+	}
+
+	// Event time moving forward refills the bucket without any real waiting
+	allowed, err = limiter.AllowAt(ctx, "user1", start.Add(time.Second))
+	if err != nil {
+		t.Fatalf("AllowAt returned error: %v", err)
+	}
+	if !allowed {
+		t.Error("Event one second later should be allowed after refill")
+	}
+}
+
+// TestAllowDoesNotAllocate tests that checking an identifier with existing state allocates nothing.
+func TestAllowDoesNotAllocate(t *testing.T) {
+	limiter := tbinmemory.NewLimiter("bench_token_bucket", math.MaxInt32, math.MaxInt32, 0)
+	ctx := context.Background()
+	limiter.Allow(ctx, "user1")
+	if allocs := testing.AllocsPerRun(1000, func() { limiter.Allow(ctx, "user1") }); allocs != 0 {
+		t.Errorf("Expected Allow not to allocate, got %v allocations per call", allocs)
+	}
+}
+
+// BenchmarkAllow measures checking an identifier with existing state, run with -benchmem to report allocations.
+func BenchmarkAllow(b *testing.B) {
+	limiter := tbinmemory.NewLimiter("bench_token_bucket", math.MaxInt32, math.MaxInt32, 0)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			limiter.Allow(ctx, "user1")
+		}
+	})
+}
+
+// TestPressure tests that Pressure reports the fraction of the bucket in use without charging it.
+func TestPressure(t *testing.T) {
+	limiter := tbinmemory.NewLimiter("test_pressure", 1, 4, 0)
+	ctx := context.Background()
+
+	for _, want := range []float64{0, 0.5, 1} {
+		pressure, err := limiter.Pressure(ctx, "user1")
+		if err != nil {
+			t.Fatalf("Pressure returned error: %v", err)
+		}
+		if math.Abs(pressure-want) > 0.01 {
+			t.Errorf("Expected pressure %v, got %v", want, pressure)
+		}
+		for i := 0; i < 2; i++ {
+			limiter.Allow(ctx, "user1")
+		}
+	}
+	if allowed, _ := limiter.Allow(ctx, "user1"); allowed {
+		t.Error("Request should be denied at full pressure")
+	}
+	if pressure, _ := limiter.Pressure(ctx, "user2"); pressure != 0 {
+		t.Errorf("Expected no pressure for an identifier without state, got %v", pressure)
+	}
+}
+
+// TestResetTime tests that ResetTime reports when the bucket is full again.
+func TestResetTime(t *testing.T) {
+	limiter := tbinmemory.NewLimiter("test_reset_time", 1, 4, 0)
+	ctx := context.Background()
+
+	start := time.Now()
+	if reset, err := limiter.ResetTime(ctx, "user1"); err != nil || reset.Before(start) || reset.After(time.Now()) {
+		t.Fatalf("Expected a reset now for an identifier without state, got %s, %v", reset, err)
+	}
+	limiter.Allow(ctx, "user1")
+	limiter.Allow(ctx, "user1")
+	reset, err := limiter.ResetTime(ctx, "user1")
+	if err != nil {
+		t.Fatalf("ResetTime returned error: %v", err)
+	}
+	if want := start.Add(2 * time.Second); reset.Sub(want).Abs() > 100*time.Millisecond {
+		t.Errorf("Expected a reset at %s, got %s", want, reset)
+	}
+}
+
+// TestReserve tests that reservations admit requests the bucket refills within the maximum wait, with the delay
+// before they may proceed, and deny the others with the delay until they fit.
+func TestReserve(t *testing.T) {
+	limiter := tbinmemory.NewLimiter("test_reserve", 10, 2, 0)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name      string
+		n         int
+		maxWait   time.Duration
+		wantOK    bool
+		wantDelay time.Duration
+	}{
+		{"available", 2, 0, true, 0},
+		{"beyond max wait", 1, 50 * time.Millisecond, false, 100 * time.Millisecond},
+		{"within max wait", 1, 200 * time.Millisecond, true, 100 * time.Millisecond},
+		{"behind the reservation", 1, 150 * time.Millisecond, false, 200 * time.Millisecond},
+		{"beyond capacity", 3, time.Minute, false, 0},
+	} {
+		reservation, err := limiter.Reserve(ctx, "user1", tc.n, tc.maxWait)
+		if err != nil {
+			t.Fatalf("%s: Reserve returned error: %v", tc.name, err)
+		}
+		if reservation.OK != tc.wantOK || reservation.Delay.Round(10*time.Millisecond) != tc.wantDelay {
+			t.Errorf("%s: Expected OK %v with delay %s, got %+v", tc.name, tc.wantOK, tc.wantDelay, reservation)
+		}
+	}
+}
+
+// TestAllowDetailed tests that each decision carries the tokens left, when the bucket is full again, and when a denied
+// request could be allowed.
+func TestAllowDetailed(t *testing.T) {
+	limiter := tbinmemory.NewLimiter("test_allow_detailed", 10, 3, 0)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name          string
+		n             int
+		wantAllowed   bool
+		wantRemaining int64
+		wantReset     time.Duration
+		wantRetry     time.Duration
+	}{
+		{"allowed", 2, true, 1, 200 * time.Millisecond, 0},
+		{"denied", 2, false, 1, 200 * time.Millisecond, 100 * time.Millisecond},
+		{"beyond capacity", 4, false, 1, 200 * time.Millisecond, 0},
+		{"emptying", 1, true, 0, 300 * time.Millisecond, 0},
+	} {
+		start := time.Now()
+		result, err := limiter.AllowDetailed(ctx, "user1", tc.n)
+		if err != nil {
+			t.Fatalf("%s: AllowDetailed returned error: %v", tc.name, err)
+		}
+		if result.Allowed != tc.wantAllowed || result.Limit != 3 || result.Remaining != tc.wantRemaining {
+			t.Errorf("%s: Expected allowed %v with %d of 3 remaining, got %+v", tc.name, tc.wantAllowed, tc.wantRemaining, result)
+		}
+		if reset := result.ResetAt.Sub(start).Round(10 * time.Millisecond); reset != tc.wantReset {
+			t.Errorf("%s: Expected a reset in %s, got %s", tc.name, tc.wantReset, reset)
+		}
+		if retry := result.RetryAfter.Round(10 * time.Millisecond); retry != tc.wantRetry {
+			t.Errorf("%s: Expected a retry after %s, got %s", tc.name, tc.wantRetry, retry)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// Package tblease serves token bucket requests from tokens leased in batches from a central bucket (e.g., in Redis),
+// so most requests are decided in memory and only one request per batch reaches the backend.
+package tblease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// releaseTimeout bounds the backend call returning the unused tokens of one lease.
+const releaseTimeout = 5 * time.Second
+
+// warmTimeout bounds the backend call leasing the tokens of one warm identifier.
+const warmTimeout = 5 * time.Second
+
+// Source is the central bucket tokens are leased from.
+type Source interface {
+	// Lease takes up to n tokens from the identifier's bucket and returns the number granted.
+	Lease(ctx context.Context, identifier string, n int) (int, error)
+	// Release returns n unused tokens to the identifier's bucket.
+	Release(ctx context.Context, identifier string, n int) error
+}
+
+// lease holds the tokens leased for one identifier.
+type lease struct {
+	mu      sync.Mutex
+	tokens  int
+	expires time.Time
+	// unbacked is the number of tokens admitted from the staleness budget, not yet charged to the source.
+	unbacked int
+	// removed is set once the lease was dropped from the limiter and its tokens returned.
+	removed bool
+}
+
+// Limiter serves requests from tokens leased from a Source, reserving up to size tokens per identifier at once.
+// Unused tokens are returned to the source once they are ttl old and when the limiter is closed, so an identifier
+// whose traffic moves to another instance is not starved for longer than ttl.
+// Since tokens are leased ahead of demand, instances together may admit bursts up to the bucket capacity earlier than
+// a shared bucket would, and a bucket leased empty by one instance denies requests on the others until it refills.
+// Limiter implements neither types.DetailedLimiter nor types.ReserveLimiter: the budget left in the central bucket is
+// only known when tokens are leased, so types.AllowDetailed reports it as unknown, and requests denied by
+// types.Reserve carry no delay.
+type Limiter struct {
+	key    string // Limiter key from config
+	source Source
+	size   int
+	ttl    time.Duration
+
+	// stalenessBudget is the number of tokens per identifier admitted without a lease while the source fails.
+	stalenessBudget int
+	// warmIdentifiers are leased tokens when the limiter starts.
+	warmIdentifiers []string
+
+	mu     sync.Mutex
+	leases map[string]*lease
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Option configures optional behaviour of a Limiter.
+type Option func(*Limiter)
+
+// WithStalenessBudget lets the limiter admit up to budget tokens per identifier without a lease while the source fails
+// (e.g., during a network partition), bounding the over-admission instead of failing requests. Once the source is
+// reachable again, the admitted tokens are charged to it; the part it cannot cover is reported as over-admission.
+func WithStalenessBudget(budget int) Option {
+	return func(l *Limiter) {
+		l.stalenessBudget = budget
+	}
+}
+
+// WithWarmStart leases size tokens for each identifier when the limiter starts, so the first requests of hot
+// identifiers after boot are served from memory instead of all reaching the source at once. Leasing runs in the
+// background and stops at the first failure, leaving the remaining identifiers to lease on their first request.
+func WithWarmStart(identifiers ...string) Option {
+	return func(l *Limiter) {
+		l.warmIdentifiers = identifiers
+	}
+}
+
+// NewLimiter creates a leasing limiter over source and starts returning expired leases in the background.
+// Call Close to stop it and return the unused tokens.
+func NewLimiter(key string, source Source, size int, ttl time.Duration, opts ...Option) *Limiter {
+	l := &Limiter{
+		key:    key,
+		source: source,
+		size:   size,
+		ttl:    ttl,
+		leases: make(map[string]*lease),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	log.Info().Str("limiter_type", "TokenBucket").Str("limiter_key", key).Int("lease_size", size).Dur("lease_ttl", ttl).Int("staleness_budget", l.stalenessBudget).Msg("Limiter: Initialized token leases")
+	go l.run()
+	return l
+}
+
+// Allow checks if a request for the given identifier can be served from its leased tokens, leasing more if needed.
+func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request consuming n tokens can be served from the identifier's leased tokens.
+// If fewer than n tokens are leased, at least size (or n, if larger) tokens are requested from the source first.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	if err := types.CheckCost(n); err != nil {
+		return false, err
+	}
+	for {
+		le := l.lease(identifier)
+		le.mu.Lock()
+		if le.removed {
+			// The lease expired and was returned while we waited for it
+			le.mu.Unlock()
+			continue
+		}
+		allowed, err := l.take(ctx, identifier, le, n)
+		le.mu.Unlock()
+		return allowed, err
+	}
+}
+
+// AllowAt checks if a request is allowed at time t by the source directly, since leased tokens are served at wall clock time.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	if timeLimiter, ok := l.source.(types.TimeLimiter); ok {
+		return timeLimiter.AllowAt(ctx, identifier, t)
+	}
+	return false, fmt.Errorf("limiter '%s' does not support AllowAt", l.key)
+}
+
+// Pressure returns the fraction of the identifier's central bucket that is empty, counting leased tokens as used,
+// if the source can tell.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	if pressureLimiter, ok := l.source.(types.PressureLimiter); ok {
+		return pressureLimiter.Pressure(ctx, identifier)
+	}
+	return 0, fmt.Errorf("%w by the lease source of limiter '%s'", types.ErrPressureUnsupported, l.key)
+}
+
+// ResetTime returns the time at which the identifier's central bucket is full again, counting leased tokens as used,
+// if the source can tell.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	if resetLimiter, ok := l.source.(types.ResetLimiter); ok {
+		return resetLimiter.ResetTime(ctx, identifier)
+	}
+	return time.Time{}, fmt.Errorf("%w by the lease source of limiter '%s'", types.ErrResetTimeUnsupported, l.key)
+}
+
+// Close stops the background job and returns all unused leased tokens to the source.
+func (l *Limiter) Close() error {
+	var err error
+	l.stopOnce.Do(func() {
+		close(l.stop)
+		<-l.done
+		err = l.releaseLeases(time.Time{}, true)
+		log.Info().Str("limiter_key", l.key).Msg("Limiter: Returned leased tokens")
+	})
+	return err
+}
+
+// lease returns the identifier's lease, creating an empty one if needed.
+func (l *Limiter) lease(identifier string) *lease {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	le, ok := l.leases[identifier]
+	if !ok {
+		le = &lease{}
+		l.leases[identifier] = le
+	}
+	return le
+}
+
+// take consumes n tokens from the lease, which must be locked, topping it up from the source if it holds too few.
+// If the source fails, the request is admitted from the staleness budget while it lasts.
+func (l *Limiter) take(ctx context.Context, identifier string, le *lease, n int) (bool, error) {
+	now := time.Now()
+	if le.tokens < n {
+		// Unbacked tokens are charged along with the new batch
+		granted, err := l.source.Lease(ctx, identifier, max(l.size, n)-le.tokens+le.unbacked)
+		if err != nil {
+			if le.unbacked+n > l.stalenessBudget {
+				return false, err
+			}
+			le.unbacked += n
+			metrics.RecordLeaseUnbacked(l.key, n)
+			log.Warn().Err(err).Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Int("unbacked", le.unbacked).Int("staleness_budget", l.stalenessBudget).Msg("Limiter: Lease failed, admitting request from staleness budget")
+			return true, nil
+		}
+		le.tokens = l.settle(identifier, le, le.tokens+granted)
+		le.expires = now.Add(l.ttl)
+	}
+	if le.tokens < n {
+		return false, nil
+	}
+	le.tokens -= n
+	return true, nil
+}
+
+// settle covers the lease's unbacked tokens with tokens leased from the source and returns the tokens left.
+// Unbacked tokens the source could not cover were admitted beyond the bucket's budget and are reported as over-admission.
+func (l *Limiter) settle(identifier string, le *lease, tokens int) int {
+	if le.unbacked == 0 {
+		return tokens
+	}
+	covered := min(tokens, le.unbacked)
+	if over := le.unbacked - covered; over > 0 {
+		metrics.RecordLeaseOverAdmitted(l.key, over)
+		log.Warn().Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Int("over_admitted", over).Msg("Limiter: Tokens admitted from staleness budget exceeded the bucket")
+	}
+	le.unbacked = 0
+	return tokens - covered
+}
+
+// run leases the tokens of the warm identifiers, then returns expired leases every ttl until the limiter is closed.
+func (l *Limiter) run() {
+	defer close(l.done)
+	l.warm()
+	ticker := time.NewTicker(l.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			if err := l.releaseLeases(now, false); err != nil {
+				log.Warn().Err(err).Str("limiter_key", l.key).Msg("Limiter: Failed to return expired leased tokens")
+			}
+		}
+	}
+}
+
+// warm leases size tokens for each warm identifier, stopping early if the limiter is closed or the source fails.
+func (l *Limiter) warm() {
+	if len(l.warmIdentifiers) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-l.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	warmed := 0
+	for _, identifier := range l.warmIdentifiers {
+		if ctx.Err() != nil {
+			return
+		}
+		le := l.lease(identifier)
+		le.mu.Lock()
+		if le.removed || le.unbacked > 0 || le.tokens >= l.size {
+			// Already served by a request, or waiting for its unbacked tokens to be charged
+			le.mu.Unlock()
+			continue
+		}
+		leaseCtx, leaseCancel := context.WithTimeout(ctx, warmTimeout)
+		granted, err := l.source.Lease(leaseCtx, identifier, l.size-le.tokens)
+		leaseCancel()
+		if err != nil {
+			le.mu.Unlock()
+			log.Warn().Err(err).Str("limiter_key", l.key).Int("warmed", warmed).Int("warm_identifiers", len(l.warmIdentifiers)).Msg("Limiter: Warm start failed, leasing remaining identifiers on demand")
+			return
+		}
+		le.tokens += granted
+		le.expires = time.Now().Add(l.ttl)
+		le.mu.Unlock()
+		warmed++
+	}
+	log.Info().Str("limiter_key", l.key).Int("warmed", warmed).Msg("Limiter: Leased tokens for warm identifiers")
+}
+
+// releaseLeases drops the leases that expired before now, or all leases if all is set, and returns their unused tokens
+// to the source. Expired leases in use by a request are left for the next run, and leases holding unbacked tokens
+// are only dropped once the tokens were charged to the source.
+func (l *Limiter) releaseLeases(now time.Time, all bool) error {
+	l.mu.Lock()
+	var dropped []string
+	var selected []*lease
+	unbacked := make(map[string]*lease)
+	for identifier, le := range l.leases {
+		if all {
+			le.mu.Lock()
+		} else if !le.mu.TryLock() {
+			continue
+		}
+		if !all && le.unbacked > 0 {
+			// Kept until its unbacked tokens are charged, so its staleness budget is not reset while the source fails
+			unbacked[identifier] = le
+		} else if all || now.After(le.expires) {
+			le.removed = true
+			delete(l.leases, identifier)
+			dropped = append(dropped, identifier)
+			selected = append(selected, le)
+		}
+		le.mu.Unlock()
+	}
+	l.mu.Unlock()
+
+	var errs []error
+	for identifier, le := range unbacked {
+		if err := l.charge(identifier, le); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i, le := range selected {
+		ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+		tokens := le.tokens
+		if need := le.unbacked - tokens; need > 0 {
+			// Charge the remaining unbacked tokens before the lease is dropped
+			granted, err := l.source.Lease(ctx, dropped[i], need)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			tokens += granted
+		}
+		if tokens = l.settle(dropped[i], le, tokens); tokens > 0 {
+			if err := l.source.Release(ctx, dropped[i], tokens); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// charge charges the unbacked tokens of a lease to the source, e.g., once a partition healed while the identifier is idle.
+func (l *Limiter) charge(identifier string, le *lease) error {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	if le.removed || le.unbacked == 0 {
+		return nil
+	}
+	tokens := le.tokens
+	if need := le.unbacked - tokens; need > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+		defer cancel()
+		granted, err := l.source.Lease(ctx, identifier, need)
+		if err != nil {
+			return err
+		}
+		tokens += granted
+	}
+	le.tokens = l.settle(identifier, le, tokens)
+	return nil
+}
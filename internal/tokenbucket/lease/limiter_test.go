@@ -0,0 +1,186 @@
+// Package tblease_test contains tests for leasing tokens from a central bucket.
+package tblease_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tblease "learn.ratelimiter/internal/tokenbucket/lease"
+	"learn.ratelimiter/types"
+)
+
+// bucket is a central bucket without refill, counting the calls made to it.
+type bucket struct {
+	mu       sync.Mutex
+	tokens   int
+	leases   int
+	released int
+}
+
+func (b *bucket) Lease(ctx context.Context, identifier string, n int) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.leases++
+	granted := min(n, b.tokens)
+	b.tokens -= granted
+	return granted, nil
+}
+
+func (b *bucket) Release(ctx context.Context, identifier string, n int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += n
+	b.released += n
+	return nil
+}
+
+func (b *bucket) state() (tokens, leases, released int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens, b.leases, b.released
+}
+
+// TestLeaseBatching tests that requests are served from leased batches, calling the central bucket once per batch.
+func TestLeaseBatching(t *testing.T) {
+	source := &bucket{tokens: 10}
+	limiter := tblease.NewLimiter("test_lease", source, 4, time.Hour)
+	defer limiter.Close()
+
+	allowed := 0
+	for i := 0; i < 12; i++ {
+		if ok, err := limiter.Allow(context.Background(), "client1"); err != nil {
+			t.Fatalf("Allow returned error: %v", err)
+		} else if ok {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Errorf("Expected the bucket's 10 tokens to be served, got %d", allowed)
+	}
+	// Batches of 4, 4 and 2 tokens, then one lease per denied request
+	if _, leases, _ := source.state(); leases != 5 {
+		t.Errorf("Expected 5 calls to the central bucket, got %d", leases)
+	}
+}
+
+// TestLeaseReturn tests that unused tokens are returned when a lease expires and when the limiter is closed.
+func TestLeaseReturn(t *testing.T) {
+	source := &bucket{tokens: 10}
+	limiter := tblease.NewLimiter("test_lease_return", source, 4, 20*time.Millisecond)
+	limiter.Allow(context.Background(), "expiring")
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if tokens, _, released := source.state(); released == 3 && tokens == 9 {
+			break
+		}
+		if time.Now().After(deadline) {
+			tokens, _, released := source.state()
+			t.Fatalf("Expected 3 unused tokens to be returned on expiry, got %d returned and %d in the bucket", released, tokens)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	limiter.Allow(context.Background(), "closing")
+	if err := limiter.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if tokens, _, released := source.state(); released != 6 || tokens != 8 {
+		t.Errorf("Expected 3 more unused tokens to be returned on close, got %d returned and %d in the bucket", released, tokens)
+	}
+}
+
+// TestStalenessBudget tests that requests are admitted from the staleness budget while the source fails,
+// and that the admitted tokens are charged to the source once it is reachable again.
+func TestStalenessBudget(t *testing.T) {
+	source := &flakyBucket{bucket: bucket{tokens: 10}}
+	limiter := tblease.NewLimiter("test_lease_staleness", source, 4, time.Hour, tblease.WithStalenessBudget(3))
+	defer limiter.Close()
+
+	source.setFailing(true)
+	for i := 0; i < 3; i++ {
+		if ok, err := limiter.Allow(context.Background(), "client1"); !ok || err != nil {
+			t.Fatalf("Expected request %d to be admitted from the staleness budget, got (%v, %v)", i+1, ok, err)
+		}
+	}
+	if ok, err := limiter.Allow(context.Background(), "client1"); ok || err == nil {
+		t.Errorf("Expected the source error once the staleness budget is spent, got (%v, %v)", ok, err)
+	}
+
+	// The 3 unbacked tokens are charged with the next batch of 4
+	source.setFailing(false)
+	if ok, err := limiter.Allow(context.Background(), "client1"); !ok || err != nil {
+		t.Fatalf("Expected request to be allowed once the source recovered, got (%v, %v)", ok, err)
+	}
+	if tokens, _, _ := source.state(); tokens != 3 {
+		t.Errorf("Expected 7 tokens to be taken from the bucket, %d left", tokens)
+	}
+}
+
+// TestWarmStart tests that warm identifiers are leased tokens on start, so their first requests do not reach the source.
+func TestWarmStart(t *testing.T) {
+	source := &bucket{tokens: 10}
+	limiter := tblease.NewLimiter("test_lease_warm", source, 4, time.Hour, tblease.WithWarmStart("hot1", "hot2"))
+	defer limiter.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if tokens, leases, _ := source.state(); leases == 2 && tokens == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected both warm identifiers to lease a batch of 4 tokens")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for i := 0; i < 4; i++ {
+		if ok, err := limiter.Allow(context.Background(), "hot1"); !ok || err != nil {
+			t.Fatalf("Expected request %d to be served from the warm lease, got (%v, %v)", i, ok, err)
+		}
+	}
+	if _, leases, _ := source.state(); leases != 2 {
+		t.Errorf("Expected no further calls to the central bucket, got %d in total", leases)
+	}
+}
+
+// flakyBucket is a bucket whose leases fail while failing is set.
+type flakyBucket struct {
+	bucket
+	failing atomic.Bool
+}
+
+func (b *flakyBucket) setFailing(failing bool) { b.failing.Store(failing) }
+
+func (b *flakyBucket) Lease(ctx context.Context, identifier string, n int) (int, error) {
+	if b.failing.Load() {
+		return 0, errors.New("connection refused")
+	}
+	return b.bucket.Lease(ctx, identifier, n)
+}
+
+// TestDetailedFallback tests that detailed checks and reservations are served from leased tokens, with the budget left
+// in the central bucket reported as unknown and denials carrying no delay.
+func TestDetailedFallback(t *testing.T) {
+	source := &bucket{tokens: 2}
+	limiter := tblease.NewLimiter("test_lease_detailed", source, 2, time.Hour)
+	defer limiter.Close()
+	ctx := context.Background()
+
+	result, err := types.AllowDetailed(ctx, limiter, "client1", 1)
+	if err != nil || !result.Allowed || result.Limit >= 0 || result.Remaining >= 0 {
+		t.Errorf("Expected an allowed request with an unknown budget, got %+v, %v", result, err)
+	}
+	if reservation, err := types.Reserve(ctx, limiter, "client1", 1, time.Minute); err != nil || !reservation.OK {
+		t.Errorf("Expected the last leased token reserved, got %+v, %v", reservation, err)
+	}
+	if reservation, err := types.Reserve(ctx, limiter, "client1", 1, time.Minute); err != nil || reservation.OK || reservation.Delay != 0 {
+		t.Errorf("Expected a denial without delay once the bucket is empty, got %+v, %v", reservation, err)
+	}
+	if _, leases, _ := source.state(); leases != 2 {
+		t.Errorf("Expected one lease and one failed top-up, got %d", leases)
+	}
+}
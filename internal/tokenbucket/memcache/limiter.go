@@ -3,7 +3,6 @@ package tbmemcache
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"math"
 	"time"
@@ -11,91 +10,172 @@ import (
 	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/rs/zerolog/log"
 
+	"learn.ratelimiter/internal/clock"
+	"learn.ratelimiter/internal/codec"
+	"learn.ratelimiter/redact"
 	"learn.ratelimiter/types"
 )
 
+// maxAttempts is the number of times a request reads and updates the state before giving up, when other requests
+// update it in between.
+const maxAttempts = 5
+
 // limiter is the Memcache implementation of the Token Bucket.
 type limiter struct {
 	key      string
 	capacity int
 	rate     int
+	maxDebt  int // tokens that may be borrowed against future refill
 	client   *memcache.Client
+	codec    codec.Codec // encoding of stored state; any format is read
+	noCAS    bool        // update state with set instead of cas, for proxies without cas
+}
+
+// Option configures optional behaviour of a limiter.
+type Option func(*limiter)
+
+// WithoutCAS updates state with set instead of cas, for servers behind proxies that do not support cas (e.g., some
+// twemproxy and mcrouter deployments), so that only get, add and set are used. Concurrent requests for the same
+// identifier may then overwrite each other's update, admitting up to one extra request per concurrent update.
+func WithoutCAS() Option {
+	return func(l *limiter) {
+		l.noCAS = true
+	}
 }
 
 // tokenBucketState represents the state of a token bucket stored in Memcache.
 type tokenBucketState struct {
-	Tokens     int64     `json:"tokens"`
-	LastRefill time.Time `json:"last_refill"`
+	Tokens     int64     `json:"tokens" codec:"1"` // Negative while the bucket is in debt
+	LastRefill time.Time `json:"last_refill" codec:"2"`
 }
 
-// NewLimiter creates a new Memcache Token Bucket limiter.
-func NewLimiter(key string, rate, capacity int, client *memcache.Client) types.Limiter {
-	log.Info().Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", key).Int("rate", rate).Int("capacity", capacity).Msg("Limiter: Initialized")
-	return &limiter{
+// NewLimiter creates a new Memcache Token Bucket limiter storing state with the given codec (JSON if nil).
+// State written by any codec is read, so the codec can be changed without resetting buckets. Buckets are created
+// with add and updated with cas, so concurrent requests from any instance are counted exactly (see WithoutCAS).
+func NewLimiter(key string, rate, capacity, maxDebt int, client *memcache.Client, stateCodec codec.Codec, opts ...Option) types.CostLimiter {
+	if stateCodec == nil {
+		stateCodec = codec.JSON
+	}
+	l := &limiter{
 		key:      key,
 		rate:     rate,
 		capacity: capacity,
+		maxDebt:  maxDebt,
 		client:   client,
+		codec:    stateCodec,
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	log.Info().Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", key).Int("rate", rate).Int("capacity", capacity).Int("max_debt", maxDebt).Str("codec", stateCodec.Name()).Bool("cas", !l.noCAS).Msg("Limiter: Initialized")
+	return l
 }
 
 // Allow checks if a request for the given identifier is allowed based on the Token Bucket algorithm.
 func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
-	itemKey := fmt.Sprintf("token_bucket:%s:%s", l.key, identifier)
+	return l.AllowN(ctx, identifier, 1)
+}
 
-	// Get the current state from Memcache
-	item, err := l.client.Get(itemKey)
-	if err != nil && err != memcache.ErrCacheMiss {
-		log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Failed to get state from Memcache")
-		return false, fmt.Errorf("get state from memcache: %w", err)
-	}
+// AllowN checks if a request consuming n tokens for the given identifier is allowed based on the Token Bucket algorithm.
+// In debt mode a request larger than the remaining tokens is admitted by borrowing up to maxDebt tokens.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	return l.allow(ctx, identifier, n, time.Now())
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+// Times earlier than the last refill time are treated as the last refill time.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	return l.allow(ctx, identifier, 1, t)
+}
 
-	state := &tokenBucketState{
-		Tokens:     int64(l.capacity),
-		LastRefill: time.Now(),
+// allow evaluates a request consuming n tokens at time now. Without CAS, the updated state overwrites any update made
+// by another instance since it was read.
+func (l *limiter) allow(ctx context.Context, identifier string, n int, now time.Time) (bool, error) {
+	if err := types.CheckCost(n); err != nil {
+		return false, err
 	}
+	itemKey := "token_bucket:" + l.key + ":" + identifier
 
-	if item != nil {
-		if err := json.Unmarshal(item.Value, state); err != nil {
-			log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Failed to unmarshal state from Memcache")
-			return false, fmt.Errorf("unmarshal state: %w", err)
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		// Get the current state from Memcache
+		item, err := l.client.Get(itemKey)
+		if err != nil && err != memcache.ErrCacheMiss {
+			log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to get state from Memcache")
+			return false, fmt.Errorf("get state from memcache: %w", err)
+		}
+
+		state := &tokenBucketState{
+			Tokens:     int64(l.capacity),
+			LastRefill: now,
+		}
+		if item != nil {
+			if err := l.codec.Unmarshal(item.Value, state); err != nil {
+				log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to unmarshal state from Memcache")
+				return false, fmt.Errorf("unmarshal state: %w", err)
+			}
 		}
-	}
 
-	// Refill tokens
-	now := time.Now()
-	elapsed := now.Sub(state.LastRefill)
-	refillAmount := int64(float64(l.rate) * elapsed.Seconds())
-	state.Tokens = int64(math.Min(float64(state.Tokens)+float64(refillAmount), float64(l.capacity)))
-	state.LastRefill = now
+		if !l.take(state, n, now) {
+			// A denied request leaves the stored state untouched, since refill is computed from it on the next request
+			log.Debug().Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Int64("tokens", state.Tokens).Msg("Limiter: Request denied")
+			return false, nil
+		}
 
-	// Check if allowed
-	if state.Tokens >= 1 {
-		state.Tokens--
 		// Save the updated state back to Memcache
-		value, err := json.Marshal(state)
+		value, err := l.codec.Marshal(state)
 		if err != nil {
-			log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Failed to marshal state for Memcache")
+			log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to marshal state for Memcache")
 			return false, fmt.Errorf("marshal state: %w", err)
 		}
-		if err := l.client.Set(&memcache.Item{Key: itemKey, Value: value}); err != nil {
-			log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Failed to set state in Memcache")
-			return false, fmt.Errorf("set state in memcache: %w", err)
+		switch {
+		case item == nil:
+			// Add fails if another request created the bucket since it was read
+			err = l.client.Add(&memcache.Item{Key: itemKey, Value: value})
+		case l.noCAS:
+			err = l.client.Set(&memcache.Item{Key: itemKey, Value: value})
+		default:
+			item.Value = value
+			err = l.client.CompareAndSwap(item)
 		}
-		log.Debug().Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", identifier).Int64("tokens", state.Tokens).Msg("Limiter: Request allowed")
-		return true, nil
-	} else {
-		// Save the state even if denied to update lastRefill time
-		value, err := json.Marshal(state)
-		if err != nil {
-			log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Failed to marshal state for Memcache")
-			return false, fmt.Errorf("marshal state: %w", err)
+		if err == memcache.ErrNotStored || err == memcache.ErrCASConflict {
+			// The bucket was created, updated or evicted since it was read
+			continue
 		}
-		if err := l.client.Set(&memcache.Item{Key: itemKey, Value: value}); err != nil {
-			log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", identifier).Msg("Limiter: Failed to set state in Memcache")
+		if err != nil {
+			log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Failed to set state in Memcache")
 			return false, fmt.Errorf("set state in memcache: %w", err)
 		}
-		log.Debug().Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", identifier).Int64("tokens", state.Tokens).Msg("Limiter: Request denied")
-		return false, nil
+		log.Debug().Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Int64("tokens", state.Tokens).Msg("Limiter: Request allowed")
+		return true, nil
+	}
+
+	err := fmt.Errorf("state of identifier changed by %d concurrent requests", maxAttempts)
+	log.Warn().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Memcache").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Msg("Limiter: Too much contention updating state in Memcache")
+	return false, fmt.Errorf("update state in memcache: %w", err)
+}
+
+// take refills the bucket up to time now and takes n tokens from it, borrowing against future refill in debt mode.
+// It reports whether the tokens were taken.
+func (l *limiter) take(state *tokenBucketState, n int, now time.Time) bool {
+	// Never let time move backwards for this bucket
+	now = clock.Clamp(now, state.LastRefill)
+
+	// Refill whole tokens, keeping the time towards the next token unless the bucket is full
+	elapsed := clock.Elapsed(state.LastRefill, now)
+	refillAmount := int64(math.Floor(float64(l.rate) * elapsed.Seconds()))
+	if state.Tokens+refillAmount >= int64(l.capacity) {
+		state.Tokens = int64(l.capacity)
+		state.LastRefill = now
+	} else if refillAmount > 0 {
+		state.Tokens += refillAmount
+		state.LastRefill = state.LastRefill.Add(time.Duration(refillAmount) * time.Second / time.Duration(l.rate))
+	}
+
+	cost := int64(n)
+	borrow := l.maxDebt > 0 && state.Tokens >= 0 && state.Tokens-cost >= -int64(l.maxDebt)
+	if state.Tokens >= cost || borrow {
+		state.Tokens -= cost
+		return true
 	}
+	return false
 }
@@ -9,6 +9,14 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log" // Import zerolog's global logger
 
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/internal/backendkey"
+	"learn.ratelimiter/internal/clock"
+	"learn.ratelimiter/internal/redisargs"
+	"learn.ratelimiter/internal/redisscripts"
+	"learn.ratelimiter/internal/redisstate"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/redact"
 	"learn.ratelimiter/types"
 )
 
@@ -18,62 +26,255 @@ type Limiter struct {
 	key      string
 	rate     int // tokens per second
 	capacity int
+	maxDebt  int // tokens that may be borrowed against future refill
 	client   *redis.Client
-	script   *redis.Script
+	script   *redisscripts.Script
+	keys     *backendkey.Builder // Composes the Redis key of each identifier
+	// serverTime makes the scripts read the Redis server's clock instead of taking the application's
+	serverTime bool
+}
+
+// Option configures optional behaviour of a limiter.
+type Option func(*Limiter)
+
+// WithKeyCache caches the Redis keys of up to size frequent identifiers instead of composing them on every check.
+func WithKeyCache(size int) Option {
+	return func(l *Limiter) {
+		l.keys = backendkey.NewBuilder(size, l.key)
+	}
+}
+
+// WithServerTime refills buckets by the Redis server's clock (TIME) instead of the application's if enabled,
+// so instances with skewed clocks agree on elapsed time. Times given to AllowAt are still used as given.
+func WithServerTime(enabled bool) Option {
+	return func(l *Limiter) {
+		l.serverTime = enabled
+	}
 }
 
 // NewLimiter creates a new Redis-based Token Bucket limiter.
-// It takes a unique key for the limiter, the rate at which tokens are added, the maximum capacity of the bucket, and a Redis client instance.
-func NewLimiter(key string, rate int, capacity int, client *redis.Client) types.Limiter {
-	log.Info().Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", key).Int("rate", rate).Int("capacity", capacity).Msg("Limiter: Initialized")
+// It takes a unique key for the limiter, the rate at which tokens are added, the maximum capacity of the bucket,
+// the maximum debt a request may borrow (0 disables debt mode), a Redis client instance, and optional behaviour.
+func NewLimiter(key string, rate int, capacity int, maxDebt int, client *redis.Client, opts ...Option) types.CostLimiter {
+	log.Info().Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", key).Int("rate", rate).Int("capacity", capacity).Int("max_debt", maxDebt).Msg("Limiter: Initialized")
 
-	return &Limiter{
+	l := &Limiter{
 		key:      key,
 		rate:     rate,
 		capacity: capacity,
+		maxDebt:  maxDebt,
 		client:   client,
-		script:   redisAllowScript,
+		script:   redisscripts.TokenBucketAllow,
+		keys:     backendkey.NewBuilder(0, key),
+	}
+	for _, opt := range opts {
+		opt(l)
 	}
+	return l
 }
 
 // Allow checks if a request for the given identifier is allowed based on the Token Bucket algorithm using Redis.
 // It executes a Lua script on Redis to atomically check and update the bucket.
 // It takes a context and an identifier and returns true if the request is allowed, false otherwise, and an error if any occurred.
 func (l *Limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.AllowN(ctx, identifier, 1)
+}
+
+// AllowN checks if a request consuming n tokens for the given identifier is allowed based on the Token Bucket algorithm using Redis.
+// In debt mode the script admits a request larger than the remaining tokens by borrowing up to maxDebt tokens.
+func (l *Limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now(), l.serverTime)
+	return result.Allowed, err
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t instead of the wall clock.
+// The script treats times earlier than the last refill time as the last refill time.
+func (l *Limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	result, err := l.allow(ctx, identifier, 1, t, false)
+	return result.Allowed, err
+}
+
+// AllowDetailed checks a request consuming n tokens for the given identifier as AllowN does, with the tokens left in
+// the bucket, when it is full again and, for a denied request, when the bucket holds enough tokens for it, all
+// computed by the script.
+func (l *Limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	return l.allow(ctx, identifier, n, time.Now(), l.serverTime)
+}
+
+// Reserve approximates a reservation: the request is checked once, and a denied one carries the time the bucket takes
+// to refill the tokens it lacked. Tokens are not taken ahead of refill, so maxWait is not used, and a retry after the
+// delay may be denied if other requests took the tokens meanwhile.
+func (l *Limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	result, err := l.allow(ctx, identifier, n, time.Now(), l.serverTime)
+	return types.Reservation{OK: result.Allowed, Delay: result.RetryAfter}, err
+}
+
+// allow evaluates a request consuming n tokens at time t, or at the Redis server's time if serverTime is set.
+func (l *Limiter) allow(ctx context.Context, identifier string, n int, t time.Time, serverTime bool) (types.Result, error) {
+	if err := types.CheckCost(n); err != nil {
+		return types.Result{}, err
+	}
 	// The actual key in Redis will be a combination of the limiter key and the identifier
-	redisKey := fmt.Sprintf("%s:%s", l.key, identifier)
+	redisKey := l.keys.Key(identifier)
 
-	now := time.Now().UnixMilli()
+	now := t.UnixMilli()
 
-	result, err := l.script.Run(
-		ctx,
-		l.client,
-		[]string{redisKey},
+	args := redisargs.Get(redisKey).Add(
 		l.capacity,
 		l.rate,
 		now,
-		1, // tokens to consume
-	).Result()
+		n, // tokens to consume
+		l.maxDebt,
+		redisstate.SchemaVersion,
+		scriptFlag(serverTime),
+	)
+	defer args.Release()
+	result, err := l.script.Run(ctx, l.client, args.Keys, args.Values...).Result()
 
 	if err != nil {
-		log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", identifier).Str("redis_key", redisKey).Msg("Limiter: Redis script execution failed")
-		return false, fmt.Errorf("redis script error for limiter '%s', identifier '%s': %w", l.key, identifier, err)
+		log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Redis script execution failed")
+		return types.Result{}, fmt.Errorf("redis script error for limiter '%s', identifier '%s': %w", l.key, redact.Identifier(identifier), err)
 	}
 
-	// The script returns a two-element array: [allowed, tokens]
+	// The script returns a six-element array: [allowed, tokens, status, stale, reset_ms, retry_ms]
 	// allowed is 1 if the request is allowed, 0 otherwise
 	// tokens is the number of tokens remaining after the request
+	// status is the redisstate status of the stored bucket
+	// stale is 1 if the timestamp was earlier than the last refill time
+	// reset_ms and retry_ms are the times until the bucket is full and until a denied request could be allowed
 	results, ok := result.([]interface{})
-	if !ok || len(results) != 2 {
-		log.Error().Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", identifier).Str("redis_key", redisKey).Msg("Limiter: Unexpected result from redis script")
-		return false, fmt.Errorf("unexpected result from redis script for limiter '%s', identifier '%s'", l.key, identifier)
+	if !ok || len(results) != 6 {
+		log.Error().Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Unexpected result from redis script")
+		return types.Result{}, fmt.Errorf("unexpected result from redis script for limiter '%s', identifier '%s'", l.key, redact.Identifier(identifier))
 	}
 
 	allowed, ok := results[0].(int64)
 	if !ok {
-		log.Error().Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", identifier).Str("redis_key", redisKey).Msg("Limiter: Unexpected allowed value type from redis script")
-		return false, fmt.Errorf("unexpected allowed value type from redis script for limiter '%s', identifier '%s'", l.key, identifier)
+		log.Error().Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Unexpected allowed value type from redis script")
+		return types.Result{}, fmt.Errorf("unexpected allowed value type from redis script for limiter '%s', identifier '%s'", l.key, redact.Identifier(identifier))
 	}
 
-	return allowed == 1, nil
+	status, ok := results[2].(int64)
+	if !ok {
+		log.Error().Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Unexpected status value type from redis script")
+		return types.Result{}, fmt.Errorf("unexpected status value type from redis script for limiter '%s', identifier '%s'", l.key, redact.Identifier(identifier))
+	}
+	if err := redisstate.Check(l.key, config.TokenBucket, status); err != nil {
+		return types.Result{}, err
+	}
+	if stale, _ := results[3].(int64); stale == 1 {
+		l.recordStale(identifier, t)
+	}
+
+	tokens, _ := results[1].(int64)
+	resetMillis, _ := results[4].(int64)
+	retryMillis, _ := results[5].(int64)
+	return types.Result{
+		Allowed:    allowed == 1,
+		Limit:      int64(l.capacity),
+		Remaining:  max(tokens, 0),
+		ResetAt:    time.Now().Add(time.Duration(resetMillis) * time.Millisecond),
+		RetryAfter: time.Duration(retryMillis) * time.Millisecond,
+	}, nil
+}
+
+// Lease takes up to n tokens from the bucket for the caller to serve locally and returns the number granted,
+// which is 0 if the bucket is empty.
+func (l *Limiter) Lease(ctx context.Context, identifier string, n int) (int, error) {
+	redisKey := l.keys.Key(identifier)
+	now := time.Now()
+	result, err := redisscripts.TokenBucketLease.Run(ctx, l.client, []string{redisKey}, l.capacity, l.rate, now.UnixMilli(), n, redisstate.SchemaVersion, scriptFlag(l.serverTime)).Result()
+	if err != nil {
+		log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Redis lease script execution failed")
+		return 0, fmt.Errorf("redis lease script error for limiter '%s', identifier '%s': %w", l.key, redact.Identifier(identifier), err)
+	}
+	values, err := redisstate.Ints(result, 3)
+	if err != nil {
+		return 0, fmt.Errorf("%w for key '%s', identifier '%s'", err, l.key, redact.Identifier(identifier))
+	}
+	if err := redisstate.Check(l.key, config.TokenBucket, values[1]); err != nil {
+		return 0, err
+	}
+	if values[2] == 1 {
+		l.recordStale(identifier, now)
+	}
+	return int(values[0]), nil
+}
+
+// Release returns n unused leased tokens to the bucket, up to its capacity.
+func (l *Limiter) Release(ctx context.Context, identifier string, n int) error {
+	redisKey := l.keys.Key(identifier)
+	result, err := redisscripts.TokenBucketRelease.Run(ctx, l.client, []string{redisKey}, l.capacity, n, redisstate.SchemaVersion).Result()
+	if err != nil {
+		log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Redis release script execution failed")
+		return fmt.Errorf("redis release script error for limiter '%s', identifier '%s': %w", l.key, redact.Identifier(identifier), err)
+	}
+	values, err := redisstate.Ints(result, 2)
+	if err != nil {
+		return fmt.Errorf("%w for key '%s', identifier '%s'", err, l.key, redact.Identifier(identifier))
+	}
+	return redisstate.Check(l.key, config.TokenBucket, values[1])
+}
+
+// Pressure returns the fraction of the identifier's bucket that is empty now, 1 while the bucket is in debt.
+// It reads the bucket without refilling or charging it.
+func (l *Limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	tokens, _, err := l.tokens(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	return min(1-tokens/float64(l.capacity), 1), nil
+}
+
+// ResetTime returns the time at which the identifier's bucket is full again, or now if it is full.
+// It reads the bucket without refilling or charging it.
+func (l *Limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	tokens, now, err := l.tokens(ctx, identifier)
+	if err != nil {
+		return time.Time{}, err
+	}
+	missing := float64(l.capacity) - tokens
+	return now.Add(time.Duration(missing / float64(l.rate) * float64(time.Second))), nil
+}
+
+// tokens reads the identifier's bucket and returns its tokens once refilled, negative while the bucket is in debt,
+// and the time they were counted at.
+func (l *Limiter) tokens(ctx context.Context, identifier string) (float64, time.Time, error) {
+	redisKey := l.keys.Key(identifier)
+	fields, err := l.client.HMGet(ctx, redisKey, "tokens", "last_refill_time", redisstate.VersionField).Result()
+	if err != nil {
+		log.Error().Err(err).Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Str("redis_key", redact.Identifier(redisKey)).Msg("Limiter: Redis pressure read failed")
+		return 0, time.Time{}, fmt.Errorf("redis pressure read error for limiter '%s', identifier '%s': %w", l.key, redact.Identifier(identifier), err)
+	}
+	if err := redisstate.CheckVersion(l.key, config.TokenBucket, fields[2]); err != nil {
+		return 0, time.Time{}, err
+	}
+	now := time.Now()
+	tokens, ok := redisstate.Float(fields[0])
+	if !ok {
+		// A missing bucket starts full
+		return float64(l.capacity), now, nil
+	}
+	lastRefill, _ := redisstate.Float(fields[1])
+	if l.serverTime {
+		if now, err = l.client.Time(ctx).Result(); err != nil {
+			return 0, time.Time{}, fmt.Errorf("redis time error for limiter '%s': %w", l.key, err)
+		}
+	}
+	return min(float64(l.capacity), tokens+clock.Elapsed(time.UnixMilli(int64(lastRefill)), now).Seconds()*float64(l.rate)), now, nil
+}
+
+// recordStale records a check at time t that the script evaluated at the bucket's later last refill time,
+// because the application's clock is behind the clock of the instance that last refilled it, or t was replayed.
+func (l *Limiter) recordStale(identifier string, t time.Time) {
+	metrics.RecordStaleTimestamp(l.key, string(config.TokenBucket))
+	log.Debug().Str("limiter_type", "TokenBucket").Str("backend", "Redis").Str("limiter_key", l.key).Str("identifier", redact.Identifier(identifier)).Time("timestamp", t).Msg("Limiter: Timestamp earlier than last refill, evaluated at last refill time")
+}
+
+// scriptFlag encodes a boolean script argument.
+func scriptFlag(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
 }
@@ -9,17 +9,20 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"learn.ratelimiter/internal/testenv"
 	redistb "learn.ratelimiter/internal/tokenbucket/redis"
 )
 
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testenv.Cleanup()
+	os.Exit(code)
+}
+
 // setupRedisClient initializes a Redis client for testing.
-// It assumes a Redis instance is running on the default address.
-func setupRedisClient(t *testing.T) *redis.Client {
-	redisAddr := "localhost:6379"
-	// Check if running in GitHub Actions CI
-	if os.Getenv("CI") == "true" {
-		redisAddr = "redis:6379"
-	}
+// The server is provided by testenv, which starts one in Docker if none is configured.
+func setupRedisClient(t testing.TB) *redis.Client {
+	redisAddr := testenv.Redis(t)
 
 	t.Logf("Connecting to Redis at %s", redisAddr) // Log the Redis address
 
@@ -40,7 +43,7 @@ func setupRedisClient(t *testing.T) *redis.Client {
 }
 
 // cleanupRedis clears keys used by a specific limiter key from Redis.
-func cleanupRedis(t *testing.T, client *redis.Client, limiterKey string) {
+func cleanupRedis(t testing.TB, client *redis.Client, limiterKey string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -69,7 +72,7 @@ func TestRedisTokenBucketLimiter(t *testing.T) {
 	cleanupRedis(t, client, limiterKey)
 
 	// Test case 1: Basic rate limiting within capacity
-	limiter1 := redistb.NewLimiter(limiterKey+"_basic", 10, 50, client)
+	limiter1 := redistb.NewLimiter(limiterKey+"_basic", 10, 50, 0, client)
 	ctx := context.Background()
 
 	for i := 0; i < 50; i++ {
@@ -94,7 +97,7 @@ func TestRedisTokenBucketLimiter(t *testing.T) {
 	// Test case 3: Token refill over time
 	limiter2Key := limiterKey + "_refill"
 	cleanupRedis(t, client, limiter2Key)
-	limiter2 := redistb.NewLimiter(limiter2Key, 10, 10, client) // Rate 10/sec, Capacity 10
+	limiter2 := redistb.NewLimiter(limiter2Key, 10, 10, 0, client) // Rate 10/sec, Capacity 10
 
 	// Consume all initial tokens
 	for i := 0; i < 10; i++ {
@@ -127,7 +130,7 @@ func TestRedisTokenBucketConcurrencyAndEdgeCases(t *testing.T) {
 	limiterKey := "test_redis_token_bucket_concurrency"
 	cleanupRedis(t, client, limiterKey)
 
-	limiter := redistb.NewLimiter(limiterKey, 10, 50, client) // Rate 10/sec, Capacity 50
+	limiter := redistb.NewLimiter(limiterKey, 10, 50, 0, client) // Rate 10/sec, Capacity 50
 	ctx := context.Background()
 
 	// Test case 1: Concurrency
@@ -167,7 +170,7 @@ func TestRedisTokenBucketConcurrencyAndEdgeCases(t *testing.T) {
 	// Test case 2: Edge cases
 	t.Run("EdgeCases", func(t *testing.T) {
 		// High rate and capacity
-		limiterHigh := redistb.NewLimiter(limiterKey+"_high", 1000, 10000, client)
+		limiterHigh := redistb.NewLimiter(limiterKey+"_high", 1000, 10000, 0, client)
 		for i := 0; i < 10000; i++ {
 			allowed, err := limiterHigh.Allow(ctx, fmt.Sprintf("user_high_%d", i))
 			if err != nil {
@@ -179,3 +182,70 @@ func TestRedisTokenBucketConcurrencyAndEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+// BenchmarkAllow measures a check against Redis, run with -benchmem to report allocations.
+func BenchmarkAllow(b *testing.B) {
+	client := setupRedisClient(b)
+	defer client.Close()
+
+	limiterKey := "bench_redis_token_bucket"
+	cleanupRedis(b, client, limiterKey)
+	limiter := redistb.NewLimiter(limiterKey, 1_000_000, 1_000_000, 0, client)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := limiter.Allow(ctx, "user1"); err != nil {
+			b.Fatalf("Allow returned error: %v", err)
+		}
+	}
+}
+
+// TestServerTime tests that a limiter using the server's clock refills by Redis TIME,
+// and that state refilled by an instance with a clock ahead is not refilled again until the server's clock catches up.
+func TestServerTime(t *testing.T) {
+	client := setupRedisClient(t)
+	defer client.Close()
+
+	limiterKey := fmt.Sprintf("test_redis_token_bucket_server_time_%d", time.Now().UnixNano())
+	redisKey := limiterKey + ":user1"
+	ctx := context.Background()
+	defer client.Del(ctx, redisKey)
+	limiter := redistb.NewLimiter(limiterKey, 1, 1, 0, client, redistb.WithServerTime(true))
+
+	allowed, err := limiter.Allow(ctx, "user1")
+	if err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+	serverTime, err := client.Time(ctx).Result()
+	if err != nil {
+		t.Fatalf("TIME failed: %v", err)
+	}
+	lastRefill, err := client.HGet(ctx, redisKey, "last_refill_time").Int64()
+	if err != nil {
+		t.Fatalf("HGET failed: %v", err)
+	}
+	if diff := serverTime.Sub(time.UnixMilli(lastRefill)); diff < 0 || diff > time.Second {
+		t.Errorf("Expected the last refill time to be the server's time, got %v before TIME", diff)
+	}
+
+	// An instance with a clock an hour ahead emptied the bucket
+	ahead := serverTime.Add(time.Hour).UnixMilli()
+	if err := client.HSet(ctx, redisKey, "tokens", 0, "last_refill_time", ahead).Err(); err != nil {
+		t.Fatalf("HSET failed: %v", err)
+	}
+	allowed, err = limiter.Allow(ctx, "user1")
+	if err != nil {
+		t.Fatalf("Allow returned error: %v", err)
+	}
+	if allowed {
+		t.Error("Request should be denied while the server's clock is behind the last refill time")
+	}
+	lastRefill, err = client.HGet(ctx, redisKey, "last_refill_time").Int64()
+	if err != nil {
+		t.Fatalf("HGET failed: %v", err)
+	}
+	if lastRefill != ahead {
+		t.Errorf("Expected the last refill time to stay %d, got %d", ahead, lastRefill)
+	}
+}
@@ -0,0 +1,227 @@
+// Package keyaudit scans the Redis keyspace of a limiter and reports the keys without a TTL, the keys idle longest
+// and an estimate of the memory they use, so operators can find keys leaked by script bugs or older versions.
+package keyaudit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/rekey"
+)
+
+// Defaults used for unset Options fields.
+const (
+	DefaultSampleSize    = 20
+	DefaultOldest        = 10
+	DefaultMemorySamples = 1000
+)
+
+// scanCount is the COUNT hint of each SCAN call, and so the size of the pipelines inspecting the keys found.
+const scanCount = 500
+
+// Options configures an audit.
+type Options struct {
+	// SampleSize caps the keys without a TTL listed in the report; it defaults to DefaultSampleSize, and a negative
+	// value lists none.
+	SampleSize int
+	// Oldest is the number of keys idle longest listed in the report; it defaults to DefaultOldest, and a negative
+	// value lists none.
+	Oldest int
+	// MemorySamples is the number of keys whose memory is measured with MEMORY USAGE; it defaults to
+	// DefaultMemorySamples, and a negative value measures none.
+	MemorySamples int
+}
+
+// Key describes one key of the report.
+type Key struct {
+	Key string `json:"key"`
+	// TTL is the remaining time to live of the key, or zero if it does not expire.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// Idle is the time since the key was last read or written, as OBJECT IDLETIME reports it.
+	Idle time.Duration `json:"idle"`
+}
+
+// Prefix counts the keys found under one prefix of the limiter (see rekey.Prefixes).
+type Prefix struct {
+	Prefix     string `json:"prefix"`
+	Keys       int    `json:"keys"`
+	WithoutTTL int    `json:"without_ttl"`
+}
+
+// Report summarizes an audit.
+type Report struct {
+	LimiterKey string `json:"limiter_key"`
+	// Scanned counts the keys found.
+	Scanned  int      `json:"scanned"`
+	Prefixes []Prefix `json:"prefixes"`
+	// WithoutTTL counts the keys that never expire. Limiter state is expected to expire once unused, so these are
+	// likely leaked.
+	WithoutTTL int `json:"without_ttl"`
+	// WithoutTTLSample lists the first keys without a TTL, up to Options.SampleSize.
+	WithoutTTLSample []string `json:"without_ttl_sample,omitempty"`
+	// Oldest lists the keys idle longest, longest first, up to Options.Oldest.
+	Oldest []Key `json:"oldest,omitempty"`
+	// IdleUnavailable reports that Redis does not track idle times (e.g., under an LFU maxmemory-policy), so
+	// Oldest is empty.
+	IdleUnavailable bool `json:"idle_unavailable,omitempty"`
+	// MemorySampled counts the keys measured with MEMORY USAGE, and SampledMemoryBytes their total size.
+	MemorySampled      int   `json:"memory_sampled"`
+	SampledMemoryBytes int64 `json:"sampled_memory_bytes"`
+	// EstimatedMemoryBytes extrapolates the sampled size to every key scanned. SCAN returns keys in hash order,
+	// so the first keys measured are a fair sample.
+	EstimatedMemoryBytes int64 `json:"estimated_memory_bytes"`
+}
+
+// audit accumulates a report.
+type audit struct {
+	report        Report
+	sampleSize    int
+	oldest        int
+	memorySamples int
+}
+
+// Run scans the keys holding the state of the limiter with the given key and reports on them. It only reads Redis,
+// so it can run against a limiter serving requests, though OBJECT IDLETIME and MEMORY USAGE are called once per key.
+//
+// Keys of another limiter whose key starts with limiterKey followed by ":" (e.g., "api:v2" for "api") match the
+// same prefix and are reported too.
+func Run(ctx context.Context, client *redis.Client, limiterKey string, opts Options) (Report, error) {
+	a := audit{
+		report:        Report{LimiterKey: limiterKey, Prefixes: []Prefix{}},
+		sampleSize:    defaultIfZero(opts.SampleSize, DefaultSampleSize),
+		oldest:        defaultIfZero(opts.Oldest, DefaultOldest),
+		memorySamples: defaultIfZero(opts.MemorySamples, DefaultMemorySamples),
+	}
+	if limiterKey == "" {
+		return a.report, errors.New("the limiter key is required")
+	}
+
+	for _, prefix := range rekey.Prefixes(limiterKey) {
+		counts := Prefix{Prefix: prefix}
+		var cursor uint64
+		for {
+			keys, next, err := client.Scan(ctx, cursor, escapePattern(prefix)+"*", scanCount).Result()
+			if err != nil {
+				return a.report, fmt.Errorf("scanning keys with prefix '%s': %w", prefix, err)
+			}
+			if err := a.inspect(ctx, client, keys, &counts); err != nil {
+				return a.report, err
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+		a.report.Prefixes = append(a.report.Prefixes, counts)
+	}
+	if a.report.MemorySampled > 0 {
+		a.report.EstimatedMemoryBytes = a.report.SampledMemoryBytes * int64(a.report.Scanned) / int64(a.report.MemorySampled)
+	}
+	log.Info().Str("limiter_key", limiterKey).Int("scanned", a.report.Scanned).Int("without_ttl", a.report.WithoutTTL).Int64("estimated_memory_bytes", a.report.EstimatedMemoryBytes).Msg("KeyAudit: Limiter keyspace audited")
+	return a.report, nil
+}
+
+// inspect reads the TTL, idle time and, while samples remain, memory usage of the keys in one pipeline, and adds
+// them to the report and the counts of their prefix. Keys that expired since they were scanned are skipped.
+func (a *audit) inspect(ctx context.Context, client *redis.Client, keys []string, counts *Prefix) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	pipe := client.Pipeline()
+	ttls := make([]*redis.DurationCmd, len(keys))
+	idles := make([]*redis.DurationCmd, len(keys))
+	sizes := make([]*redis.IntCmd, len(keys))
+	measured := a.report.MemorySampled
+	for i, key := range keys {
+		ttls[i] = pipe.PTTL(ctx, key)
+		if a.oldest > 0 && !a.report.IdleUnavailable {
+			idles[i] = pipe.ObjectIdleTime(ctx, key)
+		}
+		if measured < a.memorySamples {
+			sizes[i] = pipe.MemoryUsage(ctx, key)
+			measured++
+		}
+	}
+	// Errors of single commands (e.g., OBJECT IDLETIME under an LFU policy) are handled below
+	pipe.Exec(ctx)
+
+	for i, key := range keys {
+		ttl, err := ttls[i].Result()
+		if err != nil {
+			return fmt.Errorf("reading the TTL of key '%s': %w", key, err)
+		}
+		if ttl == -2 { // The key expired since it was scanned
+			continue
+		}
+		a.report.Scanned++
+		counts.Keys++
+		if ttl < 0 {
+			ttl = 0
+			a.report.WithoutTTL++
+			counts.WithoutTTL++
+			if len(a.report.WithoutTTLSample) < a.sampleSize {
+				a.report.WithoutTTLSample = append(a.report.WithoutTTLSample, key)
+			}
+		}
+		if idles[i] != nil && !a.report.IdleUnavailable {
+			idle, err := idles[i].Result()
+			switch {
+			case errors.Is(err, redis.Nil):
+			case err != nil:
+				log.Warn().Err(err).Msg("KeyAudit: Idle times unavailable, not reporting the oldest keys")
+				a.report.IdleUnavailable = true
+				a.report.Oldest = nil
+			default:
+				a.addOldest(Key{Key: key, TTL: ttl, Idle: idle})
+			}
+		}
+		if sizes[i] != nil {
+			if size, err := sizes[i].Result(); err == nil {
+				a.report.MemorySampled++
+				a.report.SampledMemoryBytes += size
+			}
+		}
+	}
+	return nil
+}
+
+// addOldest inserts the key in the keys idle longest if it is among them.
+func (a *audit) addOldest(key Key) {
+	oldest := a.report.Oldest
+	i := sort.Search(len(oldest), func(i int) bool { return oldest[i].Idle < key.Idle })
+	if i >= a.oldest {
+		return
+	}
+	if len(oldest) < a.oldest {
+		oldest = append(oldest, Key{})
+	}
+	copy(oldest[i+1:], oldest[i:])
+	oldest[i] = key
+	a.report.Oldest = oldest
+}
+
+// defaultIfZero returns def if n is zero, n otherwise.
+func defaultIfZero(n, def int) int {
+	if n == 0 {
+		return def
+	}
+	return n
+}
+
+// escapePattern escapes the glob characters of s for use in a SCAN pattern.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,68 @@
+// Package keyaudit_test contains tests for the audit of limiter keyspaces.
+package keyaudit_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/internal/testenv"
+	"learn.ratelimiter/keyaudit"
+	"learn.ratelimiter/rekey"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testenv.Cleanup()
+	os.Exit(code)
+}
+
+// TestRunRequiresKey tests that an empty limiter key is rejected before Redis is touched.
+func TestRunRequiresKey(t *testing.T) {
+	if _, err := keyaudit.Run(context.Background(), nil, "", keyaudit.Options{}); err == nil {
+		t.Error("Expected an empty limiter key rejected")
+	}
+}
+
+// TestRun tests that keys without a TTL are counted per prefix and listed, and that memory is sampled.
+func TestRun(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	limiterKey := fmt.Sprintf("keyaudit_%d", time.Now().UnixNano())
+	defer func() {
+		for _, prefix := range rekey.Prefixes(limiterKey) {
+			keys, _ := client.Keys(ctx, prefix+"*").Result()
+			if len(keys) > 0 {
+				client.Del(ctx, keys...)
+			}
+		}
+	}()
+
+	client.Set(ctx, limiterKey+":client1", "1", time.Hour)
+	client.HSet(ctx, limiterKey+":client2", "tokens", "3")
+	client.Set(ctx, "leaky_bucket:"+limiterKey+":client3", "{}", 0)
+	client.Set(ctx, limiterKey+"_other:client4", "1", 0) // Another limiter
+
+	report, err := keyaudit.Run(ctx, client, limiterKey, keyaudit.Options{MemorySamples: 2})
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if report.Scanned != 3 || report.WithoutTTL != 2 || len(report.WithoutTTLSample) != 2 {
+		t.Errorf("Expected 3 keys, 2 without a TTL, got %+v", report)
+	}
+	if report.Prefixes[0].Keys != 2 || report.Prefixes[0].WithoutTTL != 1 || report.Prefixes[1].Keys != 1 || report.Prefixes[1].WithoutTTL != 1 {
+		t.Errorf("Unexpected counts per prefix: %+v", report.Prefixes)
+	}
+	if !report.IdleUnavailable && len(report.Oldest) != 3 {
+		t.Errorf("Expected the 3 keys listed by idle time, got %+v", report.Oldest)
+	}
+	if report.MemorySampled != 2 || report.SampledMemoryBytes <= 0 || report.EstimatedMemoryBytes < report.SampledMemoryBytes {
+		t.Errorf("Expected 2 keys measured and extrapolated to 3, got %+v", report)
+	}
+}
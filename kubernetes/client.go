@@ -0,0 +1,174 @@
+// Package kubernetes runs the rate limiter as a Kubernetes workload: it discovers peers from the EndpointSlices
+// of a Service, keeps the configuration file in sync with a ConfigMap, and serves a readiness probe tied to backend health.
+// It talks to the Kubernetes API over plain HTTP with the pod's service account, without a client library.
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// ServiceAccountDir is where Kubernetes mounts the pod's service account token, CA certificate and namespace.
+const ServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// retryInterval is how long a failed sync or watch waits before it is retried.
+const retryInterval = 5 * time.Second
+
+// watchTimeout is how long the API server keeps a watch open before the client starts a new one.
+const watchTimeout = 5 * time.Minute
+
+// Client calls the Kubernetes API.
+type Client struct {
+	baseURL   string
+	namespace string
+	// token returns the bearer token, read on every call since projected service account tokens are rotated.
+	token func() (string, error)
+	http  *http.Client
+}
+
+// NewClient creates a client for the API server at baseURL, authenticating with token if not empty.
+// namespace is used for resources whose namespace is not configured.
+func NewClient(baseURL, token, namespace string, httpClient *http.Client) *Client {
+	return &Client{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		namespace: namespace,
+		token:     func() (string, error) { return token, nil },
+		http:      httpClient,
+	}
+}
+
+// NewInClusterClient creates a client for the API server of the cluster the pod runs in, authenticating with
+// the pod's service account. The service account needs get/list/watch access to the resources used.
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	ca, err := os.ReadFile(filepath.Join(ServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("reading service account CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in service account CA certificate")
+	}
+	namespace, err := os.ReadFile(filepath.Join(ServiceAccountDir, "namespace"))
+	if err != nil {
+		return nil, fmt.Errorf("reading service account namespace: %w", err)
+	}
+	return &Client{
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		namespace: strings.TrimSpace(string(namespace)),
+		token: func() (string, error) {
+			token, err := os.ReadFile(filepath.Join(ServiceAccountDir, "token"))
+			return strings.TrimSpace(string(token)), err
+		},
+		http: &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		}},
+	}, nil
+}
+
+// Namespace returns the namespace used for resources whose namespace is not configured.
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// do sends a GET request for path and returns the response body, which the caller must close.
+func (c *Client) do(ctx context.Context, path string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	token, err := c.token()
+	if err != nil {
+		return nil, fmt.Errorf("reading service account token: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp.Body, nil
+}
+
+// get decodes the JSON resource at path into out.
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	body, err := c.do(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return json.NewDecoder(body).Decode(out)
+}
+
+// watchEvent is an event of a watch stream. Only its type is used: every change triggers a full sync.
+type watchEvent struct {
+	Type string `json:"type"`
+}
+
+// waitForChange opens the watch at path (with watch=1 and the resource version set by the caller)
+// and returns once a change is reported, or the API server ends the watch.
+func (c *Client) waitForChange(ctx context.Context, path string) error {
+	body, err := c.do(ctx, fmt.Sprintf("%s&watch=1&timeoutSeconds=%d", path, int(watchTimeout.Seconds())))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	decoder := json.NewDecoder(body)
+	for {
+		var event watchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		switch event.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+			return nil
+		case "ERROR":
+			// Typically 410 Gone: the resource version is too old, so resync and watch from the current one
+			return fmt.Errorf("watch %s reported an error", path)
+		}
+	}
+}
+
+// syncLoop calls sync, then again after every change reported by a watch starting at the resource version it returned,
+// until ctx is done. watchPath returns the watch path for a resource version. Failures are retried after retryInterval.
+func (c *Client) syncLoop(ctx context.Context, what string, watchPath func(resourceVersion string) string, sync func(ctx context.Context) (string, error)) {
+	for ctx.Err() == nil {
+		resourceVersion, err := sync(ctx)
+		if err == nil {
+			err = c.waitForChange(ctx, watchPath(resourceVersion))
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("resource", what).Msg("Kubernetes: Sync failed, retrying")
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryInterval):
+			}
+		}
+	}
+}
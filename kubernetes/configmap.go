@@ -0,0 +1,108 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// configMap is the part of a v1 ConfigMap used as a configuration source.
+type configMap struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data"`
+}
+
+// ConfigMapSource keeps a configuration file in sync with a key of a ConfigMap, so configuration changes apply as soon
+// as the ConfigMap is updated instead of after the kubelet refreshes a mounted volume.
+type ConfigMapSource struct {
+	client    *Client
+	namespace string
+	name      string
+	key       string
+	path      string
+
+	// data is the content last written to path.
+	data string
+}
+
+// NewConfigMapSource creates a source writing the key of the ConfigMap namespace/name (namespace defaults to the pod's) to path.
+func NewConfigMapSource(client *Client, namespace, name, key, path string) *ConfigMapSource {
+	if namespace == "" {
+		namespace = client.Namespace()
+	}
+	return &ConfigMapSource{client: client, namespace: namespace, name: name, key: key, path: path}
+}
+
+// Sync fetches the ConfigMap once and writes its key to the file if it changed, reporting whether it did.
+// Call it before loading the configuration, so the file exists and is current.
+func (s *ConfigMapSource) Sync(ctx context.Context) (bool, error) {
+	changed, _, err := s.sync(ctx)
+	return changed, err
+}
+
+// Watch keeps the file in sync until ctx is done, calling onChange after every change written (e.g., to reload the limiters).
+func (s *ConfigMapSource) Watch(ctx context.Context, onChange func()) {
+	log.Info().Str("namespace", s.namespace).Str("config_map", s.name).Str("key", s.key).Str("config_path", s.path).Msg("Kubernetes: Watching configuration")
+	s.client.syncLoop(ctx, "configmap", func(resourceVersion string) string {
+		return s.listPath() + "&resourceVersion=" + url.QueryEscape(resourceVersion)
+	}, func(ctx context.Context) (string, error) {
+		changed, resourceVersion, err := s.sync(ctx)
+		if changed {
+			onChange()
+		}
+		return resourceVersion, err
+	})
+}
+
+// sync fetches the ConfigMap, writes its key to the file if it changed, and returns the ConfigMap's resource version.
+func (s *ConfigMapSource) sync(ctx context.Context) (bool, string, error) {
+	var cm configMap
+	if err := s.client.get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/configmaps/%s", url.PathEscape(s.namespace), url.PathEscape(s.name)), &cm); err != nil {
+		return false, "", err
+	}
+	data, ok := cm.Data[s.key]
+	if !ok {
+		return false, cm.Metadata.ResourceVersion, fmt.Errorf("config map '%s/%s' has no key '%s'", s.namespace, s.name, s.key)
+	}
+	if data == s.data {
+		return false, cm.Metadata.ResourceVersion, nil
+	}
+	if err := writeFileAtomic(s.path, []byte(data)); err != nil {
+		return false, cm.Metadata.ResourceVersion, err
+	}
+	s.data = data
+	log.Info().Str("config_map", s.name).Str("resource_version", cm.Metadata.ResourceVersion).Str("config_path", s.path).Msg("Kubernetes: Configuration updated from config map")
+	return true, cm.Metadata.ResourceVersion, nil
+}
+
+// listPath returns the API path listing only the ConfigMap, which watches require.
+func (s *ConfigMapSource) listPath() string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/configmaps?fieldSelector=%s",
+		url.PathEscape(s.namespace), url.QueryEscape("metadata.name="+s.name))
+}
+
+// writeFileAtomic replaces the file at path with data, so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
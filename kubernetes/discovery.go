@@ -0,0 +1,141 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+)
+
+// endpointSliceList is the part of a discovery.k8s.io/v1 EndpointSliceList used for discovery.
+type endpointSliceList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []struct {
+		Endpoints []struct {
+			Addresses  []string `json:"addresses"`
+			Conditions struct {
+				// Ready is nil when unknown, which Kubernetes asks consumers to treat as ready.
+				Ready *bool `json:"ready"`
+			} `json:"conditions"`
+		} `json:"endpoints"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"items"`
+}
+
+// PeerDiscovery keeps the peer list in sync with the ready endpoints of a Service, watching its EndpointSlices.
+type PeerDiscovery struct {
+	client    *Client
+	namespace string
+	service   string
+	portName  string
+	setPeers  func([]string)
+
+	synced atomic.Bool
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPeerDiscovery creates a discovery of the peers selected by the Service in cfg, passing each new peer list
+// to setPeers (e.g., peers.Node.SetPeers). Call Start to begin watching.
+func NewPeerDiscovery(client *Client, cfg config.KubernetesDiscoveryConfig, setPeers func([]string)) *PeerDiscovery {
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = client.Namespace()
+	}
+	return &PeerDiscovery{
+		client:    client,
+		namespace: namespace,
+		service:   cfg.Service,
+		portName:  cfg.PortName,
+		setPeers:  setPeers,
+		done:      make(chan struct{}),
+	}
+}
+
+// Start watches the Service's EndpointSlices in the background until Close is called.
+func (d *PeerDiscovery) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	log.Info().Str("namespace", d.namespace).Str("service", d.service).Msg("Kubernetes: Starting peer discovery")
+	go func() {
+		defer close(d.done)
+		d.client.syncLoop(ctx, "endpointslices", func(resourceVersion string) string {
+			return d.path() + "&resourceVersion=" + url.QueryEscape(resourceVersion)
+		}, d.sync)
+	}()
+}
+
+// Close stops watching. The last peer list stays in use.
+func (d *PeerDiscovery) Close() error {
+	if d.cancel != nil {
+		d.cancel()
+		<-d.done
+	}
+	return nil
+}
+
+// Ready returns an error until the peer list was discovered once, for readiness probes.
+func (d *PeerDiscovery) Ready(ctx context.Context) error {
+	if !d.synced.Load() {
+		return fmt.Errorf("peers of service '%s/%s' not discovered yet", d.namespace, d.service)
+	}
+	return nil
+}
+
+// Sync lists the Service's EndpointSlices once and passes the addresses of its ready endpoints to setPeers.
+func (d *PeerDiscovery) Sync(ctx context.Context) error {
+	_, err := d.sync(ctx)
+	return err
+}
+
+// sync lists the EndpointSlices, updates the peers and returns the list's resource version.
+func (d *PeerDiscovery) sync(ctx context.Context) (string, error) {
+	var list endpointSliceList
+	if err := d.client.get(ctx, d.path(), &list); err != nil {
+		return "", err
+	}
+	var addrs []string
+	for _, slice := range list.Items {
+		port := 0
+		for _, p := range slice.Ports {
+			if p.Name == d.portName || (d.portName == "" && len(slice.Ports) == 1) {
+				port = p.Port
+			}
+		}
+		if port == 0 {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			// Addresses of one endpoint are fungible; the first one identifies it
+			if len(endpoint.Addresses) > 0 {
+				addrs = append(addrs, net.JoinHostPort(endpoint.Addresses[0], strconv.Itoa(port)))
+			}
+		}
+	}
+	slices.Sort(addrs)
+	addrs = slices.Compact(addrs)
+	d.setPeers(addrs)
+	d.synced.Store(true)
+	return list.Metadata.ResourceVersion, nil
+}
+
+// path returns the API path listing the Service's EndpointSlices.
+func (d *PeerDiscovery) path() string {
+	return fmt.Sprintf("/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?labelSelector=%s",
+		url.PathEscape(d.namespace), url.QueryEscape("kubernetes.io/service-name="+d.service))
+}
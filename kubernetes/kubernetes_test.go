@@ -0,0 +1,186 @@
+// Package kubernetes_test contains tests for the Kubernetes integration against a fake API server.
+package kubernetes_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/kubernetes"
+)
+
+// fakeAPI serves an EndpointSlice list and a ConfigMap, and lets watches return once the state changes.
+type fakeAPI struct {
+	mu       sync.Mutex
+	slices   string
+	config   string
+	version  int
+	changed  chan struct{}
+	lastAuth string
+}
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{changed: make(chan struct{})}
+}
+
+// set replaces the state and wakes up pending watches.
+func (f *fakeAPI) set(slices, config string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.slices, f.config = slices, config
+	f.version++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// auth returns the Authorization header of the last request.
+func (f *fakeAPI) auth() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lastAuth
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.lastAuth = r.Header.Get("Authorization")
+	slices, config, version, changed := f.slices, f.config, f.version, f.changed
+	f.mu.Unlock()
+
+	if r.URL.Query().Get("watch") == "1" {
+		select {
+		case <-changed:
+			fmt.Fprintln(w, `{"type":"MODIFIED","object":{}}`)
+		case <-r.Context().Done():
+		}
+		return
+	}
+	switch r.URL.Path {
+	case "/apis/discovery.k8s.io/v1/namespaces/limiter/endpointslices":
+		if r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=ratelimiter" {
+			http.Error(w, "unexpected selector", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"metadata":{"resourceVersion":"%d"},"items":[%s]}`, version, slices)
+	case "/api/v1/namespaces/limiter/configmaps/ratelimiter":
+		fmt.Fprintf(w, `{"metadata":{"resourceVersion":"%d"},"data":{"config.yaml":%q}}`, version, config)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// slice returns an EndpointSlice with a peer port and one endpoint per address, the last one not ready.
+func slice(addrs ...string) string {
+	endpoints := ""
+	for i, addr := range addrs {
+		if i > 0 {
+			endpoints += ","
+		}
+		endpoints += fmt.Sprintf(`{"addresses":[%q],"conditions":{"ready":%v}}`, addr, i < len(addrs)-1)
+	}
+	return `{"endpoints":[` + endpoints + `],"ports":[{"name":"metrics","port":9090},{"name":"http","port":8080}]}`
+}
+
+// TestPeerDiscovery tests that ready endpoints of the Service are reported as peers, and that changes are watched.
+func TestPeerDiscovery(t *testing.T) {
+	api := newFakeAPI()
+	api.set(slice("10.0.0.2", "10.0.0.1", "10.0.0.9"), "")
+	server := httptest.NewServer(api)
+	defer server.Close()
+	client := kubernetes.NewClient(server.URL, "secret", "limiter", server.Client())
+
+	var mu sync.Mutex
+	var peers []string
+	discovery := kubernetes.NewPeerDiscovery(client, config.KubernetesDiscoveryConfig{Service: "ratelimiter", PortName: "http"}, func(p []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		peers = p
+	})
+	if err := discovery.Ready(context.Background()); err == nil {
+		t.Error("Expected discovery not to be ready before the first sync")
+	}
+	discovery.Start()
+	defer discovery.Close()
+
+	waitForPeers := func(expected []string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			mu.Lock()
+			got := slices.Clone(peers)
+			mu.Unlock()
+			if slices.Equal(got, expected) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected peers %v, got %v", expected, got)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitForPeers([]string{"10.0.0.1:8080", "10.0.0.2:8080"})
+	if err := discovery.Ready(context.Background()); err != nil {
+		t.Errorf("Expected discovery to be ready after the first sync, got %v", err)
+	}
+	if auth := api.auth(); auth != "Bearer secret" {
+		t.Errorf("Expected the bearer token to be sent, got %q", auth)
+	}
+
+	api.set(slice("10.0.0.3", "10.0.0.9"), "")
+	waitForPeers([]string{"10.0.0.3:8080"})
+}
+
+// TestConfigMapSource tests that the configuration file is written from the ConfigMap only when it changes.
+func TestConfigMapSource(t *testing.T) {
+	api := newFakeAPI()
+	api.set("", "limiters: []\n")
+	server := httptest.NewServer(api)
+	defer server.Close()
+	client := kubernetes.NewClient(server.URL, "", "limiter", server.Client())
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	source := kubernetes.NewConfigMapSource(client, "", "ratelimiter", "config.yaml", path)
+	for i, expected := range []bool{true, false} {
+		changed, err := source.Sync(context.Background())
+		if err != nil {
+			t.Fatalf("Sync returned error: %v", err)
+		}
+		if changed != expected {
+			t.Errorf("Sync %d: expected changed %v, got %v", i+1, expected, changed)
+		}
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "limiters: []\n" {
+		t.Errorf("Expected the config map data to be written, got %q (%v)", data, err)
+	}
+}
+
+// TestReadinessHandler tests that the probe fails while any check fails.
+func TestReadinessHandler(t *testing.T) {
+	var failing error
+	handler := kubernetes.ReadinessHandler(
+		func(ctx context.Context) error { return nil },
+		func(ctx context.Context) error { return failing },
+	)
+	for _, tt := range []struct {
+		err    error
+		status int
+	}{
+		{err: nil, status: http.StatusOK},
+		{err: errors.New("redis: connection refused"), status: http.StatusServiceUnavailable},
+	} {
+		failing = tt.err
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != tt.status {
+			t.Errorf("Expected status %d with check error %v, got %d", tt.status, tt.err, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// readinessTimeout bounds all checks of one readiness probe.
+const readinessTimeout = 2 * time.Second
+
+// Check reports why the instance cannot serve traffic yet, or nil if it can.
+type Check func(ctx context.Context) error
+
+// ReadinessHandler serves a readiness probe answering 200 while every check passes and 503 otherwise,
+// so Kubernetes only routes traffic to instances whose backends are reachable (e.g., api.BackendHealthCheck).
+func ReadinessHandler(checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		for _, check := range checks {
+			if err := check(ctx); err != nil {
+				log.Warn().Err(err).Msg("Kubernetes: Readiness check failed")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintln(w, "not ready:", err)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+}
@@ -0,0 +1,63 @@
+// Package limitlog gives each limiter a logger with its own level and sampling, so one noisy limiter can be debugged
+// (e.g., logging 1% of its denials at debug level) without raising the global verbosity. Like the global logger,
+// the configuration is process-wide: it is set when the limiters are created and on reload.
+//
+// The global level must not filter out the per-limiter levels: applications set the level of log.Logger
+// (log.Logger = log.Logger.Level(level)) rather than zerolog.SetGlobalLevel.
+package limitlog
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+)
+
+// loggers holds the logger of every limiter with a logging configuration, by limiter key.
+var loggers atomic.Pointer[map[string]*zerolog.Logger]
+
+// Configure sets the loggers of the limiters from their logging configuration, replacing the previous ones.
+// Loggers are derived from the global logger as it is when Configure is called. Invalid levels are ignored,
+// since configurations are validated when loaded.
+func Configure(cfgs []config.LimiterConfig) {
+	configured := make(map[string]*zerolog.Logger)
+	for _, cfg := range cfgs {
+		if cfg.Logging == nil {
+			continue
+		}
+		logger := log.Logger
+		if level, err := zerolog.ParseLevel(cfg.Logging.Level); err == nil && cfg.Logging.Level != "" {
+			logger = logger.Level(level)
+		}
+		if rate := cfg.Logging.SampleRate; rate != nil && *rate < 1 {
+			logger = logger.Sample(&zerolog.LevelSampler{
+				TraceSampler: sampler(*rate),
+				DebugSampler: sampler(*rate),
+				InfoSampler:  sampler(*rate),
+			})
+		}
+		configured[cfg.Key] = &logger
+	}
+	loggers.Store(&configured)
+}
+
+// For returns the logger of the limiter, or the global logger if the limiter has no logging configuration.
+func For(limiterKey string) *zerolog.Logger {
+	if configured := loggers.Load(); configured != nil {
+		if logger, ok := (*configured)[limiterKey]; ok {
+			return logger
+		}
+	}
+	return &log.Logger
+}
+
+// sampler writes a random fraction of events.
+type sampler float64
+
+// Sample implements zerolog.Sampler.
+func (s sampler) Sample(zerolog.Level) bool {
+	return rand.Float64() < float64(s)
+}
@@ -0,0 +1,80 @@
+package limitlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/limitlog"
+)
+
+// capture directs the global logger, at info level, to a buffer for the duration of the test.
+func capture(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := log.Logger
+	log.Logger = zerolog.New(&buf).Level(zerolog.InfoLevel)
+	t.Cleanup(func() {
+		log.Logger = previous
+		limitlog.Configure(nil)
+	})
+	return &buf
+}
+
+func rate(r float64) *float64 { return &r }
+
+// TestLevel tests that a limiter's level applies to its logger only.
+func TestLevel(t *testing.T) {
+	buf := capture(t)
+	limitlog.Configure([]config.LimiterConfig{{Key: "noisy", Logging: &config.LimiterLoggingConfig{Level: "debug"}}})
+
+	limitlog.For("noisy").Debug().Msg("noisy debug")
+	limitlog.For("other").Debug().Msg("other debug")
+	if !strings.Contains(buf.String(), "noisy debug") {
+		t.Error("Expected the debug log of the limiter with a debug level")
+	}
+	if strings.Contains(buf.String(), "other debug") {
+		t.Error("Expected no debug log for a limiter using the global level")
+	}
+}
+
+// TestSampleRate tests that logs below the warn level are sampled, while warnings are always written.
+func TestSampleRate(t *testing.T) {
+	buf := capture(t)
+	limitlog.Configure([]config.LimiterConfig{
+		{Key: "muted", Logging: &config.LimiterLoggingConfig{SampleRate: rate(0)}},
+		{Key: "sampled", Logging: &config.LimiterLoggingConfig{SampleRate: rate(0.5)}},
+	})
+
+	limitlog.For("muted").Info().Msg("muted info")
+	limitlog.For("muted").Warn().Msg("muted warning")
+	if strings.Contains(buf.String(), "muted info") {
+		t.Error("Expected info logs dropped with a sample rate of 0")
+	}
+	if !strings.Contains(buf.String(), "muted warning") {
+		t.Error("Expected warnings written whatever the sample rate")
+	}
+
+	buf.Reset()
+	for i := 0; i < 1000; i++ {
+		limitlog.For("sampled").Info().Msg("sampled info")
+	}
+	if n := strings.Count(buf.String(), "sampled info"); n < 350 || n > 650 {
+		t.Errorf("Expected about half of 1000 logs written, got %d", n)
+	}
+}
+
+// TestReconfigure tests that Configure replaces the previous configuration.
+func TestReconfigure(t *testing.T) {
+	buf := capture(t)
+	limitlog.Configure([]config.LimiterConfig{{Key: "noisy", Logging: &config.LimiterLoggingConfig{SampleRate: rate(0)}}})
+	limitlog.Configure([]config.LimiterConfig{{Key: "noisy"}})
+
+	limitlog.For("noisy").Info().Msg("noisy info")
+	if !strings.Contains(buf.String(), "noisy info") {
+		t.Error("Expected the limiter to use the global logger once its logging configuration is removed")
+	}
+}
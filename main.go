@@ -2,21 +2,32 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	"os" // Import os for stderr
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time" // Import time for zerolog
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"     // Import zerolog
 	"github.com/rs/zerolog/log" // Import zerolog's global logger
 
+	"learn.ratelimiter/admin"
 	ratelimiter "learn.ratelimiter/api"
+	"learn.ratelimiter/banlist"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/faults"
+	"learn.ratelimiter/kubernetes"
 	"learn.ratelimiter/metrics"
 	"learn.ratelimiter/middleware"
+	"learn.ratelimiter/openapi"
+	"learn.ratelimiter/peers"
 	// Import types to use types.Limiter
 )
 
@@ -29,23 +40,81 @@ func main() {
 
 	// Define flags
 	port := flag.Int("p", 8080, "Port to run the HTTP server on")
-	configPath := flag.String("config", "config.yaml", "Path to the configuration file")
+	configPath := flag.String("config", "config.yaml", "Path to the configuration file, or a directory of them")
 	logLevelStr := flag.String("log-level", "info", "Logging level (trace, debug, info, warn, error, fatal, panic)") // Add log level flag
+	expvarEnabled := flag.Bool("expvar", false, "Publish limiter configuration and counters under /debug/vars")
+	configMap := flag.String("config-map", "", "Keep the configuration file in sync with this Kubernetes ConfigMap ([namespace/]name), under the key named like the file")
+	traceExemplars := flag.Bool("trace-exemplars", false, "Attach the trace ID of denied requests' W3C traceparent header to the denial counter as an exemplar")
 
 	// Parse the command-line flags
 	flag.Parse()
 
-	// Set the global log level based on the flag
+	// Set the log level based on the flag. It is set on the global logger rather than as zerolog's global level,
+	// so limiters with their own logging level (see limitlog) can log below it
 	logLevel, err := zerolog.ParseLevel(*logLevelStr)
 	if err != nil {
 		log.Fatal().Err(err).Str("log_level", *logLevelStr).Msg("Invalid log level provided")
 	}
-	zerolog.SetGlobalLevel(logLevel)
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	log.Logger = log.Logger.Level(logLevel)
 
 	log.Info().Str("config_path", *configPath).Msg("Starting application initialization")
 
+	// In Kubernetes, the configuration file is optionally written from a ConfigMap, before anything reads it
+	var configSource *kubernetes.ConfigMapSource
+	if *configMap != "" {
+		client, err := kubernetes.NewInClusterClient()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Application startup failed: Error creating Kubernetes client")
+		}
+		namespace, name, found := strings.Cut(*configMap, "/")
+		if !found {
+			namespace, name = "", *configMap
+		}
+		configSource = kubernetes.NewConfigMapSource(client, namespace, name, filepath.Base(*configPath), *configPath)
+		if _, err := configSource.Sync(context.Background()); err != nil {
+			log.Fatal().Err(err).Str("config_map", *configMap).Msg("Application startup failed: Error reading configuration from config map")
+		}
+	}
+
+	// Every component is created from this one load, so they all see the same version of the configuration
+	cfgFile, err := ratelimiter.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error loading configuration")
+	}
+
+	// Per-identifier overrides are managed through the admin API and applied by the limiters
+	overrideTable, err := ratelimiter.NewOverrideTableFromConfig(cfgFile)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing overrides")
+	}
+	defer overrideTable.Close()
+
+	// Limiters are put in read-only mode (e.g., during a Redis migration) by configuration and through the admin API
+	readOnlySwitch, err := ratelimiter.NewReadOnlySwitchFromConfig(cfgFile)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing read-only mode")
+	}
+	defer readOnlySwitch.Close()
+
+	// In peer mode, in-memory limiters are shared with the other instances listed under peers
+	peerNode, err := ratelimiter.NewPeerNodeFromConfig(cfgFile)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing peer mode")
+	}
+	limiterOptions := []ratelimiter.LimiterOption{ratelimiter.WithOverrides(overrideTable), ratelimiter.WithReadOnly(readOnlySwitch)}
+	if peerNode != nil {
+		limiterOptions = append(limiterOptions, ratelimiter.WithPeers(peerNode))
+	}
+	// Builds with the chaos tag inject latency and failures into Redis commands, set through the admin API
+	var faultInjector *faults.Injector
+	if faults.Enabled {
+		faultInjector = faults.New()
+		limiterOptions = append(limiterOptions, ratelimiter.WithFaults(faultInjector))
+	}
+
 	// Use the new function to initialize multiple limiters and get the closer
-	limiters, limiterConfigs, closer, err := ratelimiter.NewLimitersFromConfigPath(*configPath)
+	limiters, limiterConfigs, closer, err := ratelimiter.NewLimitersFromConfig(cfgFile, limiterOptions...)
 	if err != nil {
 		// Use logger.Fatal for fatal errors
 		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing rate limiters from config")
@@ -55,6 +124,41 @@ func main() {
 
 	log.Info().Msg("All rate limiters successfully initialized.")
 
+	// Changed limiter configurations (e.g., a new algorithm) are applied in place on SIGHUP
+	reloader := ratelimiter.NewReloader(*configPath, limiters, limiterConfigs, limiterOptions...)
+	defer reloader.Close()
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+	go func() {
+		for range reloadSignals {
+			if _, err := reloader.Reload(); err != nil {
+				log.Error().Err(err).Str("config_path", *configPath).Msg("Configuration reload failed, keeping the current limiters")
+			}
+		}
+	}()
+
+	// ConfigMap changes are applied like SIGHUP reloads
+	if configSource != nil {
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go configSource.Watch(watchCtx, func() {
+			if _, err := reloader.Reload(); err != nil {
+				log.Error().Err(err).Str("config_path", *configPath).Msg("Configuration reload failed, keeping the current limiters")
+			}
+		})
+	}
+
+	// Peers are optionally discovered from the EndpointSlices of a Kubernetes Service
+	readinessChecks := []kubernetes.Check{ratelimiter.BackendHealthCheck(closer)}
+	peerDiscovery, err := ratelimiter.NewPeerDiscoveryFromConfig(cfgFile, peerNode)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing peer discovery")
+	}
+	if peerDiscovery != nil {
+		defer peerDiscovery.Close()
+		readinessChecks = append(readinessChecks, peerDiscovery.Ready)
+	}
+
 	// Retrieve specific limiters from the map
 	apiRateLimiterKey := "api_rate_limit"
 	apiRateLimiter, ok := limiters[apiRateLimiterKey]
@@ -81,36 +185,201 @@ func main() {
 	// You can now use different limiters for different routes or logic
 	apiMetrics := metrics.NewRateLimitMetrics()
 	userLoginMetrics := metrics.NewRateLimitMetrics()
+	enableIdentifierMetrics(apiMetrics, apiRateLimiterConfig)
+	enableIdentifierMetrics(userLoginMetrics, userLoginRateLimiterConfig)
+
+	// The fraction of requests denied per limiter and day is optionally reported, and served by the admin API
+	denialReporter, err := ratelimiter.NewDenialReporterFromConfig(cfgFile)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing denial reports")
+	}
+	adminOptions := []admin.Option{admin.WithOverrides(overrideTable), admin.WithLimiters(limiters), admin.WithBackends(ratelimiter.BackendRegistry(closer)), admin.WithReadOnly(readOnlySwitch)}
+	if denialReporter != nil {
+		defer denialReporter.Close()
+		adminOptions = append(adminOptions, admin.WithDenialReports(denialReporter))
+	}
+	if faultInjector != nil {
+		adminOptions = append(adminOptions, admin.WithFaults(faultInjector))
+	}
+
+	// Bans are managed through the admin API, optionally shared with other instances, and enforced by the middleware
+	bans := banlist.New()
+	banSync, err := ratelimiter.NewBanSyncFromConfig(cfgFile, bans)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing ban sync")
+	}
+	if banSync != nil {
+		defer banSync.Close()
+	}
+	adminHandler, auditSink, err := ratelimiter.NewAdminHandlerFromConfig(cfgFile, bans, adminOptions...)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing admin API")
+	}
+	defer auditSink.Close()
+
+	// Decisions are optionally replicated to a secondary store for analytics
+	decisionSink, err := ratelimiter.NewDecisionSinkFromConfig(cfgFile)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing decision sink")
+	}
+	if decisionSink != nil {
+		defer decisionSink.Close()
+	}
+
+	// A sample of denied requests is optionally mirrored for offline analysis
+	deniedMirror, err := ratelimiter.NewMirrorFromConfig(cfgFile)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing request mirror")
+	}
+	if deniedMirror != nil {
+		defer deniedMirror.Close()
+	}
+
+	// Utilization and denial rates are optionally summarized for autoscaling policies
+	autoscaleHints, err := ratelimiter.NewAutoscaleHintsFromConfig(cfgFile)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing autoscaling hints")
+	}
+	if autoscaleHints != nil {
+		defer autoscaleHints.Close()
+	}
+
+	// Spikes in deny rates are optionally reported as they happen
+	anomalyDetector, err := ratelimiter.NewAnomalyDetectorFromConfig(cfgFile)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing anomaly detection")
+	}
+	if anomalyDetector != nil {
+		defer anomalyDetector.Close()
+	}
+
+	// The application middlewares share their options
+	middlewareOptions := []middleware.Option{middleware.WithBanList(bans), middleware.WithDecisionSink(decisionSink), middleware.WithMirror(deniedMirror), middleware.WithAutoscaleHints(autoscaleHints), middleware.WithAnomalyDetector(anomalyDetector), middleware.WithDenialReporter(denialReporter)}
+	if *traceExemplars {
+		middlewareOptions = append(middlewareOptions, middleware.WithTraceExemplars(middleware.TraceparentTraceID))
+	}
 
 	// Pass the limiter key and algorithm to the middleware constructor
-	apiRateLimitMiddleware := middleware.NewRateLimitMiddleware(apiRateLimiter, apiMetrics, apiRateLimiterKey, apiRateLimiterConfig.Algorithm)
-	userLoginRateLimitMiddleware := middleware.NewRateLimitMiddleware(userLoginRateLimiter, userLoginMetrics, userLoginRateLimiterKey, userLoginRateLimiterConfig.Algorithm)
+	apiRateLimitMiddleware := middleware.NewRateLimitMiddleware(apiRateLimiter, apiMetrics, apiRateLimiterKey, apiRateLimiterConfig.Algorithm, middlewareOptions...)
+	userLoginRateLimitMiddleware := middleware.NewRateLimitMiddleware(userLoginRateLimiter, userLoginMetrics, userLoginRateLimiterKey, userLoginRateLimiterConfig.Algorithm, middlewareOptions...)
+
+	// Routes are registered on a dedicated mux, so handlers registered on http.DefaultServeMux by imported packages
+	// (e.g., expvar's /debug/vars) are only served when enabled below
+	mux := http.NewServeMux()
 
-	http.HandleFunc("/unlimited", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/unlimited", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintln(w, "Unlimited! Let's Go!")
 	})
 
 	// Apply the 'api_rate_limit' middleware to the /limited route
-	http.HandleFunc("/limited", apiRateLimitMiddleware.Handle(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/limited", apiRateLimitMiddleware.Handle(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintln(w, "Limited, don't over use me!")
 	}, getClientIP))
 
 	// Example of applying the 'user_login_rate_limit' middleware to another route
-	http.HandleFunc("/login", userLoginRateLimitMiddleware.Handle(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/login", userLoginRateLimitMiddleware.Handle(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintln(w, "Login attempt processed!")
 	}, getClientIP))
 
-	// Expose Prometheus metrics endpoint
-	http.Handle("/metrics", promhttp.Handler())
+	// Requests carrying an API key are limited by the limiter of the key's plan, if API keys are configured
+	apiKeyRegistry, apiKeysConfig, err := ratelimiter.NewAPIKeyRegistryFromConfig(cfgFile)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing API keys")
+	}
+	if apiKeyRegistry != nil {
+		defer apiKeyRegistry.Close()
+		planMetrics := metrics.NewRateLimitMetrics()
+		plans := make(map[string]*middleware.RateLimitMiddleware, len(apiKeysConfig.Plans))
+		for plan, limiterKey := range apiKeysConfig.Plans {
+			planCfg := limiterConfigs[limiterKey]
+			plans[plan] = middleware.NewRateLimitMiddleware(limiters[limiterKey], planMetrics, limiterKey, planCfg.Algorithm, middlewareOptions...)
+		}
+		apiKeyMiddleware := middleware.NewAPIKeyMiddleware(apiKeyRegistry, apiKeysConfig.Header, plans)
+		mux.HandleFunc("/keyed", apiKeyMiddleware.Handle(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintln(w, "Limited by your plan!")
+		}))
+	}
+
+	// The operational endpoints are rate limited per client by small built-in limiters
+	endpointLimiters, endpointConfigs, err := ratelimiter.NewEndpointLimitersFromConfig(cfgFile)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing endpoint limiters")
+	}
+	endpointMetrics := metrics.NewRateLimitMetrics()
+	limitEndpoint := func(endpoint string, handler http.Handler) http.Handler {
+		limiter, ok := endpointLimiters[endpoint]
+		if !ok {
+			return handler
+		}
+		cfg := endpointConfigs[endpoint]
+		return middleware.NewRateLimitMiddleware(limiter, endpointMetrics, cfg.Key, cfg.Algorithm).Handle(handler.ServeHTTP, getClientIP)
+	}
+
+	// Expose Prometheus metrics endpoint (see newMetricsHandler)
+	mux.Handle("/metrics", limitEndpoint(config.EndpointMetrics, newMetricsHandler()))
+
+	// Expose the autoscaling hints as JSON, e.g., for the KEDA metrics-api scaler
+	if autoscaleHints != nil {
+		mux.Handle("/autoscale", limitEndpoint(config.EndpointMetrics, autoscaleHints))
+	}
+
+	// Optionally expose limiter configuration and counters to Go debug tooling, alongside the runtime's memstats and cmdline
+	if *expvarEnabled {
+		if err := ratelimiter.PublishExpvar(limiters, reloader.Configs); err != nil {
+			log.Fatal().Err(err).Msg("Application startup failed: Error publishing expvar")
+		}
+		mux.Handle("/debug/vars", limitEndpoint(config.EndpointMetrics, expvar.Handler()))
+	}
+
+	// Expose the admin API, validating requests against its OpenAPI document
+	mux.Handle("/admin/", limitEndpoint(config.EndpointAdmin, openapi.Validate(adminHandler)))
+
+	// Expose the OpenAPI document of the admin and check APIs, e.g., for generating clients
+	mux.Handle(openapi.Path, limitEndpoint(config.EndpointMetrics, openapi.Handler()))
+
+	// Serve checks forwarded by peers, and by Gubernator HTTP clients
+	if peerNode != nil {
+		mux.Handle(peers.Path, openapi.Validate(peerNode))
+	}
+
+	// Expose a liveness endpoint for probes
+	mux.Handle("/healthz", limitEndpoint(config.EndpointHealthz, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})))
+
+	// Expose a readiness endpoint, failing while a backend is unreachable
+	mux.Handle("/readyz", limitEndpoint(config.EndpointHealthz, kubernetes.ReadinessHandler(readinessChecks...)))
 
 	// Construct the address string using the parsed port
 	addr := fmt.Sprintf(":%d", *port)
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	// New connections are optionally limited per source IP before any request is read
+	connLimiter, err := ratelimiter.NewConnLimiterFromConfig(cfgFile, limiters)
+	if err != nil {
+		log.Fatal().Err(err).Str("config_path", *configPath).Msg("Application startup failed: Error initializing connection limiter")
+	}
+	if connLimiter != nil {
+		connLimiter.Install(server)
+	}
+
 	log.Info().Str("address", addr).Msg("Starting HTTP server")
 	// Use logger.Fatal for fatal errors from ListenAndServe
-	log.Fatal().Err(http.ListenAndServe(addr, nil)).Str("address", addr).Msg("HTTP server stopped")
+	log.Fatal().Err(server.ListenAndServe()).Str("address", addr).Msg("HTTP server stopped")
+}
+
+// enableIdentifierMetrics turns on per-identifier metrics for the limiter if its configuration asks for them.
+func enableIdentifierMetrics(m *metrics.RateLimitMetrics, cfg config.LimiterConfig) {
+	if cfg.IdentifierMetrics == nil {
+		return
+	}
+	m.EnableIdentifierMetrics(cfg.Key, cfg.IdentifierMetrics.MaxIdentifiers, cfg.IdentifierMetrics.Hash)
+	log.Info().Str("limiter_key", cfg.Key).Int("max_identifiers", cfg.IdentifierMetrics.MaxIdentifiers).Bool("hash", cfg.IdentifierMetrics.Hash).Msg("Identifier metrics enabled")
 }
 
 // getClientIP extracts the client's IP address from the request.
@@ -0,0 +1,36 @@
+//go:build !noprometheus
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// The collectors are created through these aliases and functions, so builds with the noprometheus tag can replace
+// them with no-ops (see collectors_excluded.go) and not link the Prometheus client.
+type (
+	counterOpts  = prometheus.CounterOpts
+	gaugeOpts    = prometheus.GaugeOpts
+	counterVec   = prometheus.CounterVec
+	metricLabels = prometheus.Labels
+)
+
+// newCounterVec creates a counter vector registered with the default registerer.
+func newCounterVec(opts counterOpts, labelNames []string) *counterVec {
+	return promauto.NewCounterVec(opts, labelNames)
+}
+
+// newGaugeVec creates a gauge vector registered with the default registerer.
+func newGaugeVec(opts gaugeOpts, labelNames []string) *prometheus.GaugeVec {
+	return promauto.NewGaugeVec(opts, labelNames)
+}
+
+// incWithExemplar increments counter, attaching the trace ID as an exemplar if the counter supports exemplars.
+func incWithExemplar(counter prometheus.Counter, traceID string) {
+	if adder, ok := counter.(prometheus.ExemplarAdder); ok {
+		adder.AddWithExemplar(1, prometheus.Labels{"trace_id": traceID})
+	} else {
+		counter.Inc()
+	}
+}
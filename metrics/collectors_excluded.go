@@ -0,0 +1,37 @@
+//go:build noprometheus
+
+package metrics
+
+// Builds with the noprometheus tag replace the collectors with no-ops, so they do not link the Prometheus client.
+// Counts and the RateLimitMetrics counters are still kept.
+
+// counterOpts and gaugeOpts hold the fields of the Prometheus options used by this package.
+type (
+	counterOpts struct{ Name, Help string }
+	gaugeOpts   struct{ Name, Help string }
+)
+
+// metricLabels are the label values of a Prometheus series.
+type metricLabels map[string]string
+
+// counterVec is a collector vector recording nothing, standing in for both counters and gauges.
+type counterVec struct{}
+
+// collector is a series of a counterVec, recording nothing.
+type collector struct{}
+
+func newCounterVec(counterOpts, []string) *counterVec { return &counterVec{} }
+
+func newGaugeVec(gaugeOpts, []string) *counterVec { return &counterVec{} }
+
+func (*counterVec) WithLabelValues(...string) collector { return collector{} }
+
+func (*counterVec) DeletePartialMatch(metricLabels) int { return 0 }
+
+func (collector) Inc() {}
+
+func (collector) Add(float64) {}
+
+func (collector) Set(float64) {}
+
+func incWithExemplar(collector, string) {}
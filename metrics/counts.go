@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// LimiterCounts is a snapshot of the requests decided for one limiter key since the process started,
+// kept independently of Prometheus so it can be read in process (e.g., by expvar).
+type LimiterCounts struct {
+	// Allowed is the number of requests allowed.
+	Allowed int64
+	// Denied is the number of requests denied, including requests denied because of a limiter error.
+	Denied int64
+	// Errors is the number of requests the limiter failed to decide.
+	Errors int64
+}
+
+// limiterCounters holds the live counts of one limiter key.
+type limiterCounters struct {
+	allowed atomic.Int64
+	denied  atomic.Int64
+	errors  atomic.Int64
+}
+
+// counters maps a limiter key to its *limiterCounters.
+var counters sync.Map
+
+// countersFor returns the counters of the limiter key, creating them on first use.
+func countersFor(limiterKey string) *limiterCounters {
+	if c, ok := counters.Load(limiterKey); ok {
+		return c.(*limiterCounters)
+	}
+	c, _ := counters.LoadOrStore(limiterKey, &limiterCounters{})
+	return c.(*limiterCounters)
+}
+
+// RecordLimiterError counts a request the limiter failed to decide (e.g., because its backend is unreachable).
+func RecordLimiterError(limiterKey string) {
+	countersFor(limiterKey).errors.Add(1)
+}
+
+// Counts returns the counts recorded so far for the limiter key.
+func Counts(limiterKey string) LimiterCounts {
+	c := countersFor(limiterKey)
+	return LimiterCounts{
+		Allowed: c.allowed.Load(),
+		Denied:  c.denied.Load(),
+		Errors:  c.errors.Load(),
+	}
+}
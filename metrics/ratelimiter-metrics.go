@@ -2,12 +2,525 @@
 package metrics
 
 import (
+	"sync"
 	"sync/atomic"
+	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"learn.ratelimiter/redact"
 )
 
+// OtherIdentifierLabel is the identifier label value used once a limiter has reached its distinct identifier cap.
+const OtherIdentifierLabel = "other"
+
+// DefaultMaxIdentifiers is the distinct identifier cap used when identifier metrics are enabled without one.
+const DefaultMaxIdentifiers = 100
+
+// OtherTagLabel is the tag label value used once a limiter has reached its distinct tag cap.
+const OtherTagLabel = "other"
+
+// MaxTags is the number of distinct tag label values recorded per limiter.
+const MaxTags = 50
+
+// LabelIdleTimeout is how long an identifier or tag label value keeps its place under the cap without being recorded.
+// Once the cap is reached, label values idle for longer are dropped, along with their series, to make room.
+const LabelIdleTimeout = time.Hour
+
+// labelSweepInterval bounds how often idle label values are looked for while the cap is reached, so a flood of new
+// identifiers does not scan the label values on every request.
+const labelSweepInterval = time.Minute
+
+// Prometheus collectors (see collectors.go) are registered once per process and shared by all RateLimitMetrics instances,
+// since registering the same metric name twice panics.
+var (
+	allowedRequestsVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_allowed_requests_total",
+			Help: "Total number of requests allowed by the rate limiter.",
+		},
+		[]string{"limiter_key", "algorithm"},
+	)
+	rejectedRequestsVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_rejected_requests_total",
+			Help: "Total number of requests rejected by the rate limiter.",
+		},
+		[]string{"limiter_key", "algorithm"},
+	)
+	stateSchemaMismatchVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_state_schema_mismatch_total",
+			Help: "Total number of times a limiter found stored state written with another schema version, by whether it was older (upgraded) or newer (left untouched).",
+		},
+		[]string{"limiter_key", "algorithm", "schema"},
+	)
+	regionShareVec = newGaugeVec(
+		gaugeOpts{
+			Name: "rate_limiter_region_share",
+			Help: "Fraction of the global budget currently enforced by this instance's region, for limiters with a regional budget.",
+		},
+		[]string{"limiter_key", "region"},
+	)
+	decisionsDroppedVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_decision_sink_dropped_total",
+			Help: "Total number of decisions the decision sink failed to replicate, by reason (overflow or write_error).",
+		},
+		[]string{"reason"},
+	)
+	backendRefreshVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_backend_refresh_total",
+			Help: "Total number of backend address refresh events, by configured address and event (changed: the host resolves to new addresses; error: re-resolution failed; retired: a connection to an old address was closed).",
+		},
+		[]string{"address", "event"},
+	)
+	mirrorDroppedVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_mirror_dropped_total",
+			Help: "Total number of sampled denied requests the mirror failed to write, by reason (overflow or write_error).",
+		},
+		[]string{"reason"},
+	)
+	identifierRequestsVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_identifier_requests_total",
+			Help: "Total number of requests per identifier, for limiters with identifier metrics enabled. Identifiers beyond the per-limiter cap are reported as \"other\".",
+		},
+		[]string{"limiter_key", "identifier", "result"},
+	)
+	tarpitVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_tarpit_total",
+			Help: "Total number of rate limited requests reaching the tarpit, by outcome (delayed, or bypassed when the tarpit was full).",
+		},
+		[]string{"limiter_key", "outcome"},
+	)
+	connRejectedVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_connections_rejected_total",
+			Help: "Total number of TCP connections closed before being served, by reason (rate, active or error).",
+		},
+		[]string{"limiter_key", "reason"},
+	)
+	loadShedVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_load_shed_total",
+			Help: "Total number of requests rejected by load shedding before the limiter was consulted, by reason (deadline or load).",
+		},
+		[]string{"limiter_key", "reason"},
+	)
+	disabledVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_disabled_requests_total",
+			Help: "Total number of requests passed through without being rate limited because the limiter was disabled for them (e.g., by a feature flag).",
+		},
+		[]string{"limiter_key"},
+	)
+	bulkheadSaturatedVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_bulkhead_saturated_total",
+			Help: "Total number of requests answered by the failure mode because the limiter's bulkhead was at capacity, by failure mode (open or closed).",
+		},
+		[]string{"limiter_key", "failure_mode"},
+	)
+	memoryPressureVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_redis_memory_pressure_total",
+			Help: "Total number of Redis memory pressure events per limiter, by event (oom for checks rejected for lack of memory, evicted for evicted identifier keys, denied for requests denied by the eviction policy).",
+		},
+		[]string{"limiter_key", "event"},
+	)
+	readOnlyVec = newGaugeVec(
+		gaugeOpts{
+			Name: "rate_limiter_read_only",
+			Help: "Whether backend writes are disabled for the limiter (1) or not (0); limiter_key \"*\" applies to every limiter.",
+		},
+		[]string{"limiter_key"},
+	)
+	readOnlyChecksVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_read_only_checks_total",
+			Help: "Total number of checks answered in read-only mode, by outcome (allowed, denied, or unevaluated for checks allowed without reading the state).",
+		},
+		[]string{"limiter_key", "outcome"},
+	)
+	migrationChecksVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_migration_checks_total",
+			Help: "Total number of checks of limiters being migrated between backends, by result (agree, primary_allowed or primary_denied when the backends' decisions diverge, secondary_error).",
+		},
+		[]string{"limiter_key", "result"},
+	)
+	failOpenVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_fail_open_total",
+			Help: "Total number of requests allowed because the check of a limiter started in degraded mode failed with an error.",
+		},
+		[]string{"limiter_key"},
+	)
+	backendErrorsVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_backend_errors_total",
+			Help: "Total number of requests a limiter failed to decide, by error class (timeout, connection, noscript, oom, saturated, serialization, canceled or other).",
+		},
+		[]string{"limiter_key", "class"},
+	)
+	leaseUnbackedVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_lease_unbacked_tokens_total",
+			Help: "Total number of tokens admitted from a lease's staleness budget while its backend was unreachable.",
+		},
+		[]string{"limiter_key"},
+	)
+	leaseOverAdmittedVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_lease_over_admitted_tokens_total",
+			Help: "Total number of unbacked tokens the central bucket could not cover once its backend was reachable again, i.e., the observed over-admission.",
+		},
+		[]string{"limiter_key"},
+	)
+	peerForwardsVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_peer_forwards_total",
+			Help: "Total number of checks forwarded to the owning peer in peer mode, by result (ok or error).",
+		},
+		[]string{"limiter_key", "result"},
+	)
+	oversizedIdentifiersVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_oversized_identifiers_total",
+			Help: "Total number of identifiers longer than the limiter's maximum identifier length, by policy applied (hash or reject).",
+		},
+		[]string{"limiter_key", "policy"},
+	)
+	staleTimestampsVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_stale_timestamps_total",
+			Help: "Total number of checks whose time was earlier than the latest time stored for the key (clock skew or replays), evaluated at the stored time instead.",
+		},
+		[]string{"limiter_key", "algorithm"},
+	)
+	autoscaleUtilizationVec = newGaugeVec(
+		gaugeOpts{
+			Name: "rate_limiter_autoscale_utilization",
+			Help: "Mean fraction of the budget in use after the limiter's checks over the window, for autoscaling policies.",
+		},
+		[]string{"limiter_key", "window"},
+	)
+	autoscaleSustainedUtilizationVec = newGaugeVec(
+		gaugeOpts{
+			Name: "rate_limiter_autoscale_sustained_utilization",
+			Help: "Lowest utilization of the limiter over any interval within the window; above a threshold only if utilization stayed above it for the whole window.",
+		},
+		[]string{"limiter_key", "window"},
+	)
+	autoscaleDenialRateVec = newGaugeVec(
+		gaugeOpts{
+			Name: "rate_limiter_autoscale_denial_rate",
+			Help: "Fraction of the limiter's checks denied over the window, for autoscaling policies.",
+		},
+		[]string{"limiter_key", "window"},
+	)
+	keyOverflowVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_key_overflow_total",
+			Help: "Total number of requests for new identifiers arriving while the limiter tracked its maximum number of identifiers, by policy applied (reject, overflow or evict).",
+		},
+		[]string{"limiter_key", "policy"},
+	)
+	uniqueIdentifiersVec = newGaugeVec(
+		gaugeOpts{
+			Name: "rate_limiter_unique_identifiers",
+			Help: "Estimated number of distinct identifiers checked by the limiter in the latest complete interval, by this instance or, when merged in Redis, by all instances.",
+		},
+		[]string{"limiter_key"},
+	)
+	denyRateAnomaliesVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_deny_rate_anomalies_total",
+			Help: "Total number of abnormal spikes in the limiter's deny rate detected, counted when each spike starts.",
+		},
+		[]string{"limiter_key"},
+	)
+	denyRateZScoreVec = newGaugeVec(
+		gaugeOpts{
+			Name: "rate_limiter_deny_rate_zscore",
+			Help: "Standard deviations between the limiter's deny rate in the latest interval and its moving baseline.",
+		},
+		[]string{"limiter_key"},
+	)
+	taggedRequestsVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_tagged_requests_total",
+			Help: "Total number of requests per tag, for middlewares tagging requests. Tags beyond the per-limiter cap are reported as \"other\".",
+		},
+		[]string{"limiter_key", "tag", "result"},
+	)
+	backendConnectionUpVec = newGaugeVec(
+		gaugeOpts{
+			Name: "rate_limiter_backend_connection_up",
+			Help: "Whether the backend connection answered its latest health check (1) or not (0).",
+		},
+		[]string{"connection", "backend"},
+	)
+	backendConnectionPoolVec = newGaugeVec(
+		gaugeOpts{
+			Name: "rate_limiter_backend_connection_pool_conns",
+			Help: "Number of connections in the backend connection's pool, by state (total or idle), as of its latest health check.",
+		},
+		[]string{"connection", "state"},
+	)
+	limiterConfigInfoVec = newGaugeVec(
+		gaugeOpts{
+			Name: "rate_limiter_limiter_config_info",
+			Help: "Configured algorithm and backend of each limiter, always 1.",
+		},
+		[]string{"limiter_key", "algorithm", "backend"},
+	)
+	configuredLimitVec = newGaugeVec(
+		gaugeOpts{
+			Name: "rate_limiter_configured_limit",
+			Help: "Configured parameters of each limiter: limit and window_seconds for window algorithms, rate (per second), capacity and max_debt for bucket algorithms.",
+		},
+		[]string{"limiter_key", "parameter"},
+	)
+	redisScriptRunsVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_redis_script_runs_total",
+			Help: "Total number of Lua script runs against Redis, by script and result (ok or error).",
+		},
+		[]string{"script", "result"},
+	)
+	redisScriptLoadsVec = newCounterVec(
+		counterOpts{
+			Name: "rate_limiter_redis_script_loads_total",
+			Help: "Total number of times a Lua script was sent to Redis in full, by script and reason (preload, or noscript when the server's script cache missed it).",
+		},
+		[]string{"script", "reason"},
+	)
+)
+
+// Values of the schema label of the state schema mismatch metric.
+const (
+	StateSchemaOlder = "older"
+	StateSchemaNewer = "newer"
+)
+
+// RecordStateSchemaMismatch counts stored state found in an older or newer schema version (StateSchemaOlder or StateSchemaNewer).
+// Backends call it directly since they are shared by all RateLimitMetrics instances.
+func RecordStateSchemaMismatch(limiterKey, algorithm, schema string) {
+	stateSchemaMismatchVec.WithLabelValues(limiterKey, algorithm, schema).Inc()
+}
+
+// SetRegionShare records the fraction of a limiter's global budget currently enforced by the region.
+func SetRegionShare(limiterKey, region string, share float64) {
+	regionShareVec.WithLabelValues(limiterKey, region).Set(share)
+}
+
+// RecordDecisionsDropped counts n decisions the decision sink dropped for the given reason.
+func RecordDecisionsDropped(reason string, n int) {
+	decisionsDroppedVec.WithLabelValues(reason).Add(float64(n))
+}
+
+// RecordMirrorDropped counts n mirrored requests the mirror dropped for the given reason.
+func RecordMirrorDropped(reason string, n int) {
+	mirrorDroppedVec.WithLabelValues(reason).Add(float64(n))
+}
+
+// RecordLoadShed counts a request the middleware shed for the given reason.
+func RecordLoadShed(limiterKey, reason string) {
+	loadShedVec.WithLabelValues(limiterKey, reason).Inc()
+}
+
+// RecordDisabled counts a request passed through because the limiter was disabled for it.
+func RecordDisabled(limiterKey string) {
+	disabledVec.WithLabelValues(limiterKey).Inc()
+}
+
+// RecordTarpit counts a rate limited request the tarpit delayed or, when full, answered immediately.
+func RecordTarpit(limiterKey, outcome string) {
+	tarpitVec.WithLabelValues(limiterKey, outcome).Inc()
+}
+
+// RecordConnRejected counts a connection the connection limiter closed for the given reason.
+func RecordConnRejected(limiterKey, reason string) {
+	connRejectedVec.WithLabelValues(limiterKey, reason).Inc()
+}
+
+// RecordBulkheadSaturated counts a request a limiter's bulkhead answered with the failure mode instead of calling the backend.
+func RecordBulkheadSaturated(limiterKey, failureMode string) {
+	bulkheadSaturatedVec.WithLabelValues(limiterKey, failureMode).Inc()
+}
+
+// Memory pressure events recorded by RecordMemoryPressure.
+const (
+	MemoryPressureOOM     = "oom"
+	MemoryPressureEvicted = "evicted"
+	MemoryPressureDenied  = "denied"
+)
+
+// RecordMemoryPressure counts a Redis memory pressure event of a limiter.
+func RecordMemoryPressure(limiterKey, event string) {
+	memoryPressureVec.WithLabelValues(limiterKey, event).Inc()
+}
+
+// SetReadOnly records whether backend writes are disabled for the limiter, or every limiter.
+func SetReadOnly(limiterKey string, readOnly bool) {
+	if readOnly {
+		readOnlyVec.WithLabelValues(limiterKey).Set(1)
+	} else {
+		readOnlyVec.WithLabelValues(limiterKey).Set(0)
+	}
+}
+
+// Read-only check outcomes recorded by RecordReadOnlyCheck.
+const (
+	ReadOnlyAllowed     = "allowed"
+	ReadOnlyDenied      = "denied"
+	ReadOnlyUnevaluated = "unevaluated"
+)
+
+// RecordReadOnlyCheck counts a check answered in read-only mode.
+func RecordReadOnlyCheck(limiterKey, outcome string) {
+	readOnlyChecksVec.WithLabelValues(limiterKey, outcome).Inc()
+}
+
+// Migration check results recorded by RecordMigrationCheck.
+const (
+	MigrationAgree          = "agree"
+	MigrationPrimaryAllowed = "primary_allowed"
+	MigrationPrimaryDenied  = "primary_denied"
+	MigrationSecondaryError = "secondary_error"
+)
+
+// RecordMigrationCheck counts a check of a limiter being migrated between backends by how the backends' decisions compare.
+func RecordMigrationCheck(limiterKey, result string) {
+	migrationChecksVec.WithLabelValues(limiterKey, result).Inc()
+}
+
+// RecordFailOpen counts a request allowed because the check of a degraded limiter failed with an error.
+func RecordFailOpen(limiterKey string) {
+	failOpenVec.WithLabelValues(limiterKey).Inc()
+}
+
+// RecordBackendError counts a request the limiter failed to decide, by the class of the error (see errclass.Classify).
+func RecordBackendError(limiterKey, class string) {
+	backendErrorsVec.WithLabelValues(limiterKey, class).Inc()
+}
+
+// RecordLeaseUnbacked counts n tokens a leasing limiter admitted from its staleness budget.
+func RecordLeaseUnbacked(limiterKey string, n int) {
+	leaseUnbackedVec.WithLabelValues(limiterKey).Add(float64(n))
+}
+
+// RecordLeaseOverAdmitted counts n admitted tokens the central bucket could not cover on reconciliation.
+func RecordLeaseOverAdmitted(limiterKey string, n int) {
+	leaseOverAdmittedVec.WithLabelValues(limiterKey).Add(float64(n))
+}
+
+// RecordPeerForward counts a check forwarded to its owning peer, with result "ok" or "error".
+func RecordPeerForward(limiterKey, result string) {
+	peerForwardsVec.WithLabelValues(limiterKey, result).Inc()
+}
+
+// RecordOversizedIdentifier counts an identifier exceeding the limiter's maximum length, with the policy applied to it.
+func RecordOversizedIdentifier(limiterKey, policy string) {
+	oversizedIdentifiersVec.WithLabelValues(limiterKey, policy).Inc()
+}
+
+// RecordKeyOverflow counts a new identifier beyond the limiter's maximum number of identifiers, with the policy applied to it.
+func RecordKeyOverflow(limiterKey, policy string) {
+	keyOverflowVec.WithLabelValues(limiterKey, policy).Inc()
+}
+
+// SetUniqueIdentifiers records the estimated number of distinct identifiers checked by the limiter in the latest complete interval.
+func SetUniqueIdentifiers(limiterKey string, count uint64) {
+	uniqueIdentifiersVec.WithLabelValues(limiterKey).Set(float64(count))
+}
+
+// RecordDenyRateAnomaly counts the start of an abnormal spike in the limiter's deny rate.
+func RecordDenyRateAnomaly(limiterKey string) {
+	denyRateAnomaliesVec.WithLabelValues(limiterKey).Inc()
+}
+
+// SetDenyRateZScore sets how many standard deviations the limiter's latest deny rate is from its baseline.
+func SetDenyRateZScore(limiterKey string, zScore float64) {
+	denyRateZScoreVec.WithLabelValues(limiterKey).Set(zScore)
+}
+
+// RecordStaleTimestamp counts a check whose time was earlier than the latest time stored for the key in the backend.
+func RecordStaleTimestamp(limiterKey, algorithm string) {
+	staleTimestampsVec.WithLabelValues(limiterKey, algorithm).Inc()
+}
+
+// SetAutoscaleHint sets the autoscaling hints of the limiter over the window (e.g., "5m").
+func SetAutoscaleHint(limiterKey, window string, utilization, sustainedUtilization, denialRate float64) {
+	autoscaleUtilizationVec.WithLabelValues(limiterKey, window).Set(utilization)
+	autoscaleSustainedUtilizationVec.WithLabelValues(limiterKey, window).Set(sustainedUtilization)
+	autoscaleDenialRateVec.WithLabelValues(limiterKey, window).Set(denialRate)
+}
+
+// RecordBackendRefresh counts a refresh event (see dialer.Refreshing) of the backend at address.
+func RecordBackendRefresh(address, event string) {
+	backendRefreshVec.WithLabelValues(address, event).Inc()
+}
+
+// SetBackendConnectionHealth records the result of a backend connection's health check and the size of its pool.
+func SetBackendConnectionHealth(connection, backend string, up bool, totalConns, idleConns int) {
+	value := 0.0
+	if up {
+		value = 1
+	}
+	backendConnectionUpVec.WithLabelValues(connection, backend).Set(value)
+	backendConnectionPoolVec.WithLabelValues(connection, "total").Set(float64(totalConns))
+	backendConnectionPoolVec.WithLabelValues(connection, "idle").Set(float64(idleConns))
+}
+
+// Values of the reason label of the Redis script loads metric.
+const (
+	RedisScriptPreload  = "preload"
+	RedisScriptNoScript = "noscript"
+)
+
+// RecordRedisScriptRun counts a run of the named Lua script, by whether it failed.
+func RecordRedisScriptRun(script string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	redisScriptRunsVec.WithLabelValues(script, result).Inc()
+}
+
+// RecordRedisScriptLoad counts a Lua script sent to Redis in full, for a reason (RedisScriptPreload or RedisScriptNoScript).
+func RecordRedisScriptLoad(script, reason string) {
+	redisScriptLoadsVec.WithLabelValues(script, reason).Inc()
+}
+
+// Values of the parameter label of the configured limit metric.
+const (
+	ConfiguredLimit         = "limit"
+	ConfiguredWindowSeconds = "window_seconds"
+	ConfiguredRate          = "rate"
+	ConfiguredCapacity      = "capacity"
+	ConfiguredMaxDebt       = "max_debt"
+)
+
+// SetLimiterConfig records the configured algorithm, backend and parameters (keyed by the Configured constants) of
+// a limiter, replacing those recorded earlier for the same key, e.g., before a reload.
+func SetLimiterConfig(limiterKey, algorithm, backend string, params map[string]float64) {
+	DeleteLimiterConfig(limiterKey)
+	limiterConfigInfoVec.WithLabelValues(limiterKey, algorithm, backend).Set(1)
+	for parameter, value := range params {
+		configuredLimitVec.WithLabelValues(limiterKey, parameter).Set(value)
+	}
+}
+
+// DeleteLimiterConfig removes the configuration recorded by SetLimiterConfig for a limiter that no longer exists.
+func DeleteLimiterConfig(limiterKey string) {
+	limiterConfigInfoVec.DeletePartialMatch(metricLabels{"limiter_key": limiterKey})
+	configuredLimitVec.DeletePartialMatch(metricLabels{"limiter_key": limiterKey})
+}
+
 // RateLimitMetrics keeps track of rate limiting statistics.
 type RateLimitMetrics struct {
 	// TotalRequests is the total number of requests processed by the rate limiter.
@@ -18,27 +531,37 @@ type RateLimitMetrics struct {
 	AllowedRequests int32
 
 	// Prometheus metrics
-	allowedRequests  *prometheus.CounterVec
-	rejectedRequests *prometheus.CounterVec
+	allowedRequests    *counterVec
+	rejectedRequests   *counterVec
+	identifierRequests *counterVec
+	taggedRequests     *counterVec
+
+	// identifierLabelers maps a limiter key to its *identifierLabeler when identifier metrics are enabled.
+	identifierLabelers sync.Map
+	// tagLabelers maps a limiter key to the *identifierLabeler bounding its tag label values.
+	tagLabelers sync.Map
+}
+
+// identifierLabeler bounds the identifier label values recorded for one limiter.
+type identifierLabeler struct {
+	mu sync.Mutex
+	// lastSeen maps each admitted label value to the time it was last recorded.
+	lastSeen map[string]time.Time
+	// swept is when idle label values were last looked for.
+	swept          time.Time
+	maxIdentifiers int
+	hash           bool
+	// evict deletes the series of a dropped label value.
+	evict func(label string)
 }
 
 // NewRateLimitMetrics creates a new instance of RateLimitMetrics.
 func NewRateLimitMetrics() *RateLimitMetrics {
 	metrics := &RateLimitMetrics{
-		allowedRequests: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "rate_limiter_allowed_requests_total",
-				Help: "Total number of requests allowed by the rate limiter.",
-			},
-			[]string{"limiter_key", "algorithm"},
-		),
-		rejectedRequests: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "rate_limiter_rejected_requests_total",
-				Help: "Total number of requests rejected by the rate limiter.",
-			},
-			[]string{"limiter_key", "algorithm"},
-		),
+		allowedRequests:    allowedRequestsVec,
+		rejectedRequests:   rejectedRequestsVec,
+		identifierRequests: identifierRequestsVec,
+		taggedRequests:     taggedRequestsVec,
 	}
 	return metrics
 }
@@ -55,11 +578,122 @@ func (r *RateLimitMetrics) RecordRequest(allowed bool) {
 	}
 }
 
-// RecordRequestWithLabels updates the Prometheus metrics with labels.
+// RecordRequestWithLabels updates the Prometheus metrics with labels and the limiter key's counts returned by Counts.
 func (r *RateLimitMetrics) RecordRequestWithLabels(allowed bool, limiterKey, algorithm string) {
 	if allowed {
 		r.allowedRequests.WithLabelValues(limiterKey, algorithm).Inc()
+		countersFor(limiterKey).allowed.Add(1)
 	} else {
 		r.rejectedRequests.WithLabelValues(limiterKey, algorithm).Inc()
+		countersFor(limiterKey).denied.Add(1)
+	}
+}
+
+// RecordRequestWithExemplar is RecordRequestWithLabels, attaching the trace ID as an exemplar to the rejected requests
+// counter for a rejected request, so a spike of denials links to representative traces. Exemplars are exposed in the
+// OpenMetrics format only. An empty trace ID attaches no exemplar.
+func (r *RateLimitMetrics) RecordRequestWithExemplar(allowed bool, limiterKey, algorithm, traceID string) {
+	if allowed || traceID == "" {
+		r.RecordRequestWithLabels(allowed, limiterKey, algorithm)
+		return
+	}
+	incWithExemplar(r.rejectedRequests.WithLabelValues(limiterKey, algorithm), traceID)
+	countersFor(limiterKey).denied.Add(1)
+}
+
+// EnableIdentifierMetrics turns on per-identifier metrics for the limiter.
+// At most maxIdentifiers distinct identifier label values are recorded (DefaultMaxIdentifiers if not positive);
+// further identifiers are counted under OtherIdentifierLabel until others are idle for LabelIdleTimeout.
+// If hash is true, identifiers are hashed with redact.Hash before use as labels.
+func (r *RateLimitMetrics) EnableIdentifierMetrics(limiterKey string, maxIdentifiers int, hash bool) {
+	if maxIdentifiers <= 0 {
+		maxIdentifiers = DefaultMaxIdentifiers
+	}
+	r.identifierLabelers.Store(limiterKey, &identifierLabeler{
+		lastSeen:       make(map[string]time.Time),
+		maxIdentifiers: maxIdentifiers,
+		hash:           hash,
+		evict: func(label string) {
+			r.identifierRequests.DeletePartialMatch(metricLabels{"limiter_key": limiterKey, "identifier": label})
+		},
+	})
+}
+
+// RecordIdentifierRequest updates the per-identifier metrics for the limiter.
+// It does nothing unless identifier metrics were enabled for the limiter.
+func (r *RateLimitMetrics) RecordIdentifierRequest(allowed bool, limiterKey, identifier string) {
+	label, ok := r.IdentifierLabel(limiterKey, identifier)
+	if !ok {
+		return
+	}
+	result := "rejected"
+	if allowed {
+		result = "allowed"
+	}
+	r.identifierRequests.WithLabelValues(limiterKey, label, result).Inc()
+}
+
+// RecordTaggedRequest updates the per-tag metrics for the limiter.
+// At most MaxTags distinct tags are recorded per limiter; further tags are counted under OtherTagLabel until others
+// are idle for LabelIdleTimeout.
+func (r *RateLimitMetrics) RecordTaggedRequest(allowed bool, limiterKey, tag string) {
+	v, ok := r.tagLabelers.Load(limiterKey)
+	if !ok {
+		v, _ = r.tagLabelers.LoadOrStore(limiterKey, &identifierLabeler{
+			lastSeen:       make(map[string]time.Time),
+			maxIdentifiers: MaxTags,
+			evict: func(label string) {
+				r.taggedRequests.DeletePartialMatch(metricLabels{"limiter_key": limiterKey, "tag": label})
+			},
+		})
+	}
+	result := "rejected"
+	if allowed {
+		result = "allowed"
+	}
+	r.taggedRequests.WithLabelValues(limiterKey, v.(*identifierLabeler).label(tag, time.Now()), result).Inc()
+}
+
+// IdentifierLabel returns the label value recorded for the identifier under the limiter,
+// and false if identifier metrics are not enabled for the limiter.
+func (r *RateLimitMetrics) IdentifierLabel(limiterKey, identifier string) (string, bool) {
+	return r.IdentifierLabelAt(limiterKey, identifier, time.Now())
+}
+
+// IdentifierLabelAt is IdentifierLabel for a request recorded at time now.
+func (r *RateLimitMetrics) IdentifierLabelAt(limiterKey, identifier string, now time.Time) (string, bool) {
+	v, ok := r.identifierLabelers.Load(limiterKey)
+	if !ok {
+		return "", false
+	}
+	return v.(*identifierLabeler).label(identifier, now), true
+}
+
+// label returns the bounded label value for the identifier recorded at time now, admitting new values until the cap
+// is reached and dropping idle values to make room once it is.
+func (l *identifierLabeler) label(identifier string, now time.Time) string {
+	if l.hash {
+		identifier = redact.Hash(identifier)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.lastSeen[identifier]; ok {
+		l.lastSeen[identifier] = now
+		return identifier
+	}
+	if len(l.lastSeen) >= l.maxIdentifiers && now.Sub(l.swept) >= labelSweepInterval {
+		l.swept = now
+		for label, seen := range l.lastSeen {
+			if now.Sub(seen) >= LabelIdleTimeout {
+				delete(l.lastSeen, label)
+				l.evict(label)
+			}
+		}
+	}
+	if len(l.lastSeen) >= l.maxIdentifiers {
+		return OtherIdentifierLabel
 	}
+	l.lastSeen[identifier] = now
+	return identifier
 }
@@ -0,0 +1,80 @@
+// Package metrics_test contains tests for the rate limiter metrics.
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/redact"
+)
+
+// TestIdentifierLabelCap tests that identifiers beyond the cap are rolled into the "other" label.
+func TestIdentifierLabelCap(t *testing.T) {
+	m := metrics.NewRateLimitMetrics()
+
+	if _, ok := m.IdentifierLabel("disabled", "user1"); ok {
+		t.Fatal("Identifier metrics should be disabled by default")
+	}
+
+	m.EnableIdentifierMetrics("capped", 2, false)
+	for _, id := range []string{"user1", "user2"} {
+		if label, _ := m.IdentifierLabel("capped", id); label != id {
+			t.Errorf("Expected label %q, got %q", id, label)
+		}
+	}
+	if label, _ := m.IdentifierLabel("capped", "user3"); label != metrics.OtherIdentifierLabel {
+		t.Errorf("Expected identifier beyond the cap to be labelled %q, got %q", metrics.OtherIdentifierLabel, label)
+	}
+	// Identifiers admitted before the cap was reached keep their label
+	if label, _ := m.IdentifierLabel("capped", "user1"); label != "user1" {
+		t.Errorf("Expected label user1, got %q", label)
+	}
+}
+
+// TestIdentifierLabelHash tests that hashed labels are stable and do not reveal the identifier.
+func TestIdentifierLabelHash(t *testing.T) {
+	m := metrics.NewRateLimitMetrics()
+	m.EnableIdentifierMetrics("hashed", 10, true)
+
+	first, _ := m.IdentifierLabel("hashed", "203.0.113.7")
+	second, _ := m.IdentifierLabel("hashed", "203.0.113.7")
+	if first != second {
+		t.Errorf("Expected stable hashed label, got %q and %q", first, second)
+	}
+	if strings.Contains(first, "203.0.113.7") || len(first) != 16 {
+		t.Errorf("Unexpected hashed label %q", first)
+	}
+	// Hashed labels are keyed like hashed logs, so the two can be correlated
+	if want := redact.Hash("203.0.113.7"); first != want {
+		t.Errorf("Expected the hashed label to match redact.Hash, %q, got %q", want, first)
+	}
+}
+
+// TestIdentifierLabelIdle tests that once the cap is reached, idle identifiers make room for new ones.
+func TestIdentifierLabelIdle(t *testing.T) {
+	m := metrics.NewRateLimitMetrics()
+	m.EnableIdentifierMetrics("idle", 2, false)
+	start := time.Now()
+
+	m.IdentifierLabelAt("idle", "user1", start)
+	m.IdentifierLabelAt("idle", "user2", start)
+	// user2 stays active while user1 goes idle
+	m.IdentifierLabelAt("idle", "user2", start.Add(metrics.LabelIdleTimeout/2))
+	if label, _ := m.IdentifierLabelAt("idle", "user3", start.Add(metrics.LabelIdleTimeout/2)); label != metrics.OtherIdentifierLabel {
+		t.Errorf("Expected user3 to be labelled %q while no identifier is idle, got %q", metrics.OtherIdentifierLabel, label)
+	}
+
+	// The next sweep finds user1 idle, so user3 takes its place
+	later := start.Add(metrics.LabelIdleTimeout + time.Minute)
+	if label, _ := m.IdentifierLabelAt("idle", "user3", later); label != "user3" {
+		t.Errorf("Expected user3 to take the place of idle user1, got %q", label)
+	}
+	if label, _ := m.IdentifierLabelAt("idle", "user2", later); label != "user2" {
+		t.Errorf("Expected active user2 to keep its label, got %q", label)
+	}
+	if label, _ := m.IdentifierLabelAt("idle", "user1", later); label != metrics.OtherIdentifierLabel {
+		t.Errorf("Expected returning user1 to be labelled %q, got %q", metrics.OtherIdentifierLabel, label)
+	}
+}
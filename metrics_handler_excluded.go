@@ -0,0 +1,10 @@
+//go:build noprometheus
+
+package main
+
+import "net/http"
+
+// newMetricsHandler answers 404 Not Found: builds with the noprometheus tag record no Prometheus metrics.
+func newMetricsHandler() http.Handler {
+	return http.NotFoundHandler()
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/apikeys"
+)
+
+// APIKeyMiddleware resolves the API key of each request to its plan and rate limits the request with that plan's middleware,
+// identifying the client by the key's name. Requests without a known API key are rejected with 401 Unauthorized.
+type APIKeyMiddleware struct {
+	registry *apikeys.Registry
+	header   string
+	// plans maps each plan to the middleware enforcing its limits.
+	plans map[string]*RateLimitMiddleware
+}
+
+// NewAPIKeyMiddleware creates a middleware reading API keys from the given request header, resolving them with the registry,
+// and limiting each plan with its middleware.
+func NewAPIKeyMiddleware(registry *apikeys.Registry, header string, plans map[string]*RateLimitMiddleware) *APIKeyMiddleware {
+	return &APIKeyMiddleware{registry: registry, header: header, plans: plans}
+}
+
+// Handle wraps an http.HandlerFunc with API key resolution and the rate limiting of the key's plan.
+// The resolved key is available to next through apikeys.FromContext.
+func (m *APIKeyMiddleware) Handle(next http.HandlerFunc) http.HandlerFunc {
+	handlers := make(map[string]http.HandlerFunc, len(m.plans))
+	for plan, planMiddleware := range m.plans {
+		handlers[plan] = planMiddleware.Handle(next, apiKeyName)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey, ok := m.registry.Lookup(r.Header.Get(m.header))
+		if !ok {
+			log.Info().Str("header", m.header).Str("path", r.URL.Path).Msg("Middleware: Request without a valid API key denied")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler, ok := handlers[apiKey.Plan]
+		if !ok {
+			log.Error().Str("api_key", apiKey.Name).Str("plan", apiKey.Plan).Msg("Middleware: No limiter for the API key's plan")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		handler(w, r.WithContext(apikeys.WithAPIKey(r.Context(), apiKey)))
+	}
+}
+
+// apiKeyName returns the name of the API key resolved for the request.
+func apiKeyName(r *http.Request) string {
+	apiKey, _ := apikeys.FromContext(r.Context())
+	return apiKey.Name
+}
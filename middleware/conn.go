@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+
+	"learn.ratelimiter/internal/errclass"
+	"learn.ratelimiter/limitlog"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// Reasons a connection was rejected, used as the reason label of the connection rejection metric.
+const (
+	ConnRejectRate   = "rate"
+	ConnRejectActive = "active"
+	ConnRejectError  = "error"
+)
+
+// ConnLimiter limits the TCP connections an http.Server accepts per source IP, below the HTTP request level:
+// new connections are checked against a limiter, and optionally capped per source IP while open, so floods of
+// connections (e.g., slowloris-style clients holding connections open) are closed before any request is read.
+//
+// Checks run in the server's accept loop, so the limiter should answer quickly (e.g., an in-memory limiter).
+// The source IP is the connection's remote address: behind a proxy or load balancer, it is the proxy's address.
+type ConnLimiter struct {
+	limiter    types.Limiter
+	limiterKey string
+	// maxActive caps the open connections per source IP; zero leaves them uncapped.
+	maxActive int
+
+	mu     sync.Mutex
+	active map[string]int      // Open connections by source IP
+	conns  map[net.Conn]string // Source IP of each accepted connection, until it is closed or hijacked
+}
+
+// ConnOption configures optional behaviour of a ConnLimiter.
+type ConnOption func(*ConnLimiter)
+
+// WithMaxConnsPerIP caps the connections open at once from one source IP. Connections over the cap are closed
+// without consulting the limiter. Zero or less leaves open connections uncapped.
+func WithMaxConnsPerIP(n int) ConnOption {
+	return func(c *ConnLimiter) {
+		c.maxActive = max(n, 0)
+	}
+}
+
+// NewConnLimiter creates a ConnLimiter checking each new connection against limiter, using its source IP as the identifier.
+// limiterKey labels the metrics and logs of the connection checks. Install it on a server with Install.
+func NewConnLimiter(limiter types.Limiter, limiterKey string, opts ...ConnOption) *ConnLimiter {
+	c := &ConnLimiter{
+		limiter:    limiter,
+		limiterKey: limiterKey,
+		active:     make(map[string]int),
+		conns:      make(map[net.Conn]string),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Install sets the server's ConnContext and ConnState hooks to c's, calling any hooks already set afterwards.
+func (c *ConnLimiter) Install(srv *http.Server) {
+	connContext, connState := srv.ConnContext, srv.ConnState
+	srv.ConnContext = func(ctx context.Context, conn net.Conn) context.Context {
+		ctx = c.ConnContext(ctx, conn)
+		if connContext != nil {
+			ctx = connContext(ctx, conn)
+		}
+		return ctx
+	}
+	srv.ConnState = func(conn net.Conn, state http.ConnState) {
+		c.ConnState(conn, state)
+		if connState != nil {
+			connState(conn, state)
+		}
+	}
+}
+
+// ConnContext checks a new connection, for use as http.Server.ConnContext, and closes it if it is rejected.
+// A rejected connection is never served: the server sees it closed as soon as it starts reading.
+// Limiter errors reject the connection, as they reject requests in RateLimitMiddleware.
+func (c *ConnLimiter) ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	ip := sourceIP(conn)
+	if reason := c.admit(ctx, conn, ip); reason != "" {
+		limitlog.For(c.limiterKey).Info().Str("limiter_key", c.limiterKey).Str("remote_addr", redact.Addr(ip)).Str("reason", reason).Msg("Middleware: Connection rejected")
+		metrics.RecordConnRejected(c.limiterKey, reason)
+		conn.Close()
+	}
+	return ctx
+}
+
+// ConnState releases the connections admitted by ConnContext once they are closed or hijacked, for use as http.Server.ConnState.
+func (c *ConnLimiter) ConnState(conn net.Conn, state http.ConnState) {
+	if state != http.StateClosed && state != http.StateHijacked {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ip, ok := c.conns[conn]
+	if !ok {
+		return
+	}
+	delete(c.conns, conn)
+	if c.active[ip]--; c.active[ip] <= 0 {
+		delete(c.active, ip)
+	}
+}
+
+// Active returns the number of connections from the source IP admitted and still open.
+func (c *ConnLimiter) Active(ip string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active[ip]
+}
+
+// admit checks the connection and tracks it if admitted, returning "" or the reason it is rejected.
+func (c *ConnLimiter) admit(ctx context.Context, conn net.Conn, ip string) string {
+	if c.maxActive > 0 {
+		c.mu.Lock()
+		full := c.active[ip] >= c.maxActive
+		c.mu.Unlock()
+		if full {
+			return ConnRejectActive
+		}
+	}
+	allowed, err := c.limiter.Allow(ctx, ip)
+	if err != nil {
+		class := errclass.Classify(err)
+		limitlog.For(c.limiterKey).Error().Err(err).Str("limiter_key", c.limiterKey).Str("remote_addr", redact.Addr(ip)).Str("error_class", string(class)).Msg("Middleware: Error checking connection rate limit")
+		metrics.RecordLimiterError(c.limiterKey)
+		metrics.RecordBackendError(c.limiterKey, string(class))
+		return ConnRejectError
+	}
+	if !allowed {
+		return ConnRejectRate
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active[ip]++
+	c.conns[conn] = ip
+	return ""
+}
+
+// sourceIP returns the IP address of the connection's remote end, or the whole remote address if it has no port.
+func sourceIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	ip, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return ip
+}
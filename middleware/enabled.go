@@ -0,0 +1,18 @@
+package middleware
+
+import "net/http"
+
+// EnabledFunc reports whether the limiter with the given key applies to the request, e.g., by evaluating a feature
+// flag (LaunchDarkly, OpenFeature) for the request's user, so limiters can be rolled out gradually or switched off in an
+// emergency without a redeploy. It is called for every request, so it should answer from memory (e.g., a flag SDK's
+// local cache) rather than make a network call.
+type EnabledFunc func(limiterKey string, r *http.Request) bool
+
+// WithEnabledFunc passes requests for which fn reports the limiter disabled to the next handler without consulting the
+// limiter. Like skipped requests, they consume no budget and are not recorded in decisions, but they are counted by the
+// rate_limiter_disabled_requests_total metric so a disabled limiter stays visible.
+func WithEnabledFunc(fn EnabledFunc) Option {
+	return func(m *RateLimitMiddleware) {
+		m.enabled = fn
+	}
+}
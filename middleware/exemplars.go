@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TraceIDFunc returns the ID of the trace the request belongs to, or "" if it is not traced. With OpenTelemetry, it
+// can read the span context of the request's context:
+//
+//	func(r *http.Request) string {
+//		if sc := trace.SpanContextFromContext(r.Context()); sc.IsSampled() {
+//			return sc.TraceID().String()
+//		}
+//		return ""
+//	}
+type TraceIDFunc func(r *http.Request) string
+
+// WithTraceExemplars attaches the trace ID returned by fn as an exemplar to the rejected requests counter for every
+// request the limiter denies, so engineers can jump from a spike of denials in Prometheus to representative traces.
+// Exemplars are exposed only when the metrics are scraped in the OpenMetrics format.
+func WithTraceExemplars(fn TraceIDFunc) Option {
+	return func(m *RateLimitMiddleware) {
+		m.traceID = fn
+	}
+}
+
+// TraceparentTraceID returns the trace ID of the request's W3C traceparent header, which OpenTelemetry and other
+// tracers propagate, if the trace is sampled, or "" otherwise.
+func TraceparentTraceID(r *http.Request) string {
+	// version "-" trace-id "-" parent-id "-" trace-flags, e.g., 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	parts := strings.Split(r.Header.Get("Traceparent"), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[3]) != 2 {
+		return ""
+	}
+	traceID := parts[1]
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	// An all-zero trace ID is invalid; bit 0 of the flags marks sampled traces
+	if err != nil || flags&1 == 0 || !isLowerHex(traceID) || strings.Trim(traceID, "0") == "" {
+		return ""
+	}
+	return traceID
+}
+
+// isLowerHex reports whether s consists of lowercase hexadecimal digits only.
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && (s[i] < 'a' || s[i] > 'f') {
+			return false
+		}
+	}
+	return true
+}
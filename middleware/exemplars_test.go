@@ -0,0 +1,70 @@
+//go:build !noprometheus
+
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"learn.ratelimiter/config"
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/middleware"
+)
+
+// TestTraceExemplars tests that denials carry the trace ID of sampled traceparent headers as an exemplar.
+func TestTraceExemplars(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	for _, tc := range []struct {
+		traceparent string
+		want        string
+	}{
+		{"00-" + traceID + "-00f067aa0ba902b7-01", traceID},
+		{"00-" + traceID + "-00f067aa0ba902b7-00", ""},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"00-" + strings.ToUpper(traceID) + "-00f067aa0ba902b7-01", ""},
+		{"garbage", ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Traceparent", tc.traceparent)
+		if got := middleware.TraceparentTraceID(r); got != tc.want {
+			t.Errorf("TraceparentTraceID(%q) = %q, want %q", tc.traceparent, got, tc.want)
+		}
+	}
+
+	limiter := fcinmemory.NewLimiter("test_trace_exemplars", time.Minute, 1)
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_trace_exemplars", config.FixedWindowCounter, middleware.WithTraceExemplars(middleware.TraceparentTraceID))
+	handler := m.Handle(okHandler, staticIdentifier)
+	for range 2 {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+		handler(httptest.NewRecorder(), r)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "rate_limiter_rejected_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() != "limiter_key" || label.GetValue() != "test_trace_exemplars" {
+					continue
+				}
+				exemplar := metric.GetCounter().GetExemplar()
+				if len(exemplar.GetLabel()) != 1 || exemplar.GetLabel()[0].GetValue() != traceID {
+					t.Fatalf("Expected an exemplar with the trace ID, got %v", exemplar)
+				}
+				return
+			}
+		}
+	}
+	t.Fatal("Expected the denial to be counted")
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"learn.ratelimiter/types"
+)
+
+// Rate limit response headers set by WithRateLimitHeaders.
+const (
+	HeaderLimit     = "X-RateLimit-Limit"
+	HeaderRemaining = "X-RateLimit-Remaining"
+	HeaderReset     = "X-RateLimit-Reset"
+	HeaderRetry     = "Retry-After"
+	HeaderPolicy    = "X-RateLimit-Policy"
+)
+
+// WithRateLimitHeaders checks requests with types.AllowDetailed and tells clients where they stand in every response
+// the limiter decided: X-RateLimit-Limit and X-RateLimit-Remaining in units of budget, X-RateLimit-Reset as the Unix
+// time in seconds at which the budget is fully restored, and, on 429 responses, Retry-After in seconds. Headers the
+// limiter cannot tell (see types.Result) are left out. With nested middlewares, the innermost one's headers win.
+func WithRateLimitHeaders() Option {
+	return func(m *RateLimitMiddleware) {
+		m.headers = true
+	}
+}
+
+// WithPolicyHeader names the policy that denied each rate limited request in the X-RateLimit-Policy header of the 429
+// response: the middleware's limiter key or, for limiters enforcing several limits such as a composite limiter or a
+// per_minute_cap, the key of the limit that denied it (see types.Result.Policy). Requests are checked with
+// types.AllowDetailed to tell. With nested middlewares, the header names the one that denied the request.
+func WithPolicyHeader() Option {
+	return func(m *RateLimitMiddleware) {
+		m.policyHeader = true
+	}
+}
+
+// setRateLimitHeaders sets the headers describing the result of the request's check.
+func setRateLimitHeaders(w http.ResponseWriter, result types.Result) {
+	header := w.Header()
+	if result.Limit >= 0 {
+		header.Set(HeaderLimit, strconv.FormatInt(result.Limit, 10))
+	}
+	if result.Remaining >= 0 {
+		header.Set(HeaderRemaining, strconv.FormatInt(result.Remaining, 10))
+	}
+	if !result.ResetAt.IsZero() {
+		// Rounded up, so clients coming back at the reset time find the budget restored
+		header.Set(HeaderReset, strconv.FormatInt(int64(math.Ceil(float64(result.ResetAt.UnixMilli())/1000)), 10))
+	}
+	if !result.Allowed && result.RetryAfter > 0 {
+		header.Set(HeaderRetry, strconv.FormatInt(ceilSeconds(result.RetryAfter), 10))
+	}
+}
+
+// setPolicyHeader names the policy that denied the request, if the middleware sends it.
+func (m *RateLimitMiddleware) setPolicyHeader(w http.ResponseWriter, policy string) {
+	if m.policyHeader {
+		w.Header().Set(HeaderPolicy, policy)
+	}
+}
+
+// ceilSeconds returns d in whole seconds, rounded up, and 0 if d is not positive.
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(max(d, 0).Seconds()))
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// Reasons a request was shed, used as the reason label of the load shedding metric.
+const (
+	ShedReasonDeadline = "deadline"
+	ShedReasonLoad     = "load"
+)
+
+// LoadSignal reports the current system load, e.g., CPU utilization or the length of a work queue.
+type LoadSignal func() float64
+
+// LoadShedding configures early rejection of requests the service is unlikely to serve in time.
+type LoadShedding struct {
+	// Headroom is the least time that must be left before the request context's deadline. Zero disables the deadline check.
+	Headroom time.Duration
+	// Signal, if set, is compared against Threshold on every request.
+	Signal LoadSignal
+	// Threshold is the load above which requests are shed.
+	Threshold float64
+}
+
+// WithLoadShedding rejects requests with 503 Service Unavailable, before the limiter is consulted and without consuming budget,
+// if their context deadline leaves less than shedding.Headroom or if shedding.Signal reports a load above shedding.Threshold.
+func WithLoadShedding(shedding LoadShedding) Option {
+	return func(m *RateLimitMiddleware) {
+		m.shedding = &shedding
+	}
+}
+
+// shedReason returns why the request should be shed, or "" if it may be checked against the limiter.
+func (s *LoadShedding) shedReason(r *http.Request) string {
+	if s.Headroom > 0 {
+		if deadline, ok := r.Context().Deadline(); ok && time.Until(deadline) < s.Headroom {
+			return ShedReasonDeadline
+		}
+	}
+	if s.Signal != nil && s.Signal() > s.Threshold {
+		return ShedReasonLoad
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"learn.ratelimiter/limitlog"
+	"learn.ratelimiter/redact"
+)
+
+// memoKey identifies a decision within a request.
+type memoKey struct {
+	limiterKey string
+	identifier string
+}
+
+// memo records the decisions made for one request, so a limiter is not consulted twice for the same identifier.
+type memo struct {
+	mu       sync.Mutex
+	statuses map[memoKey]int
+}
+
+// memoContextKey is the context key under which the request's memo is stored.
+type memoContextKey struct{}
+
+// WithRequestMemo consults the limiter at most once per request for each identifier. Later checks of the same request
+// by a middleware with the same limiter key (e.g., when a router re-enters the handler chain, or when middlewares are nested)
+// reuse the first decision instead of charging the budget again. Such checks are not counted again in metrics or decisions.
+func WithRequestMemo() Option {
+	return func(m *RateLimitMiddleware) {
+		m.memo = true
+	}
+}
+
+// withMemo returns r with a memo in its context if memoization is enabled and the request has none yet,
+// so the handlers after this middleware see the decisions made for the request.
+func (m *RateLimitMiddleware) withMemo(r *http.Request) *http.Request {
+	if !m.memo {
+		return r
+	}
+	if _, ok := r.Context().Value(memoContextKey{}).(*memo); ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), memoContextKey{}, &memo{statuses: make(map[memoKey]int)}))
+}
+
+// memoized returns the status of an earlier check of the request for identifier, if memoization is enabled and there was one.
+func (m *RateLimitMiddleware) memoized(r *http.Request, identifier string) (int, bool) {
+	if !m.memo {
+		return 0, false
+	}
+	requestMemo, ok := r.Context().Value(memoContextKey{}).(*memo)
+	if !ok {
+		return 0, false
+	}
+	requestMemo.mu.Lock()
+	status, ok := requestMemo.statuses[memoKey{limiterKey: m.limiterKey, identifier: identifier}]
+	requestMemo.mu.Unlock()
+	if ok {
+		limitlog.For(m.limiterKey).Debug().Str("limiter_key", m.limiterKey).Str("identifier", redact.Identifier(identifier)).Int("status", status).Msg("Middleware: Reusing decision made earlier for request")
+	}
+	return status, ok
+}
+
+// memoize records the status of the request's check for identifier, if memoization is enabled.
+func (m *RateLimitMiddleware) memoize(r *http.Request, identifier string, status int) {
+	if !m.memo {
+		return
+	}
+	requestMemo, ok := r.Context().Value(memoContextKey{}).(*memo)
+	if !ok {
+		return
+	}
+	requestMemo.mu.Lock()
+	requestMemo.statuses[memoKey{limiterKey: m.limiterKey, identifier: identifier}] = status
+	requestMemo.mu.Unlock()
+}
@@ -2,36 +2,193 @@
 package middleware
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"io"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog/log" // Import zerolog's global logger
 
+	"learn.ratelimiter/anomaly"
+	"learn.ratelimiter/autoscale"
+	"learn.ratelimiter/banlist"
 	"learn.ratelimiter/config"
+	"learn.ratelimiter/decisions"
+	"learn.ratelimiter/denialreport"
+	"learn.ratelimiter/internal/errclass"
+	"learn.ratelimiter/limitlog"
 	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/mirror"
+	"learn.ratelimiter/redact"
 	"learn.ratelimiter/types"
 )
 
 // RateLimitMiddleware provides rate limiting functionality for HTTP handlers.
 type RateLimitMiddleware struct {
-	// limiter is the rate limiter instance to use.
-	limiter types.Limiter
+	// binding is the rate limiter instance to use and its algorithm, replaced by Rebind.
+	binding atomic.Pointer[binding]
 	// metrics is the metrics collector for rate limiting statistics.
 	metrics *metrics.RateLimitMetrics
 	// limiterKey is the key associated with this limiter configuration.
 	limiterKey string
-	// algorithm is the rate limiting algorithm used by this limiter.
+
+	// bodyCost charges requests by body size instead of one unit each.
+	bodyCost bool
+	// maxBodyBytes is the largest request body accepted when bodyCost is enabled.
+	maxBodyBytes int64
+	// bans, if set, rejects banned identifiers before the limiter is consulted.
+	bans *banlist.List
+	// decisions, if set, receives every decision for asynchronous replication.
+	decisions *decisions.Sink
+	// mirror, if set, receives a sample of the requests denied by the limiter or the ban list.
+	mirror *mirror.Mirror
+	// tagFunc, if set, tags requests for per-tag metrics and decisions.
+	tagFunc TagFunc
+	// shedding, if set, rejects requests early when their deadline is near or the system is overloaded.
+	shedding *LoadShedding
+	// memo, if set, reuses the decision made earlier for the same request and identifier.
+	memo bool
+	// result, if set, stores the decision in the request context.
+	result bool
+	// hints, if set, observes every limiter decision for the autoscaling hints.
+	hints *autoscale.Hints
+	// anomalies, if set, observes every limiter decision for deny rate anomaly detection.
+	anomalies *anomaly.Detector
+	// denials, if set, observes every limiter decision for the daily denial reports.
+	denials *denialreport.Reporter
+	// skip, if set, selects requests that are not rate limited.
+	skip *SkipRules
+	// enabled, if set, decides per request whether the limiter applies.
+	enabled EnabledFunc
+	// tarpit, if set, delays rate limited requests before they are answered.
+	tarpit *tarpit
+	// headers, if set, checks requests with their detailed result and sets the rate limit headers.
+	headers bool
+	// policyHeader, if set, checks requests with their detailed result and names the policy denying them.
+	policyHeader bool
+	// traceID, if set, returns the trace ID attached as an exemplar to the denial counter.
+	traceID TraceIDFunc
+}
+
+// binding is the limiter a middleware consults and the rate limiting algorithm it implements.
+type binding struct {
+	limiter   types.Limiter
 	algorithm config.AlgorithmType
 }
 
+// DefaultMaxBodyBytes is the body size limit used by WithBodyCost when no positive limit is given.
+const DefaultMaxBodyBytes = 10 << 20
+
+// bodyCostUnit is the number of body bytes charged as one unit of budget.
+const bodyCostUnit = 1024
+
+// Option configures optional behaviour of a RateLimitMiddleware.
+type Option func(*RateLimitMiddleware)
+
+// WithBodyCost charges each request ceil(body bytes / 1KB) units (minimum 1) through AllowN,
+// so large payloads consume proportionally more budget than tiny calls.
+// Bodies larger than maxBodyBytes are rejected with 413 Request Entity Too Large before the limiter is consulted.
+func WithBodyCost(maxBodyBytes int64) Option {
+	return func(m *RateLimitMiddleware) {
+		if maxBodyBytes <= 0 {
+			maxBodyBytes = DefaultMaxBodyBytes
+		}
+		m.bodyCost = true
+		m.maxBodyBytes = maxBodyBytes
+	}
+}
+
+// WithBanList rejects requests from identifiers banned for this limiter with 403 Forbidden, without consuming budget.
+func WithBanList(bans *banlist.List) Option {
+	return func(m *RateLimitMiddleware) {
+		m.bans = bans
+	}
+}
+
+// WithDecisionSink records every decision, including rejections before the limiter is consulted, to the sink.
+func WithDecisionSink(sink *decisions.Sink) Option {
+	return func(m *RateLimitMiddleware) {
+		m.decisions = sink
+	}
+}
+
+// WithMirror copies a sample of the requests denied by the limiter (429) or the ban list (403) to the mirror.
+func WithMirror(target *mirror.Mirror) Option {
+	return func(m *RateLimitMiddleware) {
+		m.mirror = target
+	}
+}
+
+// WithAutoscaleHints observes every decision of the limiter in hints, along with the identifier's budget utilization
+// when the limiter reports it (see types.PressureLimiter). Requests rejected before the limiter is consulted are not observed.
+func WithAutoscaleHints(hints *autoscale.Hints) Option {
+	return func(m *RateLimitMiddleware) {
+		m.hints = hints
+	}
+}
+
+// WithAnomalyDetector observes every decision of the limiter in detector, which reports abnormal spikes in its deny rate.
+// Requests rejected before the limiter is consulted are not observed.
+func WithAnomalyDetector(detector *anomaly.Detector) Option {
+	return func(m *RateLimitMiddleware) {
+		m.anomalies = detector
+	}
+}
+
+// WithDenialReporter observes every decision of the limiter in reporter, which reports the fraction of requests it
+// denied and the identifiers it denied most per day. Requests rejected before the limiter is consulted are not observed.
+func WithDenialReporter(reporter *denialreport.Reporter) Option {
+	return func(m *RateLimitMiddleware) {
+		m.denials = reporter
+	}
+}
+
+// TagFunc returns the tag of a request (e.g., its endpoint group or client SDK version), or "" to leave it untagged.
+// Tags should come from a small set of values since each one is recorded as a metric label.
+type TagFunc func(*http.Request) string
+
+// WithTagFunc tags requests with fn, breaking down the allow/deny metrics (rate_limiter_tagged_requests_total)
+// and recorded decisions by tag. This is useful when one limiter key covers many endpoints.
+func WithTagFunc(fn TagFunc) Option {
+	return func(m *RateLimitMiddleware) {
+		m.tagFunc = fn
+	}
+}
+
 // NewRateLimitMiddleware creates a new RateLimitMiddleware.
-// It takes a types.Limiter, a metrics.RateLimitMetrics collector, a unique key for the limiter, and the algorithm type.
-func NewRateLimitMiddleware(limiter types.Limiter, metrics *metrics.RateLimitMetrics, limiterKey string, algorithm config.AlgorithmType) *RateLimitMiddleware {
-	return &RateLimitMiddleware{
-		limiter:    limiter,
+// It takes a types.Limiter, a metrics.RateLimitMetrics collector, a unique key for the limiter, the algorithm type, and optional behaviour.
+func NewRateLimitMiddleware(limiter types.Limiter, metrics *metrics.RateLimitMetrics, limiterKey string, algorithm config.AlgorithmType, opts ...Option) *RateLimitMiddleware {
+	m := &RateLimitMiddleware{
 		metrics:    metrics,
 		limiterKey: limiterKey,
-		algorithm:  algorithm,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.bind(limiter, algorithm)
+	return m
+}
+
+// Rebind makes the middleware consult limiter, which implements algorithm, instead of its current limiter. It is safe
+// to call while requests are served, so a reloaded limiter takes effect without recreating or re-registering handlers:
+// requests being checked finish with the previous limiter, and later ones use limiter. Limiters created by
+// api.NewLimitersFromConfigPath are already replaced in place by api.Reloader and need no rebinding.
+func (m *RateLimitMiddleware) Rebind(limiter types.Limiter, algorithm config.AlgorithmType) {
+	previous := m.binding.Load()
+	m.bind(limiter, algorithm)
+	log.Info().Str("limiter_key", m.limiterKey).Str("previous_algorithm", string(previous.algorithm)).Str("algorithm", string(algorithm)).Msg("Middleware: Rebound limiter")
+}
+
+// bind makes the middleware consult limiter, which implements algorithm.
+func (m *RateLimitMiddleware) bind(limiter types.Limiter, algorithm config.AlgorithmType) {
+	if _, ok := limiter.(types.CostLimiter); m.bodyCost && !ok {
+		log.Warn().Str("limiter_key", m.limiterKey).Msg("Middleware: Limiter does not support AllowN, body cost will be ignored")
+	}
+	m.binding.Store(&binding{limiter: limiter, algorithm: algorithm})
 }
 
 // Handle wraps an http.HandlerFunc with rate limiting logic.
@@ -39,36 +196,261 @@ func NewRateLimitMiddleware(limiter types.Limiter, metrics *metrics.RateLimitMet
 // It returns a new http.HandlerFunc that applies rate limiting before calling the next handler.
 func (m *RateLimitMiddleware) Handle(next http.HandlerFunc, identifierFunc func(*http.Request) string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		identifier := identifierFunc(r)
-		if identifier == "" {
-			// Log with RemoteAddr if identifier extraction fails
-			log.Warn().Str("limiter_key", m.limiterKey).Str("remote_addr", r.RemoteAddr).Msg("Middleware: Could not extract identifier for request")
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Error().Str("limiter_key", m.limiterKey).Str("remote_addr", r.RemoteAddr).Msg("Middleware: Request denied due to missing identifier")
-			m.metrics.RecordRequestWithLabels(false, m.limiterKey, string(m.algorithm))
+		r = m.withResults(m.withMemo(r))
+		if status := m.check(w, r, identifierFunc); status != http.StatusOK {
+			w.WriteHeader(status)
 			return
 		}
+		next.ServeHTTP(w, r)
+	}
+}
 
-		// Pass the request's context to the Allow method
-		allowed, err := m.limiter.Allow(r.Context(), identifier)
-		if err != nil {
-			// Include limiter key and identifier in error log
-			log.Error().Err(err).Str("limiter_key", m.limiterKey).Str("identifier", identifier).Msg("Middleware: Error checking rate limit")
-			w.WriteHeader(http.StatusInternalServerError)
-			// Include limiter key and identifier in denial log
-			log.Error().Str("limiter_key", m.limiterKey).Str("identifier", identifier).Msg("Middleware: Request denied due to limiter error")
-			m.metrics.RecordRequestWithLabels(false, m.limiterKey, string(m.algorithm))
-			return
+// KeyIdentifier adapts a function building a composite key from the request into an identifier function for Handle
+// and the RPC handlers, using the key's canonical encoding. An empty key yields no identifier.
+func KeyIdentifier(keyFunc func(*http.Request) types.Key) func(*http.Request) string {
+	return func(r *http.Request) string {
+		return keyFunc(r).String()
+	}
+}
+
+// check applies rate limiting to the request, recording metrics and logging the outcome.
+// It returns http.StatusOK if the request may proceed, or the HTTP status describing why it was rejected.
+// Protocol-specific wrappers translate the status into their own error format.
+func (m *RateLimitMiddleware) check(w http.ResponseWriter, r *http.Request, identifierFunc func(*http.Request) string) int {
+	return m.checkDetailed(w, r, identifierFunc, nil)
+}
+
+// checkDetailed is check, also storing the limiter's detailed result into detail if it is not nil (see
+// types.AllowDetailed). detail is left unchanged if the limiter was not consulted.
+func (m *RateLimitMiddleware) checkDetailed(w http.ResponseWriter, r *http.Request, identifierFunc func(*http.Request) string, detail *types.Result) (status int) {
+	if m.skip != nil && m.skip.matches(r) {
+		return http.StatusOK
+	}
+	if m.enabled != nil && !m.enabled(m.limiterKey, r) {
+		metrics.RecordDisabled(m.limiterKey)
+		return http.StatusOK
+	}
+	// The limiter is loaded once, so a request racing with Rebind is checked and recorded against a single limiter
+	b := m.binding.Load()
+	identifier := identifierFunc(r)
+	if status, ok := m.memoized(r, identifier); ok {
+		return status
+	}
+	defer func() {
+		m.memoize(r, identifier, status)
+	}()
+	cost := 1
+	consulted := false
+	// policy names the limit denying a rate limited request, recorded with the decision
+	var policy string
+	// errorClass is the class of the error the limiter failed with, recorded with the decision
+	var errorClass errclass.Class
+	if m.result {
+		defer func() {
+			m.storeResult(r, b.limiter, identifier, cost, status, consulted)
+		}()
+	}
+	var tag string
+	if m.tagFunc != nil {
+		tag = m.tagFunc(r)
+		if tag != "" {
+			defer func() {
+				m.metrics.RecordTaggedRequest(status == http.StatusOK, m.limiterKey, tag)
+			}()
+		}
+	}
+	if m.decisions != nil {
+		defer func() {
+			m.decisions.Record(decisions.Decision{
+				Time:       time.Now(),
+				LimiterKey: m.limiterKey,
+				Algorithm:  string(b.algorithm),
+				Identifier: identifier,
+				Allowed:    status == http.StatusOK,
+				Status:     status,
+				Cost:       cost,
+				Path:       r.URL.Path,
+				Tag:        tag,
+				Policy:     policy,
+				ErrorClass: string(errorClass),
+			})
+		}()
+	}
+
+	if m.mirror != nil {
+		defer func() {
+			if status == http.StatusTooManyRequests || status == http.StatusForbidden {
+				m.mirror.Record(r, m.limiterKey, identifier, status)
+			}
+		}()
+	}
+
+	if identifier == "" {
+		// Log with RemoteAddr if identifier extraction fails
+		limitlog.For(m.limiterKey).Warn().Str("limiter_key", m.limiterKey).Str("remote_addr", redact.Addr(r.RemoteAddr)).Msg("Middleware: Could not extract identifier for request")
+		limitlog.For(m.limiterKey).Error().Str("limiter_key", m.limiterKey).Str("remote_addr", redact.Addr(r.RemoteAddr)).Msg("Middleware: Request denied due to missing identifier")
+		m.metrics.RecordRequestWithLabels(false, m.limiterKey, string(b.algorithm))
+		return http.StatusInternalServerError
+	}
+
+	if m.shedding != nil {
+		if reason := m.shedding.shedReason(r); reason != "" {
+			limitlog.For(m.limiterKey).Warn().Str("limiter_key", m.limiterKey).Str("identifier", redact.Identifier(identifier)).Str("reason", reason).Msg("Middleware: Request shed")
+			m.metrics.RecordRequestWithLabels(false, m.limiterKey, string(b.algorithm))
+			metrics.RecordLoadShed(m.limiterKey, reason)
+			return http.StatusServiceUnavailable
+		}
+	}
+
+	if m.bans != nil && m.bans.IsBanned(m.limiterKey, identifier) {
+		limitlog.For(m.limiterKey).Info().Str("limiter_key", m.limiterKey).Str("identifier", redact.Identifier(identifier)).Str("path", r.URL.Path).Msg("Middleware: Request from banned identifier denied")
+		m.metrics.RecordRequestWithLabels(false, m.limiterKey, string(b.algorithm))
+		m.metrics.RecordIdentifierRequest(false, m.limiterKey, identifier)
+		return http.StatusForbidden
+	}
+
+	if m.bodyCost {
+		var status int
+		cost, status = m.requestCost(w, r)
+		if status != http.StatusOK {
+			limitlog.For(m.limiterKey).Info().Str("limiter_key", m.limiterKey).Str("identifier", redact.Identifier(identifier)).Int("status", status).Msg("Middleware: Request body rejected")
+			m.metrics.RecordRequestWithLabels(false, m.limiterKey, string(b.algorithm))
+			m.metrics.RecordIdentifierRequest(false, m.limiterKey, identifier)
+			return status
+		}
+	}
+
+	// Pass the request's context to the limiter, tagged so limiters with a write budget can select it
+	ctx := types.WithOperation(r.Context(), operationForMethod(r.Method))
+	var allowed bool
+	var err error
+	if m.headers || m.policyHeader || detail != nil {
+		var result types.Result
+		result, err = types.AllowDetailed(ctx, b.limiter, identifier, cost)
+		allowed, policy = result.Allowed, result.Policy
+		if err == nil && m.headers {
+			setRateLimitHeaders(w, result)
+		}
+		if err == nil && detail != nil {
+			*detail = result
+		}
+	} else {
+		allowed, err = allow(ctx, b.limiter, identifier, cost)
+	}
+	consulted = err == nil
+	if errors.Is(err, types.ErrIdentifierTooLong) {
+		// The client chose the identifier (e.g., a header value), so this is not a limiter failure
+		limitlog.For(m.limiterKey).Info().Err(err).Str("limiter_key", m.limiterKey).Str("path", r.URL.Path).Msg("Middleware: Request with identifier too long rejected")
+		m.metrics.RecordRequestWithLabels(false, m.limiterKey, string(b.algorithm))
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, types.ErrTooManyKeys) {
+		// New identifiers are turned away to bound the limiter's state, which is a denial rather than a limiter failure
+		limitlog.For(m.limiterKey).Info().Err(err).Str("limiter_key", m.limiterKey).Str("identifier", redact.Identifier(identifier)).Msg("Middleware: Request for a new identifier rejected, too many identifiers")
+		m.metrics.RecordRequestWithLabels(false, m.limiterKey, string(b.algorithm))
+		policy = m.limiterKey
+		m.setPolicyHeader(w, policy)
+		return http.StatusTooManyRequests
+	}
+	if err != nil {
+		errorClass = errclass.Classify(err)
+		// Include limiter key, identifier and error class in error log
+		limitlog.For(m.limiterKey).Error().Err(err).Str("limiter_key", m.limiterKey).Str("identifier", redact.Identifier(identifier)).Str("error_class", string(errorClass)).Msg("Middleware: Error checking rate limit")
+		// Include limiter key and identifier in denial log
+		limitlog.For(m.limiterKey).Error().Str("limiter_key", m.limiterKey).Str("identifier", redact.Identifier(identifier)).Msg("Middleware: Request denied due to limiter error")
+		m.metrics.RecordRequestWithLabels(false, m.limiterKey, string(b.algorithm))
+		m.metrics.RecordIdentifierRequest(false, m.limiterKey, identifier)
+		metrics.RecordLimiterError(m.limiterKey)
+		metrics.RecordBackendError(m.limiterKey, string(errorClass))
+		// The backend may decide the same request later, so clients are told to retry rather than that it failed
+		if errorClass.Transient() {
+			return http.StatusServiceUnavailable
 		}
+		return http.StatusInternalServerError
+	}
+
+	if m.traceID != nil && !allowed {
+		m.metrics.RecordRequestWithExemplar(allowed, m.limiterKey, string(b.algorithm), m.traceID(r))
+	} else {
+		m.metrics.RecordRequestWithLabels(allowed, m.limiterKey, string(b.algorithm))
+	}
+	m.metrics.RecordIdentifierRequest(allowed, m.limiterKey, identifier)
+	if m.hints != nil {
+		m.observe(ctx, b.limiter, identifier, allowed)
+	}
+	if m.anomalies != nil {
+		m.anomalies.Observe(m.limiterKey, allowed)
+	}
+	if m.denials != nil {
+		m.denials.Observe(m.limiterKey, identifier, allowed)
+	}
+
+	if !allowed {
+		policy = cmp.Or(policy, m.limiterKey)
+		m.setPolicyHeader(w, policy)
+		// Include limiter key, identifier, and path in denial log
+		limitlog.For(m.limiterKey).Info().Str("limiter_key", m.limiterKey).Str("identifier", redact.Identifier(identifier)).Str("policy", policy).Str("path", r.URL.Path).Msg("Middleware: Request rate limited")
+		if m.tarpit != nil {
+			m.tarpit.hold(r, m.limiterKey)
+		}
+		return http.StatusTooManyRequests
+	}
+	return http.StatusOK
+}
+
+// allow consults the limiter, charging cost units when the limiter supports AllowN.
+func allow(ctx context.Context, limiter types.Limiter, identifier string, cost int) (bool, error) {
+	if costLimiter, ok := limiter.(types.CostLimiter); ok && cost != 1 {
+		return costLimiter.AllowN(ctx, identifier, cost)
+	}
+	return limiter.Allow(ctx, identifier)
+}
+
+// observe records the decision in the autoscaling hints, with the identifier's utilization after an allowed request.
+func (m *RateLimitMiddleware) observe(ctx context.Context, limiter types.Limiter, identifier string, allowed bool) {
+	pressure := -1.0
+	if allowed {
+		if p, err := types.Pressure(ctx, limiter, identifier); err == nil {
+			pressure = p
+		}
+	}
+	m.hints.Observe(m.limiterKey, allowed, pressure)
+}
 
-		m.metrics.RecordRequestWithLabels(allowed, m.limiterKey, string(m.algorithm))
+// requestCost returns the cost of the request body in units of bodyCostUnit bytes (minimum 1) and http.StatusOK,
+// or a non-OK status if the body is too large or cannot be read.
+// Bodies of unknown length are buffered (up to maxBodyBytes) so they can still be passed to the next handler.
+func (m *RateLimitMiddleware) requestCost(w http.ResponseWriter, r *http.Request) (int, int) {
+	size := r.ContentLength
+	if size > m.maxBodyBytes {
+		return 0, http.StatusRequestEntityTooLarge
+	}
 
-		if allowed {
-			next.ServeHTTP(w, r)
-		} else {
-			w.WriteHeader(http.StatusTooManyRequests)
-			// Include limiter key, identifier, and path in denial log
-			log.Info().Str("limiter_key", m.limiterKey).Str("identifier", identifier).Str("path", r.URL.Path).Msg("Middleware: Request rate limited")
+	if size < 0 {
+		body, err := io.ReadAll(io.LimitReader(r.Body, m.maxBodyBytes+1))
+		if err != nil {
+			limitlog.For(m.limiterKey).Warn().Err(err).Str("limiter_key", m.limiterKey).Msg("Middleware: Failed to read request body")
+			return 0, http.StatusBadRequest
+		}
+		if int64(len(body)) > m.maxBodyBytes {
+			return 0, http.StatusRequestEntityTooLarge
 		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		size = int64(len(body))
+	} else if r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, m.maxBodyBytes)
+	}
+
+	cost := (size + bodyCostUnit - 1) / bodyCostUnit
+	return int(max(cost, 1)), http.StatusOK
+}
+
+// operationForMethod classifies safe HTTP methods as reads and all other methods as writes.
+func operationForMethod(method string) types.Operation {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return types.OperationRead
+	default:
+		return types.OperationWrite
 	}
 }
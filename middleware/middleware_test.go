@@ -0,0 +1,764 @@
+// Package middleware_test contains tests for the HTTP rate limiting middleware.
+package middleware_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/apikeys"
+	"learn.ratelimiter/autoscale"
+	"learn.ratelimiter/banlist"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/decisions"
+	"learn.ratelimiter/internal/capped"
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/internal/identifierlimit"
+	"learn.ratelimiter/internal/maxkeys"
+	"learn.ratelimiter/internal/splitbudget"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/middleware"
+	"learn.ratelimiter/mirror"
+	"learn.ratelimiter/types"
+)
+
+// testMetrics is shared because the Prometheus collectors are registered globally.
+var testMetrics = metrics.NewRateLimitMetrics()
+
+func staticIdentifier(*http.Request) string { return "client1" }
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+	w.WriteHeader(http.StatusOK)
+}
+
+// TestBodyCost tests that request bodies are charged per started kilobyte.
+func TestBodyCost(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("test_body_cost", time.Minute, 4)
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_body_cost", config.FixedWindowCounter, middleware.WithBodyCost(1<<20))
+	handler := m.Handle(okHandler, staticIdentifier)
+
+	// A 3000 byte body costs 3 units
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("a", 3000))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for first upload, got %d", rec.Code)
+	}
+
+	// Another 3000 byte body does not fit in the remaining unit
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("a", 3000))))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 for second upload, got %d", rec.Code)
+	}
+
+	// An empty request still costs one unit and fits
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for empty request, got %d", rec.Code)
+	}
+}
+
+// TestBodyCostTooLarge tests that bodies over the configured maximum are rejected before consulting the limiter.
+func TestBodyCostTooLarge(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("test_body_too_large", time.Minute, 100)
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_body_too_large", config.FixedWindowCounter, middleware.WithBodyCost(1024))
+	handler := m.Handle(okHandler, staticIdentifier)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("a", 2048))))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413, got %d", rec.Code)
+	}
+
+	// Bodies of unknown length are measured as well
+	req := httptest.NewRequest(http.MethodPost, "/upload", io.NopCloser(strings.NewReader(strings.Repeat("a", 2048))))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected 413 for unknown length body, got %d", rec.Code)
+	}
+}
+
+// TestWriteBudget tests that mutating methods are charged against the write budget and reads against the read budget.
+func TestWriteBudget(t *testing.T) {
+	read := fcinmemory.NewLimiter("test_split", time.Minute, 3)
+	write := fcinmemory.NewLimiter("test_split#write", time.Minute, 1)
+	m := middleware.NewRateLimitMiddleware(splitbudget.NewLimiter("test_split", read, write), testMetrics, "test_split", config.FixedWindowCounter)
+	handler := m.Handle(okHandler, staticIdentifier)
+
+	expect := func(method string, want int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, "/items", nil))
+		if rec.Code != want {
+			t.Fatalf("%s: expected %d, got %d", method, want, rec.Code)
+		}
+	}
+
+	expect(http.MethodPost, http.StatusOK)
+	expect(http.MethodDelete, http.StatusTooManyRequests)
+	// Reads have their own, larger budget
+	expect(http.MethodGet, http.StatusOK)
+	expect(http.MethodGet, http.StatusOK)
+	expect(http.MethodHead, http.StatusOK)
+	expect(http.MethodGet, http.StatusTooManyRequests)
+}
+
+// TestBanList tests that banned identifiers are rejected with 403 without consuming budget.
+func TestBanList(t *testing.T) {
+	bans := banlist.New()
+	limiter := fcinmemory.NewLimiter("test_ban_list", time.Minute, 1)
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_ban_list", config.FixedWindowCounter, middleware.WithBanList(bans))
+	handler := m.Handle(okHandler, staticIdentifier)
+
+	bans.Ban("test_ban_list", "client1", 0)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 for banned identifier, got %d", rec.Code)
+	}
+
+	bans.Unban("test_ban_list", "client1")
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 once unbanned, got %d", rec.Code)
+	}
+}
+
+// TestIdentifierTooLong tests that identifiers rejected for their length are answered with 400 without consuming budget.
+func TestIdentifierTooLong(t *testing.T) {
+	base := fcinmemory.NewLimiter("test_identifier_too_long", time.Minute, 1)
+	limiter := identifierlimit.NewLimiter("test_identifier_too_long", base, config.IdentifierLimitConfig{MaxLength: 8, Policy: config.IdentifierPolicyReject})
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_identifier_too_long", config.FixedWindowCounter)
+
+	rec := httptest.NewRecorder()
+	m.Handle(okHandler, func(*http.Request) string { return strings.Repeat("a", 100) })(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an identifier too long, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	m.Handle(okHandler, staticIdentifier)(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a short identifier, got %d", rec.Code)
+	}
+}
+
+// TestRequestMemo tests that a request passing through the same limiter twice is charged once with WithRequestMemo,
+// while other limiters are still consulted.
+func TestRequestMemo(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		opts    []middleware.Option
+		charged int
+	}{
+		{name: "memo", opts: []middleware.Option{middleware.WithRequestMemo()}, charged: 3},
+		{name: "no memo", charged: 6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			limiter := fcinmemory.NewLimiter("test_request_memo", time.Minute, 10)
+			m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_request_memo", config.FixedWindowCounter, tc.opts...)
+			other := fcinmemory.NewLimiter("test_request_memo_other", time.Minute, 10)
+			otherMiddleware := middleware.NewRateLimitMiddleware(other, testMetrics, "test_request_memo_other", config.FixedWindowCounter, tc.opts...)
+
+			// The request re-enters the middleware, as with a router dispatching it twice
+			handler := m.Handle(otherMiddleware.Handle(m.Handle(okHandler, staticIdentifier), staticIdentifier), staticIdentifier)
+			for i := 0; i < 3; i++ {
+				rec := httptest.NewRecorder()
+				handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+				if rec.Code != http.StatusOK {
+					t.Fatalf("Expected 200, got %d", rec.Code)
+				}
+			}
+			if remaining := remainingBudget(limiter); remaining != 10-tc.charged {
+				t.Errorf("Expected %d units charged to the re-entered limiter, got %d", tc.charged, 10-remaining)
+			}
+			if remaining := remainingBudget(other); remaining != 7 {
+				t.Errorf("Expected 3 units charged to the other limiter, got %d", 10-remaining)
+			}
+		})
+	}
+}
+
+// TestRequestResult tests that the decision is stored in the request context for the handlers after the middleware.
+func TestRequestResult(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("test_request_result", time.Minute, 4)
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_request_result", config.FixedWindowCounter, middleware.WithRequestResult())
+	other := fcinmemory.NewLimiter("test_request_result_other", time.Minute, 4)
+	otherMiddleware := middleware.NewRateLimitMiddleware(other, testMetrics, "test_request_result_other", config.FixedWindowCounter, middleware.WithRequestResult())
+
+	var results []middleware.Result
+	var last middleware.Result
+	handler := m.Handle(otherMiddleware.Handle(func(w http.ResponseWriter, r *http.Request) {
+		results = middleware.ResultsFromContext(r.Context())
+		last, _ = middleware.ResultFromContext(r.Context())
+	}, staticIdentifier), staticIdentifier)
+	start := time.Now()
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if len(results) != 2 || results[0].LimiterKey != "test_request_result" || results[1].LimiterKey != "test_request_result_other" {
+		t.Fatalf("Expected the results of both middlewares, outermost first, got %+v", results)
+	}
+	if last != results[1] {
+		t.Errorf("Expected the innermost result, got %+v", last)
+	}
+	if !last.Allowed || last.Status != http.StatusOK || last.Identifier != "client1" || last.Cost != 1 {
+		t.Errorf("Unexpected result %+v", last)
+	}
+	if last.Remaining != 0.75 {
+		t.Errorf("Expected 0.75 of the budget remaining, got %v", last.Remaining)
+	}
+	if last.Reset.Before(start.Add(time.Minute)) || last.Reset.After(time.Now().Add(time.Minute)) {
+		t.Errorf("Expected a reset at the end of the window, got %s", last.Reset)
+	}
+
+	plain := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_request_result", config.FixedWindowCounter)
+	plain.Handle(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := middleware.ResultFromContext(r.Context()); ok {
+			t.Error("Expected no result without WithRequestResult")
+		}
+	}, staticIdentifier)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+// TestRateLimitHeaders tests that the limit, remaining budget and reset time are sent with every decision, and the
+// retry delay with denials.
+func TestRateLimitHeaders(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("test_rate_limit_headers", time.Minute, 2)
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_rate_limit_headers", config.FixedWindowCounter, middleware.WithRateLimitHeaders())
+	handler := m.Handle(okHandler, staticIdentifier)
+
+	start := time.Now()
+	for i, want := range []string{"1", "0", "0"} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := w.Header().Get(middleware.HeaderLimit); got != "2" {
+			t.Errorf("Request %d: expected limit 2, got %q", i, got)
+		}
+		if got := w.Header().Get(middleware.HeaderRemaining); got != want {
+			t.Errorf("Request %d: expected %s remaining, got %q", i, want, got)
+		}
+		reset, err := strconv.ParseInt(w.Header().Get(middleware.HeaderReset), 10, 64)
+		if err != nil || reset < start.Add(time.Minute).Unix() || reset > time.Now().Add(time.Minute).Unix()+1 {
+			t.Errorf("Request %d: expected a reset at the end of the window, got %q", i, w.Header().Get(middleware.HeaderReset))
+		}
+		retry := w.Header().Get(middleware.HeaderRetry)
+		if w.Code == http.StatusOK && retry != "" {
+			t.Errorf("Request %d: expected no Retry-After for an allowed request, got %q", i, retry)
+		}
+		if w.Code == http.StatusTooManyRequests && retry != "60" {
+			t.Errorf("Request %d: expected a retry after the window, got %q", i, retry)
+		}
+	}
+
+	plain := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_rate_limit_headers", config.FixedWindowCounter)
+	w := httptest.NewRecorder()
+	plain.Handle(okHandler, staticIdentifier)(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := w.Header().Get(middleware.HeaderLimit); got != "" {
+		t.Errorf("Expected no headers without WithRateLimitHeaders, got limit %q", got)
+	}
+}
+
+// TestPolicyHeader tests that rate limited responses name the limiter key, or the limit within the limiter that
+// denied them, and that allowed responses name none.
+func TestPolicyHeader(t *testing.T) {
+	burst := fcinmemory.NewLimiter("test_policy_header", time.Minute, 2)
+	cap := fcinmemory.NewLimiter("test_policy_header:per_minute", time.Minute, 1)
+	limiter := capped.NewLimiter("test_policy_header", burst, cap, capped.WithCapPolicy("test_policy_header:per_minute"))
+	handler := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_policy_header", config.FixedWindowCounter, middleware.WithPolicyHeader()).Handle(okHandler, staticIdentifier)
+
+	for i, want := range []string{"", "test_policy_header:per_minute", "test_policy_header"} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := w.Header().Get(middleware.HeaderPolicy); got != want {
+			t.Errorf("Request %d (status %d): expected policy %q, got %q", i, w.Code, want, got)
+		}
+	}
+}
+
+// remainingBudget spends and returns the budget left for client1.
+func remainingBudget(limiter *fcinmemory.Limiter) int {
+	remaining := 0
+	for ok, _ := limiter.Allow(context.Background(), "client1"); ok; ok, _ = limiter.Allow(context.Background(), "client1") {
+		remaining++
+	}
+	return remaining
+}
+
+// TestTooManyKeys tests that requests for new identifiers beyond the key cap are answered with 429.
+func TestTooManyKeys(t *testing.T) {
+	base := fcinmemory.NewLimiter("test_too_many_keys", time.Minute, 10)
+	limiter := maxkeys.NewLimiter("test_too_many_keys", base, config.MaxKeysConfig{Limit: 1})
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_too_many_keys", config.FixedWindowCounter)
+
+	rec := httptest.NewRecorder()
+	m.Handle(okHandler, staticIdentifier)(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for the first identifier, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	m.Handle(okHandler, func(*http.Request) string { return "another" })(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 for an identifier beyond the cap, got %d", rec.Code)
+	}
+}
+
+// TestDecisionSink tests that allowed and rejected requests are recorded to the decision sink with their tag, and
+// rejected ones with the policy denying them.
+func TestDecisionSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	writer, err := decisions.NewFileWriter(path)
+	if err != nil {
+		t.Fatalf("NewFileWriter returned error: %v", err)
+	}
+	sink := decisions.NewSink(writer)
+	limiter := fcinmemory.NewLimiter("test_decision_sink", time.Minute, 1)
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_decision_sink", config.FixedWindowCounter,
+		middleware.WithDecisionSink(sink), middleware.WithTagFunc(func(r *http.Request) string { return "items" }))
+	handler := m.Handle(okHandler, staticIdentifier)
+	for i := 0; i < 2; i++ {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+	}
+	sink.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open decision log: %v", err)
+	}
+	defer file.Close()
+	var recorded []decisions.Decision
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var d decisions.Decision
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			t.Fatalf("Failed to decode decision: %v", err)
+		}
+		recorded = append(recorded, d)
+	}
+	if len(recorded) != 2 {
+		t.Fatalf("Expected 2 decisions, got %d", len(recorded))
+	}
+	if !recorded[0].Allowed || recorded[0].Status != http.StatusOK || recorded[0].Path != "/items" || recorded[0].Identifier != "client1" || recorded[0].Tag != "items" {
+		t.Errorf("Unexpected first decision: %+v", recorded[0])
+	}
+	if recorded[1].Allowed || recorded[1].Status != http.StatusTooManyRequests || recorded[1].Policy != "test_decision_sink" {
+		t.Errorf("Expected second request to be recorded as rate limited by the limiter, got %+v", recorded[1])
+	}
+}
+
+// failingLimiter returns err from every check.
+type failingLimiter struct {
+	err error
+}
+
+func (f *failingLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return false, f.err
+}
+
+// TestLimiterErrorStatus tests that requests the limiter fails to decide are answered with 503 if the backend may
+// decide them later, with 500 otherwise, and recorded with the class of the error.
+func TestLimiterErrorStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+		class  string
+	}{
+		{fmt.Errorf("run script: %w", context.DeadlineExceeded), http.StatusServiceUnavailable, "timeout"},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, http.StatusServiceUnavailable, "connection"},
+		{types.ErrBackendSaturated, http.StatusServiceUnavailable, "saturated"},
+		{fmt.Errorf("limiter 'test': %w", types.ErrIncompatibleState), http.StatusInternalServerError, "serialization"},
+		{errors.New("unexpected"), http.StatusInternalServerError, "other"},
+	} {
+		var out bytes.Buffer
+		sink := decisions.NewSink(decisions.NewStreamWriter(&out, "buffer"))
+		m := middleware.NewRateLimitMiddleware(&failingLimiter{err: tc.err}, testMetrics, "test_limiter_error_status", config.FixedWindowCounter, middleware.WithDecisionSink(sink))
+		rec := httptest.NewRecorder()
+		m.Handle(okHandler, staticIdentifier)(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		sink.Close()
+
+		if rec.Code != tc.status {
+			t.Errorf("Expected %d for %v, got %d", tc.status, tc.err, rec.Code)
+		}
+		var d decisions.Decision
+		if err := json.Unmarshal(out.Bytes(), &d); err != nil {
+			t.Fatalf("Expected a single decision, got %q: %v", out.String(), err)
+		}
+		if d.ErrorClass != tc.class || d.Status != tc.status {
+			t.Errorf("Expected decision with error class %q and status %d for %v, got %+v", tc.class, tc.status, tc.err, d)
+		}
+	}
+}
+
+// TestMirror tests that only requests denied by the limiter are mirrored.
+func TestMirror(t *testing.T) {
+	var out bytes.Buffer
+	mirrored := mirror.New(mirror.NewStreamWriter(&out, "buffer"), 0)
+	limiter := fcinmemory.NewLimiter("test_mirror", time.Minute, 1)
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_mirror", config.FixedWindowCounter, middleware.WithMirror(mirrored))
+	handler := m.Handle(okHandler, staticIdentifier)
+	for _, path := range []string{"/allowed", "/denied"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	mirrored.Close()
+
+	var req mirror.Request
+	if err := json.Unmarshal(out.Bytes(), &req); err != nil {
+		t.Fatalf("Expected a single mirrored request, got %q: %v", out.String(), err)
+	}
+	if req.Path != "/denied" || req.Status != http.StatusTooManyRequests || req.LimiterKey != "test_mirror" {
+		t.Errorf("Unexpected mirrored request: %+v", req)
+	}
+}
+
+// TestRebind tests that a rebound limiter takes effect for later requests of an existing handler, including while
+// requests are being served.
+func TestRebind(t *testing.T) {
+	m := middleware.NewRateLimitMiddleware(fcinmemory.NewLimiter("test_rebind", time.Minute, 1), testMetrics, "test_rebind", config.FixedWindowCounter)
+	handler := m.Handle(okHandler, staticIdentifier)
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != want {
+			t.Fatalf("Request %d: expected %d before rebinding, got %d", i+1, want, rec.Code)
+		}
+	}
+
+	// Requests served concurrently with Rebind use either limiter
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+	}
+	m.Rebind(fcinmemory.NewLimiter("test_rebind", time.Minute, 100), config.FixedWindowCounter)
+	wg.Wait()
+
+	m.Rebind(fcinmemory.NewLimiter("test_rebind", time.Minute, 3), config.FixedWindowCounter)
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != want {
+			t.Errorf("Request %d: expected %d after rebinding, got %d", i+1, want, rec.Code)
+		}
+	}
+}
+
+// TestAutoscaleHints tests that limiter decisions are observed with the identifier's utilization.
+func TestAutoscaleHints(t *testing.T) {
+	hints := autoscale.New([]time.Duration{time.Minute}, time.Minute)
+	defer hints.Close()
+	limiter := fcinmemory.NewLimiter("test_autoscale_hints", time.Minute, 2)
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_autoscale_hints", config.FixedWindowCounter,
+		middleware.WithAutoscaleHints(hints))
+	handler := m.Handle(okHandler, staticIdentifier)
+	for i := 0; i < 3; i++ {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	// Summarize once the interval of the requests has completed
+	hint := hints.SummaryAt(time.Now().Add(time.Minute))["test_autoscale_hints"]["1m"]
+	if hint.Requests != 3 {
+		t.Fatalf("Expected 3 requests observed, got %d", hint.Requests)
+	}
+	// Utilization after each request: 1/2, 2/2, and 1 for the denied request
+	if want := 2.5 / 3; hint.Utilization < want-1e-9 || hint.Utilization > want+1e-9 {
+		t.Errorf("Expected utilization %v, got %v", want, hint.Utilization)
+	}
+	if want := 1.0 / 3; hint.DenialRate < want-1e-9 || hint.DenialRate > want+1e-9 {
+		t.Errorf("Expected denial rate %v, got %v", want, hint.DenialRate)
+	}
+}
+
+// TestConnLimiter tests that new connections over the limiter's budget are closed before any request is served.
+func TestConnLimiter(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("test_conn_rate", time.Minute, 2)
+	connLimiter := middleware.NewConnLimiter(limiter, "test_conn_rate")
+	server := httptest.NewUnstartedServer(http.HandlerFunc(okHandler))
+	connLimiter.Install(server.Config)
+	server.Start()
+	defer server.Close()
+
+	get := func() error {
+		// A new transport opens a new connection for each request
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	for i := 0; i < 2; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("Connection %d should be served, got %v", i+1, err)
+		}
+	}
+	if err := get(); err == nil {
+		t.Error("Third connection should be closed by the connection limiter")
+	}
+}
+
+// TestMaxConnsPerIP tests that connections over the per-IP cap are closed, and that closed connections are released.
+func TestMaxConnsPerIP(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("test_conn_active", time.Minute, 100)
+	connLimiter := middleware.NewConnLimiter(limiter, "test_conn_active", middleware.WithMaxConnsPerIP(1))
+	server := httptest.NewUnstartedServer(http.HandlerFunc(okHandler))
+	connLimiter.Install(server.Config)
+	server.Start()
+	defer server.Close()
+
+	// Hold a connection open without sending a request, as a slowloris client would
+	held, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial returned error: %v", err)
+	}
+	waitForActive(t, connLimiter, 1)
+
+	second, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial returned error: %v", err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Second connection should be closed while the first is open, got %v", err)
+	}
+
+	held.Close()
+	waitForActive(t, connLimiter, 0)
+}
+
+// waitForActive waits until the connection limiter tracks want connections from the loopback address.
+func waitForActive(t *testing.T, connLimiter *middleware.ConnLimiter, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for connLimiter.Active("127.0.0.1") != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d active connections, got %d", want, connLimiter.Active("127.0.0.1"))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestSkipRules tests that requests matching a skip rule are served without consuming budget.
+func TestSkipRules(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("test_skip_rules", time.Minute, 1)
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_skip_rules", config.FixedWindowCounter,
+		middleware.WithSkipRules(middleware.SkipRules{
+			Methods: []string{http.MethodOptions},
+			Paths:   []string{"/healthz"},
+			Headers: map[string]string{"X-Probe": "", "X-Internal": "true"},
+		}))
+	handler := m.Handle(okHandler, staticIdentifier)
+
+	skipped := []*http.Request{
+		httptest.NewRequest(http.MethodOptions, "/items", nil),
+		httptest.NewRequest(http.MethodGet, "/healthz", nil),
+		httptest.NewRequest(http.MethodGet, "/items", nil),
+		httptest.NewRequest(http.MethodGet, "/items", nil),
+	}
+	skipped[2].Header.Set("X-Probe", "kubelet")
+	skipped[3].Header.Set("X-Internal", "true")
+	for _, r := range skipped {
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Skipped request %s %s should be served, got %d", r.Method, r.URL.Path, rec.Code)
+		}
+	}
+
+	limited := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/healthz/deep", nil),
+		httptest.NewRequest(http.MethodGet, "/items", nil),
+	}
+	limited[1].Header.Set("X-Internal", "false")
+	for i, r := range limited {
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		// The budget of 1 is still unused by the skipped requests
+		want := http.StatusOK
+		if i > 0 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Errorf("Request %s %s: expected %d, got %d", r.Method, r.URL.Path, want, rec.Code)
+		}
+	}
+}
+
+// TestEnabledFunc tests that requests for which the limiter is disabled pass through without consuming budget.
+func TestEnabledFunc(t *testing.T) {
+	limiter := fcinmemory.NewLimiter("test_enabled_func", time.Minute, 1)
+	var gotKey string
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_enabled_func", config.FixedWindowCounter,
+		middleware.WithEnabledFunc(func(limiterKey string, r *http.Request) bool {
+			gotKey = limiterKey
+			return r.Header.Get("X-Flag") != "off"
+		}))
+	handler := m.Handle(okHandler, staticIdentifier)
+
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/items", nil)
+		r.Header.Set("X-Flag", "off")
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected request %d served while the limiter is disabled, got %d", i, rec.Code)
+		}
+	}
+	if gotKey != "test_enabled_func" {
+		t.Errorf("Expected the limiter key passed to the hook, got %q", gotKey)
+	}
+
+	// The budget of 1 is still unused by the requests passed through
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/items", nil))
+		if rec.Code != want {
+			t.Errorf("Enabled request %d: expected %d, got %d", i, want, rec.Code)
+		}
+	}
+}
+
+// TestTarpit tests that rate limited requests are held before being answered, unless the tarpit is full.
+func TestTarpit(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	limiter := fcinmemory.NewLimiter("test_tarpit", time.Minute, 1)
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_tarpit", config.FixedWindowCounter,
+		middleware.WithTarpit(middleware.Tarpit{Delay: delay, MaxConcurrent: 1}))
+	handler := m.Handle(okHandler, staticIdentifier)
+	serve := func(r *http.Request) (int, time.Duration) {
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		return rec.Code, time.Since(start)
+	}
+
+	if code, elapsed := serve(httptest.NewRequest(http.MethodGet, "/", nil)); code != http.StatusOK || elapsed >= delay {
+		t.Fatalf("Allowed request should be served immediately, got %d after %v", code, elapsed)
+	}
+
+	// Hold the only slot, then check that another denied request is answered immediately
+	held := make(chan time.Duration)
+	go func() {
+		_, elapsed := serve(httptest.NewRequest(http.MethodGet, "/", nil))
+		held <- elapsed
+	}()
+	time.Sleep(delay / 4)
+	if code, elapsed := serve(httptest.NewRequest(http.MethodGet, "/", nil)); code != http.StatusTooManyRequests || elapsed >= delay/2 {
+		t.Errorf("Denied request should be answered immediately while the tarpit is full, got %d after %v", code, elapsed)
+	}
+	if elapsed := <-held; elapsed < delay {
+		t.Errorf("Denied request should be held for %v, got %v", delay, elapsed)
+	}
+
+	// Holding ends when the client goes away
+	ctx, cancel := context.WithTimeout(context.Background(), delay/4)
+	defer cancel()
+	if code, elapsed := serve(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)); code != http.StatusTooManyRequests || elapsed >= delay {
+		t.Errorf("Denied request should be answered once its context is done, got %d after %v", code, elapsed)
+	}
+}
+
+// TestAPIKeyMiddleware tests that requests are limited per API key by the limiter of the key's plan and that unknown keys are rejected.
+func TestAPIKeyMiddleware(t *testing.T) {
+	registry := apikeys.NewRegistry(time.Hour, apikeys.NewStaticStore(map[string]apikeys.APIKey{
+		"free-secret": {Name: "alice", Plan: "free"},
+		"pro-secret":  {Name: "bob", Plan: "pro"},
+	}))
+	registry.Start()
+	defer registry.Close()
+	plans := map[string]*middleware.RateLimitMiddleware{
+		"free": middleware.NewRateLimitMiddleware(fcinmemory.NewLimiter("test_plan_free", time.Minute, 1), testMetrics, "test_plan_free", config.FixedWindowCounter),
+		"pro":  middleware.NewRateLimitMiddleware(fcinmemory.NewLimiter("test_plan_pro", time.Minute, 3), testMetrics, "test_plan_pro", config.FixedWindowCounter),
+	}
+	var seen string
+	handler := middleware.NewAPIKeyMiddleware(registry, "X-API-Key", plans).Handle(func(w http.ResponseWriter, r *http.Request) {
+		apiKey, _ := apikeys.FromContext(r.Context())
+		seen = apiKey.Name
+		w.WriteHeader(http.StatusOK)
+	})
+
+	allowed := func(key string, n int) (int, int) {
+		ok, last := 0, 0
+		for i := 0; i < n; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-API-Key", key)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code == http.StatusOK {
+				ok++
+			}
+			last = rec.Code
+		}
+		return ok, last
+	}
+	if ok, last := allowed("free-secret", 3); ok != 1 || last != http.StatusTooManyRequests {
+		t.Errorf("Expected 1 request allowed on the free plan, got %d (last status %d)", ok, last)
+	}
+	if ok, _ := allowed("pro-secret", 5); ok != 3 || seen != "bob" {
+		t.Errorf("Expected 3 requests allowed for bob on the pro plan, got %d for %q", ok, seen)
+	}
+	if _, last := allowed("unknown", 1); last != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an unknown key, got %d", last)
+	}
+	if _, last := allowed("", 1); last != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a key, got %d", last)
+	}
+}
+
+// TestLoadShedding tests that requests are shed with 503 without consuming budget when the load is too high or the deadline too near.
+func TestLoadShedding(t *testing.T) {
+	load := 0.9
+	limiter := fcinmemory.NewLimiter("test_load_shedding", time.Minute, 1)
+	m := middleware.NewRateLimitMiddleware(limiter, testMetrics, "test_load_shedding", config.FixedWindowCounter,
+		middleware.WithLoadShedding(middleware.LoadShedding{
+			Headroom:  time.Second,
+			Signal:    func() float64 { return load },
+			Threshold: 0.8,
+		}))
+	handler := m.Handle(okHandler, staticIdentifier)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 while overloaded, got %d", rec.Code)
+	}
+
+	load = 0.5
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 for a request without enough time left, got %d", rec.Code)
+	}
+
+	// Shed requests did not consume the single unit of budget
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 once load dropped, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"learn.ratelimiter/types"
+)
+
+// Result is the decision of a middleware for a request.
+type Result struct {
+	LimiterKey string
+	Identifier string
+	Allowed    bool
+	// Status is the HTTP status of the decision, http.StatusOK if the request was allowed.
+	Status int
+	// Cost is the number of units the request was charged.
+	Cost int
+	// Remaining is the fraction of the identifier's budget left after the decision, between 0 and 1, or negative if
+	// the limiter was not consulted or cannot tell (see types.PressureLimiter).
+	Remaining float64
+	// Reset is the time at which the identifier's budget is fully restored, or the zero time if the limiter was not
+	// consulted or cannot tell (see types.ResetLimiter).
+	Reset time.Time
+}
+
+// results records the decisions made for one request, in the order the middlewares made them.
+type results struct {
+	mu      sync.Mutex
+	results []Result
+}
+
+// resultsContextKey is the context key under which the request's results are stored.
+type resultsContextKey struct{}
+
+// WithRequestResult stores the decision for each request in its context, so the handlers after the middleware can
+// read it with ResultFromContext (e.g., to log it, return it in the response body, or degrade features near the
+// limit). Reading the remaining budget and reset time adds two reads of the limiter's state per request, which are
+// backend round trips for remote backends. Requests skipped by WithSkipRules or WithEnabledFunc get no result.
+func WithRequestResult() Option {
+	return func(m *RateLimitMiddleware) {
+		m.result = true
+	}
+}
+
+// ResultFromContext returns the decision of the last middleware that checked the request, if one stored it (see
+// WithRequestResult).
+func ResultFromContext(ctx context.Context) (Result, bool) {
+	requestResults := ResultsFromContext(ctx)
+	if len(requestResults) == 0 {
+		return Result{}, false
+	}
+	return requestResults[len(requestResults)-1], true
+}
+
+// ResultsFromContext returns the decisions stored for the request by nested middlewares, outermost first.
+func ResultsFromContext(ctx context.Context) []Result {
+	requestResults, ok := ctx.Value(resultsContextKey{}).(*results)
+	if !ok {
+		return nil
+	}
+	requestResults.mu.Lock()
+	defer requestResults.mu.Unlock()
+	return append([]Result(nil), requestResults.results...)
+}
+
+// withResults returns r with a place for results in its context if results are enabled and the request has none yet,
+// so the handlers after this middleware see the decisions made for the request.
+func (m *RateLimitMiddleware) withResults(r *http.Request) *http.Request {
+	if !m.result {
+		return r
+	}
+	if _, ok := r.Context().Value(resultsContextKey{}).(*results); ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), resultsContextKey{}, &results{}))
+}
+
+// storeResult stores the decision for the request, reading the identifier's remaining budget and reset time from the
+// limiter if it was consulted.
+func (m *RateLimitMiddleware) storeResult(r *http.Request, limiter types.Limiter, identifier string, cost, status int, consulted bool) {
+	requestResults, ok := r.Context().Value(resultsContextKey{}).(*results)
+	if !ok {
+		return
+	}
+	result := Result{
+		LimiterKey: m.limiterKey,
+		Identifier: identifier,
+		Allowed:    status == http.StatusOK,
+		Status:     status,
+		Cost:       cost,
+		Remaining:  -1,
+	}
+	if consulted {
+		if pressure, err := types.Pressure(r.Context(), limiter, identifier); err == nil {
+			result.Remaining = max(1-pressure, 0)
+		}
+		if reset, err := types.ResetTime(r.Context(), limiter, identifier); err == nil {
+			result.Reset = reset
+		}
+	}
+	requestResults.mu.Lock()
+	requestResults.results = append(requestResults.results, result)
+	requestResults.mu.Unlock()
+}
@@ -0,0 +1,224 @@
+// Package middleware provides HTTP middleware for integrating the rate limiter.
+package middleware
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"learn.ratelimiter/types"
+)
+
+// RPC frameworks such as connect-go, Twirp and grpc-go (via grpc.Server.ServeHTTP) serve requests through net/http,
+// so the wrappers below apply rate limiting at the HTTP layer and report rejections in each protocol's own error format.
+// This keeps the middleware free of framework dependencies while sharing identifier extraction and checks with Handle.
+
+// rpcCode is a gRPC/Connect/Twirp error code name and its numeric gRPC status.
+type rpcCode struct {
+	name string
+	grpc int
+}
+
+// Error codes used for rejected RPCs.
+var (
+	rpcResourceExhausted = rpcCode{name: "resource_exhausted", grpc: 8}
+	rpcInvalidArgument   = rpcCode{name: "invalid_argument", grpc: 3}
+	rpcPermissionDenied  = rpcCode{name: "permission_denied", grpc: 7}
+	rpcInternal          = rpcCode{name: "internal", grpc: 13}
+	rpcUnavailable       = rpcCode{name: "unavailable", grpc: 14}
+)
+
+// rpcCodeForStatus maps a rejection status from check to an RPC error code.
+func rpcCodeForStatus(status int) rpcCode {
+	switch status {
+	case http.StatusTooManyRequests:
+		return rpcResourceExhausted
+	case http.StatusRequestEntityTooLarge, http.StatusBadRequest:
+		return rpcInvalidArgument
+	case http.StatusForbidden:
+		return rpcPermissionDenied
+	case http.StatusServiceUnavailable:
+		return rpcUnavailable
+	default:
+		return rpcInternal
+	}
+}
+
+// ConnectHandler wraps a connect-go handler with rate limiting.
+// Rejections are reported as Connect errors; gRPC and gRPC-Web requests served by the same handler receive gRPC status
+// trailers, with the client hints of GRPCHandler.
+// It takes the next handler and a function to extract the identifier from the request (e.g., from headers or the procedure path).
+func (m *RateLimitMiddleware) ConnectHandler(next http.Handler, identifierFunc func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = m.withResults(m.withMemo(r))
+		contentType := r.Header.Get("Content-Type")
+		grpc := strings.HasPrefix(contentType, "application/grpc")
+		var result *types.Result
+		if grpc {
+			result = &types.Result{Limit: -1, Remaining: -1}
+		}
+		status := m.checkDetailed(w, r, identifierFunc, result)
+		if status == http.StatusOK {
+			next.ServeHTTP(w, r)
+			return
+		}
+		code := rpcCodeForStatus(status)
+		switch {
+		case grpc:
+			m.writeGRPCError(w, contentType, code, *result)
+		case strings.HasPrefix(contentType, "application/connect+"):
+			writeConnectStreamError(w, contentType, code)
+		default:
+			writeJSONError(w, status, map[string]string{"code": code.name, "message": http.StatusText(status)})
+		}
+	})
+}
+
+// TwirpHandler wraps a Twirp server with rate limiting, reporting rejections as Twirp JSON errors.
+func (m *RateLimitMiddleware) TwirpHandler(next http.Handler, identifierFunc func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = m.withResults(m.withMemo(r))
+		status := m.check(w, r, identifierFunc)
+		if status == http.StatusOK {
+			next.ServeHTTP(w, r)
+			return
+		}
+		code := rpcCodeForStatus(status)
+		writeJSONError(w, status, map[string]string{"code": code.name, "msg": http.StatusText(status)})
+	})
+}
+
+// GRPCHandler wraps a gRPC server served through its ServeHTTP method with rate limiting,
+// reporting rejections as a trailers-only response carrying the gRPC status. Rate limited calls also carry hints for
+// clients to back off: the retry-after (seconds) and x-ratelimit-remaining trailing metadata, when the limiter can
+// tell them (see types.AllowDetailed), and a google.rpc.QuotaFailure naming the limiter and a google.rpc.RetryInfo
+// in the status details, which gRPC clients and their retry policies read.
+func (m *RateLimitMiddleware) GRPCHandler(next http.Handler, identifierFunc func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = m.withResults(m.withMemo(r))
+		result := types.Result{Limit: -1, Remaining: -1}
+		status := m.checkDetailed(w, r, identifierFunc, &result)
+		if status == http.StatusOK {
+			next.ServeHTTP(w, r)
+			return
+		}
+		contentType := r.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/grpc"
+		}
+		m.writeGRPCError(w, contentType, rpcCodeForStatus(status), result)
+	})
+}
+
+// ProcedureIdentifier returns an identifier function combining the RPC procedure (the request path) with the identifier from base,
+// so a single limiter can budget each procedure separately.
+func ProcedureIdentifier(base func(*http.Request) string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		identifier := base(r)
+		if identifier == "" {
+			return ""
+		}
+		return r.URL.Path + ":" + identifier
+	}
+}
+
+// writeGRPCError writes a trailers-only gRPC response with the given status code. Rate limited calls carry the
+// retry delay and remaining budget of the result as metadata and status details.
+func (m *RateLimitMiddleware) writeGRPCError(w http.ResponseWriter, contentType string, code rpcCode, result types.Result) {
+	message := "rate limit: " + code.name
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Grpc-Status", strconv.Itoa(code.grpc))
+	header.Set("Grpc-Message", message)
+	if code == rpcResourceExhausted {
+		if result.RetryAfter > 0 {
+			header.Set(HeaderRetry, strconv.FormatInt(ceilSeconds(result.RetryAfter), 10))
+		}
+		if result.Remaining >= 0 {
+			header.Set(HeaderRemaining, strconv.FormatInt(result.Remaining, 10))
+		}
+		// Binary metadata is base64-encoded, which gRPC implementations accept without padding
+		header.Set("Grpc-Status-Details-Bin", base64.RawStdEncoding.EncodeToString(m.quotaStatus(code, message, result.RetryAfter)))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Type URLs of the google.rpc error details sent with rate limited calls.
+const (
+	quotaFailureTypeURL = "type.googleapis.com/google.rpc.QuotaFailure"
+	retryInfoTypeURL    = "type.googleapis.com/google.rpc.RetryInfo"
+)
+
+// quotaStatus encodes the google.rpc.Status of a rate limited call: its code and message, with a QuotaFailure naming
+// the limiter and, if retryAfter is positive, a RetryInfo carrying it. The messages are written field by field, so
+// the middleware does not depend on the generated gRPC packages.
+func (m *RateLimitMiddleware) quotaStatus(code rpcCode, message string, retryAfter time.Duration) []byte {
+	// google.rpc.QuotaFailure{violations: [{subject, description}]}
+	var violation []byte
+	violation = protowire.AppendTag(violation, 1, protowire.BytesType)
+	violation = protowire.AppendString(violation, "limiter:"+m.limiterKey)
+	violation = protowire.AppendTag(violation, 2, protowire.BytesType)
+	violation = protowire.AppendString(violation, "rate limit exceeded")
+	var quotaFailure []byte
+	quotaFailure = protowire.AppendTag(quotaFailure, 1, protowire.BytesType)
+	quotaFailure = protowire.AppendBytes(quotaFailure, violation)
+
+	// google.rpc.Status{code, message, details: [google.protobuf.Any...]}
+	var status []byte
+	status = protowire.AppendTag(status, 1, protowire.VarintType)
+	status = protowire.AppendVarint(status, uint64(code.grpc))
+	status = protowire.AppendTag(status, 2, protowire.BytesType)
+	status = protowire.AppendString(status, message)
+	status = appendAny(status, 3, quotaFailureTypeURL, quotaFailure)
+	if retryAfter > 0 {
+		// google.rpc.RetryInfo{retry_delay: google.protobuf.Duration{seconds, nanos}}
+		var duration []byte
+		duration = protowire.AppendTag(duration, 1, protowire.VarintType)
+		duration = protowire.AppendVarint(duration, uint64(retryAfter/time.Second))
+		duration = protowire.AppendTag(duration, 2, protowire.VarintType)
+		duration = protowire.AppendVarint(duration, uint64(retryAfter%time.Second))
+		var retryInfo []byte
+		retryInfo = protowire.AppendTag(retryInfo, 1, protowire.BytesType)
+		retryInfo = protowire.AppendBytes(retryInfo, duration)
+		status = appendAny(status, 3, retryInfoTypeURL, retryInfo)
+	}
+	return status
+}
+
+// appendAny appends a google.protobuf.Any holding the message of the given type as field num.
+func appendAny(b []byte, num protowire.Number, typeURL string, message []byte) []byte {
+	var anyMessage []byte
+	anyMessage = protowire.AppendTag(anyMessage, 1, protowire.BytesType)
+	anyMessage = protowire.AppendString(anyMessage, typeURL)
+	anyMessage = protowire.AppendTag(anyMessage, 2, protowire.BytesType)
+	anyMessage = protowire.AppendBytes(anyMessage, message)
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, anyMessage)
+}
+
+// writeConnectStreamError writes a Connect streaming response consisting only of an end-of-stream message carrying the error.
+func writeConnectStreamError(w http.ResponseWriter, contentType string, code rpcCode) {
+	payload, _ := json.Marshal(map[string]any{
+		"error": map[string]string{"code": code.name, "message": "rate limit: " + code.name},
+	})
+	// Envelope: one flags byte (0x02 marks end-of-stream) followed by a big-endian uint32 length.
+	envelope := make([]byte, 5, 5+len(payload))
+	envelope[0] = 0x02
+	binary.BigEndian.PutUint32(envelope[1:], uint32(len(payload)))
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(envelope, payload...))
+}
+
+// writeJSONError writes a JSON error body with the given HTTP status.
+func writeJSONError(w http.ResponseWriter, status int, body map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
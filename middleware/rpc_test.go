@@ -0,0 +1,145 @@
+// Package middleware_test contains tests for the HTTP rate limiting middleware.
+package middleware_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"learn.ratelimiter/config"
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/middleware"
+)
+
+// TestRPCHandlers tests that each RPC wrapper reports rejections in its protocol's error format.
+func TestRPCHandlers(t *testing.T) {
+	newMiddleware := func(key string) *middleware.RateLimitMiddleware {
+		return middleware.NewRateLimitMiddleware(fcinmemory.NewLimiter(key, time.Minute, 1), testMetrics, key, config.FixedWindowCounter)
+	}
+	next := http.HandlerFunc(okHandler)
+
+	t.Run("ConnectUnary", func(t *testing.T) {
+		handler := newMiddleware("test_connect").ConnectHandler(next, staticIdentifier)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", strings.NewReader("{}")))
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected 429, got %d", rec.Code)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode Connect error: %v", err)
+		}
+		if body["code"] != "resource_exhausted" {
+			t.Errorf("Expected code resource_exhausted, got %q", body["code"])
+		}
+	})
+
+	t.Run("ConnectGRPC", func(t *testing.T) {
+		handler := newMiddleware("test_connect_grpc").ConnectHandler(next, staticIdentifier)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil))
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+		req.Header.Set("Content-Type", "application/grpc+proto")
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("Grpc-Status") != "8" {
+			t.Fatalf("Expected trailers-only response with grpc-status 8, got %d and %q", rec.Code, rec.Header().Get("Grpc-Status"))
+		}
+	})
+
+	t.Run("GRPCHints", func(t *testing.T) {
+		handler := newMiddleware("test_grpc_hints").GRPCHandler(next, staticIdentifier)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil))
+		if rec.Header().Get("Grpc-Status") != "8" {
+			t.Fatalf("Expected grpc-status 8, got %q", rec.Header().Get("Grpc-Status"))
+		}
+		if got := rec.Header().Get("Retry-After"); got != "60" {
+			t.Errorf("Expected retry-after 60, got %q", got)
+		}
+		if got := rec.Header().Get("X-RateLimit-Remaining"); got != "0" {
+			t.Errorf("Expected x-ratelimit-remaining 0, got %q", got)
+		}
+
+		details, err := base64.RawStdEncoding.DecodeString(rec.Header().Get("Grpc-Status-Details-Bin"))
+		if err != nil {
+			t.Fatalf("Failed to decode status details: %v", err)
+		}
+		status := protoFields(t, details)
+		if len(status[1]) != 1 || status[1][0].(uint64) != 8 {
+			t.Errorf("Expected status code 8, got %v", status[1])
+		}
+		typeURLs := make(map[string][]byte)
+		for _, detail := range status[3] {
+			anyMessage := protoFields(t, detail.([]byte))
+			typeURLs[string(anyMessage[1][0].([]byte))] = anyMessage[2][0].([]byte)
+		}
+		violation := protoFields(t, protoFields(t, typeURLs["type.googleapis.com/google.rpc.QuotaFailure"])[1][0].([]byte))
+		if subject := string(violation[1][0].([]byte)); subject != "limiter:test_grpc_hints" {
+			t.Errorf("Expected a quota failure for the limiter, got subject %q", subject)
+		}
+		retryInfo, ok := typeURLs["type.googleapis.com/google.rpc.RetryInfo"]
+		if !ok {
+			t.Fatalf("Expected retry info in %v", typeURLs)
+		}
+		delay := protoFields(t, protoFields(t, retryInfo)[1][0].([]byte))
+		if seconds := delay[1][0].(uint64); seconds < 59 || seconds > 60 {
+			t.Errorf("Expected a retry delay of a minute, got %ds", seconds)
+		}
+	})
+
+	t.Run("Twirp", func(t *testing.T) {
+		handler := newMiddleware("test_twirp").TwirpHandler(next, staticIdentifier)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/twirp/pkg.Service/Method", nil))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/twirp/pkg.Service/Method", nil))
+		var body map[string]string
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode Twirp error: %v", err)
+		}
+		if rec.Code != http.StatusTooManyRequests || body["code"] != "resource_exhausted" || body["msg"] == "" {
+			t.Fatalf("Unexpected Twirp error: %d %v", rec.Code, body)
+		}
+	})
+}
+
+// protoFields decodes the varint and length-delimited fields of a protocol buffers message, by field number.
+func protoFields(t *testing.T, b []byte) map[protowire.Number][]any {
+	t.Helper()
+	fields := make(map[protowire.Number][]any)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("Malformed message: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		var value any
+		switch typ {
+		case protowire.VarintType:
+			value, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("Unexpected wire type %d of field %d", typ, num)
+		}
+		if n < 0 {
+			t.Fatalf("Malformed field %d: %v", num, protowire.ParseError(n))
+		}
+		fields[num] = append(fields[num], value)
+		b = b[n:]
+	}
+	return fields
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// SkipRules selects requests passed to the next handler without being rate limited, e.g., CORS preflights and health probes.
+// A request is skipped if it matches any rule. Skipped requests consume no budget and are not counted in metrics or decisions.
+type SkipRules struct {
+	// Methods are skipped request methods (e.g., http.MethodOptions for CORS preflights), compared case-insensitively.
+	Methods []string
+	// Paths are skipped URL paths (e.g., "/healthz"), compared exactly.
+	Paths []string
+	// Headers maps header names to the value that skips a request; an empty value skips requests carrying the header at all.
+	// Since clients set headers, use them only for headers a trusted proxy sets or strips.
+	Headers map[string]string
+}
+
+// WithSkipRules passes requests matching rules to the next handler before the identifier is extracted or the limiter consulted.
+func WithSkipRules(rules SkipRules) Option {
+	return func(m *RateLimitMiddleware) {
+		m.skip = &rules
+	}
+}
+
+// matches reports whether the request matches any of the rules.
+func (s *SkipRules) matches(r *http.Request) bool {
+	for _, method := range s.Methods {
+		if strings.EqualFold(r.Method, method) {
+			return true
+		}
+	}
+	if slices.Contains(s.Paths, r.URL.Path) {
+		return true
+	}
+	for name, value := range s.Headers {
+		values := r.Header.Values(name)
+		if len(values) > 0 && (value == "" || slices.Contains(values, value)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"learn.ratelimiter/metrics"
+)
+
+// MaxTarpitDelay caps the delay of the tarpit, whatever Tarpit.Delay says, so a misconfiguration cannot hold
+// requests for minutes.
+const MaxTarpitDelay = 30 * time.Second
+
+// DefaultTarpitConcurrency is the number of requests held at once when Tarpit.MaxConcurrent is not positive.
+const DefaultTarpitConcurrency = 100
+
+// Outcomes of a denied request reaching the tarpit, used as the outcome label of the tarpit metric.
+const (
+	TarpitDelayed  = "delayed"
+	TarpitBypassed = "bypassed"
+)
+
+// Tarpit configures delaying rate limited requests before answering 429, slowing down naive clients (e.g., scrapers
+// retrying in a loop) that would otherwise come back immediately.
+type Tarpit struct {
+	// Delay is how long a denied request is held, capped at MaxTarpitDelay.
+	Delay time.Duration
+	// MaxConcurrent is the number of requests held at once (default DefaultTarpitConcurrency). Requests denied while
+	// as many are held are answered immediately, so a flood cannot tie up an unbounded number of goroutines and connections.
+	MaxConcurrent int
+}
+
+// tarpit holds denied requests, up to a fixed number at once.
+type tarpit struct {
+	delay time.Duration
+	// slots holds a token per request being held.
+	slots chan struct{}
+}
+
+// WithTarpit holds rate limited requests for tarpit.Delay before answering 429 Too Many Requests.
+// Holding a request ends early when its context is done (e.g., the client disconnects or its deadline passes),
+// and requests denied while tarpit.MaxConcurrent are held are answered immediately. Requests are counted by
+// the rate_limiter_tarpit_total metric, by outcome (delayed or bypassed). The server's WriteTimeout, if any,
+// should exceed the delay.
+func WithTarpit(tp Tarpit) Option {
+	return func(m *RateLimitMiddleware) {
+		if tp.Delay <= 0 {
+			m.tarpit = nil
+			return
+		}
+		if tp.MaxConcurrent <= 0 {
+			tp.MaxConcurrent = DefaultTarpitConcurrency
+		}
+		m.tarpit = &tarpit{
+			delay: min(tp.Delay, MaxTarpitDelay),
+			slots: make(chan struct{}, tp.MaxConcurrent),
+		}
+	}
+}
+
+// hold delays the denied request, unless as many requests as allowed are already held.
+func (t *tarpit) hold(r *http.Request, limiterKey string) {
+	select {
+	case t.slots <- struct{}{}:
+	default:
+		metrics.RecordTarpit(limiterKey, TarpitBypassed)
+		return
+	}
+	defer func() { <-t.slots }()
+	metrics.RecordTarpit(limiterKey, TarpitDelayed)
+
+	timer := time.NewTimer(t.delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+}
@@ -0,0 +1,243 @@
+// Package mirror copies a sample of denied requests (metadata and headers, and optionally bodies) to a sink for offline
+// analysis of what is being blocked. Requests are redacted before they are queued, and written asynchronously, so
+// mirroring never waits on the sink.
+package mirror
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/metrics"
+)
+
+// Request is a denied request as mirrored.
+// Its JSON field names are a stable format ingested by analysis pipelines: add fields, never rename them.
+type Request struct {
+	Time       time.Time `json:"time"`
+	LimiterKey string    `json:"limiter_key"`
+	Identifier string    `json:"identifier"`
+	// Status is the HTTP status the request was answered with (e.g., 429 or 403).
+	Status     int                 `json:"status"`
+	Method     string              `json:"method"`
+	Host       string              `json:"host,omitempty"`
+	Path       string              `json:"path"`
+	Query      string              `json:"query,omitempty"`
+	RemoteAddr string              `json:"remote_addr,omitempty"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	// Body holds the start of the request body, if bodies are mirrored.
+	Body string `json:"body,omitempty"`
+	// BodyTruncated is set if the body was longer than the mirrored part.
+	BodyTruncated bool `json:"body_truncated,omitempty"`
+}
+
+// Writer stores batches of mirrored requests.
+type Writer interface {
+	// Write stores the requests, oldest first.
+	Write(ctx context.Context, requests []Request) error
+	io.Closer
+}
+
+// RedactFunc removes personal data from a request before it is queued, e.g., by masking headers or the identifier.
+type RedactFunc func(*Request)
+
+// Defaults used when an option is not given or not positive.
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultBufferSize    = 1000
+	DefaultMaxBodyBytes  = 4096
+)
+
+// Reasons mirrored requests are dropped, used as the reason label of the dropped requests metric.
+const (
+	DropReasonOverflow   = "overflow"
+	DropReasonWriteError = "write_error"
+)
+
+// Mirror samples denied requests, redacts them and writes them in batches from a background goroutine.
+// Requests recorded while the buffer is full are dropped.
+type Mirror struct {
+	writer        Writer
+	sampleRate    float64
+	maxBodyBytes  int64 // 0 leaves bodies out
+	redactors     []RedactFunc
+	batchSize     int
+	flushInterval time.Duration
+
+	queue     chan Request
+	stop      chan struct{}
+	done      chan struct{}
+	closed    atomic.Bool
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Option configures optional behaviour of a Mirror.
+type Option func(*Mirror)
+
+// WithSampleRate mirrors only the given fraction of denied requests, chosen at random. Rates outside (0, 1) mirror every one.
+func WithSampleRate(rate float64) Option {
+	return func(m *Mirror) {
+		if rate > 0 && rate < 1 {
+			m.sampleRate = rate
+		}
+	}
+}
+
+// WithBody mirrors up to maxBytes of each request body (DefaultMaxBodyBytes if maxBytes is not positive).
+// Bodies are left out by default.
+func WithBody(maxBytes int64) Option {
+	return func(m *Mirror) {
+		if maxBytes <= 0 {
+			maxBytes = DefaultMaxBodyBytes
+		}
+		m.maxBodyBytes = maxBytes
+	}
+}
+
+// WithRedactors applies the redactors, in order, to each request before it is queued.
+func WithRedactors(redactors ...RedactFunc) Option {
+	return func(m *Mirror) {
+		m.redactors = append(m.redactors, redactors...)
+	}
+}
+
+// WithBatching writes at most batchSize requests at once (DefaultBatchSize if not positive), at least every
+// flushInterval (DefaultFlushInterval if not positive).
+func WithBatching(batchSize int, flushInterval time.Duration) Option {
+	return func(m *Mirror) {
+		if batchSize > 0 {
+			m.batchSize = batchSize
+		}
+		if flushInterval > 0 {
+			m.flushInterval = flushInterval
+		}
+	}
+}
+
+// New creates a mirror writing to writer with a buffer of bufferSize requests (DefaultBufferSize if not positive),
+// and starts its background goroutine. The mirror takes ownership of the writer and closes it on Close.
+func New(writer Writer, bufferSize int, opts ...Option) *Mirror {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	m := &Mirror{
+		writer:        writer,
+		sampleRate:    1,
+		batchSize:     DefaultBatchSize,
+		flushInterval: DefaultFlushInterval,
+		queue:         make(chan Request, bufferSize),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	log.Info().Float64("sample_rate", m.sampleRate).Int64("max_body_bytes", m.maxBodyBytes).Int("buffer_size", bufferSize).Msg("Mirror: Starting denied request mirror")
+	go m.run()
+	return m
+}
+
+// Record mirrors the request, denied by the limiter with the given status, subject to sampling. The body, if
+// mirrored, is read from r, so Record must be called before anything else reads it. Requests recorded after Close
+// are discarded.
+func (m *Mirror) Record(r *http.Request, limiterKey, identifier string, status int) {
+	if m.closed.Load() || (m.sampleRate < 1 && rand.Float64() >= m.sampleRate) {
+		return
+	}
+	req := Request{
+		Time:       time.Now(),
+		LimiterKey: limiterKey,
+		Identifier: identifier,
+		Status:     status,
+		Method:     r.Method,
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		RemoteAddr: r.RemoteAddr,
+		Headers:    r.Header.Clone(),
+	}
+	if m.maxBodyBytes > 0 && r.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(r.Body, m.maxBodyBytes+1))
+		if err != nil {
+			log.Debug().Err(err).Str("limiter_key", limiterKey).Msg("Mirror: Failed to read request body")
+		}
+		if int64(len(body)) > m.maxBodyBytes {
+			body = body[:m.maxBodyBytes]
+			req.BodyTruncated = true
+		}
+		req.Body = string(body)
+	}
+	for _, redactor := range m.redactors {
+		redactor(&req)
+	}
+	select {
+	case m.queue <- req:
+	default:
+		metrics.RecordMirrorDropped(DropReasonOverflow, 1)
+	}
+}
+
+// run batches queued requests until the mirror is closed, then writes what is left.
+func (m *Mirror) run() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.flushInterval)
+	defer ticker.Stop()
+	batch := make([]Request, 0, m.batchSize)
+	for {
+		select {
+		case req := <-m.queue:
+			batch = append(batch, req)
+			if len(batch) >= m.batchSize {
+				batch = m.flush(batch)
+			}
+		case <-ticker.C:
+			batch = m.flush(batch)
+		case <-m.stop:
+			for {
+				select {
+				case req := <-m.queue:
+					batch = append(batch, req)
+					if len(batch) >= m.batchSize {
+						batch = m.flush(batch)
+					}
+				default:
+					m.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes the batch, if any, and returns it emptied for reuse. Failed batches are dropped rather than retried.
+func (m *Mirror) flush(batch []Request) []Request {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.writer.Write(ctx, batch); err != nil {
+		log.Warn().Err(err).Int("count", len(batch)).Msg("Mirror: Failed to write mirrored requests, dropping batch")
+		metrics.RecordMirrorDropped(DropReasonWriteError, len(batch))
+	}
+	return batch[:0]
+}
+
+// Close stops accepting requests, writes those still buffered and closes the writer. It is safe to call more than once.
+func (m *Mirror) Close() error {
+	m.closeOnce.Do(func() {
+		m.closed.Store(true)
+		close(m.stop)
+		<-m.done
+		m.closeErr = m.writer.Close()
+	})
+	return m.closeErr
+}
@@ -0,0 +1,116 @@
+// Package mirror_test contains tests for the denied request mirror.
+package mirror_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/mirror"
+)
+
+// recordingWriter keeps every request written to it.
+type recordingWriter struct {
+	mu       sync.Mutex
+	requests []mirror.Request
+}
+
+func (w *recordingWriter) Write(_ context.Context, batch []mirror.Request) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.requests = append(w.requests, batch...)
+	return nil
+}
+
+func (w *recordingWriter) Close() error { return nil }
+
+// TestRecord tests that requests are mirrored with their metadata and headers, but not their body by default,
+// and that credentials are redacted.
+func TestRecord(t *testing.T) {
+	writer := &recordingWriter{}
+	m := mirror.New(writer, 0, mirror.WithRedactors(mirror.RedactHeaders("X-Session")))
+	r := httptest.NewRequest(http.MethodPost, "/login?next=home", strings.NewReader("password=secret"))
+	r.Header.Set("Authorization", "Bearer token")
+	r.Header.Set("X-Session", "abc")
+	r.Header.Set("User-Agent", "scanner/1.0")
+	m.Record(r, "login", "client1", http.StatusTooManyRequests)
+	m.Close()
+
+	if len(writer.requests) != 1 {
+		t.Fatalf("Expected 1 mirrored request, got %d", len(writer.requests))
+	}
+	got := writer.requests[0]
+	if got.LimiterKey != "login" || got.Identifier != "client1" || got.Status != http.StatusTooManyRequests || got.Method != http.MethodPost || got.Path != "/login" || got.Query != "next=home" {
+		t.Errorf("Unexpected metadata: %+v", got)
+	}
+	if got.Body != "" {
+		t.Errorf("Expected no body by default, got %q", got.Body)
+	}
+	for _, name := range []string{"Authorization", "X-Session"} {
+		if values := got.Headers[name]; len(values) != 1 || values[0] != "[REDACTED]" {
+			t.Errorf("Expected %s redacted, got %v", name, values)
+		}
+	}
+	if values := got.Headers["User-Agent"]; len(values) != 1 || values[0] != "scanner/1.0" {
+		t.Errorf("Expected User-Agent kept, got %v", values)
+	}
+}
+
+// TestRecordBody tests that bodies are mirrored up to the maximum size when enabled.
+func TestRecordBody(t *testing.T) {
+	writer := &recordingWriter{}
+	m := mirror.New(writer, 0, mirror.WithBody(4))
+	m.Record(httptest.NewRequest(http.MethodPost, "/", strings.NewReader("abcdefgh")), "api", "client1", http.StatusForbidden)
+	m.Record(httptest.NewRequest(http.MethodPost, "/", strings.NewReader("abc")), "api", "client1", http.StatusForbidden)
+	m.Close()
+
+	if len(writer.requests) != 2 {
+		t.Fatalf("Expected 2 mirrored requests, got %d", len(writer.requests))
+	}
+	if got := writer.requests[0]; got.Body != "abcd" || !got.BodyTruncated {
+		t.Errorf("Expected a truncated body, got %q (truncated %v)", got.Body, got.BodyTruncated)
+	}
+	if got := writer.requests[1]; got.Body != "abc" || got.BodyTruncated {
+		t.Errorf("Expected the whole body, got %q (truncated %v)", got.Body, got.BodyTruncated)
+	}
+}
+
+// TestHTTPWriter tests that batches are posted to the endpoint as JSON lines.
+func TestHTTPWriter(t *testing.T) {
+	var mu sync.Mutex
+	var received []mirror.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("Expected JSON lines, got content type %q", ct)
+		}
+		scanner := bufio.NewScanner(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		for scanner.Scan() {
+			var req mirror.Request
+			if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+				t.Errorf("Failed to decode mirrored request: %v", err)
+			}
+			received = append(received, req)
+		}
+	}))
+	defer server.Close()
+
+	m := mirror.New(mirror.NewHTTPWriter(server.URL, time.Second), 0)
+	for _, path := range []string{"/a", "/b"} {
+		m.Record(httptest.NewRequest(http.MethodGet, path, nil), "api", "client1", http.StatusTooManyRequests)
+	}
+	m.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 || received[0].Path != "/a" || received[1].Path != "/b" {
+		t.Errorf("Expected both requests posted in order, got %+v", received)
+	}
+}
@@ -0,0 +1,38 @@
+package mirror
+
+import (
+	"net/http"
+
+	"learn.ratelimiter/redact"
+)
+
+// redacted replaces the values of redacted headers.
+const redacted = "[REDACTED]"
+
+// DefaultRedactedHeaders are headers carrying credentials, redacted by RedactHeaders in addition to those it is given.
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-API-Key"}
+
+// RedactHeaders returns a redactor replacing the values of the given headers and DefaultRedactedHeaders.
+func RedactHeaders(names ...string) RedactFunc {
+	canonical := make([]string, 0, len(DefaultRedactedHeaders)+len(names))
+	for _, name := range append(append([]string(nil), DefaultRedactedHeaders...), names...) {
+		canonical = append(canonical, http.CanonicalHeaderKey(name))
+	}
+	return func(req *Request) {
+		for _, name := range canonical {
+			if _, ok := req.Headers[name]; ok {
+				req.Headers[name] = []string{redacted}
+			}
+		}
+	}
+}
+
+// RedactIdentifiers returns a redactor hiding the identifier and remote address as logs do (see redact.SetMode).
+func RedactIdentifiers() RedactFunc {
+	return func(req *Request) {
+		req.Identifier = redact.Identifier(req.Identifier)
+		if req.RemoteAddr != "" {
+			req.RemoteAddr = redact.Addr(req.RemoteAddr)
+		}
+	}
+}
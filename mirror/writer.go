@@ -0,0 +1,113 @@
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// HTTPWriter POSTs each batch of requests to an endpoint as JSON lines (application/x-ndjson).
+type HTTPWriter struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPWriter creates a writer posting to url, giving up on each batch after timeout.
+func NewHTTPWriter(url string, timeout time.Duration) *HTTPWriter {
+	return &HTTPWriter{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// Write posts the requests and checks that the endpoint accepted them.
+func (w *HTTPWriter) Write(ctx context.Context, requests []Request) error {
+	var body bytes.Buffer
+	if err := writeJSONLines(&body, w.url, requests); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, &body)
+	if err != nil {
+		return fmt.Errorf("create mirror request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post mirrored requests: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("mirror endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close releases idle connections to the endpoint.
+func (w *HTTPWriter) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+// FileWriter appends requests to a file as JSON lines.
+type FileWriter struct {
+	path string
+	file *os.File
+}
+
+// NewFileWriter opens (or creates) the file at path for appending.
+func NewFileWriter(path string) (*FileWriter, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open mirror file '%s': %w", path, err)
+	}
+	return &FileWriter{path: path, file: file}, nil
+}
+
+// Write appends the requests to the file, one JSON object per line.
+func (w *FileWriter) Write(_ context.Context, requests []Request) error {
+	return writeJSONLines(w.file, w.path, requests)
+}
+
+// Close closes the file.
+func (w *FileWriter) Close() error {
+	return w.file.Close()
+}
+
+// StreamWriter writes requests as JSON lines to a stream it does not own, such as standard output.
+type StreamWriter struct {
+	name string
+	out  io.Writer
+}
+
+// NewStreamWriter creates a writer of JSON lines to out, named name in errors.
+func NewStreamWriter(out io.Writer, name string) *StreamWriter {
+	return &StreamWriter{name: name, out: out}
+}
+
+// Write writes the requests to the stream, one JSON object per line.
+func (w *StreamWriter) Write(_ context.Context, requests []Request) error {
+	return writeJSONLines(w.out, w.name, requests)
+}
+
+// Close does nothing, since the stream is owned by the caller.
+func (w *StreamWriter) Close() error {
+	return nil
+}
+
+// writeJSONLines writes the requests to out through a buffer, one JSON object per line.
+func writeJSONLines(out io.Writer, name string, requests []Request) error {
+	buf := bufio.NewWriter(out)
+	encoder := json.NewEncoder(buf)
+	for _, req := range requests {
+		if err := encoder.Encode(req); err != nil {
+			return fmt.Errorf("write mirrored requests to '%s': %w", name, err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("write mirrored requests to '%s': %w", name, err)
+	}
+	return nil
+}
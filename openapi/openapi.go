@@ -0,0 +1,189 @@
+// Package openapi serves the OpenAPI 3 document describing the admin API and the check API (peers.Path), so client
+// SDKs and internal portals can be generated from it, and validates requests against the same document.
+//
+// Validation supports the subset of schemas the document uses: type, properties, required, items, enum, minimum
+// (with exclusiveMinimum), minLength, pattern, anyOf, $ref to components, and the date-time and duration
+// (Go duration syntax) formats. Handlers keep checking what the document cannot express.
+package openapi
+
+import (
+	"bytes"
+	_ "embed" // Embed the OpenAPI document
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Path is the path the document is usually served at.
+const Path = "/openapi.json"
+
+// maxBodyBytes caps the size of a request body read for validation.
+const maxBodyBytes = 32 << 20
+
+//go:embed openapi.json
+var document []byte
+
+// spec is the parsed document, reduced to what validation needs.
+var spec = mustParse(document)
+
+// Document returns the OpenAPI document as JSON.
+func Document() []byte {
+	return bytes.Clone(document)
+}
+
+// Handler serves the OpenAPI document.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(document)
+	})
+}
+
+// Validate checks requests for operations described by the document before passing them to next: required and typed
+// query parameters, and JSON request bodies. Invalid requests are answered with 400 Bad Request and a JSON error body.
+// Requests for paths or methods the document does not describe are passed unchanged, for next to answer.
+func Validate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, ok := spec.operation(r.Method, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := op.validate(r); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// openAPI is the part of an OpenAPI document used for validation.
+type openAPI struct {
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Parameters map[string]*parameter `json:"parameters"`
+		Schemas    map[string]*schema    `json:"schemas"`
+	} `json:"components"`
+}
+
+// operation is one method of a path.
+type operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*parameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool                  `json:"required"`
+		Content  map[string]*mediaType `json:"content"`
+	} `json:"requestBody"`
+}
+
+// parameter is a query parameter, or a reference to one.
+type parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+// mediaType is the schema of a request body in one content type.
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+// mustParse parses the document and resolves parameter references, panicking on a malformed document.
+func mustParse(data []byte) *openAPI {
+	var doc openAPI
+	if err := json.Unmarshal(data, &doc); err != nil {
+		panic(fmt.Sprintf("openapi: invalid document: %v", err))
+	}
+	for _, methods := range doc.Paths {
+		for _, op := range methods {
+			for i, param := range op.Parameters {
+				if param.Ref == "" {
+					continue
+				}
+				resolved, ok := doc.Components.Parameters[strings.TrimPrefix(param.Ref, "#/components/parameters/")]
+				if !ok {
+					panic(fmt.Sprintf("openapi: unresolved parameter %s", param.Ref))
+				}
+				op.Parameters[i] = resolved
+			}
+		}
+	}
+	return &doc
+}
+
+// operation returns the operation serving the method and path.
+func (doc *openAPI) operation(method, path string) (*operation, bool) {
+	op, ok := doc.Paths[path][strings.ToLower(method)]
+	return op, ok
+}
+
+// validate checks the query parameters and the JSON body of the request.
+func (op *operation) validate(r *http.Request) error {
+	query := r.URL.Query()
+	for _, param := range op.Parameters {
+		if param.In != "query" {
+			continue
+		}
+		if !query.Has(param.Name) {
+			if param.Required {
+				return fmt.Errorf("query parameter %s is required", param.Name)
+			}
+			continue
+		}
+		if err := param.Schema.validateParameter(query.Get(param.Name)); err != nil {
+			return fmt.Errorf("query parameter %s: %w", param.Name, err)
+		}
+	}
+	return op.validateBody(r)
+}
+
+// validateBody checks a JSON request body, leaving the body readable by the next handler.
+// Bodies in other content types the operation accepts (e.g., CSV) are not checked.
+func (op *operation) validateBody(r *http.Request) error {
+	if op.RequestBody == nil {
+		return nil
+	}
+	contentType := "application/json"
+	if header := r.Header.Get("Content-Type"); header != "" {
+		contentType, _, _ = mime.ParseMediaType(header)
+	} else if len(op.RequestBody.Content) > 1 {
+		// Without a content type, a body the operation accepts in several types is not assumed to be JSON
+		return nil
+	}
+	media, ok := op.RequestBody.Content[contentType]
+	if !ok || contentType != "application/json" {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+	if len(body) > maxBodyBytes {
+		return errors.New("request body too large")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return errors.New("request body is required")
+		}
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	if err := media.Schema.validate(value, "body"); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
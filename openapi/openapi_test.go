@@ -0,0 +1,136 @@
+// Package openapi_test contains tests for the OpenAPI document and request validation.
+package openapi_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/admin"
+	"learn.ratelimiter/banlist"
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/connregistry"
+	"learn.ratelimiter/denialreport"
+	"learn.ratelimiter/faults"
+	fcinmemory "learn.ratelimiter/internal/fixedcounter/inmemory"
+	"learn.ratelimiter/openapi"
+	"learn.ratelimiter/overrides"
+	"learn.ratelimiter/peers"
+	"learn.ratelimiter/readonly"
+	"learn.ratelimiter/types"
+)
+
+// TestDocumentRoutes tests that every admin operation of the document is served by the admin handler.
+func TestDocumentRoutes(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openapi.Document(), &doc); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+	if _, ok := doc.Paths[peers.Path]["post"]; !ok {
+		t.Errorf("Expected the check API at %s in the document", peers.Path)
+	}
+
+	table := overrides.NewTable(overrides.NewMemoryStore(), time.Hour)
+	defer table.Close()
+	limiters := map[string]types.Limiter{"api": fcinmemory.NewLimiter("api", time.Minute, 1)}
+	registry := connregistry.New(nil)
+	denials := denialreport.New(config.DenialReportConfig{})
+	defer denials.Close()
+	handler := admin.NewHandler(banlist.New(), admin.NewMemoryAuditSink(0), admin.WithOverrides(table), admin.WithLimiters(limiters), admin.WithBackends(registry), admin.WithReadOnly(readonly.New()), admin.WithFaults(faults.New()), admin.WithDenialReports(denials), admin.WithVersion(admin.VersionInfo{}))
+	for path, methods := range doc.Paths {
+		if !strings.HasPrefix(path, "/admin/") {
+			continue
+		}
+		for method := range methods {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(strings.ToUpper(method), path, strings.NewReader("[]")))
+			// The mux answers unknown routes in plain text; handlers answer errors in JSON
+			if rec.Code == http.StatusMethodNotAllowed || rec.Body.String() == "404 page not found\n" {
+				t.Errorf("%s %s is in the document but not served (%d)", strings.ToUpper(method), path, rec.Code)
+			}
+		}
+	}
+}
+
+// TestValidate tests that requests are checked against the document before reaching the handler.
+func TestValidate(t *testing.T) {
+	var received string
+	handler := openapi.Validate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"valid ban", http.MethodPost, "/admin/bans", "", `{"limiter_key":"api","identifier":"1.2.3.4","ttl":"1h"}`, http.StatusOK},
+		{"ban without identifier", http.MethodPost, "/admin/bans", "application/json", `{"limiter_key":"api"}`, http.StatusBadRequest},
+		{"ban with empty identifier", http.MethodPost, "/admin/bans", "", `{"limiter_key":"api","identifier":""}`, http.StatusBadRequest},
+		{"ban with invalid ttl", http.MethodPost, "/admin/bans", "", `{"limiter_key":"api","identifier":"x","ttl":"soon"}`, http.StatusBadRequest},
+		{"ban with wrong type", http.MethodPost, "/admin/bans", "", `{"limiter_key":1,"identifier":"x"}`, http.StatusBadRequest},
+		{"ban without body", http.MethodPost, "/admin/bans", "", ``, http.StatusBadRequest},
+		{"ban with malformed body", http.MethodPost, "/admin/bans", "", `{`, http.StatusBadRequest},
+		{"override with zero multiplier", http.MethodPost, "/admin/overrides", "", `{"limiter_key":"api","identifier":"x","multiplier":0}`, http.StatusBadRequest},
+		{"valid override", http.MethodPost, "/admin/overrides", "", `{"limiter_key":"api","identifier":"x","multiplier":2.5}`, http.StatusOK},
+		{"unban without identifier", http.MethodDelete, "/admin/bans?limiter_key=api", "", ``, http.StatusBadRequest},
+		{"valid unban", http.MethodDelete, "/admin/bans?limiter_key=api&identifier=x", "", ``, http.StatusOK},
+		{"audit with invalid limit", http.MethodGet, "/admin/audit?limit=abc", "", ``, http.StatusBadRequest},
+		{"audit with zero limit", http.MethodGet, "/admin/audit?limit=0", "", ``, http.StatusBadRequest},
+		{"audit with unknown action", http.MethodGet, "/admin/audit?action=explode", "", ``, http.StatusBadRequest},
+		{"audit with invalid since", http.MethodGet, "/admin/audit?since=yesterday", "", ``, http.StatusBadRequest},
+		{"valid audit query", http.MethodGet, "/admin/audit?action=ban&since=2024-01-01T00:00:00Z&limit=10", "", ``, http.StatusOK},
+		{"export with unknown format", http.MethodGet, "/admin/bans/export?format=xml", "", ``, http.StatusBadRequest},
+		{"CSV import", http.MethodPost, "/admin/bans/import?format=csv", "text/csv", "limiter_key,identifier,expires_at\n", http.StatusOK},
+		{"JSON import with invalid entry", http.MethodPost, "/admin/bans/import", "application/json", `[{"limiter_key":"api"}]`, http.StatusBadRequest},
+		{"checks with quoted integers", http.MethodPost, peers.Path, "", `{"requests":[{"name":"api","unique_key":"x","hits":"2","limit":10}]}`, http.StatusOK},
+		{"checks with invalid hits", http.MethodPost, peers.Path, "", `{"requests":[{"name":"api","unique_key":"x","hits":true}]}`, http.StatusBadRequest},
+		{"undocumented path", http.MethodGet, "/admin/unknown?limit=abc", "", ``, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Fatalf("Expected %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+			if tt.want == http.StatusOK && received != tt.body {
+				t.Errorf("Expected the handler to read the body %q, got %q", tt.body, received)
+			}
+			if tt.want == http.StatusBadRequest && !strings.Contains(rec.Body.String(), `"error"`) {
+				t.Errorf("Expected a JSON error body, got %s", rec.Body)
+			}
+		})
+	}
+}
+
+// TestHandler tests that the document is served as JSON.
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	openapi.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, openapi.Path, nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", ct)
+	}
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil || !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got %q (%v)", doc.OpenAPI, err)
+	}
+}
@@ -0,0 +1,184 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// schema is the subset of an OpenAPI schema object used by the document.
+type schema struct {
+	Ref              string             `json:"$ref"`
+	Type             string             `json:"type"`
+	Format           string             `json:"format"`
+	Properties       map[string]*schema `json:"properties"`
+	Required         []string           `json:"required"`
+	Items            *schema            `json:"items"`
+	Enum             []any              `json:"enum"`
+	Minimum          *float64           `json:"minimum"`
+	ExclusiveMinimum bool               `json:"exclusiveMinimum"`
+	MinLength        int                `json:"minLength"`
+	Pattern          string             `json:"pattern"`
+	AnyOf            []*schema          `json:"anyOf"`
+}
+
+// resolve follows the schema's reference to a component schema, if it has one.
+func (s *schema) resolve() (*schema, error) {
+	if s.Ref == "" {
+		return s, nil
+	}
+	resolved, ok := spec.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	if !ok {
+		return nil, fmt.Errorf("unresolved schema %s", s.Ref)
+	}
+	return resolved, nil
+}
+
+// validate checks a decoded JSON value (numbers as json.Number) against the schema. at names the value in errors.
+func (s *schema) validate(value any, at string) error {
+	s, err := s.resolve()
+	if err != nil {
+		return err
+	}
+	if len(s.AnyOf) > 0 {
+		for _, alternative := range s.AnyOf {
+			if alternative.validate(value, at) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s does not match any of the allowed types", at)
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(allowed any) bool { return fmt.Sprint(allowed) == fmt.Sprint(value) }) {
+		return fmt.Errorf("%s must be one of %v", at, s.Enum)
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", at)
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s.%s is required", at, name)
+			}
+		}
+		for name, property := range s.Properties {
+			if v, ok := object[name]; ok {
+				if err := property.validate(v, at+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s must be an array", at)
+		}
+		if s.Items != nil {
+			for i, item := range array {
+				if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", at)
+		}
+		return s.validateString(str, at)
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s must be a %s", at, s.Type)
+		}
+		return s.validateNumber(string(number), at)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", at)
+		}
+	}
+	return nil
+}
+
+// validateParameter checks the value of a query parameter, parsed as the schema's type.
+func (s *schema) validateParameter(value string) error {
+	s, err := s.resolve()
+	if err != nil {
+		return err
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(allowed any) bool { return fmt.Sprint(allowed) == value }) {
+		return fmt.Errorf("must be one of %v", s.Enum)
+	}
+	switch s.Type {
+	case "integer", "number":
+		return s.validateNumber(value, "value")
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+	case "string":
+		return s.validateString(value, "value")
+	}
+	return nil
+}
+
+// validateString checks the length, pattern and format of a string.
+func (s *schema) validateString(value, at string) error {
+	if utf8.RuneCountInString(value) < s.MinLength {
+		if s.MinLength == 1 {
+			return fmt.Errorf("%s must not be empty", at)
+		}
+		return fmt.Errorf("%s must have at least %d characters", at, s.MinLength)
+	}
+	if s.Pattern != "" {
+		matched, err := regexp.MatchString(s.Pattern, value)
+		if err != nil {
+			return fmt.Errorf("invalid pattern for %s: %w", at, err)
+		}
+		if !matched {
+			return fmt.Errorf("%s must match %s", at, s.Pattern)
+		}
+	}
+	switch s.Format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return fmt.Errorf("%s must be an RFC 3339 time", at)
+		}
+	case "duration":
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("%s must be a duration (e.g., 1h)", at)
+		}
+	}
+	return nil
+}
+
+// validateNumber checks that a number has the schema's type and is within its minimum.
+func (s *schema) validateNumber(value, at string) error {
+	if s.Type == "integer" {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("%s must be an integer", at)
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%s must be a number", at)
+	}
+	if s.Minimum != nil {
+		if s.ExclusiveMinimum && n <= *s.Minimum {
+			return fmt.Errorf("%s must be greater than %v", at, *s.Minimum)
+		}
+		if n < *s.Minimum {
+			return fmt.Errorf("%s must be at least %v", at, *s.Minimum)
+		}
+	}
+	return nil
+}
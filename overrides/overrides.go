@@ -0,0 +1,286 @@
+// Package overrides provides per-identifier limit overrides (e.g., "give customer X 5x the limit for 24h"),
+// kept in a store shared by all instances and cached locally so checking them costs no backend call.
+package overrides
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+)
+
+// Override multiplies a limiter's parameters for one identifier, optionally until it expires.
+type Override struct {
+	// LimiterKey is the key of the limiter the override applies to.
+	LimiterKey string `json:"limiter_key"`
+	// Identifier is the identifier (e.g., customer ID) whose limit is overridden.
+	Identifier string `json:"identifier"`
+	// Multiplier scales the limiter's limits, rates and capacities for the identifier (e.g., 5 for five times the limit).
+	Multiplier float64 `json:"multiplier"`
+	// ExpiresAt is when the override reverts; the zero value means the override is permanent.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the override has reverted at the given time.
+func (o Override) Expired(now time.Time) bool {
+	return !o.ExpiresAt.IsZero() && !now.Before(o.ExpiresAt)
+}
+
+// Remaining returns how long the override still applies at the given time, or 0 if it is permanent or expired.
+func (o Override) Remaining(now time.Time) time.Duration {
+	if o.ExpiresAt.IsZero() {
+		return 0
+	}
+	return max(o.ExpiresAt.Sub(now), 0)
+}
+
+// entryKey identifies an override in the local cache.
+type entryKey struct {
+	limiterKey string
+	identifier string
+}
+
+// Table caches the overrides of a store locally. Changes made through the table are applied to the store and the cache at once;
+// changes made by other instances are picked up by periodic refreshes. Expired overrides stop applying immediately.
+type Table struct {
+	store           Store
+	refreshInterval time.Duration
+
+	// current is replaced, never modified, so lookups need no lock.
+	current atomic.Pointer[map[entryKey]Override]
+	// mu serializes changes to the cache.
+	mu        sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewTable creates a table caching the overrides of store, refreshed every refreshInterval once started.
+func NewTable(store Store, refreshInterval time.Duration) *Table {
+	t := &Table{
+		store:           store,
+		refreshInterval: refreshInterval,
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+	t.current.Store(&map[entryKey]Override{})
+	return t
+}
+
+// Start loads the overrides and keeps refreshing them in the background until Close is called.
+// A failed initial load is logged; the table starts empty and retries on the next refresh.
+func (t *Table) Start() {
+	t.startOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), t.refreshInterval)
+		if err := t.Refresh(ctx); err != nil {
+			log.Warn().Err(err).Msg("Overrides: Initial load failed, starting without overrides")
+		}
+		cancel()
+		log.Info().Dur("refresh_interval", t.refreshInterval).Msg("Overrides: Starting override refresh")
+		go t.run()
+	})
+}
+
+// run refreshes the cache on every tick until stopped.
+func (t *Table) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), t.refreshInterval)
+			if err := t.Refresh(ctx); err != nil {
+				log.Warn().Err(err).Msg("Overrides: Refresh failed, keeping the cached overrides")
+			}
+			cancel()
+		}
+	}
+}
+
+// Refresh replaces the cache with the overrides currently in the store.
+func (t *Table) Refresh(ctx context.Context) error {
+	overrides, err := t.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	entries := make(map[entryKey]Override, len(overrides))
+	for _, o := range overrides {
+		entries[entryKey{o.LimiterKey, o.Identifier}] = o
+	}
+	t.mu.Lock()
+	t.current.Store(&entries)
+	t.mu.Unlock()
+	return nil
+}
+
+// Multiplier returns the multiplier of the identifier's active override for the limiter, with false if there is none.
+func (t *Table) Multiplier(limiterKey, identifier string) (float64, bool) {
+	o, ok := (*t.current.Load())[entryKey{limiterKey, identifier}]
+	if !ok || o.Expired(time.Now()) {
+		return 0, false
+	}
+	return o.Multiplier, true
+}
+
+// Multipliers returns the multipliers of the active overrides for the limiter.
+func (t *Table) Multipliers(limiterKey string) map[float64]bool {
+	now := time.Now()
+	multipliers := make(map[float64]bool)
+	for _, o := range *t.current.Load() {
+		if o.LimiterKey == limiterKey && !o.Expired(now) {
+			multipliers[o.Multiplier] = true
+		}
+	}
+	return multipliers
+}
+
+// Set stores the override, replacing any override for the same limiter and identifier.
+// It returns the override it replaced, with false if there was no active one.
+func (t *Table) Set(ctx context.Context, o Override) (Override, bool, error) {
+	if err := t.store.Set(ctx, o); err != nil {
+		return Override{}, false, err
+	}
+	previous, existed := t.update(entryKey{o.LimiterKey, o.Identifier}, &o)
+	return previous, existed && !previous.Expired(time.Now()), nil
+}
+
+// Delete removes the identifier's override for the limiter.
+// It returns the removed override, with false if there was no active one.
+func (t *Table) Delete(ctx context.Context, limiterKey, identifier string) (Override, bool, error) {
+	if err := t.store.Delete(ctx, limiterKey, identifier); err != nil {
+		return Override{}, false, err
+	}
+	previous, existed := t.update(entryKey{limiterKey, identifier}, nil)
+	return previous, existed && !previous.Expired(time.Now()), nil
+}
+
+// Merge stores the unexpired overrides, replacing any for the same limiters and identifiers.
+// It returns the number of overrides stored, which are all applied to the cache even if storing a later one fails.
+func (t *Table) Merge(ctx context.Context, entries []Override) (int, error) {
+	now := time.Now()
+	var stored []Override
+	var err error
+	for _, o := range entries {
+		if o.Expired(now) {
+			continue
+		}
+		if err = t.store.Set(ctx, o); err != nil {
+			break
+		}
+		stored = append(stored, o)
+	}
+	t.apply(stored, nil)
+	return len(stored), err
+}
+
+// Replace replaces all overrides with the unexpired ones among entries, e.g., to sync overrides from another
+// environment. It returns the number of overrides stored and the number of active overrides removed because they
+// are not among the entries.
+func (t *Table) Replace(ctx context.Context, entries []Override) (int, int, error) {
+	current, err := t.store.List(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	now := time.Now()
+	kept := make(map[entryKey]bool, len(entries))
+	for _, o := range entries {
+		kept[entryKey{o.LimiterKey, o.Identifier}] = !o.Expired(now)
+	}
+	var removed []entryKey
+	for _, o := range current {
+		key := entryKey{o.LimiterKey, o.Identifier}
+		if kept[key] {
+			continue
+		}
+		if err := t.store.Delete(ctx, o.LimiterKey, o.Identifier); err != nil {
+			t.apply(nil, removed)
+			return 0, len(removed), err
+		}
+		removed = append(removed, key)
+	}
+	t.apply(nil, removed)
+	imported, err := t.Merge(ctx, entries)
+	return imported, len(removed), err
+}
+
+// apply copies the cache with the overrides set and the keys removed.
+func (t *Table) apply(set []Override, removed []entryKey) {
+	if len(set) == 0 && len(removed) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	current := *t.current.Load()
+	entries := make(map[entryKey]Override, len(current)+len(set))
+	for k, v := range current {
+		entries[k] = v
+	}
+	for _, key := range removed {
+		delete(entries, key)
+	}
+	for _, o := range set {
+		entries[entryKey{o.LimiterKey, o.Identifier}] = o
+	}
+	t.current.Store(&entries)
+}
+
+// update copies the cache with the entry replaced (or removed if o is nil) and returns the previous entry.
+func (t *Table) update(key entryKey, o *Override) (Override, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	current := *t.current.Load()
+	previous, existed := current[key]
+	entries := make(map[entryKey]Override, len(current)+1)
+	for k, v := range current {
+		entries[k] = v
+	}
+	if o != nil {
+		entries[key] = *o
+	} else {
+		delete(entries, key)
+	}
+	t.current.Store(&entries)
+	return previous, existed
+}
+
+// Entries returns the active overrides for the limiter, or for all limiters if limiterKey is empty,
+// sorted by limiter key and identifier.
+func (t *Table) Entries(limiterKey string) []Override {
+	now := time.Now()
+	var entries []Override
+	for _, o := range *t.current.Load() {
+		if (limiterKey == "" || o.LimiterKey == limiterKey) && !o.Expired(now) {
+			entries = append(entries, o)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].LimiterKey != entries[j].LimiterKey {
+			return entries[i].LimiterKey < entries[j].LimiterKey
+		}
+		return entries[i].Identifier < entries[j].Identifier
+	})
+	return entries
+}
+
+// Close stops background refreshes and closes the store if it implements io.Closer.
+// It is safe to call more than once, and before Start.
+func (t *Table) Close() error {
+	var err error
+	t.stopOnce.Do(func() {
+		close(t.stop)
+		t.startOnce.Do(func() { close(t.done) })
+		<-t.done
+		if closer, ok := t.store.(io.Closer); ok {
+			err = closer.Close()
+		}
+	})
+	return err
+}
@@ -0,0 +1,59 @@
+// Package overrides_test contains tests for per-identifier overrides.
+package overrides_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/overrides"
+)
+
+// TestTableSharedStore tests that overrides set on one instance reach another on refresh and stop applying once expired.
+func TestTableSharedStore(t *testing.T) {
+	ctx := context.Background()
+	store := overrides.NewMemoryStore()
+	local := overrides.NewTable(store, time.Hour)
+	remote := overrides.NewTable(store, time.Hour)
+	defer local.Close()
+	defer remote.Close()
+
+	if _, _, err := local.Set(ctx, overrides.Override{LimiterKey: "api", Identifier: "customer-x", Multiplier: 5}); err != nil {
+		t.Fatalf("Failed to set override: %v", err)
+	}
+	if _, _, err := local.Set(ctx, overrides.Override{LimiterKey: "api", Identifier: "customer-y", Multiplier: 2, ExpiresAt: time.Now().Add(50 * time.Millisecond)}); err != nil {
+		t.Fatalf("Failed to set override: %v", err)
+	}
+	if multiplier, ok := local.Multiplier("api", "customer-x"); !ok || multiplier != 5 {
+		t.Errorf("Expected multiplier 5 on the local instance, got %v (%v)", multiplier, ok)
+	}
+	if _, ok := remote.Multiplier("api", "customer-x"); ok {
+		t.Error("Expected the remote instance not to see the override before refreshing")
+	}
+
+	if err := remote.Refresh(ctx); err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	if multiplier, ok := remote.Multiplier("api", "customer-x"); !ok || multiplier != 5 {
+		t.Errorf("Expected multiplier 5 on the remote instance after refresh, got %v (%v)", multiplier, ok)
+	}
+	if _, ok := remote.Multiplier("login", "customer-x"); ok {
+		t.Error("Expected the override to apply to its limiter only")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := remote.Multiplier("api", "customer-y"); ok {
+		t.Error("Expected the expired override to revert without a refresh")
+	}
+	if entries := remote.Entries("api"); len(entries) != 1 || entries[0].Identifier != "customer-x" {
+		t.Errorf("Expected only the permanent override to be listed, got %+v", entries)
+	}
+
+	if _, ok, err := local.Delete(ctx, "api", "customer-x"); err != nil || !ok {
+		t.Fatalf("Expected override to be deleted, got %v (%v)", ok, err)
+	}
+	remote.Refresh(ctx)
+	if _, ok := remote.Multiplier("api", "customer-x"); ok {
+		t.Error("Expected the deleted override to be gone after refresh")
+	}
+}
@@ -0,0 +1,133 @@
+package overrides
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/internal/redisscripts"
+)
+
+// Store persists overrides. Expired overrides may be kept by the store but are never returned.
+type Store interface {
+	// Set stores the override, replacing any override for the same limiter and identifier.
+	Set(ctx context.Context, o Override) error
+	// Delete removes the identifier's override for the limiter, if any.
+	Delete(ctx context.Context, limiterKey, identifier string) error
+	// List returns all active overrides.
+	List(ctx context.Context) ([]Override, error)
+}
+
+// MemoryStore is a Store kept in process memory, so overrides apply only to the instance they were set on.
+type MemoryStore struct {
+	mu        sync.Mutex
+	overrides map[entryKey]Override
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{overrides: make(map[entryKey]Override)}
+}
+
+// Set stores the override.
+func (s *MemoryStore) Set(_ context.Context, o Override) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.overrides[entryKey{o.LimiterKey, o.Identifier}] = o
+	return nil
+}
+
+// Delete removes the override, if any.
+func (s *MemoryStore) Delete(_ context.Context, limiterKey, identifier string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.overrides, entryKey{limiterKey, identifier})
+	return nil
+}
+
+// List returns the active overrides, removing expired ones.
+func (s *MemoryStore) List(_ context.Context) ([]Override, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	overrides := make([]Override, 0, len(s.overrides))
+	for key, o := range s.overrides {
+		if o.Expired(now) {
+			delete(s.overrides, key)
+			continue
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
+
+// RedisKey is the Redis hash holding all overrides.
+const RedisKey = "ratelimiter:overrides"
+
+// RedisStore is a Store kept in a Redis hash shared by all instances.
+// Each field identifies a limiter and identifier and holds the override as JSON.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a store in the given Redis instance.
+// The store takes ownership of the client and closes it on Close.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Close closes the Redis client.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// field returns the hash field of the identifier's override for the limiter.
+// Both parts are JSON encoded so neither can contain the separator.
+func field(limiterKey, identifier string) string {
+	data, _ := json.Marshal([2]string{limiterKey, identifier})
+	return string(data)
+}
+
+// Set stores the override in the hash.
+func (s *RedisStore) Set(ctx context.Context, o Override) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, RedisKey, field(o.LimiterKey, o.Identifier), data).Err()
+}
+
+// Delete removes the override from the hash.
+func (s *RedisStore) Delete(ctx context.Context, limiterKey, identifier string) error {
+	return s.client.HDel(ctx, RedisKey, field(limiterKey, identifier)).Err()
+}
+
+// List returns the active overrides in the hash and removes expired ones.
+func (s *RedisStore) List(ctx context.Context) ([]Override, error) {
+	fields, err := s.client.HGetAll(ctx, RedisKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	overrides := make([]Override, 0, len(fields))
+	for f, value := range fields {
+		var o Override
+		if err := json.Unmarshal([]byte(value), &o); err != nil {
+			log.Warn().Err(err).Str("field", f).Msg("Overrides: Skipping malformed override")
+			continue
+		}
+		if o.Expired(now) {
+			// Best effort cleanup; the field is only removed if no instance replaced the override meanwhile
+			if err := redisscripts.OverridesDeleteIfUnchanged.Run(ctx, s.client, []string{RedisKey}, f, value).Err(); err != nil {
+				log.Debug().Err(err).Str("field", f).Msg("Overrides: Failed to remove expired override")
+			}
+			continue
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
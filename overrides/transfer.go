@@ -0,0 +1,108 @@
+package overrides
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"learn.ratelimiter/banlist"
+)
+
+// The formats of bulk import and export are those of bans (see banlist.Format). The CSV format has the header row
+// limiter_key,identifier,multiplier,expires_at, where expires_at is an RFC 3339 time or empty for permanent overrides.
+
+// csvHeader is the header row of the CSV format.
+var csvHeader = []string{"limiter_key", "identifier", "multiplier", "expires_at"}
+
+// Export writes the overrides to w in the given format.
+func Export(w io.Writer, entries []Override, format banlist.Format) error {
+	if format != banlist.FormatCSV {
+		if entries == nil {
+			entries = []Override{}
+		}
+		return json.NewEncoder(w).Encode(entries)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, o := range entries {
+		expiresAt := ""
+		if !o.ExpiresAt.IsZero() {
+			expiresAt = o.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		multiplier := strconv.FormatFloat(o.Multiplier, 'g', -1, 64)
+		if err := cw.Write([]string{o.LimiterKey, o.Identifier, multiplier, expiresAt}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Import reads overrides in the given format from r. Every override must have a limiter key, an identifier and a
+// positive multiplier.
+func Import(r io.Reader, format banlist.Format) ([]Override, error) {
+	var entries []Override
+	if format != banlist.FormatCSV {
+		if err := json.NewDecoder(r).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		for i, o := range entries {
+			if err := validate(o); err != nil {
+				return nil, fmt.Errorf("entry %d: %w", i+1, err)
+			}
+		}
+		return entries, nil
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+	for i, column := range csvHeader {
+		if header[i] != column {
+			return nil, fmt.Errorf("invalid CSV header: expected column %d to be '%s', got '%s'", i+1, column, header[i])
+		}
+	}
+	for row := 2; ; row++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		o := Override{LimiterKey: record[0], Identifier: record[1]}
+		if o.Multiplier, err = strconv.ParseFloat(record[2], 64); err != nil {
+			return nil, fmt.Errorf("row %d: invalid multiplier '%s'", row, record[2])
+		}
+		if record[3] != "" {
+			if o.ExpiresAt, err = time.Parse(time.RFC3339, record[3]); err != nil {
+				return nil, fmt.Errorf("row %d: invalid expires_at '%s'", row, record[3])
+			}
+		}
+		if err := validate(o); err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+		entries = append(entries, o)
+	}
+}
+
+// validate checks that the override has a limiter key, an identifier and a positive multiplier.
+func validate(o Override) error {
+	if o.LimiterKey == "" || o.Identifier == "" {
+		return errors.New("limiter_key and identifier are required")
+	}
+	if !(o.Multiplier > 0) {
+		return errors.New("multiplier must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package peers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/metrics"
+	"learn.ratelimiter/redact"
+	"learn.ratelimiter/types"
+)
+
+// maxRequestBytes bounds the size of a GetRateLimits request body.
+const maxRequestBytes = 1 << 20
+
+// Node is this instance's member of the peer group. It decides checks it owns with its local limiters, forwards the
+// others to their owner, and serves checks forwarded by peers (and Gubernator HTTP clients) at Path.
+type Node struct {
+	self     string
+	ring     *Ring
+	client   *http.Client
+	failOpen bool
+	// secret is the bearer token sent with forwarded checks, and secretDigest its digest checked on served ones.
+	secret       string
+	secretDigest [sha256.Size]byte
+
+	mu       sync.RWMutex
+	limiters map[string]types.Limiter
+}
+
+// NewNode creates the node for this instance from cfg, initially with the static peer list.
+// Until a peer list is set, e.g., by discovery, every check is decided locally.
+// Checks are only served to requests carrying the peers' secret; without a secret, none are.
+func NewNode(cfg config.PeersConfig) *Node {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = config.DefaultPeerTimeout
+	}
+	self := cfg.LocalAddress()
+	secret := cfg.Secret()
+	log.Info().Str("self", self).Strs("peers", cfg.Static).Dur("timeout", timeout).Str("failure_mode", string(cfg.FailureMode)).Msg("Peers: Joined peer group")
+	return &Node{
+		self:         self,
+		ring:         NewRing(cfg.Static),
+		client:       &http.Client{Timeout: timeout},
+		failOpen:     cfg.FailureMode == config.FailOpen,
+		secret:       secret,
+		secretDigest: sha256.Sum256([]byte(secret)),
+		limiters:     make(map[string]types.Limiter),
+	}
+}
+
+// SetPeers replaces the peer addresses, e.g., when discovery reports a change.
+func (n *Node) SetPeers(peers []string) {
+	n.ring.SetPeers(peers)
+	log.Info().Strs("peers", peers).Msg("Peers: Peer list updated")
+}
+
+// Peers returns the current peer addresses.
+func (n *Node) Peers() []string {
+	return n.ring.Peers()
+}
+
+// Owner returns the address of the peer deciding checks for the identifier under the limiter key.
+func (n *Node) Owner(key, identifier string) string {
+	return n.ring.Owner(key + "_" + identifier)
+}
+
+// Register sets local as the limiter deciding the checks this instance owns under key, replacing any limiter
+// registered before (e.g., on reload).
+func (n *Node) Register(key string, local types.Limiter) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.limiters[key] = local
+}
+
+// Limiter returns a limiter routing each check under key to the owner of its identifier.
+// Checks owned by this instance are decided by the limiter registered under key.
+func (n *Node) Limiter(key string) types.Limiter {
+	return &limiter{node: n, key: key}
+}
+
+// limiter routes checks for one limiter key through the node.
+type limiter struct {
+	node *Node
+	key  string // Limiter key from config
+}
+
+// Allow checks if a request for the given identifier is allowed by the identifier's owner.
+func (l *limiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	return l.node.allow(ctx, l.key, identifier, 1, time.Time{})
+}
+
+// AllowN checks if a request costing n units for the given identifier is allowed by the identifier's owner.
+func (l *limiter) AllowN(ctx context.Context, identifier string, n int) (bool, error) {
+	return l.node.allow(ctx, l.key, identifier, n, time.Time{})
+}
+
+// AllowAt checks if a request for the given identifier is allowed at time t by the identifier's owner.
+func (l *limiter) AllowAt(ctx context.Context, identifier string, t time.Time) (bool, error) {
+	return l.node.allow(ctx, l.key, identifier, 1, t)
+}
+
+// KeyCount returns the number of identifiers the limiter registered under key holds state for on this instance,
+// i.e., of the identifiers this instance owns, and false if it cannot tell.
+func (l *limiter) KeyCount() (int, bool) {
+	l.node.mu.RLock()
+	local := l.node.limiters[l.key]
+	l.node.mu.RUnlock()
+	if keyCounter, ok := local.(types.KeyCounter); ok {
+		return keyCounter.KeyCount()
+	}
+	return 0, false
+}
+
+// Forget drops the identifier's state in the limiter registered under key on this instance. State held by the peer
+// owning the identifier, if another, is kept.
+func (l *limiter) Forget(identifier string) {
+	l.node.mu.RLock()
+	local, ok := l.node.limiters[l.key]
+	l.node.mu.RUnlock()
+	if ok {
+		types.Forget(local, identifier)
+	}
+}
+
+// Pressure returns the fraction of the identifier's budget in use, if this instance owns the identifier.
+// The pressure of identifiers owned by other peers is not forwarded.
+func (l *limiter) Pressure(ctx context.Context, identifier string) (float64, error) {
+	if owner := l.node.Owner(l.key, identifier); owner != "" && owner != l.node.self {
+		return 0, fmt.Errorf("%w for identifiers owned by peer '%s'", types.ErrPressureUnsupported, owner)
+	}
+	l.node.mu.RLock()
+	local, ok := l.node.limiters[l.key]
+	l.node.mu.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("limiter '%s' is not served by peer '%s'", l.key, l.node.self)
+	}
+	return types.Pressure(ctx, local, identifier)
+}
+
+// ResetTime returns the time at which the identifier's budget is fully restored, if this instance owns the identifier.
+func (l *limiter) ResetTime(ctx context.Context, identifier string) (time.Time, error) {
+	if owner := l.node.Owner(l.key, identifier); owner != "" && owner != l.node.self {
+		return time.Time{}, fmt.Errorf("%w for identifiers owned by peer '%s'", types.ErrResetTimeUnsupported, owner)
+	}
+	l.node.mu.RLock()
+	local, ok := l.node.limiters[l.key]
+	l.node.mu.RUnlock()
+	if !ok {
+		return time.Time{}, fmt.Errorf("limiter '%s' is not served by peer '%s'", l.key, l.node.self)
+	}
+	return types.ResetTime(ctx, local, identifier)
+}
+
+// Reserve reserves a request costing n units, if this instance owns the identifier. Checks of identifiers owned by
+// other peers are forwarded as AllowN is, and admitted without delay.
+func (l *limiter) Reserve(ctx context.Context, identifier string, n int, maxWait time.Duration) (types.Reservation, error) {
+	if owner := l.node.Owner(l.key, identifier); owner != "" && owner != l.node.self {
+		allowed, err := l.node.allow(ctx, l.key, identifier, n, time.Time{})
+		return types.Reservation{OK: allowed}, err
+	}
+	l.node.mu.RLock()
+	local, ok := l.node.limiters[l.key]
+	l.node.mu.RUnlock()
+	if !ok {
+		return types.Reservation{}, fmt.Errorf("limiter '%s' is not served by peer '%s'", l.key, l.node.self)
+	}
+	return types.Reserve(ctx, local, identifier, n, maxWait)
+}
+
+// AllowDetailed checks a request costing n units with its result, if this instance owns the identifier. Checks of
+// identifiers owned by other peers are forwarded as AllowN is, and their results carry only the decision.
+func (l *limiter) AllowDetailed(ctx context.Context, identifier string, n int) (types.Result, error) {
+	if owner := l.node.Owner(l.key, identifier); owner != "" && owner != l.node.self {
+		allowed, err := l.node.allow(ctx, l.key, identifier, n, time.Time{})
+		return types.Result{Allowed: allowed, Limit: -1, Remaining: -1}, err
+	}
+	l.node.mu.RLock()
+	local, ok := l.node.limiters[l.key]
+	l.node.mu.RUnlock()
+	if !ok {
+		return types.Result{}, fmt.Errorf("limiter '%s' is not served by peer '%s'", l.key, l.node.self)
+	}
+	return types.AllowDetailed(ctx, local, identifier, n)
+}
+
+// allow decides the check locally if this instance owns the identifier, and forwards it to the owner otherwise.
+// A zero t evaluates the check at the owner's wall clock.
+func (n *Node) allow(ctx context.Context, key, identifier string, hits int, t time.Time) (bool, error) {
+	owner := n.Owner(key, identifier)
+	if owner == "" || owner == n.self {
+		return n.allowLocal(ctx, key, identifier, hits, t)
+	}
+	allowed, err := n.forward(ctx, owner, key, identifier, hits, t)
+	if err != nil {
+		metrics.RecordPeerForward(key, "error")
+		log.Warn().Err(err).Str("limiter_key", key).Str("identifier", redact.Identifier(identifier)).Str("owner", owner).Bool("fail_open", n.failOpen).Msg("Peers: Forwarding check to owner failed")
+		if n.failOpen {
+			return true, nil
+		}
+		return false, err
+	}
+	metrics.RecordPeerForward(key, "ok")
+	return allowed, nil
+}
+
+// allowLocal decides the check with the limiter registered under key.
+func (n *Node) allowLocal(ctx context.Context, key, identifier string, hits int, t time.Time) (bool, error) {
+	n.mu.RLock()
+	local, ok := n.limiters[key]
+	n.mu.RUnlock()
+	if !ok {
+		return false, fmt.Errorf("limiter '%s' is not served by peer '%s'", key, n.self)
+	}
+	if !t.IsZero() {
+		if timeLimiter, ok := local.(types.TimeLimiter); ok {
+			return timeLimiter.AllowAt(ctx, identifier, t)
+		}
+		return false, fmt.Errorf("limiter '%s' does not support AllowAt", key)
+	}
+	if costLimiter, ok := local.(types.CostLimiter); ok && hits != 1 {
+		return costLimiter.AllowN(ctx, identifier, hits)
+	}
+	return local.Allow(ctx, identifier)
+}
+
+// forward sends the check to the owner and returns its decision.
+func (n *Node) forward(ctx context.Context, owner, key, identifier string, hits int, t time.Time) (bool, error) {
+	check := RateLimitReq{Name: key, UniqueKey: identifier, Hits: Int64(hits)}
+	if !t.IsZero() {
+		check.CreatedAt = Int64(t.UnixMilli())
+	}
+	body, err := json.Marshal(GetRateLimitsReq{Requests: []RateLimitReq{check}})
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peerURL(owner), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ForwardedHeader, n.self)
+	req.Header.Set("Authorization", "Bearer "+n.secret)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("peer '%s': %w", owner, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("peer '%s': unexpected status %d", owner, resp.StatusCode)
+	}
+	var result GetRateLimitsResp
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("peer '%s': decoding response: %w", owner, err)
+	}
+	if len(result.Responses) != 1 {
+		return false, fmt.Errorf("peer '%s': expected 1 response, got %d", owner, len(result.Responses))
+	}
+	if result.Responses[0].Error != "" {
+		return false, fmt.Errorf("peer '%s': %s", owner, result.Responses[0].Error)
+	}
+	return result.Responses[0].Status == StatusUnderLimit, nil
+}
+
+// peerURL returns the URL checks are forwarded to for a peer address, which is a host:port or a base URL.
+func peerURL(addr string) string {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimSuffix(addr, "/") + Path
+}
+
+// ServeHTTP decides a batch of checks. Checks forwarded by a peer are decided locally; others are routed to their owner.
+// Requests not carrying the peers' secret as a bearer token are rejected with 401.
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !n.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="peers"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var batch GetRateLimitsReq
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&batch); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	forwarded := r.Header.Get(ForwardedHeader) != ""
+
+	result := GetRateLimitsResp{Responses: make([]RateLimitResp, len(batch.Requests))}
+	for i, check := range batch.Requests {
+		hits := int(check.Hits)
+		if hits <= 0 {
+			hits = 1
+		}
+		var t time.Time
+		if check.CreatedAt > 0 {
+			t = time.UnixMilli(int64(check.CreatedAt))
+		}
+		var allowed bool
+		var err error
+		if forwarded {
+			allowed, err = n.allowLocal(r.Context(), check.Name, check.UniqueKey, hits, t)
+		} else {
+			allowed, err = n.allow(r.Context(), check.Name, check.UniqueKey, hits, t)
+		}
+		switch {
+		case err != nil:
+			result.Responses[i] = RateLimitResp{Status: StatusOverLimit, Error: err.Error()}
+		case allowed:
+			result.Responses[i] = RateLimitResp{Status: StatusUnderLimit}
+		default:
+			result.Responses[i] = RateLimitResp{Status: StatusOverLimit}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Warn().Err(err).Str("remote_addr", redact.Addr(r.RemoteAddr)).Msg("Peers: Failed to write response")
+	}
+}
+
+// authorized reports whether the request carries the peers' secret as a bearer token.
+// Fixed-length digests are compared in constant time, so response timing doesn't reveal prefixes of the secret.
+func (n *Node) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" || n.secret == "" {
+		return false
+	}
+	digest := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare(digest[:], n.secretDigest[:]) == 1
+}
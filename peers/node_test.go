@@ -0,0 +1,163 @@
+// Package peers_test contains tests for peer mode.
+package peers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/peers"
+	"learn.ratelimiter/types"
+)
+
+// countingLimiter allows up to limit requests per identifier.
+type countingLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	counts map[string]int
+}
+
+func newCountingLimiter(limit int) *countingLimiter {
+	return &countingLimiter{limit: limit, counts: make(map[string]int)}
+}
+
+func (l *countingLimiter) Allow(ctx context.Context, identifier string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[identifier] >= l.limit {
+		return false, nil
+	}
+	l.counts[identifier]++
+	return true, nil
+}
+
+func (l *countingLimiter) identifiers() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.counts)
+}
+
+// startNodes starts one node per local limiter, all serving the limiter key "api" in the same peer group.
+func startNodes(t *testing.T, failureMode config.FailureMode, locals ...types.Limiter) ([]*peers.Node, []*httptest.Server) {
+	t.Helper()
+	servers := make([]*httptest.Server, len(locals))
+	addrs := make([]string, len(locals))
+	for i := range locals {
+		servers[i] = httptest.NewUnstartedServer(nil)
+		addrs[i] = servers[i].Listener.Addr().String()
+	}
+	t.Setenv("TEST_PEER_SECRET", "peer-secret")
+	nodes := make([]*peers.Node, len(locals))
+	for i, local := range locals {
+		nodes[i] = peers.NewNode(config.PeersConfig{Self: addrs[i], Static: addrs, Timeout: time.Second, FailureMode: failureMode, SecretEnv: "TEST_PEER_SECRET"})
+		nodes[i].Register("api", local)
+		servers[i].Config.Handler = nodes[i]
+		servers[i].Start()
+		t.Cleanup(servers[i].Close)
+	}
+	return nodes, servers
+}
+
+// TestPeerModeGlobalLimit tests that checks sent to any instance are decided by the identifier's owner,
+// so the limit applies across instances and each identifier's state lives on one instance only.
+func TestPeerModeGlobalLimit(t *testing.T) {
+	locals := []*countingLimiter{newCountingLimiter(5), newCountingLimiter(5)}
+	nodes, _ := startNodes(t, config.FailClosed, locals[0], locals[1])
+
+	const identifiers = 20
+	for i := 0; i < identifiers; i++ {
+		identifier := fmt.Sprintf("client%d", i)
+		allowed := 0
+		for j := 0; j < 10; j++ {
+			ok, err := nodes[j%2].Limiter("api").Allow(context.Background(), identifier)
+			if err != nil {
+				t.Fatalf("Allow returned error: %v", err)
+			}
+			if ok {
+				allowed++
+			}
+		}
+		if allowed != 5 {
+			t.Errorf("Expected 5 requests allowed for %s across instances, got %d", identifier, allowed)
+		}
+	}
+
+	if a, b := locals[0].identifiers(), locals[1].identifiers(); a+b != identifiers || a == 0 || b == 0 {
+		t.Errorf("Expected the %d identifiers to be split between the instances, got %d and %d", identifiers, a, b)
+	}
+}
+
+// TestPeerModeOwnerUnreachable tests the failure modes applied when the owner of an identifier cannot be reached.
+func TestPeerModeOwnerUnreachable(t *testing.T) {
+	for _, tt := range []struct {
+		failureMode config.FailureMode
+		allowed     bool
+		err         bool
+	}{
+		{failureMode: config.FailClosed, allowed: false, err: true},
+		{failureMode: config.FailOpen, allowed: true, err: false},
+	} {
+		t.Run(string(tt.failureMode), func(t *testing.T) {
+			nodes, servers := startNodes(t, tt.failureMode, newCountingLimiter(5), newCountingLimiter(5))
+			servers[1].Close()
+
+			identifier := ""
+			for i := 0; identifier == ""; i++ {
+				if candidate := fmt.Sprintf("client%d", i); nodes[0].Owner("api", candidate) == servers[1].Listener.Addr().String() {
+					identifier = candidate
+				}
+			}
+			ok, err := nodes[0].Limiter("api").Allow(context.Background(), identifier)
+			if ok != tt.allowed || (err != nil) != tt.err {
+				t.Errorf("Expected (%v, error %v) when the owner is unreachable, got (%v, %v)", tt.allowed, tt.err, ok, err)
+			}
+		})
+	}
+}
+
+// TestPeerModeSecret tests that checks are only served to requests carrying the peers' secret.
+func TestPeerModeSecret(t *testing.T) {
+	_, servers := startNodes(t, config.FailClosed, newCountingLimiter(5))
+	body := `{"requests": [{"name": "api", "unique_key": "client1", "hits": 1}]}`
+	for token, want := range map[string]int{
+		"":             http.StatusUnauthorized,
+		"wrong-secret": http.StatusUnauthorized,
+		"peer-secret":  http.StatusOK,
+	} {
+		req, _ := http.NewRequest(http.MethodPost, servers[0].URL+peers.Path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Expected status %d with token %q, got %d", want, token, resp.StatusCode)
+		}
+	}
+}
+
+// TestRingOwnerStability tests that removing a peer only moves the keys it owned.
+func TestRingOwnerStability(t *testing.T) {
+	ring := peers.NewRing([]string{"a:1", "b:1", "c:1"})
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("api_client%d", i)
+		before[key] = ring.Owner(key)
+	}
+
+	ring.SetPeers([]string{"a:1", "c:1"})
+	for key, owner := range before {
+		if after := ring.Owner(key); owner != "b:1" && after != owner {
+			t.Fatalf("Expected key %s to stay on %s, moved to %s", key, owner, after)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package peers
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Path is the HTTP path checks are served at, the path of Gubernator's GetRateLimits HTTP API.
+const Path = "/v1/GetRateLimits"
+
+// ForwardedHeader marks a check forwarded by a peer, which the receiving instance decides locally instead of
+// forwarding it again, so peers with a different view of the ring cannot forward a check in circles.
+const ForwardedHeader = "X-Ratelimit-Peer-Forwarded"
+
+// Status is the outcome of a check.
+type Status string
+
+// Constants for check outcomes, as named by Gubernator.
+const (
+	StatusUnderLimit Status = "UNDER_LIMIT"
+	StatusOverLimit  Status = "OVER_LIMIT"
+)
+
+// RateLimitReq is one check. Gubernator fields describing the limit itself (limit, duration, algorithm) are ignored,
+// since limits come from the limiter configured under Name.
+type RateLimitReq struct {
+	// Name is the limiter key.
+	Name string `json:"name"`
+	// UniqueKey is the identifier.
+	UniqueKey string `json:"unique_key"`
+	// Hits is the cost of the request (default 1).
+	Hits Int64 `json:"hits,omitempty"`
+	// CreatedAt is the time the request is evaluated at, in milliseconds since the epoch (default the owner's clock).
+	CreatedAt Int64 `json:"created_at,omitempty"`
+}
+
+// RateLimitResp is the outcome of one check.
+type RateLimitResp struct {
+	Status Status `json:"status"`
+	// Error describes why the check could not be decided; Status is then StatusOverLimit.
+	Error string `json:"error,omitempty"`
+}
+
+// GetRateLimitsReq is a batch of checks.
+type GetRateLimitsReq struct {
+	Requests []RateLimitReq `json:"requests"`
+}
+
+// GetRateLimitsResp holds the outcome of each check of a GetRateLimitsReq, in the same order.
+type GetRateLimitsResp struct {
+	Responses []RateLimitResp `json:"responses"`
+}
+
+// Int64 is an integer accepting both JSON numbers and the quoted strings used for 64-bit integers by the
+// protobuf JSON mapping, as sent by Gubernator clients.
+type Int64 int64
+
+// UnmarshalJSON decodes a JSON number or a quoted integer.
+func (v *Int64) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		*v = Int64(n)
+		return nil
+	}
+	var n int64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*v = Int64(n)
+	return nil
+}
@@ -0,0 +1,70 @@
+// Package peers implements peer mode: instances agree on an owner instance for each limiter key and identifier,
+// and forward checks to it, so in-memory limiters enforce global limits without an external datastore.
+// Checks are exchanged as JSON over HTTP in the shape of Gubernator's GetRateLimits HTTP API.
+package peers
+
+import (
+	"hash/fnv"
+	"slices"
+	"sync"
+)
+
+// Ring assigns keys to peers with rendezvous (highest random weight) hashing, so adding or removing a peer only moves
+// the keys it owned or will own. Every instance must see the same peer list to agree on owners.
+type Ring struct {
+	mu    sync.RWMutex
+	peers []string
+}
+
+// NewRing creates a ring of the given peer addresses.
+func NewRing(peers []string) *Ring {
+	r := &Ring{}
+	r.SetPeers(peers)
+	return r
+}
+
+// SetPeers replaces the peer addresses, e.g., when discovery reports a change.
+func (r *Ring) SetPeers(peers []string) {
+	sorted := slices.Clone(peers)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.peers = sorted
+}
+
+// Peers returns the peer addresses, sorted.
+func (r *Ring) Peers() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.peers)
+}
+
+// Owner returns the address of the peer owning key, or "" if the ring has no peers.
+func (r *Ring) Owner(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var owner string
+	var best uint64
+	for _, peer := range r.peers {
+		h := fnv.New64a()
+		h.Write([]byte(peer))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		if weight := mix(h.Sum64()); owner == "" || weight > best {
+			owner, best = peer, weight
+		}
+	}
+	return owner
+}
+
+// mix spreads every input bit over the whole hash (the splitmix64 finalizer), since FNV leaves the high bits
+// compared by Owner nearly unaffected by the last bytes of the key.
+func mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
@@ -0,0 +1,134 @@
+// Package readonly provides the switch putting limiters in read-only mode, e.g., during a Redis migration: their checks
+// are evaluated against the current state and reported, but nothing is written to their backends.
+package readonly
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/metrics"
+)
+
+// Global is the limiter key of the entry putting every limiter in read-only mode.
+const Global = "*"
+
+// Entry describes limiters in read-only mode.
+type Entry struct {
+	// LimiterKey is the key of the limiter in read-only mode, or Global for every limiter.
+	LimiterKey string `json:"limiter_key"`
+	// ExpiresAt is when writes are re-enabled automatically; the zero value keeps read-only mode until it is cleared.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	// Reason describes why the limiters are read-only (e.g., a maintenance ticket).
+	Reason string `json:"reason,omitempty"`
+}
+
+// expired reports whether writes were re-enabled at the given time.
+func (e Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// Switch is a concurrency-safe set of read-only entries. Expiring entries are removed by a timer when they expire,
+// so the rate_limiter_read_only metric follows them.
+type Switch struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	timers  map[string]*time.Timer
+}
+
+// New creates a switch with no limiter in read-only mode.
+func New() *Switch {
+	return &Switch{entries: make(map[string]Entry), timers: make(map[string]*time.Timer)}
+}
+
+// Set puts the limiter of the entry, or every limiter, in read-only mode until it expires, replacing any entry for the
+// same key. It returns the replaced entry and whether there was one.
+func (s *Switch) Set(entry Entry) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, replaced := s.remove(entry.LimiterKey)
+	s.entries[entry.LimiterKey] = entry
+	if !entry.ExpiresAt.IsZero() {
+		s.timers[entry.LimiterKey] = time.AfterFunc(time.Until(entry.ExpiresAt), func() { s.expire(entry) })
+	}
+	metrics.SetReadOnly(entry.LimiterKey, true)
+	log.Warn().Str("limiter_key", entry.LimiterKey).Time("expires_at", entry.ExpiresAt).Str("reason", entry.Reason).Msg("ReadOnly: Limiter backend writes disabled")
+	return previous, replaced
+}
+
+// Clear re-enables writes for the limiter with the given key, or Global, and returns the removed entry if there was one.
+// Clearing a limiter's entry leaves it read-only while a Global entry is set.
+func (s *Switch) Clear(limiterKey string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.remove(limiterKey)
+	if ok {
+		log.Info().Str("limiter_key", limiterKey).Msg("ReadOnly: Limiter backend writes re-enabled")
+	}
+	return entry, ok
+}
+
+// Active reports whether the limiter with the given key is in read-only mode, by its own entry or the Global one.
+func (s *Switch) Active(limiterKey string) bool {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[Global]; ok && !entry.expired(now) {
+		return true
+	}
+	entry, ok := s.entries[limiterKey]
+	return ok && !entry.expired(now)
+}
+
+// Entries returns the entries in effect, sorted by limiter key.
+func (s *Switch) Entries() []Entry {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		if !entry.expired(now) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LimiterKey < entries[j].LimiterKey })
+	return entries
+}
+
+// Close stops the timers of expiring entries, which stay in effect until the process exits.
+func (s *Switch) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, timer := range s.timers {
+		timer.Stop()
+	}
+	clear(s.timers)
+	return nil
+}
+
+// expire removes the entry once it expired, unless it was replaced since.
+func (s *Switch) expire(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries[entry.LimiterKey] != entry {
+		return
+	}
+	s.remove(entry.LimiterKey)
+	log.Info().Str("limiter_key", entry.LimiterKey).Msg("ReadOnly: Read-only mode expired, limiter backend writes re-enabled")
+}
+
+// remove deletes the entry for the key and stops its timer. The caller holds s.mu.
+func (s *Switch) remove(limiterKey string) (Entry, bool) {
+	if timer, ok := s.timers[limiterKey]; ok {
+		timer.Stop()
+		delete(s.timers, limiterKey)
+	}
+	entry, ok := s.entries[limiterKey]
+	if ok {
+		delete(s.entries, limiterKey)
+		metrics.SetReadOnly(limiterKey, false)
+	}
+	return entry, ok
+}
@@ -0,0 +1,56 @@
+// Package readonly_test contains tests for the read-only switch.
+package readonly_test
+
+import (
+	"testing"
+	"time"
+
+	"learn.ratelimiter/readonly"
+)
+
+// TestSwitch tests that limiters are read-only by their own entry or the global one, until the entry is cleared.
+func TestSwitch(t *testing.T) {
+	sw := readonly.New()
+	defer sw.Close()
+
+	sw.Set(readonly.Entry{LimiterKey: "api"})
+	if !sw.Active("api") || sw.Active("login") {
+		t.Fatal("Expected only the limiter with an entry to be read-only")
+	}
+	sw.Set(readonly.Entry{LimiterKey: readonly.Global, Reason: "redis migration"})
+	if !sw.Active("login") {
+		t.Error("Expected every limiter to be read-only with a global entry")
+	}
+	if entries := sw.Entries(); len(entries) != 2 || entries[0].LimiterKey != readonly.Global {
+		t.Errorf("Expected the global and api entries sorted by key, got %+v", entries)
+	}
+
+	if _, ok := sw.Clear("api"); !ok {
+		t.Fatal("Expected the api entry to be cleared")
+	}
+	if !sw.Active("api") {
+		t.Error("Expected the limiter to stay read-only while the global entry is set")
+	}
+	sw.Clear(readonly.Global)
+	if sw.Active("api") {
+		t.Error("Expected writes re-enabled once every entry is cleared")
+	}
+}
+
+// TestSwitchExpiry tests that writes are re-enabled automatically once an entry expires.
+func TestSwitchExpiry(t *testing.T) {
+	sw := readonly.New()
+	defer sw.Close()
+
+	sw.Set(readonly.Entry{LimiterKey: "api", ExpiresAt: time.Now().Add(20 * time.Millisecond)})
+	if !sw.Active("api") {
+		t.Fatal("Expected the limiter to be read-only before its entry expires")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if sw.Active("api") {
+		t.Error("Expected writes re-enabled once the entry expired")
+	}
+	if entries := sw.Entries(); len(entries) != 0 {
+		t.Errorf("Expected the expired entry to be removed, got %+v", entries)
+	}
+}
@@ -0,0 +1,107 @@
+// Package redact hides identifiers (e.g., IP addresses, user IDs or API key names) in logs and error messages.
+// The mode is process-wide, like the global logger, and defaults to logging identifiers in full.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"learn.ratelimiter/config"
+)
+
+// maskedPrefixLength is the number of leading characters kept from identifiers that are not IP addresses in masked mode.
+const maskedPrefixLength = 3
+
+// mode is the current config.IdentifierLogMode.
+var mode atomic.Value
+
+// processHashKey is the random key identifiers are hashed with unless SetHashKey sets another.
+var processHashKey = make([]byte, 32)
+
+// hashKey is the current []byte key identifiers are hashed with.
+var hashKey atomic.Value
+
+func init() {
+	mode.Store(config.IdentifierLogFull)
+	if _, err := rand.Read(processHashKey); err != nil {
+		panic("redact: generating hash key: " + err.Error())
+	}
+	hashKey.Store(processHashKey)
+}
+
+// SetMode sets how identifiers are logged from now on. An empty mode logs them in full.
+func SetMode(m config.IdentifierLogMode) {
+	if m == "" {
+		m = config.IdentifierLogFull
+	}
+	mode.Store(m)
+}
+
+// Mode returns how identifiers are currently logged.
+func Mode() config.IdentifierLogMode {
+	return mode.Load().(config.IdentifierLogMode)
+}
+
+// SetHashKey sets the key identifiers are hashed with from now on. Instances sharing a key hash identifiers alike, so
+// their logs and metrics can be correlated. An empty key restores the random key of the process.
+func SetHashKey(key []byte) {
+	if len(key) == 0 {
+		key = processHashKey
+	}
+	hashKey.Store(key)
+}
+
+// Hash returns a short keyed hash (HMAC-SHA-256) of the identifier, used by hashed logs and identifier metrics.
+// Unlike a plain hash, it cannot be reversed by hashing candidate identifiers (e.g., every IPv4 address) without the key.
+func Hash(identifier string) string {
+	mac := hmac.New(sha256.New, hashKey.Load().([]byte))
+	mac.Write([]byte(identifier))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Identifier returns the identifier as it should appear in logs and error messages:
+// unchanged, as a short hash (the same one hashed identifier metrics use), or masked.
+// Masking zeroes the last octet of IPv4 addresses and all but the first 48 bits of IPv6 addresses,
+// and keeps only the first few characters of other identifiers.
+func Identifier(identifier string) string {
+	switch Mode() {
+	case config.IdentifierLogHashed:
+		return Hash(identifier)
+	case config.IdentifierLogMasked:
+		return mask(identifier)
+	default:
+		return identifier
+	}
+}
+
+// Addr returns a host:port address (e.g., http.Request.RemoteAddr) as it should appear in logs, redacting the host.
+func Addr(addr string) string {
+	if Mode() == config.IdentifierLogFull {
+		return addr
+	}
+	if addrPort, err := netip.ParseAddrPort(addr); err == nil {
+		return Identifier(addrPort.Addr().String())
+	}
+	return Identifier(addr)
+}
+
+// mask masks an IP address or truncates any other identifier.
+func mask(identifier string) string {
+	if addr, err := netip.ParseAddr(identifier); err == nil {
+		bits := 48
+		if addr.Is4() {
+			bits = 24
+		}
+		prefix, _ := addr.Prefix(bits)
+		return prefix.Addr().String()
+	}
+	if len(identifier) <= maskedPrefixLength {
+		return strings.Repeat("*", len(identifier))
+	}
+	return identifier[:maskedPrefixLength] + "***"
+}
@@ -0,0 +1,62 @@
+// Package redact_test contains tests for identifier redaction.
+package redact_test
+
+import (
+	"strings"
+	"testing"
+
+	"learn.ratelimiter/config"
+	"learn.ratelimiter/redact"
+)
+
+// TestIdentifier tests how identifiers appear in each mode.
+func TestIdentifier(t *testing.T) {
+	defer redact.SetMode(config.IdentifierLogFull)
+
+	redact.SetMode("")
+	if got := redact.Identifier("203.0.113.7"); got != "203.0.113.7" {
+		t.Errorf("Expected identifiers in full by default, got %q", got)
+	}
+
+	redact.SetMode(config.IdentifierLogMasked)
+	for identifier, want := range map[string]string{
+		"203.0.113.7":         "203.0.113.0",
+		"2001:db8:1:2:3::4":   "2001:db8:1::",
+		"user-12345":          "use***",
+		"ab":                  "**",
+		"tenant=acme|user=42": "ten***",
+	} {
+		if got := redact.Identifier(identifier); got != want {
+			t.Errorf("Expected %q to be masked as %q, got %q", identifier, want, got)
+		}
+	}
+	if got := redact.Addr("203.0.113.7:54321"); got != "203.0.113.0" {
+		t.Errorf("Expected remote address to be masked as 203.0.113.0, got %q", got)
+	}
+
+	redact.SetMode(config.IdentifierLogHashed)
+	first, second := redact.Identifier("user-12345"), redact.Identifier("user-12345")
+	if first != second || len(first) != 16 || strings.Contains(first, "12345") {
+		t.Errorf("Expected a stable 16 character hash, got %q and %q", first, second)
+	}
+}
+
+// TestHashKey tests that identifiers are hashed with the key set, and with the process's own key without one.
+func TestHashKey(t *testing.T) {
+	defer redact.SetHashKey(nil)
+
+	random := redact.Hash("203.0.113.7")
+	redact.SetHashKey([]byte("shared-secret"))
+	shared := redact.Hash("203.0.113.7")
+	if shared == random {
+		t.Error("Expected the hash to change with the key")
+	}
+	if want := "6e6efea5a04f4dc1"; shared != want {
+		t.Errorf("Expected the HMAC-SHA-256 of the identifier under the shared key, %q, got %q", want, shared)
+	}
+
+	redact.SetHashKey(nil)
+	if got := redact.Hash("203.0.113.7"); got != random {
+		t.Errorf("Expected an empty key to restore the process's key, got %q instead of %q", got, random)
+	}
+}
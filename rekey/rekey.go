@@ -0,0 +1,203 @@
+// Package rekey moves the Redis state of a limiter to another limiter key, so renaming a limiter does not reset the
+// limits of its identifiers. Keys are copied with DUMP and RESTORE, which preserves their type, value and TTL.
+package rekey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log" // Import zerolog's global logger
+
+	"learn.ratelimiter/config"
+)
+
+// DefaultSampleSize is the number of moves listed in a report when Options.SampleSize is zero.
+const DefaultSampleSize = 20
+
+// Options configures a run.
+type Options struct {
+	// DryRun only reports the keys that would be moved, without writing anything.
+	DryRun bool
+	// Copy keeps the keys under the old limiter key instead of deleting them once copied.
+	Copy bool
+	// Overwrite replaces keys already present under the new limiter key; they are skipped as conflicts otherwise.
+	Overwrite bool
+	// SampleSize caps the moves listed in the report; it defaults to DefaultSampleSize, and a negative value lists none.
+	SampleSize int
+}
+
+// Move describes one key moved, or to be moved in a dry run.
+type Move struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// TTL is the remaining time to live of the key, or zero if it does not expire.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// Conflict reports that the new key already exists.
+	Conflict bool `json:"conflict,omitempty"`
+}
+
+// Report summarizes a run.
+type Report struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	DryRun bool   `json:"dry_run"`
+	// Scanned counts the keys found under the old limiter key.
+	Scanned int `json:"scanned"`
+	// Moved counts the keys copied (and deleted unless Copy is set), or that would be in a dry run.
+	Moved int `json:"moved"`
+	// Conflicts counts the keys skipped because the new key exists and Overwrite is not set.
+	Conflicts int `json:"conflicts"`
+	// Expired counts the keys that expired between being found and being copied.
+	Expired int `json:"expired"`
+	// Sample lists the first moves, up to Options.SampleSize.
+	Sample []Move `json:"sample,omitempty"`
+}
+
+// Prefixes returns the prefixes of the Redis keys holding the state of the limiter with the given key: its
+// per-identifier state (including leaky buckets), the keys of its max_keys and unique_identifiers decorators, and the
+// per-identifier state of its write budget.
+func Prefixes(limiterKey string) []string {
+	writeKey := limiterKey + config.WriteBudgetSuffix
+	return []string{
+		limiterKey + ":",
+		"leaky_bucket:" + limiterKey + ":",
+		"max_keys:{" + limiterKey + "}:",
+		"unique_identifiers:" + limiterKey + ":",
+		writeKey + ":",
+		"leaky_bucket:" + writeKey + ":",
+	}
+}
+
+// overlap reports whether a key under one of the prefixes of a can be under one of the prefixes of b.
+func overlap(a, b []string) bool {
+	for _, prefixA := range a {
+		for _, prefixB := range b {
+			if strings.HasPrefix(prefixA, prefixB) || strings.HasPrefix(prefixB, prefixA) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Run moves the keys holding the state of the limiter key from to the limiter key to. Keys are moved one at a time,
+// so a limiter serving requests during the run may lose the updates made between a key's copy and its deletion;
+// run it while both limiters are in read-only mode or not serving requests.
+//
+// Keys of another limiter whose key starts with from followed by ":" (e.g., "api:v2" for "api") match the same
+// prefix and are moved too.
+func Run(ctx context.Context, client *redis.Client, from, to string, opts Options) (Report, error) {
+	report := Report{From: from, To: to, DryRun: opts.DryRun}
+	if from == "" || to == "" {
+		return report, errors.New("both limiter keys are required")
+	}
+	if from == to {
+		return report, fmt.Errorf("limiter key '%s' is unchanged", from)
+	}
+	if overlap(Prefixes(from), Prefixes(to)) {
+		// The keys written would match the prefix being scanned, or the other way around
+		return report, fmt.Errorf("limiter keys '%s' and '%s' overlap", from, to)
+	}
+	sampleSize := opts.SampleSize
+	if sampleSize == 0 {
+		sampleSize = DefaultSampleSize
+	}
+
+	newPrefixes := Prefixes(to)
+	for i, oldPrefix := range Prefixes(from) {
+		iter := client.Scan(ctx, 0, escapePattern(oldPrefix)+"*", 0).Iterator()
+		for iter.Next(ctx) {
+			oldKey := iter.Val()
+			move := Move{From: oldKey, To: newPrefixes[i] + strings.TrimPrefix(oldKey, oldPrefix)}
+			report.Scanned++
+			moved, err := moveKey(ctx, client, &move, opts)
+			if err != nil {
+				return report, fmt.Errorf("moving key '%s' to '%s': %w", move.From, move.To, err)
+			}
+			switch {
+			case move.Conflict:
+				report.Conflicts++
+			case !moved:
+				report.Expired++
+				continue
+			default:
+				report.Moved++
+			}
+			if len(report.Sample) < sampleSize {
+				report.Sample = append(report.Sample, move)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return report, fmt.Errorf("scanning keys with prefix '%s': %w", oldPrefix, err)
+		}
+	}
+	log.Info().Str("from", from).Str("to", to).Bool("dry_run", opts.DryRun).Int("moved", report.Moved).Int("conflicts", report.Conflicts).Msg("Rekey: Limiter keys moved")
+	return report, nil
+}
+
+// moveKey copies the key with its TTL and deletes the original unless opts.Copy is set, filling in the TTL and
+// conflict of the move. It returns false if the key expired or the new key exists and opts.Overwrite is not set.
+func moveKey(ctx context.Context, client *redis.Client, move *Move, opts Options) (bool, error) {
+	ttl, err := client.PTTL(ctx, move.From).Result()
+	if err != nil {
+		return false, err
+	}
+	if ttl == -2 { // The key expired since it was scanned
+		return false, nil
+	}
+	if ttl > 0 {
+		move.TTL = ttl
+	}
+	if opts.DryRun {
+		if !opts.Overwrite {
+			exists, err := client.Exists(ctx, move.To).Result()
+			if err != nil {
+				return false, err
+			}
+			move.Conflict = exists > 0
+		}
+		return !move.Conflict, nil
+	}
+
+	value, err := client.Dump(ctx, move.From).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if opts.Overwrite {
+		err = client.RestoreReplace(ctx, move.To, move.TTL, value).Err()
+	} else {
+		err = client.Restore(ctx, move.To, move.TTL, value).Err()
+	}
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "BUSYKEY") {
+			move.Conflict = true
+			return false, nil
+		}
+		return false, err
+	}
+	if !opts.Copy {
+		if err := client.Del(ctx, move.From).Err(); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// escapePattern escapes the glob characters of s for use in a SCAN pattern.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,87 @@
+// Package rekey_test contains tests for moving limiter state to a new limiter key.
+package rekey_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"learn.ratelimiter/internal/testenv"
+	"learn.ratelimiter/rekey"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testenv.Cleanup()
+	os.Exit(code)
+}
+
+// TestRunRejectsOverlap tests that keys whose prefixes overlap are rejected before Redis is touched.
+func TestRunRejectsOverlap(t *testing.T) {
+	for _, keys := range [][2]string{{"api", "api"}, {"api", "api:v2"}, {"api:v2", "api"}, {"api", "api#write"}, {"", "api"}} {
+		if _, err := rekey.Run(context.Background(), nil, keys[0], keys[1], rekey.Options{}); err == nil {
+			t.Errorf("Expected moving '%s' to '%s' rejected", keys[0], keys[1])
+		}
+	}
+}
+
+// TestRun tests that a dry run writes nothing, and that a run moves keys with their TTL and skips conflicts.
+func TestRun(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: testenv.Redis(t)})
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	suffix := time.Now().UnixNano()
+	from, to := fmt.Sprintf("rekey_old_%d", suffix), fmt.Sprintf("rekey_new_%d", suffix)
+	defer func() {
+		for _, limiterKey := range []string{from, to} {
+			for _, prefix := range rekey.Prefixes(limiterKey) {
+				keys, _ := client.Keys(ctx, prefix+"*").Result()
+				if len(keys) > 0 {
+					client.Del(ctx, keys...)
+				}
+			}
+		}
+	}()
+
+	client.Set(ctx, from+":client1", "1", time.Hour)
+	client.HSet(ctx, from+":client2", "tokens", "3")
+	client.Set(ctx, "leaky_bucket:"+from+":client3", "{}", 0)
+	client.Set(ctx, from+":conflict", "old", 0)
+	client.Set(ctx, to+":conflict", "new", 0)
+
+	report, err := rekey.Run(ctx, client, from, to, rekey.Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if report.Scanned != 4 || report.Moved != 3 || report.Conflicts != 1 {
+		t.Errorf("Expected 4 keys scanned, 3 to move and 1 conflict, got %+v", report)
+	}
+	if n, _ := client.Exists(ctx, to+":client1").Result(); n != 0 {
+		t.Error("Expected a dry run not to write keys")
+	}
+
+	report, err = rekey.Run(ctx, client, from, to, rekey.Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Moved != 3 || report.Conflicts != 1 {
+		t.Errorf("Expected 3 keys moved and 1 conflict, got %+v", report)
+	}
+	if ttl, _ := client.TTL(ctx, to+":client1").Result(); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected the TTL preserved, got %v", ttl)
+	}
+	if tokens, _ := client.HGet(ctx, to+":client2", "tokens").Result(); tokens != "3" {
+		t.Errorf("Expected the hash moved, got %q", tokens)
+	}
+	if n, _ := client.Exists(ctx, from+":client1", "leaky_bucket:"+from+":client3").Result(); n != 0 {
+		t.Error("Expected the old keys deleted")
+	}
+	if value, _ := client.Get(ctx, to+":conflict").Result(); value != "new" {
+		t.Errorf("Expected the existing key kept without overwrite, got %q", value)
+	}
+}
@@ -0,0 +1,162 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Dimension is one named part of a composite Key (e.g., tenant "acme").
+type Dimension struct {
+	Name  string
+	Value string
+}
+
+// Key is a composite identifier made of named dimensions, such as a tenant and a user.
+// Its canonical encoding (String) is independent of the order the dimensions were given in,
+// so every caller building a key from the same values limits the same identifier.
+type Key struct {
+	// dimensions are sorted by name, with unique names.
+	dimensions []Dimension
+}
+
+// NewKey creates a key from the dimensions. If a name is given more than once, the last value wins.
+func NewKey(dimensions ...Dimension) Key {
+	byName := make(map[string]string, len(dimensions))
+	for _, d := range dimensions {
+		byName[d.Name] = d.Value
+	}
+	sorted := make([]Dimension, 0, len(byName))
+	for name, value := range byName {
+		sorted = append(sorted, Dimension{Name: name, Value: value})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return Key{dimensions: sorted}
+}
+
+// KeyOf creates a key from alternating names and values, e.g., KeyOf("tenant", "acme", "user", "42").
+// A trailing name without a value gets an empty value.
+func KeyOf(namesAndValues ...string) Key {
+	dimensions := make([]Dimension, 0, (len(namesAndValues)+1)/2)
+	for i := 0; i < len(namesAndValues); i += 2 {
+		d := Dimension{Name: namesAndValues[i]}
+		if i+1 < len(namesAndValues) {
+			d.Value = namesAndValues[i+1]
+		}
+		dimensions = append(dimensions, d)
+	}
+	return NewKey(dimensions...)
+}
+
+// Dimensions returns the key's dimensions sorted by name.
+func (k Key) Dimensions() []Dimension {
+	return append([]Dimension(nil), k.dimensions...)
+}
+
+// Get returns the value of the named dimension, with false if the key has no such dimension.
+func (k Key) Get(name string) (string, bool) {
+	for _, d := range k.dimensions {
+		if d.Name == name {
+			return d.Value, true
+		}
+	}
+	return "", false
+}
+
+// Match reports whether the key matches the descriptor: the key must have every dimension of the descriptor,
+// with the same value unless the descriptor's value is empty, which matches any value.
+func (k Key) Match(descriptor Key) bool {
+	for _, d := range descriptor.dimensions {
+		value, ok := k.Get(d.Name)
+		if !ok || (d.Value != "" && d.Value != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Shape returns the key's dimension names joined by commas (e.g., "tenant,user"). Unlike the values,
+// the shape has low cardinality, making it suitable as a metrics label.
+func (k Key) Shape() string {
+	names := make([]string, len(k.dimensions))
+	for i, d := range k.dimensions {
+		names[i] = d.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// keyEscaper escapes the characters with a meaning in the canonical encoding.
+var keyEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, `|`, `\|`)
+
+// String returns the canonical encoding of the key, used as the identifier passed to limiters and stored by backends:
+// name=value pairs sorted by name and joined by "|", with "\", "=" and "|" escaped by a backslash.
+func (k Key) String() string {
+	var b strings.Builder
+	for i, d := range k.dimensions {
+		if i > 0 {
+			b.WriteByte('|')
+		}
+		keyEscaper.WriteString(&b, d.Name)
+		b.WriteByte('=')
+		keyEscaper.WriteString(&b, d.Value)
+	}
+	return b.String()
+}
+
+// ParseKey decodes a key from its canonical encoding.
+func ParseKey(s string) (Key, error) {
+	if s == "" {
+		return Key{}, nil
+	}
+	var dimensions []Dimension
+	var current strings.Builder
+	var name string
+	inValue := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 == len(s) {
+				return Key{}, fmt.Errorf("invalid key '%s': trailing escape", s)
+			}
+			i++
+			current.WriteByte(s[i])
+		case '=':
+			if inValue {
+				return Key{}, fmt.Errorf("invalid key '%s': unescaped '=' in value", s)
+			}
+			name, inValue = current.String(), true
+			current.Reset()
+		case '|':
+			if !inValue {
+				return Key{}, fmt.Errorf("invalid key '%s': dimension without value", s)
+			}
+			dimensions = append(dimensions, Dimension{Name: name, Value: current.String()})
+			current.Reset()
+			inValue = false
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if !inValue {
+		return Key{}, fmt.Errorf("invalid key '%s': dimension without value", s)
+	}
+	dimensions = append(dimensions, Dimension{Name: name, Value: current.String()})
+	return NewKey(dimensions...), nil
+}
+
+// KeyLimiter is implemented by limiters that accept composite keys directly.
+type KeyLimiter interface {
+	Limiter
+	// AllowKey checks if a request for the composite key is allowed.
+	AllowKey(ctx context.Context, key Key) (bool, error)
+}
+
+// AllowKey checks if a request for the composite key is allowed by the limiter,
+// using AllowKey if the limiter implements KeyLimiter and the key's canonical encoding as identifier otherwise.
+func AllowKey(ctx context.Context, limiter Limiter, key Key) (bool, error) {
+	if keyLimiter, ok := limiter.(KeyLimiter); ok {
+		return keyLimiter.AllowKey(ctx, key)
+	}
+	return limiter.Allow(ctx, key.String())
+}
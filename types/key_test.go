@@ -0,0 +1,73 @@
+// Package types_test contains tests for the shared rate limiter types.
+package types_test
+
+import (
+	"context"
+	"testing"
+
+	"learn.ratelimiter/types"
+)
+
+// TestKeyCanonicalEncoding tests that keys encode independently of dimension order and round-trip through ParseKey.
+func TestKeyCanonicalEncoding(t *testing.T) {
+	a := types.KeyOf("user", "42", "tenant", "acme")
+	b := types.NewKey(types.Dimension{Name: "tenant", Value: "acme"}, types.Dimension{Name: "user", Value: "42"})
+	if a.String() != b.String() || a.String() != "tenant=acme|user=42" {
+		t.Errorf("Expected both keys to encode as tenant=acme|user=42, got %q and %q", a, b)
+	}
+
+	// Values containing the separators cannot collide with other keys
+	tricky := types.KeyOf("tenant", "a|user=b", "path", `c\d`)
+	if tricky.String() == types.KeyOf("tenant", "a", "user", "b", "path", `c\d`).String() {
+		t.Errorf("Expected escaped values not to collide, got %q", tricky)
+	}
+	parsed, err := types.ParseKey(tricky.String())
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", tricky, err)
+	}
+	if value, _ := parsed.Get("tenant"); value != "a|user=b" || parsed.String() != tricky.String() {
+		t.Errorf("Expected round trip of %q, got %q", tricky, parsed)
+	}
+
+	for _, invalid := range []string{"tenant", "tenant=a=b", `tenant=a\`, "tenant=a|user"} {
+		if _, err := types.ParseKey(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+// TestKeyMatch tests descriptor matching and the low-cardinality shape of a key.
+func TestKeyMatch(t *testing.T) {
+	key := types.KeyOf("tenant", "acme", "user", "42", "route", "/search")
+	if !key.Match(types.KeyOf("tenant", "acme")) || !key.Match(types.KeyOf("tenant", "", "route", "/search")) {
+		t.Error("Expected key to match descriptors with equal or wildcard values")
+	}
+	if key.Match(types.KeyOf("tenant", "other")) || key.Match(types.KeyOf("region", "")) {
+		t.Error("Expected key not to match descriptors with other values or missing dimensions")
+	}
+	if shape := key.Shape(); shape != "route,tenant,user" {
+		t.Errorf("Expected shape route,tenant,user, got %q", shape)
+	}
+}
+
+// identifierLimiter records the identifier it was asked about.
+type identifierLimiter struct {
+	identifier string
+}
+
+func (l *identifierLimiter) Allow(_ context.Context, identifier string) (bool, error) {
+	l.identifier = identifier
+	return true, nil
+}
+
+// TestAllowKeyFallback tests that limiters without AllowKey receive the key's canonical encoding as identifier.
+func TestAllowKeyFallback(t *testing.T) {
+	limiter := &identifierLimiter{}
+	key := types.KeyOf("tenant", "acme", "user", "42")
+	if _, err := types.AllowKey(context.Background(), limiter, key); err != nil {
+		t.Fatalf("AllowKey failed: %v", err)
+	}
+	if limiter.identifier != key.String() {
+		t.Errorf("Expected identifier %q, got %q", key.String(), limiter.identifier)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !nomemcache
+
+package types
+
+import "github.com/bradfitz/gomemcache/memcache"
+
+// MemcacheClient is the client of the Memcache backend. Builds with the nomemcache tag replace it with a placeholder,
+// so binaries not using the Memcache backend do not link its client.
+type MemcacheClient = memcache.Client
@@ -0,0 +1,7 @@
+//go:build nomemcache
+
+package types
+
+// MemcacheClient is a placeholder for the client of the Memcache backend, which is left out of builds with the
+// nomemcache tag. No such client is ever created, so limiters using the Memcache backend cannot be created.
+type MemcacheClient struct{}
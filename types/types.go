@@ -3,6 +3,9 @@ package types
 
 import (
 	"context" // Import context
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -14,8 +17,317 @@ type Limiter interface {
 	Allow(ctx context.Context, key string) (bool, error)
 }
 
+// CostLimiter is implemented by limiters that can charge a single request more than one unit.
+type CostLimiter interface {
+	Limiter
+	// AllowN checks if a request costing n units is allowed for the given key.
+	// It returns true if the request is allowed, false otherwise, and an error if any occurred, including an error
+	// wrapping ErrInvalidCost if n is less than 1.
+	AllowN(ctx context.Context, key string, n int) (bool, error)
+}
+
+// TimeLimiter is implemented by limiters that can evaluate a request at a caller-supplied time instead of the wall clock,
+// e.g., to rate limit by event time in replay or ETL pipelines.
+// Times earlier than the latest time already seen for a key are treated as that latest time, so state never moves backwards.
+type TimeLimiter interface {
+	Limiter
+	// AllowAt checks if a request for the given key is allowed at time t.
+	AllowAt(ctx context.Context, key string, t time.Time) (bool, error)
+}
+
+// UsageLimiter is implemented by limiters that can export and import how much of each identifier's budget is in use,
+// so per-identifier state survives replacing the limiter with one using another algorithm or other parameters.
+// The conversion is best-effort: only the fraction of the budget in use is carried over, not its timing.
+type UsageLimiter interface {
+	Limiter
+	// Usage returns the fraction of the budget in use at time now, between 0 and 1, of every identifier with state.
+	Usage(now time.Time) map[string]float64
+	// SetUsage replaces the identifier's state with one where the given fraction of its budget is in use at time now.
+	SetUsage(identifier string, used float64, now time.Time)
+}
+
+// KeyCounter is implemented by limiters that can report how many identifiers they hold state for,
+// e.g., in-memory limiters and wrappers delegating to them.
+type KeyCounter interface {
+	Limiter
+	// KeyCount returns the number of identifiers with state, including idle identifiers whose state is still held,
+	// and false if the count is not known (e.g., a wrapper around a limiter keeping its state in Redis).
+	KeyCount() (int, bool)
+}
+
+// KeyForgetter is implemented by limiters that can drop the state held for an identifier, e.g., in-memory limiters
+// and wrappers delegating to them.
+type KeyForgetter interface {
+	Limiter
+	// Forget drops the state held for the given key, so its next request starts with a fresh budget.
+	Forget(key string)
+}
+
+// Forget drops the state held for the given key if the limiter implements KeyForgetter, and returns false otherwise.
+func Forget(limiter Limiter, key string) bool {
+	if keyForgetter, ok := limiter.(KeyForgetter); ok {
+		keyForgetter.Forget(key)
+		return true
+	}
+	return false
+}
+
+// PressureLimiter is implemented by limiters that can tell how close an identifier is to its limit without charging it,
+// so other subsystems (e.g., job schedulers, autoscalers) can react before denials start.
+type PressureLimiter interface {
+	Limiter
+	// Pressure returns the fraction of the budget of the given key in use now, between 0 (unused) and 1 (requests are denied).
+	Pressure(ctx context.Context, key string) (float64, error)
+}
+
+// Pressure returns the fraction of the budget of the given key in use, if the limiter implements PressureLimiter,
+// and an error wrapping ErrPressureUnsupported otherwise.
+func Pressure(ctx context.Context, limiter Limiter, key string) (float64, error) {
+	if pressureLimiter, ok := limiter.(PressureLimiter); ok {
+		return pressureLimiter.Pressure(ctx, key)
+	}
+	return 0, fmt.Errorf("%w by %T", ErrPressureUnsupported, limiter)
+}
+
+// ResetLimiter is implemented by limiters that can tell when an identifier's budget is fully restored, so clients
+// can be told when to come back.
+type ResetLimiter interface {
+	Limiter
+	// ResetTime returns the time at which the budget of the given key is fully restored if it receives no further
+	// requests, or now if none of it is in use.
+	ResetTime(ctx context.Context, key string) (time.Time, error)
+}
+
+// ResetTime returns the time at which the budget of the given key is fully restored, if the limiter implements
+// ResetLimiter, and an error wrapping ErrResetTimeUnsupported otherwise.
+func ResetTime(ctx context.Context, limiter Limiter, key string) (time.Time, error) {
+	if resetLimiter, ok := limiter.(ResetLimiter); ok {
+		return resetLimiter.ResetTime(ctx, key)
+	}
+	return time.Time{}, fmt.Errorf("%w by %T", ErrResetTimeUnsupported, limiter)
+}
+
+// Reservation is the outcome of Reserve.
+type Reservation struct {
+	// OK reports whether the request was admitted. Its units are charged, and it may proceed once Delay has elapsed.
+	OK bool
+	// Delay is how long an admitted request must wait before proceeding, or how long a denied one should wait before
+	// it is retried. It is zero for a denied request if the limiter cannot tell, or the request can never be admitted.
+	Delay time.Duration
+}
+
+// ReserveLimiter is implemented by limiters that can admit a request ahead of time, like golang.org/x/time/rate:
+// rather than denying a request the budget will cover shortly, they charge it now and tell how long it must wait.
+type ReserveLimiter interface {
+	Limiter
+	// Reserve admits a request costing n units for the given key if the budget covers it within maxWait, with the
+	// delay before it may proceed. Reserved units are not returned if the caller gives up waiting.
+	Reserve(ctx context.Context, key string, n int, maxWait time.Duration) (Reservation, error)
+}
+
+// Reserve admits a request costing n units for the given key ahead of time, if the limiter implements ReserveLimiter.
+// Other limiters are checked once, charging n units if they implement CostLimiter and a single unit otherwise, and
+// their denials carry no delay.
+func Reserve(ctx context.Context, limiter Limiter, key string, n int, maxWait time.Duration) (Reservation, error) {
+	if reserveLimiter, ok := limiter.(ReserveLimiter); ok {
+		return reserveLimiter.Reserve(ctx, key, n, maxWait)
+	}
+	var allowed bool
+	var err error
+	if costLimiter, ok := limiter.(CostLimiter); ok {
+		allowed, err = costLimiter.AllowN(ctx, key, n)
+	} else {
+		allowed, err = limiter.Allow(ctx, key)
+	}
+	return Reservation{OK: allowed}, err
+}
+
+// Result is the outcome of AllowDetailed, with what a client needs to pace itself (e.g., in X-RateLimit-* headers).
+type Result struct {
+	// Allowed reports whether the request was allowed.
+	Allowed bool
+	// Limit is the budget of the key: the limit of a window or the capacity of a bucket, or negative if the limiter
+	// cannot tell.
+	Limit int64
+	// Remaining is the number of units left in the budget after the decision, or negative if the limiter cannot tell.
+	Remaining int64
+	// ResetAt is the time at which the budget is fully restored if the key receives no further requests, or the zero
+	// time if the limiter cannot tell.
+	ResetAt time.Time
+	// RetryAfter is how long a denied request should wait before it is retried. It is zero for an allowed request,
+	// and for a denied one if the limiter cannot tell or the request can never be allowed.
+	RetryAfter time.Duration
+	// Policy is the key of the limit that denied the request, for limiters enforcing several limits (e.g., a composite
+	// limiter); Limit is then that limit's budget. It is empty for other limiters and for allowed requests.
+	Policy string
+}
+
+// DetailedLimiter is implemented by limiters that can tell, along with each decision, how much of the budget is left
+// and when it is restored, computed with the decision rather than read separately.
+type DetailedLimiter interface {
+	Limiter
+	// AllowDetailed checks if a request costing n units is allowed for the given key, charging it as AllowN does.
+	AllowDetailed(ctx context.Context, key string, n int) (Result, error)
+}
+
+// AllowDetailed checks a request costing n units for the given key, if the limiter implements DetailedLimiter.
+// Other limiters are checked once, charging n units if they implement CostLimiter and a single unit otherwise; their
+// results have a negative Limit and Remaining, and the reset time of ResetTime if they implement ResetLimiter.
+func AllowDetailed(ctx context.Context, limiter Limiter, key string, n int) (Result, error) {
+	if detailedLimiter, ok := limiter.(DetailedLimiter); ok {
+		return detailedLimiter.AllowDetailed(ctx, key, n)
+	}
+	var allowed bool
+	var err error
+	if costLimiter, ok := limiter.(CostLimiter); ok {
+		allowed, err = costLimiter.AllowN(ctx, key, n)
+	} else {
+		allowed, err = limiter.Allow(ctx, key)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Allowed: allowed, Limit: -1, Remaining: -1}
+	if resetLimiter, ok := limiter.(ResetLimiter); ok {
+		if resetAt, err := resetLimiter.ResetTime(ctx, key); err == nil {
+			result.ResetAt = resetAt
+		}
+	}
+	return result, nil
+}
+
+// IdentifierStats counts the requests decided for one identifier over a rolling window.
+type IdentifierStats struct {
+	// Allowed is the number of requests allowed in the window.
+	Allowed int64
+	// Denied is the number of requests denied in the window.
+	Denied int64
+	// Window is the length of the window counted.
+	Window time.Duration
+}
+
+// StatsLimiter is implemented by limiters counting recent decisions per identifier.
+type StatsLimiter interface {
+	Limiter
+	// Stats returns the requests allowed and denied for the given key over the limiter's rolling window.
+	Stats(ctx context.Context, key string) (IdentifierStats, error)
+}
+
+// Stats returns the requests allowed and denied for the given key, if the limiter implements StatsLimiter,
+// and an error wrapping ErrStatsUnsupported otherwise.
+func Stats(ctx context.Context, limiter Limiter, key string) (IdentifierStats, error) {
+	if statsLimiter, ok := limiter.(StatsLimiter); ok {
+		return statsLimiter.Stats(ctx, key)
+	}
+	return IdentifierStats{}, fmt.Errorf("%w by %T", ErrStatsUnsupported, limiter)
+}
+
+// Decision is one decision of a limiter for an identifier.
+type Decision struct {
+	// Time is when the request was decided.
+	Time time.Time
+	// Allowed reports whether the request was allowed.
+	Allowed bool
+	// Cost is the number of units the request was charged.
+	Cost int
+	// Remaining is the fraction of the budget left after the decision, between 0 and 1, or negative if the limiter
+	// cannot tell.
+	Remaining float64
+	// Err is the error of a failed check, in which case Allowed is false.
+	Err string
+}
+
+// HistoryLimiter is implemented by limiters keeping the latest decisions per identifier.
+type HistoryLimiter interface {
+	Limiter
+	// History returns the latest decisions for the given key, oldest first.
+	History(ctx context.Context, key string) ([]Decision, error)
+}
+
+// History returns the latest decisions for the given key, if the limiter implements HistoryLimiter, and an error
+// wrapping ErrHistoryUnsupported otherwise.
+func History(ctx context.Context, limiter Limiter, key string) ([]Decision, error) {
+	if historyLimiter, ok := limiter.(HistoryLimiter); ok {
+		return historyLimiter.History(ctx, key)
+	}
+	return nil, fmt.Errorf("%w by %T", ErrHistoryUnsupported, limiter)
+}
+
+// Operation classifies a request for limiters that keep separate read and write budgets.
+type Operation int
+
+// Constants for request operations.
+const (
+	// OperationRead is a request that does not mutate state (e.g., GET). It is the default.
+	OperationRead Operation = iota
+	// OperationWrite is a request that mutates state (e.g., POST, PUT, DELETE).
+	OperationWrite
+)
+
+// operationContextKey is the context key under which the request operation is stored.
+type operationContextKey struct{}
+
+// WithOperation returns a copy of ctx carrying the request operation.
+func WithOperation(ctx context.Context, op Operation) context.Context {
+	return context.WithValue(ctx, operationContextKey{}, op)
+}
+
+// OperationFromContext returns the request operation stored in ctx, or OperationRead if none is set.
+func OperationFromContext(ctx context.Context) Operation {
+	op, _ := ctx.Value(operationContextKey{}).(Operation)
+	return op
+}
+
+// ErrRateLimited is returned by helpers that run a call only if the limiter allows it, when the limiter denies it.
+var ErrRateLimited = errors.New("rate limiter: request rate limited")
+
+// ErrWaitTimeout is returned by Wait when a request could not be admitted within the maximum wait.
+var ErrWaitTimeout = errors.New("rate limiter: maximum wait exceeded")
+
+// ErrBackendSaturated is returned by limiters that fail closed when their bulkhead's in-flight backend calls are at capacity.
+var ErrBackendSaturated = errors.New("rate limiter: too many in-flight backend calls")
+
+// ErrBackendOutOfMemory is returned by limiters that fail closed when Redis rejects their writes for lack of memory.
+var ErrBackendOutOfMemory = errors.New("rate limiter: backend out of memory")
+
+// ErrIdentifierTooLong is returned by limiters rejecting identifiers longer than their maximum identifier length.
+var ErrIdentifierTooLong = errors.New("rate limiter: identifier too long")
+
+// ErrTooManyKeys is returned by limiters rejecting new identifiers once they track their maximum number of identifiers.
+var ErrTooManyKeys = errors.New("rate limiter: too many identifiers")
+
+// ErrPressureUnsupported is returned by Pressure for limiters that cannot tell how much of a budget is in use.
+var ErrPressureUnsupported = errors.New("rate limiter: pressure not supported")
+
+// ErrResetTimeUnsupported is returned by ResetTime for limiters that cannot tell when a budget is restored.
+var ErrResetTimeUnsupported = errors.New("rate limiter: reset time not supported")
+
+// ErrStatsUnsupported is returned by Stats for limiters not counting decisions per identifier.
+var ErrStatsUnsupported = errors.New("rate limiter: stats not supported")
+
+// ErrHistoryUnsupported is returned by History for limiters not keeping decisions per identifier.
+var ErrHistoryUnsupported = errors.New("rate limiter: history not supported")
+
 // BackendClients holds initialized backend client instances.
 type BackendClients struct {
 	// RedisClient is the Redis client instance.
 	RedisClient *redis.Client
+	// MemcacheClient is the Memcache client instance.
+	MemcacheClient *MemcacheClient
 }
+
+// ErrInvalidCost is returned by limiters for requests costing less than one unit, which would otherwise be admitted
+// without being charged, or return units to the budget.
+var ErrInvalidCost = errors.New("rate limiter: request cost must be at least 1")
+
+// CheckCost returns an error wrapping ErrInvalidCost if a request costing n units cannot be charged.
+func CheckCost(n int) error {
+	if n < 1 {
+		return fmt.Errorf("%w, got %d", ErrInvalidCost, n)
+	}
+	return nil
+}
+
+// ErrIncompatibleState is returned when stored limiter state was written by a newer release with an incompatible layout.
+// The state is left untouched; the request should be retried against an up-to-date instance or handled as a limiter error.
+var ErrIncompatibleState = errors.New("rate limiter: state written by a newer incompatible release")